@@ -0,0 +1,110 @@
+package main
+
+import (
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// accessLogger writes one structured line per request. Requests to a route
+// are logged with the route's sample rate; failed requests are always
+// logged.
+type accessLogger struct {
+	logger   *slog.Logger
+	sampling map[string]float64 // route -> fraction of requests logged
+}
+
+func newAccessLogger(sampling map[string]float64) *accessLogger {
+	return &accessLogger{
+		logger:   slog.New(slog.NewJSONHandler(os.Stdout, nil)),
+		sampling: sampling,
+	}
+}
+
+// wrap logs requests handled by h under the given route name.
+func (l *accessLogger) wrap(route string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		h.ServeHTTP(rec, r)
+
+		if rec.status < 400 && !l.sampled(route) {
+			return
+		}
+
+		attrs := []any{
+			"route", route,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"latency_ms", float64(time.Since(start).Microseconds()) / 1e3,
+			"source_ip", sourceIP(r),
+		}
+		// Slack metadata is available once the handler has parsed the form
+		for _, field := range []string{"team_id", "channel_id", "user_id"} {
+			if v := r.Form.Get(field); v != "" {
+				attrs = append(attrs, field, v)
+			}
+		}
+		l.logger.Info("request", attrs...)
+	})
+}
+
+func (l *accessLogger) sampled(route string) bool {
+	rate, ok := l.sampling[route]
+	if !ok {
+		return true
+	}
+	return rate >= 1 || rand.Float64() < rate
+}
+
+// sourceIP returns the client address, preferring the first address in
+// X-Forwarded-For as set by the Heroku router.
+func sourceIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		ip, _, _ := strings.Cut(fwd, ",")
+		return strings.TrimSpace(ip)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// statusRecorder captures the status code and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Unwrap lets handlers reach the underlying writer, as agent connections
+// do to take over theirs.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Flush lets streaming handlers flush through the recorder.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func bufferedAccessLogger(sampling map[string]float64) (*accessLogger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	l := newAccessLogger(sampling)
+	l.logger = slog.New(slog.NewJSONHandler(&buf, nil))
+	return l, &buf
+}
+
+func TestAccessLogger_LogsRequest(t *testing.T) {
+	l, buf := bufferedAccessLogger(nil)
+	h := l.wrap("webhook", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}))
+
+	data := url.Values{}
+	data.Set("team_id", "T1")
+	data.Set("channel_id", "C1")
+	req := httptest.NewRequest("POST", "/", strings.NewReader(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Failed to parse log line %q: %v", buf.String(), err)
+	}
+
+	expected := map[string]interface{}{
+		"route":      "webhook",
+		"status":     float64(http.StatusTeapot),
+		"bytes":      float64(len("short and stout")),
+		"source_ip":  "203.0.113.7",
+		"team_id":    "T1",
+		"channel_id": "C1",
+	}
+	for k, v := range expected {
+		if entry[k] != v {
+			t.Errorf("Expected %s=%v, got %v", k, v, entry[k])
+		}
+	}
+	if _, ok := entry["latency_ms"]; !ok {
+		t.Error("Expected latency_ms in log line")
+	}
+}
+
+func TestAccessLogger_Sampling(t *testing.T) {
+	l, buf := bufferedAccessLogger(map[string]float64{"metrics": 0})
+	ok := l.wrap("metrics", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	failing := l.wrap("metrics", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+
+	ok.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/debug/vars", nil))
+	if buf.Len() != 0 {
+		t.Errorf("Expected sampled-out request not to be logged, got %q", buf.String())
+	}
+
+	failing.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/debug/vars", nil))
+	if !strings.Contains(buf.String(), `"status":500`) {
+		t.Errorf("Expected failed request to be logged, got %q", buf.String())
+	}
+}
+
+func TestEnvRates(t *testing.T) {
+	t.Setenv("TEST_RATES", "metrics=0.1, webhook=1")
+	rates, err := envRates("TEST_RATES")
+	if err != nil {
+		t.Fatalf("envRates: %v", err)
+	}
+	if rates["metrics"] != 0.1 || rates["webhook"] != 1 {
+		t.Errorf("Unexpected rates %v", rates)
+	}
+
+	t.Setenv("TEST_RATES", "metrics=2")
+	if _, err := envRates("TEST_RATES"); err == nil {
+		t.Error("Expected error for rate above 1")
+	}
+}
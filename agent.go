@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// agentProtocol is the Upgrade token of agent connections. After the
+// upgrade, the server and the agent exchange agentMessages as JSON lines.
+const agentProtocol = "http-shell-agent/1"
+
+// Agent message types. The agent sends hello once, then output and result
+// for each job; the server sends run and cancel.
+const (
+	agentHello  = "hello"
+	agentRun    = "run"
+	agentCancel = "cancel"
+	agentOutput = "output"
+	agentResult = "result"
+)
+
+// agentCancelWait bounds how long a canceled job waits for its agent to
+// report the command stopped, like commandWaitDelay for local commands
+// but allowing for the round trip.
+const agentCancelWait = 3 * commandWaitDelay
+
+// agentLostExitCode is the exit code of a job whose agent disconnected
+// before it finished.
+const agentLostExitCode = 1
+
+// agentNamePattern is what agent names may look like.
+var agentNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,62}$`)
+
+// agentMessage is one line of the agent protocol. Which fields are set
+// depends on Type.
+type agentMessage struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"` // the job, for all but hello
+
+	// hello
+	Name    string       `json:"name,omitempty"`
+	Caps    []capability `json:"caps,omitempty"`
+	Version string       `json:"version,omitempty"`
+
+	// run
+	Command       string   `json:"command,omitempty"`
+	PTY           bool     `json:"pty,omitempty"`
+	Stdin         []byte   `json:"stdin,omitempty"`
+	Env           []string `json:"env,omitempty"`
+	TranslateANSI bool     `json:"translate_ansi,omitempty"`
+
+	// output
+	Data []byte `json:"data,omitempty"`
+
+	// result
+	Lines      []string `json:"lines,omitempty"`
+	Binary     []byte   `json:"binary,omitempty"`
+	ExitCode   int      `json:"exit_code,omitempty"`
+	DurationMS int64    `json:"duration_ms,omitempty"`
+}
+
+// agentHub keeps the connections of the agents that run commands on
+// other hosts, by name.
+type agentHub struct {
+	token string
+
+	mu     sync.Mutex
+	agents map[string]*agentConn
+}
+
+func newAgentHub(token string) *agentHub {
+	return &agentHub{token: token, agents: make(map[string]*agentConn)}
+}
+
+// agentConn is a connected agent.
+type agentConn struct {
+	name    string
+	caps    []capability
+	version string
+	remote  string
+	since   time.Time
+
+	conn    net.Conn
+	writeMu sync.Mutex
+	enc     *json.Encoder
+
+	mu   sync.Mutex
+	jobs map[string]*agentJob // running, by ID
+}
+
+// agentJob is a command running on an agent.
+type agentJob struct {
+	progress io.Writer
+	done     chan commandResult
+}
+
+// get returns a connected agent, or nil.
+func (h *agentHub) get(name string) *agentConn {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.agents[name]
+}
+
+// list returns the connected agents, by name.
+func (h *agentHub) list() []*agentConn {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	agents := make([]*agentConn, 0, len(h.agents))
+	for _, a := range h.agents {
+		agents = append(agents, a)
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].name < agents[j].name })
+	return agents
+}
+
+// backend describes what a connected agent can do. Builtins run on the
+// server, so an agent never offers the server's files.
+func (a *agentConn) backend() backend {
+	var caps []capability
+	for _, c := range a.caps {
+		if c == capPTY || c == capStdin {
+			caps = append(caps, c)
+		}
+	}
+	return backend{Name: "agent " + a.name, Caps: caps}
+}
+
+// send writes a message to the agent.
+func (a *agentConn) send(m agentMessage) error {
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+	return a.enc.Encode(m)
+}
+
+// run runs a command on the agent, copying its output to opts.Progress as
+// it arrives. Canceling ctx asks the agent to kill the command; its output
+// until then is still returned.
+func (a *agentConn) run(ctx context.Context, command string, opts runOptions) commandResult {
+	startTime := time.Now()
+	failed := func(err error) commandResult {
+		return commandResult{
+			Lines:    []string{fmt.Sprintf("agent %s: %v", a.name, err)},
+			ExitCode: agentLostExitCode,
+			Duration: time.Since(startTime),
+		}
+	}
+
+	msg := agentMessage{Type: agentRun, ID: randomToken()[:16], Command: command, PTY: opts.PTY, Env: opts.Env, TranslateANSI: opts.TranslateANSI}
+	if opts.Stdin != nil {
+		stdin, err := io.ReadAll(opts.Stdin)
+		if err != nil {
+			return failed(fmt.Errorf("reading input: %w", err))
+		}
+		msg.Stdin = stdin
+	}
+
+	j := &agentJob{progress: opts.Progress, done: make(chan commandResult, 1)}
+	a.mu.Lock()
+	if a.jobs == nil {
+		a.mu.Unlock()
+		return failed(errors.New("disconnected"))
+	}
+	a.jobs[msg.ID] = j
+	a.mu.Unlock()
+
+	if err := a.send(msg); err != nil {
+		a.finish(msg.ID, failed(err))
+	}
+	select {
+	case result := <-j.done:
+		return result
+	case <-ctx.Done():
+	}
+	if err := a.send(agentMessage{Type: agentCancel, ID: msg.ID}); err != nil {
+		a.finish(msg.ID, failed(err))
+	}
+	// An agent that hangs must not hold the job forever.
+	timer := time.NewTimer(agentCancelWait)
+	defer timer.Stop()
+	var result commandResult
+	select {
+	case result = <-j.done:
+	case <-timer.C:
+		a.finish(msg.ID, failed(fmt.Errorf("did not stop within %s of being canceled", agentCancelWait)))
+		result = <-j.done
+	}
+	// The agent only sees a cancellation, not why.
+	if result.ExitCode == 130 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		result.ExitCode = 124
+	}
+	return result
+}
+
+// finish ends a job with its result. Later results for it are ignored.
+func (a *agentConn) finish(id string, result commandResult) {
+	a.mu.Lock()
+	j := a.jobs[id]
+	delete(a.jobs, id)
+	a.mu.Unlock()
+	if j != nil {
+		j.done <- result
+	}
+}
+
+// serve reads the agent's messages until the connection ends, then fails
+// the jobs still running on it.
+func (a *agentConn) serve(dec *json.Decoder) error {
+	defer func() {
+		a.mu.Lock()
+		jobs := a.jobs
+		a.jobs = nil
+		a.mu.Unlock()
+		for _, j := range jobs {
+			j.done <- commandResult{Lines: []string{fmt.Sprintf("agent %s disconnected before the command finished", a.name)}, ExitCode: agentLostExitCode}
+		}
+	}()
+	for {
+		var m agentMessage
+		if err := dec.Decode(&m); err != nil {
+			return err
+		}
+		switch m.Type {
+		case agentOutput:
+			a.mu.Lock()
+			j := a.jobs[m.ID]
+			a.mu.Unlock()
+			if j != nil && j.progress != nil {
+				j.progress.Write(m.Data)
+			}
+		case agentResult:
+			a.finish(m.ID, commandResult{
+				Lines:    m.Lines,
+				Binary:   m.Binary,
+				ExitCode: m.ExitCode,
+				Duration: time.Duration(m.DurationMS) * time.Millisecond,
+			})
+		}
+	}
+}
+
+// handleAgent accepts an agent's connection. The agent authenticates with
+// AGENT_TOKEN, or its certificate on AGENTS_LISTEN_ADDR, and upgrades the
+// request to the agent protocol; the connection then stays open, and jobs
+// are sent over it, until either side closes it.
+func (s *server) handleAgent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || !strings.EqualFold(r.Header.Get("Upgrade"), agentProtocol) {
+		http.Error(w, "Upgrade to "+agentProtocol+" required", http.StatusUpgradeRequired)
+		return
+	}
+	// An agent with a verified certificate is authenticated by it, and may
+	// only use a name it was issued for; others need the token.
+	certNames := agentCertNames(r)
+	if certNames == nil {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if s.agents.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.agents.token)) != 1 {
+			logRejection(r, errors.New("invalid agent token"))
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "Cannot upgrade connection", http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: %s\r\nConnection: Upgrade\r\n\r\n", agentProtocol)
+	if err := rw.Flush(); err != nil {
+		return
+	}
+
+	dec := json.NewDecoder(rw.Reader)
+	var hello agentMessage
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if err := dec.Decode(&hello); err != nil || hello.Type != agentHello || !agentNamePattern.MatchString(hello.Name) {
+		fmt.Fprintf(os.Stderr, "Rejected agent from %s: bad hello\n", r.RemoteAddr)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	if certNames != nil && !slices.Contains(certNames, hello.Name) {
+		fmt.Fprintf(os.Stderr, "Rejected agent from %s: its certificate is for %s, not %s\n", r.RemoteAddr, strings.Join(certNames, ", "), hello.Name)
+		s.auditLog.record(auditEvent{Action: "agent_rejected", Detail: fmt.Sprintf("%s from %s: certificate for %s", hello.Name, r.RemoteAddr, strings.Join(certNames, ", "))})
+		return
+	}
+
+	a := &agentConn{
+		name:    hello.Name,
+		caps:    hello.Caps,
+		version: hello.Version,
+		remote:  r.RemoteAddr,
+		since:   time.Now(),
+		conn:    conn,
+		enc:     json.NewEncoder(conn),
+		jobs:    make(map[string]*agentJob),
+	}
+	s.agents.mu.Lock()
+	// A reconnecting agent replaces its old connection.
+	if old := s.agents.agents[a.name]; old != nil {
+		old.conn.Close()
+	}
+	s.agents.agents[a.name] = a
+	s.agents.mu.Unlock()
+	s.auditLog.record(auditEvent{Action: "agent_connected", Detail: fmt.Sprintf("%s from %s", a.name, a.remote)})
+
+	err = a.serve(dec)
+
+	s.agents.mu.Lock()
+	if s.agents.agents[a.name] == a {
+		delete(s.agents.agents, a.name)
+	}
+	s.agents.mu.Unlock()
+	s.auditLog.record(auditEvent{Action: "agent_disconnected", Detail: fmt.Sprintf("%s from %s: %v", a.name, a.remote, err)})
+}
+
+// agentFor returns the agent that runs a command's shell commands, that
+// of the host given with @ or --host= or else the channel profile's, or ""
+// to run them on the server, as with --container=.
+func (s *server) agentFor(cmd slashCommand) string {
+	if cmd.Container != "" {
+		return ""
+	}
+	if cmd.Host != "" {
+		return s.cfg.Inventory.agentOf(cmd.Host)
+	}
+	if agent := s.cfg.profileFor(cmd.ChannelID).Agent; agent != "" {
+		return s.cfg.Inventory.agentOf(agent)
+	}
+	return ""
+}
+
+// backendFor returns the backend that runs a command's shell commands. It
+// fails if that is an agent that is not connected, or a group none of
+// whose agents is.
+func (s *server) backendFor(cmd slashCommand) (backend, error) {
+	if len(cmd.Group) > 0 {
+		return s.groupBackend(cmd.Host, cmd.Group)
+	}
+	if s.dockerFor(cmd) != nil {
+		return dockerBackend, nil
+	}
+	name := s.agentFor(cmd)
+	if name == "" && s.cfg.profileFor(cmd.ChannelID).Sandbox != nil {
+		return sandboxedBackend, nil
+	}
+	if name == "" {
+		return localBackend, nil
+	}
+	a := s.agents.get(name)
+	if a == nil {
+		return backend{}, fmt.Errorf("agent %s is not connected", name)
+	}
+	return a.backend(), nil
+}
+
+// runOnAgent runs a shell command on the named agent.
+func (s *server) runOnAgent(ctx context.Context, name, command string, opts runOptions) commandResult {
+	a := s.agents.get(name)
+	if a == nil {
+		return commandResult{Lines: []string{fmt.Sprintf("agent %s is not connected", name)}, ExitCode: agentLostExitCode}
+	}
+	return a.run(ctx, command, opts)
+}
+
+// agentLines describes the connected agents, for status.
+func (h *agentHub) agentLines() []string {
+	agents := h.list()
+	if len(agents) == 0 {
+		return []string{"Agents: none connected"}
+	}
+	lines := []string{"Agents:"}
+	for _, a := range agents {
+		a.mu.Lock()
+		running := len(a.jobs)
+		a.mu.Unlock()
+		var caps []string
+		for _, c := range a.backend().Caps {
+			caps = append(caps, string(c))
+		}
+		slices.Sort(caps)
+		lines = append(lines, fmt.Sprintf("  %s %s  %s, connected %s ago, %d running (%s)",
+			a.name, a.version, a.remote, time.Since(a.since).Round(time.Second), running, strings.Join(caps, ", ")))
+	}
+	return lines
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startAgent serves s over HTTP and connects an agent named name to it.
+// It returns a function that disconnects the agent.
+func startAgent(t *testing.T, s *server, name string) (disconnect func()) {
+	t.Helper()
+	ts := httptest.NewServer(s.routes())
+	t.Cleanup(ts.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runAgent(ctx, agentConfig{ServerURL: ts.URL + "/agents", Token: s.cfg.AgentToken, Name: name}, io.Discard, io.Discard)
+		close(done)
+	}()
+	disconnect = func() {
+		cancel()
+		<-done
+	}
+	t.Cleanup(disconnect)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.agents.get(name) == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected agent %s to connect", name)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return disconnect
+}
+
+func agentServer() *server {
+	return newServer(config{AgentToken: "agent-secret", Profiles: []profile{{Name: "default", Agent: "web01"}}})
+}
+
+func TestAgent_RunsCommands(t *testing.T) {
+	s := agentServer()
+	startAgent(t, s, "web01")
+
+	data := url.Values{}
+	data.Set("text", "$ --stdin cat\n---\nfrom stdin")
+	data.Set("user_id", "U1")
+
+	response := postCommand(t, s, data)
+	if !strings.Contains(response["text"], "from stdin") || !strings.Contains(response["text"], "_success") {
+		t.Errorf("Expected the command run by the agent, got %q", response["text"])
+	}
+
+	var progress bytes.Buffer
+	result := s.runOnAgent(context.Background(), "web01", "echo streamed; exit 3", runOptions{Progress: &progress})
+	if result.ExitCode != 3 || strings.Join(result.Lines, "\n") != "streamed" {
+		t.Errorf("Expected the agent's result, got %+v", result)
+	}
+	if progress.String() != "streamed\n" {
+		t.Errorf("Expected output streamed as it was produced, got %q", progress.String())
+	}
+}
+
+func TestAgent_Cancel(t *testing.T) {
+	s := agentServer()
+	startAgent(t, s, "web01")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	result := s.runOnAgent(ctx, "web01", "sleep 10", runOptions{})
+	if result.ExitCode != 124 || time.Since(start) > 5*time.Second {
+		t.Errorf("Expected the command killed on the agent when it timed out, got %+v", result)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if result := s.runOnAgent(ctx, "web01", "sleep 10", runOptions{}); result.ExitCode != 130 {
+		t.Errorf("Expected the stopped command terminated, got %+v", result)
+	}
+}
+
+func TestAgent_CancelHungAgent(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	// The agent reads what it is sent but never answers.
+	go io.Copy(io.Discard, client)
+	a := &agentConn{name: "web01", conn: server, enc: json.NewEncoder(server), jobs: make(map[string]*agentJob)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	result := a.run(ctx, "sleep 10", runOptions{})
+	if elapsed := time.Since(start); elapsed > agentCancelWait+time.Second || !strings.Contains(strings.Join(result.Lines, "\n"), "did not stop") {
+		t.Errorf("Expected the job given up after %s, got %+v after %s", agentCancelWait, result, elapsed)
+	}
+}
+
+func TestAgent_Disconnected(t *testing.T) {
+	s := agentServer()
+	disconnect := startAgent(t, s, "web01")
+
+	done := make(chan commandResult)
+	go func() { done <- s.runOnAgent(context.Background(), "web01", "sleep 10", runOptions{}) }()
+	time.Sleep(100 * time.Millisecond)
+	disconnect()
+
+	select {
+	case result := <-done:
+		if result.ExitCode != agentLostExitCode || !strings.Contains(strings.Join(result.Lines, "\n"), "disconnected") {
+			t.Errorf("Expected the job failed when its agent went away, got %+v", result)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the job to end when its agent disconnected")
+	}
+
+	data := url.Values{}
+	data.Set("text", "$ echo hello")
+	response := postCommand(t, s, data)
+	if response["text"] != "_agent web01 is not connected_ `BACKEND_UNREACHABLE`" {
+		t.Errorf("Expected commands refused without the agent, got %q", response["text"])
+	}
+}
+
+func TestAgent_BuiltinsRunOnServer(t *testing.T) {
+	s := agentServer()
+	startAgent(t, s, "web01")
+
+	data := url.Values{}
+	data.Set("text", "$ status")
+	response := postCommand(t, s, data)
+	if !strings.Contains(response["text"], "web01") {
+		t.Errorf("Expected status to list the agent, got %q", response["text"])
+	}
+	data.Set("text", "$ sha256 /etc/hostname")
+	response = postCommand(t, s, data)
+	if !strings.Contains(response["text"], "needs files, which the agent web01 backend does not support") {
+		t.Errorf("Expected builtins reading the server's files refused, got %q", response["text"])
+	}
+}
+
+func TestDialAgent_Unauthorized(t *testing.T) {
+	s := agentServer()
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	_, err := dialAgent(context.Background(), agentConfig{ServerURL: ts.URL + "/agents", Token: "wrong", Name: "web01"})
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected the agent refused, got %v", err)
+	}
+	if s.agents.get("web01") != nil {
+		t.Error("Expected no agent registered")
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const agentUsage = `usage: http-shell agent
+       http-shell agent pin CERT_FILE
+
+Connects to an http-shell server and runs the commands it sends on this
+host. Configured with AGENT_SERVER_URL, the server's AGENTS_PATH URL such
+as https://shell.example.com/agents, AGENT_TOKEN, and AGENT_NAME, which
+defaults to the host name.
+
+For mutual TLS, AGENT_TLS_CERT and AGENT_TLS_KEY are the agent's
+certificate, used instead of AGENT_TOKEN, and AGENT_SERVER_PINS the
+comma-separated pins of the server's keys. "pin" prints the pins of the
+certificates in a file.`
+
+// agentMaxBackoff is the longest an agent waits before reconnecting.
+const agentMaxBackoff = 30 * time.Second
+
+// agentConfig is how an agent reaches its server.
+type agentConfig struct {
+	ServerURL string
+	Token     string
+	Name      string
+
+	// TLSCert and TLSKey are the agent's certificate for mutual TLS.
+	// ServerPins are the pins of the keys the server's certificate may
+	// have; without them it is verified against the system's CAs.
+	TLSCert    string
+	TLSKey     string
+	ServerPins []string
+
+	// Env is the environment commands start with, instead of the agent's.
+	Env envPolicy
+}
+
+func loadAgentConfig() (agentConfig, error) {
+	cfg := agentConfig{
+		ServerURL: os.Getenv("AGENT_SERVER_URL"),
+		Token:     getenv("AGENT_TOKEN"),
+		Name:      os.Getenv("AGENT_NAME"),
+		TLSCert:   os.Getenv("AGENT_TLS_CERT"),
+		TLSKey:    os.Getenv("AGENT_TLS_KEY"),
+	}
+	for _, pin := range envList("AGENT_SERVER_PINS") {
+		if !strings.HasPrefix(pin, pinPrefix) {
+			return cfg, fmt.Errorf("invalid AGENT_SERVER_PINS entry %q: must start with %s", pin, pinPrefix)
+		}
+		cfg.ServerPins = append(cfg.ServerPins, pin)
+	}
+	var err error
+	if cfg.Env, err = loadEnvPolicy(); err != nil {
+		return cfg, err
+	}
+	if cfg.ServerURL == "" || (cfg.Token == "" && cfg.TLSCert == "") {
+		return cfg, errors.New("AGENT_SERVER_URL and AGENT_TOKEN or AGENT_TLS_CERT are required")
+	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return cfg, errors.New("AGENT_TLS_CERT and AGENT_TLS_KEY go together")
+	}
+	if _, err := agentClientTLS(cfg); err != nil {
+		return cfg, err
+	}
+	if cfg.Name == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return cfg, fmt.Errorf("AGENT_NAME is unset and the host name is unknown: %w", err)
+		}
+		cfg.Name = host
+	}
+	if !agentNamePattern.MatchString(cfg.Name) {
+		return cfg, fmt.Errorf("invalid AGENT_NAME %q", cfg.Name)
+	}
+	return cfg, nil
+}
+
+// runAgentCommand is the agent subcommand. It runs until interrupted.
+func runAgentCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 2 && args[0] == "pin" {
+		if err := printPins(args[1], stdout); err != nil {
+			fmt.Fprintf(stderr, "agent: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	if len(args) > 0 {
+		fmt.Fprintln(stderr, agentUsage)
+		return 2
+	}
+	cfg, err := loadAgentConfig()
+	if err != nil {
+		fmt.Fprintf(stderr, "agent: %v\n", err)
+		fmt.Fprintln(stderr, agentUsage)
+		return 2
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	runAgent(ctx, cfg, stdout, stderr)
+	return 0
+}
+
+// runAgent keeps a connection to the server open until ctx is canceled,
+// reconnecting with a growing delay when it fails.
+func runAgent(ctx context.Context, cfg agentConfig, stdout, stderr io.Writer) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		start := time.Now()
+		err := serveAgent(ctx, cfg, stdout)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(start) > agentMaxBackoff {
+			backoff = time.Second
+		}
+		fmt.Fprintf(stderr, "agent: %v; reconnecting in %s\n", err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, agentMaxBackoff)
+	}
+}
+
+// serveAgent connects to the server and runs the commands it sends until
+// the connection ends or ctx is canceled. Commands still running then are
+// killed.
+func serveAgent(ctx context.Context, cfg agentConfig, stdout io.Writer) error {
+	conn, err := dialAgent(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	a := &agentRunner{enc: json.NewEncoder(conn), env: cfg.Env, jobs: make(map[string]context.CancelFunc)}
+	if err := a.send(agentMessage{Type: agentHello, Name: cfg.Name, Caps: localBackend.Caps, Version: buildVersion()}); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Agent %s connected to %s\n", cfg.Name, cfg.ServerURL)
+
+	dec := json.NewDecoder(conn)
+	for {
+		var m agentMessage
+		if err := dec.Decode(&m); err != nil {
+			return fmt.Errorf("connection lost: %w", err)
+		}
+		switch m.Type {
+		case agentRun:
+			a.start(ctx, m)
+		case agentCancel:
+			a.cancel(m.ID)
+		}
+	}
+}
+
+// dialAgent opens a connection to the server and upgrades it to the agent
+// protocol. Over https the server's certificate is verified, or its key
+// checked against the pins.
+func dialAgent(ctx context.Context, cfg agentConfig) (net.Conn, error) {
+	u, err := url.Parse(cfg.ServerURL)
+	if err != nil {
+		return nil, err
+	}
+	var dialer interface {
+		DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+	}
+	port := "80"
+	switch u.Scheme {
+	case "http":
+		dialer = &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 15 * time.Second}
+	case "https":
+		port = "443"
+		tlsConfig, err := agentClientTLS(cfg)
+		if err != nil {
+			return nil, err
+		}
+		dialer = &tls.Dialer{NetDialer: &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 15 * time.Second}, Config: tlsConfig}
+	default:
+		return nil, fmt.Errorf("AGENT_SERVER_URL must be http or https, got %q", cfg.ServerURL)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", cfg.ServerURL, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	req.Header.Set("Upgrade", agentProtocol)
+	req.Header.Set("Connection", "Upgrade")
+	if cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, fmt.Errorf("server refused the connection: %s", resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+	return bufferedConn{Conn: conn, r: br}, nil
+}
+
+// bufferedConn reads through a bufio.Reader that may hold bytes already
+// read from the connection.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// agentRunner runs the commands the server sends an agent.
+type agentRunner struct {
+	writeMu sync.Mutex
+	enc     *json.Encoder
+	env     envPolicy
+
+	mu   sync.Mutex
+	jobs map[string]context.CancelFunc // running, by ID
+}
+
+func (a *agentRunner) send(m agentMessage) error {
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+	return a.enc.Encode(m)
+}
+
+// start runs a command in the background, streaming its output to the
+// server, and sends its result when it ends.
+func (a *agentRunner) start(ctx context.Context, m agentMessage) {
+	ctx, cancel := context.WithCancel(ctx)
+	a.mu.Lock()
+	a.jobs[m.ID] = cancel
+	a.mu.Unlock()
+
+	opts := runOptions{PTY: m.PTY && ptySupported, Env: m.Env, Environ: a.env.environ(), TranslateANSI: m.TranslateANSI}
+	opts.Progress = agentOutputWriter{a: a, id: m.ID}
+	if m.Stdin != nil {
+		opts.Stdin = bytes.NewReader(m.Stdin)
+	}
+	go func() {
+		defer cancel()
+		result := runCommand(ctx, m.Command, opts)
+		a.mu.Lock()
+		delete(a.jobs, m.ID)
+		a.mu.Unlock()
+		a.send(agentMessage{
+			Type:       agentResult,
+			ID:         m.ID,
+			Lines:      result.Lines,
+			Binary:     result.Binary,
+			ExitCode:   result.ExitCode,
+			DurationMS: result.Duration.Milliseconds(),
+		})
+	}()
+}
+
+// cancel kills a running command.
+func (a *agentRunner) cancel(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if cancel := a.jobs[id]; cancel != nil {
+		cancel()
+	}
+}
+
+// agentOutputWriter sends a job's output to the server as it is
+// produced.
+type agentOutputWriter struct {
+	a  *agentRunner
+	id string
+}
+
+func (w agentOutputWriter) Write(p []byte) (int, error) {
+	// Output is still collected for the result if the connection fails,
+	// so the command is not disturbed.
+	w.a.send(agentMessage{Type: agentOutput, ID: w.id, Data: p})
+	return len(p), nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pinPrefix starts a public key pin, as in curl's --pinnedpubkey.
+const pinPrefix = "sha256/"
+
+// reloading is a value loaded from files that is loaded again when any of
+// them changes, so certificates and keys can be rotated without a restart.
+type reloading[T any] struct {
+	files []string
+	load  func() (T, error)
+
+	mu    sync.Mutex
+	value T
+	mods  []time.Time
+}
+
+func newReloading[T any](load func() (T, error), files ...string) *reloading[T] {
+	return &reloading[T]{files: files, load: load}
+}
+
+// get returns the value, loading it if a file changed since it was last
+// loaded. If loading fails, the previous value is kept.
+func (r *reloading[T]) get() (T, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	mods := make([]time.Time, len(r.files))
+	for i, f := range r.files {
+		info, err := os.Stat(f)
+		if err != nil {
+			if r.mods != nil {
+				return r.value, nil
+			}
+			return r.value, err
+		}
+		mods[i] = info.ModTime()
+	}
+	if r.mods != nil && slices.Equal(mods, r.mods) {
+		return r.value, nil
+	}
+	value, err := r.load()
+	if err != nil {
+		if r.mods != nil {
+			fmt.Fprintf(os.Stderr, "Error reloading %s, keeping the previous one: %v\n", strings.Join(r.files, " and "), err)
+			return r.value, nil
+		}
+		return value, err
+	}
+	r.value, r.mods = value, mods
+	return value, nil
+}
+
+// reloadingKeyPair loads a certificate and its key from PEM files.
+func reloadingKeyPair(certFile, keyFile string) *reloading[*tls.Certificate] {
+	return newReloading(func() (*tls.Certificate, error) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		return &cert, err
+	}, certFile, keyFile)
+}
+
+// reloadingCAPool loads a pool of CA certificates from a PEM file, which
+// may hold several, as while one CA replaces another.
+func reloadingCAPool(file string) *reloading[*x509.CertPool] {
+	return newReloading(func() (*x509.CertPool, error) {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates in %s", file)
+		}
+		return pool, nil
+	}, file)
+}
+
+// agentsTLSConfig is the TLS configuration of the agents' listener: the
+// server's certificate, and agents must present a certificate issued by
+// the client CA. The files are reloaded when they change.
+func agentsTLSConfig(cfg config) (*tls.Config, error) {
+	cert := reloadingKeyPair(cfg.AgentsTLSCert, cfg.AgentsTLSKey)
+	ca := reloadingCAPool(cfg.AgentsClientCA)
+	if _, err := cert.get(); err != nil {
+		return nil, fmt.Errorf("loading AGENTS_TLS_CERT: %w", err)
+	}
+	if _, err := ca.get(); err != nil {
+		return nil, fmt.Errorf("loading AGENTS_CLIENT_CA: %w", err)
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c, err := cert.get()
+			if err != nil {
+				return nil, err
+			}
+			pool, err := ca.get()
+			if err != nil {
+				return nil, err
+			}
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*c},
+				ClientCAs:    pool,
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+			}, nil
+		},
+	}, nil
+}
+
+// newAgentsTLSServer returns the server for AGENTS_LISTEN_ADDR, which
+// only accepts agents, over mutual TLS.
+func (s *server) newAgentsTLSServer() (*http.Server, error) {
+	tlsConfig, err := agentsTLSConfig(s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(s.routeTable.resolve(s.cfg.Paths).Agents, s.accessLog.wrap("agents", http.HandlerFunc(s.handleAgent)))
+	return &http.Server{
+		Addr:      s.cfg.AgentsListenAddr,
+		Handler:   mux,
+		TLSConfig: tlsConfig,
+		// Agent connections are taken over after the upgrade, which
+		// HTTP/2 does not allow.
+		TLSNextProto: map[string]func(*http.Server, *tls.Conn, http.Handler){},
+	}, nil
+}
+
+// agentCertNames returns the names a verified agent certificate is valid
+// for, or nil if the request came without one.
+func agentCertNames(r *http.Request) []string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+	leaf := r.TLS.VerifiedChains[0][0]
+	names := append([]string{leaf.Subject.CommonName}, leaf.DNSNames...)
+	slices.Sort(names)
+	return slices.DeleteFunc(slices.Compact(names), func(n string) bool { return n == "" })
+}
+
+// publicKeyPin returns the pin of a certificate's public key.
+func publicKeyPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return pinPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// agentClientTLS is the TLS configuration of an agent: its certificate,
+// and, if pins are given, the server's certificate must have one of their
+// public keys instead of a chain to a trusted CA. It is made again for
+// each connection, so a rotated certificate is used from the next one, and
+// giving the old and new pins lets the server's key be rotated.
+func agentClientTLS(cfg agentConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading AGENT_TLS_CERT: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if len(cfg.ServerPins) > 0 {
+		// Only the pin is checked, so the server's certificate may be
+		// self-signed or issued by a private CA.
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("the server presented no certificate")
+			}
+			pin := publicKeyPin(cs.PeerCertificates[0])
+			if !slices.Contains(cfg.ServerPins, pin) {
+				return fmt.Errorf("the server's certificate has key %s, which is not pinned", pin)
+			}
+			return nil
+		}
+	}
+	return tlsConfig, nil
+}
+
+// printPins writes the public key pin of each certificate in a PEM file,
+// for AGENT_SERVER_PINS.
+func printPins(file string, stdout io.Writer) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	found := false
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%s  %s\n", publicKeyPin(cert), cert.Subject)
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("no certificates in %s", file)
+	}
+	return nil
+}
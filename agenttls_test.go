@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string // the CA certificate, PEM
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	file := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, file: file}
+}
+
+// issue writes a certificate for name and its key to files in dir, and
+// returns their paths and the certificate's pin.
+func (ca *testCA) issue(t *testing.T, dir, name string, usage x509.ExtKeyUsage) (certFile, keyFile, pin string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return certFile, keyFile, publicKeyPin(cert)
+}
+
+// startAgentsTLS serves s's agent listener on a random port. It returns
+// the agents URL, the client CA, and the pin of the server's key.
+func startAgentsTLS(t *testing.T, s *server) (agentsURL string, clientCA *testCA, pin string) {
+	t.Helper()
+	serverCA, clientCA := newTestCA(t), newTestCA(t)
+	dir := t.TempDir()
+	s.cfg.AgentsTLSCert, s.cfg.AgentsTLSKey, pin = serverCA.issue(t, dir, "shell.example.com", x509.ExtKeyUsageServerAuth)
+	s.cfg.AgentsClientCA = clientCA.file
+
+	srv, err := s.newAgentsTLSServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeTLS(ln, "", "")
+	t.Cleanup(func() { srv.Close() })
+	return "https://" + ln.Addr().String() + "/agents", clientCA, pin
+}
+
+func mtlsAgentServer() *server {
+	return newServer(config{AgentsListenAddr: "127.0.0.1:0", Profiles: []profile{{Name: "default", Agent: "web01"}}})
+}
+
+func TestAgentsTLS_RunsCommands(t *testing.T) {
+	s := mtlsAgentServer()
+	agentsURL, clientCA, pin := startAgentsTLS(t, s)
+	certFile, keyFile, _ := clientCA.issue(t, t.TempDir(), "web01", x509.ExtKeyUsageClientAuth)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runAgent(ctx, agentConfig{ServerURL: agentsURL, Name: "web01", TLSCert: certFile, TLSKey: keyFile, ServerPins: []string{pin}}, io.Discard, io.Discard)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.agents.get("web01") == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the agent to connect with its certificate")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	data := url.Values{}
+	data.Set("text", "$ echo over mtls")
+	response := postCommand(t, s, data)
+	if !strings.Contains(response["text"], "over mtls") {
+		t.Errorf("Expected the command run by the agent, got %q", response["text"])
+	}
+
+	// Without a token, the main listener accepts no agents.
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "/agents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusUpgradeRequired {
+		t.Errorf("Expected no agents route without AGENT_TOKEN, got %s", resp.Status)
+	}
+}
+
+func TestAgentsTLS_NameMustMatchCertificate(t *testing.T) {
+	s := mtlsAgentServer()
+	agentsURL, clientCA, pin := startAgentsTLS(t, s)
+	certFile, keyFile, _ := clientCA.issue(t, t.TempDir(), "web02", x509.ExtKeyUsageClientAuth)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := serveAgent(ctx, agentConfig{ServerURL: agentsURL, Name: "web01", TLSCert: certFile, TLSKey: keyFile, ServerPins: []string{pin}}, io.Discard)
+	if err == nil || ctx.Err() != nil {
+		t.Errorf("Expected the connection closed, got %v", err)
+	}
+	if s.agents.get("web01") != nil {
+		t.Error("Expected an agent with another name's certificate refused")
+	}
+}
+
+func TestAgentsTLS_TokenCannotReplaceAgent(t *testing.T) {
+	s := newServer(config{AgentToken: "agent-secret", AgentsListenAddr: "127.0.0.1:0", Profiles: []profile{{Name: "default", Agent: "web01"}}})
+	agentsURL, clientCA, pin := startAgentsTLS(t, s)
+	certFile, keyFile, _ := clientCA.issue(t, t.TempDir(), "web01", x509.ExtKeyUsageClientAuth)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runAgent(ctx, agentConfig{ServerURL: agentsURL, Name: "web01", TLSCert: certFile, TLSKey: keyFile, ServerPins: []string{pin}}, io.Discard, io.Discard)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.agents.get("web01") == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the agent to connect with its certificate")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	real := s.agents.get("web01")
+
+	// The handler is served directly, as the main listener no longer
+	// routes agents.
+	ts := httptest.NewServer(http.HandlerFunc(s.handleAgent))
+	defer ts.Close()
+	tokenCtx, tokenCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer tokenCancel()
+	if err := serveAgent(tokenCtx, agentConfig{ServerURL: ts.URL, Token: "agent-secret", Name: "web01"}, io.Discard); err == nil || tokenCtx.Err() != nil {
+		t.Errorf("Expected the token agent refused, got %v", err)
+	}
+	if s.agents.get("web01") != real {
+		t.Error("Expected the certificate's agent kept")
+	}
+
+	t.Setenv("AGENT_TOKEN", "agent-secret")
+	t.Setenv("AGENTS_LISTEN_ADDR", ":8443")
+	t.Setenv("AGENTS_TLS_CERT", certFile)
+	t.Setenv("AGENTS_TLS_KEY", keyFile)
+	t.Setenv("AGENTS_CLIENT_CA", clientCA.file)
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "AGENT_TOKEN cannot be used with AGENTS_LISTEN_ADDR") {
+		t.Errorf("Expected the token refused with AGENTS_LISTEN_ADDR, got %v", err)
+	}
+}
+
+func TestAgentsTLS_Refused(t *testing.T) {
+	s := mtlsAgentServer()
+	agentsURL, clientCA, pin := startAgentsTLS(t, s)
+	dir := t.TempDir()
+	certFile, keyFile, _ := clientCA.issue(t, dir, "web01", x509.ExtKeyUsageClientAuth)
+	otherCert, otherKey, _ := newTestCA(t).issue(t, dir, "other", x509.ExtKeyUsageClientAuth)
+
+	tests := []struct {
+		name string
+		cfg  agentConfig
+		want string
+	}{
+		{"unpinned server", agentConfig{TLSCert: certFile, TLSKey: keyFile, ServerPins: []string{"sha256/AAAA"}}, "not pinned"},
+		{"untrusted certificate", agentConfig{TLSCert: otherCert, TLSKey: otherKey, ServerPins: []string{pin}}, ""},
+		{"no certificate", agentConfig{ServerPins: []string{pin}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.ServerURL, tt.cfg.Name = agentsURL, "other"
+			conn, err := dialAgent(context.Background(), tt.cfg)
+			if err == nil {
+				conn.Close()
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected the connection refused with %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestAgentsTLS_RotatesServerCertificate(t *testing.T) {
+	s := mtlsAgentServer()
+	agentsURL, clientCA, oldPin := startAgentsTLS(t, s)
+	dir := t.TempDir()
+	certFile, keyFile, _ := clientCA.issue(t, dir, "web01", x509.ExtKeyUsageClientAuth)
+	newCert, newKey, newPin := newTestCA(t).issue(t, dir, "shell.example.com", x509.ExtKeyUsageServerAuth)
+
+	cfg := agentConfig{ServerURL: agentsURL, Name: "web01", TLSCert: certFile, TLSKey: keyFile, ServerPins: []string{newPin}}
+	if conn, err := dialAgent(context.Background(), cfg); err == nil {
+		conn.Close()
+		t.Fatal("Expected the new key refused before the rotation")
+	}
+
+	for _, f := range [][2]string{{newCert, s.cfg.AgentsTLSCert}, {newKey, s.cfg.AgentsTLSKey}} {
+		data, err := os.ReadFile(f[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(f[1], data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(f[1], later, later)
+	}
+
+	cfg.ServerPins = []string{oldPin, newPin}
+	conn, err := dialAgent(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Expected the rotated certificate served without a restart, got %v", err)
+	}
+	conn.Close()
+}
+
+func TestPrintPins(t *testing.T) {
+	certFile, _, pin := newTestCA(t).issue(t, t.TempDir(), "shell.example.com", x509.ExtKeyUsageServerAuth)
+
+	var out bytes.Buffer
+	if code := runAgentCommand([]string{"pin", certFile}, &out, io.Discard); code != 0 {
+		t.Fatalf("Expected success, got exit code %d", code)
+	}
+	if out.String() != pin+"  CN=shell.example.com\n" {
+		t.Errorf("Expected the certificate's pin, got %q", out.String())
+	}
+}
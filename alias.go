@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	aliasUsage   = "usage: alias [--team] <name>='<command>' | alias list"
+	unaliasUsage = "usage: unalias [--team] <name>"
+)
+
+// aliasName is what an alias may be called.
+var aliasName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// errAliasNotFound is returned for aliases not defined in a scope.
+var errAliasNotFound = errors.New("no such alias")
+
+// aliasEntry is what an alias expands to, and who defined it.
+type aliasEntry struct {
+	Command string    `json:"command"`
+	UserID  string    `json:"user_id,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// aliasStore keeps aliases by scope, a channel or a team, in the backend
+// chosen by openStores.
+type aliasStore struct {
+	aliasBackend
+}
+
+// aliasBackend is where an aliasStore keeps aliases.
+type aliasBackend interface {
+	// set defines or redefines an alias.
+	set(scope, name string, e aliasEntry) error
+	// remove deletes an alias, or returns errAliasNotFound.
+	remove(scope, name string) error
+	// get returns an alias of a scope.
+	get(scope, name string) (aliasEntry, bool)
+	// list returns the aliases of a scope by name.
+	list(scope string) map[string]aliasEntry
+}
+
+// aliasFile keeps aliases in a JSON file in the data directory. The file
+// is rewritten on every change.
+type aliasFile struct {
+	path string
+
+	mu     sync.Mutex
+	scopes map[string]map[string]aliasEntry // scope key, then alias name
+}
+
+func newAliasFile(dir string) (*aliasFile, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	st := &aliasFile{path: filepath.Join(dir, "aliases.json"), scopes: map[string]map[string]aliasEntry{}}
+	data, err := os.ReadFile(st.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &st.scopes); err != nil {
+		return nil, fmt.Errorf("%s: %w", st.path, err)
+	}
+	return st, nil
+}
+
+// aliasScope returns the key aliases of a channel, or of the channel's
+// team, are kept under.
+func aliasScope(cmd slashCommand, team bool) string {
+	if team {
+		return "team:" + cmd.TeamID
+	}
+	return "channel:" + cmd.ChannelID
+}
+
+func (st *aliasFile) set(scope, name string, e aliasEntry) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.scopes[scope] == nil {
+		st.scopes[scope] = map[string]aliasEntry{}
+	}
+	previous, existed := st.scopes[scope][name]
+	st.scopes[scope][name] = e
+	if err := writeJSONFile(st.path, st.scopes); err != nil {
+		if existed {
+			st.scopes[scope][name] = previous
+		} else {
+			delete(st.scopes[scope], name)
+		}
+		return err
+	}
+	return nil
+}
+
+func (st *aliasFile) remove(scope, name string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	e, ok := st.scopes[scope][name]
+	if !ok {
+		return errAliasNotFound
+	}
+	delete(st.scopes[scope], name)
+	if err := writeJSONFile(st.path, st.scopes); err != nil {
+		st.scopes[scope][name] = e
+		return err
+	}
+	return nil
+}
+
+func (st *aliasFile) get(scope, name string) (aliasEntry, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	e, ok := st.scopes[scope][name]
+	return e, ok
+}
+
+func (st *aliasFile) list(scope string) map[string]aliasEntry {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	aliases := make(map[string]aliasEntry, len(st.scopes[scope]))
+	for name, e := range st.scopes[scope] {
+		aliases[name] = e
+	}
+	return aliases
+}
+
+// lookup finds an alias for a command's channel, then for its team.
+func (st *aliasStore) lookup(cmd slashCommand, name string) (aliasEntry, bool) {
+	if e, ok := st.get(aliasScope(cmd, false), name); ok {
+		return e, true
+	}
+	if cmd.TeamID == "" {
+		return aliasEntry{}, false
+	}
+	return st.get(aliasScope(cmd, true), name)
+}
+
+// expandAlias replaces the first word of a command with the alias it
+// names, if any. Expansion happens once: an alias that starts with
+// another alias's name is not expanded again.
+func (s *server) expandAlias(cmd slashCommand, command string) string {
+	if s.aliases == nil {
+		return command
+	}
+	name, rest, _ := strings.Cut(command, " ")
+	e, ok := s.aliases.lookup(cmd, name)
+	if !ok {
+		return command
+	}
+	if rest == "" {
+		return e.Command
+	}
+	return e.Command + " " + rest
+}
+
+func runAlias(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	fail := func(code int, msg string) commandResult {
+		return commandResult{Lines: []string{msg}, ExitCode: code, Duration: time.Since(startTime)}
+	}
+	if s.aliases == nil {
+		return fail(1, "alias needs DATA_DIR")
+	}
+	if len(args) == 0 || (len(args) == 1 && args[0] == "list") {
+		return commandResult{Lines: s.aliasLines(cmd), Duration: time.Since(startTime)}
+	}
+
+	team := args[0] == "--team"
+	if team {
+		args = args[1:]
+	}
+	name, command, ok := strings.Cut(strings.Join(args, " "), "=")
+	if !ok || len(args) == 0 {
+		return fail(2, aliasUsage)
+	}
+	command = strings.TrimSpace(command)
+	if n := len(command); n >= 2 && (command[0] == '\'' || command[0] == '"') && command[n-1] == command[0] {
+		command = command[1 : n-1]
+	}
+	if !aliasName.MatchString(name) || command == "" {
+		return fail(2, aliasUsage)
+	}
+	if _, ok := s.builtins()[name]; ok {
+		return fail(1, fmt.Sprintf("alias: %s is a builtin", name))
+	}
+	if team && cmd.TeamID == "" {
+		return fail(1, "alias: --team needs a command from a Slack team")
+	}
+
+	if err := s.aliases.set(aliasScope(cmd, team), name, aliasEntry{Command: command, UserID: cmd.UserID, Created: time.Now()}); err != nil {
+		return fail(1, "alias: "+err.Error())
+	}
+	scope := "this channel"
+	if team {
+		scope = "the team"
+	}
+	return commandResult{Lines: []string{fmt.Sprintf("%s is now an alias for %s in %s", name, command, scope)}, Duration: time.Since(startTime)}
+}
+
+func runUnalias(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	fail := func(code int, msg string) commandResult {
+		return commandResult{Lines: []string{msg}, ExitCode: code, Duration: time.Since(startTime)}
+	}
+	if s.aliases == nil {
+		return fail(1, "unalias needs DATA_DIR")
+	}
+	team := len(args) > 0 && args[0] == "--team"
+	if team {
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		return fail(2, unaliasUsage)
+	}
+	if err := s.aliases.remove(aliasScope(cmd, team), args[0]); err != nil {
+		return fail(1, fmt.Sprintf("unalias: %s: %v", args[0], err))
+	}
+	return commandResult{Lines: []string{"removed alias " + args[0]}, Duration: time.Since(startTime)}
+}
+
+// aliasLines lists the aliases of a command's channel and team. A channel
+// alias hides a team alias of the same name.
+func (s *server) aliasLines(cmd slashCommand) []string {
+	channel := s.aliases.list(aliasScope(cmd, false))
+	team := map[string]aliasEntry{}
+	if cmd.TeamID != "" {
+		team = s.aliases.list(aliasScope(cmd, true))
+	}
+
+	var lines []string
+	for _, scope := range []struct {
+		label   string
+		aliases map[string]aliasEntry
+		hidden  map[string]aliasEntry
+	}{{"channel", channel, nil}, {"team", team, channel}} {
+		names := make([]string, 0, len(scope.aliases))
+		for name := range scope.aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			line := fmt.Sprintf("%s='%s'  (%s)", name, scope.aliases[name].Command, scope.label)
+			if _, ok := scope.hidden[name]; ok {
+				line += ", hidden by the channel alias"
+			}
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return []string{"no aliases in this channel"}
+	}
+	return lines
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestAlias_DefineExpandRemove(t *testing.T) {
+	dir := t.TempDir()
+	s := newServer(config{DataDir: dir})
+	ctx := context.Background()
+	in := func(channel, text string) map[string]string {
+		return s.handleCommandExecution(ctx, slashCommand{Text: text, UserID: "U1", ChannelID: channel, TeamID: "T1"})
+	}
+
+	response := in("C1", "$ alias greet='echo hello from'")
+	if !strings.Contains(response["text"], "greet is now an alias for echo hello from in this channel") {
+		t.Fatalf("Expected the alias defined, got %q", response["text"])
+	}
+	response = in("C1", "$ greet C1")
+	if !strings.Contains(response["text"], "hello from C1") {
+		t.Errorf("Expected the alias expanded with its arguments, got %q", response["text"])
+	}
+	response = in("C2", "$ greet C2")
+	if strings.Contains(response["text"], "hello from") {
+		t.Errorf("Expected a channel alias not to apply elsewhere, got %q", response["text"])
+	}
+
+	// Team aliases apply in every channel, unless a channel alias hides them.
+	in("C1", "$ alias --team greet='echo team greeting'")
+	if response = in("C2", "$ greet"); !strings.Contains(response["text"], "team greeting") {
+		t.Errorf("Expected the team alias in another channel, got %q", response["text"])
+	}
+	if response = in("C1", "$ greet"); !strings.Contains(response["text"], "hello from") {
+		t.Errorf("Expected the channel alias to win, got %q", response["text"])
+	}
+	response = in("C1", "$ alias list")
+	if !strings.Contains(response["text"], "greet='echo hello from'  (channel)") || !strings.Contains(response["text"], "(team), hidden by the channel alias") {
+		t.Errorf("Expected both aliases listed, got %q", response["text"])
+	}
+
+	// Aliases survive a restart.
+	s = newServer(config{DataDir: dir})
+	if response = in("C1", "$ greet again"); !strings.Contains(response["text"], "hello from again") {
+		t.Errorf("Expected the alias to be reloaded, got %q", response["text"])
+	}
+
+	if response = in("C1", "$ unalias greet"); !strings.Contains(response["text"], "removed alias greet") {
+		t.Errorf("Expected the alias removed, got %q", response["text"])
+	}
+	if response = in("C1", "$ greet"); !strings.Contains(response["text"], "team greeting") {
+		t.Errorf("Expected the team alias once the channel alias is gone, got %q", response["text"])
+	}
+	if response = in("C1", "$ unalias greet"); !strings.Contains(response["text"], "no such alias") {
+		t.Errorf("Expected no channel alias left, got %q", response["text"])
+	}
+}
+
+func TestAlias_Refusals(t *testing.T) {
+	s := newServer(config{DataDir: t.TempDir()})
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"$ alias status='uptime'", "status is a builtin"},
+		{"$ alias 'bad name'=uptime", aliasUsage},
+		{"$ alias empty=''", aliasUsage},
+		{"$ unalias", unaliasUsage},
+	}
+	for _, tt := range tests {
+		response := s.handleCommandExecution(context.Background(), slashCommand{Text: tt.text, UserID: "U1", ChannelID: "C1"})
+		if !strings.Contains(response["text"], tt.want) {
+			t.Errorf("%s: expected %q, got %q", tt.text, tt.want, response["text"])
+		}
+	}
+
+	s = newServer(config{})
+	response := s.handleCommandExecution(context.Background(), slashCommand{Text: "$ alias x=uptime", UserID: "U1", ChannelID: "C1"})
+	if !strings.Contains(response["text"], "alias needs DATA_DIR") {
+		t.Errorf("Expected aliases to need DATA_DIR, got %q", response["text"])
+	}
+}
+
+func TestAlias_ChecksSeeExpansion(t *testing.T) {
+	s := newServer(config{DataDir: t.TempDir()})
+	s.handleCommandExecution(context.Background(), slashCommand{Text: "$ alias dry='echo expanded'", UserID: "U1", ChannelID: "C1"})
+	response := s.handleCommandExecution(context.Background(), slashCommand{Text: "$ dry now", UserID: "U1", ChannelID: "C1", DryRun: true})
+	if !strings.Contains(response["text"], "would run_ `echo expanded now`") {
+		t.Errorf("Expected the dry run to show the expansion, got %q", response["text"])
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ansiPattern matches ANSI escape sequences: CSI sequences such as colors
+// and cursor movement, OSC sequences such as window titles, and short
+// escapes such as charset selection.
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[ -/]*[0-~]`)
+
+// stripANSI removes escape sequences from output. Stray escape characters
+// that start no sequence are dropped too, so removing one sequence cannot
+// leave another behind, as in "\x1b\x1b[m[m".
+func stripANSI(s string) string {
+	if !strings.Contains(s, "\x1b") {
+		return s
+	}
+	return strings.ReplaceAll(ansiPattern.ReplaceAllString(s, ""), "\x1b", "")
+}
+
+// collapseRedraws applies carriage returns and backspaces within a line the
+// way a terminal would, so progress bars that redraw themselves leave only
+// their final state.
+func collapseRedraws(line string) string {
+	line = strings.TrimSuffix(line, "\r")
+	if !strings.ContainsAny(line, "\r\b") {
+		return line
+	}
+
+	var screen []rune
+	col := 0
+	for _, r := range line {
+		switch r {
+		case '\r':
+			col = 0
+		case '\b':
+			if col > 0 {
+				col--
+			}
+		default:
+			if col < len(screen) {
+				screen[col] = r
+			} else {
+				screen = append(screen, r)
+			}
+			col++
+		}
+	}
+	return string(screen)
+}
+
+// ANSI modes.
+const (
+	ansiStrip     = "strip"
+	ansiTranslate = "translate"
+)
+
+// Markers prefixed to lines colored red or green, such as failing and
+// passing tests or removed and added diff lines.
+const (
+	redLineMarker   = "🔴 "
+	greenLineMarker = "🟢 "
+)
+
+// sgrColor is the foreground color tracked by translateANSI.
+type sgrColor int
+
+const (
+	colorDefault sgrColor = iota
+	colorRed
+	colorGreen
+)
+
+// sgrState is the text style set by SGR escape sequences. It carries over
+// from one line to the next, as it does in a terminal.
+type sgrState struct {
+	bold  bool
+	color sgrColor
+}
+
+// translateANSI turns bold text into *bold* and marks lines with red or
+// green text, then strips the remaining escape sequences. Lines with both
+// are marked red.
+func translateANSI(s string) string {
+	if !strings.Contains(s, "\x1b") {
+		return s
+	}
+
+	var st sgrState
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = st.translateLine(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (st *sgrState) translateLine(line string) string {
+	var b strings.Builder
+	var red, green, open bool
+	write := func(text string) {
+		if text == "" {
+			return
+		}
+		if st.bold != open {
+			b.WriteByte('*')
+			open = st.bold
+		}
+		if strings.TrimSpace(text) != "" {
+			red = red || st.color == colorRed
+			green = green || st.color == colorGreen
+		}
+		b.WriteString(text)
+	}
+
+	last := 0
+	for _, loc := range ansiPattern.FindAllStringIndex(line, -1) {
+		write(line[last:loc[0]])
+		st.apply(line[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	write(line[last:])
+	if open {
+		b.WriteByte('*')
+	}
+
+	switch {
+	case red:
+		return redLineMarker + b.String()
+	case green:
+		return greenLineMarker + b.String()
+	}
+	return b.String()
+}
+
+// apply updates the state from an escape sequence. Sequences other than
+// SGR are ignored.
+func (st *sgrState) apply(seq string) {
+	if !strings.HasPrefix(seq, "\x1b[") || !strings.HasSuffix(seq, "m") {
+		return
+	}
+
+	params := strings.Split(seq[2:len(seq)-1], ";")
+	for i := 0; i < len(params); i++ {
+		switch params[i] {
+		case "", "0", "00":
+			*st = sgrState{}
+		case "1", "01":
+			st.bold = true
+		case "22":
+			st.bold = false
+		case "31", "91":
+			st.color = colorRed
+		case "32", "92":
+			st.color = colorGreen
+		case "39":
+			st.color = colorDefault
+		case "38":
+			st.color = colorDefault
+			i += extendedColorParams(params[i+1:])
+		case "48":
+			i += extendedColorParams(params[i+1:])
+		default:
+			// Any other foreground color
+			if n, err := strconv.Atoi(params[i]); err == nil && (n >= 30 && n <= 37 || n >= 90 && n <= 97) {
+				st.color = colorDefault
+			}
+		}
+	}
+}
+
+// extendedColorParams returns how many parameters follow 38 or 48: two
+// for 5;n and four for 2;r;g;b.
+func extendedColorParams(rest []string) int {
+	if len(rest) > 0 {
+		switch rest[0] {
+		case "5":
+			return 2
+		case "2":
+			return 4
+		}
+	}
+	return 0
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripANSI(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"plain", "hello", "hello"},
+		{"color", "\x1b[01;34mdir\x1b[0m file", "dir file"},
+		{"cursor movement", "\x1b[2K\x1b[1Gdone", "done"},
+		{"window title", "\x1b]0;title\x07prompt", "prompt"},
+		{"two byte escape", "\x1b(Btext", "text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripANSI(tt.input); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCollapseRedraws(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"plain", "hello", "hello"},
+		{"crlf", "hello\r", "hello"},
+		{"progress bar", "10%\r50%\r100%", "100%"},
+		{"partial overwrite", "abcdef\rXY", "XYcdef"},
+		{"backspace", "ab\bc", "ac"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := collapseRedraws(tt.input); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestExecuteCommand_StripsANSI(t *testing.T) {
+	result := executeCommand(`printf '\033[31mred\033[0m\n0%%\r100%%\n'`, "$ colors")
+
+	if strings.Contains(result, "\x1b") || strings.Contains(result, "\r") {
+		t.Errorf("Expected escape sequences to be removed, got %q", result)
+	}
+	if !strings.Contains(result, "red\n100%") {
+		t.Errorf("Expected cleaned output, got %q", result)
+	}
+}
+
+func TestTranslateANSI(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"plain", "hello", "hello"},
+		{"bold", "\x1b[1mFAIL\x1b[0m done", "*FAIL* done"},
+		{"red line", "\x1b[31m- removed\x1b[0m", "🔴 - removed"},
+		{"green line", "\x1b[32m+ added\x1b[39m", "🟢 + added"},
+		{"red wins", "\x1b[32mok\x1b[0m \x1b[91mfailed\x1b[0m", "🔴 ok failed"},
+		{"style carries over lines", "\x1b[1;31mone\ntwo\x1b[0m\nthree", "🔴 *one*\n🔴 *two*\nthree"},
+		{"colored whitespace only", "\x1b[31m \x1b[0mtext", " text"},
+		{"extended color", "\x1b[38;5;1mtext\x1b[0m", "text"},
+		{"other escapes", "\x1b[2K\x1b]0;title\x07\x1b[32mPASS\x1b[0m", "🟢 PASS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripANSI(translateANSI(tt.input)); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func FuzzTranslateANSI(f *testing.F) {
+	for _, seed := range []string{
+		"\x1b[1;31mone\ntwo\x1b[0m\nthree",
+		"\x1b[38;5;1mtext\x1b[0m",
+		"\x1b[38;2;1;2;3;48;5mx",
+		"\x1b[38",
+		"\x1b]0;title",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		out := translateANSI(s)
+		if strings.Count(out, "\n") != strings.Count(s, "\n") {
+			t.Fatalf("Expected lines to be kept, got %q from %q", out, s)
+		}
+	})
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reasons an approval cannot be decided.
+var (
+	errApprovalNotFound = errors.New("approval request not found")
+	errApprovalExpired  = errors.New("approval request expired")
+	errSelfApproval     = errors.New("commands must be approved by another user")
+	errNotApprover      = errors.New("you are not an approver")
+	errNotRequester     = errors.New("only the user who ran the command can confirm it")
+)
+
+// Approval actions.
+const (
+	actionApprove = "approve"
+	actionDeny    = "deny"
+)
+
+// approval is a command waiting for a second user to approve it.
+type approval struct {
+	ID      string
+	Cmd     slashCommand
+	Command string
+	Reason  string
+	Expires time.Time
+}
+
+// approvalQueue holds pending approvals until they are decided or expire.
+type approvalQueue struct {
+	ttl       time.Duration
+	approvers map[string]bool // empty allows any user but the requester
+	now       func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]*approval
+}
+
+func newApprovalQueue(ttl time.Duration, approvers []string) *approvalQueue {
+	q := &approvalQueue{
+		ttl:       ttl,
+		approvers: make(map[string]bool),
+		now:       time.Now,
+		pending:   make(map[string]*approval),
+	}
+	for _, id := range approvers {
+		q.approvers[id] = true
+	}
+	return q
+}
+
+// add queues a command for approval, dropping expired requests.
+func (q *approvalQueue) add(cmd slashCommand, command, reason string) *approval {
+	a := &approval{
+		ID:      randomToken()[:12],
+		Cmd:     cmd,
+		Command: command,
+		Reason:  reason,
+		Expires: q.now().Add(q.ttl),
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for id, p := range q.pending {
+		if q.now().After(p.Expires) {
+			delete(q.pending, id)
+		}
+	}
+	q.pending[a.ID] = a
+	return a
+}
+
+// decide removes a pending approval on behalf of userID. Approving needs an
+// approver other than the requester; the requester may also deny, which
+// withdraws the request.
+func (q *approvalQueue) decide(id, userID string, approve bool) (*approval, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	a, ok := q.pending[id]
+	if !ok {
+		return nil, errApprovalNotFound
+	}
+	if q.now().After(a.Expires) {
+		delete(q.pending, id)
+		return a, errApprovalExpired
+	}
+	requester := userID == a.Cmd.UserID
+	if approve && requester {
+		return nil, errSelfApproval
+	}
+	if !requester && len(q.approvers) > 0 && !q.approvers[userID] {
+		return nil, errNotApprover
+	}
+	delete(q.pending, id)
+	return a, nil
+}
+
+// take removes a pending request on behalf of its requester, as when a
+// user confirms their own command.
+func (q *approvalQueue) take(id, userID string) (*approval, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	a, ok := q.pending[id]
+	if !ok {
+		return nil, errApprovalNotFound
+	}
+	if a.Cmd.UserID != userID {
+		return nil, errNotRequester
+	}
+	delete(q.pending, id)
+	if q.now().After(a.Expires) {
+		return a, errApprovalExpired
+	}
+	return a, nil
+}
+
+// peek returns a pending request of userID's without removing it, as when
+// a modal's input is checked before the modal closes.
+func (q *approvalQueue) peek(id, userID string) (*approval, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	a, ok := q.pending[id]
+	if !ok || a.Cmd.UserID != userID || q.now().After(a.Expires) {
+		return nil, false
+	}
+	return a, true
+}
+
+// approvalReason reports whether a command needs approval, either because
+// the policy says so or because it matches an approval pattern.
+func (s *server) approvalReason(command string, d policyDecision) (string, bool) {
+	if d.Decision == policyApprove {
+		return d.Reason, true
+	}
+	for _, re := range s.cfg.ApprovalPatterns {
+		if re.MatchString(command) {
+			return "matches " + re.String(), true
+		}
+	}
+	return "", false
+}
+
+// requestApproval posts an approval request with Approve and Deny buttons
+// to the channel and tells the requester. Without interactivity or a
+// response_url to post to, the command is refused.
+func (s *server) requestApproval(ctx context.Context, cmd slashCommand, command, reason string) map[string]string {
+	if !s.cfg.Interactivity || cmd.ResponseURL == "" {
+		return failure(codeApprovalRequired, formatDenied("requires approval", reason))
+	}
+
+	cmd.Reviewed = &reviewedCommand{Command: command, Env: s.channelEnv(cmd)}
+	a := s.approvals.add(cmd, command, reason)
+	s.auditLog.record(auditEvent{
+		Action:    "approval_requested",
+		UserID:    cmd.UserID,
+		ChannelID: cmd.ChannelID,
+		TeamID:    cmd.TeamID,
+		Command:   s.displayText(cmd),
+		Detail:    reason,
+	})
+
+	text := fmt.Sprintf("<@%s> requests approval to run `%s`", cmd.UserID, s.displayText(cmd))
+	if reason != "" {
+		text += " (" + reason + ")"
+	}
+	text += fmt.Sprintf("\n_expires in %s_", s.approvals.ttl)
+	message := map[string]interface{}{
+		"response_type": "in_channel",
+		"text":          text,
+		"blocks": []block{
+			sectionBlock(text),
+			actionsBlock(
+				button(actionApprove, "Approve", a.ID, "primary"),
+				button(actionDeny, "Deny", a.ID, "danger"),
+			),
+		},
+	}
+	if err := postWebhook(ctx, s.client, cmd.ResponseURL, message); err != nil {
+		fmt.Fprintf(os.Stderr, "Error posting approval request: %v\n", err)
+		return failure(codeApprovalRequired, formatDenied("requires approval", reason))
+	}
+	return ephemeral("_waiting for approval_")
+}
+
+// decideApproval handles a click on Approve or Deny and returns the message
+// that replaces the request. An approved command runs in the background as
+// the requester, and its result is posted to the requester's response_url.
+func (s *server) decideApproval(p interactionPayload, id string, approve bool) map[string]string {
+	a, err := s.approvals.decide(id, p.User.ID, approve)
+	if errors.Is(err, errApprovalExpired) {
+		s.auditApproval(a, "approval_expired", p.User.ID)
+		return map[string]string{
+			"replace_original": "true",
+			"text":             fmt.Sprintf("_approval expired_ `%s`", s.displayText(a.Cmd)),
+		}
+	}
+	if err != nil {
+		return map[string]string{
+			"response_type":    "ephemeral",
+			"replace_original": "false",
+			"text":             fmt.Sprintf("_cannot decide: %v_", err),
+		}
+	}
+
+	if !approve {
+		s.auditApproval(a, "approval_denied", p.User.ID)
+		return map[string]string{
+			"replace_original": "true",
+			"text":             fmt.Sprintf("_denied by <@%s>_ `%s`", p.User.ID, s.displayText(a.Cmd)),
+		}
+	}
+
+	s.auditApproval(a, "approval_granted", p.User.ID)
+	cmd := a.Cmd
+	cmd.ApprovedBy = p.User.ID
+	if cmd.ResponseURL == "" {
+		cmd.ResponseURL = p.ResponseURL
+	}
+	go func() {
+		ctx := context.Background()
+		message := s.respond(ctx, cmd)
+		if err := postWebhook(ctx, s.client, cmd.ResponseURL, message); err != nil {
+			fmt.Fprintf(os.Stderr, "Error posting approved command result: %v\n", err)
+		}
+	}()
+	return map[string]string{
+		"replace_original": "true",
+		"text":             fmt.Sprintf("_approved by <@%s>_ `%s`", p.User.ID, s.displayText(a.Cmd)),
+	}
+}
+
+// auditApproval records a decision on an approval request.
+func (s *server) auditApproval(a *approval, action, deciderID string) {
+	s.auditLog.record(auditEvent{
+		Action:    action,
+		UserID:    deciderID,
+		ChannelID: a.Cmd.ChannelID,
+		TeamID:    a.Cmd.TeamID,
+		Command:   s.displayText(a.Cmd),
+		Detail:    "requested by " + a.Cmd.UserID,
+	})
+}
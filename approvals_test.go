@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApprovalQueue_Decide(t *testing.T) {
+	q := newApprovalQueue(time.Minute, []string{"U3"})
+	a := q.add(slashCommand{UserID: "U1"}, "rm x", "")
+
+	if _, err := q.decide(a.ID, "U1", true); err != errSelfApproval {
+		t.Errorf("Expected self approval to be refused, got %v", err)
+	}
+	if _, err := q.decide(a.ID, "U2", true); err != errNotApprover {
+		t.Errorf("Expected non-approver to be refused, got %v", err)
+	}
+	if _, err := q.decide(a.ID, "U3", true); err != nil {
+		t.Errorf("Expected approver to approve, got %v", err)
+	}
+	if _, err := q.decide(a.ID, "U3", true); err != errApprovalNotFound {
+		t.Errorf("Expected request to be gone after approval, got %v", err)
+	}
+
+	withdrawn := q.add(slashCommand{UserID: "U1"}, "rm x", "")
+	if _, err := q.decide(withdrawn.ID, "U1", false); err != nil {
+		t.Errorf("Expected requester to withdraw, got %v", err)
+	}
+
+	expired := q.add(slashCommand{UserID: "U1"}, "rm x", "")
+	q.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if _, err := q.decide(expired.ID, "U3", true); err != errApprovalExpired {
+		t.Errorf("Expected expired request, got %v", err)
+	}
+}
+
+func TestApproval_RunsAfterSecondUserApproves(t *testing.T) {
+	ts, messages := messageRecorder(t)
+	dir := t.TempDir()
+	s := newServer(config{
+		Interactivity:    true,
+		ApprovalPatterns: []*regexp.Regexp{regexp.MustCompile(`^echo approved`)},
+		ApprovalTTL:      time.Minute,
+		DataDir:          dir,
+	})
+
+	cmd := slashCommand{Text: "$ echo approved", UserID: "U1", ChannelID: "C1", ResponseURL: ts.URL}
+	if response := s.handleCommandExecution(context.Background(), cmd); response["text"] != "_waiting for approval_" {
+		t.Fatalf("Expected command to wait for approval, got %q", response["text"])
+	}
+
+	request := <-messages
+	if request["response_type"] != "in_channel" || !strings.Contains(request["text"].(string), "<@U1> requests approval") {
+		t.Fatalf("Expected approval request in channel, got %v", request)
+	}
+	id := buttonValue(t, request, actionApprove)
+
+	clickButton(t, s, "U1", actionApprove, id, ts.URL)
+	if text := (<-messages)["text"].(string); !strings.Contains(text, errSelfApproval.Error()) {
+		t.Errorf("Expected self approval to be refused, got %q", text)
+	}
+
+	clickButton(t, s, "U2", actionApprove, id, ts.URL)
+	if text := (<-messages)["text"].(string); !strings.Contains(text, "approved by <@U2>") {
+		t.Errorf("Expected request to be marked approved, got %q", text)
+	}
+
+	if m := nextResult(t, messages); !strings.Contains(m["text"].(string), "approved\n") {
+		t.Errorf("Expected command output, got %v", m)
+	}
+
+	audit := auditLogText(t, dir)
+	for _, action := range []string{`"action":"approval_requested","user_id":"U1"`, `"action":"approval_granted","user_id":"U2"`} {
+		if !strings.Contains(audit, action) {
+			t.Errorf("Expected audit log to contain %s, got %s", action, audit)
+		}
+	}
+}
+
+func TestApproval_RefusedWithoutInteractivity(t *testing.T) {
+	s := newServer(config{ApprovalPatterns: []*regexp.Regexp{regexp.MustCompile(`^rm `)}})
+
+	response := s.handleCommandExecution(context.Background(), slashCommand{Text: "$ rm -rf /tmp/x"})
+	if response["text"] != "_requires approval: matches ^rm _ `APPROVAL_REQUIRED`" {
+		t.Errorf("Expected refusal, got %q", response["text"])
+	}
+}
+
+func TestApproval_RunsWhatWasReviewed(t *testing.T) {
+	ts, messages := messageRecorder(t)
+	s := newServer(config{
+		Interactivity:    true,
+		ApprovalPatterns: []*regexp.Regexp{regexp.MustCompile(`^echo `)},
+		ApprovalTTL:      time.Minute,
+		DataDir:          t.TempDir(),
+	})
+	ctx := context.Background()
+	in := func(text string) map[string]string {
+		return s.handleCommandExecution(ctx, slashCommand{Text: text, UserID: "U1", ChannelID: "C1"})
+	}
+	request := func(text string) string {
+		t.Helper()
+		cmd := slashCommand{Text: text, UserID: "U1", ChannelID: "C1", ResponseURL: ts.URL}
+		if response := s.handleCommandExecution(ctx, cmd); response["text"] != "_waiting for approval_" {
+			t.Fatalf("Expected %q to wait for approval, got %q", text, response["text"])
+		}
+		return buttonValue(t, <-messages, actionApprove)
+	}
+
+	// The channel's variables are those the command was to run with.
+	in("$ set GREETING=reviewed")
+	id := request("$ echo $GREETING")
+	in("$ set GREETING=changed")
+	clickButton(t, s, "U2", actionApprove, id, ts.URL)
+	if m := nextResult(t, messages); !strings.Contains(m["text"].(string), "\nreviewed") {
+		t.Errorf("Expected the variables the command was reviewed with, got %v", m)
+	}
+
+	// A command that no longer expands to what was approved is refused.
+	in("$ alias deploy='echo safe'")
+	id = request("$ deploy")
+	in("$ alias deploy='echo rm -rf /'")
+	clickButton(t, s, "U2", actionApprove, id, ts.URL)
+	for {
+		select {
+		case m := <-messages:
+			text := m["text"].(string)
+			if strings.Contains(text, "approved by") {
+				continue
+			}
+			if !strings.Contains(text, "now expands to_ `echo rm -rf /`") {
+				t.Errorf("Expected the changed command refused, got %q", text)
+			}
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatal("No result posted")
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// archiveTimeout bounds storing one job's output, which the reply waits
+// for so it can link to it.
+const archiveTimeout = 30 * time.Second
+
+// outputArchive keeps the complete output of each job, keyed by job ID,
+// so messages can show a shortened view while the full output remains
+// retrievable.
+type outputArchive interface {
+	put(ctx context.Context, jobID string, data []byte) error
+	get(ctx context.Context, jobID string) ([]byte, error)
+	remove(ctx context.Context, jobID string) error
+	// expire deletes output stored before the given time and returns how
+	// many jobs' output it deleted.
+	expire(ctx context.Context, before time.Time) (int, error)
+}
+
+// newOutputArchive opens the archive named by OUTPUT_ARCHIVE: a local
+// directory (a path or file:// URL), a Google Cloud Storage bucket
+// (gs://bucket) or an S3-compatible bucket (https://host/bucket). Keys in
+// buckets start with prefix.
+func newOutputArchive(cfg config, client *http.Client) (outputArchive, error) {
+	target := cfg.OutputArchive
+	if strings.HasPrefix(target, "/") {
+		target = "file://" + target
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Path == "" {
+			return nil, fmt.Errorf("%s: missing directory", cfg.OutputArchive)
+		}
+		if err := os.MkdirAll(u.Path, 0o700); err != nil {
+			return nil, err
+		}
+		return dirArchive(u.Path), nil
+	case "gs":
+		// Cloud Storage accepts S3 requests signed with HMAC keys.
+		bucket, err := newS3Client("https://storage.googleapis.com/"+u.Host, "auto", cfg.GCSAccessKeyID, cfg.GCSSecretAccessKey, "", client)
+		if err != nil {
+			return nil, err
+		}
+		return &bucketArchive{bucket: bucket, prefix: cfg.OutputArchivePrefix}, nil
+	case "http", "https":
+		bucket, err := newS3Client(cfg.OutputArchive, cfg.S3Region, cfg.S3AccessKeyID, cfg.S3SecretAccessKey, cfg.S3SessionToken, client)
+		if err != nil {
+			return nil, err
+		}
+		return &bucketArchive{bucket: bucket, prefix: cfg.OutputArchivePrefix}, nil
+	}
+	return nil, fmt.Errorf("%s: want a directory, gs://bucket or https://host/bucket", cfg.OutputArchive)
+}
+
+// dirArchive keeps output in files named after job IDs in a directory.
+type dirArchive string
+
+func (d dirArchive) path(jobID string) (string, error) {
+	if jobID == "" || jobID != filepath.Base(jobID) || jobID == ".." || jobID == "." {
+		return "", fmt.Errorf("invalid job ID %q", jobID)
+	}
+	return filepath.Join(string(d), jobID), nil
+}
+
+func (d dirArchive) put(ctx context.Context, jobID string, data []byte) error {
+	path, err := d.path(jobID)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+func (d dirArchive) get(ctx context.Context, jobID string) ([]byte, error) {
+	path, err := d.path(jobID)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func (d dirArchive) remove(ctx context.Context, jobID string) error {
+	path, err := d.path(jobID)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func (d dirArchive) expire(ctx context.Context, before time.Time) (int, error) {
+	entries, err := os.ReadDir(string(d))
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() || !info.ModTime().Before(before) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(string(d), e.Name())); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// bucketArchive keeps output in objects named <prefix><job-id>.
+type bucketArchive struct {
+	bucket *s3Client
+	prefix string
+}
+
+func (b *bucketArchive) put(ctx context.Context, jobID string, data []byte) error {
+	return b.bucket.put(ctx, b.prefix+jobID, http.DetectContentType(data), data)
+}
+
+func (b *bucketArchive) get(ctx context.Context, jobID string) ([]byte, error) {
+	return b.bucket.get(ctx, b.prefix+jobID)
+}
+
+func (b *bucketArchive) remove(ctx context.Context, jobID string) error {
+	return b.bucket.remove(ctx, b.prefix+jobID)
+}
+
+func (b *bucketArchive) expire(ctx context.Context, before time.Time) (int, error) {
+	var expired []string
+	err := b.bucket.list(ctx, b.prefix, func(obj s3Object) error {
+		if obj.LastModified.Before(before) {
+			expired = append(expired, obj.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for i, key := range expired {
+		if err := b.bucket.remove(ctx, key); err != nil {
+			return i, err
+		}
+	}
+	return len(expired), nil
+}
+
+// archiveOutput stores a finished job's complete output, redacted as it
+// is in the job store. Binary output is stored as it is. Output withheld
+// for a secret is not archived, since redaction may miss part of it.
+func (s *server) archiveOutput(ctx context.Context, j *job, result commandResult) {
+	if s.archive == nil || len(j.Leaks) > 0 {
+		return
+	}
+	data := result.Binary
+	if data == nil {
+		lines := result.Lines
+		if s.cfg.profileFor(j.Cmd.ChannelID).Classification.rules().Redact {
+			lines = redactLines(lines)
+		}
+		data = []byte(s.displayText(j.Cmd) + "\n" + strings.Join(lines, "\n") + "\n")
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), archiveTimeout)
+	defer cancel()
+	if err := s.archive.put(ctx, j.ID, data); err != nil {
+		fmt.Fprintf(os.Stderr, "Error archiving output of job %s: %v\n", j.ID, err)
+		return
+	}
+	j.Archived = true
+}
+
+// archivedOutputURL returns the link to a job's archived output, or ""
+// if it was not archived or there is no public URL.
+func (s *server) archivedOutputURL(j *job) string {
+	if j == nil || !j.Archived || s.cfg.PublicURL == "" {
+		return ""
+	}
+	paths := s.routeTable.resolve(s.cfg.Paths)
+	return strings.TrimSuffix(s.cfg.PublicURL, "/") + paths.Admin + "/outputs/" + j.ID
+}
+
+// handleArchivedOutput serves a job's archived output to callers who may
+// see the job, as for transcripts.
+func (s *server) handleArchivedOutput(w http.ResponseWriter, r *http.Request) {
+	v, err := s.apiViewer(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	j, err := s.store.job(id)
+	if err != nil || j.Redacted || !s.canView(v, j) {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := s.archive.get(r.Context(), j.ID)
+	if errors.Is(err, os.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading archived output of job %s: %v\n", j.ID, err)
+		http.Error(w, "Cannot read archived output", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Write(data)
+}
+
+// runArchiveRetention deletes archived output older than OUTPUT_RETENTION
+// every hour.
+func (s *server) runArchiveRetention() {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		n, err := s.archive.expire(ctx, time.Now().Add(-s.cfg.OutputRetention))
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error expiring archived output: %v\n", err)
+		} else if n > 0 {
+			fmt.Printf("Expired archived output of %d jobs\n", n)
+		}
+		time.Sleep(time.Hour)
+	}
+}
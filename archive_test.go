@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleCommand_ArchivesFullOutput(t *testing.T) {
+	dir := t.TempDir()
+	s := newServer(config{
+		DataDir:         t.TempDir(),
+		OutputArchive:   dir,
+		PublicURL:       "https://shell.example.com",
+		MaxMessageChars: 500,
+		APITokens:       map[string]string{"tok-u1": "U1"},
+	})
+
+	data := url.Values{}
+	data.Set("text", "$ seq 1 1000")
+	data.Set("channel_id", "C1")
+	data.Set("user_id", "U1")
+	response := postCommand(t, s, data)
+
+	link := regexp.MustCompile(`<https://shell\.example\.com(/debug/outputs/[0-9a-f]+)\|Full output>`).FindStringSubmatch(response["text"])
+	if link == nil {
+		t.Fatalf("Expected the preview to link the archived output, got %q", response["text"])
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer tok-u1")
+		w := httptest.NewRecorder()
+		s.routes().ServeHTTP(w, req)
+		return w
+	}
+	w := get(link[1])
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), "$ seq 1 1000\n1\n2\n") || !strings.HasSuffix(w.Body.String(), "\n1000\n") {
+		t.Errorf("Expected the full output, got %d %q", w.Code, w.Body.String())
+	}
+
+	if w = get("/debug/outputs/0000"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown job, got %d", w.Code)
+	}
+}
+
+func TestDirArchive_Expire(t *testing.T) {
+	dir := t.TempDir()
+	a := dirArchive(dir)
+	ctx := context.Background()
+	for _, id := range []string{"old", "new"} {
+		if err := a.put(ctx, id, []byte(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(filepath.Join(dir, "old"), old, old)
+
+	if n, err := a.expire(ctx, time.Now().Add(-24*time.Hour)); err != nil || n != 1 {
+		t.Fatalf("Expected one expired job, got %d, %v", n, err)
+	}
+	if _, err := a.get(ctx, "old"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected old output deleted, got %v", err)
+	}
+	if data, err := a.get(ctx, "new"); err != nil || string(data) != "new" {
+		t.Errorf("Expected new output kept, got %q, %v", data, err)
+	}
+	if err := a.put(ctx, "../escape", nil); err == nil {
+		t.Error("Expected job IDs with paths to be refused")
+	}
+}
+
+func TestBucketArchive_Expire(t *testing.T) {
+	var deleted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+			if r.URL.Query().Get("prefix") != "out/" {
+				http.Error(w, "bad prefix", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `<ListBucketResult><IsTruncated>false</IsTruncated>`+
+				`<Contents><Key>out/old</Key><LastModified>2024-01-01T00:00:00.000Z</LastModified></Contents>`+
+				`<Contents><Key>out/new</Key><LastModified>2024-03-01T00:00:00.000Z</LastModified></Contents>`+
+				`</ListBucketResult>`)
+		case r.Method == http.MethodDelete:
+			deleted = append(deleted, r.URL.Path)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	bucket, err := newS3Client(srv.URL+"/archive", "us-east-1", "AKID", "secret", "", srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &bucketArchive{bucket: bucket, prefix: "out/"}
+	n, err := a.expire(context.Background(), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil || n != 1 || len(deleted) != 1 || deleted[0] != "/archive/out/old" {
+		t.Errorf("Expected only out/old deleted, got %d, %v, %v", n, deleted, err)
+	}
+	if _, err := a.get(context.Background(), "missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a missing object to be reported as such, got %v", err)
+	}
+}
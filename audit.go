@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// auditEvent records a security-relevant action, such as an approval.
+type auditEvent struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"`
+	UserID    string    `json:"user_id,omitempty"`
+	ChannelID string    `json:"channel_id,omitempty"`
+	TeamID    string    `json:"team_id,omitempty"`
+	Command   string    `json:"command,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+
+	// Set for executed commands: the text as typed, the job, and how it
+	// ended.
+	Text        string `json:"text,omitempty"`
+	JobID       string `json:"job_id,omitempty"`
+	ExitCode    *int   `json:"exit_code,omitempty"`
+	DurationMS  int64  `json:"duration_ms,omitempty"`
+	OutputBytes int    `json:"output_bytes,omitempty"`
+
+	// Seq numbers the events in audit.db from 1, and Prev and Hash chain
+	// them (see chainHash), so changes to the log can be detected.
+	Seq  int64  `json:"seq,omitempty"`
+	Prev string `json:"prev,omitempty"`
+	Hash string `json:"hash,omitempty"`
+}
+
+// auditCommandExecuted is the audit action for every command that runs.
+// Commands refused before running are recorded under the action that
+// refused them.
+const auditCommandExecuted = "command_executed"
+
+// auditLog writes audit events to stderr and, with a data directory, to
+// the audit table of audit.db in it. Events in the table are hash chained.
+type auditLog struct {
+	db *sql.DB // nil logs to stderr only
+
+	syslog *syslogSink     // nil unless AUDIT_SYSLOG is set
+	export *recordExporter // nil unless EXPORT_BUCKET_URL is set
+
+	mu   sync.Mutex
+	seq  int64  // of the last event in the table
+	head string // hash of the last event in the table
+}
+
+// auditSchema creates the audit table. Events are kept as JSON, as they
+// were hashed, with the columns queries filter on beside them. Triggers
+// refuse updates and deletes, so events can only be added.
+const auditSchema = `CREATE TABLE IF NOT EXISTS audit (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	seq INTEGER NOT NULL,
+	time INTEGER NOT NULL,
+	action TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	channel_id TEXT NOT NULL,
+	event TEXT NOT NULL);
+CREATE INDEX IF NOT EXISTS audit_time ON audit (time);
+CREATE TRIGGER IF NOT EXISTS audit_no_update BEFORE UPDATE ON audit
+	BEGIN SELECT RAISE(ABORT, 'the audit log is append-only'); END;
+CREATE TRIGGER IF NOT EXISTS audit_no_delete BEFORE DELETE ON audit
+	BEGIN SELECT RAISE(ABORT, 'the audit log is append-only'); END`
+
+func newAuditLog(dir string) *auditLog {
+	if dir == "" {
+		return &auditLog{}
+	}
+	db, err := openAuditDB(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening audit log: %v\n", err)
+		return &auditLog{}
+	}
+	a := &auditLog{db: db}
+	// The chain continues from the last event in the table.
+	var event string
+	err = db.QueryRow("SELECT event FROM audit WHERE seq > 0 ORDER BY id DESC LIMIT 1").Scan(&event)
+	var e auditEvent
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Error reading audit log: %v\n", err)
+	case json.Unmarshal([]byte(event), &e) == nil:
+		a.seq, a.head = e.Seq, e.Hash
+	}
+	return a
+}
+
+// openAuditDB opens audit.db in dir, creating it with the events of an
+// audit.jsonl written by earlier versions, which is then removed.
+func openAuditDB(dir string) (*sql.DB, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "audit.db")
+	db, err := sql.Open("sqlite", sqliteDSN(path, "_pragma=busy_timeout(5000)"))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(auditSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	if err := importAuditFile(db, filepath.Join(dir, "audit.jsonl")); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("importing audit.jsonl: %w", err)
+	}
+	return db, nil
+}
+
+// importAuditFile adds the events of an audit.jsonl file, in order and as
+// they were chained, to an empty audit table, and removes the file.
+func importAuditFile(db *sql.DB, path string) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM audit").Scan(&n); err != nil || n > 0 {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = scanAuditFile(path, func(e auditEvent, _ int) error {
+		return insertAuditEvent(tx.Exec, e)
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// insertAuditEvent appends an event to the audit table.
+func insertAuditEvent(exec func(query string, args ...interface{}) (sql.Result, error), e auditEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = exec("INSERT INTO audit (seq, time, action, user_id, channel_id, event) VALUES (?, ?, ?, ?, ?, ?)",
+		e.Seq, e.Time.UnixMicro(), e.Action, e.UserID, e.ChannelID, string(data))
+	return err
+}
+
+// chainHash is the hash of an event, which covers its sequence number
+// and the previous event's hash, so an edited, removed or reordered event
+// breaks the chain from there on.
+func chainHash(e auditEvent) string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// anchor returns the sequence number and hash of the last event, which
+// pin the log's contents up to it.
+func (a *auditLog) anchor() (int64, string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.seq, a.head
+}
+
+// record writes an event, stamping it with the current time.
+func (a *auditLog) record(e auditEvent) {
+	e.Time = time.Now().UTC()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.db != nil {
+		e.Seq, e.Prev = a.seq+1, a.head
+		e.Hash = chainHash(e)
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding audit event: %v\n", err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Audit: %s\n", line)
+	if a.syslog != nil {
+		a.syslog.send(line)
+	}
+	if a.export != nil {
+		a.export.add(exportAudit, line)
+	}
+	if a.db == nil {
+		return
+	}
+	if err := insertAuditEvent(a.db.Exec, e); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing audit log: %v\n", err)
+		return
+	}
+	a.seq, a.head = e.Seq, e.Hash
+}
+
+// auditFilter selects audit events; empty fields match any event.
+type auditFilter struct {
+	Since, Until time.Time // [Since, Until)
+	UserID       string
+	ChannelID    string
+	Action       string
+}
+
+// between returns the events recorded in [since, until), oldest first.
+// Without a data directory there are none.
+func (a *auditLog) between(since, until time.Time) ([]auditEvent, error) {
+	var events []auditEvent
+	err := a.scan(auditFilter{Since: since, Until: until}, false, func(e auditEvent) bool {
+		events = append(events, e)
+		return true
+	})
+	return events, err
+}
+
+// scan calls fn with the events matching f, oldest first or, with
+// newest, newest first, until fn returns false.
+func (a *auditLog) scan(f auditFilter, newest bool, fn func(auditEvent) bool) error {
+	if a.db == nil {
+		return nil
+	}
+	query := "SELECT event FROM audit WHERE time >= ? AND time < ?"
+	args := []interface{}{f.Since.UnixMicro(), f.Until.UnixMicro()}
+	for _, c := range []struct{ column, value string }{{"user_id", f.UserID}, {"channel_id", f.ChannelID}, {"action", f.Action}} {
+		if c.value != "" {
+			query += " AND " + c.column + " = ?"
+			args = append(args, c.value)
+		}
+	}
+	if newest {
+		query += " ORDER BY id DESC"
+	} else {
+		query += " ORDER BY id"
+	}
+	rows, err := a.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		var e auditEvent
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			return err
+		}
+		if !fn(e) {
+			break
+		}
+	}
+	return rows.Err()
+}
+
+// scanAuditFile calls fn with each event in an audit file and its line
+// number. Lines that are not events are skipped.
+func scanAuditFile(path string, fn func(e auditEvent, line int) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for n := 1; scanner.Scan(); n++ {
+		var e auditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if err := fn(e, n); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
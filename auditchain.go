@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// auditAnchor pins an audit log's contents up to an event: the event's
+// sequence number and hash, written "seq:hash".
+type auditAnchor struct {
+	Seq  int64
+	Hash string
+}
+
+func (a auditAnchor) String() string {
+	return fmt.Sprintf("%d:%s", a.Seq, a.Hash)
+}
+
+func parseAuditAnchor(s string) (auditAnchor, error) {
+	seq, hash, ok := strings.Cut(s, ":")
+	n, err := strconv.ParseInt(seq, 10, 64)
+	if !ok || err != nil || n < 1 || len(hash) != 64 {
+		return auditAnchor{}, fmt.Errorf("invalid anchor %q: want <seq>:<sha256>", s)
+	}
+	return auditAnchor{Seq: n, Hash: hash}, nil
+}
+
+// auditVerification is the outcome of checking an audit log's chain.
+type auditVerification struct {
+	Unchained int // events written before chaining, at the start
+	Chained   int64
+	Head      auditAnchor
+	Problems  []string
+}
+
+// verifyAuditChain checks that the events in r form an unbroken chain
+// from sequence number 1, and that it matches the anchors. An edited,
+// inserted, removed or reordered event breaks the chain; events cut from
+// the end are only detected with an anchor recorded before they were cut.
+func verifyAuditChain(r io.Reader, anchors []auditAnchor) (auditVerification, error) {
+	var v auditVerification
+	problem := func(line int, format string, args ...interface{}) {
+		v.Problems = append(v.Problems, fmt.Sprintf("line %d: ", line)+fmt.Sprintf(format, args...))
+	}
+	want := make(map[int64]string, len(anchors))
+	for _, a := range anchors {
+		want[a.Seq] = a.Hash
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20)
+	for n := 1; scanner.Scan(); n++ {
+		var e auditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			problem(n, "not an audit event")
+			continue
+		}
+		if e.Hash == "" {
+			if v.Chained > 0 {
+				problem(n, "event without a hash after the chain started")
+			} else {
+				v.Unchained++
+			}
+			continue
+		}
+		if e.Seq != v.Head.Seq+1 {
+			problem(n, "sequence number %d, want %d", e.Seq, v.Head.Seq+1)
+		}
+		if e.Prev != v.Head.Hash {
+			problem(n, "event %d does not follow the previous event", e.Seq)
+		}
+		if chainHash(e) != e.Hash {
+			problem(n, "event %d was modified", e.Seq)
+		}
+		if h, ok := want[e.Seq]; ok && h != e.Hash {
+			problem(n, "event %d does not match its anchor", e.Seq)
+		}
+		v.Chained++
+		v.Head = auditAnchor{Seq: e.Seq, Hash: e.Hash}
+	}
+	if err := scanner.Err(); err != nil {
+		return v, err
+	}
+	for _, a := range anchors {
+		if a.Seq > v.Head.Seq {
+			v.Problems = append(v.Problems, fmt.Sprintf("anchor %s is past the end of the log, at event %d: events were removed", a, v.Head.Seq))
+		}
+	}
+	return v, nil
+}
+
+// runAuditCommand implements "http-shell audit verify [--anchor=<seq>:<hash>]...
+// [path]". The path defaults to audit.db in DATA_DIR; a file of JSON lines,
+// such as a copy shipped elsewhere, can be verified too. It returns the
+// process's exit status: 0 if the log is intact, 1 if not, 2 for misuse.
+func runAuditCommand(args []string, stdout, stderr io.Writer) int {
+	const usage = "usage: http-shell audit verify [--anchor=<seq>:<hash>]... [path]"
+	if len(args) == 0 || args[0] != "verify" {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+
+	var anchors []auditAnchor
+	var path string
+	for _, arg := range args[1:] {
+		if v, ok := strings.CutPrefix(arg, "--anchor="); ok {
+			a, err := parseAuditAnchor(v)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return 2
+			}
+			anchors = append(anchors, a)
+			continue
+		}
+		if path != "" || strings.HasPrefix(arg, "-") {
+			fmt.Fprintln(stderr, usage)
+			return 2
+		}
+		path = arg
+	}
+	if path == "" {
+		if config := os.Getenv("CONFIG_FILE"); config != "" {
+			if err := loadEnvFile(config); err != nil {
+				fmt.Fprintf(stderr, "Error loading config file: %v\n", err)
+				return 2
+			}
+		}
+		if os.Getenv("DATA_DIR") == "" {
+			fmt.Fprintln(stderr, "audit verify: give the log's path or set DATA_DIR")
+			return 2
+		}
+		path = filepath.Join(os.Getenv("DATA_DIR"), "audit.db")
+	}
+
+	f, err := openAuditEvents(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "audit verify: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+	v, err := verifyAuditChain(f, anchors)
+	if err != nil {
+		fmt.Fprintf(stderr, "audit verify: %s: %v\n", path, err)
+		return 1
+	}
+
+	if v.Unchained > 0 {
+		fmt.Fprintf(stdout, "%d events from before chaining cannot be verified\n", v.Unchained)
+	}
+	for _, p := range v.Problems {
+		fmt.Fprintln(stdout, p)
+	}
+	if len(v.Problems) > 0 {
+		fmt.Fprintf(stdout, "FAILED: %s: %d problems in %d chained events\n", path, len(v.Problems), v.Chained)
+		return 1
+	}
+	fmt.Fprintf(stdout, "OK: %s: %d chained events, head %s\n", path, v.Chained, v.Head)
+	return 0
+}
+
+// openAuditEvents opens an audit log for verification: a file of JSON
+// lines as it is, or the events of an audit database, one per line in the
+// order they were added.
+func openAuditEvents(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 16)
+	if n, _ := io.ReadFull(f, header); string(header[:n]) != "SQLite format 3\x00" {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return f, nil
+	}
+	f.Close()
+
+	db, err := sql.Open("sqlite", sqliteDSN(path, "mode=ro&_pragma=busy_timeout(5000)"))
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query("SELECT event FROM audit ORDER BY id")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	r, w := io.Pipe()
+	go func() {
+		defer db.Close()
+		defer rows.Close()
+		for rows.Next() {
+			var event string
+			if err := rows.Scan(&event); err != nil {
+				w.CloseWithError(err)
+				return
+			}
+			if _, err := io.WriteString(w, event+"\n"); err != nil {
+				return
+			}
+		}
+		w.CloseWithError(rows.Err())
+	}()
+	return r, nil
+}
+
+// runAuditAnchors posts the audit log's head to AUDIT_ANCHOR_URL every
+// AUDIT_ANCHOR_INTERVAL, when it has changed. Kept outside the server,
+// anchors let "audit verify" detect events removed from the end of the
+// log, which the chain alone cannot.
+func (s *server) runAuditAnchors() {
+	var last int64
+	for {
+		time.Sleep(s.cfg.AuditAnchorInterval)
+		seq, head := s.auditLog.anchor()
+		if seq == 0 || seq == last {
+			continue
+		}
+		if err := s.postAuditAnchor(context.Background(), auditAnchor{Seq: seq, Hash: head}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error posting audit anchor: %v\n", err)
+			continue
+		}
+		last = seq
+	}
+}
+
+// postAuditAnchor sends an anchor to AUDIT_ANCHOR_URL as a Slack message.
+func (s *server) postAuditAnchor(ctx context.Context, a auditAnchor) error {
+	if s.cfg.AuditAnchorURL == "" {
+		return errors.New("no AUDIT_ANCHOR_URL")
+	}
+	text := fmt.Sprintf("Audit log anchor at %s: `%s`\nVerify with `http-shell audit verify --anchor=%s`", time.Now().UTC().Format(time.RFC3339), a, a)
+	return postWebhook(ctx, s.client, s.cfg.AuditAnchorURL, map[string]string{"text": text, "anchor": a.String()})
+}
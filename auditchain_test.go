@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// chainedAuditLog writes n events to an audit log in a new directory and
+// returns the database's path.
+func chainedAuditLog(t *testing.T, n int) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for i := 0; i < n; i++ {
+		// Each event is written by a fresh log, which continues the chain
+		// from the file, as after a restart.
+		newAuditLog(dir).record(auditEvent{Action: "test", Detail: strings.Repeat("x", i)})
+	}
+	return filepath.Join(dir, "audit.db")
+}
+
+// auditLogText returns the events of the audit log in dir, one JSON object
+// per line, or "" if there is none.
+func auditLogText(t *testing.T, dir string) string {
+	t.Helper()
+
+	r, err := openAuditEvents(filepath.Join(dir, "audit.db"))
+	if os.IsNotExist(err) {
+		return ""
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// rewriteAuditDB replaces the events in an audit database with what
+// tamper makes of them, as someone bypassing its triggers could.
+func rewriteAuditDB(t *testing.T, path string, tamper func(lines []string) []string) {
+	t.Helper()
+
+	lines := strings.Split(strings.TrimSuffix(auditLogText(t, filepath.Dir(path)), "\n"), "\n")
+	db, err := sql.Open("sqlite", sqliteDSN(path, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{"DROP TRIGGER audit_no_update", "DROP TRIGGER audit_no_delete", "DELETE FROM audit"} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, line := range tamper(lines) {
+		if _, err := db.Exec("INSERT INTO audit (seq, time, action, user_id, channel_id, event) VALUES (0, 0, '', '', '', ?)", line); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func verifyFile(t *testing.T, path string, args ...string) (int, string) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	code := runAuditCommand(append(append([]string{"verify"}, args...), path), &stdout, &stderr)
+	return code, stdout.String() + stderr.String()
+}
+
+func TestAuditVerify_Intact(t *testing.T) {
+	path := chainedAuditLog(t, 3)
+
+	code, out := verifyFile(t, path)
+	if code != 0 || !strings.Contains(out, "OK: "+path+": 3 chained events, head 3:") {
+		t.Errorf("Expected the log verified, got %d: %s", code, out)
+	}
+
+	// A copy of the events as JSON lines verifies the same.
+	copied := filepath.Join(t.TempDir(), "audit.jsonl")
+	os.WriteFile(copied, []byte(auditLogText(t, filepath.Dir(path))), 0o600)
+	if code, out := verifyFile(t, copied); code != 0 || !strings.Contains(out, "OK: "+copied+": 3 chained events, head 3:") {
+		t.Errorf("Expected the copy verified, got %d: %s", code, out)
+	}
+}
+
+func TestAuditLog_AppendOnly(t *testing.T) {
+	path := chainedAuditLog(t, 2)
+	db, err := sql.Open("sqlite", sqliteDSN(path, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{"UPDATE audit SET action = 'forged'", "DELETE FROM audit WHERE seq = 2"} {
+		if _, err := db.Exec(stmt); err == nil || !strings.Contains(err.Error(), "append-only") {
+			t.Errorf("Expected %q refused, got %v", stmt, err)
+		}
+	}
+}
+
+func TestAuditLog_ImportsFile(t *testing.T) {
+	path := chainedAuditLog(t, 2)
+	old := filepath.Join(t.TempDir(), "audit.jsonl")
+	os.WriteFile(old, []byte(`{"time":"2020-01-01T00:00:00Z","action":"unchained"}`+"\n"+auditLogText(t, filepath.Dir(path))), 0o600)
+
+	a := newAuditLog(filepath.Dir(old))
+	a.record(auditEvent{Action: "test"})
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("Expected audit.jsonl removed once imported, got %v", err)
+	}
+	if seq, _ := a.anchor(); seq != 3 {
+		t.Errorf("Expected the chain continued from the imported events, got seq %d", seq)
+	}
+	code, out := verifyFile(t, filepath.Join(filepath.Dir(old), "audit.db"))
+	if code != 0 || !strings.Contains(out, "1 events from before chaining") || !strings.Contains(out, "3 chained events") {
+		t.Errorf("Expected the imported log verified, got %d: %s", code, out)
+	}
+}
+
+func TestAuditVerify_DetectsTampering(t *testing.T) {
+	for name, tamper := range map[string]func(lines []string) []string{
+		"modified": func(lines []string) []string {
+			lines[1] = strings.Replace(lines[1], `"detail":"x"`, `"detail":"y"`, 1)
+			return lines
+		},
+		"removed":   func(lines []string) []string { return append(lines[:1], lines[2:]...) },
+		"reordered": func(lines []string) []string { lines[0], lines[1] = lines[1], lines[0]; return lines },
+		"inserted": func(lines []string) []string {
+			return append(lines[:1], append([]string{`{"action":"forged"}`}, lines[1:]...)...)
+		},
+	} {
+		path := chainedAuditLog(t, 3)
+		rewriteAuditDB(t, path, tamper)
+
+		if code, out := verifyFile(t, path); code != 1 || !strings.Contains(out, "FAILED") {
+			t.Errorf("%s: expected verification to fail, got %d: %s", name, code, out)
+		}
+	}
+}
+
+func TestAuditVerify_AnchorDetectsTruncation(t *testing.T) {
+	dir := t.TempDir()
+	a := newAuditLog(dir)
+	for i := 0; i < 3; i++ {
+		a.record(auditEvent{Action: "test"})
+	}
+	seq, head := a.anchor()
+	anchor := auditAnchor{Seq: seq, Hash: head}.String()
+	path := filepath.Join(dir, "audit.db")
+
+	if code, out := verifyFile(t, path, "--anchor="+anchor); code != 0 {
+		t.Fatalf("Expected the log to match its anchor, got %d: %s", code, out)
+	}
+
+	rewriteAuditDB(t, path, func(lines []string) []string { return lines[:2] })
+	if code, _ := verifyFile(t, path); code != 0 {
+		t.Errorf("Expected a truncated log to verify without an anchor")
+	}
+	if code, out := verifyFile(t, path, "--anchor="+anchor); code != 1 || !strings.Contains(out, "events were removed") {
+		t.Errorf("Expected truncation detected with the anchor, got %d: %s", code, out)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Defaults of the audit builtin.
+const (
+	auditQueryDefaultSince = 7 * 24 * time.Hour
+	auditQueryLimit        = 20
+)
+
+const auditUsage = "usage: audit [--since=7d] [--user=<id>] [--channel=<id>] [--action=<action>] [text]"
+
+// auditCommand records a finished command with its outcome. Secrets typed
+// into the command are logged as hashes, as when it was checked.
+func (s *server) auditCommand(j *job, result commandResult) {
+	exitCode := result.ExitCode
+	outputBytes := len(result.Binary)
+	for _, line := range result.Lines {
+		outputBytes += len(line) + 1
+	}
+	s.auditLog.record(auditEvent{
+		Action:      auditCommandExecuted,
+		UserID:      j.Cmd.UserID,
+		ChannelID:   j.Cmd.ChannelID,
+		TeamID:      j.Cmd.TeamID,
+		Command:     maskSecrets(j.Command, j.Cmd.Secrets),
+		Text:        maskSecrets(j.Cmd.Text, j.Cmd.Secrets),
+		JobID:       j.ID,
+		ExitCode:    &exitCode,
+		DurationMS:  result.Duration.Milliseconds(),
+		OutputBytes: outputBytes,
+	})
+}
+
+// runAudit is the audit builtin, for admins: it lists the newest audit
+// events matching the filters, and text in the command or detail.
+func runAudit(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	fail := func(code int, msg string) commandResult {
+		return commandResult{Lines: []string{msg}, ExitCode: code, Duration: time.Since(startTime)}
+	}
+	if !s.cfg.Admins[cmd.UserID] {
+		return fail(1, "audit: only admins can query the audit log")
+	}
+
+	since := auditQueryDefaultSince
+	var user, channel, action string
+	var words []string
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		switch {
+		case ok && name == "--since":
+			d, err := parseSince(value)
+			if err != nil {
+				return fail(2, err.Error())
+			}
+			since = d
+		case ok && name == "--user":
+			user = strings.Trim(value, "<@>")
+		case ok && name == "--channel":
+			channel, _, _ = strings.Cut(strings.Trim(value, "<#>"), "|")
+		case ok && name == "--action":
+			action = value
+		case strings.HasPrefix(arg, "--"):
+			return fail(2, auditUsage)
+		default:
+			words = append(words, arg)
+		}
+	}
+	text := strings.ToLower(strings.Trim(strings.Join(words, " "), `"'`))
+
+	var matches []auditEvent
+	f := auditFilter{Since: startTime.Add(-since), Until: startTime.Add(time.Second), UserID: user, ChannelID: channel, Action: action}
+	err := s.auditLog.scan(f, true, func(e auditEvent) bool {
+		if text == "" || strings.Contains(strings.ToLower(e.Command+"\n"+e.Text+"\n"+e.Detail), text) {
+			matches = append(matches, e)
+		}
+		return len(matches) < auditQueryLimit
+	})
+	if err != nil {
+		return fail(1, fmt.Sprintf("audit: %v", err))
+	}
+	if len(matches) == 0 {
+		return commandResult{Lines: []string{"no matching audit events"}, Duration: time.Since(startTime)}
+	}
+
+	lines := make([]string, 0, len(matches))
+	for _, e := range matches {
+		lines = append(lines, formatAuditEvent(e))
+	}
+	return commandResult{Lines: lines, Duration: time.Since(startTime)}
+}
+
+// formatAuditEvent shows an event on one line, newest first in listings.
+func formatAuditEvent(e auditEvent) string {
+	parts := []string{e.Time.Local().Format("2006-01-02 15:04:05"), e.Action}
+	if e.UserID != "" {
+		parts = append(parts, "<@"+e.UserID+">")
+	}
+	if e.ChannelID != "" {
+		parts = append(parts, "<#"+e.ChannelID+">")
+	}
+	if e.JobID != "" {
+		parts = append(parts, e.JobID)
+	}
+	if e.ExitCode != nil {
+		parts = append(parts, fmt.Sprintf("exit %d, %s, %d bytes", *e.ExitCode, time.Duration(e.DurationMS)*time.Millisecond, e.OutputBytes))
+	}
+	if e.Command != "" {
+		parts = append(parts, e.Command)
+	}
+	if e.Detail != "" {
+		parts = append(parts, "("+e.Detail+")")
+	}
+	return strings.Join(parts, "  ")
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestAudit_RecordsAndQueriesCommands(t *testing.T) {
+	s := newServer(config{DataDir: t.TempDir(), Admins: map[string]bool{"UADMIN": true}})
+	ctx := context.Background()
+	in := func(user, text string) string {
+		return s.handleCommandExecution(ctx, slashCommand{Text: text, UserID: user, ChannelID: "C1", TeamID: "T1"})["text"]
+	}
+	in("U1", "$ echo hello")
+	in("U2", "$ sh -c 'exit 3'")
+	in("U1", "$ echo postgres://app:hunter2@db")
+
+	if got := in("U1", "$ audit"); !strings.Contains(got, "only admins") {
+		t.Errorf("Expected the audit log closed to other users, got %q", got)
+	}
+
+	got := in("UADMIN", "$ audit --user=U2")
+	if !strings.Contains(got, "command_executed  <@U2>  <#C1>") || !strings.Contains(got, "exit 3") || strings.Contains(got, "echo hello") {
+		t.Errorf("Expected only U2's command with its exit code, got %q", got)
+	}
+	got = in("UADMIN", "$ audit --action=command_executed hello")
+	if !strings.Contains(got, "exit 0") || !strings.Contains(got, "6 bytes") || !strings.Contains(got, "echo hello") {
+		t.Errorf("Expected the command with its output size, got %q", got)
+	}
+	got = in("UADMIN", "$ audit postgres")
+	if strings.Contains(got, "hunter2") || !strings.Contains(got, hashSecret("hunter2")) {
+		t.Errorf("Expected the typed secret logged as a hash, got %q", got)
+	}
+	if got := in("UADMIN", "$ audit --bogus"); !strings.Contains(got, "usage: audit") {
+		t.Errorf("Expected usage for an unknown flag, got %q", got)
+	}
+}
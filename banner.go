@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// startupReport is what configuration a server actually loaded, posted to
+// OPS_CHANNEL when it starts so operators can check a deploy.
+type startupReport struct {
+	Version    string
+	Host       string
+	Features   []string
+	Backends   []string
+	PolicyHash string
+}
+
+// buildVersion returns the module version the binary was built as or,
+// for builds from a checkout, the commit, marked dirty if the tree had
+// changes.
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	settings := map[string]string{}
+	for _, s := range info.Settings {
+		settings[s.Key] = s.Value
+	}
+	rev := settings["vcs.revision"]
+	if rev == "" {
+		return "devel"
+	}
+	if len(rev) > 12 {
+		rev = rev[:12]
+	}
+	if settings["vcs.modified"] == "true" {
+		rev += "-dirty"
+	}
+	return rev
+}
+
+// policyHash returns a short hash of the settings that decide whether a
+// command may run, so servers meant to share a policy can be compared
+// without showing it. The Lua hooks file is hashed by content.
+func policyHash(cfg config) string {
+	policy := struct {
+		Profiles           []profile
+		HostGroups         map[string][]string
+		Classifier         []classifierRule
+		DangerousAction    string
+		SuspiciousAction   string
+		InlineSecretAction string
+		Honeytokens        []string
+		ApprovalPatterns   []string
+		Approvers          []string
+		Admins             []string
+		SensitiveChannels  []string
+		InspectPaths       []string
+		OPAURL             string
+		PolicyFailOpen     bool
+		PluginsDir         string
+		LuaHooks           string
+	}{
+		Profiles:           cfg.Profiles,
+		Classifier:         cfg.ClassifierRules,
+		DangerousAction:    cfg.DangerousAction,
+		SuspiciousAction:   cfg.SuspiciousAction,
+		InlineSecretAction: cfg.InlineSecretAction,
+		Honeytokens:        cfg.Honeytokens,
+		Approvers:          cfg.Approvers,
+		Admins:             sortedKeys(cfg.Admins),
+		SensitiveChannels:  sortedKeys(cfg.SensitiveChannels),
+		InspectPaths:       cfg.InspectPaths,
+		OPAURL:             cfg.OPAURL,
+		PolicyFailOpen:     cfg.PolicyFailOpen,
+		PluginsDir:         cfg.PluginsDir,
+	}
+	if cfg.Inventory != nil {
+		policy.HostGroups = cfg.Inventory.Groups
+	}
+	for _, re := range cfg.ApprovalPatterns {
+		policy.ApprovalPatterns = append(policy.ApprovalPatterns, re.String())
+	}
+	if cfg.LuaHooksFile != "" {
+		data, err := os.ReadFile(cfg.LuaHooksFile)
+		if err != nil {
+			policy.LuaHooks = "unreadable: " + err.Error()
+		} else {
+			sum := sha256.Sum256(data)
+			policy.LuaHooks = hex.EncodeToString(sum[:])
+		}
+	}
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return "unknown"
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// startupReport describes the server as configured.
+func (s *server) startupReport() startupReport {
+	cfg := s.cfg
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	r := startupReport{
+		Version:    buildVersion(),
+		Host:       fmt.Sprintf("%s (pid %d, %s/%s, %s)", host, os.Getpid(), runtime.GOOS, runtime.GOARCH, runtime.Version()),
+		PolicyHash: policyHash(cfg),
+	}
+
+	feature := func(on bool, name string) {
+		if on {
+			r.Features = append(r.Features, name)
+		}
+	}
+	feature(cfg.SigningSecret != "", "signature verification")
+	feature(cfg.Interactivity, "interactivity")
+	feature(cfg.Sessions, "sessions")
+	feature(cfg.PTY, "pty by default")
+	feature(cfg.Lint, "lint")
+	feature(cfg.Onboarding, "onboarding")
+	feature(len(cfg.ApprovalPatterns) > 0, "approvals")
+	feature(cfg.LeakResponse, "leak response")
+	feature(cfg.CommandTimeout > 0, "command timeout "+cfg.CommandTimeout.String())
+	feature(cfg.WatchdogIdle > 0, "watchdog")
+	feature(cfg.HeartbeatInterval > 0, "heartbeats")
+	feature(len(cfg.Templates) > 0, fmt.Sprintf("%d templates", len(cfg.Templates)))
+	feature(len(cfg.Profiles) > 0, fmt.Sprintf("%d profiles", len(cfg.Profiles)))
+	feature(cfg.SandboxImage != "", "sandbox "+cfg.SandboxImage)
+	feature(cfg.Limits != nil, fmt.Sprintf("limits of %s", cfg.Limits))
+	feature(cfg.Rlimits != nil, fmt.Sprintf("rlimits of %s", cfg.Rlimits))
+	feature(cfg.Env.Allow != nil || cfg.Env.Set != nil, "command environment")
+	feature(cfg.Inventory != nil, fmt.Sprintf("inventory of %d hosts", len(cfg.Inventory.hostNames())))
+	feature(cfg.DailySummaryAt != "", "daily summary at "+cfg.DailySummaryAt)
+	feature(cfg.SecurityReportAt != "", "security report at "+cfg.SecurityReportAt)
+	feature(cfg.TemplateSuggestionsAt != "", "template suggestions at "+cfg.TemplateSuggestionsAt)
+	feature(s.schedules != nil && s.slack != nil, "schedules")
+	feature(s.mirror != nil, "mirroring")
+	feature(len(cfg.APITokens) > 0, "API tokens")
+	feature(len(cfg.FormatVariants) > 0, "formatting experiments")
+	feature(s.queue != nil, "inbound queue")
+
+	backend := func(kind, name string) {
+		r.Backends = append(r.Backends, kind+": "+name)
+	}
+	var caps []string
+	for _, c := range localBackend.Caps {
+		caps = append(caps, string(c))
+	}
+	backend("execution", fmt.Sprintf("%s (%s)", localBackend.Name, strings.Join(caps, ", ")))
+	if s.store != nil {
+		store := cfg.storeBackend()
+		if store == storePostgres {
+			if u, err := url.Parse(cfg.DatabaseURL); err == nil && u.Host != "" {
+				store += " at " + u.Host
+			}
+		}
+		backend("store", store)
+	}
+	if s.agents != nil {
+		var at []string
+		if s.agents.token != "" {
+			at = append(at, s.routeTable.resolve(cfg.Paths).Agents)
+		}
+		if cfg.AgentsListenAddr != "" {
+			at = append(at, cfg.AgentsListenAddr+" with mutual TLS")
+		}
+		backend("agents", "accepted at "+strings.Join(at, " and "))
+	}
+	if s.leader != nil {
+		backend("scheduler", "run by the server holding a Postgres advisory lock")
+	}
+	switch a := s.archive.(type) {
+	case dirArchive:
+		backend("output archive", "directory "+string(a))
+	case *bucketArchive:
+		backend("output archive", "bucket "+cfg.OutputArchive)
+	}
+	if s.exporter != nil {
+		backend("export", cfg.ExportBucketURL)
+	}
+	if cfg.OPAURL != "" {
+		backend("policy", "OPA")
+	}
+	if s.plugins != nil {
+		backend("plugins", "WASM from "+cfg.PluginsDir)
+	}
+	if s.hooks != nil {
+		backend("hooks", "Lua from "+cfg.LuaHooksFile)
+	}
+	if len(s.providerBuiltins) > 0 {
+		backend("providers", fmt.Sprintf("%d from %s", len(s.providerBuiltins), cfg.ProvidersDir))
+	}
+	if cfg.Lint {
+		shellcheck := cfg.Shellcheck
+		if shellcheck == "" {
+			shellcheck = "shellcheck"
+		}
+		if path, err := exec.LookPath(shellcheck); err == nil {
+			backend("lint", path)
+		} else {
+			backend("lint", "internal rules only")
+		}
+	}
+	if cfg.SandboxImage != "" || slices.ContainsFunc(cfg.Profiles, func(p profile) bool { return p.Container != "" || p.Image != "" || len(p.Containers) > 0 }) {
+		docker := cfg.Docker
+		if docker == "" {
+			docker = "docker"
+		}
+		backend("docker", docker)
+	}
+	if cfg.AuditSyslog != "" {
+		backend("audit", "syslog "+cfg.AuditSyslog)
+	}
+	return r
+}
+
+// text formats the report as a Slack message.
+func (r startupReport) text() string {
+	features := "none"
+	if len(r.Features) > 0 {
+		features = strings.Join(r.Features, ", ")
+	}
+	return fmt.Sprintf(":rocket: http-shell %s started on %s\n*Features:* %s\n*Backends:*\n• %s\n*Policy hash:* `%s`",
+		r.Version, r.Host, features, strings.Join(r.Backends, "\n• "), r.PolicyHash)
+}
+
+// postStartupReport posts the startup report to OPS_CHANNEL.
+func (s *server) postStartupReport(ctx context.Context) {
+	text := s.startupReport().text()
+	if err := s.slack.call(ctx, "chat.postMessage", url.Values{"channel": {s.cfg.OpsChannel}, "text": {text}}, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error posting startup report: %v\n", err)
+	}
+}
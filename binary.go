@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// isBinary reports whether output is not readable text, such as an image
+// or compressed archive written to stdout.
+func isBinary(output []byte) bool {
+	if len(output) == 0 {
+		return false
+	}
+	if bytes.IndexByte(output, 0) >= 0 || !utf8.Valid(output) {
+		return true
+	}
+	return !strings.HasPrefix(http.DetectContentType(output), "text/")
+}
+
+// binaryFilename picks a file name for binary output from its content type.
+func binaryFilename(output []byte) (filename, contentType string) {
+	contentType, _, _ = strings.Cut(http.DetectContentType(output), ";")
+	ext := map[string]string{
+		"image/png":                "png",
+		"image/jpeg":               "jpg",
+		"image/gif":                "gif",
+		"image/webp":               "webp",
+		"application/pdf":          "pdf",
+		"application/x-gzip":       "gz",
+		"application/zip":          "zip",
+		"application/octet-stream": "bin",
+	}[contentType]
+	if ext == "" {
+		ext = "bin"
+	}
+	return "output." + ext, contentType
+}
+
+// deliverBinary uploads binary output as a file where allowed and within
+// the upload quota, and returns a line describing what happened to it.
+func (s *server) deliverBinary(ctx context.Context, cmd slashCommand, variant formatVariant, text string, data []byte, canUpload bool) string {
+	filename, contentType := binaryFilename(data)
+	if canUpload && !s.quota.canUpload(int64(len(data))) {
+		return fmt.Sprintf("binary output (%s, %d bytes) omitted, daily upload quota reached", contentType, len(data))
+	}
+	if canUpload {
+		channel, threadTS := cmd.uploadTarget()
+		err := s.slack.uploadFile(ctx, channel, threadTS, filename, "Output of "+text, data)
+		if err == nil {
+			return fmt.Sprintf("binary output (%s, %d bytes) attached as %s", contentType, len(data), filename)
+		}
+		variant.count("slack_errors")
+		fmt.Fprintf(os.Stderr, "Error uploading binary output: %v\n", err)
+	}
+	return fmt.Sprintf("binary output (%s, %d bytes) omitted", contentType, len(data))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestIsBinary(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   []byte
+		expected bool
+	}{
+		{"empty", nil, false},
+		{"text", []byte("hello\nworld\n"), false},
+		{"json", []byte(`{"a": 1}`), false},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), true},
+		{"gzip", []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00"), true},
+		{"invalid utf-8", []byte("caf\xe9"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isBinary(tt.output); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRunCommand_BinaryOutput(t *testing.T) {
+	result := runCommand(context.Background(), `printf 'data' | gzip; echo warning >&2`, runOptions{})
+
+	if len(result.Binary) == 0 {
+		t.Fatal("Expected binary stdout to be kept separately")
+	}
+	if got := strings.Join(result.Lines, "\n"); got != "warning" {
+		t.Errorf("Expected only stderr in lines, got %q", got)
+	}
+}
+
+func TestHandleCommand_BinaryOutputUploaded(t *testing.T) {
+	f := newFakeSlack(t)
+	var uploaded []byte
+	f.mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		uploaded, _ = io.ReadAll(r.Body)
+	})
+	f.respond("files.getUploadURLExternal", map[string]interface{}{
+		"upload_url": f.URL + "/upload",
+		"file_id":    "F0123ABCDE",
+	})
+	s := newServer(f.config())
+
+	data := url.Values{}
+	data.Set("text", "$ printf 'data' | gzip")
+	data.Set("channel_id", "C1")
+
+	response := postCommand(t, s, data)
+
+	if !strings.Contains(response["text"], "attached as output.gz") {
+		t.Errorf("Expected attachment note, got %q", response["text"])
+	}
+	if len(uploaded) < 2 || uploaded[0] != 0x1f || uploaded[1] != 0x8b {
+		t.Errorf("Expected gzip data to be uploaded unchanged, got %q", uploaded)
+	}
+	calls := f.callsTo("files.getUploadURLExternal")
+	if len(calls) != 1 || calls[0].Params.Get("filename") != "output.gz" {
+		t.Errorf("Expected upload of output.gz, got %v", calls)
+	}
+}
+
+func TestHandleCommand_BinaryOutputOmittedWithoutToken(t *testing.T) {
+	s := newServer(config{})
+
+	data := url.Values{}
+	data.Set("text", "$ printf 'data' | gzip")
+
+	response := postCommand(t, s, data)
+
+	if !strings.Contains(response["text"], "binary output (application/x-gzip") || !strings.Contains(response["text"], "omitted") {
+		t.Errorf("Expected omission note, got %q", response["text"])
+	}
+}
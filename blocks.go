@@ -0,0 +1,38 @@
+package main
+
+// block is a Slack Block Kit block or element, encoded as JSON.
+type block map[string]interface{}
+
+// mrkdwn returns a formatted text object.
+func mrkdwn(text string) block {
+	return block{"type": "mrkdwn", "text": text}
+}
+
+// plainText returns an unformatted text object.
+func plainText(text string) block {
+	return block{"type": "plain_text", "text": text}
+}
+
+// sectionBlock returns a section showing formatted text.
+func sectionBlock(text string) block {
+	return block{"type": "section", "text": mrkdwn(text)}
+}
+
+// actionsBlock returns a block holding interactive elements.
+func actionsBlock(elements ...block) block {
+	return block{"type": "actions", "elements": elements}
+}
+
+// button returns a button element. Style is "", "primary" or "danger".
+func button(actionID, text, value, style string) block {
+	b := block{
+		"type":      "button",
+		"action_id": actionID,
+		"text":      plainText(text),
+		"value":     value,
+	}
+	if style != "" {
+		b["style"] = style
+	}
+	return b
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// builtin is a command handled by the server instead of the shell. Builtins
+// take precedence over shell commands of the same name.
+type builtin struct {
+	Name    string
+	Usage   string
+	Summary string
+	Run     func(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult
+
+	// Claims, if set, reports whether the builtin handles a command with
+	// the given arguments. Other commands with its name go to the shell.
+	Claims func(args []string) bool
+
+	// Needs lists what the builtin requires of the backend, and Accepts
+	// the meta-flag capabilities it honors. Builtins run in the server,
+	// so by default they accept none.
+	Needs   []capability
+	Accepts []capability
+
+	// Template is the template the builtin runs, for template builtins.
+	Template *template
+}
+
+// builtins returns the server's builtin commands, including those provided
+// by plugins.
+func (s *server) builtins() map[string]builtin {
+	all := map[string]builtin{
+		"alias": {
+			Name:    "alias",
+			Usage:   "alias [--team] <name>='<command>' | alias list",
+			Summary: "define a command alias for the channel or team",
+			Run:     runAlias,
+		},
+		"audit": {
+			Name:    "audit",
+			Usage:   "audit [--since=7d] [--user=<id>] [--channel=<id>] [--action=<action>] [text]",
+			Summary: "query the audit log (admins only)",
+			Run:     runAudit,
+		},
+		"cron": {
+			Name:    "cron",
+			Usage:   `cron explain "*/5 2 * * *"`,
+			Summary: "explain a cron schedule and show its next runs",
+			Run:     runCron,
+		},
+		"decode": {
+			Name:    "decode",
+			Usage:   "decode base64|jwt|json <data>",
+			Summary: "decode base64, show a JWT's claims, or pretty-print JSON",
+			Run:     runDecode,
+		},
+		"epoch": {
+			Name:    "epoch",
+			Usage:   "epoch [<timestamp> | <RFC 3339 time>]",
+			Summary: "convert between Unix timestamps and dates",
+			Run:     runEpoch,
+		},
+		"head": {
+			Name:    "head",
+			Usage:   "head -c <size> <path>",
+			Summary: "show the first bytes of a file, up to 64k",
+			Run:     runHead,
+			Claims:  claimsHead,
+			Needs:   []capability{capFiles},
+		},
+		"help": {
+			Name:    "help",
+			Usage:   "help",
+			Summary: "list builtin commands",
+			Run:     runHelp,
+		},
+		"prefs": {
+			Name:    "prefs",
+			Usage:   "prefs [plain on|off]",
+			Summary: "show or set how replies to you are formatted",
+			Run:     runPrefs,
+		},
+		"run": {
+			Name:    "run",
+			Usage:   "run <snippet>",
+			Summary: "run a snippet from the team's library",
+			Run:     runRun,
+		},
+		"schedule": {
+			Name:    "schedule",
+			Usage:   `schedule "<cron expression>" <command> | schedule list | schedule remove <id>`,
+			Summary: "run a command on a schedule and post its output in the channel",
+			Run:     runSchedule,
+		},
+		"selftest": {
+			Name:    "selftest",
+			Usage:   "selftest",
+			Summary: "check each stage of the command pipeline (admins only)",
+			Run:     runSelftest,
+		},
+		"set": {
+			Name:    "set",
+			Usage:   "set <NAME>=<value>",
+			Summary: "set a variable for commands run in the channel",
+			Run:     runSet,
+			Claims:  claimsSet,
+		},
+		"setup": {
+			Name:    "setup",
+			Usage:   "setup [remove]",
+			Summary: "pin a banner describing the channel's profile (admins only)",
+			Run:     runSetup,
+		},
+		"sha256": {
+			Name:    "sha256",
+			Usage:   "sha256 <path>...",
+			Summary: "print the SHA-256 checksum of files",
+			Run:     runSHA256,
+			Needs:   []capability{capFiles},
+		},
+		"snippet": {
+			Name:    "snippet",
+			Usage:   "snippet add <name> | list | show <name> | remove <name>",
+			Summary: "manage the team's library of named scripts",
+			Run:     runSnippet,
+		},
+		"stat": {
+			Name:    "stat",
+			Usage:   "stat <path>...",
+			Summary: "show the type, size, mode, owner and modification time of files",
+			Run:     runStat,
+			Claims:  claimsStat,
+			Needs:   []capability{capFiles},
+		},
+		"status": {
+			Name:    "status",
+			Usage:   "status",
+			Summary: "show running jobs and Slack API usage",
+			Run:     runStatus,
+		},
+		"time": {
+			Name:    "time",
+			Usage:   "time in <city or zone>[, ...]",
+			Summary: "show the time in other time zones",
+			Run:     runTime,
+			Claims:  claimsTime,
+		},
+		"unalias": {
+			Name:    "unalias",
+			Usage:   "unalias [--team] <name>",
+			Summary: "remove a command alias",
+			Run:     runUnalias,
+		},
+		"unset": {
+			Name:    "unset",
+			Usage:   "unset <NAME>",
+			Summary: "remove a channel variable",
+			Run:     runUnset,
+		},
+		"url": {
+			Name:    "url",
+			Usage:   "url decode|encode <text>",
+			Summary: "percent-decode or encode text",
+			Run:     runURL,
+		},
+		"vars": {
+			Name:    "vars",
+			Usage:   "vars",
+			Summary: "list the channel's variables",
+			Run:     runVars,
+		},
+		"watch": {
+			Name:    "watch",
+			Usage:   "watch [-n <seconds>] <command>",
+			Summary: "re-run a command and keep one message up to date with its output",
+			Run:     runWatch,
+		},
+	}
+	if s.store != nil {
+		all["search"] = builtin{
+			Name:    "search",
+			Usage:   `search "text" [--since=7d]`,
+			Summary: "search stored transcripts",
+			Run:     runSearch,
+		}
+		all["diff-jobs"] = builtin{
+			Name:    "diff-jobs",
+			Usage:   "diff-jobs <job-id> <job-id>",
+			Summary: "compare the transcripts of two jobs",
+			Run:     runDiffJobs,
+		}
+		all["redact"] = builtin{
+			Name:    "redact",
+			Usage:   "redact <job-id>",
+			Summary: "remove a job's output from Slack and the store",
+			Run:     runRedact,
+		}
+		all["result"] = builtin{
+			Name:    "result",
+			Usage:   "result <job-id>",
+			Summary: "show a past job's output and how it ended",
+			Run:     runResult,
+		}
+		all["history"] = builtin{
+			Name:    "history",
+			Usage:   "history [n]",
+			Summary: "list your recent commands in this channel",
+			Run:     runHistory,
+		}
+	}
+	if s.cfg.Inventory != nil {
+		all["hosts"] = builtin{
+			Name:    "hosts",
+			Usage:   "hosts",
+			Summary: "list the hosts and groups of the inventory",
+			Run:     runHosts,
+		}
+	}
+	if s.deadLetters != nil {
+		all["redeliver"] = builtin{
+			Name:    "redeliver",
+			Usage:   "redeliver [<id>]",
+			Summary: "list or post again results that could not be delivered",
+			Run:     runRedeliver,
+		}
+	}
+	for _, t := range s.cfg.Templates {
+		if _, ok := all[t.Name]; !ok {
+			all[t.Name] = t.builtin()
+		}
+	}
+	if s.savedTemplates != nil {
+		for _, t := range s.savedTemplates.list() {
+			if _, ok := all[t.Name]; !ok {
+				all[t.Name] = t.template().builtin()
+			}
+		}
+	}
+	for _, b := range s.providerBuiltins {
+		if _, ok := all[b.Name]; !ok {
+			all[b.Name] = b
+		}
+	}
+	if s.plugins != nil {
+		for _, b := range s.plugins.builtins() {
+			if _, ok := all[b.Name]; !ok {
+				all[b.Name] = b
+			}
+		}
+	}
+	return all
+}
+
+// lookupBuiltin returns the builtin named by the first word of command and
+// the remaining words as its arguments.
+func (s *server) lookupBuiltin(command string) (builtin, []string, bool) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return builtin{}, nil, false
+	}
+	b, ok := s.builtins()[fields[0]]
+	if ok && b.Claims != nil && !b.Claims(fields[1:]) {
+		return builtin{}, nil, false
+	}
+	return b, fields[1:], ok
+}
+
+func runHelp(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+
+	all := s.builtins()
+	names := make([]string, 0, len(all))
+	width := 0
+	for name, b := range all {
+		names = append(names, name)
+		if len(b.Usage) > width {
+			width = len(b.Usage)
+		}
+	}
+	sort.Strings(names)
+
+	lines := []string{"Builtin commands:"}
+	for _, name := range names {
+		b := all[name]
+		lines = append(lines, fmt.Sprintf("  %-*s  %s", width, b.Usage, b.Summary))
+	}
+	lines = append(lines, "Anything else is run with sh.")
+
+	return commandResult{Lines: lines, Duration: time.Since(startTime)}
+}
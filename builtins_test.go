@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHandleCommand_Help(t *testing.T) {
+	s := newServer(config{})
+
+	data := url.Values{}
+	data.Set("text", "$ help")
+
+	response := postCommand(t, s, data)
+
+	if !strings.Contains(response["text"], "Builtin commands:") {
+		t.Errorf("Expected builtin list, got %q", response["text"])
+	}
+	if !strings.Contains(response["text"], "list builtin commands") {
+		t.Errorf("Expected help to list itself, got %q", response["text"])
+	}
+}
+
+func TestHandleCommand_Status(t *testing.T) {
+	f := newFakeSlack(t)
+	s := newServer(f.config())
+	s.slack.call(context.Background(), "test.status", nil, nil)
+
+	data := url.Values{}
+	data.Set("text", "$ status")
+
+	response := postCommand(t, s, data)
+
+	if !strings.Contains(response["text"], "Running jobs: 1") {
+		t.Errorf("Expected the status job itself to be running, got %q", response["text"])
+	}
+	if !strings.Contains(response["text"], "test.status") {
+		t.Errorf("Expected Slack API calls per method, got %q", response["text"])
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// canvasFlushInterval is how often new output is appended to a canvas
+// while a command runs, unless the workspace's rate limits call for less
+// often.
+const canvasFlushInterval = 5 * time.Second
+
+// canvasChunkSize is the most output appended to a canvas in one edit. It
+// grows, up to canvasMaxChunkSize, as edits are made less often, so fewer
+// calls carry the same output.
+const (
+	canvasChunkSize    = 16 << 10
+	canvasMaxChunkSize = 128 << 10
+)
+
+// canvasSummaryLines is how many of the last output lines are posted in
+// the channel alongside the canvas link.
+const canvasSummaryLines = 5
+
+// markdownContent returns a canvas document_content value.
+func markdownContent(markdown string) map[string]string {
+	return map[string]string{"type": "markdown", "markdown": markdown}
+}
+
+// createCanvas creates a standalone canvas and returns its ID.
+func (api *slackAPI) createCanvas(ctx context.Context, title, markdown string) (string, error) {
+	content, err := json.Marshal(markdownContent(markdown))
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		CanvasID string `json:"canvas_id"`
+	}
+	err = api.call(ctx, "canvases.create", url.Values{"title": {title}, "document_content": {string(content)}}, &resp)
+	return resp.CanvasID, err
+}
+
+// shareCanvas lets the members of a channel read a canvas.
+func (api *slackAPI) shareCanvas(ctx context.Context, canvasID, channel string) error {
+	channels, err := json.Marshal([]string{channel})
+	if err != nil {
+		return err
+	}
+	return api.call(ctx, "canvases.access.set", url.Values{
+		"canvas_id":    {canvasID},
+		"access_level": {"read"},
+		"channel_ids":  {string(channels)},
+	}, nil)
+}
+
+// appendCanvas adds markdown to the end of a canvas.
+func (api *slackAPI) appendCanvas(ctx context.Context, canvasID, markdown string) error {
+	changes, err := json.Marshal([]map[string]interface{}{{
+		"operation":        "insert_at_end",
+		"document_content": markdownContent(markdown),
+	}})
+	if err != nil {
+		return err
+	}
+	return api.call(ctx, "canvases.edit", url.Values{"canvas_id": {canvasID}, "changes": {string(changes)}}, nil)
+}
+
+// deleteCanvas deletes a canvas.
+func (api *slackAPI) deleteCanvas(ctx context.Context, canvasID string) error {
+	return api.call(ctx, "canvases.delete", url.Values{"canvas_id": {canvasID}}, nil)
+}
+
+// replaceCanvas replaces the whole content of a canvas with markdown.
+func (api *slackAPI) replaceCanvas(ctx context.Context, canvasID, markdown string) error {
+	changes, err := json.Marshal([]map[string]interface{}{{
+		"operation":        "replace",
+		"document_content": markdownContent(markdown),
+	}})
+	if err != nil {
+		return err
+	}
+	return api.call(ctx, "canvases.edit", url.Values{"canvas_id": {canvasID}, "changes": {string(changes)}}, nil)
+}
+
+// canvasStream appends a command's output to a canvas as it is produced.
+// Output is collected by Write and sent in chunks of whole lines.
+type canvasStream struct {
+	api    *slackAPI
+	id     string
+	redact bool
+
+	mu        sync.Mutex
+	pending   bytes.Buffer
+	sent      int  // bytes appended to the canvas so far
+	discarded bool // set once nothing more may be appended
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// canvasAllowed reports whether output of a command may be streamed to a
+// canvas: the canvas is shared with the channel, so the output must be
+// allowed to leave it as a file.
+func (s *server) canvasAllowed(cmd slashCommand) bool {
+	rules := s.cfg.profileFor(cmd.ChannelID).Classification.rules()
+	return s.slack != nil && rules.FileUploads && !rules.PrivateOnly && !s.cfg.SensitiveChannels[cmd.ChannelID]
+}
+
+// startCanvasStream creates a canvas for a command, shares it with the
+// command's channel and starts appending output to it.
+func (s *server) startCanvasStream(ctx context.Context, cmd slashCommand) (*canvasStream, error) {
+	text := s.publicText(cmd)
+	id, err := s.slack.createCanvas(ctx, "Output of "+text, "Output of `"+text+"`\n")
+	if err != nil {
+		return nil, fmt.Errorf("creating canvas: %w", err)
+	}
+	if err := s.slack.shareCanvas(ctx, id, cmd.ChannelID); err != nil {
+		return nil, fmt.Errorf("sharing canvas: %w", err)
+	}
+
+	c := &canvasStream{
+		api:    s.slack,
+		id:     id,
+		redact: s.cfg.profileFor(cmd.ChannelID).Classification.rules().Redact,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go c.run(context.WithoutCancel(ctx))
+	return c, nil
+}
+
+func (c *canvasStream) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pending.Write(p)
+}
+
+// run flushes complete lines every canvasFlushInterval, or as the
+// workspace's pacer says, and everything that is left once the stream is
+// closed.
+func (c *canvasStream) run(ctx context.Context) {
+	defer close(c.done)
+	defer c.api.pacer.join("canvases.edit")()
+	timer := time.NewTimer(c.api.pacer.interval("canvases.edit", canvasFlushInterval))
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			c.flush(ctx, false)
+			timer.Reset(c.api.pacer.interval("canvases.edit", canvasFlushInterval))
+		case <-c.stop:
+			c.flush(ctx, true)
+			return
+		}
+	}
+}
+
+// flush appends pending output to the canvas. Unless all is set, a
+// trailing partial line is kept for the next flush.
+func (c *canvasStream) flush(ctx context.Context, all bool) {
+	c.mu.Lock()
+	if c.discarded {
+		c.mu.Unlock()
+		return
+	}
+	data := c.pending.Bytes()
+	if !all {
+		data = data[:bytes.LastIndexByte(data, '\n')+1]
+	}
+	out := string(data)
+	c.pending.Next(len(data))
+	c.mu.Unlock()
+
+	out = strings.ReplaceAll(stripANSI(out), "\r\n", "\n")
+	chunkSize := min(int(canvasChunkSize*c.api.pacer.scale("canvases.edit", canvasFlushInterval)), canvasMaxChunkSize)
+	for out != "" {
+		chunk := out
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+			if i := strings.LastIndexByte(chunk, '\n'); i > 0 {
+				chunk = chunk[:i+1]
+			}
+		}
+		out = out[len(chunk):]
+
+		lines := strings.Split(strings.TrimSuffix(chunk, "\n"), "\n")
+		if c.redact {
+			lines = redactLines(lines)
+		}
+		if err := c.api.appendCanvas(ctx, c.id, "```\n"+strings.Join(lines, "\n")+"\n```\n"); err != nil {
+			fmt.Fprintf(os.Stderr, "Error appending to canvas: %v\n", err)
+			if errorCodeOf(err, "") == codeSlackRateLimited && !all {
+				// Kept for the next flush, which the pacer delays.
+				c.mu.Lock()
+				rest := append([]byte(chunk+out), c.pending.Bytes()...)
+				c.pending.Reset()
+				c.pending.Write(rest)
+				c.mu.Unlock()
+			}
+			return
+		}
+		c.mu.Lock()
+		c.sent += len(chunk)
+		c.mu.Unlock()
+	}
+}
+
+// close sends the remaining output, including lines from a result that
+// was not streamed, such as a builtin's, and returns the canvas link.
+func (c *canvasStream) close(ctx context.Context, result commandResult) string {
+	close(c.stop)
+	<-c.done
+
+	c.mu.Lock()
+	streamed := c.sent > 0
+	c.mu.Unlock()
+	if !streamed && len(result.Lines) > 0 {
+		c.Write([]byte(strings.Join(result.Lines, "\n") + "\n"))
+		c.flush(ctx, true)
+	}
+
+	f, err := c.api.fileInfo(ctx, c.id)
+	if err != nil || f.Permalink == "" {
+		return ""
+	}
+	return f.Permalink
+}
+
+// discard stops the stream without sending the remaining output and
+// deletes the canvas, as when the output contained a secret. A canvas that
+// cannot be deleted is emptied instead.
+func (c *canvasStream) discard(ctx context.Context) {
+	c.mu.Lock()
+	c.discarded = true
+	c.pending.Reset()
+	c.mu.Unlock()
+	close(c.stop)
+	<-c.done
+
+	err := c.api.deleteCanvas(ctx, c.id)
+	if err == nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Error deleting canvas %s: %v\n", c.id, err)
+	if err := c.api.replaceCanvas(ctx, c.id, "Output withheld: it contained a secret.\n"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error emptying canvas %s: %v\n", c.id, err)
+	}
+}
+
+// canvasSummary replaces a result's output with its last lines, since the
+// full output is in the canvas.
+func canvasSummary(result commandResult) commandResult {
+	if omitted := len(result.Lines) - canvasSummaryLines; omitted > 0 {
+		tail := append([]string{fmt.Sprintf("... %d earlier lines in the canvas", omitted)}, result.Lines[omitted:]...)
+		result.Lines = tail
+	}
+	return result
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCanvas_StreamsOutputAndLinks(t *testing.T) {
+	f := newFakeSlack(t)
+	f.respond("canvases.create", map[string]interface{}{"canvas_id": "F0CANVAS1"})
+	f.respond("files.info", map[string]interface{}{"file": map[string]string{"id": "F0CANVAS1", "permalink": "https://example.slack.com/docs/T1/F0CANVAS1"}})
+	s := newServer(f.config())
+
+	response := s.handleCommandExecution(context.Background(), slashCommand{Text: "$ --canvas seq 1 20", UserID: "U1", ChannelID: "C1"})
+
+	text := response["text"]
+	if !strings.Contains(text, "<https://example.slack.com/docs/T1/F0CANVAS1|Full output in canvas>") {
+		t.Errorf("Expected canvas link, got %q", text)
+	}
+	if !strings.Contains(text, "... 15 earlier lines in the canvas\n16\n") || strings.Contains(text, "\n15\n") {
+		t.Errorf("Expected only the last lines in the channel, got %q", text)
+	}
+
+	if calls := f.callsTo("canvases.access.set"); len(calls) != 1 || calls[0].Params.Get("channel_ids") != `["C1"]` {
+		t.Errorf("Expected canvas to be shared with the channel, got %v", calls)
+	}
+	var streamed strings.Builder
+	for _, c := range f.callsTo("canvases.edit") {
+		var changes []struct {
+			DocumentContent struct {
+				Markdown string `json:"markdown"`
+			} `json:"document_content"`
+		}
+		json.Unmarshal([]byte(c.Params.Get("changes")), &changes)
+		for _, ch := range changes {
+			streamed.WriteString(ch.DocumentContent.Markdown)
+		}
+	}
+	if !strings.Contains(streamed.String(), "1\n2\n3\n") || !strings.Contains(streamed.String(), "\n20\n") {
+		t.Errorf("Expected full output in the canvas, got %q", streamed.String())
+	}
+}
+
+func TestCanvas_RefusedWhenOutputIsPrivate(t *testing.T) {
+	f := newFakeSlack(t)
+	cfg := f.config()
+	cfg.SensitiveChannels = map[string]bool{"C1": true}
+	s := newServer(cfg)
+
+	response := s.handleCommandExecution(context.Background(), slashCommand{Text: "$ --canvas seq 1 20", UserID: "U1", ChannelID: "C1"})
+	if !strings.Contains(response["text"], "--canvas needs") || len(f.callsTo("canvases.create")) != 0 {
+		t.Errorf("Expected --canvas to be refused, got %q", response["text"])
+	}
+}
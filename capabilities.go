@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// capability is a feature a command may need from whatever runs it, such
+// as a pseudo-terminal or access to the host's files.
+type capability string
+
+const (
+	capPTY   capability = "pty"   // run under a pseudo-terminal, as with --pty
+	capStdin capability = "stdin" // read input, as with --stdin or --file
+	capFiles capability = "files" // read the host's files
+)
+
+// capabilityFlags names the meta-flags that request a capability, for
+// error messages.
+var capabilityFlags = map[capability]string{
+	capPTY:   "--pty",
+	capStdin: "--stdin and --file",
+}
+
+// backend is where shell commands run. Each advertises what it supports,
+// so that commands asking for more are refused before they start rather
+// than failing halfway.
+type backend struct {
+	Name string
+	Caps []capability
+}
+
+func (b backend) supports(c capability) bool {
+	return slices.Contains(b.Caps, c)
+}
+
+// localBackend runs commands with sh on the server's host.
+var localBackend = backend{Name: "local", Caps: localCaps()}
+
+func localCaps() []capability {
+	caps := []capability{capStdin, capFiles}
+	if ptySupported {
+		caps = append(caps, capPTY)
+	}
+	return caps
+}
+
+// requestedCaps returns the capabilities asked for by meta-flags.
+func requestedCaps(flags metaFlags) []capability {
+	var caps []capability
+	if flags.PTY {
+		caps = append(caps, capPTY)
+	}
+	if flags.Stdin || flags.File != "" {
+		caps = append(caps, capStdin)
+	}
+	return caps
+}
+
+// checkCapabilities reports an error if a command asks for something that
+// will not be honored: a meta-flag the builtin or backend running it does
+// not support, or a builtin needing something the backend lacks.
+func (s *server) checkCapabilities(be backend, command string, flags metaFlags) error {
+	b, _, isBuiltin := s.lookupBuiltin(command)
+	for _, c := range requestedCaps(flags) {
+		if isBuiltin && !slices.Contains(b.Accepts, c) {
+			return fmt.Errorf("the %s builtin does not support %s", b.Name, capabilityFlags[c])
+		}
+		if !isBuiltin && !be.supports(c) {
+			return fmt.Errorf("the %s backend does not support %s", be.Name, capabilityFlags[c])
+		}
+	}
+	if isBuiltin {
+		for _, c := range b.Needs {
+			if !be.supports(c) {
+				return fmt.Errorf("the %s builtin needs %s, which the %s backend does not support", b.Name, c, be.Name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCheckCapabilities(t *testing.T) {
+	s := newServer(config{})
+
+	tests := []struct {
+		command string
+		flags   metaFlags
+		want    string // substring of the error, or "" for none
+	}{
+		{"echo hi", metaFlags{Stdin: true}, ""},
+		{"status", metaFlags{}, ""},
+		{"status", metaFlags{PTY: true}, "the status builtin does not support --pty"},
+		{"sha256 /etc/hostname", metaFlags{File: "F1"}, "the sha256 builtin does not support --stdin and --file"},
+		// head without -c goes to the shell, which can read stdin.
+		{"head -n 1", metaFlags{Stdin: true}, ""},
+	}
+	for _, tt := range tests {
+		err := s.checkCapabilities(localBackend, tt.command, tt.flags)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("checkCapabilities(%q) = %v, want no error", tt.command, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("checkCapabilities(%q) = %v, want %q", tt.command, err, tt.want)
+		}
+	}
+}
+
+func TestCheckCapabilities_BackendLacksNeed(t *testing.T) {
+	saved := localBackend
+	defer func() { localBackend = saved }()
+	localBackend = backend{Name: "local", Caps: []capability{capStdin}}
+
+	s := newServer(config{})
+	err := s.checkCapabilities(localBackend, "sha256 /etc/hostname", metaFlags{})
+	if err == nil || !strings.Contains(err.Error(), "needs files") {
+		t.Errorf("Expected sha256 to need files, got %v", err)
+	}
+	err = s.checkCapabilities(localBackend, "top -b -n 1", metaFlags{PTY: true})
+	if err == nil || !strings.Contains(err.Error(), "the local backend does not support --pty") {
+		t.Errorf("Expected --pty to be refused, got %v", err)
+	}
+}
+
+func TestHandleCommand_UnsupportedMetaFlag(t *testing.T) {
+	s := newServer(config{})
+
+	data := url.Values{}
+	data.Set("text", "$ --stdin help\n---\ninput")
+
+	response := postCommand(t, s, data)
+
+	if response["response_type"] != "ephemeral" || !strings.Contains(response["text"], "does not support") {
+		t.Errorf("Expected an immediate capability error, got %v", response)
+	}
+}
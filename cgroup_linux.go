@@ -0,0 +1,20 @@
+//go:build linux
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+const cgroupsSupported = true
+
+// attach starts cmd directly in the cgroup, so that nothing it does
+// escapes the limits, even in its first instants.
+func (cg *commandCgroup) attach(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(cg.fd.Fd())
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "os/exec"
+
+const cgroupsSupported = false
+
+func (cg *commandCgroup) attach(cmd *exec.Cmd) {}
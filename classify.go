@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// Severities assigned by the classifier, from least to most severe.
+const (
+	severitySafe      = "safe"
+	severityWarn      = "warn"
+	severityDangerous = "dangerous"
+)
+
+var severityRank = map[string]int{severitySafe: 0, severityWarn: 1, severityDangerous: 2}
+
+// What to do with dangerous commands.
+const (
+	dangerousConfirm = "confirm"
+	dangerousBlock   = "block"
+)
+
+// commandSeverities counts classified commands by severity.
+var commandSeverities = expvar.NewMap("command_severity")
+
+// classifierRule tags commands matching Pattern with a severity.
+type classifierRule struct {
+	Pattern  string `json:"pattern"`
+	Severity string `json:"severity"`
+	Reason   string `json:"reason"`
+
+	re *regexp.Regexp
+}
+
+// loadClassifierRules reads rules from a JSON array such as
+// [{"pattern": "^git push --force", "severity": "warn", "reason": "force push"}].
+func loadClassifierRules(path string) ([]classifierRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []classifierRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for i, r := range rules {
+		if _, ok := severityRank[r.Severity]; !ok {
+			return nil, fmt.Errorf("rule %d: unknown severity %q", i+1, r.Severity)
+		}
+		if rules[i].re, err = regexp.Compile(r.Pattern); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		if r.Reason == "" {
+			rules[i].Reason = "matches " + r.Pattern
+		}
+	}
+	return rules, nil
+}
+
+// dangerRules turns DANGER_PATTERNS into dangerous rules.
+func dangerRules(patterns []*regexp.Regexp) []classifierRule {
+	var rules []classifierRule
+	for _, re := range patterns {
+		rules = append(rules, classifierRule{
+			Pattern:  re.String(),
+			Severity: severityDangerous,
+			Reason:   "matches " + re.String(),
+			re:       re,
+		})
+	}
+	return rules
+}
+
+// classify returns the highest severity of the rules a command matches,
+// and the reasons of the rules at that severity. Commands matching no rule
+// are safe.
+func (s *server) classify(command string) (string, []string) {
+	severity := severitySafe
+	var reasons []string
+	for _, r := range s.cfg.ClassifierRules {
+		if !r.re.MatchString(command) {
+			continue
+		}
+		switch rank := severityRank[r.Severity]; {
+		case rank > severityRank[severity]:
+			severity = r.Severity
+			reasons = []string{r.Reason}
+		case rank == severityRank[severity] && rank > 0:
+			reasons = append(reasons, r.Reason)
+		}
+	}
+	commandSeverities.Add(severity, 1)
+	return severity, reasons
+}
+
+// severityFooter renders the warning appended to the output of a command
+// that is not safe.
+func severityFooter(severity string, reasons []string) string {
+	if severity == severitySafe {
+		return ""
+	}
+	footer := "\n_⚠️ " + severity
+	for i, reason := range reasons {
+		if i == 0 {
+			footer += ": "
+		} else {
+			footer += ", "
+		}
+		footer += reason
+	}
+	return footer + "_"
+}
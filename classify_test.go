@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	os.WriteFile(path, []byte(`[
+		{"pattern": "^git push .*--force", "severity": "warn", "reason": "force push"},
+		{"pattern": "^sudo ", "severity": "warn"},
+		{"pattern": "^sudo reboot", "severity": "dangerous", "reason": "reboots the host"}
+	]`), 0o644)
+	rules, err := loadClassifierRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer(config{ClassifierRules: rules})
+
+	tests := []struct {
+		command  string
+		severity string
+		reasons  []string
+	}{
+		{"ls", severitySafe, nil},
+		{"git push origin --force", severityWarn, []string{"force push"}},
+		{"sudo ls", severityWarn, []string{"matches ^sudo "}},
+		{"sudo reboot", severityDangerous, []string{"reboots the host"}},
+	}
+	for _, tt := range tests {
+		severity, reasons := s.classify(tt.command)
+		if severity != tt.severity || !reflect.DeepEqual(reasons, tt.reasons) {
+			t.Errorf("classify(%q) = %s %v, want %s %v", tt.command, severity, reasons, tt.severity, tt.reasons)
+		}
+	}
+}
+
+func TestLoadClassifierRules_UnknownSeverity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	os.WriteFile(path, []byte(`[{"pattern": "x", "severity": "scary"}]`), 0o644)
+	if _, err := loadClassifierRules(path); err == nil {
+		t.Error("Expected error for unknown severity")
+	}
+}
+
+func TestClassify_WarningFooter(t *testing.T) {
+	s := newServer(config{ClassifierRules: []classifierRule{
+		{Pattern: "^echo", Severity: severityWarn, Reason: "echoes", re: regexp.MustCompile("^echo")},
+	}})
+
+	response := s.handleCommandExecution(context.Background(), slashCommand{Text: "$ echo hi", UserID: "U1"})
+	if !strings.HasSuffix(response["text"], "\n_⚠️ warn: echoes_") {
+		t.Errorf("Expected warning footer, got %q", response["text"])
+	}
+}
+
+func TestClassify_BlockDangerous(t *testing.T) {
+	s := newServer(config{
+		DangerousAction: dangerousBlock,
+		ClassifierRules: []classifierRule{
+			{Pattern: "^echo", Severity: severityDangerous, Reason: "echoes", re: regexp.MustCompile("^echo")},
+		},
+	})
+
+	response := s.handleCommandExecution(context.Background(), slashCommand{Text: "$ echo hi", UserID: "U1"})
+	if response["text"] != "_blocked: echoes_ `COMMAND_BLOCKED`" {
+		t.Errorf("Expected command to be blocked, got %q", response["text"])
+	}
+}
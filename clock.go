@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // zones for hosts without a zoneinfo database
+)
+
+// zoneAreas are the IANA areas tried for a bare city name, so that
+// "Tokyo" finds Asia/Tokyo.
+var zoneAreas = []string{"America", "Europe", "Asia", "Africa", "Australia", "Pacific", "Atlantic", "Indian", "Antarctica"}
+
+// zoneAliases are common names that are not IANA zone names.
+var zoneAliases = map[string]string{
+	"utc": "UTC", "gmt": "UTC", "z": "UTC",
+	"pt": "America/Los_Angeles", "pst": "America/Los_Angeles", "pdt": "America/Los_Angeles",
+	"mt": "America/Denver", "mst": "America/Denver", "mdt": "America/Denver",
+	"ct": "America/Chicago", "cst": "America/Chicago", "cdt": "America/Chicago",
+	"et": "America/New_York", "est": "America/New_York", "edt": "America/New_York",
+	"bst": "Europe/London", "cet": "Europe/Paris", "cest": "Europe/Paris",
+	"ist": "Asia/Kolkata", "jst": "Asia/Tokyo", "aest": "Australia/Sydney",
+	"san francisco": "America/Los_Angeles", "sf": "America/Los_Angeles", "seattle": "America/Los_Angeles",
+	"washington": "America/New_York", "boston": "America/New_York", "nyc": "America/New_York",
+	"austin": "America/Chicago", "dallas": "America/Chicago",
+	"bangalore": "Asia/Kolkata", "bengaluru": "Asia/Kolkata", "mumbai": "Asia/Kolkata", "delhi": "Asia/Kolkata",
+	"beijing": "Asia/Shanghai", "munich": "Europe/Berlin", "frankfurt": "Europe/Berlin",
+}
+
+// findZone resolves an IANA zone name, a city or a common abbreviation.
+func findZone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if alias, ok := zoneAliases[strings.ToLower(name)]; ok {
+		return time.LoadLocation(alias)
+	}
+	if loc, err := time.LoadLocation(name); err == nil && name != "" && name != "Local" {
+		return loc, nil
+	}
+
+	// Zone names capitalize each word and use underscores for spaces.
+	words := strings.Fields(strings.ToLower(name))
+	for i, w := range words {
+		words[i] = strings.ToUpper(w[:1]) + w[1:]
+	}
+	city := strings.Join(words, "_")
+	for _, area := range zoneAreas {
+		if loc, err := time.LoadLocation(area + "/" + city); err == nil {
+			return loc, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown time zone or city %q", name)
+}
+
+// formatClock renders a time with its weekday, zone and UTC offset.
+func formatClock(t time.Time) string {
+	return t.Format("Mon 2006-01-02 15:04:05 MST (UTC-07:00)")
+}
+
+func runTime(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	if len(args) < 2 {
+		return commandResult{Lines: []string{"usage: time in <city or zone>[, <city or zone>...]"}, ExitCode: 2, Duration: time.Since(startTime)}
+	}
+
+	now := time.Now()
+	var lines []string
+	for _, name := range strings.Split(strings.Join(args[1:], " "), ",") {
+		loc, err := findZone(name)
+		if err != nil {
+			return commandResult{Lines: []string{err.Error()}, ExitCode: 1, Duration: time.Since(startTime)}
+		}
+		lines = append(lines, fmt.Sprintf("%s (%s): %s", strings.TrimSpace(name), loc, formatClock(now.In(loc))))
+	}
+	return commandResult{Lines: lines, Duration: time.Since(startTime)}
+}
+
+// claimsTime limits the time builtin to "time in ...", leaving the shell's
+// time for timing commands.
+func claimsTime(args []string) bool {
+	return len(args) > 0 && args[0] == "in"
+}
+
+func runEpoch(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	if len(args) == 0 {
+		return commandResult{Lines: []string{strconv.FormatInt(time.Now().Unix(), 10)}, Duration: time.Since(startTime)}
+	}
+
+	arg := strings.Join(args, " ")
+	if t, err := time.Parse(time.RFC3339, arg); err == nil {
+		return commandResult{Lines: []string{strconv.FormatInt(t.Unix(), 10)}, Duration: time.Since(startTime)}
+	}
+	t, unit, err := parseEpoch(arg)
+	if err != nil {
+		return commandResult{Lines: []string{"usage: epoch [<timestamp> | <RFC 3339 time>]"}, ExitCode: 2, Duration: time.Since(startTime)}
+	}
+	lines := []string{
+		fmt.Sprintf("%s (%s)", arg, unit),
+		"UTC:   " + formatClock(t.UTC()),
+		"local: " + formatClock(t.Local()),
+		relativeTime(t, time.Now()),
+	}
+	return commandResult{Lines: lines, Duration: time.Since(startTime)}
+}
+
+// parseEpoch reads a Unix timestamp, telling seconds, milliseconds,
+// microseconds and nanoseconds apart by magnitude.
+func parseEpoch(s string) (time.Time, string, error) {
+	if sec, frac, ok := strings.Cut(s, "."); ok {
+		n, err := strconv.ParseInt(sec, 10, 64)
+		if err != nil {
+			return time.Time{}, "", err
+		}
+		f, err := strconv.ParseFloat("0."+frac, 64)
+		if err != nil {
+			return time.Time{}, "", err
+		}
+		return time.Unix(n, int64(f*1e9)), "seconds", nil
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	abs := n
+	if abs < 0 {
+		abs = -abs
+	}
+	switch {
+	case abs < 1e11:
+		return time.Unix(n, 0), "seconds", nil
+	case abs < 1e14:
+		return time.UnixMilli(n), "milliseconds", nil
+	case abs < 1e17:
+		return time.UnixMicro(n), "microseconds", nil
+	}
+	return time.Unix(0, n), "nanoseconds", nil
+}
+
+// relativeTime describes t relative to now in the largest whole unit.
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	suffix := "ago"
+	if d < 0 {
+		d, suffix = -d, "from now"
+	}
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"year", 365 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+		{"second", time.Second},
+	}
+	for _, u := range units {
+		if n := int64(d / u.size); n > 0 {
+			if n > 1 {
+				return fmt.Sprintf("%d %ss %s", n, u.name, suffix)
+			}
+			return fmt.Sprintf("1 %s %s", u.name, suffix)
+		}
+	}
+	return "now"
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindZone(t *testing.T) {
+	for name, want := range map[string]string{
+		"Tokyo":         "Asia/Tokyo",
+		"new york":      "America/New_York",
+		"Europe/Berlin": "Europe/Berlin",
+		"PST":           "America/Los_Angeles",
+		"Bangalore":     "Asia/Kolkata",
+		"utc":           "UTC",
+		" sao paulo ":   "America/Sao_Paulo",
+	} {
+		loc, err := findZone(name)
+		if err != nil || loc.String() != want {
+			t.Errorf("%q: expected %s, got %v (%v)", name, want, loc, err)
+		}
+	}
+	if _, err := findZone("Atlantis"); err == nil {
+		t.Error("Expected an error for an unknown city")
+	}
+}
+
+func TestHandleCommand_TimeIn(t *testing.T) {
+	s := newServer(config{})
+
+	data := url.Values{}
+	data.Set("text", "$ time in Tokyo, London")
+
+	response := postCommand(t, s, data)
+
+	if !strings.Contains(response["text"], "Tokyo (Asia/Tokyo): ") || !strings.Contains(response["text"], "London (Europe/London): ") {
+		t.Errorf("Expected the time in both cities, got %q", response["text"])
+	}
+}
+
+func TestHandleCommand_TimeLeftToShell(t *testing.T) {
+	s := newServer(config{})
+	if _, _, ok := s.lookupBuiltin("time sleep 0"); ok {
+		t.Error("Expected time without 'in' to be left to the shell")
+	}
+}
+
+func TestParseEpoch(t *testing.T) {
+	want := time.Date(2024, 6, 20, 16, 13, 20, 0, time.UTC)
+	for _, in := range []string{"1718900000", "1718900000000", "1718900000000000", "1718900000000000000"} {
+		got, _, err := parseEpoch(in)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("%s: expected %s, got %s (%v)", in, want, got.UTC(), err)
+		}
+	}
+	if got, _, _ := parseEpoch("1718900000.5"); !got.Equal(want.Add(500 * time.Millisecond)) {
+		t.Errorf("Expected fractional seconds, got %s", got.UTC())
+	}
+}
+
+func TestRunEpoch(t *testing.T) {
+	result := runEpoch(context.Background(), nil, slashCommand{}, []string{"1718900000"})
+	if out := strings.Join(result.Lines, "\n"); !strings.Contains(out, "UTC:   Thu 2024-06-20 16:13:20 UTC (UTC+00:00)") || !strings.Contains(out, "ago") {
+		t.Errorf("Expected the date in UTC and how long ago, got %q", out)
+	}
+
+	result = runEpoch(context.Background(), nil, slashCommand{}, []string{"2024-06-20T16:13:20Z"})
+	if len(result.Lines) != 1 || result.Lines[0] != "1718900000" {
+		t.Errorf("Expected the timestamp of a date, got %q", result.Lines)
+	}
+}
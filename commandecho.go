@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Command echo settings of profiles: how the command is shown in messages
+// others can see.
+const (
+	echoFull = "full" // as typed, redacted if the profile redacts
+	echoMask = "mask" // the program's name only, e.g. "$ ssh …"
+	echoOmit = "omit" // not at all
+)
+
+// hiddenCommand stands in for an omitted command in messages that refer to
+// it, such as heartbeats.
+const hiddenCommand = "…"
+
+// maskCommand shows only the base name of the program a command runs, so
+// the paths, hosts and arguments it was given are not shown.
+func maskCommand(text string) string {
+	_, command := normalizeCommand(text)
+	fields := strings.Fields(command)
+	masked := hiddenCommand
+	if len(fields) > 0 {
+		masked = path.Base(fields[0])
+		if len(fields) > 1 {
+			masked += " " + hiddenCommand
+		}
+	}
+	if strings.HasPrefix(strings.TrimSpace(text), "$") {
+		masked = "$ " + masked
+	}
+	return masked
+}
+
+// echo returns a command's text as the profile shows it to others.
+func (p profile) echo(text string) string {
+	switch p.CommandEcho {
+	case echoMask:
+		return maskCommand(text)
+	case echoOmit:
+		return hiddenCommand
+	}
+	return text
+}
+
+// publicText returns the command text as it may be shown in messages
+// others can see, masked or left out as the channel's profile says.
+func (s *server) publicText(cmd slashCommand) string {
+	return s.cfg.profileFor(cmd.ChannelID).echo(s.displayText(cmd))
+}
+
+// showCommand tells the invoker alone which command a result with a masked
+// or omitted command belongs to.
+func (s *server) showCommand(ctx context.Context, cmd slashCommand) {
+	note := ephemeral(fmt.Sprintf("_you ran_ `%s`", s.displayText(cmd)))
+	var err error
+	switch {
+	case cmd.ResponseURL != "":
+		err = postWebhook(ctx, s.client, cmd.ResponseURL, note)
+	case s.slack != nil && cmd.ChannelID != "":
+		err = s.sendInThread(ctx, cmd, note)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error showing the command to its invoker: %v\n", err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaskCommand(t *testing.T) {
+	tests := []struct{ text, want string }{
+		{"$ ssh db-prod.internal uptime", "$ ssh …"},
+		{"$ /srv/billing/bin/reconcile --all", "$ reconcile …"},
+		{"$ --pty top", "$ top"},
+		{"$ uptime", "$ uptime"},
+		{"$", "$ …"},
+		{"df -h", "df …"},
+	}
+	for _, tt := range tests {
+		if got := maskCommand(tt.text); got != tt.want {
+			t.Errorf("maskCommand(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestHandleCommand_CommandEcho(t *testing.T) {
+	tests := []struct {
+		echo, want string
+	}{
+		{echoMask, "```$ echo …\ndb-prod.internal```"},
+		{echoOmit, "```…\ndb-prod.internal```"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.echo, func(t *testing.T) {
+			ts, messages := messageRecorder(t)
+			s := newServer(config{Profiles: []profile{{Name: "default", CommandEcho: tt.echo}}})
+
+			data := url.Values{}
+			data.Set("text", "$ echo db-prod.internal")
+			data.Set("response_url", ts.URL)
+
+			response := postCommand(t, s, data)
+
+			if response["response_type"] != "in_channel" || !strings.HasPrefix(response["text"], tt.want) {
+				t.Errorf("Expected the output with the command hidden, got %q", response["text"])
+			}
+			select {
+			case m := <-messages:
+				if m["response_type"] != "ephemeral" || m["text"] != "_you ran_ `$ echo db-prod.internal`" {
+					t.Errorf("Expected the command shown to the invoker alone, got %v", m)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Expected the command shown to the invoker")
+			}
+		})
+	}
+}
+
+func TestHandleCommand_CommandEchoPrivateOutput(t *testing.T) {
+	ts, messages := messageRecorder(t)
+	s := newServer(config{Profiles: []profile{{Name: "default", CommandEcho: echoOmit, Classification: classSecret}}})
+
+	data := url.Values{}
+	data.Set("text", "$ echo hello")
+	data.Set("response_url", ts.URL)
+
+	postCommand(t, s, data)
+
+	m := <-messages
+	if text, _ := m["text"].(string); !strings.Contains(text, "$ echo hello") {
+		t.Errorf("Expected private output to keep its command, got %v", m)
+	}
+}
+
+func TestLoadProfiles_CommandEcho(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	if err := os.WriteFile(path, []byte(`[{"name": "x", "command_echo": "blur"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadProfiles(path); err == nil || !strings.Contains(err.Error(), "command_echo") {
+		t.Errorf("Expected error for unknown command_echo, got %v", err)
+	}
+}
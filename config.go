@@ -0,0 +1,928 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// config holds server settings read from the environment.
+type config struct {
+	Port string
+
+	// SensitiveChannels lists channel IDs where command output is never
+	// posted to the channel. Only the status line is shown publicly and the
+	// full output is sent to the invoker as an ephemeral message.
+	SensitiveChannels map[string]bool
+
+	// SigningSecret enables Slack request signature verification. Requests
+	// older than SignatureMaxAge, allowing SignatureClockSkew of clock
+	// difference either way, are rejected.
+	SigningSecret      string
+	SignatureMaxAge    time.Duration
+	SignatureClockSkew time.Duration
+
+	// SlackToken is a bot token for calling the Slack Web API at
+	// SlackAPIURL. Features that need the Web API are unavailable without it.
+	SlackToken  string
+	SlackAPIURL string
+
+	// MaxMessageChars is the largest message posted, zero for no limit.
+	// Longer output is shortened to a preview and, where allowed, uploaded
+	// as a file.
+	MaxMessageChars int
+
+	// InspectPaths are the directories the sha256, stat and head builtins
+	// may read below. Empty allows any path the server can read.
+	InspectPaths []string
+
+	// UploadQuotaBytes and MessageQuota cap the bytes uploaded and
+	// messages posted to the workspace per day, zero for no limit. Over
+	// the upload quota, output is shortened with a link to its transcript
+	// instead of uploaded; over the message quota, replies are only shown
+	// to the invoker and nothing else is posted.
+	UploadQuotaBytes int64
+	MessageQuota     int64
+
+	// MaxFileSize caps the size of Slack files downloaded with --file.
+	MaxFileSize int64
+
+	// AccessLogSampling maps route names to the fraction of their requests
+	// that are access logged. Routes not listed are always logged.
+	AccessLogSampling map[string]float64
+
+	// OPAURL is an Open Policy Agent data API URL consulted before every
+	// command. If the policy cannot be evaluated the command is denied,
+	// unless PolicyFailOpen is set.
+	OPAURL         string
+	PolicyFailOpen bool
+
+	// PluginsDir holds WASM plugins, which are reloaded when their files
+	// change. Each plugin call is limited to PluginTimeout and
+	// PluginMemoryLimitMB of memory.
+	PluginsDir          string
+	PluginTimeout       time.Duration
+	PluginMemoryLimitMB int
+
+	// ProvidersDir holds command provider executables, which add builtins.
+	// They are discovered at startup and each call is limited to
+	// PluginTimeout.
+	ProvidersDir string
+
+	// LuaHooksFile is a Lua script whose hook functions transform requests
+	// and responses. Each hook call is limited to PluginTimeout.
+	LuaHooksFile string
+
+	// MirrorURL is a staging instance that receives sanitized, dry-run
+	// copies of every slash command request.
+	MirrorURL string
+
+	// FormatVariants names one formatter, or two to split channels between
+	// them: FormatSplit is the fraction of channels that get the second.
+	FormatVariants []string
+	FormatSplit    float64
+
+	// Interactivity enables interactive messages such as the Stop button on
+	// running commands. The Slack app's interactivity request URL must point
+	// at Paths.Interactivity.
+	Interactivity bool
+
+	// DataDir holds the job store. Without it, finished jobs are not kept
+	// and features that need them, such as daily summaries, are disabled.
+	DataDir string
+
+	// Store is where jobs, users, aliases and schedules are kept: an
+	// SQLite database in DataDir (storeSQLite, the default), JSON files in
+	// DataDir (storeFiles), or the Postgres database at DatabaseURL
+	// (storePostgres), which servers of a multi-instance deployment can
+	// share. Setting DatabaseURL selects Postgres.
+	Store       string
+	DatabaseURL string
+
+	// Queue keeps accepted slash commands in DataDir until their results
+	// are posted. They are acknowledged straight away and run in the
+	// background, and those not yet started when the server stops are run
+	// when it starts again.
+	Queue bool
+
+	// DailySummaryAt is the time of day, "HH:MM" in the server's time zone,
+	// at which each active channel gets a summary of the last day. Empty
+	// disables summaries. PublicURL is the server's external base URL, used
+	// for transcript links.
+	DailySummaryAt string
+	PublicURL      string
+
+	// SecurityReportAt is the day and time of the week, such as
+	// "mon 09:00", at which a security report of the past week is sent by
+	// DM to SecurityReportAdmins. SecurityReportTemplate, if set, renders
+	// it instead of the default template.
+	SecurityReportAt       string
+	SecurityReportAdmins   []string
+	SecurityReportTemplate *texttemplate.Template
+
+	// TemplateSuggestionsAt is the day and time of the week, such as
+	// "mon 09:00", at which Admins are sent by DM the commands typed most
+	// often in the past week, with buttons that turn them into templates.
+	TemplateSuggestionsAt string
+
+	// Admins may see every stored job through history, search and the
+	// admin API; other users see their own, and their channel's where its
+	// profile shares history. APITokens map bearer tokens for the admin
+	// API to the user IDs they act as; without any, the API serves public
+	// jobs to every caller.
+	Admins    map[string]bool
+	APITokens map[string]string
+
+	// ApprovalPatterns are regular expressions for commands that only run
+	// after another user approves them, as do commands the policy marks
+	// "approve". Approvers may approve, or anyone but the requester if
+	// empty. Requests expire after ApprovalTTL. Approval needs
+	// Interactivity; without it such commands are refused.
+	ApprovalPatterns []*regexp.Regexp
+	Approvers        []string
+	ApprovalTTL      time.Duration
+
+	// ClassifierRules tag commands as safe, warn or dangerous. Warnings are
+	// shown below the output. Dangerous commands are blocked or, with
+	// DangerousAction "confirm", must be confirmed by the user in a modal,
+	// which needs Interactivity and a Slack token. The rules come from
+	// CLASSIFIER_FILE, plus a dangerous rule for each DANGER_PATTERNS entry.
+	ClassifierRules []classifierRule
+	DangerousAction string
+
+	// Lint annotates replies with problems found in the command by
+	// shellcheck, if installed, and internal rules. Shellcheck is the path
+	// of shellcheck, looked up in PATH if empty. Each profile sets the least
+	// severe finding shown.
+	Lint       bool
+	Shellcheck string
+
+	// Onboarding sends users a tour by DM on their first command. The tour
+	// is OnboardingTour, loaded from ONBOARDING_FILE, or a built-in one. It
+	// needs DataDir to remember who has been seen and a Slack token.
+	Onboarding     bool
+	OnboardingTour []string
+
+	// Templates are curated commands with output post-processors, loaded
+	// from the JSON file named by TEMPLATES_FILE. Each is a builtin.
+	Templates []template
+
+	// Paths are the URL paths of the server's endpoints. They are reloaded
+	// on SIGHUP along with CONFIG_FILE.
+	Paths endpointPaths
+
+	// Profiles are loaded from the JSON file named by PROFILES_FILE.
+	Profiles []profile
+
+	// Inventory is loaded from the YAML file named by INVENTORY_FILE. It
+	// is nil without one.
+	Inventory *inventory
+
+	// Sessions enables persistent shell sessions for commands sent with a
+	// thread_ts. Idle sessions are closed after SessionIdleTimeout.
+	Sessions              bool
+	SessionIdleTimeout    time.Duration
+	SessionCommandTimeout time.Duration
+
+	// CommandTimeout stops a command, including builtins and session
+	// commands, after the given duration. Zero means no limit.
+	CommandTimeout time.Duration
+
+	// HeartbeatInterval is how long a command may show no output before
+	// a "still running" message is posted for it. Zero disables it.
+	HeartbeatInterval time.Duration
+
+	// WatchdogIdle is how long a command may produce no output before the
+	// watchdog acts on it, as set by WatchdogAction: "ask" (the default)
+	// posts Kill and Keep waiting buttons, "kill" kills it. Zero disables
+	// the watchdog.
+	WatchdogIdle   time.Duration
+	WatchdogAction string
+
+	// PTY runs every command attached to a pseudo-terminal. Individual
+	// commands can opt in with the --pty meta-flag.
+	PTY bool
+
+	// ANSIMode is "strip" or "translate". Translate keeps the meaning of
+	// bold text and red and green lines when escape sequences are removed.
+	ANSIMode string
+
+	// SuspiciousAction is "alert" or "block" and applies to commands that
+	// match a detection rule or contain one of the Honeytokens. Alerts are
+	// posted to SecurityWebhookURL.
+	SuspiciousAction   string
+	Honeytokens        []string
+	SecurityWebhookURL string
+
+	// LeakResponse withholds output containing a high-confidence secret,
+	// quarantines its transcript and alerts SecurityChannel or, without
+	// one, SecurityWebhookURL.
+	LeakResponse    bool
+	SecurityChannel string
+
+	// AgentToken is the secret agents authenticate with when they connect
+	// at Paths.Agents. Without it no agents are accepted there.
+	AgentToken string
+
+	// AgentsListenAddr is a second address that accepts agents over
+	// mutual TLS: the server presents AgentsTLSCert, and agents must
+	// present a certificate issued by AgentsClientCA for their name. The
+	// files are reloaded when they change.
+	AgentsListenAddr string
+	AgentsTLSCert    string
+	AgentsTLSKey     string
+	AgentsClientCA   string
+
+	// Docker is the path of the docker CLI that runs commands in the
+	// containers of profiles, looked up in PATH if empty.
+	Docker string
+
+	// SandboxImage runs every shell command that would run on the server's
+	// host in a new, locked-down container of the image instead, removed
+	// when the command ends. It has no network unless SandboxNetwork names
+	// a Docker network to attach it to.
+	SandboxImage   string
+	SandboxNetwork string
+
+	// Limits caps the memory and CPU of each command run on the server's
+	// host, or in a new container, from COMMAND_MEMORY_MAX and
+	// COMMAND_CPU_MAX, in cgroups created beneath CGROUP_PARENT.
+	Limits *commandLimits
+
+	// Rlimits limits the CPU time, file size and open files of each
+	// command run on the server's host, or in a new container, from
+	// COMMAND_CPU_TIME, COMMAND_FILE_SIZE_MAX and COMMAND_OPEN_FILES_MAX.
+	Rlimits *rlimits
+
+	// Env is the environment commands run on the server's host start with,
+	// instead of the server's, which holds its credentials.
+	Env envPolicy
+
+	// OpsChannel receives a report on startup of the version, features,
+	// backends and policy hash the server runs with. It needs a Slack
+	// token.
+	OpsChannel string
+
+	// InlineSecretAction is "warn", "block" or "off" and applies to
+	// commands with a secret typed into them, such as a password in a
+	// connection string.
+	InlineSecretAction string
+
+	// AuditAnchorURL receives the audit log's latest hash every
+	// AuditAnchorInterval, so removed events can be detected.
+	AuditAnchorURL      string
+	AuditAnchorInterval time.Duration
+
+	// AuditSyslog also sends audit events to syslog: "local", or a
+	// udp://, tcp:// or unix:// address.
+	AuditSyslog string
+
+	// ExportBucketURL is an S3 or S3-compatible bucket, such as
+	// https://s3.us-east-1.amazonaws.com/bucket, to which audit events and
+	// job results are uploaded every ExportInterval as JSON lines files
+	// under ExportPrefix.
+	ExportBucketURL string
+	ExportPrefix    string
+	ExportInterval  time.Duration
+
+	// OutputArchive keeps each job's complete output, so shortened
+	// messages can link to it: a directory, gs://bucket or an
+	// S3-compatible https://host/bucket. Keys in buckets start with
+	// OutputArchivePrefix. Output older than OutputRetention is deleted,
+	// unless it is zero. The archive needs DataDir, to check who may see
+	// a job's output.
+	OutputArchive       string
+	OutputArchivePrefix string
+	OutputRetention     time.Duration
+
+	// GCSAccessKeyID and GCSSecretAccessKey are an HMAC key for Cloud
+	// Storage buckets.
+	GCSAccessKeyID     string
+	GCSSecretAccessKey string
+
+	// S3Region and the S3 credentials sign requests to buckets.
+	S3Region          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	S3SessionToken    string
+}
+
+// credentialEnv are the variables loadConfig reads that hold the server's
+// and agents' credentials. Commands never get them from the server's
+// environment, whatever COMMAND_ENV_ALLOW says.
+var credentialEnv = []string{
+	"SLACK_TOKEN", "SLACK_SIGNING_SECRET", "AGENT_TOKEN", "API_TOKENS",
+	"DATABASE_URL", "SECURITY_WEBHOOK_URL", "AUDIT_ANCHOR_URL",
+	"GCS_ACCESS_KEY_ID", "GCS_SECRET_ACCESS_KEY",
+	"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN",
+}
+
+func loadConfig() (config, error) {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadEnvFile(path); err != nil {
+			return config{}, fmt.Errorf("loading config file: %w", err)
+		}
+	}
+
+	cfg := config{
+		Port:                 os.Getenv("PORT"),
+		SensitiveChannels:    envSet("SENSITIVE_CHANNELS"),
+		SigningSecret:        getenv("SLACK_SIGNING_SECRET"),
+		SlackToken:           getenv("SLACK_TOKEN"),
+		SlackAPIURL:          os.Getenv("SLACK_API_URL"),
+		OPAURL:               os.Getenv("OPA_URL"),
+		PluginsDir:           os.Getenv("PLUGINS_DIR"),
+		ProvidersDir:         os.Getenv("PROVIDERS_DIR"),
+		LuaHooksFile:         os.Getenv("LUA_HOOKS_FILE"),
+		MirrorURL:            os.Getenv("MIRROR_URL"),
+		DataDir:              os.Getenv("DATA_DIR"),
+		Store:                os.Getenv("STORE"),
+		DatabaseURL:          getenv("DATABASE_URL"),
+		DailySummaryAt:       os.Getenv("DAILY_SUMMARY_AT"),
+		PublicURL:            os.Getenv("PUBLIC_URL"),
+		SecurityReportAt:     os.Getenv("SECURITY_REPORT_AT"),
+		SecurityReportAdmins: envList("SECURITY_REPORT_ADMINS"),
+		Admins:               envSet("ADMINS"),
+		Approvers:            envList("APPROVERS"),
+		FormatVariants:       envList("FORMAT_VARIANTS"),
+		SuspiciousAction:     os.Getenv("SUSPICIOUS_ACTION"),
+		InlineSecretAction:   os.Getenv("INLINE_SECRET_ACTION"),
+		ANSIMode:             os.Getenv("ANSI_MODE"),
+		DangerousAction:      os.Getenv("DANGEROUS_ACTION"),
+		WatchdogAction:       os.Getenv("WATCHDOG_ACTION"),
+		Shellcheck:           os.Getenv("SHELLCHECK_PATH"),
+		Honeytokens:          envList("HONEYTOKENS"),
+		InspectPaths:         envList("INSPECT_PATHS"),
+		SecurityWebhookURL:   getenv("SECURITY_WEBHOOK_URL"),
+		SecurityChannel:      os.Getenv("SECURITY_CHANNEL"),
+		OpsChannel:           os.Getenv("OPS_CHANNEL"),
+		AgentToken:           getenv("AGENT_TOKEN"),
+		AgentsListenAddr:     os.Getenv("AGENTS_LISTEN_ADDR"),
+		AgentsTLSCert:        os.Getenv("AGENTS_TLS_CERT"),
+		AgentsTLSKey:         os.Getenv("AGENTS_TLS_KEY"),
+		AgentsClientCA:       os.Getenv("AGENTS_CLIENT_CA"),
+		Docker:               os.Getenv("DOCKER_PATH"),
+		SandboxImage:         os.Getenv("SANDBOX_IMAGE"),
+		SandboxNetwork:       os.Getenv("SANDBOX_NETWORK"),
+		AuditAnchorURL:       getenv("AUDIT_ANCHOR_URL"),
+		AuditSyslog:          os.Getenv("AUDIT_SYSLOG"),
+		ExportBucketURL:      os.Getenv("EXPORT_BUCKET_URL"),
+		ExportPrefix:         os.Getenv("EXPORT_PREFIX"),
+		OutputArchive:        os.Getenv("OUTPUT_ARCHIVE"),
+		OutputArchivePrefix:  os.Getenv("OUTPUT_ARCHIVE_PREFIX"),
+		GCSAccessKeyID:       getenv("GCS_ACCESS_KEY_ID"),
+		GCSSecretAccessKey:   getenv("GCS_SECRET_ACCESS_KEY"),
+		S3Region:             os.Getenv("AWS_REGION"),
+		S3AccessKeyID:        getenv("AWS_ACCESS_KEY_ID"),
+		S3SecretAccessKey:    getenv("AWS_SECRET_ACCESS_KEY"),
+		S3SessionToken:       getenv("AWS_SESSION_TOKEN"),
+		Paths: endpointPaths{
+			Webhook:       os.Getenv("WEBHOOK_PATH"),
+			Interactivity: os.Getenv("INTERACTIVITY_PATH"),
+			Events:        os.Getenv("EVENTS_PATH"),
+			Admin:         strings.TrimSuffix(os.Getenv("ADMIN_PATH"), "/"),
+			Agents:        os.Getenv("AGENTS_PATH"),
+		},
+	}
+	if cfg.Port == "" {
+		cfg.Port = "8080"
+	}
+	if cfg.SlackAPIURL == "" {
+		cfg.SlackAPIURL = "https://slack.com/api/"
+	}
+	if cfg.S3Region == "" {
+		cfg.S3Region = "us-east-1"
+	}
+
+	switch cfg.SuspiciousAction {
+	case "":
+		cfg.SuspiciousAction = suspiciousAlert
+	case suspiciousAlert, suspiciousBlock:
+	default:
+		return cfg, fmt.Errorf("invalid SUSPICIOUS_ACTION %q", cfg.SuspiciousAction)
+	}
+
+	switch cfg.InlineSecretAction {
+	case "":
+		cfg.InlineSecretAction = inlineSecretWarn
+	case inlineSecretWarn, inlineSecretBlock, inlineSecretOff:
+	default:
+		return cfg, fmt.Errorf("invalid INLINE_SECRET_ACTION %q", cfg.InlineSecretAction)
+	}
+
+	if cfg.AuditSyslog != "" {
+		if _, _, err := parseSyslogTarget(cfg.AuditSyslog); err != nil {
+			return cfg, fmt.Errorf("invalid AUDIT_SYSLOG: %w", err)
+		}
+	}
+
+	switch cfg.DangerousAction {
+	case "":
+		cfg.DangerousAction = dangerousConfirm
+	case dangerousConfirm, dangerousBlock:
+	default:
+		return cfg, fmt.Errorf("invalid DANGEROUS_ACTION %q", cfg.DangerousAction)
+	}
+	switch cfg.WatchdogAction {
+	case "":
+		cfg.WatchdogAction = watchdogAsk
+	case watchdogAsk, watchdogKill:
+	default:
+		return cfg, fmt.Errorf("invalid WATCHDOG_ACTION %q", cfg.WatchdogAction)
+	}
+
+	switch cfg.ANSIMode {
+	case "":
+		cfg.ANSIMode = ansiStrip
+	case ansiStrip, ansiTranslate:
+	default:
+		return cfg, fmt.Errorf("invalid ANSI_MODE %q", cfg.ANSIMode)
+	}
+
+	for name, path := range map[string]string{
+		"WEBHOOK_PATH":       cfg.Paths.Webhook,
+		"INTERACTIVITY_PATH": cfg.Paths.Interactivity,
+		"EVENTS_PATH":        cfg.Paths.Events,
+		"ADMIN_PATH":         cfg.Paths.Admin,
+		"AGENTS_PATH":        cfg.Paths.Agents,
+	} {
+		if path != "" && path != randomPath && !strings.HasPrefix(path, "/") {
+			return cfg, fmt.Errorf("invalid %s %q: must start with / or be %q", name, path, randomPath)
+		}
+	}
+
+	if len(cfg.FormatVariants) > 2 {
+		return cfg, fmt.Errorf("invalid FORMAT_VARIANTS: at most two variants")
+	}
+	for _, name := range cfg.FormatVariants {
+		if formatters[name] == nil {
+			return cfg, fmt.Errorf("invalid FORMAT_VARIANTS: unknown formatter %q", name)
+		}
+	}
+
+	if cfg.DailySummaryAt != "" {
+		if _, err := parseClock(cfg.DailySummaryAt); err != nil {
+			return cfg, fmt.Errorf("invalid DAILY_SUMMARY_AT: %w", err)
+		}
+		if cfg.DataDir == "" || cfg.SlackToken == "" {
+			return cfg, fmt.Errorf("DAILY_SUMMARY_AT requires DATA_DIR and SLACK_TOKEN")
+		}
+	}
+	if cfg.SecurityReportAt != "" {
+		if _, _, err := parseWeekClock(cfg.SecurityReportAt); err != nil {
+			return cfg, fmt.Errorf("invalid SECURITY_REPORT_AT: %w", err)
+		}
+		if cfg.DataDir == "" || cfg.SlackToken == "" || len(cfg.SecurityReportAdmins) == 0 {
+			return cfg, fmt.Errorf("SECURITY_REPORT_AT requires DATA_DIR, SLACK_TOKEN and SECURITY_REPORT_ADMINS")
+		}
+	}
+
+	var err error
+	if cfg.APITokens, err = envAPITokens("API_TOKENS"); err != nil {
+		return cfg, err
+	}
+	if cfg.ApprovalPatterns, err = envPatterns("APPROVAL_PATTERNS"); err != nil {
+		return cfg, err
+	}
+	if path := os.Getenv("CLASSIFIER_FILE"); path != "" {
+		if cfg.ClassifierRules, err = loadClassifierRules(path); err != nil {
+			return cfg, fmt.Errorf("loading classifier rules: %w", err)
+		}
+	}
+	if path := os.Getenv("SECURITY_REPORT_TEMPLATE"); path != "" {
+		if cfg.SecurityReportTemplate, err = loadSecurityReportTemplate(path); err != nil {
+			return cfg, fmt.Errorf("loading security report template: %w", err)
+		}
+	}
+	if path := os.Getenv("TEMPLATES_FILE"); path != "" {
+		if cfg.Templates, err = loadTemplates(path); err != nil {
+			return cfg, fmt.Errorf("loading templates: %w", err)
+		}
+	}
+	dangerPatterns, err := envPatterns("DANGER_PATTERNS")
+	if err != nil {
+		return cfg, err
+	}
+	cfg.ClassifierRules = append(cfg.ClassifierRules, dangerRules(dangerPatterns)...)
+	if cfg.ApprovalTTL, err = envDuration("APPROVAL_TTL", 15*time.Minute); err != nil {
+		return cfg, err
+	}
+	if cfg.SignatureMaxAge, err = envDuration("SIGNATURE_MAX_AGE", 5*time.Minute); err != nil {
+		return cfg, err
+	}
+	if cfg.SignatureClockSkew, err = envDuration("SIGNATURE_CLOCK_SKEW", 30*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.Sessions, err = envBool("SESSIONS_ENABLED"); err != nil {
+		return cfg, err
+	}
+	if cfg.Lint, err = envBool("LINT_ENABLED"); err != nil {
+		return cfg, err
+	}
+	if cfg.Onboarding, err = envBool("ONBOARDING_ENABLED"); err != nil {
+		return cfg, err
+	}
+	if cfg.Queue, err = envBool("QUEUE_ENABLED"); err != nil {
+		return cfg, err
+	}
+	if cfg.Queue && cfg.DataDir == "" {
+		return cfg, fmt.Errorf("QUEUE_ENABLED requires DATA_DIR")
+	}
+	if cfg.OpsChannel != "" && cfg.SlackToken == "" {
+		return cfg, fmt.Errorf("OPS_CHANNEL requires SLACK_TOKEN")
+	}
+	if cfg.Onboarding && (cfg.DataDir == "" || cfg.SlackToken == "") {
+		return cfg, fmt.Errorf("ONBOARDING_ENABLED requires DATA_DIR and SLACK_TOKEN")
+	}
+	if path := os.Getenv("ONBOARDING_FILE"); path != "" {
+		if cfg.OnboardingTour, err = loadTour(path); err != nil {
+			return cfg, fmt.Errorf("loading onboarding tour: %w", err)
+		}
+	}
+	if cfg.Interactivity, err = envBool("INTERACTIVITY_ENABLED"); err != nil {
+		return cfg, err
+	}
+	// Clicks and events act as the user named in their payload, so they
+	// must be signed by Slack. SLACK_TOKEN serves the events endpoint.
+	if cfg.Interactivity && cfg.SigningSecret == "" {
+		return cfg, fmt.Errorf("INTERACTIVITY_ENABLED requires SLACK_SIGNING_SECRET")
+	}
+	if cfg.SlackToken != "" && cfg.SigningSecret == "" {
+		return cfg, fmt.Errorf("SLACK_TOKEN requires SLACK_SIGNING_SECRET, to verify the events endpoint")
+	}
+	cfg.TemplateSuggestionsAt = os.Getenv("TEMPLATE_SUGGESTIONS_AT")
+	if cfg.TemplateSuggestionsAt != "" {
+		if _, _, err := parseWeekClock(cfg.TemplateSuggestionsAt); err != nil {
+			return cfg, fmt.Errorf("invalid TEMPLATE_SUGGESTIONS_AT: %w", err)
+		}
+		if cfg.DataDir == "" || cfg.SlackToken == "" || len(cfg.Admins) == 0 || !cfg.Interactivity {
+			return cfg, fmt.Errorf("TEMPLATE_SUGGESTIONS_AT requires DATA_DIR, SLACK_TOKEN, ADMINS and INTERACTIVITY_ENABLED")
+		}
+	}
+	if cfg.PTY, err = envBool("PTY_ENABLED"); err != nil {
+		return cfg, err
+	}
+	if cfg.LeakResponse, err = envBool("LEAK_RESPONSE_ENABLED"); err != nil {
+		return cfg, err
+	}
+	if cfg.AuditAnchorInterval, err = envDuration("AUDIT_ANCHOR_INTERVAL", time.Hour); err != nil {
+		return cfg, err
+	}
+	if cfg.AuditAnchorURL != "" && (cfg.DataDir == "" || cfg.AuditAnchorInterval <= 0) {
+		return cfg, fmt.Errorf("AUDIT_ANCHOR_URL requires DATA_DIR and a positive AUDIT_ANCHOR_INTERVAL")
+	}
+	if cfg.OutputRetention, err = envDuration("OUTPUT_RETENTION", 0); err != nil {
+		return cfg, err
+	}
+	switch cfg.Store {
+	case "", storeSQLite, storeFiles:
+		if cfg.Store != "" && cfg.DatabaseURL != "" {
+			return cfg, fmt.Errorf("DATABASE_URL cannot be used with STORE=%s", cfg.Store)
+		}
+	case storePostgres:
+		if cfg.DatabaseURL == "" {
+			return cfg, fmt.Errorf("STORE=postgres requires DATABASE_URL")
+		}
+	default:
+		return cfg, fmt.Errorf("STORE must be sqlite, files or postgres, got %q", cfg.Store)
+	}
+	if cfg.OutputArchive != "" && cfg.DataDir == "" {
+		return cfg, fmt.Errorf("OUTPUT_ARCHIVE requires DATA_DIR")
+	}
+	if cfg.ExportInterval, err = envDuration("EXPORT_INTERVAL", time.Hour); err != nil {
+		return cfg, err
+	}
+	if cfg.ExportBucketURL != "" {
+		if _, err := newS3Client(cfg.ExportBucketURL, cfg.S3Region, "", "", "", nil); err != nil {
+			return cfg, fmt.Errorf("invalid EXPORT_BUCKET_URL: %w", err)
+		}
+		if cfg.ExportInterval <= 0 || cfg.S3AccessKeyID == "" || cfg.S3SecretAccessKey == "" {
+			return cfg, fmt.Errorf("EXPORT_BUCKET_URL requires a positive EXPORT_INTERVAL, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+		}
+	}
+	if cfg.MaxFileSize, err = envInt64("MAX_FILE_SIZE", 10<<20); err != nil {
+		return cfg, err
+	}
+	if cfg.UploadQuotaBytes, err = envInt64("UPLOAD_QUOTA_BYTES", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.MessageQuota, err = envInt64("MESSAGE_QUOTA", 0); err != nil {
+		return cfg, err
+	}
+	maxMessageChars, err := envInt64("MAX_MESSAGE_CHARS", 4000)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.MaxMessageChars = int(maxMessageChars)
+	if cfg.PolicyFailOpen, err = envBool("POLICY_FAIL_OPEN"); err != nil {
+		return cfg, err
+	}
+	if cfg.PluginTimeout, err = envDuration("PLUGIN_TIMEOUT", 5*time.Second); err != nil {
+		return cfg, err
+	}
+	pluginMemoryLimitMB, err := envInt64("PLUGIN_MEMORY_LIMIT_MB", 64)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.PluginMemoryLimitMB = int(pluginMemoryLimitMB)
+	if cfg.AccessLogSampling, err = envRates("ACCESS_LOG_SAMPLING"); err != nil {
+		return cfg, err
+	}
+	if cfg.FormatSplit, err = envFloat("FORMAT_SPLIT", 0.5); err != nil {
+		return cfg, err
+	}
+	if cfg.CommandTimeout, err = envDuration("COMMAND_TIMEOUT", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.HeartbeatInterval, err = envDuration("HEARTBEAT_INTERVAL", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.WatchdogIdle, err = envDuration("WATCHDOG_IDLE", 0); err != nil {
+		return cfg, err
+	}
+	if cfg.SessionIdleTimeout, err = envDuration("SESSION_IDLE_TIMEOUT", 15*time.Minute); err != nil {
+		return cfg, err
+	}
+	if cfg.SessionCommandTimeout, err = envDuration("SESSION_COMMAND_TIMEOUT", 30*time.Second); err != nil {
+		return cfg, err
+	}
+
+	if path := os.Getenv("PROFILES_FILE"); path != "" {
+		profiles, err := loadProfiles(path)
+		if err != nil {
+			return cfg, fmt.Errorf("loading profiles: %w", err)
+		}
+		cfg.Profiles = profiles
+	}
+	if path := os.Getenv("INVENTORY_FILE"); path != "" {
+		if cfg.Inventory, err = loadInventory(path); err != nil {
+			return cfg, fmt.Errorf("loading inventory: %w", err)
+		}
+	}
+	if memory, cpu := os.Getenv("COMMAND_MEMORY_MAX"), os.Getenv("COMMAND_CPU_MAX"); memory != "" || cpu != "" {
+		var maxBytes int64
+		var cpus float64
+		if memory != "" {
+			if maxBytes, err = parseSize(memory); err != nil || maxBytes <= 0 {
+				return cfg, fmt.Errorf("invalid COMMAND_MEMORY_MAX %q", memory)
+			}
+		}
+		if cpu != "" {
+			if cpus, err = strconv.ParseFloat(cpu, 64); err != nil || cpus <= 0 {
+				return cfg, fmt.Errorf("invalid COMMAND_CPU_MAX %q", cpu)
+			}
+		}
+		parent := os.Getenv("CGROUP_PARENT")
+		if parent == "" {
+			return cfg, fmt.Errorf("COMMAND_MEMORY_MAX and COMMAND_CPU_MAX require CGROUP_PARENT")
+		}
+		if cfg.Limits, err = newCommandLimits(parent, maxBytes, cpus); err != nil {
+			return cfg, fmt.Errorf("CGROUP_PARENT: %w", err)
+		}
+	}
+	if cfg.Env, err = loadEnvPolicy(); err != nil {
+		return cfg, err
+	}
+	if cpu, size, files := os.Getenv("COMMAND_CPU_TIME"), os.Getenv("COMMAND_FILE_SIZE_MAX"), os.Getenv("COMMAND_OPEN_FILES_MAX"); cpu != "" || size != "" || files != "" {
+		if !rlimitsSupported {
+			return cfg, fmt.Errorf("COMMAND_CPU_TIME, COMMAND_FILE_SIZE_MAX and COMMAND_OPEN_FILES_MAX are not supported on this system")
+		}
+		r := &rlimits{}
+		if cpu != "" {
+			d, err := time.ParseDuration(cpu)
+			if err != nil || d < time.Second {
+				return cfg, fmt.Errorf("invalid COMMAND_CPU_TIME %q: must be at least 1s", cpu)
+			}
+			r.CPU = uint64((d + time.Second - 1) / time.Second)
+		}
+		if size != "" {
+			n, err := parseSize(size)
+			if err != nil || n <= 0 {
+				return cfg, fmt.Errorf("invalid COMMAND_FILE_SIZE_MAX %q", size)
+			}
+			r.FileSize = uint64(n)
+		}
+		if files != "" {
+			// The shell and the helper setting the limits need a few
+			// descriptors of their own.
+			n, err := strconv.ParseUint(files, 10, 64)
+			if err != nil || n < 8 {
+				return cfg, fmt.Errorf("invalid COMMAND_OPEN_FILES_MAX %q: must be at least 8", files)
+			}
+			r.OpenFiles = n
+		}
+		cfg.Rlimits = r
+	}
+	if cfg.SandboxImage != "" && !validImage(cfg.SandboxImage) {
+		return cfg, fmt.Errorf("invalid SANDBOX_IMAGE %q", cfg.SandboxImage)
+	}
+	if cfg.SandboxNetwork != "" && (cfg.SandboxImage == "" || !containerNamePattern.MatchString(cfg.SandboxNetwork)) {
+		return cfg, fmt.Errorf("SANDBOX_NETWORK requires SANDBOX_IMAGE and must name a Docker network")
+	}
+	if cfg.AgentsListenAddr != "" && (cfg.AgentsTLSCert == "" || cfg.AgentsTLSKey == "" || cfg.AgentsClientCA == "") {
+		return cfg, fmt.Errorf("AGENTS_LISTEN_ADDR requires AGENTS_TLS_CERT, AGENTS_TLS_KEY and AGENTS_CLIENT_CA")
+	}
+	if cfg.AgentsListenAddr != "" && cfg.AgentToken != "" {
+		return cfg, fmt.Errorf("AGENT_TOKEN cannot be used with AGENTS_LISTEN_ADDR")
+	}
+	for _, p := range cfg.Profiles {
+		if p.Agent != "" && cfg.AgentToken == "" && cfg.AgentsListenAddr == "" {
+			return cfg, fmt.Errorf("profile %q: agent requires AGENT_TOKEN or AGENTS_LISTEN_ADDR", p.Name)
+		}
+		for pattern := range p.Hosts {
+			group, ok := strings.CutPrefix(pattern, "@")
+			if !ok {
+				continue
+			}
+			if cfg.Inventory == nil {
+				return cfg, fmt.Errorf("profile %q: hosts %s requires INVENTORY_FILE", p.Name, pattern)
+			}
+			if _, ok := cfg.Inventory.Groups[group]; !ok {
+				return cfg, fmt.Errorf("profile %q: hosts %s: no such group in the inventory", p.Name, pattern)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// envList splits a comma-separated environment variable into its trimmed,
+// non-empty values.
+func envList(name string) []string {
+	var values []string
+	for _, v := range strings.Split(getenv(name), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// envSet is like envList but returns the values as a set.
+func envSet(name string) map[string]bool {
+	set := make(map[string]bool)
+	for _, v := range envList(name) {
+		set[v] = true
+	}
+	return set
+}
+
+// envBool parses a boolean environment variable, treating unset as false.
+func envBool(name string) (bool, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return b, nil
+}
+
+// envDuration parses a duration environment variable such as "30s",
+// returning def when unset.
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return d, nil
+}
+
+// envInt64 parses an integer environment variable, returning def when unset.
+func envInt64(name string, def int64) (int64, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return n, nil
+}
+
+// envFloat parses a fraction between 0 and 1, returning def when unset.
+func envFloat(name string, def float64) (float64, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 || f > 1 {
+		return 0, fmt.Errorf("invalid %s %q: must be between 0 and 1", name, v)
+	}
+	return f, nil
+}
+
+// envRates parses a comma-separated list of name=rate pairs such as
+// "metrics=0.1,webhook=1". Rates must be between 0 and 1.
+func envRates(name string) (map[string]float64, error) {
+	rates := make(map[string]float64)
+	for _, pair := range envList(name) {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid %s: %q is not name=rate", name, pair)
+		}
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid %s: rate for %q must be between 0 and 1", name, key)
+		}
+		rates[strings.TrimSpace(key)] = rate
+	}
+	return rates, nil
+}
+
+// envFileKeys records the variables set by the last loadEnvFile call and
+// their values before it, so that variables removed from the file are
+// restored on reload.
+var envFileKeys = map[string]*string{}
+
+// loadEnvFile sets environment variables from a file of KEY=value lines.
+// Values from the file take precedence over the process environment.
+func loadEnvFile(path string) error {
+	values, err := readEnvFile(path)
+	if err != nil {
+		return err
+	}
+
+	for key, old := range envFileKeys {
+		if _, ok := values[key]; ok {
+			continue
+		}
+		if old == nil {
+			os.Unsetenv(key)
+		} else {
+			os.Setenv(key, *old)
+		}
+		delete(envFileKeys, key)
+	}
+	for key, value := range values {
+		if _, ok := envFileKeys[key]; !ok {
+			var old *string
+			if v, ok := os.LookupEnv(key); ok {
+				old = &v
+			}
+			envFileKeys[key] = old
+		}
+		os.Setenv(key, value)
+	}
+	return nil
+}
+
+// readEnvFile reads a file of KEY=value lines. Blank lines and lines
+// starting with # are ignored.
+func readEnvFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=value", path, i+1)
+		}
+		values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return values, nil
+}
+
+// envAPITokens parses a comma-separated list of "<user-id>:<token>" pairs
+// into a map from token to user ID.
+func envAPITokens(name string) (map[string]string, error) {
+	tokens := make(map[string]string)
+	for _, pair := range envList(name) {
+		userID, token, ok := strings.Cut(pair, ":")
+		if !ok || userID == "" || token == "" {
+			return nil, fmt.Errorf("invalid %s: %q is not <user-id>:<token>", name, pair)
+		}
+		tokens[token] = userID
+	}
+	return tokens, nil
+}
+
+// envPatterns compiles a comma-separated list of regular expressions.
+func envPatterns(name string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, p := range envList(name) {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// callbackConfirm identifies the confirmation modal.
+const callbackConfirm = "confirm_command"
+
+// confirmTTL is how long a confirmation modal can be left open.
+const confirmTTL = 10 * time.Minute
+
+// requestConfirmation opens a modal asking the user to confirm a dangerous
+// command. Opening a modal needs the slash command's trigger_id, a Slack
+// token and interactivity; without them the command is refused.
+func (s *server) requestConfirmation(ctx context.Context, cmd slashCommand, command, reason string) map[string]string {
+	refused := failure(codeConfirmationRequired, formatDenied("requires confirmation", reason))
+	if !s.cfg.Interactivity || s.slack == nil || cmd.TriggerID == "" {
+		return refused
+	}
+
+	cmd.Reviewed = &reviewedCommand{Command: command, Env: s.channelEnv(cmd)}
+	c := s.confirmations.add(cmd, command, reason)
+	view, err := json.Marshal(block{
+		"type":             "modal",
+		"callback_id":      callbackConfirm,
+		"private_metadata": c.ID,
+		"title":            plainText("Confirm command"),
+		"submit":           plainText("Run"),
+		"close":            plainText("Cancel"),
+		"blocks": []block{
+			sectionBlock(fmt.Sprintf("Are you sure you want to run %s?", quoteCode(s.displayText(cmd)))),
+		},
+	})
+	if err != nil {
+		return refused
+	}
+
+	params := url.Values{"trigger_id": {cmd.TriggerID}, "view": {string(view)}}
+	if err := s.slack.call(ctx, "views.open", params, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening confirmation: %v\n", err)
+		return refused
+	}
+	return ephemeral("_waiting for confirmation_")
+}
+
+// quoteCode formats text as inline code, or as a code block if it spans
+// several lines.
+func quoteCode(text string) string {
+	if strings.Contains(text, "\n") {
+		return "```" + text + "```"
+	}
+	return "`" + text + "`"
+}
+
+// confirmCommand runs a command whose confirmation modal was submitted by
+// the user who ran it. The result is posted to the command's response_url
+// or, for commands taken from a message, in the message's thread.
+func (s *server) confirmCommand(userID, id string) {
+	c, err := s.confirmations.take(id, userID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error confirming command: %v\n", err)
+		if c != nil && c.Cmd.ResponseURL != "" {
+			postWebhook(context.Background(), s.client, c.Cmd.ResponseURL, ephemeral(fmt.Sprintf("_cannot run: %v_", err)))
+		}
+		return
+	}
+
+	cmd := c.Cmd
+	cmd.Confirmed = true
+	go func() {
+		ctx := context.Background()
+		if cmd.FromMessage {
+			s.postInThread(ctx, cmd, s.handleCommandExecution(ctx, cmd))
+			return
+		}
+		message := s.respond(ctx, cmd)
+		if cmd.ResponseURL == "" {
+			return
+		}
+		if err := postWebhook(ctx, s.client, cmd.ResponseURL, message); err != nil {
+			fmt.Fprintf(os.Stderr, "Error posting confirmed command result: %v\n", err)
+		}
+	}()
+}
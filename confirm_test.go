@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// submitView posts a view_submission payload for a modal.
+func submitView(t *testing.T, s *server, userID, callbackID, metadata string) {
+	t.Helper()
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"type": "view_submission",
+		"user": map[string]string{"id": userID},
+		"view": map[string]string{"callback_id": callbackID, "private_metadata": metadata},
+	})
+	body := url.Values{"payload": {string(payload)}}.Encode()
+	req := httptest.NewRequest("POST", "/slack/interactive", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.routes().ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestConfirmation_OpensModalAndRunsOnSubmit(t *testing.T) {
+	f := newFakeSlack(t)
+	ts, messages := messageRecorder(t)
+	cfg := f.config()
+	cfg.Interactivity = true
+	cfg.ClassifierRules = dangerRules([]*regexp.Regexp{regexp.MustCompile(`^echo danger`)})
+	s := newServer(cfg)
+
+	cmd := slashCommand{Text: "$ echo danger", UserID: "U1", ResponseURL: ts.URL, TriggerID: "T123"}
+	if response := s.handleCommandExecution(context.Background(), cmd); response["text"] != "_waiting for confirmation_" {
+		t.Fatalf("Expected command to wait for confirmation, got %q", response["text"])
+	}
+
+	calls := f.callsTo("views.open")
+	if len(calls) != 1 || calls[0].Params.Get("trigger_id") != "T123" {
+		t.Fatalf("Expected views.open with the trigger_id, got %v", calls)
+	}
+	var view struct {
+		CallbackID      string  `json:"callback_id"`
+		PrivateMetadata string  `json:"private_metadata"`
+		Blocks          []block `json:"blocks"`
+	}
+	if err := json.Unmarshal([]byte(calls[0].Params.Get("view")), &view); err != nil {
+		t.Fatalf("Failed to decode view: %v", err)
+	}
+	if text := view.Blocks[0]["text"].(map[string]interface{})["text"]; text != "Are you sure you want to run `$ echo danger`?" {
+		t.Errorf("Unexpected modal text %q", text)
+	}
+
+	submitView(t, s, "U2", view.CallbackID, view.PrivateMetadata)
+	submitView(t, s, "U1", view.CallbackID, view.PrivateMetadata)
+
+	if m := nextResult(t, messages); !strings.Contains(m["text"].(string), "danger\n") {
+		t.Errorf("Expected command output, got %v", m)
+	}
+}
+
+func TestConfirmation_RefusedWithoutTrigger(t *testing.T) {
+	s := newServer(config{ClassifierRules: dangerRules([]*regexp.Regexp{regexp.MustCompile(`rm -rf`)})})
+
+	response := s.handleCommandExecution(context.Background(), slashCommand{Text: "$ rm -rf /data"})
+	if response["text"] != "_requires confirmation: matches rm -rf_ `CONFIRMATION_REQUIRED`" {
+		t.Errorf("Expected refusal, got %q", response["text"])
+	}
+}
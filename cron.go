@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed five-field cron expression. Each field is a
+// bit set of the values it matches.
+type cronSchedule struct {
+	Minute, Hour, Dom, Month, Dow uint64
+
+	fields [5]string // as written, for descriptions
+}
+
+// cronField describes the range and names of one cron field.
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // names[i] is value min+i
+}
+
+var cronFields = [5]cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// cronMacros are the @ shorthands understood in place of five fields.
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseCron parses a cron expression such as "*/5 2 * * mon-fri".
+func parseCron(expr string) (cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return cronSchedule{}, fmt.Errorf("expected 5 fields (minute hour day-of-month month day-of-week), got %d", len(fields))
+	}
+
+	var sched cronSchedule
+	sets := [5]*uint64{&sched.Minute, &sched.Hour, &sched.Dom, &sched.Month, &sched.Dow}
+	for i, f := range fields {
+		set, err := cronFields[i].parse(f)
+		if err != nil {
+			return cronSchedule{}, fmt.Errorf("%s field %q: %w", cronFields[i].name, f, err)
+		}
+		*sets[i] = set
+		sched.fields[i] = f
+	}
+	// Sunday is both 0 and 7.
+	if sched.Dow&(1<<7) != 0 {
+		sched.Dow = sched.Dow&^(1<<7) | 1
+	}
+	return sched, nil
+}
+
+func (f cronField) parse(s string) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(s, ",") {
+		rng, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step < 1 {
+				return 0, fmt.Errorf("bad step %q", stepText)
+			}
+		}
+
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			from, to, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(from); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = f.value(to); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				hi = f.max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("range %q is backwards", rng)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%q is not between %d and %d", s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// matches reports whether the schedule fires at t's minute.
+func (c cronSchedule) matches(t time.Time) bool {
+	return c.Minute&(1<<t.Minute()) != 0 && c.Hour&(1<<t.Hour()) != 0 && c.Month&(1<<t.Month()) != 0 && c.dayMatches(t)
+}
+
+// dayMatches reports whether t's day is one the schedule runs on. As in
+// cron, if both day fields are restricted, a day matching either will do.
+func (c cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := c.Dom&(1<<t.Day()) != 0
+	dowMatch := c.Dow&(1<<t.Weekday()) != 0
+	if c.fields[2] != "*" && c.fields[4] != "*" {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+// next returns the first time after t the schedule fires, or the zero
+// time if it does not within five years, as for "0 0 31 2 *".
+func (c cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		switch {
+		case c.Month&(1<<t.Month()) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.Hour&(1<<t.Hour()) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case c.Minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// describe explains the schedule in English, e.g. "every 5 minutes past
+// hour 2".
+func (c cronSchedule) describe() string {
+	minute, hour := c.fields[0], c.fields[1]
+	var when string
+	if isNumber(minute) && isNumber(hour) {
+		m, _ := strconv.Atoi(minute)
+		h, _ := strconv.Atoi(hour)
+		when = fmt.Sprintf("at %02d:%02d", h, m)
+	} else {
+		when = describeCronField(minute, "minute", cronFields[0])
+		if hour != "*" {
+			when += " past " + describeCronField(hour, "hour", cronFields[1])
+		}
+	}
+
+	var days []string
+	if c.fields[2] != "*" {
+		days = append(days, "on "+describeCronField(c.fields[2], "day-of-month", cronFields[2]))
+	}
+	if c.fields[4] != "*" {
+		days = append(days, "on "+describeCronField(c.fields[4], "day-of-week", cronFields[4]))
+	}
+	if len(days) > 0 {
+		when += " " + strings.Join(days, " or ")
+	}
+	if c.fields[3] != "*" {
+		when += " in " + describeCronField(c.fields[3], "month", cronFields[3])
+	}
+	return strings.ToUpper(when[:1]) + when[1:]
+}
+
+// describeCronField explains one field, e.g. "every 5 minutes" or
+// "minutes 0 and 30".
+func describeCronField(s, unit string, f cronField) string {
+	if s == "*" {
+		return "every " + unit
+	}
+	if rest, ok := strings.CutPrefix(s, "*/"); ok {
+		return "every " + rest + " " + unit + "s"
+	}
+	parts := strings.Split(s, ",")
+	for i, part := range parts {
+		rng, step, hasStep := strings.Cut(part, "/")
+		from, to, isRange := strings.Cut(rng, "-")
+		text := f.display(from)
+		if isRange {
+			text += " through " + f.display(to)
+		}
+		if hasStep {
+			text = "every " + step + " " + unit + "s from " + text
+		}
+		parts[i] = text
+	}
+	if len(parts) == 1 && (f.names == nil || unit == "hour") {
+		return unit + " " + parts[0]
+	}
+	if f.names == nil {
+		return unit + "s " + joinAnd(parts)
+	}
+	return joinAnd(parts)
+}
+
+// display shows a named field's value by name, e.g. "Mon" for 1.
+func (f cronField) display(s string) string {
+	v, err := f.value(s)
+	if err != nil || f.names == nil {
+		return s
+	}
+	name := f.names[(v-f.min)%len(f.names)]
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+func joinAnd(parts []string) string {
+	if len(parts) < 2 {
+		return strings.Join(parts, "")
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// cronUsage is shown when the cron builtin is used incorrectly.
+const cronUsage = `usage: cron explain "<minute> <hour> <day-of-month> <month> <day-of-week>"`
+
+func runCron(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	if len(args) < 2 || args[0] != "explain" {
+		return commandResult{Lines: []string{cronUsage}, ExitCode: 2, Duration: time.Since(startTime)}
+	}
+
+	expr := strings.Trim(strings.Join(args[1:], " "), `"'`)
+	sched, err := parseCron(expr)
+	if err != nil {
+		return commandResult{Lines: []string{err.Error()}, ExitCode: 1, Duration: time.Since(startTime)}
+	}
+
+	lines := []string{sched.describe() + ".", "", "Next runs (" + time.Local.String() + "):"}
+	t := time.Now()
+	for i := 0; i < 5; i++ {
+		if t = sched.next(t); t.IsZero() {
+			lines = append(lines, "  never")
+			break
+		}
+		lines = append(lines, "  "+formatClock(t))
+	}
+	return commandResult{Lines: lines, Duration: time.Since(startTime)}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCronDescribe(t *testing.T) {
+	for expr, want := range map[string]string{
+		"*/5 2 * * *":      "Every 5 minutes past hour 2",
+		"30 9 * * mon-fri": "At 09:30 on Mon through Fri",
+		"0,30 * 1 * *":     "Minutes 0 and 30 on day-of-month 1",
+		"@daily":           "At 00:00",
+		"15 3 * jan,jul *": "At 03:15 in Jan and Jul",
+	} {
+		sched, err := parseCron(expr)
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+		if got := sched.describe(); got != want {
+			t.Errorf("%s: expected %q, got %q", expr, want, got)
+		}
+	}
+}
+
+func TestCronInvalid(t *testing.T) {
+	for _, expr := range []string{"* * * *", "60 * * * *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "* * * foo *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("%s: expected an error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	start := time.Date(2026, 10, 16, 23, 58, 0, 0, time.UTC) // a Friday
+	for expr, want := range map[string]time.Time{
+		"*/5 2 * * *":  time.Date(2026, 10, 17, 2, 0, 0, 0, time.UTC),
+		"30 9 * * 1-5": time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC),
+		"0 0 1 * 0":    time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC), // day of month or Sunday
+		"0 0 29 2 *":   time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+		"59 23 * * 7":  time.Date(2026, 10, 18, 23, 59, 0, 0, time.UTC),
+		"* * * * *":    time.Date(2026, 10, 16, 23, 59, 0, 0, time.UTC),
+	} {
+		sched, err := parseCron(expr)
+		if err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+		got := sched.next(start)
+		if !got.Equal(want) {
+			t.Errorf("%s: expected %s, got %s", expr, want, got)
+		}
+		if !sched.matches(got) {
+			t.Errorf("%s: next run %s does not match", expr, got)
+		}
+	}
+
+	sched, _ := parseCron("0 0 31 2 *")
+	if got := sched.next(start); !got.IsZero() {
+		t.Errorf("Expected no run on February 31, got %s", got)
+	}
+}
+
+func TestRunCron(t *testing.T) {
+	result := runCron(context.Background(), nil, slashCommand{}, []string{"explain", `"*/5`, "2", "*", "*", `*"`})
+	out := strings.Join(result.Lines, "\n")
+	if result.ExitCode != 0 || !strings.HasPrefix(out, "Every 5 minutes past hour 2.") || strings.Count(out, "02:") != 5 {
+		t.Errorf("Expected the schedule explained with 5 runs, got %q", out)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const redeliverUsage = "usage: redeliver [<id>]"
+
+// errDeadLetterNotFound is returned for dead letter IDs that are not kept.
+var errDeadLetterNotFound = errors.New("no such dead letter")
+
+// deadLetter is a result that could not be posted to Slack by any route,
+// kept so it can be delivered once Slack or the token works again.
+type deadLetter struct {
+	ID          string            `json:"id"`
+	TeamID      string            `json:"team_id,omitempty"`
+	ChannelID   string            `json:"channel_id,omitempty"`
+	UserID      string            `json:"user_id,omitempty"`
+	ThreadTS    string            `json:"thread_ts,omitempty"`
+	ResponseURL string            `json:"response_url,omitempty"`
+	Text        string            `json:"text"` // the command, as typed
+	Message     map[string]string `json:"message"`
+	Error       string            `json:"error"`
+	Failed      time.Time         `json:"failed"`
+	Attempts    int               `json:"attempts"`
+}
+
+// command returns the slash command whose result the letter holds, with
+// what is needed to post it.
+func (d deadLetter) command() slashCommand {
+	return slashCommand{
+		Text:        d.Text,
+		TeamID:      d.TeamID,
+		ChannelID:   d.ChannelID,
+		UserID:      d.UserID,
+		ThreadTS:    d.ThreadTS,
+		ResponseURL: d.ResponseURL,
+	}
+}
+
+// deadLetterStore keeps dead letters in a JSON file in the data directory.
+// The file is rewritten on every change.
+type deadLetterStore struct {
+	path string
+
+	mu      sync.Mutex
+	letters []deadLetter
+}
+
+func newDeadLetterStore(dir string) (*deadLetterStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	st := &deadLetterStore{path: filepath.Join(dir, "deadletters.json")}
+	data, err := os.ReadFile(st.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &st.letters); err != nil {
+		return nil, fmt.Errorf("%s: %w", st.path, err)
+	}
+	return st, nil
+}
+
+// add keeps a new dead letter.
+func (st *deadLetterStore) add(d deadLetter) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	letters := append(append([]deadLetter(nil), st.letters...), d)
+	if err := writeJSONFile(st.path, letters); err != nil {
+		return err
+	}
+	st.letters = letters
+	return nil
+}
+
+// get returns a dead letter.
+func (st *deadLetterStore) get(id string) (deadLetter, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, d := range st.letters {
+		if d.ID == id {
+			return d, true
+		}
+	}
+	return deadLetter{}, false
+}
+
+// update replaces a dead letter with d, which has the same ID, or removes
+// it if remove is set.
+func (st *deadLetterStore) update(d deadLetter, remove bool) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var letters []deadLetter
+	found := false
+	for _, e := range st.letters {
+		if e.ID != d.ID {
+			letters = append(letters, e)
+			continue
+		}
+		found = true
+		if !remove {
+			letters = append(letters, d)
+		}
+	}
+	if !found {
+		return errDeadLetterNotFound
+	}
+	if err := writeJSONFile(st.path, letters); err != nil {
+		return err
+	}
+	st.letters = letters
+	return nil
+}
+
+// list returns the dead letters of a user, or all of them for "", oldest
+// first.
+func (st *deadLetterStore) list(userID string) []deadLetter {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var letters []deadLetter
+	for _, d := range st.letters {
+		if userID == "" || d.UserID == userID {
+			letters = append(letters, d)
+		}
+	}
+	return letters
+}
+
+// deadLetter keeps a result that could not be posted, if there is a data
+// directory to keep it in, and records the failure in the audit log.
+func (s *server) deadLetter(cmd slashCommand, message map[string]string, err error) {
+	fmt.Fprintf(os.Stderr, "Error delivering result of %q: %v\n", s.displayText(cmd), err)
+	if s.deadLetters == nil {
+		return
+	}
+	d := deadLetter{
+		ID:          randomToken()[:8],
+		TeamID:      cmd.TeamID,
+		ChannelID:   cmd.ChannelID,
+		UserID:      cmd.UserID,
+		ThreadTS:    cmd.ThreadTS,
+		ResponseURL: cmd.ResponseURL,
+		Text:        s.displayText(cmd),
+		Message:     message,
+		Error:       err.Error(),
+		Failed:      time.Now(),
+		Attempts:    1,
+	}
+	if err := s.deadLetters.add(d); err != nil {
+		fmt.Fprintf(os.Stderr, "Error keeping undelivered result: %v\n", err)
+		return
+	}
+	s.auditLog.record(auditEvent{
+		Action:    "delivery_failed",
+		UserID:    cmd.UserID,
+		ChannelID: cmd.ChannelID,
+		TeamID:    cmd.TeamID,
+		Command:   redactLine(s.displayText(cmd)),
+		Detail:    fmt.Sprintf("dead letter %s: %v", d.ID, err),
+	})
+}
+
+// redeliver posts a dead letter again, and forgets it once it is posted.
+// by is who asked, for the audit log.
+func (s *server) redeliver(ctx context.Context, d deadLetter, by string) error {
+	err := s.sendLater(ctx, d.command(), d.Message)
+	if err != nil {
+		d.Attempts++
+		d.Error = err.Error()
+		if err := s.deadLetters.update(d, false); err != nil {
+			fmt.Fprintf(os.Stderr, "Error updating dead letter %s: %v\n", d.ID, err)
+		}
+		return err
+	}
+	if err := s.deadLetters.update(d, true); err != nil {
+		fmt.Fprintf(os.Stderr, "Error removing dead letter %s: %v\n", d.ID, err)
+	}
+	s.auditLog.record(auditEvent{
+		Action:    "redelivered",
+		UserID:    by,
+		ChannelID: d.ChannelID,
+		TeamID:    d.TeamID,
+		Detail:    fmt.Sprintf("dead letter %s of %s, after %d attempts", d.ID, d.UserID, d.Attempts),
+	})
+	return nil
+}
+
+// runRedeliver is the redeliver builtin. Without arguments it lists the
+// results that could not be delivered: the user's own, or all of them for
+// admins. $ redeliver <id> posts one to where it was meant to go.
+func runRedeliver(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	fail := func(code int, msg string) commandResult {
+		return commandResult{Lines: []string{msg}, ExitCode: code, Duration: time.Since(startTime)}
+	}
+	admin := s.cfg.Admins[cmd.UserID]
+
+	switch len(args) {
+	case 0:
+		owner := cmd.UserID
+		if admin {
+			owner = ""
+		}
+		letters := s.deadLetters.list(owner)
+		if len(letters) == 0 {
+			return commandResult{Lines: []string{"no undelivered results"}, Duration: time.Since(startTime)}
+		}
+		var lines []string
+		for _, d := range letters {
+			lines = append(lines, fmt.Sprintf("%s  %s  <@%s> in <#%s>  %s  (%d attempts: %s)",
+				d.ID, d.Failed.Local().Format("2006-01-02 15:04"), d.UserID, d.ChannelID, redactLine(d.Text), d.Attempts, d.Error))
+		}
+		return commandResult{Lines: lines, Duration: time.Since(startTime)}
+	case 1:
+	default:
+		return fail(2, redeliverUsage)
+	}
+
+	d, ok := s.deadLetters.get(args[0])
+	if !ok || d.UserID != cmd.UserID && !admin {
+		// Other users' results are reported like missing ones.
+		return fail(1, "no undelivered result "+args[0])
+	}
+	if err := s.redeliver(ctx, d, cmd.UserID); err != nil {
+		return fail(1, fmt.Sprintf("redelivering %s failed again: %v", d.ID, err))
+	}
+	return commandResult{Lines: []string{fmt.Sprintf("delivered the result of %s to <#%s>", redactLine(d.Text), d.ChannelID)}, Duration: time.Since(startTime)}
+}
+
+// handleDeadLetters serves the dead letters to admins as JSON at
+// ADMIN_PATH/deadletters, and redelivers one on POST to
+// ADMIN_PATH/deadletters/<id>.
+func (s *server) handleDeadLetters(w http.ResponseWriter, r *http.Request) {
+	v, err := s.apiViewer(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if !v.Admin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path[strings.LastIndex(r.URL.Path, "/deadletters")+len("/deadletters"):], "/")
+	if id == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		letters := s.deadLetters.list("")
+		if letters == nil {
+			letters = []deadLetter{}
+		}
+		writeJSON(w, letters)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	d, ok := s.deadLetters.get(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if err := s.redeliver(r.Context(), d, v.UserID); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(map[string]interface{}{"delivered": false, "error": err.Error()})
+		return
+	}
+	writeJSON(w, map[string]interface{}{"delivered": true})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDeadLetter_Redeliver(t *testing.T) {
+	f := newFakeSlack(t)
+	cfg := f.config()
+	cfg.DataDir = t.TempDir()
+	cfg.Admins = map[string]bool{"UADMIN": true}
+	s := newServer(cfg)
+	ctx := context.Background()
+
+	f.respond("chat.postMessage", map[string]interface{}{"ok": false, "error": "token_revoked"})
+	cmd := slashCommand{Text: "$ echo hello", UserID: "U1", ChannelID: "C1", ThreadTS: "1.1"}
+	s.postInThread(ctx, cmd, map[string]string{"response_type": "in_channel", "text": "hello"})
+
+	letters := s.deadLetters.list("")
+	if len(letters) != 1 || letters[0].Message["text"] != "hello" || !strings.Contains(letters[0].Error, "token_revoked") {
+		t.Fatalf("Expected the result kept as a dead letter, got %+v", letters)
+	}
+	id := letters[0].ID
+	data := auditLogText(t, cfg.DataDir)
+	if !strings.Contains(data, `"action":"delivery_failed"`) {
+		t.Errorf("Expected the failure audited, got %s", data)
+	}
+
+	// Dead letters survive a restart.
+	s = newServer(cfg)
+	if got := s.handleCommandExecution(ctx, slashCommand{Text: "$ redeliver", UserID: "U1", ChannelID: "C2"})["text"]; !strings.Contains(got, id) || !strings.Contains(got, "token_revoked") {
+		t.Errorf("Expected the dead letter listed, got %q", got)
+	}
+	if got := s.handleCommandExecution(ctx, slashCommand{Text: "$ redeliver", UserID: "U2", ChannelID: "C2"})["text"]; !strings.Contains(got, "no undelivered results") {
+		t.Errorf("Expected other users' dead letters hidden, got %q", got)
+	}
+	if got := s.handleCommandExecution(ctx, slashCommand{Text: "$ redeliver " + id, UserID: "U2", ChannelID: "C2"})["text"]; !strings.Contains(got, "no undelivered result "+id) {
+		t.Errorf("Expected other users not to redeliver it, got %q", got)
+	}
+
+	if got := s.handleCommandExecution(ctx, slashCommand{Text: "$ redeliver " + id, UserID: "U1", ChannelID: "C2"})["text"]; !strings.Contains(got, "failed again") {
+		t.Errorf("Expected redelivery to fail while Slack does, got %q", got)
+	}
+	if d, ok := s.deadLetters.get(id); !ok || d.Attempts != 2 {
+		t.Errorf("Expected the dead letter kept with 2 attempts, got %+v", d)
+	}
+
+	f.respond("chat.postMessage", nil)
+	if got := s.handleCommandExecution(ctx, slashCommand{Text: "$ redeliver " + id, UserID: "UADMIN", ChannelID: "C2"})["text"]; !strings.Contains(got, "delivered the result of $ echo hello to <#C1>") {
+		t.Errorf("Expected the result delivered, got %q", got)
+	}
+	posts := f.callsTo("chat.postMessage")
+	last := posts[len(posts)-1].Params
+	if last.Get("channel") != "C1" || last.Get("thread_ts") != "1.1" || last.Get("text") != "hello" {
+		t.Errorf("Expected the result posted in its thread, got %v", last)
+	}
+	if len(s.deadLetters.list("")) != 0 {
+		t.Error("Expected the dead letter removed once delivered")
+	}
+}
+
+func TestPostLater_DeadLetterAfterFallback(t *testing.T) {
+	f := newFakeSlack(t)
+	f.mux.HandleFunc("/response", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	f.respond("chat.postMessage", map[string]interface{}{"ok": false, "error": "channel_not_found"})
+	cfg := f.config()
+	cfg.DataDir = t.TempDir()
+	s := newServer(cfg)
+
+	cmd := slashCommand{Text: "$ sleep 60", UserID: "U1", ChannelID: "C1", ResponseURL: f.URL + "/response"}
+	s.postLater(context.Background(), cmd, map[string]string{"response_type": "in_channel", "text": "done"})
+
+	if calls := f.callsTo("chat.postMessage"); len(calls) != 1 {
+		t.Errorf("Expected the channel tried after the response_url, got %d calls", len(calls))
+	}
+	letters := s.deadLetters.list("U1")
+	if len(letters) != 1 || letters[0].ResponseURL != cmd.ResponseURL || !strings.Contains(letters[0].Error, "channel_not_found") {
+		t.Errorf("Expected a dead letter with the last error, got %+v", letters)
+	}
+}
+
+func TestHandleDeadLetters(t *testing.T) {
+	f := newFakeSlack(t)
+	cfg := f.config()
+	cfg.DataDir = t.TempDir()
+	cfg.Admins = map[string]bool{"UADMIN": true}
+	cfg.APITokens = map[string]string{"admin-token": "UADMIN", "user-token": "U1"}
+	s := newServer(cfg)
+	d := deadLetter{ID: "dl1", UserID: "U1", ChannelID: "C1", Text: "$ uptime", Message: map[string]string{"response_type": "in_channel", "text": "up 3 days"}}
+	if err := s.deadLetters.add(d); err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.routes().ServeHTTP(w, req)
+		return w
+	}
+
+	if w := request("GET", "/debug/deadletters", "user-token"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected non-admins refused, got %d", w.Code)
+	}
+	w := request("GET", "/debug/deadletters", "admin-token")
+	var letters []deadLetter
+	if err := json.Unmarshal(w.Body.Bytes(), &letters); err != nil || len(letters) != 1 || letters[0].ID != "dl1" {
+		t.Errorf("Expected the dead letters listed, got %d %s", w.Code, w.Body)
+	}
+
+	if w := request("POST", "/debug/deadletters/missing", "admin-token"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown dead letter, got %d", w.Code)
+	}
+	if w := request("POST", "/debug/deadletters/dl1", "admin-token"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"delivered":true`) {
+		t.Errorf("Expected the dead letter delivered, got %d %s", w.Code, w.Body)
+	}
+	if calls := f.callsTo("chat.postMessage"); len(calls) != 1 || calls[0].Params.Get("text") != "up 3 days" {
+		t.Errorf("Expected the result posted, got %v", calls)
+	}
+	if _, ok := s.deadLetters.get("dl1"); ok {
+		t.Error("Expected the dead letter removed")
+	}
+}
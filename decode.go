@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The decode and url builtins answer common quick questions in Go, without
+// starting a shell.
+
+func runDecode(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	fail := func(msg string) commandResult {
+		return commandResult{Lines: []string{msg}, ExitCode: 2, Duration: time.Since(startTime)}
+	}
+	if len(args) < 2 {
+		return fail("usage: decode base64|jwt|json <data>")
+	}
+
+	var lines []string
+	var binary []byte
+	var err error
+	switch args[0] {
+	case "base64":
+		var data []byte
+		// Whitespace is not part of base64, so a blob split over several
+		// words is joined back together.
+		if data, err = decodeBase64(strings.Join(args[1:], "")); err == nil {
+			if isBinary(data) {
+				binary = data
+			} else {
+				lines = cleanOutput(string(data))
+			}
+		}
+	case "jwt":
+		lines, err = decodeJWT(strings.Join(args[1:], ""))
+	case "json":
+		lines, err = indentJSON([]byte(strings.Join(args[1:], " ")))
+	default:
+		return fail(fmt.Sprintf("decode: unknown format %q (base64, jwt or json)", args[0]))
+	}
+	if err != nil {
+		return commandResult{Lines: []string{"decode " + args[0] + ": " + err.Error()}, ExitCode: 1, Duration: time.Since(startTime)}
+	}
+	return commandResult{Lines: lines, Binary: binary, Duration: time.Since(startTime)}
+}
+
+func runURL(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	if len(args) < 2 || (args[0] != "decode" && args[0] != "encode") {
+		return commandResult{Lines: []string{"usage: url decode|encode <text>"}, ExitCode: 2, Duration: time.Since(startTime)}
+	}
+
+	text := strings.Join(args[1:], " ")
+	// Slack turns pasted URLs into links such as <https://x?a=1&amp;b=2>.
+	if link, ok := strings.CutPrefix(text, "<"); ok && strings.HasSuffix(link, ">") {
+		link, _, _ = strings.Cut(strings.TrimSuffix(link, ">"), "|")
+		text = slackUnescape.Replace(link)
+	}
+	if args[0] == "encode" {
+		return commandResult{Lines: []string{url.QueryEscape(text)}, Duration: time.Since(startTime)}
+	}
+
+	decoded, err := url.QueryUnescape(text)
+	if err != nil {
+		return commandResult{Lines: []string{"url decode: " + err.Error()}, ExitCode: 1, Duration: time.Since(startTime)}
+	}
+	lines := []string{decoded}
+	// A full URL is more readable with its query one parameter per line.
+	if u, err := url.Parse(text); err == nil && u.Scheme != "" && u.RawQuery != "" {
+		if query, err := url.ParseQuery(u.RawQuery); err == nil {
+			keys := make([]string, 0, len(query))
+			for key := range query {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			lines = append(lines, "")
+			for _, key := range keys {
+				for _, v := range query[key] {
+					lines = append(lines, key+" = "+v)
+				}
+			}
+		}
+	}
+	return commandResult{Lines: lines, Duration: time.Since(startTime)}
+}
+
+// decodeBase64 accepts standard and URL-safe base64, with or without
+// padding.
+func decodeBase64(s string) ([]byte, error) {
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if data, err := enc.DecodeString(s); err == nil {
+			return data, nil
+		}
+	}
+	return nil, errors.New("not valid base64")
+}
+
+// decodeJWT shows the header and claims of a JSON Web Token. The
+// signature is neither shown nor verified, and the output says so.
+func decodeJWT(token string) ([]string, error) {
+	parts := strings.Split(strings.TrimPrefix(token, "Bearer"), ".")
+	if len(parts) != 3 {
+		return nil, errors.New("a JWT has three dot-separated parts")
+	}
+
+	var lines []string
+	for i, name := range []string{"header", "claims"} {
+		data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[i], "="))
+		if err != nil {
+			return nil, fmt.Errorf("%s: not valid base64url", name)
+		}
+		pretty, err := indentJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		lines = append(lines, name+":")
+		lines = append(lines, pretty...)
+	}
+
+	var claims map[string]interface{}
+	data, _ := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if json.Unmarshal(data, &claims) == nil {
+		for _, name := range []string{"iat", "nbf", "exp"} {
+			if v, ok := claims[name].(float64); ok {
+				t := time.Unix(int64(v), 0).UTC()
+				note := ""
+				if name == "exp" && t.Before(time.Now()) {
+					note = " (expired)"
+				}
+				lines = append(lines, fmt.Sprintf("%s: %s%s", name, t.Format(time.RFC3339), note))
+			}
+		}
+	}
+	return append(lines, "signature: not shown, not verified"), nil
+}
+
+// indentJSON pretty-prints a JSON document.
+func indentJSON(data []byte) ([]string, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, bytes.TrimSpace(data), "", "  "); err != nil {
+		return nil, fmt.Errorf("not valid JSON: %w", err)
+	}
+	return strings.Split(buf.String(), "\n"), nil
+}
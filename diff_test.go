@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	a := strings.Split("a b c d e f g h i j k l m", " ")
+	b := strings.Split("a b X d e f g h i j k l m Y", " ")
+
+	lines, added, removed := unifiedDiff(diffLines(a, b))
+	want := []string{
+		"@@ -1,6 +1,6 @@", " a", " b", "-c", "+X", " d", " e", " f",
+		"@@ -11,3 +11,4 @@", " k", " l", " m", "+Y",
+	}
+	if !reflect.DeepEqual(lines, want) || added != 2 || removed != 1 {
+		t.Errorf("unifiedDiff = %q (+%d -%d), want %q (+2 -1)", lines, added, removed, want)
+	}
+}
+
+func TestDiffLines_Reconstructs(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := func() []string {
+		lines := make([]string, rng.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return lines
+	}
+	for i := 0; i < 200; i++ {
+		a, b := random(), random()
+		var gotA, gotB []string
+		for _, op := range diffLines(a, b) {
+			if op.kind != '+' {
+				gotA = append(gotA, op.line)
+			}
+			if op.kind != '-' {
+				gotB = append(gotB, op.line)
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("Edit script for %q -> %q does not reconstruct the inputs", a, b)
+		}
+	}
+}
+
+func TestDiffJobs(t *testing.T) {
+	s := newServer(config{DataDir: t.TempDir(), SensitiveChannels: map[string]bool{"C2": true}})
+	ctx := context.Background()
+	s.handleCommandExecution(ctx, slashCommand{Text: "$ printf 'ok\\nsame\\n'", ChannelID: "C1"})
+	s.handleCommandExecution(ctx, slashCommand{Text: "$ printf 'failed\\nsame\\n'; exit 1", ChannelID: "C1"})
+	s.handleCommandExecution(ctx, slashCommand{Text: "$ echo private", ChannelID: "C2"})
+	jobs, _ := s.store.since(time.Time{})
+
+	response := s.handleCommandExecution(ctx, slashCommand{Text: "$ diff-jobs " + jobs[0].ID + " " + jobs[1].ID, ChannelID: "C1"})
+	for _, want := range []string{"2 lines added, 2 removed (success → error)", "\n-ok\n+$ printf", "\n+failed\n same"} {
+		if !strings.Contains(response["text"], want) {
+			t.Errorf("Expected %q in the diff, got %q", want, response["text"])
+		}
+	}
+
+	response = s.handleCommandExecution(ctx, slashCommand{Text: "$ diff-jobs " + jobs[0].ID + " " + jobs[2].ID, ChannelID: "C1"})
+	if !strings.Contains(response["text"], "no job "+jobs[2].ID) {
+		t.Errorf("Expected private job to be refused, got %q", response["text"])
+	}
+}
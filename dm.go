@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// openDM opens, or finds, the direct message conversation with a user and
+// returns its channel ID.
+func (s *server) openDM(ctx context.Context, userID string) (string, error) {
+	var channel struct {
+		Channel struct {
+			ID string `json:"id"`
+		} `json:"channel"`
+	}
+	if err := s.slack.call(ctx, "conversations.open", url.Values{"users": {userID}}, &channel); err != nil {
+		return "", err
+	}
+	return channel.Channel.ID, nil
+}
+
+// wantsDM reports whether a command's output goes to the invoker's DM,
+// because of --dm or the channel's profile.
+func (s *server) wantsDM(cmd slashCommand, flags metaFlags) bool {
+	return flags.DM || s.cfg.profileFor(cmd.ChannelID).DM
+}
+
+// sendDM posts a reply in the invoker's DM and returns the note left in
+// the channel. If posting fails the reply is returned to the invoker
+// alone instead.
+func (s *server) sendDM(ctx context.Context, cmd slashCommand, message map[string]string) map[string]string {
+	params := url.Values{"channel": {cmd.DMChannel}, "text": {message["text"]}}
+	if err := s.slack.call(ctx, "chat.postMessage", params, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error sending output by DM: %v\n", err)
+		message["response_type"] = "ephemeral"
+		return message
+	}
+	return ephemeral("_output sent to you by DM_")
+}
+
+// uploadTarget returns where files belonging to a command's output are
+// shared: the invoker's DM or the channel given with --to if output goes
+// there, else the command's channel and thread.
+func (c slashCommand) uploadTarget() (channel, threadTS string) {
+	if c.DMChannel != "" {
+		return c.DMChannel, ""
+	}
+	if c.OutputChannel != "" {
+		return c.OutputChannel, ""
+	}
+	return c.ChannelID, c.ThreadTS
+}
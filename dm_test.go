@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHandleCommand_DMFlag(t *testing.T) {
+	f := newFakeSlack(t)
+	f.respond("conversations.open", map[string]interface{}{"channel": map[string]string{"id": "D1"}})
+	s := newServer(f.config())
+
+	data := url.Values{}
+	data.Set("text", "$ --dm echo hello")
+	data.Set("channel_id", "C1")
+	data.Set("user_id", "U1")
+
+	response := postCommand(t, s, data)
+
+	if response["response_type"] != "ephemeral" || !strings.Contains(response["text"], "sent to you by DM") {
+		t.Errorf("Expected a private note in the channel, got %v", response)
+	}
+	if calls := f.callsTo("conversations.open"); len(calls) != 1 || calls[0].Params.Get("users") != "U1" {
+		t.Fatalf("Expected the invoker's DM to be opened, got %v", calls)
+	}
+	calls := f.callsTo("chat.postMessage")
+	if len(calls) != 1 || calls[0].Params.Get("channel") != "D1" || !strings.Contains(calls[0].Params.Get("text"), "hello") {
+		t.Errorf("Expected output posted in the DM, got %v", calls)
+	}
+}
+
+func TestHandleCommand_DMProfile(t *testing.T) {
+	f := newFakeSlack(t)
+	f.respond("conversations.open", map[string]interface{}{"channel": map[string]string{"id": "D1"}})
+	cfg := f.config()
+	cfg.Profiles = []profile{{Name: "default"}, {Name: "ops", Channels: []string{"C1"}, DM: true}}
+	s := newServer(cfg)
+
+	data := url.Values{}
+	data.Set("text", "$ echo hello")
+	data.Set("channel_id", "C1")
+	data.Set("user_id", "U1")
+
+	postCommand(t, s, data)
+
+	if calls := f.callsTo("chat.postMessage"); len(calls) != 1 || calls[0].Params.Get("channel") != "D1" {
+		t.Errorf("Expected output posted in the DM, got %v", calls)
+	}
+}
+
+func TestHandleCommand_DMFallsBackToEphemeral(t *testing.T) {
+	f := newFakeSlack(t)
+	f.respond("conversations.open", map[string]interface{}{"channel": map[string]string{"id": "D1"}})
+	f.respond("chat.postMessage", map[string]interface{}{"ok": false, "error": "cannot_dm_bot"})
+	s := newServer(f.config())
+
+	data := url.Values{}
+	data.Set("text", "$ --dm echo hello")
+	data.Set("user_id", "U1")
+
+	response := postCommand(t, s, data)
+
+	if response["response_type"] != "ephemeral" || !strings.Contains(response["text"], "hello") {
+		t.Errorf("Expected the output shown only to the invoker, got %v", response)
+	}
+}
+
+func TestHandleCommand_DMNeedsToken(t *testing.T) {
+	s := newServer(config{})
+
+	data := url.Values{}
+	data.Set("text", "$ --dm echo hello")
+	data.Set("user_id", "U1")
+
+	response := postCommand(t, s, data)
+
+	if !strings.Contains(response["text"], "needs a Slack token") || strings.Contains(response["text"], "hello") {
+		t.Errorf("Expected the command refused, got %q", response["text"])
+	}
+}
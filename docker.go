@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// containerNamePattern is what Docker accepts as a container name.
+	containerNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	// imagePattern is a reference to an image, such as "alpine:3.20" or
+	// "registry.example.com/tools@sha256:...", that cannot pass for an
+	// option of docker run.
+	imagePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.:/@-]*$`)
+)
+
+func validImage(image string) bool {
+	return imagePattern.MatchString(image)
+}
+
+// dockerBackend runs commands in Docker containers on the server's host.
+// Builtins still run on the server, outside them, so it lacks capFiles.
+var dockerBackend = backend{Name: "docker", Caps: dockerCaps()}
+
+func dockerCaps() []capability {
+	caps := []capability{capStdin}
+	if ptySupported {
+		caps = append(caps, capPTY)
+	}
+	return caps
+}
+
+// dockerStopTimeout bounds how long stopping a canceled command's
+// processes in its container may take.
+const dockerStopTimeout = 10 * time.Second
+
+// dockerKillScript kills the processes of a container whose environment
+// holds the marker given as $1, which docker exec set for a command, so
+// that those it started go too.
+const dockerKillScript = `for d in /proc/[0-9]*; do tr '\0' '\n' <"$d/environ" 2>/dev/null | grep -qxF "$1" && kill -9 "${d#/proc/}"; done; exit 0`
+
+// dockerTarget is where a command runs in Docker: in a running container,
+// with docker exec, or in a new container of an image, removed afterwards.
+// Sandbox locks the new container down.
+type dockerTarget struct {
+	Container string
+	Image     string
+	Sandbox   bool
+}
+
+// sandboxWorkdir is the directory sandboxed commands start in.
+const sandboxWorkdir = "/work"
+
+// sandboxArgs are the options of docker run that lock a sandbox container
+// down: no network but the one given, a read-only root with writable
+// tmpfs mounts for /tmp and the working directory, no capabilities or
+// privilege escalation, and an unprivileged user.
+func sandboxArgs(network string) []string {
+	if network == "" {
+		network = "none"
+	}
+	return []string{
+		"--network", network,
+		"--read-only",
+		"--tmpfs", "/tmp:rw,nosuid,nodev,size=64m",
+		"--tmpfs", sandboxWorkdir + ":rw,exec,nosuid,nodev,size=64m",
+		"--workdir", sandboxWorkdir,
+		"--cap-drop", "ALL",
+		"--security-opt", "no-new-privileges",
+		"--user", "65534:65534",
+	}
+}
+
+// dockerFor returns the Docker target of a command's shell commands: the
+// container given with --container=, or else the channel profile's
+// container or image, or else, with SANDBOX_IMAGE, a sandbox unless the
+// profile names an agent. It returns nil if they do not run in Docker.
+func (s *server) dockerFor(cmd slashCommand) *dockerTarget {
+	if cmd.Container != "" {
+		return &dockerTarget{Container: cmd.Container}
+	}
+	if cmd.Host != "" {
+		return nil
+	}
+	p := s.cfg.profileFor(cmd.ChannelID)
+	if p.Container != "" || p.Image != "" {
+		return &dockerTarget{Container: p.Container, Image: p.Image}
+	}
+	if s.cfg.SandboxImage != "" && p.Agent == "" {
+		return &dockerTarget{Image: s.cfg.SandboxImage, Sandbox: true}
+	}
+	return nil
+}
+
+// checkContainer checks that a command may run in the container given
+// with --container=: it cannot be combined with @host, and the channel's
+// profile must list the container in Containers.
+func (s *server) checkContainer(cmd slashCommand, flags metaFlags) error {
+	if flags.Host != "" {
+		return withCode(codeBadRequest, errors.New("--container cannot be combined with @host or --host="))
+	}
+	if !containerNamePattern.MatchString(flags.Container) {
+		return withCode(codeBadRequest, fmt.Errorf("invalid container name %q", flags.Container))
+	}
+	for _, pattern := range s.cfg.profileFor(cmd.ChannelID).Containers {
+		if ok, _ := path.Match(pattern, flags.Container); ok {
+			return nil
+		}
+	}
+	reason := fmt.Sprintf("not allowed to run commands in container %s from this channel", flags.Container)
+	s.auditRefusal(cmd, auditPolicyDenied, reason)
+	return withCode(codePolicyDenied, errors.New(reason))
+}
+
+// runInDocker runs a shell command with sh in a container, with docker
+// exec, or in a new container of an image, with docker run. Output is
+// streamed and collected as for commands run on the server. Variables of
+// opts.Env are passed by name, so their values stay out of the docker
+// command line. Canceling ctx also kills the command in the container:
+// docker exec does not forward signals, so the command's processes are
+// marked with a variable to find them by, and a new container is removed.
+func (s *server) runInDocker(ctx context.Context, target dockerTarget, command string, opts runOptions) commandResult {
+	docker := s.cfg.Docker
+	if docker == "" {
+		docker = "docker"
+	}
+	token := randomToken()
+
+	argv := []string{docker}
+	if target.Image != "" {
+		argv = append(argv, "run", "--rm", "--name", "http-shell-"+token)
+		if target.Sandbox {
+			argv = append(argv, sandboxArgs(s.cfg.SandboxNetwork)...)
+		}
+		if s.cfg.Limits != nil {
+			argv = append(argv, s.cfg.Limits.dockerArgs()...)
+		}
+		if s.cfg.Rlimits != nil {
+			argv = append(argv, s.cfg.Rlimits.dockerArgs()...)
+		}
+	} else {
+		argv = append(argv, "exec", "-e", "HTTP_SHELL_JOB="+token)
+	}
+	if opts.Stdin != nil || opts.PTY {
+		argv = append(argv, "-i")
+	}
+	if opts.PTY {
+		argv = append(argv, "-t")
+	}
+	for _, kv := range opts.Env {
+		name, _, _ := strings.Cut(kv, "=")
+		argv = append(argv, "-e", name)
+	}
+	if target.Image != "" {
+		argv = append(argv, target.Image)
+	} else {
+		argv = append(argv, target.Container)
+	}
+	argv = append(argv, "sh", "-c", command)
+
+	stop := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), dockerStopTimeout)
+		defer cancel()
+		var err error
+		if target.Image != "" {
+			err = exec.CommandContext(ctx, docker, "rm", "-f", "http-shell-"+token).Run()
+		} else {
+			err = exec.CommandContext(ctx, docker, "exec", target.Container, "sh", "-c", dockerKillScript, "sh", "HTTP_SHELL_JOB="+token).Run()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error stopping a command in Docker: %v\n", err)
+		}
+	}
+	return runProgram(ctx, argv, stop, opts)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDocker writes a docker CLI that logs its arguments and runs the
+// command given after "sh" on the host, with the variables given with -e,
+// and returns its path and log.
+func fakeDocker(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	script := `#!/bin/sh
+printf '%s\n' "$*" >>` + log + `
+[ "$1" = rm ] && exit 0
+while [ "$1" != sh ]; do
+	case "$1" in -e) case "$2" in *=*) export "$2" ;; esac; shift ;; esac
+	shift
+done
+exec "$@"
+`
+	path := filepath.Join(dir, "docker")
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path, log
+}
+
+func dockerLog(t *testing.T, log string) string {
+	t.Helper()
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestHandleCommand_DockerProfile(t *testing.T) {
+	docker, log := fakeDocker(t)
+	tests := []struct {
+		profile profile
+		want    string
+	}{
+		{profile{Name: "default", Container: "app"}, "exec -e HTTP_SHELL_JOB="},
+		{profile{Name: "default", Image: "alpine:3.20"}, "run --rm --name http-shell-"},
+	}
+	for _, tt := range tests {
+		os.Remove(log)
+		s := newServer(config{Docker: docker, Profiles: []profile{tt.profile}})
+		data := url.Values{}
+		data.Set("text", "$ echo hello")
+		if response := postCommand(t, s, data); !strings.HasPrefix(response["text"], "```$ echo hello\nhello```") {
+			t.Errorf("%+v: expected the command's output, got %q", tt.profile, response["text"])
+		}
+		args := dockerLog(t, log)
+		if !strings.HasPrefix(args, tt.want) || !strings.HasSuffix(args, " sh -c echo hello\n") {
+			t.Errorf("%+v: expected docker %s... sh -c echo hello, got %q", tt.profile, tt.want, args)
+		}
+	}
+}
+
+func TestHandleCommand_DockerStdin(t *testing.T) {
+	docker, log := fakeDocker(t)
+	s := newServer(config{Docker: docker, Profiles: []profile{{Name: "default", Container: "app"}}})
+	data := url.Values{}
+	data.Set("text", "$ --stdin cat\n---\nfrom stdin")
+	if response := postCommand(t, s, data); !strings.Contains(response["text"], "from stdin") {
+		t.Errorf("Expected the input passed to the container, got %q", response["text"])
+	}
+	if args := dockerLog(t, log); !strings.Contains(args, " -i app sh -c cat") {
+		t.Errorf("Expected docker exec -i, got %q", args)
+	}
+}
+
+func TestHandleCommand_ContainerFlag(t *testing.T) {
+	docker, log := fakeDocker(t)
+	var targeted string
+	s := newServer(config{
+		Docker:     docker,
+		AgentToken: "agent-secret",
+		Profiles:   []profile{{Name: "default", Containers: []string{"app-*"}, Hosts: map[string][]string{"web*": {"*"}}}},
+		OPAURL: fakeOPA(t, func(in policyInput) interface{} {
+			targeted = in.TargetContainer
+			return "allow"
+		}).URL,
+	})
+	startAgent(t, s, "web01")
+
+	tests := []struct{ text, want string }{
+		{"$ --container=app-1 echo hello", "```$ --container=app-1 echo hello\nhello```"},
+		{"$ --container=db echo hello", "_not allowed to run commands in container db from this channel (POLICY_DENIED)_"},
+		{"$ --container=-v echo hello", "_invalid container name \"-v\" (BAD_REQUEST)_"},
+		{"$ @web01 --container=app-1 echo hello", "_--container cannot be combined with @host or --host= (BAD_REQUEST)_"},
+	}
+	for _, tt := range tests {
+		targeted = ""
+		data := url.Values{}
+		data.Set("text", tt.text)
+		if response := postCommand(t, s, data); !strings.HasPrefix(response["text"], tt.want) {
+			t.Errorf("%q: expected %q, got %q", tt.text, tt.want, response["text"])
+		} else if strings.HasPrefix(tt.want, "```") && targeted != "app-1" {
+			t.Errorf("%q: expected the policy to see the target container, got %q", tt.text, targeted)
+		}
+	}
+	if args := dockerLog(t, log); !strings.HasPrefix(args, "exec ") || !strings.Contains(args, " app-1 sh -c echo hello") {
+		t.Errorf("Expected docker exec in app-1, got %q", args)
+	}
+}
+
+func TestHandleCommand_DockerTimeout(t *testing.T) {
+	docker, log := fakeDocker(t)
+	tests := []struct {
+		profile profile
+		want    string
+	}{
+		{profile{Name: "default", Container: "app", maxDuration: 200 * time.Millisecond}, "exec app sh -c " + dockerKillScript + " sh HTTP_SHELL_JOB="},
+		{profile{Name: "default", Image: "alpine:3.20", maxDuration: 200 * time.Millisecond}, "rm -f http-shell-"},
+	}
+	for _, tt := range tests {
+		os.Remove(log)
+		s := newServer(config{Docker: docker, Profiles: []profile{tt.profile}})
+		data := url.Values{}
+		data.Set("text", "$ sleep 5")
+		postCommand(t, s, data)
+		if args := dockerLog(t, log); !strings.Contains(args, "\n"+tt.want) {
+			t.Errorf("%+v: expected the command stopped in Docker with %q, got %q", tt.profile, tt.want, args)
+		}
+	}
+}
+
+func TestLoadProfiles_Docker(t *testing.T) {
+	tests := []struct{ data, want string }{
+		{`[{"name": "x", "agent": "web01", "container": "app"}]`, "only one of agent, container and image"},
+		{`[{"name": "x", "container": "app", "image": "alpine"}]`, "only one of agent, container and image"},
+		{`[{"name": "x", "container": "--privileged"}]`, "invalid container name"},
+		{`[{"name": "x", "image": "-v/:/host"}]`, "invalid image"},
+		{`[{"name": "x", "containers": ["app["]}]`, "invalid containers pattern"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "profiles.json")
+		if err := os.WriteFile(path, []byte(tt.data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadProfiles(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error %q, got %v", tt.data, tt.want, err)
+		}
+	}
+}
+
+func TestHandleCommand_Sandbox(t *testing.T) {
+	docker, log := fakeDocker(t)
+	s := newServer(config{Docker: docker, SandboxImage: "alpine:3.20"})
+	data := url.Values{}
+	data.Set("text", "$ pwd")
+	if response := postCommand(t, s, data); !strings.HasPrefix(response["text"], "```$ pwd\n") {
+		t.Errorf("Expected the command's output, got %q", response["text"])
+	}
+	args := dockerLog(t, log)
+	for _, want := range []string{"run --rm --name http-shell-", " --network none --read-only ", " --workdir /work --cap-drop ALL ", " --user 65534:65534 alpine:3.20 sh -c pwd\n"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("Expected docker run with %q, got %q", want, args)
+		}
+	}
+
+	data.Set("text", "$ sha256 /etc/hostname")
+	if response := postCommand(t, s, data); !strings.Contains(response["text"], "which the docker backend does not support") {
+		t.Errorf("Expected builtins reading the server's files refused in the sandbox, got %q", response["text"])
+	}
+}
+
+func TestDockerFor_Sandbox(t *testing.T) {
+	s := newServer(config{
+		SandboxImage: "alpine:3.20",
+		Profiles: []profile{
+			{Name: "default"},
+			{Name: "agent", Channels: []string{"C1"}, Agent: "web01"},
+			{Name: "container", Channels: []string{"C2"}, Container: "app"},
+		},
+	})
+	tests := []struct {
+		cmd  slashCommand
+		want *dockerTarget
+	}{
+		{slashCommand{ChannelID: "C0"}, &dockerTarget{Image: "alpine:3.20", Sandbox: true}},
+		{slashCommand{ChannelID: "C1"}, nil},
+		{slashCommand{ChannelID: "C2"}, &dockerTarget{Container: "app"}},
+		{slashCommand{ChannelID: "C0", Host: "web01"}, nil},
+		{slashCommand{ChannelID: "C0", Container: "app-1"}, &dockerTarget{Container: "app-1"}},
+	}
+	for _, tt := range tests {
+		got := s.dockerFor(tt.cmd)
+		if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("dockerFor(%+v) = %+v, want %+v", tt.cmd, got, tt.want)
+		}
+	}
+}
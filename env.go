@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// defaultEnvAllow are the variables of the server's environment that
+// commands get unless COMMAND_ENV_ALLOW says otherwise: enough for the
+// shell and the usual tools to find programs, files and the locale.
+var defaultEnvAllow = []string{"PATH", "HOME", "USER", "LOGNAME", "SHELL", "LANG", "LC_*", "TZ", "TMPDIR"}
+
+// heldCredentials are the credentials hideCredentials took out of the
+// process's environment, where getenv still finds them.
+var heldCredentials = make(map[string]string)
+
+// getenv is os.Getenv, but also finds held credentials.
+func getenv(name string) string {
+	if v, ok := os.LookupEnv(name); ok {
+		return v
+	}
+	return heldCredentials[name]
+}
+
+// holdCredentials moves the credentials in the environment, whether the
+// process started with them or CONFIG_FILE set them, into heldCredentials,
+// so that nothing started with the environment gets them.
+func holdCredentials() {
+	for _, name := range credentialEnv {
+		if v, ok := os.LookupEnv(name); ok {
+			heldCredentials[name] = v
+			os.Unsetenv(name)
+		}
+	}
+}
+
+// envPolicy decides the environment commands start with, in place of the
+// server's: the allowed variables of the server's environment, then those
+// set for all commands. The zero policy allows defaultEnvAllow. The
+// server's own credentials, credentialEnv, are never allowed.
+type envPolicy struct {
+	// Allow lists the names of the variables passed on, where a trailing *
+	// matches any suffix, from COMMAND_ENV_ALLOW.
+	Allow []string
+
+	// Set are variables given to every command, from COMMAND_ENV_FILE,
+	// which take precedence over the server's.
+	Set map[string]string
+}
+
+// loadEnvPolicy reads the policy from COMMAND_ENV_ALLOW and
+// COMMAND_ENV_FILE.
+func loadEnvPolicy() (envPolicy, error) {
+	p := envPolicy{Allow: envList("COMMAND_ENV_ALLOW")}
+	for _, pattern := range p.Allow {
+		if name := strings.TrimSuffix(pattern, "*"); strings.ContainsAny(name, "*=") {
+			return p, fmt.Errorf("invalid COMMAND_ENV_ALLOW entry %q", pattern)
+		}
+	}
+	if path := os.Getenv("COMMAND_ENV_FILE"); path != "" {
+		set, err := readEnvFile(path)
+		if err != nil {
+			return p, fmt.Errorf("loading COMMAND_ENV_FILE: %w", err)
+		}
+		p.Set = set
+	}
+	return p, nil
+}
+
+func (p envPolicy) allowed(name string) bool {
+	if slices.Contains(credentialEnv, name) {
+		return false
+	}
+	allow := p.Allow
+	if allow == nil {
+		allow = defaultEnvAllow
+	}
+	for _, pattern := range allow {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); (ok && strings.HasPrefix(name, prefix)) || pattern == name {
+			return true
+		}
+	}
+	return false
+}
+
+// environ returns the environment commands start with, as "KEY=value"
+// entries, never nil so that it replaces the server's.
+func (p envPolicy) environ() []string {
+	env := []string{}
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); p.allowed(name) {
+			env = append(env, kv)
+		}
+	}
+	names := make([]string, 0, len(p.Set))
+	for name := range p.Set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, name+"="+p.Set[name])
+	}
+	return env
+}
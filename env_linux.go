@@ -0,0 +1,107 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// credentialsFDEnv names the descriptor a process started again by
+// hideCredentials reads its credentials from.
+const credentialsFDEnv = "HTTP_SHELL_CREDENTIALS_FD"
+
+// hideCredentials keeps the process's credentials from the commands it
+// starts. Unsetting them is not enough: the kernel keeps the environment
+// a process started with in /proc/<pid>/environ. A process started with
+// credentials therefore executes itself again, under the same PID, without
+// them, and reads them from a pipe instead. The process is also made
+// undumpable, so that processes of the same user cannot read its memory
+// or its /proc files. It is called before and after loading the
+// configuration, which may set credentials from CONFIG_FILE.
+func hideCredentials() error {
+	if fd, ok := os.LookupEnv(credentialsFDEnv); ok {
+		os.Unsetenv(credentialsFDEnv)
+		if err := readCredentials(fd); err != nil {
+			return err
+		}
+	}
+	holdCredentials()
+	if startedWithCredentials() {
+		if err := execWithoutCredentials(); err != nil {
+			return err
+		}
+	}
+	return unix.Prctl(unix.PR_SET_DUMPABLE, 0, 0, 0, 0)
+}
+
+// startedWithCredentials reports whether the environment the process
+// started with holds any credentials.
+func startedWithCredentials() bool {
+	environ, err := os.ReadFile("/proc/self/environ")
+	if err != nil {
+		return false
+	}
+	for _, kv := range bytes.Split(environ, []byte{0}) {
+		if name, _, _ := strings.Cut(string(kv), "="); slices.Contains(credentialEnv, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// execWithoutCredentials executes the process again with its environment
+// but for the credentials, which are written to a pipe it inherits. It
+// only returns on failure.
+func execWithoutCredentials() error {
+	data, err := json.Marshal(heldCredentials)
+	if err != nil {
+		return err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	// The credentials must fit in the pipe, since nothing reads them
+	// until the process has executed itself.
+	if len(data) > 64<<10 {
+		w.Close()
+		return fmt.Errorf("credentials too large to pass on: %d bytes", len(data))
+	}
+	_, err = w.Write(data)
+	w.Close()
+	if err != nil {
+		return err
+	}
+	if _, err := unix.FcntlInt(r.Fd(), unix.F_SETFD, 0); err != nil {
+		return err
+	}
+	env := append(os.Environ(), credentialsFDEnv+"="+strconv.Itoa(int(r.Fd())))
+	return syscall.Exec("/proc/self/exe", os.Args, env)
+}
+
+// readCredentials reads the credentials passed on by
+// execWithoutCredentials.
+func readCredentials(fd string) error {
+	n, err := strconv.Atoi(fd)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", credentialsFDEnv, fd)
+	}
+	f := os.NewFile(uintptr(n), "credentials")
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("reading credentials: %w", err)
+	}
+	return json.Unmarshal(data, &heldCredentials)
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+// hideCredentials keeps the process's credentials from the commands it
+// starts by taking them out of its environment. Other systems may still
+// show the environment the process started with to processes of the same
+// user.
+func hideCredentials() error {
+	holdCredentials()
+	return nil
+}
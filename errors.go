@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+)
+
+// errorCode is a stable name for a kind of failure. Codes are shown in
+// replies and logs and count in the errors metric, so users, alerts and
+// scripts using the HTTP API can tell failures apart without parsing
+// messages, which may change.
+type errorCode string
+
+const (
+	codeBadRequest           errorCode = "BAD_REQUEST"           // malformed command or meta-flags
+	codeUnsupported          errorCode = "UNSUPPORTED"           // needs something not available here
+	codePolicyDenied         errorCode = "POLICY_DENIED"         // refused by the policy
+	codeCommandBlocked       errorCode = "COMMAND_BLOCKED"       // blocked as dangerous or suspicious
+	codeHookRefused          errorCode = "HOOK_REFUSED"          // refused by a pre_exec hook
+	codeApprovalRequired     errorCode = "APPROVAL_REQUIRED"     // needs an approval that cannot be requested
+	codeConfirmationRequired errorCode = "CONFIRMATION_REQUIRED" // needs a confirmation that cannot be requested
+	codeTimeout              errorCode = "TIMEOUT"               // killed by the command timeout
+	codeLimitExceeded        errorCode = "LIMIT_EXCEEDED"        // killed by a resource limit
+	codeSlackRateLimited     errorCode = "SLACK_RATE_LIMITED"    // Slack answered 429
+	codeSlackError           errorCode = "SLACK_ERROR"           // any other failed Slack call
+	codeBackendUnreachable   errorCode = "BACKEND_UNREACHABLE"   // a service the server relies on did not answer
+)
+
+// errorCounts counts, by code, failed Slack calls and replies reporting a
+// failure, so a reply about a failed Slack call counts twice.
+var errorCounts = expvar.NewMap("errors")
+
+// codedError is an error with a code. Its message ends with the code, so
+// logs show it without callers having to.
+type codedError struct {
+	Code errorCode
+	Err  error
+}
+
+func (e *codedError) Error() string {
+	return fmt.Sprintf("%v (%s)", e.Err, e.Code)
+}
+
+func (e *codedError) Unwrap() error {
+	return e.Err
+}
+
+// withCode gives err a code.
+func withCode(code errorCode, err error) error {
+	return &codedError{Code: code, Err: err}
+}
+
+// errorCodeOf returns the code of the first coded error in err's chain,
+// or fallback if there is none.
+func errorCodeOf(err error, fallback errorCode) errorCode {
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+	return fallback
+}
+
+// failure is the reply to a command that did not run. The code is shown
+// after the message and returned as error_code for API clients.
+func failure(code errorCode, text string) map[string]string {
+	errorCounts.Add(string(code), 1)
+	reply := ephemeral(text + " `" + string(code) + "`")
+	reply["error_code"] = string(code)
+	return reply
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// eventDedupTTL is how long event IDs are remembered. Slack retries a
+// delivery up to three times within about an hour.
+const eventDedupTTL = time.Hour
+
+// eventEnvelope holds the fields of an Events API request used by the
+// server.
+type eventEnvelope struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	TeamID    string `json:"team_id"`
+	EventID   string `json:"event_id"`
+	Event     struct {
+		Type         string       `json:"type"`
+		Tab          string       `json:"tab"`
+		CallbackID   string       `json:"callback_id"`
+		WorkflowStep workflowStep `json:"workflow_step"`
+		User         string       `json:"user"`
+		BotID        string       `json:"bot_id"`
+		Text         string       `json:"text"`
+		Channel      string       `json:"channel"`
+		TS           string       `json:"ts"`
+		ThreadTS     string       `json:"thread_ts"`
+	} `json:"event"`
+}
+
+// leadingMention matches the bot mention that starts an app_mention text.
+var leadingMention = regexp.MustCompile(`^\s*<@[A-Z0-9]+(\|[^>]*)?>\s*`)
+
+// mentionCommand returns the command in the text of an app_mention event:
+// everything after the bot mention that starts it.
+func mentionCommand(text string) string {
+	return strings.TrimSpace(leadingMention.ReplaceAllString(text, ""))
+}
+
+// eventDedup remembers recently handled event IDs, so retried deliveries
+// are not run twice.
+type eventDedup struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]time.Time // event ID -> when it was first seen
+}
+
+func newEventDedup(ttl time.Duration) *eventDedup {
+	return &eventDedup{ttl: ttl, now: time.Now, seen: make(map[string]time.Time)}
+}
+
+// first records an event ID and reports whether it had not been seen
+// within the TTL.
+func (d *eventDedup) first(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	for seenID, at := range d.seen {
+		if now.Sub(at) > d.ttl {
+			delete(d.seen, seenID)
+		}
+	}
+	if _, ok := d.seen[id]; ok {
+		return false
+	}
+	d.seen[id] = now
+	return true
+}
+
+// handleEvent receives Events API requests. Mentions of the bot run the
+// rest of the message as a command, and the result is posted in a thread
+// under the mention. Opening the App Home shows the job dashboard, and
+// workflow steps run their command.
+func (s *server) handleEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.verifyRequest(w, r) {
+		return
+	}
+
+	var e eventEnvelope
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestBody)).Decode(&e); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	switch e.Type {
+	case "url_verification":
+		writeJSON(w, map[string]string{"challenge": e.Challenge})
+		return
+	case "event_callback":
+		// Slack expects an acknowledgement within three seconds, so
+		// events are handled after responding.
+		switch {
+		case e.Event.Type == "app_mention" && e.Event.BotID == "" && s.events.first(e.EventID):
+			go s.runMention(e)
+		case e.Event.Type == "app_home_opened" && e.Event.Tab == "home":
+			go s.openHome(context.Background(), e.Event.User)
+		case e.Event.Type == "workflow_step_execute" && e.Event.CallbackID == callbackWorkflowStep && s.events.first(e.EventID):
+			go s.executeWorkflowStep(context.Background(), e.Event.WorkflowStep, e.TeamID)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// runMention runs the command in an app_mention event and posts the
+// result in the mention's thread.
+func (s *server) runMention(e eventEnvelope) {
+	text := mentionCommand(e.Event.Text)
+	if text == "" {
+		return
+	}
+	thread := e.Event.ThreadTS
+	if thread == "" {
+		thread = e.Event.TS
+	}
+	cmd := slashCommand{
+		Text:      text,
+		UserID:    e.Event.User,
+		ChannelID: e.Event.Channel,
+		TeamID:    e.TeamID,
+		ThreadTS:  thread,
+		MessageTS: e.Event.TS,
+	}
+
+	ctx := context.Background()
+	s.postInThread(ctx, cmd, s.handleCommandExecution(ctx, cmd))
+}
+
+// postInThread posts the result of a command that has no response_url in
+// the command's thread, or to its user alone if it is not for the channel.
+// A result that cannot be posted is kept as a dead letter.
+func (s *server) postInThread(ctx context.Context, cmd slashCommand, message map[string]string) {
+	if err := s.sendInThread(ctx, cmd, message); err != nil {
+		s.deadLetter(cmd, message, err)
+	}
+}
+
+// sendInThread is postInThread without the dead letter.
+func (s *server) sendInThread(ctx context.Context, cmd slashCommand, message map[string]string) error {
+	method := "chat.postMessage"
+	params := url.Values{
+		"channel": {cmd.ChannelID},
+		"text":    {message["text"]},
+	}
+	if cmd.ThreadTS != "" {
+		params.Set("thread_ts", cmd.ThreadTS)
+	}
+	if message["response_type"] != "in_channel" {
+		method = "chat.postEphemeral"
+		params.Set("user", cmd.UserID)
+	} else if s.cfg.profileFor(cmd.ChannelID).ReplyBroadcast {
+		params.Set("reply_broadcast", "true")
+	}
+	return s.slack.call(ctx, method, params, nil)
+}
+
+// canPostLater reports whether the result of a command can be posted
+// after its request has been answered.
+func (s *server) canPostLater(cmd slashCommand) bool {
+	return cmd.ResponseURL != "" || (s.slack != nil && cmd.ChannelID != "")
+}
+
+// postLater posts the result of a command that outlived its request, to
+// its response_url or else in its channel or thread. A response_url
+// expires after 30 minutes, so the channel is also the fallback. A result
+// that cannot be posted either way is kept as a dead letter.
+func (s *server) postLater(ctx context.Context, cmd slashCommand, message map[string]string) {
+	if err := s.sendLater(ctx, cmd, message); err != nil {
+		s.deadLetter(cmd, message, err)
+	}
+}
+
+// sendLater is postLater without the dead letter.
+func (s *server) sendLater(ctx context.Context, cmd slashCommand, message map[string]string) error {
+	err := errors.New("no response_url or channel to post to")
+	if cmd.ResponseURL != "" {
+		if err = postWebhook(ctx, s.client, cmd.ResponseURL, message); err == nil {
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "Error posting result: %v\n", err)
+	}
+	if s.slack != nil && cmd.ChannelID != "" {
+		return s.sendInThread(ctx, cmd, message)
+	}
+	return err
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postEvent sends an Events API request and returns the response.
+func postEvent(t *testing.T, s *server, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest("POST", "/slack/events", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.routes().ServeHTTP(w, req)
+	return w
+}
+
+// waitForCalls waits until the fake has recorded n calls of a method.
+func waitForCalls(t *testing.T, f *fakeSlack, method string, n int) []fakeSlackCall {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		calls := f.callsTo(method)
+		if len(calls) >= n || time.Now().After(deadline) {
+			return calls
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEvents_URLVerification(t *testing.T) {
+	s := newServer(newFakeSlack(t).config())
+
+	w := postEvent(t, s, `{"type": "url_verification", "challenge": "abc123"}`)
+
+	var response map[string]string
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if w.Code != http.StatusOK || response["challenge"] != "abc123" {
+		t.Errorf("Expected challenge to be echoed, got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestEvents_AppMentionRunsCommandOnce(t *testing.T) {
+	f := newFakeSlack(t)
+	s := newServer(f.config())
+
+	mention := `{"type": "event_callback", "team_id": "T1", "event_id": "Ev1", "event": {
+		"type": "app_mention", "user": "U1", "channel": "C1", "ts": "1700000000.000100",
+		"text": "<@UBOT> echo hello"}}`
+	for i := 0; i < 2; i++ {
+		if w := postEvent(t, s, mention); w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+	}
+
+	calls := waitForCalls(t, f, "chat.postMessage", 1)
+	if len(calls) != 1 {
+		t.Fatalf("Expected one result, got %d", len(calls))
+	}
+	if p := calls[0].Params; p.Get("channel") != "C1" || p.Get("thread_ts") != "1700000000.000100" || !strings.Contains(p.Get("text"), "hello") {
+		t.Errorf("Expected output in the mention's thread, got %v", p)
+	}
+
+	// A retry of the same event must not run the command again.
+	time.Sleep(100 * time.Millisecond)
+	if calls := f.callsTo("chat.postMessage"); len(calls) != 1 {
+		t.Errorf("Expected retried event to be ignored, got %d results", len(calls))
+	}
+}
+
+func TestPostInThread_ReplyBroadcast(t *testing.T) {
+	f := newFakeSlack(t)
+	cfg := f.config()
+	cfg.Profiles = []profile{{Name: "default"}, {Name: "ops", Channels: []string{"C1"}, ReplyBroadcast: true}}
+	s := newServer(cfg)
+	ctx := context.Background()
+
+	s.postInThread(ctx, slashCommand{ChannelID: "C1", ThreadTS: "1.1"}, map[string]string{"response_type": "in_channel", "text": "done"})
+	s.postInThread(ctx, slashCommand{ChannelID: "C2", ThreadTS: "1.1"}, map[string]string{"response_type": "in_channel", "text": "done"})
+	s.postInThread(ctx, slashCommand{ChannelID: "C1", ThreadTS: "1.1", UserID: "U1"}, map[string]string{"text": "private"})
+
+	calls := f.callsTo("chat.postMessage")
+	if len(calls) != 2 {
+		t.Fatalf("Expected two thread replies, got %d", len(calls))
+	}
+	if got := calls[0].Params.Get("reply_broadcast"); got != "true" {
+		t.Errorf("Expected reply to be broadcast in a reply_broadcast channel, got %q", got)
+	}
+	if got := calls[1].Params.Get("reply_broadcast"); got != "" {
+		t.Errorf("Expected no broadcast elsewhere, got %q", got)
+	}
+	if eph := f.callsTo("chat.postEphemeral"); len(eph) != 1 || eph[0].Params.Get("reply_broadcast") != "" {
+		t.Errorf("Expected private result not to be broadcast, got %v", eph)
+	}
+}
+
+func TestEventDedup_Expires(t *testing.T) {
+	d := newEventDedup(time.Minute)
+	now := time.Now()
+	d.now = func() time.Time { return now }
+
+	if !d.first("Ev1") || d.first("Ev1") {
+		t.Fatal("Expected only the first delivery to be new")
+	}
+	now = now.Add(2 * time.Minute)
+	if !d.first("Ev1") {
+		t.Error("Expected event to be forgotten after the TTL")
+	}
+}
+
+func FuzzMentionCommand(f *testing.F) {
+	for _, seed := range []string{
+		"<@U0BOT> uptime",
+		"  <@U0BOT|shell>\n$ df -h",
+		"uptime <@U0BOT>",
+		"<@U0BOT",
+		"<@>",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		command := mentionCommand(text)
+		if command != strings.TrimSpace(command) {
+			t.Fatalf("Expected the command trimmed, got %q", command)
+		}
+		if !strings.Contains(text, command) {
+			t.Fatalf("Expected %q to come from %q", command, text)
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kinds of exported records, each batched into its own files.
+const (
+	exportAudit = "audit"
+	exportJobs  = "jobs"
+)
+
+// exportMaxPending bounds the records of one kind waiting to be uploaded
+// while the bucket is unreachable. Records beyond it are dropped from
+// the export, though not from the data directory.
+const exportMaxPending = 64 << 20
+
+// exportTimeout bounds each upload.
+const exportTimeout = time.Minute
+
+// recordExporter batches audit events and job results into newline
+// delimited JSON files uploaded to a bucket every rotation interval, for
+// retention beyond the server's own disk. Files are named
+// <prefix><kind>/YYYY/MM/DD/HHMMSS-<host>.jsonl after the time they were
+// uploaded. Records not yet uploaded are lost if the server stops.
+type recordExporter struct {
+	bucket   *s3Client
+	prefix   string
+	hostname string
+
+	mu      sync.Mutex
+	pending map[string]*bytes.Buffer // by kind
+}
+
+func newRecordExporter(bucket *s3Client, prefix string) *recordExporter {
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "http-shell"
+	}
+	return &recordExporter{bucket: bucket, prefix: prefix, hostname: hostname, pending: map[string]*bytes.Buffer{}}
+}
+
+// add queues a JSON record for the next upload.
+func (e *recordExporter) add(kind string, record []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	buf := e.pending[kind]
+	if buf == nil {
+		buf = new(bytes.Buffer)
+		e.pending[kind] = buf
+	}
+	if buf.Len()+len(record)+1 > exportMaxPending {
+		fmt.Fprintf(os.Stderr, "Error exporting %s record: too many records waiting\n", kind)
+		return
+	}
+	buf.Write(record)
+	buf.WriteByte('\n')
+}
+
+// flush uploads the records queued so far, one file per kind. Records
+// that fail to upload are kept for the next flush.
+func (e *recordExporter) flush(ctx context.Context, now time.Time) error {
+	e.mu.Lock()
+	batches := e.pending
+	e.pending = map[string]*bytes.Buffer{}
+	e.mu.Unlock()
+
+	kinds := make([]string, 0, len(batches))
+	for kind := range batches {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	var firstErr error
+	for _, kind := range kinds {
+		data := batches[kind].Bytes()
+		key := fmt.Sprintf("%s%s/%s-%s.jsonl", e.prefix, kind, now.UTC().Format("2006/01/02/150405"), e.hostname)
+		if err := e.bucket.put(ctx, key, "application/x-ndjson", data); err != nil {
+			e.requeue(kind, data)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("uploading %s: %w", kind, err)
+			}
+		}
+	}
+	return firstErr
+}
+
+// requeue puts records back in front of those added since they were
+// taken for upload.
+func (e *recordExporter) requeue(kind string, data []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	buf := bytes.NewBuffer(data)
+	if newer := e.pending[kind]; newer != nil {
+		buf.Write(newer.Bytes())
+	}
+	e.pending[kind] = buf
+}
+
+// run uploads the queued records every interval.
+func (e *recordExporter) run(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		if err := e.flush(ctx, time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error exporting records: %v\n", err)
+		}
+		cancel()
+	}
+}
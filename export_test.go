@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBucket records objects put into it and fails while failing is set.
+type fakeBucket struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	objects map[string]string
+	auth    []string
+	failing bool
+}
+
+func newFakeBucket(t *testing.T) *fakeBucket {
+	t.Helper()
+	b := &fakeBucket{objects: map[string]string{}}
+	b.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.failing {
+			http.Error(w, "SlowDown", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		b.objects[r.URL.Path] = string(body)
+		b.auth = append(b.auth, r.Header.Get("Authorization"))
+	}))
+	t.Cleanup(b.Close)
+	return b
+}
+
+func (b *fakeBucket) client(t *testing.T) *s3Client {
+	t.Helper()
+	c, err := newS3Client(b.URL+"/archive", "eu-west-1", "AKID", "secret", "", http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRecordExporter_UploadsBatches(t *testing.T) {
+	b := newFakeBucket(t)
+	e := newRecordExporter(b.client(t), "shell/")
+	e.hostname = "web01"
+	e.add(exportAudit, []byte(`{"action":"a"}`))
+	e.add(exportAudit, []byte(`{"action":"b"}`))
+	e.add(exportJobs, []byte(`{"id":"j1"}`))
+
+	now := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	if err := e.flush(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := b.objects["/archive/shell/audit/2024/03/01/123000-web01.jsonl"]; got != "{\"action\":\"a\"}\n{\"action\":\"b\"}\n" {
+		t.Errorf("Unexpected audit batch %q (objects %v)", got, b.objects)
+	}
+	if got := b.objects["/archive/shell/jobs/2024/03/01/123000-web01.jsonl"]; got != "{\"id\":\"j1\"}\n" {
+		t.Errorf("Unexpected jobs batch %q", got)
+	}
+	if len(b.auth) == 0 || !strings.HasPrefix(b.auth[0], "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(b.auth[0], "/eu-west-1/s3/aws4_request") {
+		t.Errorf("Expected signed requests, got %v", b.auth)
+	}
+}
+
+func TestRecordExporter_KeepsRecordsUntilUploaded(t *testing.T) {
+	b := newFakeBucket(t)
+	b.failing = true
+	e := newRecordExporter(b.client(t), "")
+	e.add(exportAudit, []byte(`{"n":1}`))
+
+	if err := e.flush(context.Background(), time.Now()); err == nil {
+		t.Fatal("Expected the upload to fail")
+	}
+	e.add(exportAudit, []byte(`{"n":2}`))
+	b.mu.Lock()
+	b.failing = false
+	b.mu.Unlock()
+	if err := e.flush(context.Background(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b.objects) != 1 {
+		t.Fatalf("Expected one file, got %v", b.objects)
+	}
+	for _, got := range b.objects {
+		if got != "{\"n\":1}\n{\"n\":2}\n" {
+			t.Errorf("Expected both records in order, got %q", got)
+		}
+	}
+}
+
+func TestNewS3Client_RequiresBucket(t *testing.T) {
+	for _, u := range []string{"https://s3.amazonaws.com", "s3://bucket", "https:///bucket"} {
+		if _, err := newS3Client(u, "us-east-1", "", "", "", nil); err == nil {
+			t.Errorf("%s: expected an error", u)
+		}
+	}
+}
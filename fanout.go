@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostResult is how a command sent to a group of hosts ended on one of
+// them.
+type hostResult struct {
+	Host     string
+	ExitCode int
+}
+
+// groupBackend returns the backend that runs a command on each host of a
+// group: it supports what all of their connected agents support. It fails
+// if none of them is connected.
+func (s *server) groupBackend(group string, hosts []string) (backend, error) {
+	var caps []capability
+	connected := 0
+	for _, host := range hosts {
+		a := s.agents.get(s.cfg.Inventory.agentOf(host))
+		if a == nil {
+			continue
+		}
+		hostCaps := a.backend().Caps
+		if connected == 0 {
+			caps = slices.Clone(hostCaps)
+		} else {
+			caps = slices.DeleteFunc(caps, func(c capability) bool { return !slices.Contains(hostCaps, c) })
+		}
+		connected++
+	}
+	if connected == 0 {
+		return backend{}, fmt.Errorf("no agent of the hosts of %s is connected", group)
+	}
+	return backend{Name: "group " + group, Caps: caps}, nil
+}
+
+// runOnGroup runs a shell command on every host of a group at once. The
+// output of each host is streamed with its lines prefixed with the host,
+// and the result has a section for each host, in order, headed with how
+// the command ended there. It fails if any host failed, with the first
+// failing host's exit code.
+func (s *server) runOnGroup(ctx context.Context, hosts []string, command string, opts runOptions) commandResult {
+	startTime := time.Now()
+
+	// Each agent reads its own copy of the input.
+	var stdin []byte
+	if opts.Stdin != nil {
+		var err error
+		if stdin, err = io.ReadAll(opts.Stdin); err != nil {
+			return commandResult{Lines: []string{fmt.Sprintf("reading input: %v", err)}, ExitCode: 1, Duration: time.Since(startTime)}
+		}
+	}
+	var progress *lockedWriter
+	if opts.Progress != nil {
+		progress = &lockedWriter{w: opts.Progress}
+	}
+
+	results := make([]commandResult, len(hosts))
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		hostOpts := opts
+		if opts.Stdin != nil {
+			hostOpts.Stdin = bytes.NewReader(stdin)
+		}
+		var prefixed *hostPrefixWriter
+		if progress != nil {
+			prefixed = &hostPrefixWriter{prefix: "[" + host + "] ", w: progress}
+			hostOpts.Progress = prefixed
+		}
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			results[i] = s.runOnAgent(ctx, s.cfg.Inventory.agentOf(host), command, hostOpts)
+			prefixed.flush()
+		}(i, host)
+	}
+	wg.Wait()
+
+	result := commandResult{Duration: time.Since(startTime)}
+	for i, host := range hosts {
+		r := results[i]
+		status := "ok"
+		if r.ExitCode != 0 {
+			status = fmt.Sprintf("exit %d, %s", r.ExitCode, translateExitCode(r.ExitCode))
+			if result.ExitCode == 0 {
+				result.ExitCode = r.ExitCode
+			}
+		}
+		result.Lines = append(result.Lines, fmt.Sprintf("── %s: %s ──", host, status))
+		result.Lines = append(result.Lines, r.Lines...)
+		if len(r.Binary) > 0 {
+			result.Lines = append(result.Lines, fmt.Sprintf("(binary output, %d bytes)", len(r.Binary)))
+		}
+		result.Hosts = append(result.Hosts, hostResult{Host: host, ExitCode: r.ExitCode})
+	}
+	return result
+}
+
+// hostsFooter summarizes how a command sent to a group ended on its hosts,
+// naming those it failed on, e.g. "2 of 3 hosts succeeded; failed on
+// web03 (exit 1)".
+func hostsFooter(hosts []hostResult) string {
+	if len(hosts) == 0 {
+		return ""
+	}
+	var failed []string
+	for _, h := range hosts {
+		if h.ExitCode != 0 {
+			failed = append(failed, fmt.Sprintf("%s (exit %d)", h.Host, h.ExitCode))
+		}
+	}
+	if len(failed) == 0 {
+		return fmt.Sprintf("\n_all %d hosts succeeded_", len(hosts))
+	}
+	return fmt.Sprintf("\n_%d of %d hosts succeeded; failed on %s_", len(hosts)-len(failed), len(hosts), strings.Join(failed, ", "))
+}
+
+// lockedWriter serializes writes from the hosts of a group.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// hostPrefixWriter writes a host's output a whole line at a time, with
+// the host in front, so the lines of hosts running at once do not mix.
+type hostPrefixWriter struct {
+	prefix string
+	w      io.Writer
+	buf    []byte
+}
+
+func (h *hostPrefixWriter) Write(p []byte) (int, error) {
+	h.buf = append(h.buf, p...)
+	i := bytes.LastIndexByte(h.buf, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(h.buf[:i+1], []byte("\n")) {
+		if len(line) > 0 {
+			out.WriteString(h.prefix)
+			out.Write(line)
+		}
+	}
+	h.buf = append(h.buf[:0], h.buf[i+1:]...)
+	if _, err := h.w.Write(out.Bytes()); err != nil {
+		return len(p), err
+	}
+	return len(p), nil
+}
+
+// flush writes what is left of a last line without a newline.
+func (h *hostPrefixWriter) flush() {
+	if h == nil || len(h.buf) == 0 {
+		return
+	}
+	h.w.Write([]byte(h.prefix + string(h.buf) + "\n"))
+	h.buf = nil
+}
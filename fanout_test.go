@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHandleCommand_GroupFanOut(t *testing.T) {
+	inv, err := loadInventory(writeInventory(t, `
+hosts: {web01: {}, web02: {}, web03: {}}
+groups: {web: [web01, web02, web03], pair: [web01, web02]}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var targets []string
+	s := newServer(config{
+		AgentToken: "agent-secret",
+		Inventory:  inv,
+		OPAURL: fakeOPA(t, func(in policyInput) interface{} {
+			targets = in.TargetHosts
+			return "allow"
+		}).URL,
+		Profiles: []profile{{Name: "default", Hosts: map[string][]string{"@web": {"U1"}, "web0[12]": {"U2"}}}},
+	})
+	startAgent(t, s, "web01")
+	startAgent(t, s, "web02")
+
+	data := url.Values{}
+	data.Set("user_id", "U1")
+	data.Set("text", `$ @web sh -c 'echo "$0"; test "$0" = sh'`)
+	response := postCommand(t, s, data)
+	text := response["text"]
+	for _, want := range []string{
+		"[web] $ sh -c",
+		"── web01: ok ──\nsh\n── web02: ok ──\nsh\n── web03: exit 1, error ──\nagent web03 is not connected",
+		"_2 of 3 hosts succeeded; failed on web03 (exit 1)_",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in %q", want, text)
+		}
+	}
+	if strings.Join(targets, ",") != "web01,web02,web03" {
+		t.Errorf("Expected the policy to see the group's hosts, got %v", targets)
+	}
+
+	// A user must be allowed on every host of the group.
+	data.Set("user_id", "U2")
+	data.Set("text", "$ @web uptime")
+	if response := postCommand(t, s, data); !strings.Contains(response["text"], "not allowed to run commands on web from this channel") {
+		t.Errorf("Expected the group refused, got %q", response["text"])
+	}
+	data.Set("text", "$ @pair echo hi")
+	if response := postCommand(t, s, data); !strings.Contains(response["text"], "_all 2 hosts succeeded_") {
+		t.Errorf("Expected the group allowed, got %q", response["text"])
+	}
+}
+
+func TestHostPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	shared := &lockedWriter{w: &out}
+	w := &hostPrefixWriter{prefix: "[web01] ", w: shared}
+	w.Write([]byte("one\ntw"))
+	w.Write([]byte("o\nthr"))
+	w.flush()
+	if got, want := out.String(), "[web01] one\n[web01] two\n[web01] thr\n"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
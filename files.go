@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// slackFile is the subset of a Slack file object used to download and
+// link to it, and to check who may use it.
+type slackFile struct {
+	ID                 string `json:"id"`
+	Name               string `json:"name"`
+	Size               int64  `json:"size"`
+	URLPrivateDownload string `json:"url_private_download"`
+	Permalink          string `json:"permalink"`
+
+	// User uploaded the file, which is shared in Channels, Groups
+	// (private channels) and IMs.
+	User     string   `json:"user"`
+	Channels []string `json:"channels"`
+	Groups   []string `json:"groups"`
+	IMs      []string `json:"ims"`
+}
+
+// sharedWith reports whether a command may use the file: its invoker
+// uploaded it, or it was shared in the command's channel. The bot's token
+// can read files from anywhere, so others' uploads elsewhere stay out.
+func (f slackFile) sharedWith(cmd slashCommand) bool {
+	if f.User != "" && f.User == cmd.UserID {
+		return true
+	}
+	return cmd.ChannelID != "" && (slices.Contains(f.Channels, cmd.ChannelID) || slices.Contains(f.Groups, cmd.ChannelID) || slices.Contains(f.IMs, cmd.ChannelID))
+}
+
+// fileIDPattern matches a Slack file ID on its own or inside a permalink
+// such as https://example.slack.com/files/U0123/F0123ABCD/data.csv.
+var fileIDPattern = regexp.MustCompile(`\bF[0-9A-Z]{8,}\b`)
+
+// parseFileRef extracts the file ID from a file ID or permalink.
+func parseFileRef(ref string) (string, bool) {
+	id := fileIDPattern.FindString(ref)
+	return id, id != ""
+}
+
+func (api *slackAPI) fileInfo(ctx context.Context, id string) (slackFile, error) {
+	var resp struct {
+		File slackFile `json:"file"`
+	}
+	err := api.call(ctx, "files.info", url.Values{"file": {id}}, &resp)
+	return resp.File, err
+}
+
+// downloadFile saves a Slack file into dir and returns its path. Files
+// larger than maxSize are refused.
+func (api *slackAPI) downloadFile(ctx context.Context, f slackFile, dir string, maxSize int64) (string, error) {
+	if f.Size > maxSize {
+		return "", fmt.Errorf("file %s is %d bytes, limit is %d", f.Name, f.Size, maxSize)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", f.URLPrivateDownload, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+api.token)
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("downloading %s: status %d", f.Name, resp.StatusCode)
+	}
+
+	path := filepath.Join(dir, filepath.Base(f.Name))
+	out, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	// Read one byte past the limit to detect files that lied about their size
+	n, err := io.Copy(out, io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return "", err
+	}
+	if n > maxSize {
+		return "", fmt.Errorf("file %s exceeds limit of %d bytes", f.Name, maxSize)
+	}
+	return path, nil
+}
+
+// fetchFile downloads the referenced Slack file, if the command may use
+// it, into a new temporary directory. The caller must call cleanup when
+// done with the file.
+func (s *server) fetchFile(ctx context.Context, cmd slashCommand, ref string) (path string, cleanup func(), err error) {
+	if s.slack == nil {
+		return "", nil, fmt.Errorf("--file requires SLACK_TOKEN")
+	}
+
+	id, ok := parseFileRef(ref)
+	if !ok {
+		return "", nil, fmt.Errorf("not a Slack file: %s", ref)
+	}
+
+	f, err := s.slack.fileInfo(ctx, id)
+	if err != nil {
+		return "", nil, err
+	}
+	if !f.sharedWith(cmd) {
+		return "", nil, fmt.Errorf("file %s was not shared in this channel or by you", id)
+	}
+
+	dir, err := os.MkdirTemp("", "http-shell-file-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+
+	path, err = s.slack.downloadFile(ctx, f, dir, s.cfg.MaxFileSize)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return path, cleanup, nil
+}
+
+// uploadFile shares content as a file in a channel, or in a thread when
+// threadTS is set, using the external upload flow behind files.uploadV2.
+func (api *slackAPI) uploadFile(ctx context.Context, channel, threadTS, filename, title string, content []byte) error {
+	var upload struct {
+		UploadURL string `json:"upload_url"`
+		FileID    string `json:"file_id"`
+	}
+	err := api.call(ctx, "files.getUploadURLExternal", url.Values{
+		"filename": {filename},
+		"length":   {strconv.Itoa(len(content))},
+	}, &upload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", upload.UploadURL, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	start := time.Now()
+	resp, err := api.client.Do(req)
+	if err != nil {
+		recordSlackCall("files.upload", start, 0, err)
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("uploading %s: status %d", filename, resp.StatusCode)
+	}
+	recordSlackCall("files.upload", start, resp.StatusCode, err)
+	if err != nil {
+		return err
+	}
+
+	files, err := json.Marshal([]map[string]string{{"id": upload.FileID, "title": title}})
+	if err != nil {
+		return err
+	}
+	params := url.Values{
+		"files":      {string(files)},
+		"channel_id": {channel},
+	}
+	if threadTS != "" {
+		params.Set("thread_ts", threadTS)
+	}
+	if err := api.call(ctx, "files.completeUploadExternal", params, nil); err != nil {
+		return err
+	}
+	api.quota.countUpload(int64(len(content)))
+	return nil
+}
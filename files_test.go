@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseFileRef(t *testing.T) {
+	tests := []struct {
+		ref      string
+		expected string
+	}{
+		{"F0123ABCDE", "F0123ABCDE"},
+		{"https://example.slack.com/files/U0123ABCD/F0123ABCDE/data.csv", "F0123ABCDE"},
+		{"data.csv", ""},
+	}
+
+	for _, tt := range tests {
+		if got, _ := parseFileRef(tt.ref); got != tt.expected {
+			t.Errorf("parseFileRef(%q): expected %q, got %q", tt.ref, tt.expected, got)
+		}
+	}
+}
+
+func TestHandleCommand_File(t *testing.T) {
+	f := newFakeSlack(t)
+	f.mux.HandleFunc("/download/data.csv", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer xoxb-test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("a,b\n1,2\n"))
+	})
+	f.respond("files.info", map[string]interface{}{"file": map[string]interface{}{
+		"id":                   "F0123ABCDE",
+		"name":                 "data.csv",
+		"size":                 8,
+		"url_private_download": f.URL + "/download/data.csv",
+		"user":                 "U2",
+		"channels":             []string{"C1"},
+	}})
+
+	cfg := f.config()
+	cfg.MaxFileSize = 1024
+	s := newServer(cfg)
+
+	data := url.Values{}
+	data.Set("text", "$ --file=F0123ABCDE wc -l; basename \"$SLACK_FILE\"")
+	data.Set("user_id", "U1")
+	data.Set("channel_id", "C1")
+
+	response := postCommand(t, s, data)
+
+	if !strings.Contains(response["text"], "2\ndata.csv") {
+		t.Errorf("Expected file on stdin and in $SLACK_FILE, got %q", response["text"])
+	}
+
+	// Another channel's file is refused unless the invoker uploaded it.
+	data.Set("channel_id", "C2")
+	response = postCommand(t, s, data)
+	if !strings.Contains(response["text"], "not shared in this channel or by you") {
+		t.Errorf("Expected a file from another channel refused, got %q", response["text"])
+	}
+	data.Set("user_id", "U2")
+	response = postCommand(t, s, data)
+	if !strings.Contains(response["text"], "2\ndata.csv") {
+		t.Errorf("Expected the uploader's own file accepted, got %q", response["text"])
+	}
+}
+
+func TestHandleCommand_FileTooLarge(t *testing.T) {
+	f := newFakeSlack(t)
+	f.respond("files.info", map[string]interface{}{"file": map[string]interface{}{
+		"id": "F0123ABCDE", "name": "big.bin", "size": 4096, "user": "U1",
+	}})
+
+	cfg := f.config()
+	cfg.MaxFileSize = 1024
+	s := newServer(cfg)
+
+	data := url.Values{}
+	data.Set("text", "$ --file=F0123ABCDE cat")
+	data.Set("user_id", "U1")
+
+	response := postCommand(t, s, data)
+
+	if response["response_type"] != "ephemeral" || !strings.Contains(response["text"], "limit") {
+		t.Errorf("Expected size limit error, got %q", response["text"])
+	}
+}
+
+func TestHandleCommand_FileWithoutToken(t *testing.T) {
+	s := newServer(config{})
+
+	data := url.Values{}
+	data.Set("text", "$ --file=F0123ABCDE cat")
+
+	response := postCommand(t, s, data)
+
+	if !strings.Contains(response["text"], "SLACK_TOKEN") {
+		t.Errorf("Expected missing token error, got %q", response["text"])
+	}
+}
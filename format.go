@@ -0,0 +1,67 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// formatVariantStats counts, per formatter variant, messages delivered,
+// outputs truncated to fit and failed Slack calls, as "<variant>.<event>".
+var formatVariantStats = expvar.NewMap("format_variants")
+
+// formatters render a command and its result as a message.
+var formatters = map[string]func(text string, res commandResult) string{
+	"classic": formatResult,
+	"compact": formatCompact,
+}
+
+// formatVariant is a formatter taking part in a formatting experiment, or
+// the plain formatter users can choose for themselves.
+type formatVariant struct {
+	name   string
+	format func(text string, res commandResult) string
+	status func(res commandResult) string // the status line alone
+}
+
+// count records an event for the variant.
+func (v formatVariant) count(event string) {
+	formatVariantStats.Add(v.name+"."+event, 1)
+}
+
+// variantFor returns the formatter for a channel. With two variants
+// configured, channels are split between them by a hash of the channel ID
+// so that each channel always sees the same format.
+func (s *server) variantFor(channelID string) formatVariant {
+	names := s.cfg.FormatVariants
+	if len(names) == 0 {
+		names = []string{"classic"}
+	}
+
+	name := names[0]
+	if len(names) > 1 && channelBucket(channelID) < s.cfg.FormatSplit {
+		name = names[1]
+	}
+	return formatVariant{name: name, format: formatters[name], status: formatStatus}
+}
+
+// channelBucket maps a channel ID to a stable value in [0, 1).
+func channelBucket(channelID string) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(channelID))
+	return float64(h.Sum32()%10000) / 10000
+}
+
+// formatCompact puts the command and status on one line and the output, if
+// any, in a code block below.
+func formatCompact(text string, res commandResult) string {
+	header := fmt.Sprintf("`%s` %s", text, formatStatus(res))
+	if strings.TrimSpace(text) == "" {
+		header = formatStatus(res)
+	}
+	if len(res.Lines) == 0 {
+		return header
+	}
+	return header + "\n```" + strings.Join(res.Lines, "\n") + "```"
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVariantFor(t *testing.T) {
+	s := newServer(config{FormatVariants: []string{"classic", "compact"}, FormatSplit: 0.5})
+
+	seen := map[string]int{}
+	for i := 0; i < 100; i++ {
+		channel := fmt.Sprintf("C%d", i)
+		v := s.variantFor(channel)
+		if again := s.variantFor(channel); again.name != v.name {
+			t.Fatalf("Expected channel %s to keep variant %s, got %s", channel, v.name, again.name)
+		}
+		seen[v.name]++
+	}
+	if seen["classic"] < 20 || seen["compact"] < 20 {
+		t.Errorf("Expected channels split between variants, got %v", seen)
+	}
+
+	s.cfg.FormatSplit = 0
+	if v := s.variantFor("C1"); v.name != "classic" {
+		t.Errorf("Expected split 0 to use the first variant, got %s", v.name)
+	}
+	if v := newServer(config{}).variantFor("C1"); v.name != "classic" {
+		t.Errorf("Expected classic by default, got %s", v.name)
+	}
+}
+
+func TestFormatCompact(t *testing.T) {
+	res := commandResult{Lines: []string{"a", "b"}, Duration: time.Millisecond}
+	if got, want := formatCompact("$ ls", res), "`$ ls` _success 1.00ms_\n```a\nb```"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if got := formatCompact("$ true", commandResult{}); strings.Contains(got, "```") {
+		t.Errorf("Expected no code block without output, got %q", got)
+	}
+}
+
+func TestDeliver_CountsTruncationsPerVariant(t *testing.T) {
+	s := newServer(config{FormatVariants: []string{"compact"}, MaxMessageChars: 100})
+	truncations := func() int64 {
+		if v, ok := formatVariantStats.Get("compact.truncations").(*expvar.Int); ok {
+			return v.Value()
+		}
+		return 0
+	}
+	before := truncations()
+
+	s.handleCommandExecution(context.Background(), slashCommand{Text: "$ seq 1 100"})
+
+	if after := truncations(); after != before+1 {
+		t.Errorf("Expected one truncation to be counted, got %d", after-before)
+	}
+}
@@ -0,0 +1,628 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// slashCommand holds the fields of a slash command request used by the
+// server. Only Text is required.
+type slashCommand struct {
+	Text        string
+	UserID      string
+	ChannelID   string
+	TeamID      string
+	ResponseURL string
+	ThreadTS    string
+	TriggerID   string
+
+	// DryRun evaluates the command without running it, as for requests
+	// mirrored from production.
+	DryRun bool
+
+	// ApprovedBy is the user who approved the command, if it needed
+	// approval. It is never taken from the request.
+	ApprovedBy string
+
+	// Confirmed is set once the user confirmed a dangerous command. It is
+	// never taken from the request.
+	Confirmed bool
+
+	// DMChannel is the invoker's DM when output is delivered there rather
+	// than to the channel. It is never taken from the request.
+	DMChannel string
+
+	// OutputChannel is the channel given with --to, once checked, where
+	// output is posted instead. It is never taken from the request.
+	OutputChannel string
+
+	// Host is the agent given with @ or --host=, once checked, that runs
+	// the command instead of the profile's. It is never taken from the
+	// request.
+	Host string
+
+	// Group is the hosts of the group given with @ or --host=, once
+	// checked, which all run the command; Host is then the group. It is
+	// never taken from the request.
+	Group []string
+
+	// Container is the Docker container given with --container=, once
+	// checked, that runs the command instead of the profile's backend. It
+	// is never taken from the request.
+	Container string
+
+	// FromMessage is set for commands taken from a message with the "Run
+	// this as a command" shortcut. Their results go in the message's thread.
+	FromMessage bool
+
+	// MessageTS is the message the command was taken from, as for
+	// mentions and the shortcut, which is marked with status reactions.
+	MessageTS string
+
+	// Inputs are "NAME=value" variables the command runs with in addition
+	// to the channel's, such as the values of a workflow step's variables.
+	// They are never taken from the request.
+	Inputs []string
+
+	// Secrets are the secrets typed into the command, which are masked
+	// wherever it is stored or posted. They are never taken from the
+	// request.
+	Secrets []inlineSecret
+
+	// Reviewed is the command as it was expanded when its approval or
+	// confirmation was requested, which is what the approver or the user
+	// saw. It is never taken from the request.
+	Reviewed *reviewedCommand
+}
+
+// reviewedCommand is a command put to an approver or to its user, with
+// the channel's variables it was to run with.
+type reviewedCommand struct {
+	Command string
+	Env     []string
+}
+
+// maxRequestBody limits how much of a request body is read for signature
+// verification.
+const maxRequestBody = 1 << 20
+
+func (s *server) handleCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.verifyRequest(w, r) {
+		return
+	}
+
+	// Parse form data
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	cmd := slashCommand{
+		Text:        r.FormValue("text"),
+		UserID:      r.FormValue("user_id"),
+		ChannelID:   r.FormValue("channel_id"),
+		TeamID:      r.FormValue("team_id"),
+		ResponseURL: r.FormValue("response_url"),
+		ThreadTS:    r.FormValue("thread_ts"),
+		TriggerID:   r.FormValue("trigger_id"),
+		DryRun:      r.FormValue("dry_run") == "true",
+	}
+
+	if cmd.Text == "" {
+		http.Error(w, "Missing required field: text", http.StatusBadRequest)
+		return
+	}
+
+	if s.mirror != nil && !cmd.DryRun {
+		s.mirror.send(r.PostForm)
+	}
+
+	// Queued commands are acknowledged once they are on disk and their
+	// results posted when they finish.
+	// Commands with a secret typed into them are not written to disk.
+	if s.queue != nil && !cmd.DryRun && s.canPostLater(cmd) && len(detectInlineSecrets(cmd.Text)) == 0 && s.enqueue(cmd) {
+		writeJSON(w, ephemeral(queuedMessage))
+		return
+	}
+
+	// The request context is canceled if Slack gives up on the request,
+	// which stops every stage below.
+	writeJSON(w, s.respond(r.Context(), cmd))
+}
+
+// respond runs a command and returns the reply, with a Re-run button if
+// it ran. A command that starts with a misspelled builtin or meta-flag is
+// not run; the reply suggests the closest matches instead.
+func (s *server) respond(ctx context.Context, cmd slashCommand) interface{} {
+	if sg, ok := s.suggest(ctx, cmd.Text); ok {
+		return s.suggestionMessage(cmd, sg)
+	}
+	return s.withRerun(cmd, s.handleCommandExecution(ctx, cmd))
+}
+
+// handleCommandExecution runs a command through detection, policy,
+// execution and delivery, and returns the immediate response. Canceling
+// ctx stops whichever stage is running.
+//
+// In channels whose profile has a soft timeout, a command still running
+// when it expires is reported as such and left to finish in the
+// background, no longer stopped by ctx; its result is posted later.
+func (s *server) handleCommandExecution(ctx context.Context, cmd slashCommand) map[string]string {
+	// Results posted later show the command too, so its secrets are
+	// masked there as well.
+	cmd.Secrets = detectInlineSecrets(cmd.Text)
+	soft := s.cfg.profileFor(cmd.ChannelID).softTimeout
+	if soft <= 0 || cmd.DryRun || !s.canPostLater(cmd) {
+		return s.processCommand(ctx, cmd)
+	}
+
+	done := make(chan map[string]string, 1)
+	go func() { done <- s.processCommand(context.WithoutCancel(ctx), cmd) }()
+	timer := time.NewTimer(soft)
+	defer timer.Stop()
+	select {
+	case message := <-done:
+		return message
+	case <-timer.C:
+	}
+
+	go func() {
+		s.postLater(context.WithoutCancel(ctx), cmd, <-done)
+	}()
+	return ephemeral(fmt.Sprintf("_still running after %s; the result will be posted when it finishes_", soft))
+}
+
+// processCommand is handleCommandExecution without the soft timeout.
+func (s *server) processCommand(ctx context.Context, cmd slashCommand) map[string]string {
+	if s.cfg.Onboarding && !cmd.DryRun {
+		go s.onboard(context.WithoutCancel(ctx), cmd)
+	}
+
+	// "!!" and "!<job-id>" re-run a stored command as if it was typed
+	// again, so every check applies to it anew.
+	if text, ok, err := s.expandHistory(cmd); ok {
+		if err != nil {
+			return failure(codeBadRequest, "_"+err.Error()+"_")
+		}
+		cmd.Text = text
+	}
+
+	flags, command := normalizeCommand(cmd.Text)
+	// Aliases and snippets are expanded first, so everything after sees
+	// the command that actually runs.
+	command = s.expandSnippet(cmd, s.expandAlias(cmd, command))
+	// The host given with @ or --host= is checked before the backend is
+	// chosen, and the policy sees it as target_host, with the hosts of a
+	// group as target_hosts.
+	if flags.Host != "" {
+		group, err := s.checkHost(cmd, flags.Host)
+		if err != nil {
+			return failure(errorCodeOf(err, codeBadRequest), "_"+err.Error()+"_")
+		}
+		cmd.Host, cmd.Group = flags.Host, group
+	}
+	if flags.Container != "" {
+		if err := s.checkContainer(cmd, flags); err != nil {
+			return failure(errorCodeOf(err, codeBadRequest), "_"+err.Error()+"_")
+		}
+		cmd.Container = flags.Container
+	}
+	be, err := s.backendFor(cmd)
+	if err != nil {
+		return failure(codeBackendUnreachable, "_"+err.Error()+"_")
+	}
+	opts := runOptions{
+		PTY:           flags.PTY || (s.cfg.PTY && be.supports(capPTY)),
+		TranslateANSI: s.cfg.ANSIMode == ansiTranslate,
+	}
+	if flags.Stdin {
+		var stdin string
+		var ok bool
+		if command, stdin, ok = splitStdin(command); !ok {
+			return failure(codeBadRequest, "_--stdin requires a `"+stdinSeparator+"` line between the command and its input_")
+		}
+		opts.Stdin = strings.NewReader(stdin)
+	}
+	if opts.PTY && (flags.Stdin || flags.File != "") {
+		return failure(codeBadRequest, "_--stdin and --file cannot be combined with --pty_")
+	}
+	if err := s.checkCapabilities(be, command, flags); err != nil {
+		return failure(codeUnsupported, "_"+err.Error()+"_")
+	}
+	if flags.Canvas && !s.canvasAllowed(cmd) {
+		return failure(codeUnsupported, "_--canvas needs a Slack token and a channel where output may be shared_")
+	}
+
+	if s.wantsDM(cmd, flags) {
+		if s.slack == nil || cmd.UserID == "" {
+			return failure(codeUnsupported, "_output by DM needs a Slack token_")
+		}
+		if flags.Canvas {
+			return failure(codeBadRequest, "_--dm cannot be combined with --canvas_")
+		}
+	}
+
+	// The channel given with --to is checked before the policy, which
+	// sees it as output_channel.
+	if flags.To != "" {
+		if s.slack == nil || cmd.UserID == "" {
+			return failure(codeUnsupported, "_--to needs a Slack token_")
+		}
+		if flags.Canvas || s.wantsDM(cmd, flags) {
+			return failure(codeBadRequest, "_--to cannot be combined with --canvas or --dm_")
+		}
+		channel, err := s.resolveOutputChannel(ctx, cmd, flags.To)
+		if err != nil {
+			return failure(errorCodeOf(err, codeBadRequest), "_"+err.Error()+"_")
+		}
+		cmd.OutputChannel = channel
+	}
+
+	// Dry runs, such as mirrored requests, are evaluated without the side
+	// effects of hooks, alerts and approval requests.
+	if s.hooks != nil && !cmd.DryRun {
+		var err error
+		if command, _, err = s.hooks.rewrite(ctx, hookPrePolicy, cmd, command); err != nil {
+			fmt.Fprintf(os.Stderr, "Error running hook: %v\n", err)
+		}
+	}
+
+	// Secrets typed into the command are masked, from here on, in every
+	// copy of it that is stored or posted, and logged only as hashes.
+	cmd.Secrets = detectInlineSecrets(cmd.Text + "\n" + command)
+	masked := maskSecrets(command, cmd.Secrets)
+
+	// An approved or confirmed command runs only if it still expands to
+	// what was approved or confirmed, since aliases, snippets and the
+	// history may have changed since.
+	if cmd.Reviewed != nil && command != cmd.Reviewed.Command {
+		s.auditRefusal(cmd, auditPolicyDenied, "the command changed after it was reviewed")
+		return failure(codePolicyDenied, fmt.Sprintf("_refused: the command now expands to_ `%s` _rather than the_ `%s` _that was reviewed; run it again_", masked, maskSecrets(cmd.Reviewed.Command, cmd.Secrets)))
+	}
+
+	if hits := detectSuspicious(command, s.cfg.Honeytokens); len(hits) > 0 {
+		blocked := s.cfg.SuspiciousAction == suspiciousBlock
+		if !cmd.DryRun {
+			s.alertSecurity(ctx, cmd, masked, hits, blocked)
+		}
+		action := auditSuspiciousCommand
+		if blocked {
+			action = auditCommandBlocked
+		}
+		s.auditRefusal(cmd, action, strings.Join(hits, ", "))
+		if blocked {
+			return failure(codeCommandBlocked, formatDenied("blocked", strings.Join(hits, ", ")))
+		}
+	}
+
+	var secrets []inlineSecret
+	if s.cfg.InlineSecretAction != inlineSecretOff {
+		if secrets = cmd.Secrets; len(secrets) > 0 {
+			blocked := s.cfg.InlineSecretAction == inlineSecretBlock
+			s.auditInlineSecrets(cmd, masked, secrets, blocked)
+			if blocked {
+				reason := "the command contains a secret (" + inlineSecretKinds(secrets) + ")"
+				return failure(codeCommandBlocked, formatDenied("blocked", reason)+"\n_"+inlineSecretAdvice+"_")
+			}
+		}
+	}
+
+	severity, reasons := s.classify(command)
+
+	d := s.checkPolicy(ctx, cmd, command)
+	if d.Decision == policyDeny {
+		s.auditRefusal(cmd, auditPolicyDenied, d.Reason)
+		code := d.Code
+		if code == "" {
+			code = codePolicyDenied
+		}
+		return failure(code, formatDenied("denied", d.Reason))
+	}
+	if reason, ok := s.approvalReason(command, d); ok && cmd.ApprovedBy == "" {
+		if cmd.DryRun {
+			return ephemeral(fmt.Sprintf("_dry run: would ask for approval (%s) to run_ `%s`", reason, masked))
+		}
+		return s.requestApproval(ctx, cmd, command, reason)
+	}
+	if severity == severityDangerous && !cmd.Confirmed && cmd.ApprovedBy == "" {
+		if s.cfg.DangerousAction == dangerousBlock {
+			s.auditRefusal(cmd, auditCommandBlocked, strings.Join(reasons, ", "))
+			return failure(codeCommandBlocked, formatDenied("blocked", strings.Join(reasons, ", ")))
+		}
+		if cmd.DryRun {
+			return ephemeral(fmt.Sprintf("_dry run: would ask for confirmation (%s) to run_ `%s`", strings.Join(reasons, ", "), masked))
+		}
+		s.auditRefusal(cmd, auditConfirmationRequested, strings.Join(reasons, ", "))
+		return s.requestConfirmation(ctx, cmd, command, strings.Join(reasons, ", "))
+	}
+
+	if s.hooks != nil && !cmd.DryRun {
+		var reason string
+		var err error
+		if command, reason, err = s.hooks.rewrite(ctx, hookPreExec, cmd, command); err != nil {
+			fmt.Fprintf(os.Stderr, "Error running hook: %v\n", err)
+		}
+		if reason != "" {
+			return failure(codeHookRefused, formatDenied("refused", reason))
+		}
+	}
+
+	// Lint findings are shown with the reply but do not stop the command.
+	var lintFindings []lintFinding
+	if _, _, ok := s.lookupBuiltin(command); s.cfg.Lint && !ok {
+		lintFindings = s.lint(ctx, command, s.cfg.profileFor(cmd.ChannelID).lintLevel())
+	}
+
+	if cmd.DryRun {
+		return ephemeral(fmt.Sprintf("_dry run: would run_ `%s`", maskSecrets(command, cmd.Secrets)) + lintFooter(lintFindings) + inlineSecretFooter(secrets))
+	}
+
+	// A template with parameters run without them asks for them first.
+	if t, ok := s.promptableTemplate(command); ok {
+		return s.promptTemplate(ctx, cmd, t)
+	}
+
+	// The channel's variables are in the environment of its commands.
+	opts.Env = append(opts.Env, s.channelEnv(cmd)...)
+	opts.Env = append(opts.Env, cmd.Inputs...)
+
+	// Attached files are exposed as $SLACK_FILE and, unless --stdin is
+	// given, on stdin.
+	if flags.File != "" {
+		path, cleanup, err := s.fetchFile(ctx, cmd, flags.File)
+		if err != nil {
+			return failure(errorCodeOf(err, codeBadRequest), fmt.Sprintf("_cannot fetch file: %v_", err))
+		}
+		defer cleanup()
+
+		opts.Env = append(opts.Env, "SLACK_FILE="+path)
+		if opts.Stdin == nil {
+			f, err := os.Open(path)
+			if err != nil {
+				return failure(errorCodeOf(err, codeBadRequest), fmt.Sprintf("_cannot open file: %v_", err))
+			}
+			defer f.Close()
+			opts.Stdin = f
+		}
+	}
+
+	if s.wantsDM(cmd, flags) {
+		var err error
+		if cmd.DMChannel, err = s.openDM(ctx, cmd.UserID); err != nil {
+			return failure(errorCodeOf(err, codeSlackError), fmt.Sprintf("_cannot open a DM: %v_", err))
+		}
+	}
+
+	var canvas *canvasStream
+	if flags.Canvas {
+		var err error
+		if canvas, err = s.startCanvasStream(ctx, cmd); err != nil {
+			return failure(errorCodeOf(err, codeSlackError), fmt.Sprintf("_cannot stream to canvas: %v_", err))
+		}
+		opts.Progress = canvas
+	}
+
+	// Channels whose profile asks for it watch the output in a message
+	// that is edited as it arrives.
+	var live *liveMessage
+	if canvas == nil && cmd.DMChannel == "" && cmd.OutputChannel == "" && s.cfg.profileFor(cmd.ChannelID).LiveOutput && s.liveAllowed(cmd) {
+		var err error
+		if live, err = s.startLiveMessage(ctx, cmd); err != nil {
+			fmt.Fprintf(os.Stderr, "Error posting live message: %v\n", err)
+		} else {
+			opts.Progress = live
+		}
+	}
+
+	// The job's context is canceled by its Stop button; delivery still
+	// uses ctx so a stopped job reports its output.
+	jobCtx, j := s.jobs.start(ctx, cmd, command)
+	j.Severity = severity
+	defer s.jobs.finish(j)
+	if s.cfg.Interactivity && cmd.ResponseURL != "" {
+		s.postRunning(ctx, j)
+	}
+
+	// Without a live message, a command that shows nothing for a while
+	// gets a heartbeat, unless --quiet is given.
+	var beat *heartbeat
+	if live == nil && cmd.DMChannel == "" && cmd.OutputChannel == "" && !flags.Quiet {
+		if beat = s.startHeartbeat(ctx, cmd); beat != nil && opts.Progress != nil {
+			opts.Progress = writers(opts.Progress, beat)
+		}
+	}
+
+	// Output of commands in a session is not seen until they finish, and
+	// builtins print none, so neither is watched.
+	var dog *watchdog
+	if _, _, builtin := s.lookupBuiltin(command); !flags.NoWatchdog && !builtin && !s.usesSession(cmd, opts) {
+		if dog = s.startWatchdog(ctx, j); dog != nil {
+			opts.Progress = writers(opts.Progress, dog)
+		}
+	}
+
+	reactions := s.startReactions(ctx, cmd)
+	result := s.execute(jobCtx, cmd, command, opts)
+	beat.close(ctx)
+	dog.close(ctx, jobCtx.Err() != nil)
+	// The job's context is only canceled before finish if it was stopped.
+	reactions.finish(ctx, result, jobCtx.Err() != nil)
+	if live != nil {
+		live.close(ctx)
+	}
+	if s.hooks != nil {
+		var err error
+		if result, err = s.hooks.postExec(ctx, cmd, command, result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error running hook: %v\n", err)
+		}
+	}
+
+	// Output with a secret in it is quarantined when stored and withheld
+	// from Slack.
+	if s.cfg.LeakResponse {
+		j.Leaks = detectLeaks(result.Lines)
+	}
+	s.recordJob(j, result)
+	s.archiveOutput(ctx, j, result)
+	s.auditCommand(j, result)
+	if len(j.Leaks) > 0 {
+		result = s.respondToLeak(ctx, j, result)
+	}
+
+	// The full output is in the canvas; the channel gets a summary. A
+	// canvas that may hold a secret is deleted instead.
+	var canvasLink string
+	if canvas != nil && len(j.Leaks) > 0 {
+		canvas.discard(ctx)
+	} else if canvas != nil {
+		canvasLink = canvas.close(ctx, result)
+		result = canvasSummary(result)
+	}
+	if result.ExitCode != 0 {
+		go s.attachDiagnostics(context.WithoutCancel(ctx), cmd, result)
+	}
+
+	message := s.deliver(ctx, cmd, j, result)
+	if timedOut(result) {
+		errorCounts.Add(string(codeTimeout), 1)
+		message["error_code"] = string(codeTimeout)
+	} else if result.Killed != "" {
+		errorCounts.Add(string(codeLimitExceeded), 1)
+		message["error_code"] = string(codeLimitExceeded)
+	}
+	message["text"] += hostsFooter(result.Hosts) + severityFooter(severity, reasons) + lintFooter(lintFindings) + inlineSecretFooter(secrets)
+	if canvasLink != "" {
+		message["text"] += fmt.Sprintf("\n<%s|Full output in canvas>", canvasLink)
+	}
+	if s.hooks != nil {
+		var err error
+		if message, err = s.hooks.preDelivery(ctx, cmd, command, message); err != nil {
+			fmt.Fprintf(os.Stderr, "Error running hook: %v\n", err)
+		}
+	}
+	if cmd.DMChannel != "" {
+		return s.sendDM(ctx, cmd, message)
+	}
+	if cmd.OutputChannel != "" {
+		return s.sendToChannel(ctx, cmd, message)
+	}
+	return message
+}
+
+// verifyRequest checks the request signature, if a signing secret is set,
+// and leaves the body readable. It writes an error response and returns
+// false if the request is rejected.
+func (s *server) verifyRequest(w http.ResponseWriter, r *http.Request) bool {
+	if s.verifier == nil {
+		return true
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBody))
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return false
+	}
+	if err := s.verifier.verify(r, body); err != nil {
+		logRejection(r, err)
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return true
+}
+
+// execute runs a command as a builtin, in the thread's session if there is
+// one, or on its own, and applies output filters. Meta-flags that change
+// how the process is started bypass the session. The command is stopped
+// when ctx is canceled or the command timeout, or the profile's maximum
+// duration, expires.
+func (s *server) execute(ctx context.Context, cmd slashCommand, command string, opts runOptions) commandResult {
+	timeout := s.cfg.CommandTimeout
+	if limit := s.cfg.profileFor(cmd.ChannelID).maxDuration; limit > 0 {
+		timeout = limit
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var result commandResult
+	if b, args, ok := s.lookupBuiltin(command); ok {
+		result = b.Run(ctx, s, cmd, args)
+	} else if len(cmd.Group) > 0 {
+		result = s.runOnGroup(ctx, cmd.Group, command, opts)
+	} else if target := s.dockerFor(cmd); target != nil {
+		result = s.runInDocker(ctx, *target, command, opts)
+	} else if agent := s.agentFor(cmd); agent != "" {
+		result = s.runOnAgent(ctx, agent, command, opts)
+	} else if s.usesSession(cmd, opts) {
+		// The session's shell outlives changes to the channel's
+		// variables, so they are exported with each command.
+		result = s.sessions.run(ctx, sessionKey(cmd), withExports(opts.Env, command))
+	} else if sb := s.cfg.profileFor(cmd.ChannelID).Sandbox; sb != nil {
+		opts.Limits, opts.Rlimits, opts.Environ = s.cfg.Limits, s.cfg.Rlimits, s.cfg.Env.environ()
+		result = runSandboxed(ctx, sb, command, opts)
+	} else {
+		opts.Limits, opts.Rlimits, opts.Environ = s.cfg.Limits, s.cfg.Rlimits, s.cfg.Env.environ()
+		result = runCommand(ctx, command, opts)
+	}
+	if s.plugins != nil {
+		result = s.plugins.filter(ctx, command, result)
+	}
+	return result
+}
+
+// writers returns a writer duplicating writes to w and extra, or extra
+// alone if w is nil.
+func writers(w, extra io.Writer) io.Writer {
+	if w == nil {
+		return extra
+	}
+	return io.MultiWriter(w, extra)
+}
+
+// usesSession reports whether a command that is not a builtin runs in its
+// thread's session. Sessions are kept on the server's host, unsandboxed and
+// without limits, so commands run on an agent, in a container, in a
+// sandbox or with limits use none.
+func (s *server) usesSession(cmd slashCommand, opts runOptions) bool {
+	if s.cfg.profileFor(cmd.ChannelID).Sandbox != nil || s.cfg.Limits != nil || s.cfg.Rlimits != nil {
+		return false
+	}
+	return s.sessions != nil && cmd.ThreadTS != "" && s.agentFor(cmd) == "" && len(cmd.Group) == 0 && s.dockerFor(cmd) == nil && !opts.PTY && opts.Stdin == nil && opts.Progress == nil
+}
+
+// formatDenied renders a refusal with an optional reason.
+func formatDenied(status, reason string) string {
+	if reason == "" {
+		return fmt.Sprintf("_%s_", status)
+	}
+	return fmt.Sprintf("_%s: %s_", status, reason)
+}
+
+// ephemeral builds a response shown only to the invoker.
+func ephemeral(text string) map[string]string {
+	return map[string]string{
+		"response_type": "ephemeral",
+		"text":          text,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func postCommand(t *testing.T, s *server, data url.Values) map[string]string {
+	t.Helper()
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	s.handleCommand(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	return response
+}
+
+// responseURLRecorder starts a server that records messages posted to it.
+func responseURLRecorder(t *testing.T) (*httptest.Server, *[]map[string]string) {
+	t.Helper()
+
+	var messages []map[string]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			t.Errorf("Failed to decode response_url message: %v", err)
+		}
+		messages = append(messages, message)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &messages
+}
+
+func TestHandleCommand_SensitiveChannelHidesOutput(t *testing.T) {
+	ts, messages := responseURLRecorder(t)
+	s := newServer(config{SensitiveChannels: map[string]bool{"C123": true}})
+
+	data := url.Values{}
+	data.Set("text", "$ echo secret-output")
+	data.Set("channel_id", "C123")
+	data.Set("response_url", ts.URL)
+
+	response := postCommand(t, s, data)
+
+	if response["response_type"] != "in_channel" {
+		t.Errorf("Expected response_type 'in_channel', got %q", response["response_type"])
+	}
+	if strings.Contains(response["text"], "secret-output") {
+		t.Errorf("Expected channel response to omit output, got %q", response["text"])
+	}
+	if !strings.Contains(response["text"], "_success") {
+		t.Errorf("Expected channel response to contain status, got %q", response["text"])
+	}
+
+	if len(*messages) != 1 {
+		t.Fatalf("Expected 1 response_url message, got %d", len(*messages))
+	}
+	private := (*messages)[0]
+	if private["response_type"] != "ephemeral" {
+		t.Errorf("Expected ephemeral response_url message, got %q", private["response_type"])
+	}
+	if !strings.Contains(private["text"], "secret-output") {
+		t.Errorf("Expected ephemeral message to contain output, got %q", private["text"])
+	}
+}
+
+func TestHandleCommand_SensitiveChannelWithoutResponseURL(t *testing.T) {
+	s := newServer(config{SensitiveChannels: map[string]bool{"C123": true}})
+
+	data := url.Values{}
+	data.Set("text", "$ echo secret-output")
+	data.Set("channel_id", "C123")
+
+	response := postCommand(t, s, data)
+
+	if response["response_type"] != "ephemeral" {
+		t.Errorf("Expected response_type 'ephemeral', got %q", response["response_type"])
+	}
+	if !strings.Contains(response["text"], "secret-output") {
+		t.Errorf("Expected ephemeral response to contain output, got %q", response["text"])
+	}
+}
+
+func TestHandleCommand_OtherChannelShowsOutput(t *testing.T) {
+	s := newServer(config{SensitiveChannels: map[string]bool{"C123": true}})
+
+	data := url.Values{}
+	data.Set("text", "$ echo visible-output")
+	data.Set("channel_id", "C999")
+
+	response := postCommand(t, s, data)
+
+	if response["response_type"] != "in_channel" {
+		t.Errorf("Expected response_type 'in_channel', got %q", response["response_type"])
+	}
+	if !strings.Contains(response["text"], "visible-output") {
+		t.Errorf("Expected response to contain output, got %q", response["text"])
+	}
+}
+
+func TestHandleCommand_Stdin(t *testing.T) {
+	s := newServer(config{})
+
+	data := url.Values{}
+	data.Set("text", "$ --stdin tr a-z A-Z\n---\nhello stdin")
+
+	response := postCommand(t, s, data)
+
+	if !strings.Contains(response["text"], "HELLO STDIN") {
+		t.Errorf("Expected stdin to reach the command, got %q", response["text"])
+	}
+}
+
+func TestHandleCommand_StdinWithoutSeparator(t *testing.T) {
+	s := newServer(config{})
+
+	data := url.Values{}
+	data.Set("text", "$ --stdin cat")
+
+	response := postCommand(t, s, data)
+
+	if response["response_type"] != "ephemeral" {
+		t.Errorf("Expected ephemeral error, got %q", response["response_type"])
+	}
+}
+
+func TestHandleCommand_CommandTimeout(t *testing.T) {
+	s := newServer(config{CommandTimeout: 100 * time.Millisecond})
+
+	data := url.Values{}
+	data.Set("text", "$ sleep 5 & sleep 5")
+
+	start := time.Now()
+	response := postCommand(t, s, data)
+
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Expected command to be stopped by the timeout, took %s", elapsed)
+	}
+	if !strings.Contains(response["text"], "timed out") {
+		t.Errorf("Expected timed out status, got %q", response["text"])
+	}
+}
+
+func TestHandleCommand_TimeoutDeliversPartialOutput(t *testing.T) {
+	s := newServer(config{CommandTimeout: 200 * time.Millisecond})
+
+	data := url.Values{}
+	data.Set("text", "$ echo started; sleep 5")
+	response := postCommand(t, s, data)
+
+	if !strings.Contains(response["text"], "started") || !strings.Contains(response["text"], "_partial — timed out") {
+		t.Errorf("Expected partial output marked as timed out, got %q", response["text"])
+	}
+}
+
+func TestExecute_CanceledContext(t *testing.T) {
+	s := newServer(config{})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	result := s.execute(ctx, slashCommand{}, "sleep 5", runOptions{})
+
+	if result.ExitCode != 130 {
+		t.Errorf("Expected exit code 130, got %d", result.ExitCode)
+	}
+	if result.Duration > 3*time.Second {
+		t.Errorf("Expected command to stop on cancel, took %s", result.Duration)
+	}
+}
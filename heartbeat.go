@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// heartbeat tells the channel that a command which has shown no output
+// for a while is still running. One message is posted once the command
+// has been quiet for the heartbeat interval, edited as time passes and
+// deleted when the result is posted.
+type heartbeat struct {
+	api      *slackAPI
+	channel  string
+	threadTS string
+	text     string // command as shown
+	interval time.Duration
+	started  time.Time
+
+	mu         sync.Mutex
+	lastOutput time.Time
+	ts         string // the posted message, once there is one
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startHeartbeat starts watching a command, if heartbeats are enabled and
+// the command's output may be shown in its channel.
+func (s *server) startHeartbeat(ctx context.Context, cmd slashCommand) *heartbeat {
+	if s.cfg.HeartbeatInterval <= 0 || !s.liveAllowed(cmd) {
+		return nil
+	}
+	h := &heartbeat{
+		api:      s.slack,
+		channel:  cmd.ChannelID,
+		threadTS: cmd.ThreadTS,
+		text:     s.publicText(cmd),
+		interval: s.cfg.HeartbeatInterval,
+		started:  time.Now(),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	h.lastOutput = h.started
+	go h.run(context.WithoutCancel(ctx))
+	return h
+}
+
+// Write records that the command produced output, which is shown
+// elsewhere, as in a canvas, so no heartbeat is needed for a while.
+func (h *heartbeat) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	h.lastOutput = time.Now()
+	h.mu.Unlock()
+	return len(p), nil
+}
+
+func (h *heartbeat) run(ctx context.Context) {
+	defer close(h.done)
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.mu.Lock()
+			quiet := time.Since(h.lastOutput) >= h.interval
+			h.mu.Unlock()
+			if quiet {
+				h.beat(ctx)
+			}
+		case <-h.stop:
+			return
+		}
+	}
+}
+
+// beat posts the heartbeat message, or updates the one already posted.
+func (h *heartbeat) beat(ctx context.Context) {
+	elapsed := time.Since(h.started).Round(time.Second)
+	text := fmt.Sprintf("_still running… %s elapsed_ `%s`", elapsed, h.text)
+	params := url.Values{"channel": {h.channel}, "text": {text}}
+
+	h.mu.Lock()
+	ts := h.ts
+	h.mu.Unlock()
+	if ts != "" {
+		params.Set("ts", ts)
+		if err := h.api.call(ctx, "chat.update", params, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Error updating heartbeat: %v\n", err)
+		}
+		return
+	}
+
+	if h.threadTS != "" {
+		params.Set("thread_ts", h.threadTS)
+	}
+	var resp struct {
+		TS string `json:"ts"`
+	}
+	if err := h.api.call(ctx, "chat.postMessage", params, &resp); err != nil {
+		fmt.Fprintf(os.Stderr, "Error posting heartbeat: %v\n", err)
+		return
+	}
+	h.mu.Lock()
+	h.ts = resp.TS
+	h.mu.Unlock()
+}
+
+// close stops the heartbeat and deletes its message, which the result
+// replaces.
+func (h *heartbeat) close(ctx context.Context) {
+	if h == nil {
+		return
+	}
+	close(h.stop)
+	<-h.done
+	if h.ts == "" {
+		return
+	}
+	if err := h.api.call(ctx, "chat.delete", url.Values{"channel": {h.channel}, "ts": {h.ts}}, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error deleting heartbeat: %v\n", err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleCommand_HeartbeatForQuietCommand(t *testing.T) {
+	f := newFakeSlack(t)
+	f.respond("chat.postMessage", map[string]interface{}{"ts": "1700000000.000300"})
+	cfg := f.config()
+	cfg.HeartbeatInterval = 50 * time.Millisecond
+	s := newServer(cfg)
+
+	response := s.handleCommandExecution(context.Background(), slashCommand{Text: "$ sleep 0.3; echo done", UserID: "U1", ChannelID: "C1"})
+
+	if !strings.Contains(response["text"], "done") {
+		t.Errorf("Expected the result delivered as usual, got %q", response["text"])
+	}
+	posts := f.callsTo("chat.postMessage")
+	if len(posts) != 1 || !strings.Contains(posts[0].Params.Get("text"), "still running…") {
+		t.Fatalf("Expected one heartbeat message, got %v", posts)
+	}
+	if updates := f.callsTo("chat.update"); len(updates) == 0 || updates[0].Params.Get("ts") != "1700000000.000300" {
+		t.Errorf("Expected later heartbeats to edit the message, got %v", updates)
+	}
+	deletes := f.callsTo("chat.delete")
+	if len(deletes) != 1 || deletes[0].Params.Get("ts") != "1700000000.000300" {
+		t.Errorf("Expected the heartbeat deleted once the result is in, got %v", deletes)
+	}
+}
+
+func TestHandleCommand_HeartbeatSuppressed(t *testing.T) {
+	f := newFakeSlack(t)
+	cfg := f.config()
+	cfg.HeartbeatInterval = 50 * time.Millisecond
+	s := newServer(cfg)
+
+	for _, text := range []string{"$ --quiet sleep 0.2", "$ echo fast"} {
+		s.handleCommandExecution(context.Background(), slashCommand{Text: text, UserID: "U1", ChannelID: "C1"})
+	}
+
+	if posts := f.callsTo("chat.postMessage"); len(posts) != 0 {
+		t.Errorf("Expected no heartbeat with --quiet or for a fast command, got %v", posts)
+	}
+}
+
+func TestHeartbeat_OutputDefersBeat(t *testing.T) {
+	f := newFakeSlack(t)
+	cfg := f.config()
+	cfg.HeartbeatInterval = time.Hour
+	s := newServer(cfg)
+
+	h := s.startHeartbeat(context.Background(), slashCommand{Text: "$ tail -f log", ChannelID: "C1"})
+	h.lastOutput = time.Now().Add(-2 * time.Hour)
+	h.Write([]byte("line\n"))
+	if time.Since(h.lastOutput) > time.Minute {
+		t.Error("Expected output to reset the quiet time")
+	}
+	h.close(context.Background())
+	if calls := f.callsTo("chat.delete"); len(calls) != 0 {
+		t.Errorf("Expected nothing to delete before a beat, got %v", calls)
+	}
+}
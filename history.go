@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lengths of a history listing.
+const (
+	historyDefault = 10
+	historyMax     = 50
+)
+
+// recent returns the last n stored jobs that f selects and for which keep
+// returns true, oldest first.
+func (st *jobStore) recent(n int, f jobFilter, keep func(jobRecord) bool) ([]jobRecord, error) {
+	var jobs []jobRecord
+	err := st.scanNewest(f, func(r jobRecord) bool {
+		if keep(r) {
+			jobs = append(jobs, r)
+		}
+		return len(jobs) < n
+	})
+	slices.Reverse(jobs)
+	return jobs, err
+}
+
+// runHistory is the history builtin: $ history [n]. It lists the jobs run
+// in the channel that the user may see: their own, everyone's for admins,
+// and everyone's public jobs where the channel's profile shares history.
+func runHistory(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	n := historyDefault
+	if len(args) > 1 {
+		return commandResult{Lines: []string{"usage: history [n]"}, ExitCode: 2, Duration: time.Since(startTime)}
+	}
+	if len(args) == 1 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 || n > historyMax {
+			return commandResult{Lines: []string{fmt.Sprintf("history: n must be between 1 and %d", historyMax)}, ExitCode: 2, Duration: time.Since(startTime)}
+		}
+	}
+
+	v := s.viewerFor(cmd)
+	jobs, err := s.store.recent(n, jobFilter{ChannelID: cmd.ChannelID}, func(r jobRecord) bool {
+		return s.canView(v, r)
+	})
+	if err != nil {
+		return commandResult{Lines: []string{fmt.Sprintf("history: %v", err)}, ExitCode: 1, Duration: time.Since(startTime)}
+	}
+	if len(jobs) == 0 {
+		return commandResult{Lines: []string{"no history in this channel"}, Duration: time.Since(startTime)}
+	}
+	lines := make([]string, 0, len(jobs))
+	for _, j := range jobs {
+		lines = append(lines, fmt.Sprintf("%s  %s  <@%s>  %s  (%s)", j.ID, j.Started.Local().Format("01-02 15:04"), j.UserID, j.Text, translateExitCode(j.ExitCode)))
+	}
+	return commandResult{Lines: lines, Duration: time.Since(startTime)}
+}
+
+// expandHistory turns "!!", the user's last command in the channel, and
+// "!<job-id>", a stored job the user may see, into the command's text as
+// it was typed, meta-flags included. ok is false for other commands.
+func (s *server) expandHistory(cmd slashCommand) (text string, ok bool, err error) {
+	command := strings.TrimSpace(strings.TrimPrefix(cmd.Text, "$"))
+	if !strings.HasPrefix(command, "!") || strings.ContainsAny(command, " \t\n") || len(command) < 2 {
+		return "", false, nil
+	}
+	if s.store == nil {
+		return "", true, errors.New("re-running commands needs DATA_DIR")
+	}
+
+	var r jobRecord
+	if command == "!!" {
+		jobs, err := s.store.recent(1, jobFilter{ChannelID: cmd.ChannelID}, func(r jobRecord) bool {
+			return r.UserID == cmd.UserID
+		})
+		if err != nil {
+			return "", true, err
+		}
+		if len(jobs) == 0 {
+			return "", true, errors.New("no previous command in this channel")
+		}
+		r = jobs[0]
+	} else {
+		id := command[1:]
+		r, err = s.store.job(id)
+		if errors.Is(err, errJobNotStored) || (err == nil && r.UserID != cmd.UserID && !s.canView(s.viewerFor(cmd), r)) {
+			return "", true, fmt.Errorf("no job %s", id)
+		}
+		if err != nil {
+			return "", true, err
+		}
+	}
+
+	// Stored text may have been redacted, and must not be run as is.
+	if r.Redacted || strings.Contains(r.Text, redacted) {
+		return "", true, fmt.Errorf("job %s was redacted and cannot be re-run", r.ID)
+	}
+	return r.Text, true, nil
+}
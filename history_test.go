@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistory_Rerun(t *testing.T) {
+	s := newServer(config{DataDir: t.TempDir()})
+	ctx := context.Background()
+	in := func(user, channel, text string) string {
+		return s.handleCommandExecution(ctx, slashCommand{Text: text, UserID: user, ChannelID: channel})["text"]
+	}
+
+	if got := in("U1", "C1", "$ !!"); !strings.Contains(got, "no previous command in this channel") {
+		t.Errorf("Expected no previous command, got %q", got)
+	}
+	in("U1", "C1", "$ echo first")
+	in("U2", "C1", "$ echo other")
+	if got := in("U1", "C1", "$ !!"); !strings.Contains(got, "$ echo first\nfirst") {
+		t.Errorf("Expected the user's last command re-run, got %q", got)
+	}
+
+	jobs, err := s.store.since(time.Time{})
+	if err != nil || len(jobs) != 3 {
+		t.Fatalf("Expected three stored jobs, got %v, %v", jobs, err)
+	}
+	if jobs[2].Text != "$ echo first" {
+		t.Errorf("Expected the re-run stored as the command itself, got %q", jobs[2].Text)
+	}
+	other := jobs[1].ID
+	if got := in("U1", "C1", "$ !"+other); !strings.Contains(got, "no job "+other) {
+		t.Errorf("Expected another user's job not to be re-run, got %q", got)
+	}
+	if got := in("U2", "C1", "$ !"+other); !strings.Contains(got, "other\n") {
+		t.Errorf("Expected the user's own job re-run by ID, got %q", got)
+	}
+
+	if _, err := s.store.redact(other, "U2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := in("U2", "C1", "$ !"+other); !strings.Contains(got, "was redacted") {
+		t.Errorf("Expected a redacted job refused, got %q", got)
+	}
+}
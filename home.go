@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The App Home dashboard covers jobs from the last homeWindow and lists up
+// to homeRecent of them.
+const (
+	homeWindow = 24 * time.Hour
+	homeRecent = 10
+)
+
+// homeTab tracks who has opened the App Home, so their dashboards can be
+// refreshed when jobs start and finish.
+type homeTab struct {
+	mu      sync.Mutex
+	viewers map[string]bool
+
+	start   sync.Once
+	refresh chan struct{}
+}
+
+func newHomeTab() *homeTab {
+	return &homeTab{viewers: make(map[string]bool), refresh: make(chan struct{}, 1)}
+}
+
+// openHome publishes the dashboard for a user who opened the App Home and
+// keeps it up to date from then on.
+func (s *server) openHome(ctx context.Context, userID string) {
+	s.home.mu.Lock()
+	s.home.viewers[userID] = true
+	s.home.mu.Unlock()
+	s.home.start.Do(func() { go s.refreshHomes() })
+
+	s.publishHome(ctx, userID)
+}
+
+// homeChanged asks for every open dashboard to be refreshed. Changes that
+// arrive while a refresh is pending are folded into it.
+func (s *server) homeChanged() {
+	s.home.mu.Lock()
+	watched := len(s.home.viewers) > 0
+	s.home.mu.Unlock()
+	if !watched {
+		return
+	}
+	select {
+	case s.home.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// refreshHomes republishes the dashboards of everyone who has opened the
+// App Home whenever jobs change.
+func (s *server) refreshHomes() {
+	for range s.home.refresh {
+		s.home.mu.Lock()
+		viewers := make([]string, 0, len(s.home.viewers))
+		for userID := range s.home.viewers {
+			viewers = append(viewers, userID)
+		}
+		s.home.mu.Unlock()
+
+		for _, userID := range viewers {
+			s.publishHome(context.Background(), userID)
+		}
+	}
+}
+
+// publishHome renders a user's dashboard and publishes it with
+// views.publish.
+func (s *server) publishHome(ctx context.Context, userID string) {
+	view, err := json.Marshal(block{"type": "home", "blocks": s.homeBlocks(userID)})
+	if err != nil {
+		return
+	}
+	params := url.Values{"user_id": {userID}, "view": {string(view)}}
+	if err := s.slack.call(ctx, "views.publish", params, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error publishing App Home: %v\n", err)
+	}
+}
+
+// homeBlocks renders the dashboard: running commands, recent jobs and job
+// counts per user.
+func (s *server) homeBlocks(userID string) []block {
+	now := time.Now()
+	blocks := []block{{"type": "header", "text": plainText("Shell dashboard")}}
+
+	// The dashboard shows the jobs its viewer may see, as $ history does.
+	v := s.viewerFor(slashCommand{UserID: userID})
+	var running []*job
+	for _, j := range s.jobs.running() {
+		r := jobRecord{UserID: j.Cmd.UserID, ChannelID: j.Cmd.ChannelID, Private: s.cfg.SensitiveChannels[j.Cmd.ChannelID]}
+		if s.canView(v, r) {
+			running = append(running, j)
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "*Running* (%d)", len(running))
+	for _, j := range running {
+		fmt.Fprintf(&b, "\n<@%s> `%s` for %s", j.Cmd.UserID, s.publicText(j.Cmd), now.Sub(j.Started).Round(time.Second))
+	}
+	blocks = append(blocks, sectionBlock(b.String()))
+
+	if s.store == nil {
+		return blocks
+	}
+	jobs, err := s.store.since(now.Add(-homeWindow))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading jobs for App Home: %v\n", err)
+		return blocks
+	}
+	var visible []jobRecord
+	for _, j := range jobs {
+		if s.canView(v, j) {
+			visible = append(visible, j)
+		}
+	}
+
+	b.Reset()
+	b.WriteString("*Recent jobs*")
+	for i := len(visible) - 1; i >= 0 && i >= len(visible)-homeRecent; i-- {
+		j := visible[i]
+		status := "✅"
+		if j.ExitCode != 0 {
+			status = fmt.Sprintf("❌ exit %d", j.ExitCode)
+		}
+		text := "_private command_"
+		if !j.Private {
+			text = "`" + s.cfg.profileFor(j.ChannelID).echo(j.Text) + "`"
+		}
+		fmt.Fprintf(&b, "\n%s <@%s> %s (%s)", status, j.UserID, text, j.Duration.Round(time.Millisecond))
+	}
+	if len(visible) == 0 {
+		b.WriteString("\nNo jobs in the last 24 hours.")
+	}
+	blocks = append(blocks, block{"type": "divider"}, sectionBlock(b.String()))
+
+	type stats struct{ runs, failures int }
+	byUser := make(map[string]*stats)
+	for _, j := range jobs {
+		st := byUser[j.UserID]
+		if st == nil {
+			st = &stats{}
+			byUser[j.UserID] = st
+		}
+		st.runs++
+		if j.ExitCode != 0 {
+			st.failures++
+		}
+	}
+	users := make([]string, 0, len(byUser))
+	for user := range byUser {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(a, b int) bool {
+		if byUser[users[a]].runs != byUser[users[b]].runs {
+			return byUser[users[a]].runs > byUser[users[b]].runs
+		}
+		return users[a] < users[b]
+	})
+
+	b.Reset()
+	b.WriteString("*Users, last 24 hours*")
+	for _, user := range users {
+		st := byUser[user]
+		you := ""
+		if user == userID {
+			you = " (you)"
+		}
+		fmt.Fprintf(&b, "\n<@%s>%s: %d commands, %d failed", user, you, st.runs, st.failures)
+	}
+	return append(blocks, block{"type": "divider"}, sectionBlock(b.String()))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHome_PublishedOnOpenAndRefreshed(t *testing.T) {
+	f := newFakeSlack(t)
+	cfg := f.config()
+	cfg.DataDir = t.TempDir()
+	s := newServer(cfg)
+
+	s.handleCommandExecution(context.Background(), slashCommand{Text: "$ echo first", UserID: "U1", ChannelID: "C1"})
+
+	postEvent(t, s, `{"type": "event_callback", "event_id": "Ev1", "event": {"type": "app_home_opened", "tab": "home", "user": "U2"}}`)
+	calls := waitForCalls(t, f, "views.publish", 1)
+	if len(calls) != 1 || calls[0].Params.Get("user_id") != "U2" {
+		t.Fatalf("Expected the dashboard to be published for U2, got %v", calls)
+	}
+	view := calls[0].Params.Get("view")
+	for _, want := range []string{"*Running* (0)", "No jobs in the last 24 hours", "U1\\u003e: 1 commands, 0 failed"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("Expected %q in the dashboard, got %s", want, view)
+		}
+	}
+	if strings.Contains(view, "echo first") {
+		t.Errorf("Expected another user's command left out, got %s", view)
+	}
+
+	postEvent(t, s, `{"type": "event_callback", "event_id": "Ev2", "event": {"type": "app_home_opened", "tab": "home", "user": "U1"}}`)
+	calls = waitForCalls(t, f, "views.publish", 2)
+	if len(calls) != 2 || !strings.Contains(calls[1].Params.Get("view"), "`$ echo first`") {
+		t.Fatalf("Expected the user's own command in their dashboard, got %v", calls)
+	}
+
+	s.handleCommandExecution(context.Background(), slashCommand{Text: "$ false", UserID: "U2", ChannelID: "C1"})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var refreshed string
+		for _, c := range f.callsTo("views.publish")[2:] {
+			if c.Params.Get("user_id") == "U2" {
+				refreshed = c.Params.Get("view")
+			}
+		}
+		if strings.Contains(refreshed, "exit 1") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected U2's refreshed dashboard to show the new job, got %s", refreshed)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// luaHooks runs request and response transformations from a Lua script.
+// The script may define any of these global functions, each receiving a
+// request table with user, channel, team, text and command fields:
+//
+//	pre_policy(req)            -> new command, or nil
+//	pre_exec(req)              -> new command, or nil; or nil, "reason" to refuse
+//	post_exec(req, result)     -> new output, or nil; result has output and exit_code
+//	pre_delivery(req, message) -> table with text and/or response_type, or nil
+type luaHooks struct {
+	timeout time.Duration
+
+	mu sync.Mutex // lua.LState is not safe for concurrent use
+	L  *lua.LState
+}
+
+// Hook points.
+const (
+	hookPrePolicy   = "pre_policy"
+	hookPreExec     = "pre_exec"
+	hookPostExec    = "post_exec"
+	hookPreDelivery = "pre_delivery"
+)
+
+func loadLuaHooks(path string, timeout time.Duration) (*luaHooks, error) {
+	L := lua.NewState()
+	if err := L.DoFile(path); err != nil {
+		L.Close()
+		return nil, err
+	}
+	return &luaHooks{timeout: timeout, L: L}, nil
+}
+
+// call runs a hook function if the script defines it and returns its
+// results, which are nil when the hook is not defined.
+func (h *luaHooks) call(ctx context.Context, hook string, cmd slashCommand, command string, args ...lua.LValue) (lua.LValue, lua.LValue, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fn := h.L.GetGlobal(hook)
+	if fn.Type() != lua.LTFunction {
+		return lua.LNil, lua.LNil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	h.L.SetContext(ctx)
+	defer h.L.RemoveContext()
+
+	req := h.L.NewTable()
+	req.RawSetString("user", lua.LString(cmd.UserID))
+	req.RawSetString("channel", lua.LString(cmd.ChannelID))
+	req.RawSetString("team", lua.LString(cmd.TeamID))
+	req.RawSetString("text", lua.LString(cmd.Text))
+	req.RawSetString("command", lua.LString(command))
+
+	err := h.L.CallByParam(lua.P{Fn: fn, NRet: 2, Protect: true}, append([]lua.LValue{req}, args...)...)
+	if err != nil {
+		return lua.LNil, lua.LNil, fmt.Errorf("lua hook %s: %w", hook, err)
+	}
+	first, second := h.L.Get(-2), h.L.Get(-1)
+	h.L.Pop(2)
+	return first, second, nil
+}
+
+// rewrite runs a hook that may replace the command. A refusal reason is
+// returned when the hook returns nil and a string.
+func (h *luaHooks) rewrite(ctx context.Context, hook string, cmd slashCommand, command string) (string, string, error) {
+	ret, reason, err := h.call(ctx, hook, cmd, command)
+	if err != nil {
+		return command, "", err
+	}
+	if s, ok := ret.(lua.LString); ok {
+		return strings.TrimSpace(string(s)), "", nil
+	}
+	if s, ok := reason.(lua.LString); ok && ret == lua.LNil {
+		return command, string(s), nil
+	}
+	return command, "", nil
+}
+
+// postExec lets the script replace command output.
+func (h *luaHooks) postExec(ctx context.Context, cmd slashCommand, command string, result commandResult) (commandResult, error) {
+	h.mu.Lock()
+	t := h.L.NewTable()
+	h.mu.Unlock()
+	t.RawSetString("output", lua.LString(strings.Join(result.Lines, "\n")))
+	t.RawSetString("exit_code", lua.LNumber(result.ExitCode))
+
+	ret, _, err := h.call(ctx, hookPostExec, cmd, command, t)
+	if err != nil {
+		return result, err
+	}
+	if s, ok := ret.(lua.LString); ok {
+		result.Lines = cleanOutput(string(s))
+	}
+	return result, nil
+}
+
+// preDelivery lets the script change the text or response type of the
+// response to the slash command.
+func (h *luaHooks) preDelivery(ctx context.Context, cmd slashCommand, command string, message map[string]string) (map[string]string, error) {
+	h.mu.Lock()
+	t := h.L.NewTable()
+	h.mu.Unlock()
+	for k, v := range message {
+		t.RawSetString(k, lua.LString(v))
+	}
+
+	ret, _, err := h.call(ctx, hookPreDelivery, cmd, command, t)
+	if err != nil {
+		return message, err
+	}
+	out, ok := ret.(*lua.LTable)
+	if !ok {
+		return message, nil
+	}
+	for _, key := range []string{"text", "response_type"} {
+		if v, ok := out.RawGetString(key).(lua.LString); ok {
+			message[key] = string(v)
+		}
+	}
+	return message, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testHooks = `
+function pre_policy(req)
+	if req.command == "up" then
+		return "uptime"
+	end
+end
+
+function pre_exec(req)
+	if req.channel == "CLOCKED" then
+		return nil, "channel is locked"
+	end
+end
+
+function post_exec(req, result)
+	if result.exit_code ~= 0 then
+		return "failed: " .. result.output
+	end
+end
+
+function pre_delivery(req, message)
+	if req.user == "UQUIET" then
+		return {response_type = "ephemeral"}
+	end
+end
+
+function loop(req)
+	while true do end
+end
+`
+
+func hooksServer(t *testing.T) *server {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hooks.lua")
+	if err := os.WriteFile(path, []byte(testHooks), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	hooks, err := loadLuaHooks(path, time.Second)
+	if err != nil {
+		t.Fatalf("loadLuaHooks: %v", err)
+	}
+	s := newServer(config{})
+	s.hooks = hooks
+	return s
+}
+
+func TestLuaHooks_Rewrite(t *testing.T) {
+	s := hooksServer(t)
+
+	data := url.Values{}
+	data.Set("text", "$ up")
+	response := postCommand(t, s, data)
+
+	if !strings.Contains(response["text"], "load average") {
+		t.Errorf("Expected rewritten command to run, got %q", response["text"])
+	}
+}
+
+func TestLuaHooks_Refuse(t *testing.T) {
+	s := hooksServer(t)
+
+	data := url.Values{}
+	data.Set("text", "$ echo hi")
+	data.Set("channel_id", "CLOCKED")
+	response := postCommand(t, s, data)
+
+	if response["text"] != "_refused: channel is locked_ `HOOK_REFUSED`" {
+		t.Errorf("Expected refusal, got %q", response["text"])
+	}
+}
+
+func TestLuaHooks_PostExecAndDelivery(t *testing.T) {
+	s := hooksServer(t)
+
+	data := url.Values{}
+	data.Set("text", "$ echo broken; false")
+	data.Set("user_id", "UQUIET")
+	response := postCommand(t, s, data)
+
+	if !strings.Contains(response["text"], "failed: broken") {
+		t.Errorf("Expected post_exec to rewrite output, got %q", response["text"])
+	}
+	if response["response_type"] != "ephemeral" {
+		t.Errorf("Expected pre_delivery to route ephemerally, got %q", response["response_type"])
+	}
+}
+
+func TestLuaHooks_Timeout(t *testing.T) {
+	s := hooksServer(t)
+	s.hooks.timeout = 50 * time.Millisecond
+
+	if _, _, err := s.hooks.call(context.Background(), "loop", slashCommand{}, "x"); err == nil {
+		t.Error("Expected runaway hook to be stopped")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// hostAllowed reports whether a user may send commands to a host from the
+// profile's channels: some pattern of Hosts, or "@group" naming a group of
+// the inventory, must match the host and list the user, or "*" for anyone.
+func (p profile) hostAllowed(inv *inventory, host, userID string) bool {
+	for pattern, users := range p.Hosts {
+		if !slices.Contains(users, "*") && !slices.Contains(users, userID) {
+			continue
+		}
+		if group, ok := strings.CutPrefix(pattern, "@"); ok {
+			if slices.Contains(inv.groups()[group], host) {
+				return true
+			}
+		} else if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validHostPattern reports whether a pattern of a profile's hosts is well
+// formed.
+func validHostPattern(pattern string) bool {
+	_, err := path.Match(pattern, "")
+	return err == nil
+}
+
+// checkHost checks that a command may be sent to the host given with @ or
+// --host=: the channel's profile must allow it for the user, the host must
+// be in the inventory, if there is one, and its agent must be connected.
+// For a group of the inventory, the user must be allowed on each of its
+// hosts, which are returned. Unauthorized users are not told whether the
+// host exists.
+func (s *server) checkHost(cmd slashCommand, host string) ([]string, error) {
+	if s.agents == nil {
+		return nil, withCode(codeUnsupported, errors.New("commands can only be sent to other hosts when agents are accepted"))
+	}
+	if !agentNamePattern.MatchString(host) {
+		return nil, withCode(codeBadRequest, fmt.Errorf("invalid host name %q", host))
+	}
+	inv := s.cfg.Inventory
+	p := s.cfg.profileFor(cmd.ChannelID)
+	members, group := inv.groups()[host]
+	allowed := !group && p.hostAllowed(inv, host, cmd.UserID)
+	if group {
+		allowed = !slices.ContainsFunc(members, func(m string) bool { return !p.hostAllowed(inv, m, cmd.UserID) })
+	}
+	if !allowed {
+		reason := fmt.Sprintf("not allowed to run commands on %s from this channel", host)
+		s.auditRefusal(cmd, auditPolicyDenied, reason)
+		return nil, withCode(codePolicyDenied, errors.New(reason))
+	}
+	if group {
+		return members, nil
+	}
+	if !inv.hasHost(host) {
+		return nil, withCode(codeBadRequest, fmt.Errorf("unknown host %s: it is not in the inventory", host))
+	}
+	if agent := inv.agentOf(host); s.agents.get(agent) == nil {
+		if inv != nil {
+			return nil, withCode(codeBadRequest, fmt.Errorf("%s is unreachable: its agent %s is not connected", host, agent))
+		}
+		return nil, withCode(codeBadRequest, fmt.Errorf("unknown host %s: no agent of that name is connected", host))
+	}
+	return nil, nil
+}
+
+// hostHeader shows the host a command ran on in front of its text, in
+// place of the @host or --host= that chose it, e.g. "[web01] $ uptime".
+func hostHeader(text, host string) string {
+	for _, target := range []string{"@" + host, "--host=" + host} {
+		if i := strings.Index(text, target+" "); i >= 0 {
+			text = text[:i] + text[i+len(target)+1:]
+			break
+		}
+	}
+	return "[" + host + "] " + text
+}
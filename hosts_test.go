@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func hostServer(cfg config) *server {
+	cfg.AgentToken = "agent-secret"
+	cfg.Profiles = []profile{{Name: "default", Hosts: map[string][]string{"web*": {"U1"}, "db01": {"*"}}}}
+	return newServer(cfg)
+}
+
+func TestHandleCommand_HostTargeting(t *testing.T) {
+	var targeted string
+	s := hostServer(config{OPAURL: fakeOPA(t, func(in policyInput) interface{} {
+		targeted = in.TargetHost
+		return "allow"
+	}).URL})
+	startAgent(t, s, "web01")
+
+	tests := []struct {
+		user, text, want string
+	}{
+		{"U1", "$ @web01 echo hello", "```[web01] $ echo hello\nhello```"},
+		{"U1", "$ --host=web01 echo hello", "```[web01] $ echo hello\nhello```"},
+		{"U2", "$ @web01 echo hello", "_not allowed to run commands on web01 from this channel (POLICY_DENIED)_"},
+		{"U1", "$ @web09 echo hello", "_unknown host web09: no agent of that name is connected (BAD_REQUEST)_"},
+		{"U2", "$ @web09 echo hello", "_not allowed to run commands on web09 from this channel (POLICY_DENIED)_"},
+		{"U2", "$ @db01 echo hello", "_unknown host db01: no agent of that name is connected (BAD_REQUEST)_"},
+	}
+	for _, tt := range tests {
+		targeted = ""
+		data := url.Values{}
+		data.Set("user_id", tt.user)
+		data.Set("text", tt.text)
+		if response := postCommand(t, s, data); !strings.HasPrefix(response["text"], tt.want) {
+			t.Errorf("%s %q: expected %q, got %q", tt.user, tt.text, tt.want, response["text"])
+		} else if strings.HasPrefix(tt.want, "```") && targeted != "web01" {
+			t.Errorf("%s %q: expected the policy to see the target host, got %q", tt.user, tt.text, targeted)
+		}
+	}
+}
+
+func TestHandleCommand_HostTargetingWithoutAgents(t *testing.T) {
+	s := newServer(config{})
+	data := url.Values{}
+	data.Set("text", "$ @web01 uptime")
+	if response := postCommand(t, s, data); !strings.Contains(response["text"], "`UNSUPPORTED`") {
+		t.Errorf("Expected host targeting refused without agents, got %q", response["text"])
+	}
+}
+
+func TestHostHeader(t *testing.T) {
+	tests := []struct{ text, want string }{
+		{"$ @web01 uptime", "[web01] $ uptime"},
+		{"$ --pty --host=web01 top", "[web01] $ --pty top"},
+		{"$ uptime …", "[web01] $ uptime …"},
+	}
+	for _, tt := range tests {
+		if got := hostHeader(tt.text, "web01"); got != tt.want {
+			t.Errorf("hostHeader(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestLoadProfiles_InvalidHostPattern(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	if err := os.WriteFile(path, []byte(`[{"name": "x", "hosts": {"web[": ["*"]}}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadProfiles(path); err == nil || !strings.Contains(err.Error(), "invalid hosts pattern") {
+		t.Errorf("Expected error for a malformed pattern, got %v", err)
+	}
+}
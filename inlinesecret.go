@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Actions taken when a command has a secret typed into it.
+const (
+	inlineSecretWarn  = "warn"
+	inlineSecretBlock = "block"
+	inlineSecretOff   = "off"
+)
+
+// auditInlineSecret is the audit action for commands with a secret typed
+// into them.
+const auditInlineSecret = "inline_secret"
+
+// inlineSecretRules find secrets typed into a command. The value is the
+// rule's first group.
+var inlineSecretRules = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	{"password in a URL", regexp.MustCompile(`\b[A-Za-z][A-Za-z0-9+.-]*://[^\s/:@]+:([^\s/@]+)@`)},
+	{"token in a header", regexp.MustCompile(`(?i)\b(?:authorization:\s*(?:bearer|basic|token)|x-api-key:|private-token:)\s*([^\s'"]+)`)},
+	{"password option", regexp.MustCompile(`(?i)\s--(?:password|passwd|token|api-key|secret)[= ]([^\s'"]+)`)},
+}
+
+// inlineSecret is a secret found in a command.
+type inlineSecret struct {
+	Kind  string
+	Value string
+}
+
+// detectInlineSecrets returns the secrets typed into a command. Values
+// that are variable references, such as $PGPASSWORD, are what users
+// should write instead and are not reported.
+func detectInlineSecrets(command string) []inlineSecret {
+	var found []inlineSecret
+	for _, rule := range inlineSecretRules {
+		for _, m := range rule.re.FindAllStringSubmatch(command, -1) {
+			if !strings.HasPrefix(m[1], "$") {
+				found = append(found, inlineSecret{rule.name, m[1]})
+			}
+		}
+	}
+	for _, p := range leakPatterns {
+		for _, v := range p.re.FindAllString(command, -1) {
+			found = append(found, inlineSecret{p.name, v})
+		}
+	}
+	return found
+}
+
+// hashSecret identifies a secret in logs without revealing it, so the
+// same value can be recognized across events.
+func hashSecret(v string) string {
+	sum := sha256.Sum256([]byte(v))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// maskSecrets replaces the secrets in a command with their hashes.
+func maskSecrets(command string, secrets []inlineSecret) string {
+	for _, sec := range secrets {
+		command = strings.ReplaceAll(command, sec.Value, "["+hashSecret(sec.Value)+"]")
+	}
+	return command
+}
+
+// auditInlineSecrets records a command's secrets by kind and hash. The
+// command is logged with the secrets masked.
+func (s *server) auditInlineSecrets(cmd slashCommand, command string, secrets []inlineSecret, blocked bool) {
+	details := make([]string, len(secrets))
+	for i, sec := range secrets {
+		details[i] = sec.Kind + " " + hashSecret(sec.Value)
+	}
+	detail := strings.Join(details, ", ")
+	if blocked {
+		detail = "blocked: " + detail
+	}
+	s.auditLog.record(auditEvent{
+		Action:    auditInlineSecret,
+		UserID:    cmd.UserID,
+		ChannelID: cmd.ChannelID,
+		TeamID:    cmd.TeamID,
+		Command:   maskSecrets(command, secrets),
+		Detail:    detail,
+	})
+}
+
+// inlineSecretKinds lists the kinds of secrets found, once each.
+func inlineSecretKinds(secrets []inlineSecret) string {
+	var kinds []string
+	for _, sec := range secrets {
+		if !contains(kinds, sec.Kind) {
+			kinds = append(kinds, sec.Kind)
+		}
+	}
+	return strings.Join(kinds, ", ")
+}
+
+// inlineSecretAdvice is shown with a warning or refusal.
+const inlineSecretAdvice = "reference the secret from the environment instead of typing it, such as `$PGPASSWORD` or `-H \"Authorization: Bearer $API_TOKEN\"`"
+
+// inlineSecretFooter warns below a command's output that it contained a
+// secret.
+func inlineSecretFooter(secrets []inlineSecret) string {
+	if len(secrets) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n_:warning: the command contains a secret (%s); %s_", inlineSecretKinds(secrets), inlineSecretAdvice)
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The sha256, stat and head builtins inspect files in Go, so paths need no
+// shell quoting and reads are limited to INSPECT_PATHS.
+
+// headMaxBytes caps how much of a file the head builtin reads.
+const headMaxBytes = 64 << 10
+
+// errPathNotAllowed is returned for paths outside the configured
+// InspectPaths, and for every path when none are configured.
+var errPathNotAllowed = errors.New("path not allowed")
+
+// inspectPath resolves a path, following symlinks, and checks that it is
+// within one of the configured InspectPaths. Without InspectPaths no path
+// is allowed.
+func (s *server) inspectPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", err
+	}
+	for _, dir := range s.cfg.InspectPaths {
+		if d, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = d
+		}
+		if rel, err := filepath.Rel(dir, resolved); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("%s: %w", path, errPathNotAllowed)
+}
+
+// openInspected opens a regular file allowed by the path policy.
+func (s *server) openInspected(path string) (*os.File, os.FileInfo, error) {
+	resolved, err := s.inspectPath(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(resolved)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if !info.Mode().IsRegular() {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s: not a regular file", path)
+	}
+	return f, info, nil
+}
+
+func runSHA256(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	if len(args) == 0 {
+		return commandResult{Lines: []string{"usage: sha256 <path>..."}, ExitCode: 2, Duration: time.Since(startTime)}
+	}
+
+	var lines []string
+	exitCode := 0
+	for _, path := range args {
+		sum, err := s.hashFile(ctx, path)
+		if err != nil {
+			lines = append(lines, "sha256: "+err.Error())
+			exitCode = 1
+			continue
+		}
+		lines = append(lines, sum+"  "+path)
+	}
+	return commandResult{Lines: lines, ExitCode: exitCode, Duration: time.Since(startTime)}
+}
+
+// hashFile returns the hex SHA-256 of a file. Hashing stops when ctx is
+// canceled, as by the command timeout.
+func (s *server) hashFile(ctx context.Context, path string) (string, error) {
+	f, _, err := s.openInspected(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	buf := make([]byte, 1<<20)
+	for {
+		if err := ctx.Err(); err != nil {
+			return "", fmt.Errorf("%s: %w", path, err)
+		}
+		n, err := f.Read(buf)
+		h.Write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func runStat(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	if len(args) == 0 {
+		return commandResult{Lines: []string{"usage: stat <path>..."}, ExitCode: 2, Duration: time.Since(startTime)}
+	}
+
+	var lines []string
+	exitCode := 0
+	for i, path := range args {
+		if i > 0 {
+			lines = append(lines, "")
+		}
+		info, err := s.statPath(path)
+		if err != nil {
+			lines = append(lines, "stat: "+err.Error())
+			exitCode = 1
+			continue
+		}
+		lines = append(lines, info...)
+	}
+	return commandResult{Lines: lines, ExitCode: exitCode, Duration: time.Since(startTime)}
+}
+
+// statPath describes a file without following a final symlink, so links
+// are reported as such.
+func (s *server) statPath(path string) ([]string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	// The directory holding the file must be allowed; the file itself may
+	// be a link pointing anywhere.
+	dir, err := s.inspectPath(filepath.Dir(abs))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, errPathNotAllowed)
+	}
+	info, err := os.Lstat(filepath.Join(dir, filepath.Base(abs)))
+	if err != nil {
+		return nil, err
+	}
+
+	kind := "regular file"
+	switch mode := info.Mode(); {
+	case mode.IsDir():
+		kind = "directory"
+	case mode&os.ModeSymlink != 0:
+		kind = "symbolic link"
+		if target, err := os.Readlink(filepath.Join(dir, info.Name())); err == nil {
+			kind += " to " + target
+		}
+	case mode&os.ModeNamedPipe != 0:
+		kind = "named pipe"
+	case mode&os.ModeSocket != 0:
+		kind = "socket"
+	case mode&os.ModeDevice != 0:
+		kind = "device"
+	}
+
+	lines := []string{
+		"  File: " + path,
+		"  Type: " + kind,
+		fmt.Sprintf("  Size: %d (%s)", info.Size(), formatBytes(info.Size())),
+		fmt.Sprintf("  Mode: %04o (%s)", info.Mode().Perm(), info.Mode()),
+	}
+	if uid, gid, ok := fileOwner(info); ok {
+		lines = append(lines, fmt.Sprintf(" Owner: uid %d, gid %d", uid, gid))
+	}
+	lines = append(lines, "Modify: "+info.ModTime().Format(time.RFC3339))
+	return lines, nil
+}
+
+func runHead(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	if !claimsHead(args) {
+		return commandResult{Lines: []string{"usage: head -c <size> <path>"}, ExitCode: 2, Duration: time.Since(startTime)}
+	}
+	n, err := parseSize(args[1])
+	if err != nil || n <= 0 {
+		return commandResult{Lines: []string{fmt.Sprintf("head: bad size %q", args[1])}, ExitCode: 2, Duration: time.Since(startTime)}
+	}
+	if n > headMaxBytes {
+		return commandResult{Lines: []string{fmt.Sprintf("head: at most %s can be read", formatBytes(headMaxBytes))}, ExitCode: 2, Duration: time.Since(startTime)}
+	}
+
+	f, _, err := s.openInspected(args[2])
+	if err != nil {
+		return commandResult{Lines: []string{"head: " + err.Error()}, ExitCode: 1, Duration: time.Since(startTime)}
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, n))
+	if err != nil {
+		return commandResult{Lines: []string{"head: " + err.Error()}, ExitCode: 1, Duration: time.Since(startTime)}
+	}
+	if isBinary(data) {
+		return commandResult{Binary: data, Duration: time.Since(startTime)}
+	}
+	return commandResult{Lines: cleanOutput(string(data)), Duration: time.Since(startTime)}
+}
+
+// claimsHead limits the head builtin to "head -c <size> <path>"; other
+// uses of head go to the shell.
+func claimsHead(args []string) bool {
+	return len(args) == 3 && args[0] == "-c" && plainArgs(args)
+}
+
+// claimsStat leaves stat with options, such as stat -c %s, to the shell.
+func claimsStat(args []string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			return false
+		}
+	}
+	return plainArgs(args)
+}
+
+// plainArgs reports whether no argument uses shell syntax, such as pipes,
+// globs or quotes, that a builtin would not understand.
+func plainArgs(args []string) bool {
+	for _, arg := range args {
+		if strings.ContainsAny(arg, "|&;<>()$`\\\"'*?[]{}~") {
+			return false
+		}
+	}
+	return true
+}
+
+// parseSize reads a byte count with an optional k, m or g suffix (powers
+// of 1024), as in "1k".
+func parseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, errors.New("empty size")
+	}
+	mult := int64(1)
+	switch strings.ToLower(s[len(s)-1:]) {
+	case "k":
+		mult = 1 << 10
+	case "m":
+		mult = 1 << 20
+	case "g":
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n * mult, err
+}
+
+// formatBytes renders a size in the largest binary unit, e.g. "1.5 MiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
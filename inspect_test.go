@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunSHA256(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hello.txt")
+	os.WriteFile(path, []byte("hello\n"), 0o600)
+	s := newServer(config{InspectPaths: []string{dir}})
+
+	result := runSHA256(context.Background(), s, slashCommand{}, []string{path})
+
+	want := "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03  " + path
+	if result.ExitCode != 0 || len(result.Lines) != 1 || result.Lines[0] != want {
+		t.Errorf("Expected %q, got %q", want, result.Lines)
+	}
+}
+
+func TestInspectPath_Policy(t *testing.T) {
+	allowed := t.TempDir()
+	outside := t.TempDir()
+	secret := filepath.Join(outside, "secret")
+	os.WriteFile(secret, []byte("x"), 0o600)
+	link := filepath.Join(allowed, "link")
+	os.Symlink(secret, link)
+	s := newServer(config{InspectPaths: []string{allowed}})
+
+	for _, path := range []string{secret, link, filepath.Join(allowed, "..", filepath.Base(outside), "secret")} {
+		result := runSHA256(context.Background(), s, slashCommand{}, []string{path})
+		if result.ExitCode == 0 || !strings.Contains(result.Lines[0], "path not allowed") {
+			t.Errorf("%s: expected the path refused, got %q", path, result.Lines)
+		}
+	}
+
+	// stat describes the link itself, which lies in an allowed directory.
+	result := runStat(context.Background(), s, slashCommand{}, []string{link})
+	if result.ExitCode != 0 || !strings.Contains(strings.Join(result.Lines, "\n"), "Type: symbolic link to "+secret) {
+		t.Errorf("Expected the link described, got %q", result.Lines)
+	}
+}
+
+func TestInspectPath_NoneConfigured(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hello.txt")
+	os.WriteFile(path, []byte("hello\n"), 0o600)
+	s := newServer(config{})
+
+	for _, run := range []func(context.Context, *server, slashCommand, []string) commandResult{runSHA256, runStat} {
+		result := run(context.Background(), s, slashCommand{}, []string{path})
+		if result.ExitCode == 0 || !strings.Contains(result.Lines[0], "path not allowed") {
+			t.Errorf("Expected every path refused without INSPECT_PATHS, got %q", result.Lines)
+		}
+	}
+}
+
+func TestRunHead(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.txt")
+	os.WriteFile(path, []byte(strings.Repeat("abcdefghij", 200)), 0o600)
+	s := newServer(config{InspectPaths: []string{dir}})
+
+	result := runHead(context.Background(), s, slashCommand{}, []string{"-c", "1k", path})
+	if len(result.Lines) != 1 || len(result.Lines[0]) != 1024 {
+		t.Errorf("Expected 1024 bytes, got %q", result.Lines)
+	}
+
+	result = runHead(context.Background(), s, slashCommand{}, []string{"-c", "1m", path})
+	if result.ExitCode != 2 {
+		t.Errorf("Expected reads over 64k refused, got %q", result.Lines)
+	}
+}
+
+func TestLookupBuiltin_ShellFormsOfHeadAndStat(t *testing.T) {
+	s := newServer(config{})
+	for _, command := range []string{"head -n 5 /etc/hosts", "stat -c %s /etc/hosts", "stat /etc/*", "head -c 10 /etc/hosts | xxd"} {
+		if _, _, ok := s.lookupBuiltin(command); ok {
+			t.Errorf("%q: expected to be left to the shell", command)
+		}
+	}
+	for _, command := range []string{"head -c 1k /etc/hosts", "stat /etc/hosts"} {
+		if _, _, ok := s.lookupBuiltin(command); !ok {
+			t.Errorf("%q: expected the builtin", command)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// Action IDs of interactive elements.
+const (
+	actionStop  = "stop"
+	actionRerun = "rerun"
+)
+
+// maxButtonValue is the longest value Slack accepts for a button.
+const maxButtonValue = 2000
+
+// interactionPayload holds the fields of a Slack interactivity payload
+// used by the server.
+type interactionPayload struct {
+	Type       string `json:"type"`
+	CallbackID string `json:"callback_id"`
+	TriggerID  string `json:"trigger_id"`
+	User       struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Team struct {
+		ID string `json:"id"`
+	} `json:"team"`
+	Channel struct {
+		ID string `json:"id"`
+	} `json:"channel"`
+	Message struct {
+		Text     string `json:"text"`
+		TS       string `json:"ts"`
+		ThreadTS string `json:"thread_ts"`
+	} `json:"message"`
+	View struct {
+		Type            string `json:"type"`
+		CallbackID      string `json:"callback_id"`
+		PrivateMetadata string `json:"private_metadata"`
+		State           struct {
+			Values map[string]map[string]struct {
+				Value                string `json:"value"`
+				SelectedConversation string `json:"selected_conversation"`
+				SelectedOption       struct {
+					Value string `json:"value"`
+				} `json:"selected_option"`
+			} `json:"values"`
+		} `json:"state"`
+	} `json:"view"`
+	WorkflowStep workflowStep `json:"workflow_step"`
+	ResponseURL  string       `json:"response_url"`
+	Actions      []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+}
+
+// handleInteraction receives button clicks, shortcuts and modal
+// submissions. Slack sends the payload as JSON in the "payload" form field,
+// signed like slash commands.
+func (s *server) handleInteraction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.verifyRequest(w, r) {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	var p interactionPayload
+	if err := json.Unmarshal([]byte(r.FormValue("payload")), &p); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	switch p.Type {
+	case "message_action":
+		if p.CallbackID == callbackRunMessage {
+			s.runMessage(r.Context(), p)
+		}
+	case "workflow_step_edit":
+		if p.CallbackID == callbackWorkflowStep {
+			s.editWorkflowStep(r.Context(), p)
+		}
+	case "view_submission":
+		switch {
+		case p.View.CallbackID == callbackConfirm:
+			s.confirmCommand(p.User.ID, p.View.PrivateMetadata)
+		case p.View.CallbackID == callbackTemplateParams:
+			if errs := s.submitTemplate(p); len(errs) > 0 {
+				// Invalid values are shown in the modal, which stays open.
+				writeJSON(w, map[string]interface{}{"response_action": "errors", "errors": errs})
+				return
+			}
+		case p.View.Type == "workflow_step" && p.View.CallbackID == callbackWorkflowStep:
+			s.saveWorkflowStep(r.Context(), p)
+		}
+	case "block_actions":
+		for _, action := range p.Actions {
+			var message map[string]string
+			switch action.ActionID {
+			case actionStop:
+				message = s.stopJob(p.User.ID, action.Value)
+			case actionKeepWaiting:
+				message = s.keepWaiting(p.User.ID, action.Value)
+			case actionApprove, actionDeny:
+				message = s.decideApproval(p, action.Value, action.ActionID == actionApprove)
+			case actionCreateTemplate:
+				message = s.createTemplate(r.Context(), p, action.Value)
+			case actionRerun:
+				// Running may take longer than Slack waits for the
+				// acknowledgement, so the result is posted later.
+				go s.rerun(p, action.Value)
+				continue
+			default:
+				continue
+			}
+			if p.ResponseURL == "" {
+				continue
+			}
+			if err := postWebhook(r.Context(), s.client, p.ResponseURL, message); err != nil {
+				fmt.Fprintf(os.Stderr, "Error responding to action: %v\n", err)
+			}
+		}
+	}
+
+	// Responses to actions are posted to response_url; an empty 200
+	// acknowledges the payload and closes a submitted modal.
+	w.WriteHeader(http.StatusOK)
+}
+
+// stopJob stops a job for the user who clicked its Stop button and returns
+// the message that replaces the button.
+func (s *server) stopJob(userID, jobID string) map[string]string {
+	j, err := s.jobs.stop(jobID, userID)
+	if err != nil {
+		return map[string]string{
+			"response_type":    "ephemeral",
+			"replace_original": "false",
+			"text":             fmt.Sprintf("_cannot stop: %v_", err),
+		}
+	}
+	return map[string]string{
+		"replace_original": "true",
+		"text":             fmt.Sprintf("_stopped by <@%s>_ `%s`", userID, s.displayText(j.Cmd)),
+	}
+}
+
+// rerun runs a command again as the user who clicked its Re-run button,
+// in the same channel and thread, and posts the result to response_url.
+// The command goes through detection and policy for that user.
+func (s *server) rerun(p interactionPayload, text string) {
+	cmd := slashCommand{
+		Text:        text,
+		UserID:      p.User.ID,
+		ChannelID:   p.Channel.ID,
+		TeamID:      p.Team.ID,
+		ResponseURL: p.ResponseURL,
+		ThreadTS:    p.Message.ThreadTS,
+	}
+
+	ctx := context.Background()
+	message := s.respond(ctx, cmd)
+	if p.ResponseURL == "" {
+		return
+	}
+	if err := postWebhook(ctx, s.client, p.ResponseURL, message); err != nil {
+		fmt.Fprintf(os.Stderr, "Error posting re-run result: %v\n", err)
+	}
+}
+
+// withRerun adds a Re-run button to the response of a command that ran.
+// Commands that did not run are answered ephemerally and get no button, nor
+// do commands whose text would be redacted or masked or has a secret typed
+// into it, since the button carries the text.
+func (s *server) withRerun(cmd slashCommand, message map[string]string) interface{} {
+	if !s.cfg.Interactivity || cmd.DryRun || message["response_type"] != "in_channel" {
+		return message
+	}
+	if len(cmd.Text) > maxButtonValue || s.publicText(cmd) != cmd.Text || len(detectInlineSecrets(cmd.Text)) > 0 {
+		return message
+	}
+
+	// Blocks would replace the text, which may be longer than a section
+	// allows, so the button goes in an attachment below it.
+	withButton := make(map[string]interface{}, len(message)+1)
+	for k, v := range message {
+		withButton[k] = v
+	}
+	withButton["attachments"] = []block{{
+		"blocks": []block{actionsBlock(button(actionRerun, "Re-run", cmd.Text, ""))},
+	}}
+	return withButton
+}
+
+// postRunning tells the invoker that a job has started and offers a Stop
+// button while it runs.
+func (s *server) postRunning(ctx context.Context, j *job) {
+	text := fmt.Sprintf("_running_ `%s`", s.displayText(j.Cmd))
+	message := map[string]interface{}{
+		"response_type": "ephemeral",
+		"text":          text,
+		"blocks": []block{
+			sectionBlock(text),
+			actionsBlock(button(actionStop, "Stop", j.ID, "danger")),
+		},
+	}
+	if err := postWebhook(ctx, s.client, j.Cmd.ResponseURL, message); err != nil {
+		fmt.Fprintf(os.Stderr, "Error posting running message: %v\n", err)
+	}
+}
+
+// displayText returns the command text as it may be shown in the channel.
+func (s *server) displayText(cmd slashCommand) string {
+	text := maskSecrets(cmd.Text, cmd.Secrets)
+	if s.cfg.profileFor(cmd.ChannelID).Classification.rules().Redact {
+		return redactLine(text)
+	}
+	return text
+}
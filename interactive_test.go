@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// messageRecorder starts a server that passes every message posted to it
+// to the returned channel.
+func messageRecorder(t *testing.T) (*httptest.Server, chan map[string]interface{}) {
+	t.Helper()
+
+	messages := make(chan map[string]interface{}, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			t.Errorf("Failed to decode message: %v", err)
+		}
+		messages <- message
+	}))
+	t.Cleanup(ts.Close)
+	return ts, messages
+}
+
+// clickButton posts a block_actions payload for a button click.
+func clickButton(t *testing.T, s *server, userID, actionID, value, responseURL string) int {
+	t.Helper()
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"type":         "block_actions",
+		"user":         map[string]string{"id": userID},
+		"response_url": responseURL,
+		"actions":      []map[string]string{{"action_id": actionID, "value": value}},
+	})
+	body := url.Values{"payload": {string(payload)}}.Encode()
+	req := httptest.NewRequest("POST", "/slack/interactive", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.routes().ServeHTTP(w, req)
+	return w.Code
+}
+
+// buttonValue returns the value of the first button in a message.
+func buttonValue(t *testing.T, message map[string]interface{}, actionID string) string {
+	t.Helper()
+
+	blocks, _ := message["blocks"].([]interface{})
+	for _, b := range blocks {
+		elements, _ := b.(map[string]interface{})["elements"].([]interface{})
+		for _, e := range elements {
+			if e := e.(map[string]interface{}); e["action_id"] == actionID {
+				return e["value"].(string)
+			}
+		}
+	}
+	t.Fatalf("No %s button in %v", actionID, message)
+	return ""
+}
+
+func TestStopButton_StopsJob(t *testing.T) {
+	ts, messages := messageRecorder(t)
+	s := newServer(config{Interactivity: true})
+
+	done := make(chan map[string]string)
+	go func() {
+		done <- s.handleCommandExecution(context.Background(), slashCommand{Text: "$ sleep 5", UserID: "U1", ResponseURL: ts.URL})
+	}()
+
+	jobID := buttonValue(t, <-messages, actionStop)
+
+	if code := clickButton(t, s, "U2", actionStop, jobID, ts.URL); code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	if text := (<-messages)["text"].(string); !strings.Contains(text, errNotJobOwner.Error()) {
+		t.Errorf("Expected other users to be refused, got %q", text)
+	}
+
+	start := time.Now()
+	clickButton(t, s, "U1", actionStop, jobID, ts.URL)
+	if message := <-messages; message["replace_original"] != "true" || !strings.Contains(message["text"].(string), "stopped by <@U1>") {
+		t.Errorf("Expected running message to be replaced, got %v", message)
+	}
+
+	select {
+	case response := <-done:
+		if !strings.Contains(response["text"], "terminated") {
+			t.Errorf("Expected terminated status, got %q", response["text"])
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Job still running %s after Stop", time.Since(start))
+	}
+
+	clickButton(t, s, "U1", actionStop, jobID, ts.URL)
+	if text := (<-messages)["text"].(string); !strings.Contains(text, errJobNotFound.Error()) {
+		t.Errorf("Expected finished job to be reported, got %q", text)
+	}
+}
+
+func TestHandleInteraction_RequiresSignature(t *testing.T) {
+	s := newServer(config{SigningSecret: "secret", SignatureMaxAge: 5 * time.Minute})
+
+	if code := clickButton(t, s, "U1", actionStop, "x", ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", code)
+	}
+
+	payload := url.Values{"payload": {`{"type":"block_actions","user":{"id":"U1"}}`}}.Encode()
+	w := httptest.NewRecorder()
+	s.handleInteraction(w, signedRequest("secret", time.Now(), payload))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+}
+
+func TestRerunButton_RunsAsClickingUser(t *testing.T) {
+	ts, messages := messageRecorder(t)
+	opa := fakeOPA(t, func(in policyInput) interface{} {
+		if in.User == "U2" {
+			return map[string]string{"decision": "deny", "reason": "read only"}
+		}
+		return "allow"
+	})
+	s := newServer(config{Interactivity: true, OPAURL: opa.URL})
+
+	data := url.Values{"text": {"$ echo again"}, "user_id": {"U1"}, "channel_id": {"C1"}}
+	req := httptest.NewRequest("POST", "/", strings.NewReader(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.handleCommand(w, req)
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse JSON response: %v", err)
+	}
+	attachments, _ := response["attachments"].([]interface{})
+	if len(attachments) != 1 {
+		t.Fatalf("Expected one attachment, got %v", response)
+	}
+	value := buttonValue(t, attachments[0].(map[string]interface{}), actionRerun)
+	if value != "$ echo again" {
+		t.Fatalf("Expected button to carry the command, got %q", value)
+	}
+
+	clickButton(t, s, "U1", actionRerun, value, ts.URL)
+	<-messages // running
+	message := <-messages
+	if message["response_type"] != "in_channel" || !strings.Contains(message["text"].(string), "again\n") {
+		t.Errorf("Expected re-run output in channel, got %v", message)
+	}
+
+	clickButton(t, s, "U2", actionRerun, value, ts.URL)
+	message = <-messages
+	if message["response_type"] != "ephemeral" || message["text"] != "_denied: read only_ `POLICY_DENIED`" {
+		t.Errorf("Expected re-run to be denied for U2, got %v", message)
+	}
+}
+
+func TestWithRerun_SkipsRedactedCommands(t *testing.T) {
+	s := newServer(config{
+		Interactivity: true,
+		Profiles:      []profile{{Name: "default", Classification: classInternal}},
+	})
+	message := map[string]string{"response_type": "in_channel", "text": "x"}
+
+	if _, ok := s.withRerun(slashCommand{Text: "$ echo PASSWORD=hunter2"}, message).(map[string]string); !ok {
+		t.Error("Expected no button for a command with a secret")
+	}
+	if _, ok := s.withRerun(slashCommand{Text: "$ date"}, message).(map[string]string); ok {
+		t.Error("Expected a button for a plain command")
+	}
+}
+
+// nextResult returns the next message posted in the channel, skipping the
+// ephemeral running messages.
+func nextResult(t *testing.T, messages chan map[string]interface{}) map[string]interface{} {
+	t.Helper()
+
+	for {
+		select {
+		case m := <-messages:
+			if m["response_type"] == "in_channel" {
+				return m
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("No result posted")
+			return nil
+		}
+	}
+}
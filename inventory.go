@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// inventory is the hosts commands may be sent to and the groups they
+// belong to, from the YAML file named by INVENTORY_FILE:
+//
+//	hosts:
+//	  web01: {address: 10.0.1.11, description: frontend}
+//	  web02: {address: 10.0.1.12, agent: web02.prod}
+//	  db01:  {address: 10.0.2.21, user: postgres, port: 5432}
+//	groups:
+//	  web: [web01, web02]
+//	  db: [db01]
+//
+// Profiles name hosts from it in "agent" and "hosts", and groups in
+// "hosts" as "@web".
+type inventory struct {
+	Hosts  map[string]inventoryHost `yaml:"hosts"`
+	Groups map[string][]string      `yaml:"groups"`
+}
+
+// inventoryHost is one host of the inventory.
+type inventoryHost struct {
+	// Agent is the agent that runs the host's commands, the host's own
+	// name by default.
+	Agent string `yaml:"agent"`
+
+	// Address, Port and User say how the host is reached, and Description
+	// what it is for. They are shown by $ hosts.
+	Address     string `yaml:"address"`
+	Port        int    `yaml:"port"`
+	User        string `yaml:"user"`
+	Description string `yaml:"description"`
+}
+
+func loadInventory(path string) (*inventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var inv inventory
+	if err := yaml.Unmarshal(data, &inv); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	for name, h := range inv.Hosts {
+		if !agentNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid host name %q", name)
+		}
+		if h.Agent != "" && !agentNamePattern.MatchString(h.Agent) {
+			return nil, fmt.Errorf("host %q: invalid agent name %q", name, h.Agent)
+		}
+		if h.Port < 0 || h.Port > 65535 {
+			return nil, fmt.Errorf("host %q: invalid port %d", name, h.Port)
+		}
+	}
+	for name, members := range inv.Groups {
+		if !agentNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid group name %q", name)
+		}
+		if _, ok := inv.Hosts[name]; ok {
+			return nil, fmt.Errorf("group %q: a host has the same name", name)
+		}
+		if len(members) == 0 {
+			return nil, fmt.Errorf("group %q: no hosts", name)
+		}
+		for _, host := range members {
+			if _, ok := inv.Hosts[host]; !ok {
+				return nil, fmt.Errorf("group %q: unknown host %q", name, host)
+			}
+		}
+	}
+	return &inv, nil
+}
+
+// agentOf returns the agent that runs a host's commands: the one the
+// inventory gives for it, or else the agent of the same name.
+func (inv *inventory) agentOf(host string) string {
+	if inv == nil {
+		return host
+	}
+	if h, ok := inv.Hosts[host]; ok && h.Agent != "" {
+		return h.Agent
+	}
+	return host
+}
+
+// hasHost reports whether a host may be targeted. Without an inventory
+// any connected agent may.
+func (inv *inventory) hasHost(host string) bool {
+	if inv == nil {
+		return true
+	}
+	_, ok := inv.Hosts[host]
+	return ok
+}
+
+// hostNames returns the names of the inventory's hosts, sorted.
+func (inv *inventory) hostNames() []string {
+	if inv == nil {
+		return nil
+	}
+	var names []string
+	for name := range inv.Hosts {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// groups returns the inventory's groups by name.
+func (inv *inventory) groups() map[string][]string {
+	if inv == nil {
+		return nil
+	}
+	return inv.Groups
+}
+
+// groupsOf returns the groups a host belongs to, sorted.
+func (inv *inventory) groupsOf(host string) []string {
+	var groups []string
+	for name, members := range inv.groups() {
+		if slices.Contains(members, host) {
+			groups = append(groups, name)
+		}
+	}
+	slices.Sort(groups)
+	return groups
+}
+
+// runHosts is the hosts builtin. It lists the inventory's hosts, with
+// their groups, how they are reached and whether their agent is
+// connected, then the groups.
+func runHosts(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	inv := s.cfg.Inventory
+	if len(args) > 0 {
+		return commandResult{Lines: []string{"usage: hosts"}, ExitCode: 2, Duration: time.Since(startTime)}
+	}
+
+	names := inv.hostNames()
+	width := 0
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+	lines := []string{"Hosts:"}
+	for _, name := range names {
+		h := inv.Hosts[name]
+		var details []string
+		if groups := inv.groupsOf(name); len(groups) > 0 {
+			details = append(details, "groups "+strings.Join(groups, ", "))
+		}
+		if address := h.address(); address != "" {
+			details = append(details, address)
+		}
+		state := "not connected"
+		if s.agents != nil && s.agents.get(inv.agentOf(name)) != nil {
+			state = "connected"
+		}
+		if agent := inv.agentOf(name); agent != name {
+			state = "agent " + agent + " " + state
+		}
+		details = append(details, state)
+		line := fmt.Sprintf("  %-*s  %s", width, name, strings.Join(details, "; "))
+		if h.Description != "" {
+			line += " (" + h.Description + ")"
+		}
+		lines = append(lines, line)
+	}
+	if len(inv.Groups) > 0 {
+		var groups []string
+		for name, members := range inv.Groups {
+			members = slices.Clone(members)
+			slices.Sort(members)
+			groups = append(groups, fmt.Sprintf("  %s: %s", name, strings.Join(members, ", ")))
+		}
+		slices.Sort(groups)
+		lines = append(append(lines, "Groups:"), groups...)
+	}
+	return commandResult{Lines: lines, Duration: time.Since(startTime)}
+}
+
+// address returns how a host is reached, e.g. "postgres@10.0.2.21:5432".
+func (h inventoryHost) address() string {
+	address := h.Address
+	if address == "" {
+		return ""
+	}
+	if h.Port != 0 {
+		address = fmt.Sprintf("%s:%d", address, h.Port)
+	}
+	if h.User != "" {
+		address = h.User + "@" + address
+	}
+	return address
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testInventory = `
+hosts:
+  web01: {address: 10.0.1.11, description: frontend}
+  web02: {address: 10.0.1.12, agent: web02.prod}
+  db01: {address: 10.0.2.21, user: postgres, port: 5432}
+groups:
+  web: [web02, web01]
+  db: [db01]
+`
+
+func writeInventory(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "inventory.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadInventory(t *testing.T) {
+	inv, err := loadInventory(writeInventory(t, testInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := inv.agentOf("web02"); got != "web02.prod" {
+		t.Errorf("Expected web02's agent, got %q", got)
+	}
+	if got := inv.agentOf("web01"); got != "web01" {
+		t.Errorf("Expected hosts to default to the agent of their name, got %q", got)
+	}
+	if got := inv.groupsOf("web01"); len(got) != 1 || got[0] != "web" {
+		t.Errorf("Expected web01 in group web, got %v", got)
+	}
+
+	tests := []struct{ data, want string }{
+		{"hosts: {web/01: {}}", `invalid host name "web/01"`},
+		{"hosts: {web01: {port: 70000}}", "invalid port 70000"},
+		{"hosts: {web01: {}}\ngroups: {web: [web02]}", `unknown host "web02"`},
+		{"hosts: {web01: {}}\ngroups: {web01: [web01]}", "a host has the same name"},
+		{"hosts: {web01: {}}\ngroups: {web: []}", "no hosts"},
+		{"hosts: [web01]", "parsing"},
+	}
+	for _, tt := range tests {
+		if _, err := loadInventory(writeInventory(t, tt.data)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: expected error containing %q, got %v", tt.data, tt.want, err)
+		}
+	}
+}
+
+func TestLoadConfig_InventoryGroups(t *testing.T) {
+	profiles := filepath.Join(t.TempDir(), "profiles.json")
+	if err := os.WriteFile(profiles, []byte(`[{"name": "default", "hosts": {"@cache": ["*"]}}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PROFILES_FILE", profiles)
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "requires INVENTORY_FILE") {
+		t.Errorf("Expected groups to need an inventory, got %v", err)
+	}
+	t.Setenv("INVENTORY_FILE", writeInventory(t, testInventory))
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "no such group") {
+		t.Errorf("Expected an unknown group refused, got %v", err)
+	}
+}
+
+func TestHandleCommand_InventoryTargeting(t *testing.T) {
+	inv, err := loadInventory(writeInventory(t, testInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer(config{
+		AgentToken: "agent-secret",
+		Inventory:  inv,
+		Profiles:   []profile{{Name: "default", Hosts: map[string][]string{"@web": {"U1"}, "db*": {"U1"}, "cache01": {"U1"}}}},
+	})
+	startAgent(t, s, "web02.prod")
+
+	tests := []struct{ text, want string }{
+		{"$ @web02 echo hello", "```[web02] $ echo hello\nhello```"},
+		{"$ @web01 echo hello", "_web01 is unreachable"},
+		{"$ @db01 echo hello", "_db01 is unreachable"},
+		{"$ @cache01 echo hello", "_unknown host cache01: it is not in the inventory"},
+		{"$ @db echo hello", "_no agent of the hosts of db is connected"},
+	}
+	for _, tt := range tests {
+		data := url.Values{}
+		data.Set("user_id", "U1")
+		data.Set("text", tt.text)
+		if response := postCommand(t, s, data); !strings.HasPrefix(response["text"], tt.want) {
+			t.Errorf("%q: expected %q, got %q", tt.text, tt.want, response["text"])
+		}
+	}
+}
+
+func TestHosts(t *testing.T) {
+	inv, err := loadInventory(writeInventory(t, testInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer(config{AgentToken: "agent-secret", Inventory: inv})
+	startAgent(t, s, "web01")
+
+	result := runHosts(context.Background(), s, slashCommand{}, nil)
+	want := []string{
+		"Hosts:",
+		"  db01   groups db; postgres@10.0.2.21:5432; not connected",
+		"  web01  groups web; 10.0.1.11; connected (frontend)",
+		"  web02  groups web; 10.0.1.12; agent web02.prod not connected",
+		"Groups:",
+		"  db: db01",
+		"  web: web01, web02",
+	}
+	if got := strings.Join(result.Lines, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("Expected:\n%s\ngot:\n%s", strings.Join(want, "\n"), got)
+	}
+
+	if _, _, ok := newServer(config{}).lookupBuiltin("hosts"); ok {
+		t.Error("Expected no hosts builtin without an inventory")
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// redactedText replaces the command of a redacted job.
+const redactedText = "[redacted]"
+
+// redactMessageWindow is how long after a job finished its messages are
+// looked for, to cover results posted late, such as after a soft timeout.
+const redactMessageWindow = 10 * time.Minute
+
+// redact removes a stored job's command and output. The file is rewritten
+// through a temporary file, so the output is gone from disk and not just
+// hidden.
+func (st *jobFile) redact(id, by string) (jobRecord, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	in, err := os.Open(st.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return jobRecord{}, errJobNotStored
+	}
+	if err != nil {
+		return jobRecord{}, err
+	}
+	defer in.Close()
+
+	tmp := st.path + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return jobRecord{}, err
+	}
+	defer os.Remove(tmp)
+
+	var found *jobRecord
+	w := bufio.NewWriter(out)
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var r jobRecord
+		if err := json.Unmarshal(line, &r); err == nil && r.ID == id {
+			r.Text, r.Lines = redactedText, nil
+			r.Redacted, r.RedactedBy = true, by
+			if line, err = json.Marshal(r); err != nil {
+				out.Close()
+				return jobRecord{}, err
+			}
+			found = &r
+		}
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		out.Close()
+		return jobRecord{}, err
+	}
+	if err := w.Flush(); err != nil {
+		out.Close()
+		return jobRecord{}, err
+	}
+	if err := out.Close(); err != nil {
+		return jobRecord{}, err
+	}
+	if found == nil {
+		return jobRecord{}, errJobNotStored
+	}
+	return *found, os.Rename(tmp, st.path)
+}
+
+// runRedact is the redact builtin: $ redact <job-id>. The job's user or an
+// admin can replace the Slack messages that showed a job's output with a
+// note and remove its command and output from the store, for output that
+// should never have been shown, such as a printed secret.
+func runRedact(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	fail := func(code int, msg string) commandResult {
+		return commandResult{Lines: []string{msg}, ExitCode: code, Duration: time.Since(startTime)}
+	}
+	if len(args) != 1 {
+		return fail(2, "usage: redact <job-id>")
+	}
+
+	j, err := s.store.job(args[0])
+	if errors.Is(err, errJobNotStored) || err == nil && j.UserID != cmd.UserID && !s.cfg.Admins[cmd.UserID] {
+		// Other users' jobs are reported like missing ones.
+		return fail(1, "no job "+args[0])
+	}
+	if err != nil {
+		return fail(1, fmt.Sprintf("reading job %s: %v", args[0], err))
+	}
+	if j.Redacted {
+		return fail(1, fmt.Sprintf("job %s was already redacted by <@%s>", j.ID, j.RedactedBy))
+	}
+
+	lines := []string{}
+	if s.slack != nil && j.ChannelID != "" {
+		n, err := s.redactMessages(ctx, j, cmd.UserID)
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("could not edit the job's messages: %v", err))
+		} else {
+			lines = append(lines, fmt.Sprintf("replaced %d messages", n))
+		}
+	}
+	if _, err := s.store.redact(j.ID, cmd.UserID); err != nil {
+		return fail(1, fmt.Sprintf("redacting job %s: %v", j.ID, err))
+	}
+	if s.archive != nil {
+		if err := s.archive.remove(ctx, j.ID); err != nil && !errors.Is(err, os.ErrNotExist) {
+			lines = append(lines, fmt.Sprintf("could not remove the archived output: %v", err))
+		}
+	}
+	s.auditLog.record(auditEvent{
+		Action:    "job_redacted",
+		UserID:    cmd.UserID,
+		ChannelID: j.ChannelID,
+		TeamID:    j.TeamID,
+		Detail:    "job " + j.ID + " of " + j.UserID,
+	})
+	lines = append(lines, fmt.Sprintf("redacted the stored transcript of job %s", j.ID))
+	return commandResult{Lines: lines, Duration: time.Since(startTime)}
+}
+
+// redactMessages replaces the bot's messages that mention a job's command,
+// posted in its channel or thread while it ran and shortly after, with a
+// note saying who redacted it. It returns how many it replaced.
+func (s *server) redactMessages(ctx context.Context, j jobRecord, by string) (int, error) {
+	var who struct {
+		BotID string `json:"bot_id"`
+	}
+	if err := s.slack.call(ctx, "auth.test", url.Values{}, &who); err != nil {
+		return 0, err
+	}
+
+	params := url.Values{
+		"channel": {j.ChannelID},
+		"oldest":  {slackTS(j.Started.Add(-time.Second))},
+		"latest":  {slackTS(j.Started.Add(j.Duration + redactMessageWindow))},
+		"limit":   {"200"},
+	}
+	method := "conversations.history"
+	if j.ThreadTS != "" {
+		method = "conversations.replies"
+		params.Set("ts", j.ThreadTS)
+	}
+	var history struct {
+		Messages []struct {
+			TS    string `json:"ts"`
+			BotID string `json:"bot_id"`
+			Text  string `json:"text"`
+		} `json:"messages"`
+	}
+	if err := s.slack.call(ctx, method, params, &history); err != nil {
+		return 0, err
+	}
+
+	note := fmt.Sprintf("_output redacted by <@%s>_", by)
+	n := 0
+	for _, m := range history.Messages {
+		if m.BotID == "" || m.BotID != who.BotID || !strings.Contains(m.Text, j.Text) {
+			continue
+		}
+		update := url.Values{"channel": {j.ChannelID}, "ts": {m.TS}, "text": {note}, "blocks": {"[]"}}
+		if err := s.slack.call(ctx, "chat.update", update, nil); err != nil {
+			// A message that cannot be edited can still be deleted.
+			if err := s.slack.call(ctx, "chat.delete", url.Values{"channel": {j.ChannelID}, "ts": {m.TS}}, nil); err != nil {
+				return n, err
+			}
+		}
+		n++
+	}
+	return n, nil
+}
+
+// slackTS formats a time as a Slack message timestamp.
+func slackTS(t time.Time) string {
+	return fmt.Sprintf("%d.%06d", t.Unix(), t.Nanosecond()/1000)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedact(t *testing.T) {
+	f := newFakeSlack(t)
+	f.respond("auth.test", map[string]interface{}{"bot_id": "B1"})
+	f.respond("conversations.history", map[string]interface{}{"messages": []map[string]string{
+		{"ts": "1.1", "bot_id": "B1", "text": "```$ echo hunter2\nhunter2```"},
+		{"ts": "1.2", "bot_id": "B2", "text": "```$ echo hunter2\nhunter2```"},
+		{"ts": "1.3", "user": "U1", "text": "oops"},
+		{"ts": "1.4", "bot_id": "B1", "text": "```$ uptime```"},
+	}})
+	cfg := f.config()
+	cfg.DataDir = t.TempDir()
+	s := newServer(cfg)
+	ctx := context.Background()
+
+	s.handleCommandExecution(ctx, slashCommand{Text: "$ echo hunter2", UserID: "U1", ChannelID: "C1"})
+	jobs, err := s.store.since(time.Time{})
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("Expected one stored job, got %v, %v", jobs, err)
+	}
+	id := jobs[0].ID
+
+	if got := s.handleCommandExecution(ctx, slashCommand{Text: "$ redact " + id, UserID: "U2", ChannelID: "C1"})["text"]; !strings.Contains(got, "no job "+id) {
+		t.Errorf("Expected other users not to redact the job, got %q", got)
+	}
+
+	got := s.handleCommandExecution(ctx, slashCommand{Text: "$ redact " + id, UserID: "U1", ChannelID: "C1"})["text"]
+	if !strings.Contains(got, "replaced 1 messages") || !strings.Contains(got, "redacted the stored transcript of job "+id) {
+		t.Fatalf("Expected the job redacted, got %q", got)
+	}
+	history := f.callsTo("conversations.history")
+	if len(history) != 1 || history[0].Params.Get("channel") != "C1" {
+		t.Errorf("Expected the channel's history read, got %v", history)
+	}
+	updates := f.callsTo("chat.update")
+	if len(updates) != 1 || updates[0].Params.Get("ts") != "1.1" || !strings.Contains(updates[0].Params.Get("text"), "redacted by <@U1>") {
+		t.Errorf("Expected only the bot's message with the output replaced, got %v", updates)
+	}
+
+	r, err := s.store.job(id)
+	if err != nil || !r.Redacted || r.RedactedBy != "U1" || r.Text != redactedText || len(r.Lines) != 0 {
+		t.Errorf("Expected the stored job redacted, got %+v, %v", r, err)
+	}
+	if file := dataDirContaining(t, cfg.DataDir, "hunter2"); file != "" {
+		t.Errorf("Expected the output gone from disk, found it in %s", file)
+	}
+
+	if got := s.handleCommandExecution(ctx, slashCommand{Text: "$ redact " + id, UserID: "U1", ChannelID: "C1"})["text"]; !strings.Contains(got, "already redacted by <@U1>") {
+		t.Errorf("Expected a second redaction refused, got %q", got)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Reasons a job cannot be stopped.
+var (
+	errJobNotFound = errors.New("job is not running")
+	errNotJobOwner = errors.New("only the user who started the job can stop it")
+)
+
+// job is a running command.
+type job struct {
+	ID      string
+	Cmd     slashCommand
+	Command string
+	Started time.Time
+
+	// Severity is the classifier's verdict on the command.
+	Severity string
+
+	// Leaks are the kinds of secrets found in the job's output, if the
+	// leak response is enabled.
+	Leaks []string
+
+	// Archived is set once the job's full output is in the output
+	// archive.
+	Archived bool
+
+	// watchdog, if set, watches the job for a lack of output.
+	watchdog *watchdog
+
+	cancel context.CancelFunc
+}
+
+// jobRegistry tracks running commands so they can be stopped.
+type jobRegistry struct {
+	mu   sync.Mutex
+	jobs map[string]*job
+
+	// changed, if set, is called after a job starts or finishes.
+	changed func()
+}
+
+func newJobRegistry() *jobRegistry {
+	return &jobRegistry{jobs: make(map[string]*job)}
+}
+
+// start registers a job for command. The returned context is canceled
+// when the job is stopped; finish must be called when the command is done.
+func (r *jobRegistry) start(ctx context.Context, cmd slashCommand, command string) (context.Context, *job) {
+	ctx, cancel := context.WithCancel(ctx)
+	j := &job{
+		ID:      randomToken()[:12],
+		Cmd:     cmd,
+		Command: command,
+		Started: time.Now(),
+		cancel:  cancel,
+	}
+
+	r.mu.Lock()
+	r.jobs[j.ID] = j
+	r.mu.Unlock()
+	if r.changed != nil {
+		r.changed()
+	}
+	return ctx, j
+}
+
+// finish removes a job from the registry.
+func (r *jobRegistry) finish(j *job) {
+	r.mu.Lock()
+	delete(r.jobs, j.ID)
+	r.mu.Unlock()
+	j.cancel()
+	if r.changed != nil {
+		r.changed()
+	}
+}
+
+// running returns the running jobs, oldest first.
+func (r *jobRegistry) running() []*job {
+	r.mu.Lock()
+	jobs := make([]*job, 0, len(r.jobs))
+	for _, j := range r.jobs {
+		jobs = append(jobs, j)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].Started.Before(jobs[b].Started) })
+	return jobs
+}
+
+// get returns a running job on behalf of userID.
+func (r *jobRegistry) get(id, userID string) (*job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	j, ok := r.jobs[id]
+	if !ok {
+		return nil, errJobNotFound
+	}
+	if j.Cmd.UserID != userID {
+		return nil, errNotJobOwner
+	}
+	return j, nil
+}
+
+// stop cancels a running job on behalf of userID.
+func (r *jobRegistry) stop(id, userID string) (*job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	j, ok := r.jobs[id]
+	if !ok {
+		return nil, errJobNotFound
+	}
+	if j.Cmd.UserID != userID {
+		return nil, errNotJobOwner
+	}
+	j.cancel()
+	return j, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// leaderCheckInterval is how often a server checks that it still holds
+// the scheduler lock, or tries to take it.
+const leaderCheckInterval = 10 * time.Second
+
+// schedulerLockKey is the Postgres advisory lock key of the scheduler,
+// shared by all servers using the same database.
+const schedulerLockKey = 0x68747470_7368656c // "httpshel"
+
+// leaderLock is a lock that at most one server holds at a time, and that
+// is released if its holder goes away.
+type leaderLock interface {
+	// tryLock takes the lock if it is free and reports whether it did.
+	tryLock(ctx context.Context) (bool, error)
+	// held returns an error once the lock may have been lost.
+	held(ctx context.Context) error
+	// release gives the lock up.
+	release()
+}
+
+// leaderElection runs the scheduler on one server of several sharing a
+// store. The server holding the lock leads; the others check every
+// leaderCheckInterval and take over once it is released, such as when the
+// leader stops or loses its database connection.
+type leaderElection struct {
+	lock     leaderLock
+	interval time.Duration
+
+	mu      sync.Mutex // serializes checks
+	leading atomic.Bool
+}
+
+func newLeaderElection(lock leaderLock) *leaderElection {
+	return &leaderElection{lock: lock, interval: leaderCheckInterval}
+}
+
+// isLeader reports whether this server leads. A nil election, for stores
+// only one server uses, always leads.
+func (l *leaderElection) isLeader() bool {
+	return l == nil || l.leading.Load()
+}
+
+// run checks the lock until ctx is canceled, then releases it.
+func (l *leaderElection) run(ctx context.Context) {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+	for {
+		l.check(ctx)
+		select {
+		case <-ctx.Done():
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if l.leading.Swap(false) {
+				l.lock.release()
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check confirms that the leader still holds the lock, or tries to take
+// it if this server does not lead.
+func (l *leaderElection) check(ctx context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.leading.Load() {
+		if err := l.lock.held(ctx); err != nil {
+			l.leading.Store(false)
+			l.lock.release()
+			fmt.Fprintf(os.Stderr, "Lost the scheduler lock: %v\n", err)
+		}
+		return
+	}
+	ok, err := l.lock.tryLock(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error taking the scheduler lock: %v\n", err)
+		return
+	}
+	if ok {
+		l.leading.Store(true)
+		fmt.Println("Running the scheduler: this server holds the scheduler lock")
+	}
+}
+
+// pgAdvisoryLock is a session-level Postgres advisory lock. It is held on
+// one connection, so Postgres releases it if the connection drops.
+type pgAdvisoryLock struct {
+	db   *sql.DB
+	key  int64
+	conn *sql.Conn // set while held
+}
+
+func (p *pgAdvisoryLock) tryLock(ctx context.Context) (bool, error) {
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	var ok bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", p.key).Scan(&ok); err != nil || !ok {
+		conn.Close()
+		return false, err
+	}
+	p.conn = conn
+	return true, nil
+}
+
+func (p *pgAdvisoryLock) held(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, leaderCheckInterval/2)
+	defer cancel()
+	return p.conn.PingContext(ctx)
+}
+
+func (p *pgAdvisoryLock) release() {
+	if p.conn == nil {
+		return
+	}
+	p.conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", p.key)
+	p.conn.Close()
+	p.conn = nil
+}
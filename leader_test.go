@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLock is a lock shared by the fakeLockHandles of several servers.
+type fakeLock struct {
+	mu     sync.Mutex
+	holder *fakeLockHandle
+}
+
+type fakeLockHandle struct {
+	lock *fakeLock
+	lost bool // the holder's connection dropped
+}
+
+func (h *fakeLockHandle) tryLock(ctx context.Context) (bool, error) {
+	h.lock.mu.Lock()
+	defer h.lock.mu.Unlock()
+	if h.lock.holder != nil {
+		return false, nil
+	}
+	h.lock.holder = h
+	return true, nil
+}
+
+func (h *fakeLockHandle) held(ctx context.Context) error {
+	if h.lost {
+		return errors.New("connection lost")
+	}
+	return nil
+}
+
+func (h *fakeLockHandle) release() {
+	h.lock.mu.Lock()
+	defer h.lock.mu.Unlock()
+	if h.lock.holder == h {
+		h.lock.holder = nil
+	}
+}
+
+func TestLeaderElection_Failover(t *testing.T) {
+	lock := &fakeLock{}
+	a, b := &fakeLockHandle{lock: lock}, &fakeLockHandle{lock: lock}
+	first, second := newLeaderElection(a), newLeaderElection(b)
+	ctx := context.Background()
+
+	first.check(ctx)
+	second.check(ctx)
+	if !first.isLeader() || second.isLeader() {
+		t.Fatalf("Expected only the first server to lead, got %v and %v", first.isLeader(), second.isLeader())
+	}
+	first.check(ctx)
+	second.check(ctx)
+	if !first.isLeader() || second.isLeader() {
+		t.Fatal("Expected the leader to keep the lock")
+	}
+
+	a.lost = true
+	first.check(ctx)
+	if first.isLeader() {
+		t.Fatal("Expected the leader to step down once the lock may be lost")
+	}
+	second.check(ctx)
+	if !second.isLeader() {
+		t.Error("Expected the second server to take over")
+	}
+}
+
+func TestLeaderElection_ReleasesOnStop(t *testing.T) {
+	lock := &fakeLock{}
+	l := newLeaderElection(&fakeLockHandle{lock: lock})
+	l.interval = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		l.run(ctx)
+		close(done)
+	}()
+	for !l.isLeader() {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+	if l.isLeader() || lock.holder != nil {
+		t.Error("Expected the lock released when the election stops")
+	}
+}
+
+func TestRunDueSchedules_OnlyOnLeader(t *testing.T) {
+	f := newFakeSlack(t)
+	cfg := f.config()
+	cfg.DataDir = t.TempDir()
+	s := newServer(cfg)
+	s.schedules.add(scheduledCommand{ID: "s1", Cron: "* * * * *", Command: "echo tick", ChannelID: "C1", UserID: "U1"})
+
+	lock := &fakeLock{holder: &fakeLockHandle{}}
+	s.leader = newLeaderElection(&fakeLockHandle{lock: lock})
+	s.leader.check(context.Background())
+	s.runDueSchedules(context.Background(), time.Now())
+	time.Sleep(200 * time.Millisecond)
+	if calls := f.callsTo("chat.postMessage"); len(calls) != 0 {
+		t.Fatalf("Expected a standby server not to run schedules, got %v", calls)
+	}
+
+	lock.holder = nil
+	s.leader.check(context.Background())
+	s.runDueSchedules(context.Background(), time.Now())
+	if calls := waitForCalls(t, f, "chat.postMessage", 1); len(calls) != 1 {
+		t.Errorf("Expected the leader to run the schedule, got %d results", len(calls))
+	}
+}
+
+func TestPgAdvisoryLock(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	open := func() *pgAdvisoryLock {
+		db, err := openSQLStore("pgx", url, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.db.Close() })
+		return &pgAdvisoryLock{db: db.db, key: schedulerLockKey}
+	}
+	first, second := open(), open()
+	ctx := context.Background()
+
+	if ok, err := first.tryLock(ctx); err != nil || !ok {
+		t.Fatalf("Expected the first server to take the lock, got %v, %v", ok, err)
+	}
+	if ok, err := second.tryLock(ctx); err != nil || ok {
+		t.Fatalf("Expected the lock taken, got %v, %v", ok, err)
+	}
+	if err := first.held(ctx); err != nil {
+		t.Errorf("Expected the lock held, got %v", err)
+	}
+	first.release()
+	if ok, err := second.tryLock(ctx); err != nil || !ok {
+		t.Errorf("Expected the second server to take the released lock, got %v, %v", ok, err)
+	}
+	second.release()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// auditSecretLeak is the audit action for output withheld because it
+// contained a secret.
+const auditSecretLeak = "secret_leak"
+
+// respondToLeak handles a job whose output contains a high-confidence
+// secret: the output is replaced with a notice before it reaches Slack,
+// and the security channel is alerted. The stored transcript has already
+// been quarantined by recordJob.
+func (s *server) respondToLeak(ctx context.Context, j *job, result commandResult) commandResult {
+	kinds := strings.Join(j.Leaks, ", ")
+	s.auditLog.record(auditEvent{
+		Action:    auditSecretLeak,
+		UserID:    j.Cmd.UserID,
+		ChannelID: j.Cmd.ChannelID,
+		TeamID:    j.Cmd.TeamID,
+		Command:   redactLine(s.displayText(j.Cmd)),
+		Detail:    j.ID + ": " + kinds,
+	})
+	s.alertLeak(ctx, j, kinds, result)
+
+	return commandResult{
+		Lines: []string{
+			fmt.Sprintf("[output withheld: it contained a secret (%s)]", kinds),
+			"The transcript has been quarantined and security notified. Rotate the secret.",
+		},
+		ExitCode: result.ExitCode,
+		Duration: result.Duration,
+	}
+}
+
+// alertLeak posts the job's metadata, never its output, to
+// SECURITY_CHANNEL or, without a channel or token, SECURITY_WEBHOOK_URL.
+func (s *server) alertLeak(ctx context.Context, j *job, kinds string, result commandResult) {
+	fmt.Fprintf(os.Stderr, "Secret leak in job %s (%s): user=%s channel=%s\n", j.ID, kinds, j.Cmd.UserID, j.Cmd.ChannelID)
+
+	text := fmt.Sprintf(":rotating_light: Secret in output withheld: %s\n"+
+		"*Job:* %s\n*User:* <@%s> (%s)\n*Channel:* <#%s> (%s)\n*Team:* %s\n*Started:* %s\n*Exit code:* %d\n```%s```",
+		kinds, j.ID, j.Cmd.UserID, j.Cmd.UserID, j.Cmd.ChannelID, j.Cmd.ChannelID, j.Cmd.TeamID,
+		j.Started.UTC().Format("2006-01-02 15:04:05 MST"), result.ExitCode, redactLine(s.displayText(j.Cmd)))
+
+	var err error
+	switch {
+	case s.cfg.SecurityChannel != "" && s.slack != nil:
+		err = s.slack.call(ctx, "chat.postMessage", url.Values{"channel": {s.cfg.SecurityChannel}, "text": {text}}, nil)
+	case s.cfg.SecurityWebhookURL != "":
+		err = postWebhook(ctx, s.client, s.cfg.SecurityWebhookURL, map[string]string{"text": text})
+	default:
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error posting secret leak alert: %v\n", err)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cgroupPeriod is the period, in microseconds, over which a command's CPU
+// time is capped.
+const cgroupPeriod = 100000
+
+// commandLimits caps the memory and CPU of each command run on the
+// server's host by starting it in a cgroup of its own, created beneath a
+// cgroup v2 directory delegated to the server and removed when the command
+// ends.
+type commandLimits struct {
+	parent string
+	memory int64   // bytes, 0 for no cap
+	cpu    float64 // CPUs, 0 for no cap
+}
+
+// newCommandLimits checks that the server can create cgroups with the
+// needed controllers beneath parent, enabling them for its children.
+func newCommandLimits(parent string, memory int64, cpu float64) (*commandLimits, error) {
+	if !cgroupsSupported {
+		return nil, errors.New("cgroups are only supported on Linux")
+	}
+	data, err := os.ReadFile(filepath.Join(parent, "cgroup.controllers"))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a cgroup v2 directory: %w", parent, err)
+	}
+	available := strings.Fields(string(data))
+	var enable []string
+	if memory > 0 {
+		enable = append(enable, "memory")
+	}
+	if cpu > 0 {
+		enable = append(enable, "cpu")
+	}
+	for _, c := range enable {
+		if !slices.Contains(available, c) {
+			return nil, fmt.Errorf("the %s controller is not available in %s", c, parent)
+		}
+		if err := os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte("+"+c), 0); err != nil {
+			return nil, fmt.Errorf("enabling the %s controller in %s: %w", c, parent, err)
+		}
+	}
+	return &commandLimits{parent: parent, memory: memory, cpu: cpu}, nil
+}
+
+// commandCgroup is the cgroup of one command.
+type commandCgroup struct {
+	dir string
+	fd  *os.File
+}
+
+// create makes a cgroup with the limits for a command.
+func (l *commandLimits) create() (*commandCgroup, error) {
+	dir := filepath.Join(l.parent, "cmd-"+randomToken()[:12])
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return nil, err
+	}
+	cg := &commandCgroup{dir: dir}
+	settings := map[string]string{}
+	if l.memory > 0 {
+		// Swapping would only slow a runaway command down, and the whole
+		// command is killed at once rather than whichever process the
+		// kernel picks.
+		settings["memory.max"] = strconv.FormatInt(l.memory, 10)
+		settings["memory.swap.max"] = "0"
+		settings["memory.oom.group"] = "1"
+	}
+	if l.cpu > 0 {
+		settings["cpu.max"] = fmt.Sprintf("%d %d", int64(l.cpu*cgroupPeriod), cgroupPeriod)
+	}
+	for file, value := range settings {
+		err := os.WriteFile(filepath.Join(dir, file), []byte(value), 0)
+		if errors.Is(err, os.ErrNotExist) && file == "memory.swap.max" {
+			continue // no swap accounting
+		}
+		if err != nil {
+			cg.remove()
+			return nil, fmt.Errorf("setting %s: %w", file, err)
+		}
+	}
+	fd, err := os.Open(dir)
+	if err != nil {
+		cg.remove()
+		return nil, err
+	}
+	cg.fd = fd
+	return cg, nil
+}
+
+// killedBy reports why the kernel killed the command, if it hit its
+// memory limit.
+func (cg *commandCgroup) killedBy() string {
+	data, err := os.ReadFile(filepath.Join(cg.dir, "memory.events"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if n, ok := strings.CutPrefix(line, "oom_kill "); ok && n != "0" {
+			return "memory limit exceeded"
+		}
+	}
+	return ""
+}
+
+// remove kills what is left of the command and removes its cgroup. The
+// cgroup can only be removed once its processes are gone, which may take a
+// moment after they are killed.
+func (cg *commandCgroup) remove() {
+	if cg.fd != nil {
+		cg.fd.Close()
+	}
+	os.WriteFile(filepath.Join(cg.dir, "cgroup.kill"), []byte("1"), 0)
+	for i := 0; i < 100; i++ {
+		if err := os.Remove(cg.dir); err == nil || errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	fmt.Fprintf(os.Stderr, "Error removing cgroup %s: still in use\n", cg.dir)
+}
+
+// String describes the limits, e.g. "512.0 MiB of memory and 1.5 CPUs".
+func (l *commandLimits) String() string {
+	var caps []string
+	if l.memory > 0 {
+		caps = append(caps, formatBytes(l.memory)+" of memory")
+	}
+	if l.cpu > 0 {
+		caps = append(caps, strconv.FormatFloat(l.cpu, 'f', -1, 64)+" CPUs")
+	}
+	return strings.Join(caps, " and ")
+}
+
+// dockerArgs are the options of docker run that apply the same limits to
+// a new container.
+func (l *commandLimits) dockerArgs() []string {
+	var args []string
+	if l.memory > 0 {
+		memory := strconv.FormatInt(l.memory, 10)
+		args = append(args, "--memory", memory, "--memory-swap", memory)
+	}
+	if l.cpu > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(l.cpu, 'f', -1, 64))
+	}
+	return args
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCgroupParent returns a directory that passes for a cgroup v2
+// directory with the given controllers.
+func fakeCgroupParent(t *testing.T, controllers string) string {
+	t.Helper()
+	if !cgroupsSupported {
+		t.Skip("cgroups need Linux")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.controllers"), []byte(controllers+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestNewCommandLimits(t *testing.T) {
+	if _, err := newCommandLimits(fakeCgroupParent(t, "cpu io memory pids"), 512<<20, 1.5); err != nil {
+		t.Errorf("Expected limits with both controllers available, got %v", err)
+	}
+	if _, err := newCommandLimits(fakeCgroupParent(t, "cpu io"), 512<<20, 0); err == nil || !strings.Contains(err.Error(), "the memory controller is not available") {
+		t.Errorf("Expected a missing memory controller refused, got %v", err)
+	}
+	if _, err := newCommandLimits(t.TempDir(), 512<<20, 0); err == nil || !strings.Contains(err.Error(), "is not a cgroup v2 directory") {
+		t.Errorf("Expected a plain directory refused, got %v", err)
+	}
+}
+
+func TestCommandCgroup(t *testing.T) {
+	l, err := newCommandLimits(fakeCgroupParent(t, "cpu memory"), 512<<20, 1.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cg, err := l.create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cg.fd.Close()
+	for file, want := range map[string]string{"memory.max": "536870912", "memory.swap.max": "0", "memory.oom.group": "1", "cpu.max": "150000 100000"} {
+		if data, err := os.ReadFile(filepath.Join(cg.dir, file)); err != nil || string(data) != want {
+			t.Errorf("Expected %s set to %q, got %q (%v)", file, want, data, err)
+		}
+	}
+
+	events := filepath.Join(cg.dir, "memory.events")
+	for content, want := range map[string]string{
+		"low 0\nhigh 0\nmax 12\noom 1\noom_kill 0\n": "",
+		"low 0\nhigh 0\nmax 40\noom 1\noom_kill 1\n": "memory limit exceeded",
+	} {
+		if err := os.WriteFile(events, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if got := cg.killedBy(); got != want {
+			t.Errorf("killedBy() with %q = %q, want %q", content, got, want)
+		}
+	}
+
+	if got := l.String(); got != "512.0 MiB of memory and 1.5 CPUs" {
+		t.Errorf("String() = %q", got)
+	}
+	if args := l.dockerArgs(); !slices.Equal(args, []string{"--memory", "536870912", "--memory-swap", "536870912", "--cpus", "1.5"}) {
+		t.Errorf("Expected the limits passed to docker run, got %v", args)
+	}
+}
+
+func TestFormatStatus_Killed(t *testing.T) {
+	result := commandResult{ExitCode: 137, Killed: "memory limit exceeded", Duration: time.Millisecond}
+	if got, want := formatStatus(result), "_killed: memory limit exceeded 1.00ms_ `LIMIT_EXCEEDED`"; got != want {
+		t.Errorf("formatStatus() = %q, want %q", got, want)
+	}
+}
+
+// TestRunCommand_MemoryLimit runs a command that needs more memory than it
+// may have, where the server can create cgroups.
+func TestRunCommand_MemoryLimit(t *testing.T) {
+	parent := os.Getenv("TEST_CGROUP_PARENT")
+	if parent == "" {
+		t.Skip("TEST_CGROUP_PARENT names no delegated cgroup v2 directory")
+	}
+	l, err := newCommandLimits(parent, 16<<20, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := runCommand(context.Background(), `x=$(head -c 64m /dev/zero | tr '\0' a); echo done`, runOptions{Limits: l})
+	if result.Killed != "memory limit exceeded" || slices.Contains(result.Lines, "done") {
+		t.Errorf("Expected the command killed for exceeding its memory limit, got %+v", result)
+	}
+}
+
+func TestLoadConfig_Limits(t *testing.T) {
+	t.Setenv("COMMAND_MEMORY_MAX", "512m")
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "require CGROUP_PARENT") {
+		t.Errorf("Expected limits to need CGROUP_PARENT, got %v", err)
+	}
+	t.Setenv("CGROUP_PARENT", fakeCgroupParent(t, "cpu memory"))
+	cfg, err := loadConfig()
+	if err != nil || cfg.Limits == nil || cfg.Limits.memory != 512<<20 {
+		t.Errorf("Expected a 512 MiB memory limit, got %+v (%v)", cfg.Limits, err)
+	}
+	t.Setenv("COMMAND_CPU_MAX", "-1")
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "invalid COMMAND_CPU_MAX") {
+		t.Errorf("Expected a negative CPU limit refused, got %v", err)
+	}
+}
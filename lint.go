@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Lint levels, from most to least severe. They are shellcheck's levels.
+const (
+	lintError   = "error"
+	lintWarning = "warning"
+	lintInfo    = "info"
+	lintStyle   = "style"
+)
+
+var lintRank = map[string]int{lintError: 0, lintWarning: 1, lintInfo: 2, lintStyle: 3}
+
+// lintTimeout bounds the time spent in shellcheck.
+const lintTimeout = 2 * time.Second
+
+// maxLintFindings is how many findings are shown below the output.
+const maxLintFindings = 5
+
+// lintFinding is a problem found in a command. Code is the shellcheck code,
+// e.g. "SC2086"; internal rules use the code of the equivalent check.
+type lintFinding struct {
+	Code    string
+	Level   string
+	Message string
+}
+
+// lintRule is an internal rule, applied whether or not shellcheck is
+// installed.
+type lintRule struct {
+	lintFinding
+	match func(command string) bool
+}
+
+var (
+	uselessCat = regexp.MustCompile(`(^|[;&|]\s*)cat\s+[^\s|<>;&-][^\s|<>;&]*\s*\|`)
+	backticks  = regexp.MustCompile("`[^`]*`")
+)
+
+var lintRules = []lintRule{
+	{lintFinding{"SC2086", lintInfo, "unquoted variable; double quote it to prevent globbing and word splitting"}, hasUnquotedVariable},
+	{lintFinding{"SC2002", lintStyle, "useless cat; pass the file to the command instead"}, uselessCat.MatchString},
+	{lintFinding{"SC2006", lintStyle, "legacy backticks; use $(...) instead"}, backticks.MatchString},
+}
+
+// lint checks a shell command with shellcheck, if it is installed, and the
+// internal rules. Findings less severe than threshold are dropped.
+func (s *server) lint(ctx context.Context, command, threshold string) []lintFinding {
+	findings, ran := shellcheck(ctx, s.cfg.Shellcheck, command)
+	for _, r := range lintRules {
+		if ran && hasCode(findings, r.Code) {
+			continue
+		}
+		if r.match(command) {
+			findings = append(findings, r.lintFinding)
+		}
+	}
+
+	var kept []lintFinding
+	for _, f := range findings {
+		if lintRank[f.Level] <= lintRank[threshold] {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// shellcheck runs shellcheck on a command. ran is false if shellcheck is
+// not installed or failed.
+func shellcheck(ctx context.Context, path, command string) (findings []lintFinding, ran bool) {
+	if path == "" {
+		var err error
+		if path, err = exec.LookPath("shellcheck"); err != nil {
+			return nil, false
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, lintTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path, "--shell=sh", "--format=json1", "-")
+	cmd.Stdin = strings.NewReader(command)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	// shellcheck exits with 1 when it finds problems, so only the output
+	// tells whether it ran.
+	cmd.Run()
+
+	var out struct {
+		Comments []struct {
+			Code    int    `json:"code"`
+			Level   string `json:"level"`
+			Message string `json:"message"`
+		} `json:"comments"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return nil, false
+	}
+	for _, c := range out.Comments {
+		findings = append(findings, lintFinding{
+			Code:    fmt.Sprintf("SC%d", c.Code),
+			Level:   c.Level,
+			Message: c.Message,
+		})
+	}
+	return findings, true
+}
+
+// hasUnquotedVariable reports whether a command expands a variable outside
+// double quotes. Single-quoted text is not expanded and is skipped.
+func hasUnquotedVariable(command string) bool {
+	var quote byte
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case c == '\\' && quote != '\'':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '$' && i+1 < len(command):
+			next := command[i+1]
+			if next == '{' || next == '_' || next >= 'A' && next <= 'Z' || next >= 'a' && next <= 'z' {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasCode(findings []lintFinding, code string) bool {
+	for _, f := range findings {
+		if f.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// lintFooter renders findings shown below a command's output.
+func lintFooter(findings []lintFinding) string {
+	var b strings.Builder
+	for i, f := range findings {
+		if i == maxLintFindings {
+			fmt.Fprintf(&b, "\n_lint: %d more_", len(findings)-i)
+			break
+		}
+		fmt.Fprintf(&b, "\n_lint %s (%s): %s_", f.Level, f.Code, f.Message)
+	}
+	return b.String()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLint_InternalRules(t *testing.T) {
+	s := newServer(config{Shellcheck: "/nonexistent/shellcheck"})
+
+	tests := []struct {
+		command string
+		codes   []string
+	}{
+		{"ls -l", nil},
+		{"echo $HOME", []string{"SC2086"}},
+		{`echo "$HOME" '$HOME' \$HOME`, nil},
+		{"cat access.log | grep 500", []string{"SC2002"}},
+		{"cat a b", nil},
+		{"echo `date`", []string{"SC2006"}},
+	}
+	for _, tt := range tests {
+		var codes []string
+		for _, f := range s.lint(context.Background(), tt.command, lintStyle) {
+			codes = append(codes, f.Code)
+		}
+		if !reflect.DeepEqual(codes, tt.codes) {
+			t.Errorf("lint(%q) = %v, want %v", tt.command, codes, tt.codes)
+		}
+	}
+
+	if findings := s.lint(context.Background(), "cat a | wc -l", lintInfo); len(findings) != 0 {
+		t.Errorf("Expected style findings to be dropped at info level, got %v", findings)
+	}
+}
+
+func TestLint_Shellcheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shellcheck")
+	os.WriteFile(path, []byte(`#!/bin/sh
+cat >/dev/null
+echo '{"comments":[{"code":2086,"level":"info","message":"Double quote to prevent globbing and word splitting."}]}'
+exit 1
+`), 0o755)
+	s := newServer(config{Shellcheck: path})
+
+	findings := s.lint(context.Background(), "echo $HOME", lintStyle)
+	want := []lintFinding{{"SC2086", lintInfo, "Double quote to prevent globbing and word splitting."}}
+	if !reflect.DeepEqual(findings, want) {
+		t.Errorf("Expected shellcheck finding only, got %v", findings)
+	}
+}
+
+func TestLint_Footer(t *testing.T) {
+	s := newServer(config{Lint: true, Shellcheck: "/nonexistent/shellcheck"})
+
+	response := s.handleCommandExecution(context.Background(), slashCommand{Text: "$ echo $HOME", UserID: "U1"})
+	if !strings.Contains(response["text"], "\n_lint info (SC2086): unquoted variable") {
+		t.Errorf("Expected lint warning in reply, got %q", response["text"])
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// liveEditInterval is how often a live message is edited while a command
+// runs, unless the workspace's rate limits call for less often.
+// chat.update allows about one edit a second per channel.
+const liveEditInterval = 3 * time.Second
+
+// liveTailLines is how many of the latest output lines a live message
+// shows.
+const liveTailLines = 20
+
+// liveBufferSize bounds the output kept for a live message; only its tail
+// is ever shown.
+const liveBufferSize = 64 << 10
+
+// liveMessage shows the tail of a command's output in one message that is
+// edited as output arrives, like a terminal window. It is deleted once
+// the command finishes and the result is delivered as usual.
+type liveMessage struct {
+	api     *slackAPI
+	channel string
+	ts      string
+	text    string // command as shown
+	redact  bool
+	started time.Time
+
+	mu     sync.Mutex
+	output bytes.Buffer
+	shown  string // last rendered text, to skip edits that change nothing
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// liveAllowed reports whether a command's output may be shown live: the
+// message is posted in the channel, so the output must be public there
+// and the daily message quota not reached.
+func (s *server) liveAllowed(cmd slashCommand) bool {
+	rules := s.cfg.profileFor(cmd.ChannelID).Classification.rules()
+	return s.slack != nil && cmd.ChannelID != "" && !rules.PrivateOnly && !s.cfg.SensitiveChannels[cmd.ChannelID] &&
+		s.quota.canPost(1)
+}
+
+// startLiveMessage posts the live message for a command and starts
+// editing it.
+func (s *server) startLiveMessage(ctx context.Context, cmd slashCommand) (*liveMessage, error) {
+	l := &liveMessage{
+		api:     s.slack,
+		channel: cmd.ChannelID,
+		text:    s.publicText(cmd),
+		redact:  s.cfg.profileFor(cmd.ChannelID).Classification.rules().Redact,
+		started: time.Now(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	l.shown = l.render(nil)
+
+	var resp struct {
+		TS string `json:"ts"`
+	}
+	params := url.Values{"channel": {cmd.ChannelID}, "text": {l.shown}}
+	if cmd.ThreadTS != "" {
+		params.Set("thread_ts", cmd.ThreadTS)
+	}
+	if err := s.slack.call(ctx, "chat.postMessage", params, &resp); err != nil {
+		return nil, err
+	}
+	l.ts = resp.TS
+
+	go l.run(context.WithoutCancel(ctx))
+	return l, nil
+}
+
+func (l *liveMessage) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.output.Write(p)
+	if over := l.output.Len() - liveBufferSize; over > 0 {
+		l.output.Next(over)
+	}
+	return len(p), nil
+}
+
+// run edits the message every liveEditInterval, or as the workspace's
+// pacer says, until the stream is closed.
+func (l *liveMessage) run(ctx context.Context) {
+	defer close(l.done)
+	defer l.api.pacer.join("chat.update")()
+	timer := time.NewTimer(l.api.pacer.interval("chat.update", liveEditInterval))
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			l.edit(ctx)
+			timer.Reset(l.api.pacer.interval("chat.update", liveEditInterval))
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// edit replaces the message with the latest tail of the output.
+func (l *liveMessage) edit(ctx context.Context) {
+	l.mu.Lock()
+	lines := cleanOutput(l.output.String())
+	l.mu.Unlock()
+	if len(lines) > liveTailLines {
+		lines = lines[len(lines)-liveTailLines:]
+	}
+	if l.redact {
+		lines = redactLines(lines)
+	}
+
+	text := l.render(lines)
+	if text == l.shown {
+		return
+	}
+	if err := l.api.call(ctx, "chat.update", url.Values{"channel": {l.channel}, "ts": {l.ts}, "text": {text}}, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error updating live message: %v\n", err)
+		return
+	}
+	l.shown = text
+}
+
+// render shows the command, the tail of its output and how long it has
+// been running.
+func (l *liveMessage) render(lines []string) string {
+	elapsed := time.Since(l.started).Truncate(time.Second)
+	return fmt.Sprintf("```%s\n%s```\n_running for %s…_", l.text, strings.Join(lines, "\n"), elapsed)
+}
+
+// close stops editing and deletes the message, which the result replaces.
+func (l *liveMessage) close(ctx context.Context) {
+	close(l.stop)
+	<-l.done
+	if err := l.api.call(ctx, "chat.delete", url.Values{"channel": {l.channel}, "ts": {l.ts}}, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error deleting live message: %v\n", err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestHandleCommand_LiveOutputMessageReplacedByResult(t *testing.T) {
+	f := newFakeSlack(t)
+	f.respond("chat.postMessage", map[string]interface{}{"ts": "1700000000.000200"})
+	cfg := f.config()
+	cfg.Profiles = []profile{{Name: "default", LiveOutput: true}}
+	s := newServer(cfg)
+
+	response := s.handleCommandExecution(context.Background(), slashCommand{Text: "$ echo done", UserID: "U1", ChannelID: "C1", ThreadTS: "1700000000.000100"})
+
+	if !strings.Contains(response["text"], "done") {
+		t.Errorf("Expected the result delivered as usual, got %q", response["text"])
+	}
+	posts := f.callsTo("chat.postMessage")
+	if len(posts) != 1 || posts[0].Params.Get("thread_ts") != "1700000000.000100" || !strings.Contains(posts[0].Params.Get("text"), "_running for") {
+		t.Fatalf("Expected a live message in the thread, got %v", posts)
+	}
+	deletes := f.callsTo("chat.delete")
+	if len(deletes) != 1 || deletes[0].Params.Get("ts") != "1700000000.000200" || deletes[0].Params.Get("channel") != "C1" {
+		t.Errorf("Expected the live message deleted, got %v", deletes)
+	}
+}
+
+func TestLiveMessage_EditShowsTail(t *testing.T) {
+	f := newFakeSlack(t)
+	f.respond("chat.postMessage", map[string]interface{}{"ts": "1700000000.000200"})
+	s := newServer(f.config())
+
+	l, err := s.startLiveMessage(context.Background(), slashCommand{Text: "$ seq 1 30", ChannelID: "C1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 30; i++ {
+		fmt.Fprintf(l, "%d\n", i)
+	}
+	l.edit(context.Background())
+	l.edit(context.Background()) // unchanged, not sent again
+	l.close(context.Background())
+
+	updates := f.callsTo("chat.update")
+	if len(updates) != 1 {
+		t.Fatalf("Expected 1 edit, got %d", len(updates))
+	}
+	text := updates[0].Params.Get("text")
+	if !strings.Contains(text, "$ seq 1 30\n11\n") || !strings.Contains(text, "\n30```") || strings.Contains(text, "\n10\n") {
+		t.Errorf("Expected the last %d lines, got %q", liveTailLines, text)
+	}
+}
+
+func TestHandleCommand_LiveOutputNotInSensitiveChannels(t *testing.T) {
+	f := newFakeSlack(t)
+	cfg := f.config()
+	cfg.Profiles = []profile{{Name: "default", LiveOutput: true}}
+	cfg.SensitiveChannels = map[string]bool{"C1": true}
+	s := newServer(cfg)
+
+	s.handleCommandExecution(context.Background(), slashCommand{Text: "$ echo secret", UserID: "U1", ChannelID: "C1"})
+
+	if calls := f.callsTo("chat.postMessage"); len(calls) != 0 {
+		t.Errorf("Expected no live message, got %v", calls)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Throughput limits enforced by the load test unless given otherwise: the
+// server must answer commands at 90% of the offered rate, with a p99
+// latency of at most loadtestMaxP99 and no failed requests.
+const (
+	loadtestMinRate = 0.9
+	loadtestMaxP99  = time.Second
+)
+
+const loadtestUsage = "usage: http-shell loadtest [--rps=20] [--duration=10s] [--command='echo hello'] [--max-p99=1s] [--max-errors=0]"
+
+// loadtestOptions are the flags of the loadtest subcommand.
+type loadtestOptions struct {
+	RPS       int
+	Duration  time.Duration
+	Command   string
+	MaxP99    time.Duration
+	MaxErrors int
+}
+
+// loadtestResult is what one load test measured.
+type loadtestResult struct {
+	Latencies  []time.Duration // of answered requests, sorted
+	Errors     int
+	Elapsed    time.Duration
+	SlackCalls int64
+}
+
+// percentile returns the latency below which a fraction p of requests
+// were answered.
+func (r loadtestResult) percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(r.Latencies))*p+0.5) - 1
+	return r.Latencies[min(max(i, 0), len(r.Latencies)-1)]
+}
+
+// mean returns the average latency.
+func (r loadtestResult) mean() time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, l := range r.Latencies {
+		total += l
+	}
+	return total / time.Duration(len(r.Latencies))
+}
+
+// rate returns the answered requests per second.
+func (r loadtestResult) rate() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(len(r.Latencies)) / r.Elapsed.Seconds()
+}
+
+// runLoadtestCommand is the loadtest subcommand. It sends slash commands
+// at a steady rate through the whole pipeline of a scratch server, whose
+// Slack API is a local fake, and prints the latencies in Go benchmark
+// format so CI can compare runs. It fails if the throughput limits are
+// not met.
+func runLoadtestCommand(args []string, stdout, stderr io.Writer) int {
+	opts, err := parseLoadtestArgs(args)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		fmt.Fprintln(stderr, loadtestUsage)
+		return 2
+	}
+
+	dir, err := os.MkdirTemp("", "http-shell-loadtest")
+	if err != nil {
+		fmt.Fprintf(stderr, "loadtest: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	res := runLoadtest(opts, dir)
+	fmt.Fprintf(stdout, "BenchmarkLoadtest/rps=%d \t%d\t%d ns/op\t%d p50-ns\t%d p90-ns\t%d p99-ns\t%.2f req/s\t%.2f slack-calls/op\t%d errors\n",
+		opts.RPS, len(res.Latencies), int64(res.mean()), int64(res.percentile(0.5)), int64(res.percentile(0.9)), int64(res.percentile(0.99)),
+		res.rate(), float64(res.SlackCalls)/float64(max(len(res.Latencies), 1)), res.Errors)
+
+	var failures []string
+	if res.Errors > opts.MaxErrors {
+		failures = append(failures, fmt.Sprintf("%d requests failed, limit is %d", res.Errors, opts.MaxErrors))
+	}
+	if p99 := res.percentile(0.99); opts.MaxP99 > 0 && p99 > opts.MaxP99 {
+		failures = append(failures, fmt.Sprintf("p99 latency %s exceeds %s", p99.Round(time.Microsecond), opts.MaxP99))
+	}
+	if want := float64(opts.RPS) * loadtestMinRate; res.rate() < want {
+		failures = append(failures, fmt.Sprintf("answered %.2f requests a second, want at least %.2f", res.rate(), want))
+	}
+	for _, f := range failures {
+		fmt.Fprintf(stdout, "FAIL: %s\n", f)
+	}
+	if len(failures) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func parseLoadtestArgs(args []string) (loadtestOptions, error) {
+	opts := loadtestOptions{RPS: 20, Duration: 10 * time.Second, Command: "echo hello", MaxP99: loadtestMaxP99}
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return opts, fmt.Errorf("loadtest: unexpected argument %q", arg)
+		}
+		var err error
+		switch name {
+		case "--rps":
+			opts.RPS, err = strconv.Atoi(value)
+			if err == nil && opts.RPS <= 0 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "--duration":
+			opts.Duration, err = time.ParseDuration(value)
+			if err == nil && opts.Duration <= 0 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "--command":
+			opts.Command = value
+			if strings.TrimSpace(value) == "" {
+				err = fmt.Errorf("must not be empty")
+			}
+		case "--max-p99":
+			opts.MaxP99, err = time.ParseDuration(value)
+		case "--max-errors":
+			opts.MaxErrors, err = strconv.Atoi(value)
+		default:
+			return opts, fmt.Errorf("loadtest: unknown flag %s", name)
+		}
+		if err != nil {
+			return opts, fmt.Errorf("loadtest: %s: %v", name, err)
+		}
+	}
+	return opts, nil
+}
+
+// runLoadtest offers opts.RPS commands a second for opts.Duration to a
+// server keeping its data in dir, and waits for every answer.
+func runLoadtest(opts loadtestOptions, dir string) loadtestResult {
+	var slackCalls atomic.Int64
+	slack := httptest.NewServer(loadtestSlack(&slackCalls))
+	defer slack.Close()
+
+	s := newServer(config{
+		SlackToken:      "xoxb-loadtest",
+		SlackAPIURL:     slack.URL + "/api/",
+		DataDir:         dir,
+		MaxMessageChars: 3000,
+		// Failed requests are still logged.
+		AccessLogSampling: map[string]float64{"webhook": 0},
+	})
+	shell := httptest.NewServer(s.routes())
+	defer shell.Close()
+	webhook := shell.URL + s.routeTable.resolve(s.cfg.Paths).Webhook
+
+	var mu sync.Mutex
+	var res loadtestResult
+	var wg sync.WaitGroup
+	ticker := time.NewTicker(time.Second / time.Duration(opts.RPS))
+	defer ticker.Stop()
+	start := time.Now()
+	for sent := 0; time.Since(start) < opts.Duration; sent++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			form := url.Values{
+				"text":         {"$ " + opts.Command},
+				"user_id":      {fmt.Sprintf("U%04d", n%50)},
+				"channel_id":   {fmt.Sprintf("C%03d", n%10)},
+				"team_id":      {"T0LOADTEST"},
+				"response_url": {slack.URL + "/response"},
+			}
+			began := time.Now()
+			resp, err := shell.Client().PostForm(webhook, form)
+			latency := time.Since(began)
+			ok := err == nil && resp.StatusCode == http.StatusOK
+			if err == nil {
+				var reply map[string]interface{}
+				ok = ok && json.NewDecoder(resp.Body).Decode(&reply) == nil
+				resp.Body.Close()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !ok {
+				res.Errors++
+				return
+			}
+			res.Latencies = append(res.Latencies, latency)
+		}(sent)
+		<-ticker.C
+	}
+	wg.Wait()
+	res.Elapsed = time.Since(start)
+	res.SlackCalls = slackCalls.Load()
+	sort.Slice(res.Latencies, func(i, j int) bool { return res.Latencies[i] < res.Latencies[j] })
+	return res
+}
+
+// loadtestSlack is a stand-in for the Slack API that accepts every call,
+// including file uploads and posts to response URLs, and counts them.
+func loadtestSlack(calls *atomic.Int64) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		r.ParseForm()
+		response := map[string]interface{}{"ok": true, "ts": fmt.Sprintf("%d.000100", time.Now().Unix())}
+		switch strings.TrimPrefix(r.URL.Path, "/api/") {
+		case "files.getUploadURLExternal":
+			response["upload_url"] = "http://" + r.Host + "/upload"
+			response["file_id"] = "F0LOADTEST"
+		case "files.info":
+			response["file"] = map[string]interface{}{"id": "F0LOADTEST", "permalink": "https://slack.example.com/files/F0LOADTEST"}
+		case "conversations.open":
+			response["channel"] = map[string]interface{}{"id": "D0LOADTEST"}
+		}
+		writeJSON(w, response)
+	})
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		io.Copy(io.Discard, r.Body)
+	})
+	mux.HandleFunc("/response", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		io.Copy(io.Discard, r.Body)
+	})
+	return mux
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadtestCommand_PrintsBenchmark(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := runLoadtestCommand([]string{"--rps=50", "--duration=200ms", "--max-p99=5s"}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Expected the load test to pass, got %d: %s", code, stdout.String())
+	}
+	fields := strings.Fields(stdout.String())
+	if len(fields) < 4 || fields[0] != "BenchmarkLoadtest/rps=50" || fields[3] != "ns/op" || !strings.Contains(stdout.String(), "p99-ns") {
+		t.Errorf("Expected a benchmark line, got %q", stdout.String())
+	}
+}
+
+func TestLoadtestCommand_EnforcesLatency(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := runLoadtestCommand([]string{"--rps=20", "--duration=100ms", "--command=sleep 0.05", "--max-p99=1ms"}, &stdout, &stderr)
+	if code != 1 || !strings.Contains(stdout.String(), "FAIL: p99 latency") {
+		t.Errorf("Expected the latency limit to fail the run, got %d: %s", code, stdout.String())
+	}
+}
+
+func TestParseLoadtestArgs(t *testing.T) {
+	opts, err := parseLoadtestArgs([]string{"--rps=5", "--duration=1m", "--command=uptime"})
+	if err != nil || opts.RPS != 5 || opts.Duration != time.Minute || opts.Command != "uptime" || opts.MaxP99 != loadtestMaxP99 {
+		t.Errorf("Unexpected options %+v, %v", opts, err)
+	}
+	for _, args := range [][]string{{"--rps=0"}, {"--rps"}, {"--verbose=1"}, {"--command= "}} {
+		if _, err := parseLoadtestArgs(args); err == nil {
+			t.Errorf("Expected %q to be refused", args)
+		}
+	}
+}
@@ -2,61 +2,108 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/exec"
+	"slices"
 	"strings"
 	"time"
 )
 
 func main() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		os.Exit(runAuditCommand(os.Args[2:], os.Stdout, os.Stderr))
 	}
-
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
-		// Parse form data
-		if err := r.ParseForm(); err != nil {
-			http.Error(w, "Bad request", http.StatusBadRequest)
-			return
+	if len(os.Args) > 1 && os.Args[1] == "loadtest" {
+		os.Exit(runLoadtestCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "agent" {
+		if err := hideCredentials(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error hiding credentials: %v\n", err)
+			os.Exit(1)
 		}
+		os.Exit(runAgentCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "sandbox" {
+		os.Exit(runSandboxCommand(os.Args[2:], os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "rlimit" {
+		os.Exit(runRlimitCommand(os.Args[2:], os.Stderr))
+	}
 
-		text := r.FormValue("text")
-
-		if text == "" {
-			http.Error(w, "Missing required field: text", http.StatusBadRequest)
-			return
+	// Commands must not find the server's credentials in its environment,
+	// whether it started with them or CONFIG_FILE set them.
+	if err := hideCredentials(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error hiding credentials: %v\n", err)
+		os.Exit(1)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if err := hideCredentials(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error hiding credentials: %v\n", err)
+		os.Exit(1)
+	}
+	s := newServer(cfg)
+	go s.reloadOnSignal()
+	if cfg.DailySummaryAt != "" && s.store != nil {
+		go s.runDailySummary()
+	}
+	if cfg.SecurityReportAt != "" {
+		go s.runSecurityReport()
+	}
+	if cfg.TemplateSuggestionsAt != "" && s.store != nil {
+		go s.runTemplateSuggestions()
+	}
+	if s.schedules != nil && s.slack != nil {
+		if s.leader != nil {
+			go s.leader.run(context.Background())
 		}
+		go s.runScheduler()
+	}
+	if cfg.AuditAnchorURL != "" {
+		go s.runAuditAnchors()
+	}
+	if s.exporter != nil {
+		go s.exporter.run(cfg.ExportInterval)
+	}
+	if s.archive != nil && cfg.OutputRetention > 0 {
+		go s.runArchiveRetention()
+	}
+	if s.queue != nil {
+		go s.recoverQueue(context.Background())
+	}
+	if cfg.OpsChannel != "" && s.slack != nil {
+		go s.postStartupReport(context.Background())
+	}
+	if s.banners != nil && s.slack != nil {
+		go s.refreshBanners(context.Background())
+	}
 
-		// Strip leading '$' from text for execution
-		command := strings.TrimPrefix(text, "$")
-		command = strings.TrimSpace(command)
-
-		// Execute command synchronously and return result (pass original text for display)
-		result := executeCommand(command, text)
-
-		// Create JSON response
-		response := map[string]string{
-			"response_type": "in_channel",
-			"text":          result,
+	if cfg.AgentsListenAddr != "" {
+		agentsServer, err := s.newAgentsTLSServer()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error configuring agent TLS: %v\n", err)
+			os.Exit(1)
 		}
+		go func() {
+			fmt.Printf("Accepting agents on %s\n", cfg.AgentsListenAddr)
+			if err := agentsServer.ListenAndServeTLS("", ""); err != nil {
+				fmt.Fprintf(os.Stderr, "Error starting agent listener: %v\n", err)
+				os.Exit(1)
+			}
+		}()
+	}
 
-		// Return JSON response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(response)
-	})
-
-	fmt.Printf("Starting server on port %s\n", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	fmt.Printf("Starting server on port %s\n", cfg.Port)
+	printPaths(s.routeTable.resolve(cfg.Paths))
+	if err := http.ListenAndServe(":"+cfg.Port, s.routes()); err != nil {
 		fmt.Fprintf(os.Stderr, "Error starting server: %v\n", err)
 		os.Exit(1)
 	}
@@ -67,6 +114,7 @@ func translateExitCode(code int) string {
 		0:   "success",
 		1:   "error",
 		2:   "misuse",
+		124: "timed out",
 		126: "cannot execute",
 		127: "not found",
 		128: "invalid exit",
@@ -80,42 +128,178 @@ func translateExitCode(code int) string {
 	return fmt.Sprintf("error %d", code)
 }
 
+// commandResult is the outcome of running a command.
+type commandResult struct {
+	Lines    []string // cleaned stdout and stderr lines
+	Binary   []byte   // stdout, when it is not text
+	ExitCode int
+	Duration time.Duration
+
+	// Hosts are how a command sent to a group ended on each host.
+	Hosts []hostResult
+
+	// Killed says why a limit killed the command, e.g. "memory limit
+	// exceeded".
+	Killed string
+}
+
+// runOptions adjust how a command is executed.
+type runOptions struct {
+	PTY           bool      // attach the command to a pseudo-terminal
+	Stdin         io.Reader // input for the command's stdin
+	Env           []string  // extra environment variables, "KEY=value"
+	Environ       []string  // the environment to start with, the server's if nil
+	TranslateANSI bool      // keep colors and bold text as markers
+	Progress      io.Writer // receives output as it is produced
+
+	// Limits caps the command's memory and CPU with a cgroup of its own.
+	Limits *commandLimits
+	// Rlimits are set on the command before it starts.
+	Rlimits *rlimits
+	// Namespaces starts the command in new user and mount namespaces.
+	Namespaces bool
+}
+
 func executeCommand(command, originalText string) string {
+	return formatResult(originalText, runCommand(context.Background(), command, runOptions{}))
+}
+
+// commandWaitDelay bounds how long output is collected after a canceled
+// command is killed.
+const commandWaitDelay = time.Second
+
+// runCommand runs command with sh. Canceling ctx kills the command and
+// everything it started.
+func runCommand(ctx context.Context, command string, opts runOptions) commandResult {
+	return runProgram(ctx, []string{"sh", "-c", command}, nil, opts)
+}
+
+// runProgram runs a program with its arguments as runCommand runs sh.
+// Canceling ctx kills it and everything it started, then calls stop, if
+// set, to stop what it started elsewhere, such as in a container.
+func runProgram(ctx context.Context, argv []string, stop func(), opts runOptions) commandResult {
 	startTime := time.Now()
+	if opts.Rlimits != nil {
+		var err error
+		if argv, err = opts.Rlimits.wrap(argv); err != nil {
+			return commandResult{Lines: []string{"setting the command's limits: " + err.Error()}, ExitCode: 126, Duration: time.Since(startTime)}
+		}
+	}
 
 	// Execute command
-	cmd := exec.Command("sh", "-c", command)
-
-	// Capture stdout and stderr
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	setProcessGroup(cmd)
+	if opts.Namespaces {
+		newNamespaces(cmd)
+	}
+	cmd.Cancel = func() error {
+		err := killProcessGroup(cmd)
+		if stop != nil {
+			stop()
+		}
+		return err
+	}
+	cmd.WaitDelay = commandWaitDelay
+	cmd.Stdin = opts.Stdin
+	if opts.Environ != nil {
+		cmd.Env = append(slices.Clone(opts.Environ), opts.Env...)
+	} else if len(opts.Env) > 0 {
+		cmd.Env = append(os.Environ(), opts.Env...)
+	}
+	var cgroup *commandCgroup
+	if opts.Limits != nil {
+		var err error
+		if cgroup, err = opts.Limits.create(); err != nil {
+			return commandResult{Lines: []string{"creating the command's cgroup: " + err.Error()}, ExitCode: 126, Duration: time.Since(startTime)}
+		}
+		defer cgroup.remove()
+		cgroup.attach(cmd)
+	}
 
-	// Run command and wait for completion
-	err := cmd.Run()
+	var output string
+	var binary []byte
+	var err error
+	if opts.PTY {
+		output, err = runPTY(cmd, opts.Progress)
+	} else {
+		output, binary, err = runPipes(cmd, opts.Progress)
+	}
 
 	// Get exit code
 	exitCode := 0
 	if err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			exitCode = 124
+		} else if ctx.Err() != nil {
+			exitCode = 130
+		} else if exitError, ok := err.(*exec.ExitError); ok {
 			exitCode = exitError.ExitCode()
+		} else {
+			// The command could not be started at all
+			exitCode = 126
 		}
 	}
 
+	if opts.TranslateANSI {
+		output = translateANSI(output)
+	}
+
 	// Calculate execution time
 	duration := time.Since(startTime)
 
+	result := commandResult{
+		Lines:    cleanOutput(output),
+		Binary:   binary,
+		ExitCode: exitCode,
+		Duration: duration,
+	}
+	if cgroup != nil {
+		result.Killed = cgroup.killedBy()
+	}
+	if result.Killed == "" && opts.Rlimits != nil && ctx.Err() == nil {
+		result.Killed = rlimitKilled(err)
+	}
+	return result
+}
+
+// runPipes runs cmd with stdout and stderr captured separately and
+// returns them combined. Binary stdout is returned on its own instead.
+// Output is also copied to progress, if set, as it is produced.
+func runPipes(cmd *exec.Cmd, progress io.Writer) (string, []byte, error) {
+	// Capture stdout and stderr
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if progress != nil {
+		cmd.Stdout = io.MultiWriter(&stdout, progress)
+		cmd.Stderr = io.MultiWriter(&stderr, progress)
+	}
+
+	// Run command and wait for completion
+	err := cmd.Run()
+
+	if isBinary(stdout.Bytes()) {
+		return stderr.String(), stdout.Bytes(), err
+	}
+
 	// Combine stdout and stderr
 	var combinedOutput bytes.Buffer
 	combinedOutput.Write(stdout.Bytes())
 	if stderr.Len() > 0 {
 		combinedOutput.Write(stderr.Bytes())
 	}
+	return combinedOutput.String(), nil, err
+}
 
+// cleanOutput splits output into lines, stripping terminal escape
+// sequences and redraws and dropping "--- stderr ---" markers and leading
+// and trailing blank lines.
+func cleanOutput(output string) []string {
 	// Clean up the output: remove "--- stderr ---" lines and trim blank lines
-	outputLines := strings.Split(combinedOutput.String(), "\n")
+	outputLines := strings.Split(stripANSI(output), "\n")
 	var cleanedLines []string
 	for _, line := range outputLines {
+		line = collapseRedraws(line)
 		trimmed := strings.TrimSpace(line)
 		// Skip "--- stderr ---" lines (case insensitive, with optional whitespace)
 		if strings.EqualFold(trimmed, "--- stderr ---") {
@@ -131,6 +315,37 @@ func executeCommand(command, originalText string) string {
 	for len(cleanedLines) > 0 && strings.TrimSpace(cleanedLines[len(cleanedLines)-1]) == "" {
 		cleanedLines = cleanedLines[:len(cleanedLines)-1]
 	}
+	return cleanedLines
+}
+
+// formatStatus renders the italicized status line, e.g. "_success 1.60ms_".
+func formatStatus(result commandResult) string {
+	status := translateExitCode(result.ExitCode)
+	if result.Killed != "" {
+		status = "killed: " + result.Killed
+	}
+	if timedOut(result) && len(result.Lines) > 0 {
+		status = "partial — " + status
+	}
+	formatted := fmt.Sprintf("_%s %.2fms_", status, float64(result.Duration.Nanoseconds())/1e6)
+	if timedOut(result) {
+		formatted += " `" + string(codeTimeout) + "`"
+	} else if result.Killed != "" {
+		formatted += " `" + string(codeLimitExceeded) + "`"
+	}
+	return formatted
+}
+
+// timedOut reports whether a command was killed by its timeout. Its output
+// is what it printed before then.
+func timedOut(result commandResult) bool {
+	return result.ExitCode == 124
+}
+
+// formatResult renders the command and its output as a code block followed
+// by the status line.
+func formatResult(originalText string, res commandResult) string {
+	cleanedLines := res.Lines
 
 	// Ensure we never create an empty code block
 	// Check if we have any actual content (originalText should always have content, but be safe)
@@ -138,7 +353,7 @@ func executeCommand(command, originalText string) string {
 
 	if !hasContent {
 		// If no content, return just the status without code block, italicized
-		return fmt.Sprintf("_%s %.2fms_", translateExitCode(exitCode), float64(duration.Nanoseconds())/1e6)
+		return formatStatus(res)
 	}
 
 	// Prepare output - code block with command and output
@@ -156,7 +371,7 @@ func executeCommand(command, originalText string) string {
 	result.WriteString("```\n\n")
 
 	// Add status outside code block, italicized
-	result.WriteString(fmt.Sprintf("_%s %.2fms_", translateExitCode(exitCode), float64(duration.Nanoseconds())/1e6))
+	result.WriteString(formatStatus(res))
 
 	return result.String()
 }
@@ -334,3 +334,35 @@ func TestExecuteCommand_EmptyOutputPreservesCodeBlock(t *testing.T) {
 		t.Errorf("Expected result to not be an empty code block, got %q", result)
 	}
 }
+
+func FuzzCleanOutput(f *testing.F) {
+	for _, seed := range []string{
+		"hello\nworld\n",
+		"\n\n  out\n--- stderr ---\nerr\n\n",
+		"\x1b[1;31mred\x1b[0m\r\n",
+		"10%\r50%\r100%\n",
+		"abc\b\bX\n",
+		"\x1b]0;title\x07\x1b[2Kdone",
+		"\x1b\x1b[m[m",
+		"\r\b\x1b",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, output string) {
+		lines := cleanOutput(output)
+		for i, line := range lines {
+			if strings.ContainsAny(line, "\n\r\b\x1b") {
+				t.Fatalf("Line %d still has control characters: %q", i, line)
+			}
+			if strings.EqualFold(strings.TrimSpace(line), "--- stderr ---") {
+				t.Fatalf("Line %d is a stderr marker", i)
+			}
+		}
+		if len(lines) > 0 && (strings.TrimSpace(lines[0]) == "" || strings.TrimSpace(lines[len(lines)-1]) == "") {
+			t.Fatalf("Expected no leading or trailing blank lines, got %q", lines)
+		}
+		if again := cleanOutput(strings.Join(lines, "\n")); strings.Join(again, "\n") != strings.Join(lines, "\n") {
+			t.Fatalf("Expected cleaning to be idempotent, got %q then %q", lines, again)
+		}
+	})
+}
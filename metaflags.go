@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// metaFlags are options given before the shell command itself, e.g.
+// "$ --pty top -b -n 1". They are interpreted by the server and never
+// passed to the shell.
+type metaFlags struct {
+	PTY    bool
+	Stdin  bool
+	File   string // Slack file ID or permalink given with --file=
+	Canvas bool   // stream output to a canvas
+	DM     bool   // deliver output to the invoker's DM
+	To     string // channel given with --to= to post output in
+	Host   string // agent given with @ or --host= to run the command on
+	Quiet  bool   // post no heartbeats while the command runs
+
+	NoWatchdog bool   // never flag or kill the command for a lack of output
+	Container  string // Docker container given with --container= to run the command in
+}
+
+// stdinSeparator divides the command from its input when --stdin is given.
+const stdinSeparator = "---"
+
+// parseMetaFlags consumes known meta-flags from the start of command and
+// returns them with the remaining command.
+func parseMetaFlags(command string) (metaFlags, string) {
+	var flags metaFlags
+	for {
+		word, rest := command, ""
+		if i := strings.IndexFunc(command, unicode.IsSpace); i >= 0 {
+			word, rest = command[:i], command[i:]
+		}
+		switch word {
+		case "--pty":
+			flags.PTY = true
+		case "--stdin":
+			flags.Stdin = true
+		case "--canvas":
+			flags.Canvas = true
+		case "--dm":
+			flags.DM = true
+		case "--quiet":
+			flags.Quiet = true
+		case "--no-watchdog":
+			flags.NoWatchdog = true
+		default:
+			if ref, ok := strings.CutPrefix(word, "--file="); ok && ref != "" {
+				flags.File = ref
+				break
+			}
+			if ref, ok := strings.CutPrefix(word, "--to="); ok && ref != "" {
+				flags.To = ref
+				break
+			}
+			if name, ok := strings.CutPrefix(word, "--container="); ok && name != "" {
+				flags.Container = name
+				break
+			}
+			if host, ok := strings.CutPrefix(word, "--host="); ok && host != "" {
+				flags.Host = host
+				break
+			}
+			if host, ok := strings.CutPrefix(word, "@"); ok && host != "" {
+				flags.Host = host
+				break
+			}
+			return flags, command
+		}
+		command = strings.TrimSpace(rest)
+	}
+}
+
+// normalizeCommand turns the text of a slash command into the command to
+// run: the leading "$" and surrounding space are dropped and the
+// meta-flags parsed off.
+func normalizeCommand(text string) (metaFlags, string) {
+	return parseMetaFlags(strings.TrimSpace(strings.TrimPrefix(text, "$")))
+}
+
+// splitStdin separates a command from the input following the first
+// separator line. ok is false if there is no separator.
+func splitStdin(command string) (cmd, stdin string, ok bool) {
+	lines := strings.Split(command, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) == stdinSeparator {
+			cmd = strings.TrimSpace(strings.Join(lines[:i], "\n"))
+			stdin = strings.Join(lines[i+1:], "\n")
+			if stdin != "" && !strings.HasSuffix(stdin, "\n") {
+				stdin += "\n"
+			}
+			return cmd, stdin, true
+		}
+	}
+	return command, "", false
+}
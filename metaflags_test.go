@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMetaFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		flags   metaFlags
+		command string
+	}{
+		{"no flags", "top -b", metaFlags{}, "top -b"},
+		{"pty", "--pty top -b", metaFlags{PTY: true}, "top -b"},
+		{"unknown flag is part of command", "--version", metaFlags{}, "--version"},
+		{"flag only", "--pty", metaFlags{PTY: true}, ""},
+		{"stdin before newline", "--stdin\nwc -l", metaFlags{Stdin: true}, "wc -l"},
+		{"multiple flags", "--pty --stdin cat", metaFlags{PTY: true, Stdin: true}, "cat"},
+		{"output channel", "--to=#ops uptime", metaFlags{To: "#ops"}, "uptime"},
+		{"host", "@web01 uptime", metaFlags{Host: "web01"}, "uptime"},
+		{"host flag", "--pty --host=web01 top", metaFlags{PTY: true, Host: "web01"}, "top"},
+		{"container", "--container=app --stdin cat", metaFlags{Container: "app", Stdin: true}, "cat"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags, command := parseMetaFlags(tt.input)
+			if flags != tt.flags {
+				t.Errorf("Expected flags %+v, got %+v", tt.flags, flags)
+			}
+			if command != tt.command {
+				t.Errorf("Expected command %q, got %q", tt.command, command)
+			}
+		})
+	}
+}
+
+func TestSplitStdin(t *testing.T) {
+	cmd, stdin, ok := splitStdin("wc -l\n---\none\ntwo")
+	if !ok {
+		t.Fatal("Expected separator to be found")
+	}
+	if cmd != "wc -l" {
+		t.Errorf("Expected command %q, got %q", "wc -l", cmd)
+	}
+	if stdin != "one\ntwo\n" {
+		t.Errorf("Expected stdin %q, got %q", "one\ntwo\n", stdin)
+	}
+
+	if _, _, ok := splitStdin("wc -l"); ok {
+		t.Error("Expected no separator to be found")
+	}
+}
+
+func FuzzNormalizeCommand(f *testing.F) {
+	for _, seed := range []string{
+		"$ --pty top -b",
+		"$--stdin\nwc -l\n---\none",
+		"--file=F0123ABCD --dm --quiet cat",
+		"$ --no-watchdog\t--canvas  sleep 1",
+		"--file= ls",
+		"--to=<#C0123ABCD|ops> --to= uptime",
+		"$",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		flags, command := normalizeCommand(text)
+		if command != strings.TrimSpace(command) {
+			t.Fatalf("Expected the command trimmed, got %q", command)
+		}
+		if rest, again := parseMetaFlags(command); rest != (metaFlags{}) || again != command {
+			t.Fatalf("Expected every meta-flag consumed, %q left %+v in %q", text, flags, command)
+		}
+		if flags.Stdin {
+			if cmd, _, ok := splitStdin(command); ok && cmd != strings.TrimSpace(cmd) {
+				t.Fatalf("Expected the command before stdin trimmed, got %q", cmd)
+			}
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mirrorStats counts mirrored requests by outcome: sent, failed, dropped.
+var mirrorStats = expvar.NewMap("mirror_requests")
+
+// maxMirrorsInFlight bounds concurrent mirror requests. Requests beyond it
+// are dropped rather than queued, so a slow staging instance never delays
+// production.
+const maxMirrorsInFlight = 16
+
+// mirror asynchronously forwards sanitized copies of slash command requests
+// to a staging instance, which evaluates them without running anything.
+type mirror struct {
+	url      string
+	secret   []byte // re-signs mirrored requests when set
+	client   *http.Client
+	inFlight chan struct{}
+}
+
+func newMirror(url, secret string, client *http.Client) *mirror {
+	m := &mirror{url: url, client: client, inFlight: make(chan struct{}, maxMirrorsInFlight)}
+	if secret != "" {
+		m.secret = []byte(secret)
+	}
+	return m
+}
+
+// send mirrors a request's form in the background.
+func (m *mirror) send(form url.Values) {
+	select {
+	case m.inFlight <- struct{}{}:
+	default:
+		mirrorStats.Add("dropped", 1)
+		return
+	}
+
+	body := sanitizeMirror(form).Encode()
+	go func() {
+		defer func() { <-m.inFlight }()
+		if err := m.post(body); err != nil {
+			mirrorStats.Add("failed", 1)
+			fmt.Fprintf(os.Stderr, "Error mirroring request: %v\n", err)
+			return
+		}
+		mirrorStats.Add("sent", 1)
+	}()
+}
+
+func (m *mirror) post(body string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", m.url, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if m.secret != nil {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, m.secret)
+		fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+		req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+		req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("staging returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sanitizeMirror copies a request's form with secrets redacted, the fields
+// that would let staging reply in Slack removed, and dry_run set.
+func sanitizeMirror(form url.Values) url.Values {
+	mirrored := url.Values{}
+	for key, values := range form {
+		switch key {
+		case "response_url", "trigger_id", "token":
+			continue
+		}
+		mirrored[key] = redactLines(values)
+	}
+	mirrored.Set("dry_run", "true")
+	return mirrored
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMirror_SendsSanitizedDryRun(t *testing.T) {
+	staging := newServer(config{SigningSecret: "secret", SignatureMaxAge: 5 * time.Minute})
+	type mirrored struct {
+		form     url.Values
+		response map[string]string
+	}
+	received := make(chan mirrored, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		staging.handleCommand(rec, r)
+		var response map[string]string
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		received <- mirrored{r.PostForm, response}
+	}))
+	defer ts.Close()
+
+	s := newServer(config{MirrorURL: ts.URL, SigningSecret: "secret", SignatureMaxAge: 5 * time.Minute})
+	data := url.Values{}
+	data.Set("text", "$ echo PASSWORD=hunter2")
+	data.Set("user_id", "U1")
+	data.Set("response_url", "https://hooks.slack.com/commands/x")
+	req := signedRequest("secret", time.Now(), data.Encode())
+	w := httptest.NewRecorder()
+	s.handleCommand(w, req)
+
+	select {
+	case m := <-received:
+		if m.form.Get("dry_run") != "true" {
+			t.Errorf("Expected dry_run, got %v", m.form)
+		}
+		if m.form.Has("response_url") {
+			t.Errorf("Expected response_url to be removed, got %v", m.form)
+		}
+		if text := m.form.Get("text"); strings.Contains(text, "hunter2") || m.form.Get("user_id") != "U1" {
+			t.Errorf("Expected redacted text and user, got %v", m.form)
+		}
+		if !strings.Contains(m.response["text"], "dry run") {
+			t.Errorf("Expected staging to evaluate without running, got %q", m.response["text"])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Request was not mirrored")
+	}
+
+	if !strings.Contains(w.Body.String(), "hunter2") {
+		t.Errorf("Expected production to run the command, got %q", w.Body.String())
+	}
+}
+
+func TestHandleCommand_DryRunHasNoSideEffects(t *testing.T) {
+	ts, alerts := responseURLRecorder(t)
+	s := hooksServer(t)
+	s.cfg.SuspiciousAction = suspiciousAlert
+	s.cfg.SecurityWebhookURL = ts.URL
+
+	data := url.Values{}
+	data.Set("text", "$ up /etc/shadow")
+	data.Set("dry_run", "true")
+	response := postCommand(t, s, data)
+
+	if !strings.Contains(response["text"], "would run_ `up /etc/shadow`") {
+		t.Errorf("Expected the command evaluated without the pre_policy hook, got %q", response["text"])
+	}
+	if len(*alerts) != 0 {
+		t.Errorf("Expected no security alert for a dry run, got %v", *alerts)
+	}
+}
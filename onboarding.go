@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// defaultTour is the onboarding tour sent to new users. Each entry becomes
+// a section; {placeholders} are filled in per user.
+var defaultTour = []string{
+	"*Welcome to the shell, {user}!* Here is what you need to know.",
+	"*Running commands:* send `$ <command>`; the leading `$` is optional. Meta-flags go before the command: `--pty` for a terminal, `--stdin` to feed the lines after `---` to the command, and `--file=<file>` to pass a Slack file. `$ help` lists the builtins.",
+	"*Timeouts:* {timeout}",
+	"*What is logged:* {logging}",
+	"*Your permissions here:* {tier}",
+}
+
+// loadTour reads a custom tour from a JSON array of mrkdwn strings.
+func loadTour(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tour []string
+	if err := json.Unmarshal(data, &tour); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return tour, nil
+}
+
+// onboard sends the tour to users on their first command.
+func (s *server) onboard(ctx context.Context, cmd slashCommand) {
+	if s.store == nil || s.slack == nil || cmd.UserID == "" {
+		return
+	}
+	first, err := s.store.markSeen(cmd.UserID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error recording user: %v\n", err)
+		return
+	}
+	if !first {
+		return
+	}
+
+	channel, err := s.openDM(ctx, cmd.UserID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening DM for onboarding: %v\n", err)
+		return
+	}
+
+	blocks, err := json.Marshal(s.tourBlocks(cmd))
+	if err != nil {
+		return
+	}
+	params := url.Values{
+		"channel": {channel},
+		"text":    {"Welcome to the shell"},
+		"blocks":  {string(blocks)},
+	}
+	if err := s.slack.call(ctx, "chat.postMessage", params, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error sending onboarding tour: %v\n", err)
+	}
+}
+
+// tourBlocks renders the tour for a user, with a button to try help.
+func (s *server) tourBlocks(cmd slashCommand) []block {
+	tour := s.cfg.OnboardingTour
+	if len(tour) == 0 {
+		tour = defaultTour
+	}
+
+	r := strings.NewReplacer(
+		"{user}", "<@"+cmd.UserID+">",
+		"{timeout}", s.describeTimeouts(),
+		"{logging}", s.describeLogging(),
+		"{tier}", s.describeTier(cmd),
+	)
+	var blocks []block
+	for _, section := range tour {
+		blocks = append(blocks, sectionBlock(r.Replace(section)))
+	}
+	if s.cfg.Interactivity {
+		blocks = append(blocks, actionsBlock(button(actionRerun, "Try $ help", "$ help", "primary")))
+	}
+	return blocks
+}
+
+func (s *server) describeTimeouts() string {
+	if s.cfg.CommandTimeout > 0 {
+		return fmt.Sprintf("commands are stopped after %s, together with everything they started.", s.cfg.CommandTimeout)
+	}
+	return "commands run until they finish; use the Stop button or ask an admin if one hangs."
+}
+
+func (s *server) describeLogging() string {
+	parts := []string{"every request is access logged"}
+	if s.store != nil {
+		parts = append(parts, "commands and their output are kept, redacted according to the channel's profile")
+	}
+	parts = append(parts, "approvals and security alerts go to the audit log")
+	return strings.Join(parts, "; ") + "."
+}
+
+func (s *server) describeTier(cmd slashCommand) string {
+	p := s.cfg.profileFor(cmd.ChannelID)
+	tier := fmt.Sprintf("this channel uses the `%s` profile (%s)", p.Name, p.Classification)
+	for _, id := range s.cfg.Approvers {
+		if id == cmd.UserID {
+			return tier + " and you can approve other users' commands."
+		}
+	}
+	return tier + "."
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOnboarding_SendsTourOnFirstCommand(t *testing.T) {
+	f := newFakeSlack(t)
+	f.respond("conversations.open", map[string]interface{}{"channel": map[string]string{"id": "D1"}})
+	cfg := f.config()
+	cfg.DataDir = t.TempDir()
+	cfg.Interactivity = true
+	cfg.CommandTimeout = time.Minute
+	s := newServer(cfg)
+
+	s.onboard(context.Background(), slashCommand{UserID: "U1", ChannelID: "C1"})
+	s.onboard(context.Background(), slashCommand{UserID: "U1", ChannelID: "C1"})
+
+	calls := f.callsTo("chat.postMessage")
+	if len(calls) != 1 {
+		t.Fatalf("Expected one tour, got %d", len(calls))
+	}
+	if calls[0].Params.Get("channel") != "D1" {
+		t.Errorf("Expected tour in the DM, got %q", calls[0].Params.Get("channel"))
+	}
+	blocks := calls[0].Params.Get("blocks")
+	for _, want := range []string{"stopped after 1m0s", "`default` profile (public)", `"value":"$ help"`} {
+		if !strings.Contains(blocks, want) {
+			t.Errorf("Expected tour to contain %q, got %s", want, blocks)
+		}
+	}
+
+	// The flag survives a restart
+	if first, _ := newServer(cfg).store.markSeen("U1"); first {
+		t.Error("Expected U1 to be remembered")
+	}
+}
+
+func TestTourBlocks_CustomText(t *testing.T) {
+	s := newServer(config{OnboardingTour: []string{"Hi {user}, ask #ops for help."}})
+
+	blocks := s.tourBlocks(slashCommand{UserID: "U9"})
+	if len(blocks) != 1 || blocks[0]["text"].(block)["text"] != "Hi <@U9>, ask #ops for help." {
+		t.Errorf("Unexpected blocks %v", blocks)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// auditOutputRedirected is the audit action for output posted in another
+// channel with --to.
+const auditOutputRedirected = "output_redirected"
+
+// channelIDPattern matches Slack channel IDs, which --to accepts as well
+// as names.
+var channelIDPattern = regexp.MustCompile(`^[CG][A-Z0-9]{6,}$`)
+
+// slackChannel is the part of a Slack conversation object used to resolve
+// --to.
+type slackChannel struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	IsMember bool   `json:"is_member"` // the app is in the channel
+}
+
+// classRank orders classifications from least to most restrictive.
+var classRank = map[classification]int{classPublic: 0, classInternal: 1, classSecret: 2}
+
+// findChannel resolves a channel given to --to: an ID, a name with or
+// without "#", or a channel link as Slack escapes it, <#C123|name>.
+func (s *server) findChannel(ctx context.Context, ref string) (slackChannel, error) {
+	if link, ok := strings.CutPrefix(ref, "<#"); ok {
+		ref, _, _ = strings.Cut(strings.TrimSuffix(link, ">"), "|")
+	}
+	if channelIDPattern.MatchString(ref) {
+		var out struct {
+			Channel slackChannel `json:"channel"`
+		}
+		if err := s.slack.call(ctx, "conversations.info", url.Values{"channel": {ref}}, &out); err != nil {
+			return slackChannel{}, err
+		}
+		return out.Channel, nil
+	}
+
+	name := strings.TrimPrefix(ref, "#")
+	params := url.Values{
+		"types":            {"public_channel,private_channel"},
+		"exclude_archived": {"true"},
+		"limit":            {"1000"},
+	}
+	for {
+		var out struct {
+			Channels []slackChannel `json:"channels"`
+			Metadata struct {
+				NextCursor string `json:"next_cursor"`
+			} `json:"response_metadata"`
+		}
+		if err := s.slack.call(ctx, "conversations.list", params, &out); err != nil {
+			return slackChannel{}, err
+		}
+		for _, ch := range out.Channels {
+			if ch.Name == name {
+				return ch, nil
+			}
+		}
+		if out.Metadata.NextCursor == "" {
+			return slackChannel{}, fmt.Errorf("no channel named #%s", name)
+		}
+		params.Set("cursor", out.Metadata.NextCursor)
+	}
+}
+
+// isChannelMember reports whether a user is in a channel.
+func (s *server) isChannelMember(ctx context.Context, channelID, userID string) (bool, error) {
+	params := url.Values{"channel": {channelID}, "limit": {"1000"}}
+	for {
+		var out struct {
+			Members  []string `json:"members"`
+			Metadata struct {
+				NextCursor string `json:"next_cursor"`
+			} `json:"response_metadata"`
+		}
+		if err := s.slack.call(ctx, "conversations.members", params, &out); err != nil {
+			return false, err
+		}
+		for _, m := range out.Members {
+			if m == userID {
+				return true, nil
+			}
+		}
+		if out.Metadata.NextCursor == "" {
+			return false, nil
+		}
+		params.Set("cursor", out.Metadata.NextCursor)
+	}
+}
+
+// outputAllowed reports whether the profile lets commands send output to
+// a channel with --to.
+func (p profile) outputAllowed(ch slackChannel) bool {
+	for _, allowed := range p.OutputTo {
+		if allowed == "*" || allowed == ch.ID || strings.TrimPrefix(allowed, "#") == ch.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveOutputChannel checks that a command may send its output to the
+// channel given with --to and returns the channel's ID. The source
+// channel's profile must list the channel in output_to, output must not
+// be more restricted there than where the command runs, and both the
+// invoker and the app must be in it.
+func (s *server) resolveOutputChannel(ctx context.Context, cmd slashCommand, ref string) (string, error) {
+	source := s.cfg.profileFor(cmd.ChannelID)
+	if len(source.OutputTo) == 0 {
+		return "", errors.New("--to is not allowed from this channel")
+	}
+	if source.Classification.rules().PrivateOnly || s.cfg.SensitiveChannels[cmd.ChannelID] {
+		return "", errors.New("output of this channel is private and cannot be sent elsewhere")
+	}
+	ch, err := s.findChannel(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("cannot find %s: %w", ref, err)
+	}
+	if !source.outputAllowed(ch) {
+		return "", fmt.Errorf("output cannot be sent to #%s from this channel", ch.Name)
+	}
+	target := s.cfg.profileFor(ch.ID)
+	if classRank[target.Classification] > classRank[source.Classification] || s.cfg.SensitiveChannels[ch.ID] {
+		return "", fmt.Errorf("output is more restricted in #%s than here", ch.Name)
+	}
+	if !ch.IsMember {
+		return "", fmt.Errorf("the app is not in #%s; invite it first", ch.Name)
+	}
+	member, err := s.isChannelMember(ctx, ch.ID, cmd.UserID)
+	if err != nil {
+		return "", fmt.Errorf("cannot check the members of #%s: %w", ch.Name, err)
+	}
+	if !member {
+		return "", fmt.Errorf("you are not in #%s", ch.Name)
+	}
+	return ch.ID, nil
+}
+
+// sendToChannel posts a reply in the channel given with --to, saying who
+// sent it, and returns the note left for the invoker. If posting fails
+// the reply is returned to the invoker alone instead.
+func (s *server) sendToChannel(ctx context.Context, cmd slashCommand, message map[string]string) map[string]string {
+	text := fmt.Sprintf("_sent here by <@%s> with --to_\n%s", cmd.UserID, message["text"])
+	params := url.Values{"channel": {cmd.OutputChannel}, "text": {text}}
+	if err := s.slack.call(ctx, "chat.postMessage", params, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error posting output to %s: %v\n", cmd.OutputChannel, err)
+		message["response_type"] = "ephemeral"
+		return message
+	}
+	s.auditLog.record(auditEvent{
+		Action:    auditOutputRedirected,
+		UserID:    cmd.UserID,
+		ChannelID: cmd.ChannelID,
+		TeamID:    cmd.TeamID,
+		Command:   redactLine(s.displayText(cmd)),
+		Detail:    cmd.OutputChannel,
+	})
+	return ephemeral(fmt.Sprintf("_output posted in <#%s>_", cmd.OutputChannel))
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// outputChannelSlack returns a fake Slack with #incidents (C02INCDNT), which U1
+// and the app are in, and a server whose C1 may send output to it.
+func outputChannelSlack(t *testing.T) (*fakeSlack, config) {
+	f := newFakeSlack(t)
+	f.respond("conversations.list", map[string]interface{}{"channels": []map[string]interface{}{
+		{"id": "C9", "name": "random", "is_member": true},
+		{"id": "C02INCDNT", "name": "incidents", "is_member": true},
+	}})
+	f.respond("conversations.info", map[string]interface{}{"channel": map[string]interface{}{"id": "C02INCDNT", "name": "incidents", "is_member": true}})
+	f.respond("conversations.members", map[string]interface{}{"members": []string{"U2", "U1"}})
+	cfg := f.config()
+	cfg.Profiles = []profile{{Name: "default", OutputTo: []string{"#incidents"}}}
+	return f, cfg
+}
+
+func TestHandleCommand_ToChannel(t *testing.T) {
+	for _, ref := range []string{"#incidents", "incidents", "C02INCDNT", "<#C02INCDNT|incidents>"} {
+		t.Run(ref, func(t *testing.T) {
+			f, cfg := outputChannelSlack(t)
+			cfg.DataDir = t.TempDir()
+			s := newServer(cfg)
+
+			data := url.Values{}
+			data.Set("text", "$ --to="+ref+" echo hello")
+			data.Set("channel_id", "D1")
+			data.Set("user_id", "U1")
+
+			response := postCommand(t, s, data)
+
+			if response["response_type"] != "ephemeral" || response["text"] != "_output posted in <#C02INCDNT>_" {
+				t.Errorf("Expected a private note for the invoker, got %v", response)
+			}
+			calls := f.callsTo("chat.postMessage")
+			if len(calls) != 1 || calls[0].Params.Get("channel") != "C02INCDNT" {
+				t.Fatalf("Expected output posted in #incidents, got %v", calls)
+			}
+			if text := calls[0].Params.Get("text"); !strings.Contains(text, "hello") || !strings.Contains(text, "<@U1>") {
+				t.Errorf("Expected the output with who sent it, got %q", text)
+			}
+			audit := auditLogText(t, cfg.DataDir)
+			if !strings.Contains(audit, `"action":"output_redirected"`) || !strings.Contains(audit, `"detail":"C02INCDNT"`) {
+				t.Errorf("Expected the redirect audited, got %s", audit)
+			}
+		})
+	}
+}
+
+func TestHandleCommand_ToChannelRefused(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(f *fakeSlack, cfg *config)
+		reason string
+	}{
+		{"not allowed", func(f *fakeSlack, cfg *config) { cfg.Profiles = nil }, "--to is not allowed from this channel"},
+		{"not listed", func(f *fakeSlack, cfg *config) { cfg.Profiles[0].OutputTo = []string{"#random"} }, "cannot be sent to #incidents"},
+		{"unknown channel", func(f *fakeSlack, cfg *config) {
+			f.respond("conversations.list", map[string]interface{}{"channels": []interface{}{}})
+		}, "no channel named #incidents"},
+		{"app not in channel", func(f *fakeSlack, cfg *config) {
+			f.respond("conversations.list", map[string]interface{}{"channels": []map[string]interface{}{{"id": "C02INCDNT", "name": "incidents"}}})
+		}, "the app is not in #incidents"},
+		{"invoker not in channel", func(f *fakeSlack, cfg *config) {
+			f.respond("conversations.members", map[string]interface{}{"members": []string{"U2"}})
+		}, "you are not in #incidents"},
+		{"more restricted", func(f *fakeSlack, cfg *config) {
+			cfg.Profiles = append(cfg.Profiles, profile{Name: "secret", Channels: []string{"C02INCDNT"}, Classification: classSecret})
+		}, "more restricted in #incidents"},
+		{"private source", func(f *fakeSlack, cfg *config) {
+			cfg.Profiles[0].Classification = classSecret
+		}, "output of this channel is private"},
+		{"policy", func(f *fakeSlack, cfg *config) {
+			cfg.Profiles[0].OutputTo = []string{"*"}
+			cfg.OPAURL = fakeOPA(t, func(in policyInput) interface{} {
+				if in.OutputChannel == "C02INCDNT" {
+					return map[string]string{"decision": "deny", "reason": "no output to incidents"}
+				}
+				return "allow"
+			}).URL
+		}, "no output to incidents"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, cfg := outputChannelSlack(t)
+			tt.setup(f, &cfg)
+			s := newServer(cfg)
+
+			data := url.Values{}
+			data.Set("text", "$ --to=#incidents echo hello")
+			data.Set("channel_id", "C1")
+			data.Set("user_id", "U1")
+
+			response := postCommand(t, s, data)
+
+			if !strings.Contains(response["text"], tt.reason) || strings.Contains(response["text"], "hello\n") {
+				t.Errorf("Expected the command refused with %q, got %q", tt.reason, response["text"])
+			}
+			if calls := f.callsTo("chat.postMessage"); len(calls) != 0 {
+				t.Errorf("Expected nothing posted, got %v", calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// slackMethodTiers are the calls per minute a workspace may make to the
+// methods output is streamed with, from Slack's rate limit tiers. The
+// streams running at once share them.
+var slackMethodTiers = map[string]int{
+	"chat.update":   50, // Tier 3
+	"canvases.edit": 50, // Tier 3
+}
+
+// maxPacingBackoff bounds how much rate limits slow streaming down.
+const maxPacingBackoff = 8
+
+// slackPacer spaces out the calls that stream output to one workspace.
+// Each stream waits an interval that grows with the number of streams
+// sharing the method's tier and with a backoff, doubled by each rate
+// limited response and eased by each successful one, and never calls
+// before a Retry-After has passed. A nil pacer keeps the base intervals.
+type slackPacer struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	methods map[string]*methodPace
+}
+
+// methodPace is what a pacer has observed about one method.
+type methodPace struct {
+	streams int       // streams calling the method now
+	backoff float64   // multiplies intervals, from 1 to maxPacingBackoff
+	until   time.Time // no calls before, from the last Retry-After
+}
+
+func newSlackPacer() *slackPacer {
+	return &slackPacer{now: time.Now, methods: make(map[string]*methodPace)}
+}
+
+// method returns the pace of a method. The caller must hold p.mu.
+func (p *slackPacer) method(name string) *methodPace {
+	m := p.methods[name]
+	if m == nil {
+		m = &methodPace{backoff: 1}
+		p.methods[name] = m
+	}
+	return m
+}
+
+// observe records the outcome of a call: a rate limited response, with
+// the Retry-After header it came with, slows the method down, and a
+// successful one speeds it back up.
+func (p *slackPacer) observe(method string, err error, retryAfter string) {
+	if p == nil {
+		return
+	}
+	limited := errorCodeOf(err, "") == codeSlackRateLimited
+	if err != nil && !limited {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m := p.method(method)
+	if !limited {
+		m.backoff = max(1, m.backoff-0.25)
+		return
+	}
+	m.backoff = min(2*m.backoff, maxPacingBackoff)
+	if secs, err := strconv.Atoi(retryAfter); err == nil && secs > 0 {
+		m.until = p.now().Add(time.Duration(secs) * time.Second)
+	}
+}
+
+// join counts a stream as calling a method until the returned function is
+// called.
+func (p *slackPacer) join(method string) (leave func()) {
+	if p == nil {
+		return func() {}
+	}
+	p.mu.Lock()
+	p.method(method).streams++
+	p.mu.Unlock()
+	return func() {
+		p.mu.Lock()
+		p.method(method).streams--
+		p.mu.Unlock()
+	}
+}
+
+// interval returns how long a stream should wait before its next call to
+// a method it would otherwise call every base.
+func (p *slackPacer) interval(method string, base time.Duration) time.Duration {
+	if p == nil {
+		return base
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m := p.method(method)
+	interval := base
+	if perMinute := slackMethodTiers[method]; perMinute > 0 {
+		interval = max(interval, time.Duration(m.streams)*time.Minute/time.Duration(perMinute))
+	}
+	interval = time.Duration(float64(interval) * m.backoff)
+	if wait := m.until.Sub(p.now()); wait > interval {
+		interval = wait
+	}
+	return interval
+}
+
+// scale returns how many times base a method's interval is, for streams
+// that send larger batches when they call less often.
+func (p *slackPacer) scale(method string, base time.Duration) float64 {
+	return float64(p.interval(method, base)) / float64(base)
+}
+
+// pacingLines describes the methods that are slowed down, for status.
+func (p *slackPacer) pacingLines() []string {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var lines []string
+	for name, m := range p.methods {
+		if m.backoff <= 1 && !m.until.After(p.now()) {
+			continue
+		}
+		line := fmt.Sprintf("  %s: %g× slower after rate limits", name, m.backoff)
+		if wait := m.until.Sub(p.now()); wait > 0 {
+			line += fmt.Sprintf(", paused for %s", wait.Round(time.Second))
+		}
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+	return lines
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlackPacer(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	p := newSlackPacer()
+	p.now = func() time.Time { return now }
+
+	if got := p.interval("chat.update", 3*time.Second); got != 3*time.Second {
+		t.Errorf("Expected the base interval for a lone stream, got %s", got)
+	}
+
+	// Five streams share chat.update's 50 calls a minute.
+	var leaves []func()
+	for i := 0; i < 5; i++ {
+		leaves = append(leaves, p.join("chat.update"))
+	}
+	if got := p.interval("chat.update", 3*time.Second); got != 6*time.Second {
+		t.Errorf("Expected streams to share the tier, got %s", got)
+	}
+
+	p.observe("chat.update", withCode(codeSlackRateLimited, context.Canceled), "30")
+	if got := p.interval("chat.update", 3*time.Second); got != 30*time.Second {
+		t.Errorf("Expected to wait for Retry-After, got %s", got)
+	}
+	now = now.Add(31 * time.Second)
+	if got := p.interval("chat.update", 3*time.Second); got != 12*time.Second {
+		t.Errorf("Expected the interval doubled after a rate limit, got %s", got)
+	}
+	if got := p.scale("chat.update", 3*time.Second); got != 4 {
+		t.Errorf("Expected scale 4, got %g", got)
+	}
+
+	for i := 0; i < 4; i++ {
+		p.observe("chat.update", nil, "")
+	}
+	for _, leave := range leaves {
+		leave()
+	}
+	if got := p.interval("chat.update", 3*time.Second); got != 3*time.Second {
+		t.Errorf("Expected successes and ended streams to restore the pace, got %s", got)
+	}
+
+	var nilPacer *slackPacer
+	if got := nilPacer.interval("chat.update", time.Second); got != time.Second {
+		t.Errorf("Expected a nil pacer to keep the base interval, got %s", got)
+	}
+}
+
+func TestSlackAPI_PacesAfterRateLimits(t *testing.T) {
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "20")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer limited.Close()
+
+	s := newServer(config{SlackToken: "xoxb-test", SlackAPIURL: limited.URL + "/api/"})
+	s.slack.call(context.Background(), "canvases.edit", nil, nil)
+
+	if got := s.slack.pacer.interval("canvases.edit", canvasFlushInterval); got < 19*time.Second {
+		t.Errorf("Expected appends paused for Retry-After, got %s", got)
+	}
+	result := runStatus(context.Background(), s, slashCommand{}, nil)
+	if out := strings.Join(result.Lines, "\n"); !strings.Contains(out, "canvases.edit: 2× slower after rate limits, paused for 20s") {
+		t.Errorf("Expected status to show the slowed method, got %q", out)
+	}
+}
+
+func TestCanvas_KeepsOutputWhenRateLimited(t *testing.T) {
+	f := newFakeSlack(t)
+	f.respond("canvases.edit", map[string]interface{}{"ok": false, "error": "ratelimited"})
+	s := newServer(f.config())
+	c := &canvasStream{api: s.slack, id: "F0CANVAS1"}
+
+	c.Write([]byte("one\ntwo\n"))
+	c.flush(context.Background(), false)
+	if c.pending.String() != "one\ntwo\n" || c.sent != 0 {
+		t.Errorf("Expected the output kept for the next flush, got %q", c.pending.String())
+	}
+
+	f.respond("canvases.edit", nil)
+	c.Write([]byte("three\n"))
+	c.flush(context.Background(), false)
+	edits := f.callsTo("canvases.edit")
+	if c.pending.Len() != 0 || len(edits) != 2 || !strings.Contains(edits[1].Params.Get("changes"), `one\ntwo\nthree`) {
+		t.Errorf("Expected the kept output appended with the new, got %d edits, %q pending", len(edits), c.pending.String())
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// Plugins are WASI command modules loaded from a directory. Each plugin
+// "<name>.wasm" has a manifest "<name>.json" declaring the hooks it
+// implements:
+//
+//	{"hooks": ["builtin", "filter", "policy"], "usage": "name ARGS", "summary": "..."}
+//
+// For every call the module is instantiated fresh and receives a
+// pluginRequest as JSON on stdin. It replies with a pluginResponse as JSON
+// on stdout. A "builtin" plugin adds the builtin command "<name>", a
+// "filter" plugin rewrites command output before delivery, and a "policy"
+// plugin can deny commands.
+
+// Plugin hooks.
+const (
+	hookBuiltin = "builtin"
+	hookFilter  = "filter"
+	hookPolicy  = "policy"
+)
+
+type pluginManifest struct {
+	Hooks   []string `json:"hooks"`
+	Usage   string   `json:"usage"`
+	Summary string   `json:"summary"`
+}
+
+func (m pluginManifest) has(hook string) bool {
+	for _, h := range m.Hooks {
+		if h == hook {
+			return true
+		}
+	}
+	return false
+}
+
+// pluginRequest is the JSON document a plugin reads from stdin.
+type pluginRequest struct {
+	Hook     string       `json:"hook"`
+	Args     []string     `json:"args,omitempty"`      // builtin
+	User     string       `json:"user,omitempty"`      // builtin
+	Channel  string       `json:"channel,omitempty"`   // builtin
+	Command  string       `json:"command,omitempty"`   // filter
+	Output   string       `json:"output,omitempty"`    // filter
+	ExitCode int          `json:"exit_code,omitempty"` // filter
+	Input    *policyInput `json:"input,omitempty"`     // policy
+}
+
+// pluginResponse is the JSON document a plugin writes to stdout.
+type pluginResponse struct {
+	Output   string `json:"output"`    // builtin, filter
+	ExitCode int    `json:"exit_code"` // builtin
+	Decision string `json:"decision"`  // policy
+	Reason   string `json:"reason"`    // policy
+}
+
+// pluginRescanInterval limits how often the plugins directory is checked
+// for added, changed or removed modules.
+const pluginRescanInterval = time.Second
+
+type wasmPlugin struct {
+	name     string
+	manifest pluginManifest
+	modTime  time.Time
+	compiled wazero.CompiledModule
+}
+
+// wasmPlugins loads plugins from a directory and reloads them when their
+// files change.
+type wasmPlugins struct {
+	dir     string
+	timeout time.Duration
+	runtime wazero.Runtime
+
+	mu       sync.Mutex
+	plugins  map[string]*wasmPlugin
+	lastScan time.Time
+}
+
+func newWASMPlugins(dir string, timeout time.Duration, memoryLimitMB int) (*wasmPlugins, error) {
+	ctx := context.Background()
+	rc := wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(uint32(memoryLimitMB) * 16). // 64 KiB pages
+		WithCloseOnContextDone(true)
+	r := wazero.NewRuntimeWithConfig(ctx, rc)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		r.Close(ctx)
+		return nil, err
+	}
+
+	p := &wasmPlugins{
+		dir:     dir,
+		timeout: timeout,
+		runtime: r,
+		plugins: make(map[string]*wasmPlugin),
+	}
+	p.refresh()
+	return p, nil
+}
+
+// refresh reloads the plugins directory if it was last scanned more than
+// pluginRescanInterval ago.
+func (p *wasmPlugins) refresh() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if time.Since(p.lastScan) < pluginRescanInterval {
+		return
+	}
+	p.lastScan = time.Now()
+
+	paths, err := filepath.Glob(filepath.Join(p.dir, "*.wasm"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning plugins: %v\n", err)
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".wasm")
+		seen[name] = true
+
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if old, ok := p.plugins[name]; ok && old.modTime.Equal(info.ModTime()) {
+			continue
+		}
+
+		plugin, err := p.load(name, path, info.ModTime())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading plugin %s: %v\n", name, err)
+			continue
+		}
+		if old, ok := p.plugins[name]; ok {
+			old.compiled.Close(context.Background())
+		}
+		p.plugins[name] = plugin
+		fmt.Printf("Loaded plugin %s (%s)\n", name, strings.Join(plugin.manifest.Hooks, ", "))
+	}
+
+	for name, plugin := range p.plugins {
+		if !seen[name] {
+			plugin.compiled.Close(context.Background())
+			delete(p.plugins, name)
+			fmt.Printf("Unloaded plugin %s\n", name)
+		}
+	}
+}
+
+func (p *wasmPlugins) load(name, path string, modTime time.Time) (*wasmPlugin, error) {
+	var manifest pluginManifest
+	data, err := os.ReadFile(strings.TrimSuffix(path, ".wasm") + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("parsing manifest: %w", err)
+	}
+
+	wasm, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	compiled, err := p.runtime.CompileModule(context.Background(), wasm)
+	if err != nil {
+		return nil, err
+	}
+	return &wasmPlugin{name: name, manifest: manifest, modTime: modTime, compiled: compiled}, nil
+}
+
+// withHook returns the loaded plugins implementing hook, sorted by name.
+func (p *wasmPlugins) withHook(hook string) []*wasmPlugin {
+	p.refresh()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var plugins []*wasmPlugin
+	for _, plugin := range p.plugins {
+		if plugin.manifest.has(hook) {
+			plugins = append(plugins, plugin)
+		}
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].name < plugins[j].name })
+	return plugins
+}
+
+// call runs a plugin once with the given request.
+func (p *wasmPlugins) call(ctx context.Context, plugin *wasmPlugin, req pluginRequest) (pluginResponse, error) {
+	input, err := json.Marshal(req)
+	if err != nil {
+		return pluginResponse{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	config := wazero.NewModuleConfig().
+		WithName(""). // allow concurrent instances
+		WithArgs(plugin.name).
+		WithStdin(bytes.NewReader(input)).
+		WithStdout(&stdout).
+		WithStderr(&stderr)
+
+	mod, err := p.runtime.InstantiateModule(ctx, plugin.compiled, config)
+	if mod != nil {
+		mod.Close(ctx)
+	}
+	var exitErr *sys.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 0) {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return pluginResponse{}, fmt.Errorf("plugin %s timed out after %s", plugin.name, p.timeout)
+		}
+		if ctx.Err() != nil {
+			return pluginResponse{}, ctx.Err()
+		}
+		return pluginResponse{}, fmt.Errorf("plugin %s: %w: %s", plugin.name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var resp pluginResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return pluginResponse{}, fmt.Errorf("plugin %s: invalid response: %w", plugin.name, err)
+	}
+	return resp, nil
+}
+
+// callNamed runs the plugin called name, which must implement hook.
+func (p *wasmPlugins) callNamed(ctx context.Context, name, hook string, req pluginRequest) (pluginResponse, error) {
+	for _, plugin := range p.withHook(hook) {
+		if plugin.name == name {
+			return p.call(ctx, plugin, req)
+		}
+	}
+	return pluginResponse{}, fmt.Errorf("no %s plugin %s", hook, name)
+}
+
+// builtins returns a builtin for every plugin implementing the builtin hook.
+func (p *wasmPlugins) builtins() []builtin {
+	var builtins []builtin
+	for _, plugin := range p.withHook(hookBuiltin) {
+		plugin := plugin
+		usage := plugin.manifest.Usage
+		if usage == "" {
+			usage = plugin.name
+		}
+		builtins = append(builtins, builtin{
+			Name:    plugin.name,
+			Usage:   usage,
+			Summary: plugin.manifest.Summary,
+			Run: func(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+				startTime := time.Now()
+				resp, err := p.call(ctx, plugin, pluginRequest{
+					Hook:    hookBuiltin,
+					Args:    args,
+					User:    cmd.UserID,
+					Channel: cmd.ChannelID,
+				})
+				if err != nil {
+					return commandResult{Lines: []string{err.Error()}, ExitCode: 1, Duration: time.Since(startTime)}
+				}
+				return commandResult{
+					Lines:    cleanOutput(resp.Output),
+					ExitCode: resp.ExitCode,
+					Duration: time.Since(startTime),
+				}
+			},
+		})
+	}
+	return builtins
+}
+
+// filter passes command output through every filter plugin in name order.
+// A failing filter is skipped.
+func (p *wasmPlugins) filter(ctx context.Context, command string, result commandResult) commandResult {
+	for _, plugin := range p.withHook(hookFilter) {
+		resp, err := p.call(ctx, plugin, pluginRequest{
+			Hook:     hookFilter,
+			Command:  command,
+			Output:   strings.Join(result.Lines, "\n"),
+			ExitCode: result.ExitCode,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error running filter: %v\n", err)
+			continue
+		}
+		result.Lines = cleanOutput(resp.Output)
+	}
+	return result
+}
+
+// decide asks every policy plugin about a command; the first decision
+// other than allow wins.
+func (p *wasmPlugins) decide(ctx context.Context, input policyInput) (policyDecision, error) {
+	for _, plugin := range p.withHook(hookPolicy) {
+		resp, err := p.call(ctx, plugin, pluginRequest{Hook: hookPolicy, Input: &input})
+		if err != nil {
+			return policyDecision{}, err
+		}
+		switch resp.Decision {
+		case policyAllow:
+		case policyDeny, policyApprove:
+			return policyDecision{Decision: resp.Decision, Reason: resp.Reason}, nil
+		default:
+			return policyDecision{}, fmt.Errorf("plugin %s: unknown policy decision %q", plugin.name, resp.Decision)
+		}
+	}
+	return policyDecision{Decision: policyAllow}, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testPluginBuilds sync.Map // name -> []byte
+
+// buildTestPlugin compiles testdata/plugins/<name> to WASM, once per test
+// run, and installs it with the given manifest in a new plugins directory.
+func buildTestPlugin(t *testing.T, name, manifest string) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping plugin build in short mode")
+	}
+
+	wasm, ok := testPluginBuilds.Load(name)
+	if !ok {
+		out := filepath.Join(t.TempDir(), name+".wasm")
+		cmd := exec.Command("go", "build", "-o", out, "./testdata/plugins/"+name)
+		cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Skipf("cannot build wasm plugin: %v\n%s", err, output)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wasm, _ = testPluginBuilds.LoadOrStore(name, data)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name+".wasm"), wasm.([]byte), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".json"), []byte(manifest), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestWASMPlugins(t *testing.T) {
+	dir := buildTestPlugin(t, "shout", `{"hooks": ["builtin", "filter", "policy"], "usage": "shout WORDS", "summary": "shout words"}`)
+
+	plugins, err := newWASMPlugins(dir, 10*time.Second, 64)
+	if err != nil {
+		t.Fatalf("newWASMPlugins: %v", err)
+	}
+	s := newServer(config{})
+	s.plugins = plugins
+	s.policy = plugins
+
+	data := url.Values{}
+	data.Set("text", "$ shout hello world")
+	response := postCommand(t, s, data)
+	if !strings.Contains(response["text"], "HELLO WORLD!") {
+		t.Errorf("Expected builtin and filter output, got %q", response["text"])
+	}
+
+	data.Set("text", "$ echo one; echo two")
+	response = postCommand(t, s, data)
+	if !strings.Contains(response["text"], "one!\ntwo!") {
+		t.Errorf("Expected filtered shell output, got %q", response["text"])
+	}
+
+	data.Set("text", "$ echo forbidden")
+	response = postCommand(t, s, data)
+	if response["text"] != "_denied: shouted down_ `POLICY_DENIED`" {
+		t.Errorf("Expected policy denial, got %q", response["text"])
+	}
+
+	data.Set("text", "$ help")
+	response = postCommand(t, s, data)
+	if !strings.Contains(response["text"], "shout WORDS") {
+		t.Errorf("Expected plugin builtin in help, got %q", response["text"])
+	}
+}
+
+func TestWASMPlugins_HotReload(t *testing.T) {
+	dir := buildTestPlugin(t, "shout", `{"hooks": ["builtin"]}`)
+
+	plugins, err := newWASMPlugins(dir, 10*time.Second, 64)
+	if err != nil {
+		t.Fatalf("newWASMPlugins: %v", err)
+	}
+	if len(plugins.withHook(hookBuiltin)) != 1 {
+		t.Fatal("Expected plugin to be loaded")
+	}
+
+	os.Remove(filepath.Join(dir, "shout.wasm"))
+	plugins.lastScan = time.Time{}
+	if len(plugins.withHook(hookBuiltin)) != 0 {
+		t.Error("Expected removed plugin to be unloaded")
+	}
+}
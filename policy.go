@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// policyInput is the request context a policy decides on.
+type policyInput struct {
+	User    string   `json:"user"`
+	Channel string   `json:"channel"`
+	Team    string   `json:"team"`
+	Command string   `json:"command"`
+	Tokens  []string `json:"tokens"`
+	Host    string   `json:"host"`
+	Time    string   `json:"time"`
+
+	// OutputChannel is the channel given with --to, if any.
+	OutputChannel string `json:"output_channel,omitempty"`
+	// TargetHost is the agent given with @ or --host=, if any, and
+	// TargetHosts the hosts of the group it names.
+	TargetHost  string   `json:"target_host,omitempty"`
+	TargetHosts []string `json:"target_hosts,omitempty"`
+
+	// TargetContainer is the container given with --container=, if any.
+	TargetContainer string `json:"target_container,omitempty"`
+}
+
+// Policy decisions.
+const (
+	policyAllow   = "allow"
+	policyDeny    = "deny"
+	policyApprove = "approve" // allowed only after approval
+)
+
+type policyDecision struct {
+	Decision string `json:"decision"`
+	Reason   string `json:"reason,omitempty"`
+
+	// Code explains a deny in replies; POLICY_DENIED if unset.
+	Code errorCode `json:"-"`
+}
+
+// policyEngine decides whether a command may run.
+type policyEngine interface {
+	decide(ctx context.Context, input policyInput) (policyDecision, error)
+}
+
+// policyChain consults several engines in order; the first decision other
+// than allow wins.
+type policyChain []policyEngine
+
+func (c policyChain) decide(ctx context.Context, input policyInput) (policyDecision, error) {
+	for _, engine := range c {
+		d, err := engine.decide(ctx, input)
+		if err != nil || d.Decision != policyAllow {
+			return d, err
+		}
+	}
+	return policyDecision{Decision: policyAllow}, nil
+}
+
+func newPolicyInput(cmd slashCommand, command string) policyInput {
+	host, _ := os.Hostname()
+	return policyInput{
+		User:    cmd.UserID,
+		Channel: cmd.ChannelID,
+		Team:    cmd.TeamID,
+		Command: command,
+		Tokens:  strings.Fields(command),
+		Host:    host,
+		Time:    time.Now().UTC().Format(time.RFC3339),
+
+		OutputChannel: cmd.OutputChannel,
+		TargetHost:    cmd.Host,
+		TargetHosts:   cmd.Group,
+
+		TargetContainer: cmd.Container,
+	}
+}
+
+// opaPolicy queries an Open Policy Agent server's data API, e.g.
+// http://localhost:8181/v1/data/httpshell/decision. The rule may evaluate
+// to a decision string, a boolean, or an object with "decision" and
+// "reason" fields.
+type opaPolicy struct {
+	url    string
+	client *http.Client
+}
+
+func (p *opaPolicy) decide(ctx context.Context, input policyInput) (policyDecision, error) {
+	body, err := json.Marshal(map[string]policyInput{"input": input})
+	if err != nil {
+		return policyDecision{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.url, bytes.NewReader(body))
+	if err != nil {
+		return policyDecision{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return policyDecision{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return policyDecision{}, fmt.Errorf("opa returned status %d", resp.StatusCode)
+	}
+
+	var out struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return policyDecision{}, fmt.Errorf("decoding opa response: %w", err)
+	}
+	return parseOPAResult(out.Result)
+}
+
+func parseOPAResult(result json.RawMessage) (policyDecision, error) {
+	if len(result) == 0 {
+		// OPA omits the result when the rule is undefined
+		return policyDecision{Decision: policyDeny, Reason: "no policy decision"}, nil
+	}
+
+	var allowed bool
+	if err := json.Unmarshal(result, &allowed); err == nil {
+		if allowed {
+			return policyDecision{Decision: policyAllow}, nil
+		}
+		return policyDecision{Decision: policyDeny}, nil
+	}
+
+	var d policyDecision
+	if err := json.Unmarshal(result, &d.Decision); err != nil {
+		if err := json.Unmarshal(result, &d); err != nil {
+			return d, fmt.Errorf("unexpected opa result %s", result)
+		}
+	}
+
+	switch d.Decision {
+	case policyAllow, policyDeny, policyApprove:
+		return d, nil
+	default:
+		return d, fmt.Errorf("unknown policy decision %q", d.Decision)
+	}
+}
+
+// checkPolicy evaluates the configured policy. Errors deny the command
+// unless the server is configured to fail open.
+func (s *server) checkPolicy(ctx context.Context, cmd slashCommand, command string) policyDecision {
+	if s.policy == nil {
+		return policyDecision{Decision: policyAllow}
+	}
+
+	d, err := s.policy.decide(ctx, newPolicyInput(cmd, command))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error evaluating policy: %v\n", err)
+		if s.cfg.PolicyFailOpen {
+			return policyDecision{Decision: policyAllow}
+		}
+		return policyDecision{Decision: policyDeny, Reason: "policy unavailable", Code: codeBackendUnreachable}
+	}
+	return d
+}
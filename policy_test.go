@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseOPAResult(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   string
+		expected policyDecision
+	}{
+		{"undefined", ``, policyDecision{Decision: policyDeny, Reason: "no policy decision"}},
+		{"true", `true`, policyDecision{Decision: policyAllow}},
+		{"false", `false`, policyDecision{Decision: policyDeny}},
+		{"string", `"approve"`, policyDecision{Decision: policyApprove}},
+		{"object", `{"decision": "deny", "reason": "outside business hours"}`, policyDecision{Decision: policyDeny, Reason: "outside business hours"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOPAResult(json.RawMessage(tt.result))
+			if err != nil {
+				t.Fatalf("parseOPAResult: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+
+	if _, err := parseOPAResult(json.RawMessage(`"maybe"`)); err == nil {
+		t.Error("Expected error for unknown decision")
+	}
+}
+
+// fakeOPA answers policy queries with a decision computed from the input.
+func fakeOPA(t *testing.T, decide func(policyInput) interface{}) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input policyInput `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode policy input: %v", err)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": decide(body.Input)})
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestHandleCommand_PolicyDenies(t *testing.T) {
+	opa := fakeOPA(t, func(in policyInput) interface{} {
+		if in.User == "U1" && in.Tokens[0] == "rm" {
+			return map[string]string{"decision": "deny", "reason": "no deletes"}
+		}
+		return "allow"
+	})
+	s := newServer(config{OPAURL: opa.URL})
+
+	data := url.Values{}
+	data.Set("text", "$ rm -rf /tmp/nothing")
+	data.Set("user_id", "U1")
+	response := postCommand(t, s, data)
+
+	if response["text"] != "_denied: no deletes_ `POLICY_DENIED`" {
+		t.Errorf("Expected denial, got %q", response["text"])
+	}
+	if response["error_code"] != string(codePolicyDenied) {
+		t.Errorf("Expected error_code for API clients, got %q", response["error_code"])
+	}
+
+	data.Set("text", "$ echo allowed")
+	response = postCommand(t, s, data)
+	if !strings.Contains(response["text"], "allowed") {
+		t.Errorf("Expected command to run, got %q", response["text"])
+	}
+}
+
+func TestHandleCommand_PolicyUnavailable(t *testing.T) {
+	opa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer opa.Close()
+
+	data := url.Values{}
+	data.Set("text", "$ echo hello")
+
+	response := postCommand(t, newServer(config{OPAURL: opa.URL}), data)
+	if response["text"] != "_denied: policy unavailable_ `BACKEND_UNREACHABLE`" {
+		t.Errorf("Expected fail-closed denial, got %q", response["text"])
+	}
+
+	response = postCommand(t, newServer(config{OPAURL: opa.URL, PolicyFailOpen: true}), data)
+	if !strings.Contains(response["text"], "_success") {
+		t.Errorf("Expected fail-open to run the command, got %q", response["text"])
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const prefsUsage = "usage: prefs [plain on|off]"
+
+// userPrefs are a user's own settings for how replies to them look.
+type userPrefs struct {
+	// Plain replies have no code blocks, emoji or markup, and say the
+	// status in words, for screen readers.
+	Plain   bool      `json:"plain,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+// prefStore keeps users' preferences, in the backend chosen by
+// openStores.
+type prefStore struct {
+	prefBackend
+}
+
+// prefBackend is where a prefStore keeps preferences.
+type prefBackend interface {
+	// get returns a user's preferences, or false if they have set none.
+	get(userID string) (userPrefs, bool)
+	// set replaces a user's preferences.
+	set(userID string, p userPrefs) error
+}
+
+// prefFile keeps preferences in a JSON file in the data directory. The
+// file is rewritten on every change.
+type prefFile struct {
+	path string
+
+	mu    sync.Mutex
+	users map[string]userPrefs
+}
+
+func newPrefFile(dir string) (*prefFile, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	st := &prefFile{path: filepath.Join(dir, "prefs.json"), users: map[string]userPrefs{}}
+	data, err := os.ReadFile(st.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &st.users); err != nil {
+		return nil, fmt.Errorf("%s: %w", st.path, err)
+	}
+	return st, nil
+}
+
+func (st *prefFile) get(userID string) (userPrefs, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	p, ok := st.users[userID]
+	return p, ok
+}
+
+func (st *prefFile) set(userID string, p userPrefs) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	previous, existed := st.users[userID]
+	st.users[userID] = p
+	if err := writeJSONFile(st.path, st.users); err != nil {
+		if existed {
+			st.users[userID] = previous
+		} else {
+			delete(st.users, userID)
+		}
+		return err
+	}
+	return nil
+}
+
+// sqlPrefs is a prefBackend keeping each user's preferences in a row.
+type sqlPrefs struct{ *sqlStore }
+
+func (st sqlPrefs) get(userID string) (userPrefs, bool) {
+	var entry string
+	err := st.queryRow("SELECT entry FROM prefs WHERE user_id = ?", userID).Scan(&entry)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			fmt.Fprintf(os.Stderr, "Error reading preferences of %s: %v\n", userID, err)
+		}
+		return userPrefs{}, false
+	}
+	var p userPrefs
+	if err := json.Unmarshal([]byte(entry), &p); err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading preferences of %s: %v\n", userID, err)
+		return userPrefs{}, false
+	}
+	return p, true
+}
+
+func (st sqlPrefs) set(userID string, p userPrefs) error {
+	entry, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = st.exec(`INSERT INTO prefs (user_id, entry) VALUES (?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET entry = excluded.entry`, userID, string(entry))
+	return err
+}
+
+// plainFor reports whether a user wants plain replies.
+func (s *server) plainFor(userID string) bool {
+	if s.prefs == nil || userID == "" {
+		return false
+	}
+	p, _ := s.prefs.get(userID)
+	return p.Plain
+}
+
+// runPrefs is the prefs builtin. Without arguments it shows the invoker's
+// preferences; "plain on" and "plain off" switch plain replies.
+func runPrefs(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	fail := func(code int, msg string) commandResult {
+		return commandResult{Lines: []string{msg}, ExitCode: code, Duration: time.Since(startTime)}
+	}
+	if s.prefs == nil {
+		return fail(1, "prefs needs DATA_DIR")
+	}
+	if cmd.UserID == "" {
+		return fail(1, "prefs: no user to keep preferences for")
+	}
+	p, _ := s.prefs.get(cmd.UserID)
+	if len(args) == 0 {
+		state := "off"
+		if p.Plain {
+			state = "on"
+		}
+		return commandResult{Lines: []string{"plain " + state}, Duration: time.Since(startTime)}
+	}
+	if len(args) != 2 || args[0] != "plain" || (args[1] != "on" && args[1] != "off") {
+		return fail(2, prefsUsage)
+	}
+
+	p.Plain, p.Updated = args[1] == "on", time.Now()
+	if err := s.prefs.set(cmd.UserID, p); err != nil {
+		return fail(1, "prefs: "+err.Error())
+	}
+	msg := "Replies to you are formatted as before."
+	if p.Plain {
+		msg = "Replies to you are now plain text: no code blocks, emoji or markup, and the status in words."
+	}
+	return commandResult{Lines: []string{msg}, Duration: time.Since(startTime)}
+}
+
+// plainVariant formats replies to users who asked for plain text.
+var plainVariant = formatVariant{name: "plain", format: formatPlain, status: plainStatus}
+
+// formatPlain labels the command, its output and its status on lines of
+// their own, without code blocks or markup, so a screen reader reads them
+// as sentences rather than symbols.
+func formatPlain(text string, res commandResult) string {
+	var b strings.Builder
+	if strings.TrimSpace(text) != "" {
+		fmt.Fprintf(&b, "Command: %s\n", text)
+	}
+	if len(res.Lines) > 0 {
+		b.WriteString("Output:\n")
+		b.WriteString(strings.Join(res.Lines, "\n"))
+		b.WriteString("\nEnd of output.\n")
+	} else {
+		b.WriteString("No output.\n")
+	}
+	b.WriteString(plainStatus(res))
+	return b.String()
+}
+
+// plainStatus says how a command ended and how long it took in words,
+// e.g. "Result: failed with exit code 2, misuse. Took 3 seconds."
+func plainStatus(res commandResult) string {
+	status := "succeeded"
+	switch {
+	case timedOut(res) && len(res.Lines) > 0:
+		status = "timed out, so the output is partial"
+	case timedOut(res):
+		status = "timed out"
+	case res.ExitCode != 0:
+		status = fmt.Sprintf("failed with exit code %d, %s", res.ExitCode, translateExitCode(res.ExitCode))
+	}
+	return fmt.Sprintf("Result: %s. Took %s.", status, plainDuration(res.Duration))
+}
+
+// plainDuration spells out a duration, e.g. "2 minutes 5 seconds".
+func plainDuration(d time.Duration) string {
+	unit := func(n int64, name string) string {
+		if n == 1 {
+			return "1 " + name
+		}
+		return fmt.Sprintf("%d %ss", n, name)
+	}
+	switch {
+	case d < time.Second:
+		return unit(d.Milliseconds(), "millisecond")
+	case d < time.Minute:
+		return unit(int64(d.Round(time.Second)/time.Second), "second")
+	}
+	d = d.Round(time.Second)
+	minutes, seconds := int64(d/time.Minute), int64(d%time.Minute/time.Second)
+	if seconds == 0 {
+		return unit(minutes, "minute")
+	}
+	return unit(minutes, "minute") + " " + unit(seconds, "second")
+}
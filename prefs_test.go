@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatPlain(t *testing.T) {
+	tests := []struct {
+		res  commandResult
+		want string
+	}{
+		{
+			commandResult{Lines: []string{"up 3 days"}, Duration: 1500 * time.Microsecond},
+			"Command: $ uptime\nOutput:\nup 3 days\nEnd of output.\nResult: succeeded. Took 1 millisecond.",
+		},
+		{
+			commandResult{ExitCode: 127, Duration: 2 * time.Second},
+			"Command: $ uptime\nNo output.\nResult: failed with exit code 127, not found. Took 2 seconds.",
+		},
+		{
+			commandResult{Lines: []string{"partial"}, ExitCode: 124, Duration: 125 * time.Second},
+			"Command: $ uptime\nOutput:\npartial\nEnd of output.\nResult: timed out, so the output is partial. Took 2 minutes 5 seconds.",
+		},
+	}
+	for _, tt := range tests {
+		if got := formatPlain("$ uptime", tt.res); got != tt.want {
+			t.Errorf("formatPlain(%+v) = %q, want %q", tt.res, got, tt.want)
+		}
+	}
+}
+
+func TestHandleCommand_PlainPreference(t *testing.T) {
+	s := newServer(config{DataDir: t.TempDir()})
+
+	data := url.Values{}
+	data.Set("user_id", "U1")
+	data.Set("text", "$ prefs plain on")
+	if response := postCommand(t, s, data); !strings.Contains(response["text"], "now plain text") {
+		t.Fatalf("Expected plain replies switched on, got %q", response["text"])
+	}
+
+	data.Set("text", "$ echo hello")
+	response := postCommand(t, s, data)
+	if strings.ContainsAny(response["text"], "`_*") || !strings.Contains(response["text"], "Output:\nhello\n") {
+		t.Errorf("Expected a plain reply, got %q", response["text"])
+	}
+
+	data.Set("user_id", "U2")
+	if response := postCommand(t, s, data); !strings.HasPrefix(response["text"], "```$ echo hello") {
+		t.Errorf("Expected other users' replies unchanged, got %q", response["text"])
+	}
+
+	// The preference is kept across restarts.
+	s = newServer(s.cfg)
+	if !s.plainFor("U1") || s.plainFor("U2") {
+		t.Error("Expected U1's preference to be stored")
+	}
+}
+
+func TestPrefs_Usage(t *testing.T) {
+	s := newServer(config{DataDir: t.TempDir()})
+	result := runPrefs(context.Background(), s, slashCommand{UserID: "U1"}, []string{"plain", "maybe"})
+	if result.ExitCode != 2 || result.Lines[0] != prefsUsage {
+		t.Errorf("Expected usage, got %+v", result)
+	}
+	if result := runPrefs(context.Background(), s, slashCommand{UserID: "U1"}, nil); result.Lines[0] != "plain off" {
+		t.Errorf("Expected the default shown, got %+v", result)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+func fileOwner(info os.FileInfo) (uid, gid uint32, ok bool) {
+	return 0, 0, false
+}
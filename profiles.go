@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// classification is the data egress class of a profile. It controls how
+// command output may leave the host.
+type classification string
+
+const (
+	classPublic   classification = "public"
+	classInternal classification = "internal"
+	classSecret   classification = "secret"
+)
+
+// egressRules are the delivery restrictions implied by a classification.
+type egressRules struct {
+	Redact      bool // redact secrets from output before delivery
+	PrivateOnly bool // deliver output only to the invoker
+	FileUploads bool // allow output to be uploaded as a file
+}
+
+func (c classification) rules() egressRules {
+	switch c {
+	case classSecret:
+		return egressRules{Redact: true, PrivateOnly: true}
+	case classInternal:
+		return egressRules{Redact: true, FileUploads: true}
+	default:
+		return egressRules{FileUploads: true}
+	}
+}
+
+// profile groups settings applied to commands run from a set of channels.
+type profile struct {
+	Name           string         `json:"name"`
+	Channels       []string       `json:"channels"`
+	Classification classification `json:"classification"`
+
+	// LintLevel is the least severe lint finding shown: error, warning,
+	// info or style (the default).
+	LintLevel string `json:"lint_level"`
+
+	// Diagnostics attaches a bundle describing the host to the thread of
+	// every command that fails.
+	Diagnostics bool `json:"diagnostics"`
+
+	// DM delivers all output to the invoker's DM instead of the channel,
+	// as with the --dm meta-flag.
+	DM bool `json:"dm"`
+
+	// Agent names the agent that runs shell commands from the profile's
+	// channels on its host, instead of the server.
+	Agent string `json:"agent"`
+
+	// Hosts maps host name patterns, such as "web*", to the users who may
+	// send commands to the agents they match with "$ @web01 uptime" or
+	// --host=, or "*" for anyone. Without it no host can be targeted.
+	Hosts map[string][]string `json:"hosts"`
+
+	// Container names a running Docker container that runs the shell
+	// commands of the profile's channels with docker exec, and Image an
+	// image each command is run in a new container of instead.
+	Container string `json:"container"`
+	Image     string `json:"image"`
+
+	// Containers lists container name patterns, such as "app-*", that
+	// users may run a command in with --container=. Without it
+	// --container is refused.
+	Containers []string `json:"containers"`
+
+	// Sandbox restricts the paths and system calls of the shell commands
+	// the profile's channels run on the server's host.
+	Sandbox *localSandbox `json:"sandbox"`
+
+	// CommandEcho is how the command is shown with its public output and
+	// in other messages others can see: "full" (the default), "mask",
+	// which shows the program's name only, or "omit". The invoker is shown
+	// the command alone.
+	CommandEcho string `json:"command_echo"`
+
+	// OutputTo lists the channels, by ID or name, that commands run in the
+	// profile's channels may post their output to with --to; "*" allows
+	// any. Without it --to is refused.
+	OutputTo []string `json:"output_to"`
+
+	// LiveOutput shows output as it arrives in one message that is edited
+	// with its latest lines, and deleted once the result is posted.
+	LiveOutput bool `json:"live_output"`
+
+	// ReplyBroadcast also shows results posted as thread replies in the
+	// channel, so they are not buried in threads nobody reopens.
+	ReplyBroadcast bool `json:"reply_broadcast"`
+
+	// History is who may see the channel's stored jobs: "own", the
+	// default, limits users to their own jobs, and "channel" shares a
+	// channel's public jobs with everyone who asks from it. Admins see all.
+	History string `json:"history"`
+
+	// SoftTimeout is how long a command runs before it is reported as
+	// still running and left to finish in the background. MaxDuration
+	// kills it, overriding COMMAND_TIMEOUT. Both are durations such as
+	// "10m"; loadProfiles parses them into softTimeout and maxDuration.
+	SoftTimeout string `json:"soft_timeout"`
+	MaxDuration string `json:"max_duration"`
+
+	softTimeout time.Duration
+	maxDuration time.Duration
+}
+
+// defaultProfileName is the profile used for channels not listed by any
+// other profile.
+const defaultProfileName = "default"
+
+func loadProfiles(path string) ([]profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []profile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	for i, p := range profiles {
+		if p.Name == "" {
+			return nil, fmt.Errorf("profile %d: missing name", i)
+		}
+		switch p.Classification {
+		case "":
+			profiles[i].Classification = classPublic
+		case classPublic, classInternal, classSecret:
+		default:
+			return nil, fmt.Errorf("profile %q: unknown classification %q", p.Name, p.Classification)
+		}
+		if _, ok := lintRank[p.LintLevel]; p.LintLevel != "" && !ok {
+			return nil, fmt.Errorf("profile %q: unknown lint level %q", p.Name, p.LintLevel)
+		}
+		switch p.History {
+		case "", historyOwn, historyChannel:
+		default:
+			return nil, fmt.Errorf("profile %q: unknown history visibility %q", p.Name, p.History)
+		}
+		if p.SoftTimeout != "" {
+			if profiles[i].softTimeout, err = time.ParseDuration(p.SoftTimeout); err != nil {
+				return nil, fmt.Errorf("profile %q: soft_timeout: %w", p.Name, err)
+			}
+		}
+		if p.MaxDuration != "" {
+			if profiles[i].maxDuration, err = time.ParseDuration(p.MaxDuration); err != nil {
+				return nil, fmt.Errorf("profile %q: max_duration: %w", p.Name, err)
+			}
+		}
+		switch p.CommandEcho {
+		case "", echoFull, echoMask, echoOmit:
+		default:
+			return nil, fmt.Errorf("profile %q: unknown command_echo %q", p.Name, p.CommandEcho)
+		}
+		if p.Agent != "" && !agentNamePattern.MatchString(p.Agent) {
+			return nil, fmt.Errorf("profile %q: invalid agent name %q", p.Name, p.Agent)
+		}
+		for pattern := range p.Hosts {
+			if !validHostPattern(pattern) {
+				return nil, fmt.Errorf("profile %q: invalid hosts pattern %q", p.Name, pattern)
+			}
+		}
+		if p.Container != "" && p.Image != "" || p.Agent != "" && (p.Container != "" || p.Image != "") {
+			return nil, fmt.Errorf("profile %q: only one of agent, container and image may be set", p.Name)
+		}
+		if p.Container != "" && !containerNamePattern.MatchString(p.Container) {
+			return nil, fmt.Errorf("profile %q: invalid container name %q", p.Name, p.Container)
+		}
+		if p.Image != "" && !validImage(p.Image) {
+			return nil, fmt.Errorf("profile %q: invalid image %q", p.Name, p.Image)
+		}
+		for _, pattern := range p.Containers {
+			if !validHostPattern(pattern) {
+				return nil, fmt.Errorf("profile %q: invalid containers pattern %q", p.Name, pattern)
+			}
+		}
+		if p.Sandbox != nil {
+			if p.Agent != "" || p.Container != "" || p.Image != "" {
+				return nil, fmt.Errorf("profile %q: sandbox only applies to commands run on the server's host", p.Name)
+			}
+			if err := p.Sandbox.validate(); err != nil {
+				return nil, fmt.Errorf("profile %q: sandbox: %w", p.Name, err)
+			}
+		}
+		if limit := profiles[i].maxDuration; limit > 0 && profiles[i].softTimeout >= limit {
+			return nil, fmt.Errorf("profile %q: soft_timeout must be shorter than max_duration", p.Name)
+		}
+	}
+	return profiles, nil
+}
+
+// profileFor returns the profile for a channel, falling back to the
+// default profile and then to an unrestricted public profile.
+func (c config) profileFor(channelID string) profile {
+	var fallback *profile
+	for i, p := range c.Profiles {
+		for _, ch := range p.Channels {
+			if ch == channelID {
+				return p
+			}
+		}
+		if p.Name == defaultProfileName {
+			fallback = &c.Profiles[i]
+		}
+	}
+	if fallback != nil {
+		return *fallback
+	}
+	return profile{Name: defaultProfileName, Classification: classPublic}
+}
+
+// lintLevel returns the profile's lint threshold.
+func (p profile) lintLevel() string {
+	if p.LintLevel == "" {
+		return lintStyle
+	}
+	return p.LintLevel
+}
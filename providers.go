@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Command providers are executables that add builtins, discovered in a
+// directory at startup. They speak JSON over stdio: each call starts the
+// executable, writes one providerRequest to its stdin and reads one
+// providerResponse from its stdout.
+//
+// At startup every provider is asked to describe itself:
+//
+//	{"method": "describe"}
+//	{"builtins": [{"name": "deploy", "usage": "deploy SERVICE", "summary": "deploy a service"}]}
+//
+// and each of its builtins is then run with:
+//
+//	{"method": "run", "builtin": "deploy", "args": ["api"], "user": "U0123", "channel": "C0123"}
+//	{"output": "deployed api", "exit_code": 0}
+
+type providerRequest struct {
+	Method  string   `json:"method"`
+	Builtin string   `json:"builtin,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	User    string   `json:"user,omitempty"`
+	Channel string   `json:"channel,omitempty"`
+}
+
+type providerResponse struct {
+	Builtins []struct {
+		Name    string `json:"name"`
+		Usage   string `json:"usage"`
+		Summary string `json:"summary"`
+	} `json:"builtins"`
+	Output   string `json:"output"`
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error"`
+}
+
+// loadProviders describes every executable in dir and returns the builtins
+// they provide. Providers that fail to describe themselves are skipped.
+func loadProviders(dir string, timeout time.Duration) []builtin {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading providers: %v\n", err)
+		return nil
+	}
+
+	var builtins []builtin
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+
+		resp, err := callProvider(context.Background(), path, timeout, providerRequest{Method: "describe"})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading provider %s: %v\n", entry.Name(), err)
+			continue
+		}
+
+		for _, b := range resp.Builtins {
+			name := b.Name
+			usage := b.Usage
+			if usage == "" {
+				usage = name
+			}
+			builtins = append(builtins, builtin{
+				Name:    name,
+				Usage:   usage,
+				Summary: b.Summary,
+				Run: func(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+					startTime := time.Now()
+					resp, err := callProvider(ctx, path, timeout, providerRequest{
+						Method:  "run",
+						Builtin: name,
+						Args:    args,
+						User:    cmd.UserID,
+						Channel: cmd.ChannelID,
+					})
+					if err != nil {
+						return commandResult{Lines: []string{err.Error()}, ExitCode: 1, Duration: time.Since(startTime)}
+					}
+					return commandResult{
+						Lines:    cleanOutput(resp.Output),
+						ExitCode: resp.ExitCode,
+						Duration: time.Since(startTime),
+					}
+				},
+			})
+		}
+		fmt.Printf("Loaded provider %s (%d builtins)\n", entry.Name(), len(resp.Builtins))
+	}
+
+	sort.Slice(builtins, func(i, j int) bool { return builtins[i].Name < builtins[j].Name })
+	return builtins
+}
+
+// callProvider runs a provider executable once with the given request.
+func callProvider(ctx context.Context, path string, timeout time.Duration, req providerRequest) (providerResponse, error) {
+	input, err := json.Marshal(req)
+	if err != nil {
+		return providerResponse{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return providerResponse{}, fmt.Errorf("provider %s timed out after %s", filepath.Base(path), timeout)
+		}
+		if ctx.Err() != nil {
+			return providerResponse{}, ctx.Err()
+		}
+		return providerResponse{}, fmt.Errorf("provider %s: %w: %s", filepath.Base(path), err, strings.TrimSpace(stderr.String()))
+	}
+
+	var resp providerResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return providerResponse{}, fmt.Errorf("provider %s: invalid response: %w", filepath.Base(path), err)
+	}
+	if resp.Error != "" {
+		return providerResponse{}, fmt.Errorf("provider %s: %s", filepath.Base(path), resp.Error)
+	}
+	return resp, nil
+}
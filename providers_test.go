@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testProvider = `#!/bin/sh
+input=$(cat)
+case "$input" in
+*'"method":"describe"'*)
+	echo '{"builtins": [{"name": "greet", "usage": "greet NAME", "summary": "say hello"}]}'
+	;;
+*'"builtin":"greet"'*)
+	name=$(echo "$input" | sed 's/.*"args":\["\([^"]*\)".*/\1/')
+	echo "{\"output\": \"hello $name\", \"exit_code\": 0}"
+	;;
+esac
+`
+
+func TestLoadProviders(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "greeter"), []byte(testProvider), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Non-executable files are ignored
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("docs"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newServer(config{})
+	s.providerBuiltins = loadProviders(dir, 5*time.Second)
+
+	if len(s.providerBuiltins) != 1 {
+		t.Fatalf("Expected 1 provider builtin, got %d", len(s.providerBuiltins))
+	}
+
+	data := url.Values{}
+	data.Set("text", "$ greet world")
+	response := postCommand(t, s, data)
+	if !strings.Contains(response["text"], "hello world") {
+		t.Errorf("Expected provider output, got %q", response["text"])
+	}
+
+	data.Set("text", "$ help")
+	response = postCommand(t, s, data)
+	if !strings.Contains(response["text"], "greet NAME") {
+		t.Errorf("Expected provider builtin in help, got %q", response["text"])
+	}
+}
+
+func TestCallProvider_Timeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slow")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\nexec sleep 5\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := callProvider(context.Background(), path, 100*time.Millisecond, providerRequest{Method: "describe"})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Default pseudo-terminal size for commands run with a PTY.
+const (
+	ptyCols = 120
+	ptyRows = 40
+)
+
+// ptyDrainTimeout bounds how long output is read after the command exits,
+// in case a background process keeps the terminal open.
+const ptyDrainTimeout = 100 * time.Millisecond
+
+// runPTY runs cmd attached to a pseudo-terminal and returns its output.
+// Output is also copied to progress, if set, as it is produced.
+func runPTY(cmd *exec.Cmd, progress io.Writer) (string, error) {
+	cmd.Env = append(cmd.Environ(), "TERM=xterm",
+		fmt.Sprintf("COLUMNS=%d", ptyCols), fmt.Sprintf("LINES=%d", ptyRows))
+
+	master, err := startPTY(cmd, ptyCols, ptyRows)
+	if err != nil {
+		return err.Error(), err
+	}
+	defer master.Close()
+
+	var output bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		// Reading fails with EIO once the terminal is closed.
+		var w io.Writer = &output
+		if progress != nil {
+			w = io.MultiWriter(&output, progress)
+		}
+		io.Copy(w, master)
+		close(done)
+	}()
+
+	err = cmd.Wait()
+
+	select {
+	case <-done:
+	case <-time.After(ptyDrainTimeout):
+		master.Close()
+		<-done
+	}
+
+	// Terminals translate "\n" to "\r\n"
+	return strings.ReplaceAll(output.String(), "\r\n", "\n"), err
+}
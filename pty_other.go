@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+func startPTY(cmd *exec.Cmd, cols, rows int) (*os.File, error) {
+	return nil, errors.New("pty is not supported on this platform")
+}
+
+// ptySupported reports whether startPTY works on this platform.
+const ptySupported = false
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRunCommand_PTY(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("pty is only supported on linux")
+	}
+
+	result := runCommand(context.Background(), "if [ -t 1 ]; then echo tty; else echo notty; fi; stty size", runOptions{PTY: true})
+
+	if result.ExitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d (%q)", result.ExitCode, result.Lines)
+	}
+	if got := strings.Join(result.Lines, "\n"); got != "tty\n40 120" {
+		t.Errorf("Expected terminal with default size, got %q", got)
+	}
+}
+
+func TestRunCommand_NoPTY(t *testing.T) {
+	result := runCommand(context.Background(), "if [ -t 1 ]; then echo tty; else echo notty; fi", runOptions{})
+
+	if got := strings.Join(result.Lines, "\n"); got != "notty" {
+		t.Errorf("Expected no terminal, got %q", got)
+	}
+}
+
+func TestRunCommand_PTYExitCode(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("pty is only supported on linux")
+	}
+
+	result := runCommand(context.Background(), "exit 3", runOptions{PTY: true})
+	if result.ExitCode != 3 {
+		t.Errorf("Expected exit code 3, got %d", result.ExitCode)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// queuedMessage is the immediate reply to a slash command that has been
+// queued.
+const queuedMessage = "_queued; the result will be posted when it finishes_"
+
+// queuedCommand is a slash command accepted into the inbound queue.
+// Started is set once it began to run.
+type queuedCommand struct {
+	ID      int64
+	Cmd     slashCommand
+	Started bool
+}
+
+// inboundQueue keeps accepted slash commands in an SQLite database in the
+// data directory until their results have been posted, so commands are
+// not lost if the server stops in between. It is local to each server,
+// even when the store is shared.
+type inboundQueue struct {
+	db *sql.DB
+}
+
+func newInboundQueue(dir string) (*inboundQueue, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "queue.db")
+	// synchronous=FULL makes each accepted command durable before it is
+	// acknowledged.
+	db, err := sql.Open("sqlite", sqliteDSN(path, "_pragma=busy_timeout(5000)&_pragma=synchronous(FULL)"))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS inbound (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		command TEXT NOT NULL,
+		started INTEGER NOT NULL DEFAULT 0)`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	return &inboundQueue{db: db}, nil
+}
+
+// push adds a command to the queue and returns its ID.
+func (q *inboundQueue) push(cmd slashCommand) (int64, error) {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return 0, err
+	}
+	res, err := q.db.Exec("INSERT INTO inbound (command) VALUES (?)", string(data))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// start marks a command as running.
+func (q *inboundQueue) start(id int64) error {
+	_, err := q.db.Exec("UPDATE inbound SET started = 1 WHERE id = ?", id)
+	return err
+}
+
+// done removes a command whose result has been posted.
+func (q *inboundQueue) done(id int64) error {
+	_, err := q.db.Exec("DELETE FROM inbound WHERE id = ?", id)
+	return err
+}
+
+// pending returns the commands in the queue, oldest first.
+func (q *inboundQueue) pending() ([]queuedCommand, error) {
+	rows, err := q.db.Query("SELECT id, command, started FROM inbound ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var queued []queuedCommand
+	for rows.Next() {
+		var qc queuedCommand
+		var data string
+		if err := rows.Scan(&qc.ID, &data, &qc.Started); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &qc.Cmd); err != nil {
+			return nil, fmt.Errorf("reading queued command %d: %w", qc.ID, err)
+		}
+		queued = append(queued, qc)
+	}
+	return queued, rows.Err()
+}
+
+// enqueue accepts a slash command into the queue and runs it in the
+// background, posting its result later. It reports false if the command
+// could not be queued, in which case it should be run straight away.
+func (s *server) enqueue(cmd slashCommand) bool {
+	id, err := s.queue.push(cmd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error queueing command: %v\n", err)
+		return false
+	}
+	go s.runQueued(context.Background(), queuedCommand{ID: id, Cmd: cmd})
+	return true
+}
+
+// runQueued runs a queued command, posts its result and removes it from
+// the queue. Its result is always posted later, so there is no soft
+// timeout, which would let the command be removed before its result is
+// delivered.
+func (s *server) runQueued(ctx context.Context, qc queuedCommand) {
+	if err := s.queue.start(qc.ID); err != nil {
+		fmt.Fprintf(os.Stderr, "Error marking queued command %d: %v\n", qc.ID, err)
+	}
+	s.postLater(ctx, qc.Cmd, s.processCommand(ctx, qc.Cmd))
+	if err := s.queue.done(qc.ID); err != nil {
+		fmt.Fprintf(os.Stderr, "Error removing queued command %d: %v\n", qc.ID, err)
+	}
+}
+
+// recoverQueue handles the commands left in the queue when the server
+// last stopped. Those that had not started are run now. Those that had
+// are not run again, since they may have had effects, and their users
+// are told so.
+func (s *server) recoverQueue(ctx context.Context) {
+	queued, err := s.queue.pending()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading queued commands: %v\n", err)
+		return
+	}
+	for _, qc := range queued {
+		if !qc.Started {
+			go s.runQueued(ctx, qc)
+			continue
+		}
+		s.auditLog.record(auditEvent{
+			Action:    "command_interrupted",
+			UserID:    qc.Cmd.UserID,
+			ChannelID: qc.Cmd.ChannelID,
+			TeamID:    qc.Cmd.TeamID,
+			Command:   redactLine(qc.Cmd.Text),
+			Detail:    "the server stopped while it ran",
+		})
+		s.postLater(ctx, qc.Cmd, ephemeral(fmt.Sprintf("_`%s` did not finish: the server restarted while it ran, and it was not run again_", redactLine(qc.Cmd.Text))))
+		if err := s.queue.done(qc.ID); err != nil {
+			fmt.Fprintf(os.Stderr, "Error removing queued command %d: %v\n", qc.ID, err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleCommand_Queued(t *testing.T) {
+	ts, messages := messageRecorder(t)
+	dir := t.TempDir()
+	s := newServer(config{DataDir: dir, Queue: true})
+
+	data := url.Values{}
+	data.Set("text", "$ echo queued")
+	data.Set("user_id", "U1")
+	data.Set("response_url", ts.URL)
+
+	response := postCommand(t, s, data)
+	if response["text"] != queuedMessage || response["response_type"] != "ephemeral" {
+		t.Fatalf("Expected the command acknowledged as queued, got %v", response)
+	}
+
+	select {
+	case m := <-messages:
+		if text, _ := m["text"].(string); !strings.Contains(text, "queued") || !strings.Contains(text, "_success") {
+			t.Errorf("Expected the result posted to the response_url, got %v", m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the result posted")
+	}
+	waitForQueue(t, s, 0)
+}
+
+func TestRunQueued_SoftTimeout(t *testing.T) {
+	ts, messages := messageRecorder(t)
+	s := newServer(config{DataDir: t.TempDir(), Queue: true, Profiles: []profile{{Name: "default", softTimeout: 10 * time.Millisecond}}})
+	id, err := s.queue.push(slashCommand{Text: "$ sleep 0.2; echo finished", UserID: "U1", ResponseURL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queued, err := s.queue.pending()
+	if err != nil || len(queued) != 1 || queued[0].ID != id {
+		t.Fatalf("Expected the command queued, got %+v (%v)", queued, err)
+	}
+
+	// The command stays queued until its result has been posted.
+	s.runQueued(context.Background(), queued[0])
+	select {
+	case m := <-messages:
+		if text, _ := m["text"].(string); !strings.Contains(text, "finished") {
+			t.Errorf("Expected the final result posted, got %v", m)
+		}
+	default:
+		t.Fatal("Expected the result posted before the command left the queue")
+	}
+	waitForQueue(t, s, 0)
+}
+
+// waitForQueue waits until n commands are left in the queue.
+func waitForQueue(t *testing.T, s *server, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		queued, err := s.queue.pending()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(queued) == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d queued commands, got %+v", n, queued)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRecoverQueue(t *testing.T) {
+	ts, messages := messageRecorder(t)
+	dir := t.TempDir()
+	queue, err := newInboundQueue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One command was accepted and one was running when the server
+	// stopped.
+	if _, err := queue.push(slashCommand{Text: "$ echo accepted", UserID: "U1", ResponseURL: ts.URL}); err != nil {
+		t.Fatal(err)
+	}
+	running, err := queue.push(slashCommand{Text: "$ touch /tmp/once", UserID: "U1", ResponseURL: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.start(running)
+	queue.db.Close()
+
+	s := newServer(config{DataDir: dir, Queue: true})
+	s.recoverQueue(context.Background())
+
+	var texts []string
+	for len(texts) < 2 {
+		select {
+		case m := <-messages:
+			text, _ := m["text"].(string)
+			texts = append(texts, text)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected two messages, got %q", texts)
+		}
+	}
+	joined := strings.Join(texts, "\n")
+	if !strings.Contains(joined, "accepted\n") {
+		t.Errorf("Expected the accepted command run, got %q", texts)
+	}
+	if !strings.Contains(joined, "`$ touch /tmp/once` did not finish: the server restarted while it ran, and it was not run again") {
+		t.Errorf("Expected the interrupted command reported, got %q", texts)
+	}
+	waitForQueue(t, s, 0)
+
+	data := auditLogText(t, dir)
+	if !strings.Contains(data, `"action":"command_interrupted"`) {
+		t.Errorf("Expected the interruption audited, got %s", data)
+	}
+}
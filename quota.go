@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// quotaStats counts what was sent to the workspace today and how often a
+// quota changed how output was delivered: uploaded_bytes, messages,
+// upload_quota_hits and message_quota_hits.
+var quotaStats = expvar.NewMap("workspace_usage")
+
+// dailyUsage is what was sent to the workspace on one day.
+type dailyUsage struct {
+	Day      string `json:"day"` // "2006-01-02" in the server's time zone
+	Bytes    int64  `json:"bytes"`
+	Messages int64  `json:"messages"`
+}
+
+// usageQuota counts the bytes uploaded and messages posted to the
+// workspace each day against daily caps, so one noisy day cannot exhaust
+// the workspace's file storage or message limits. With a data directory
+// the counts are kept in usage.json there and survive restarts.
+type usageQuota struct {
+	maxBytes    int64 // zero for no limit
+	maxMessages int64 // zero for no limit
+	path        string
+	now         func() time.Time
+
+	mu    sync.Mutex
+	usage dailyUsage
+}
+
+func newUsageQuota(dir string, maxBytes, maxMessages int64) *usageQuota {
+	q := &usageQuota{maxBytes: maxBytes, maxMessages: maxMessages, now: time.Now}
+	if dir == "" {
+		return q
+	}
+	q.path = filepath.Join(dir, "usage.json")
+	data, err := os.ReadFile(q.path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "Error loading usage: %v\n", err)
+		}
+		return q
+	}
+	if err := json.Unmarshal(data, &q.usage); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading usage: %s: %v\n", q.path, err)
+	}
+	return q
+}
+
+// today returns the usage so far today, starting a new day if needed.
+// The caller must hold q.mu.
+func (q *usageQuota) today() *dailyUsage {
+	if day := q.now().Format("2006-01-02"); q.usage.Day != day {
+		q.usage = dailyUsage{Day: day}
+	}
+	return &q.usage
+}
+
+// canUpload reports whether n more bytes may be uploaded today. A nil
+// quota allows everything.
+func (q *usageQuota) canUpload(n int64) bool {
+	if q == nil || q.maxBytes <= 0 {
+		return true
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.today().Bytes+n > q.maxBytes {
+		quotaStats.Add("upload_quota_hits", 1)
+		return false
+	}
+	return true
+}
+
+// canPost reports whether n more messages may be posted today.
+func (q *usageQuota) canPost(n int) bool {
+	if q == nil || q.maxMessages <= 0 {
+		return true
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.today().Messages+int64(n) > q.maxMessages {
+		quotaStats.Add("message_quota_hits", 1)
+		return false
+	}
+	return true
+}
+
+// countUpload records n bytes uploaded.
+func (q *usageQuota) countUpload(n int64) {
+	q.count(n, 0)
+}
+
+// countMessages records n messages posted.
+func (q *usageQuota) countMessages(n int) {
+	q.count(0, int64(n))
+}
+
+func (q *usageQuota) count(bytes, messages int64) {
+	if q == nil {
+		return
+	}
+	quotaStats.Add("uploaded_bytes", bytes)
+	quotaStats.Add("messages", messages)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	u := q.today()
+	u.Bytes += bytes
+	u.Messages += messages
+	if q.path == "" {
+		return
+	}
+	if err := writeJSONFile(q.path, u); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving usage: %v\n", err)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUsageQuota_ResetsDaily(t *testing.T) {
+	q := newUsageQuota("", 100, 2)
+	now := time.Date(2024, 3, 1, 23, 0, 0, 0, time.Local)
+	q.now = func() time.Time { return now }
+
+	q.countUpload(80)
+	q.countMessages(2)
+	if q.canUpload(30) || q.canPost(1) {
+		t.Fatal("Expected both quotas to be reached")
+	}
+	if !q.canUpload(20) {
+		t.Error("Expected an upload within the quota to be allowed")
+	}
+
+	now = now.Add(2 * time.Hour)
+	if !q.canUpload(100) || !q.canPost(2) {
+		t.Error("Expected the quotas to reset on a new day")
+	}
+}
+
+func TestUsageQuota_Persisted(t *testing.T) {
+	dir := t.TempDir()
+	newUsageQuota(dir, 0, 3).countMessages(3)
+
+	if newUsageQuota(dir, 0, 3).canPost(1) {
+		t.Error("Expected the day's count to survive a restart")
+	}
+}
+
+func TestHandleCommand_UploadQuotaLinksTranscript(t *testing.T) {
+	f := newFakeSlack(t)
+	cfg := f.config()
+	cfg.MaxMessageChars = 500
+	cfg.UploadQuotaBytes = 100
+	cfg.DataDir = t.TempDir()
+	cfg.PublicURL = "https://shell.example.com"
+	s := newServer(cfg)
+
+	data := url.Values{}
+	data.Set("text", "$ seq 1 1000")
+	data.Set("channel_id", "C1")
+	response := postCommand(t, s, data)
+
+	if calls := f.callsTo("files.getUploadURLExternal"); len(calls) != 0 {
+		t.Errorf("Expected no upload over the quota, got %d calls", len(calls))
+	}
+	if !strings.Contains(response["text"], "more lines truncated") || !strings.Contains(response["text"], "https://shell.example.com/debug/transcripts/") {
+		t.Errorf("Expected a preview linking the transcript, got %q", response["text"])
+	}
+}
+
+func TestHandleCommand_MessageQuotaRepliesEphemerally(t *testing.T) {
+	s := newServer(config{MessageQuota: 1})
+
+	data := url.Values{}
+	data.Set("text", "$ echo hi")
+	if response := postCommand(t, s, data); response["response_type"] != "in_channel" {
+		t.Fatalf("Expected the first reply in the channel, got %v", response)
+	}
+
+	response := postCommand(t, s, data)
+	if response["response_type"] != "ephemeral" || !strings.Contains(response["text"], "daily message quota reached") {
+		t.Errorf("Expected an ephemeral reply over the quota, got %v", response)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// Reactions marking the message a command was taken from with its status.
+const (
+	reactionRunning = "hourglass_flowing_sand" // ⏳
+	reactionSuccess = "white_check_mark"       // ✅
+	reactionFailure = "x"                      // ❌
+	reactionStopped = "octagonal_sign"         // 🛑
+)
+
+// statusReactions marks a command's message while it runs and with its
+// outcome, so its status shows without opening the thread. Commands not
+// taken from a message, such as slash commands, have nothing to mark.
+type statusReactions struct {
+	s   *server
+	cmd slashCommand
+}
+
+func (s *server) startReactions(ctx context.Context, cmd slashCommand) *statusReactions {
+	// Users who asked for plain replies get their status in words.
+	if s.slack == nil || cmd.MessageTS == "" || s.plainFor(cmd.UserID) {
+		return nil
+	}
+	r := &statusReactions{s: s, cmd: cmd}
+	r.call(ctx, "reactions.add", reactionRunning)
+	return r
+}
+
+// finish replaces the running reaction with the command's outcome.
+func (r *statusReactions) finish(ctx context.Context, result commandResult, stopped bool) {
+	if r == nil {
+		return
+	}
+	r.call(ctx, "reactions.remove", reactionRunning)
+	name := reactionSuccess
+	switch {
+	case stopped:
+		name = reactionStopped
+	case result.ExitCode != 0:
+		name = reactionFailure
+	}
+	r.call(ctx, "reactions.add", name)
+}
+
+func (r *statusReactions) call(ctx context.Context, method, name string) {
+	params := url.Values{"channel": {r.cmd.ChannelID}, "timestamp": {r.cmd.MessageTS}, "name": {name}}
+	if err := r.s.slack.call(ctx, method, params, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error updating status reaction: %v\n", err)
+	}
+}
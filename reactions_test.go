@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReactions_MentionOutcome(t *testing.T) {
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"true", reactionSuccess},
+		{"exit 3", reactionFailure},
+	}
+	for _, tt := range tests {
+		f := newFakeSlack(t)
+		s := newServer(f.config())
+
+		postEvent(t, s, `{"type": "event_callback", "team_id": "T1", "event_id": "Ev1", "event": {
+			"type": "app_mention", "user": "U1", "channel": "C1", "ts": "1.2", "text": "<@UBOT> `+tt.command+`"}}`)
+
+		added := waitForCalls(t, f, "reactions.add", 2)
+		if len(added) != 2 || added[0].Params.Get("name") != reactionRunning || added[1].Params.Get("name") != tt.want {
+			t.Fatalf("%s: expected %s then %s, got %v", tt.command, reactionRunning, tt.want, added)
+		}
+		if p := added[1].Params; p.Get("channel") != "C1" || p.Get("timestamp") != "1.2" {
+			t.Errorf("%s: expected the mention to be marked, got %v", tt.command, p)
+		}
+		removed := f.callsTo("reactions.remove")
+		if len(removed) != 1 || removed[0].Params.Get("name") != reactionRunning {
+			t.Errorf("%s: expected the running reaction to be removed, got %v", tt.command, removed)
+		}
+	}
+}
+
+func TestReactions_Stopped(t *testing.T) {
+	f := newFakeSlack(t)
+	s := newServer(f.config())
+	cmd := slashCommand{ChannelID: "C1", MessageTS: "1.2"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.startReactions(context.Background(), cmd).finish(context.Background(), commandResult{ExitCode: -1}, ctx.Err() != nil)
+
+	added := f.callsTo("reactions.add")
+	if len(added) != 2 || added[1].Params.Get("name") != reactionStopped {
+		t.Errorf("Expected a stopped job to be marked %s, got %v", reactionStopped, added)
+	}
+}
+
+func TestReactions_SlashCommandUnmarked(t *testing.T) {
+	f := newFakeSlack(t)
+	s := newServer(f.config())
+
+	s.handleCommandExecution(context.Background(), slashCommand{Text: "$ true", ChannelID: "C1"})
+
+	if calls := f.callsTo("reactions.add"); len(calls) != 0 {
+		t.Errorf("Expected no reactions without a message, got %v", calls)
+	}
+}
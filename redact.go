@@ -0,0 +1,61 @@
+package main
+
+import "regexp"
+
+// leakPatterns match credentials by their format, so a match is almost
+// certainly a real secret rather than, say, a variable named "token".
+var leakPatterns = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	{"AWS access key", regexp.MustCompile(`AKIA[0-9A-Z]{16}`)},
+	{"Slack token", regexp.MustCompile(`xox[abpors]-[0-9A-Za-z-]{10,}`)},
+	{"GitHub token", regexp.MustCompile(`gh[pousr]_[0-9A-Za-z]{36,}`)},
+	{"private key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+}
+
+// secretPatterns match values that look like credentials.
+var secretPatterns = []*regexp.Regexp{
+	leakPatterns[0].re,
+	leakPatterns[1].re,
+	leakPatterns[2].re,
+	regexp.MustCompile(`(?i)bearer\s+[0-9a-z._~+/-]{16,}=*`),
+	leakPatterns[3].re,
+	regexp.MustCompile(`(?i)\b(password|passwd|secret|token|api_?key)(\s*[=:]\s*)\S+`),
+}
+
+const redacted = "[REDACTED]"
+
+// redactLine replaces credential-like values in a line.
+func redactLine(line string) string {
+	for _, re := range secretPatterns {
+		if re.NumSubexp() == 2 {
+			line = re.ReplaceAllString(line, "${1}${2}"+redacted)
+			continue
+		}
+		line = re.ReplaceAllString(line, redacted)
+	}
+	return line
+}
+
+func redactLines(lines []string) []string {
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		out[i] = redactLine(line)
+	}
+	return out
+}
+
+// detectLeaks returns the kinds of high-confidence secrets in lines.
+func detectLeaks(lines []string) []string {
+	var kinds []string
+	for _, p := range leakPatterns {
+		for _, line := range lines {
+			if p.re.MatchString(line) {
+				kinds = append(kinds, p.name)
+				break
+			}
+		}
+	}
+	return kinds
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// runResult is the result builtin: $ result <job-id>. It shows a stored
+// job's command, who ran it where and how it ended, followed by its
+// output, which is uploaded as a file like any long output. Binary output
+// is taken from the output archive.
+func runResult(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	fail := func(code int, msg string) commandResult {
+		return commandResult{Lines: []string{msg}, ExitCode: code, Duration: time.Since(startTime)}
+	}
+	if len(args) != 1 {
+		return fail(2, "usage: result <job-id>")
+	}
+
+	r, err := s.store.job(args[0])
+	if errors.Is(err, errJobNotStored) || err == nil && !s.canView(s.viewerFor(cmd), r) {
+		// Jobs the user may not see are reported like missing ones, as
+		// for transcripts.
+		return fail(1, fmt.Sprintf("no job %s", args[0]))
+	}
+	if err != nil {
+		return fail(1, fmt.Sprintf("reading job %s: %v", args[0], err))
+	}
+	if r.Redacted {
+		return fail(1, fmt.Sprintf("job %s was redacted by <@%s>", r.ID, r.RedactedBy))
+	}
+
+	lines := []string{
+		fmt.Sprintf("job %s by <@%s> in <#%s>, %s, %s after %s", r.ID, r.UserID, r.ChannelID,
+			r.Started.Local().Format("2006-01-02 15:04:05"), translateExitCode(r.ExitCode), r.Duration.Round(time.Millisecond)),
+		r.Text,
+	}
+	result := commandResult{Lines: append(lines, r.Lines...)}
+	if s.archive != nil {
+		data, err := s.archive.get(ctx, r.ID)
+		switch {
+		case err == nil && isBinary(data):
+			result.Binary = data
+		case err != nil && !errors.Is(err, os.ErrNotExist):
+			fmt.Fprintf(os.Stderr, "Error reading archived output of job %s: %v\n", r.ID, err)
+		}
+	}
+	result.Duration = time.Since(startTime)
+	return result
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResult(t *testing.T) {
+	s := newServer(config{DataDir: t.TempDir(), SensitiveChannels: map[string]bool{"C2": true}})
+	ctx := context.Background()
+	s.handleCommandExecution(ctx, slashCommand{Text: "$ printf 'one\\ntwo\\n'; exit 3", UserID: "U1", ChannelID: "C1"})
+	s.handleCommandExecution(ctx, slashCommand{Text: "$ echo private", UserID: "U1", ChannelID: "C2"})
+	jobs, _ := s.store.since(time.Time{})
+
+	response := s.handleCommandExecution(ctx, slashCommand{Text: "$ result " + jobs[0].ID, UserID: "U1", ChannelID: "C1"})
+	text := response["text"]
+	if !strings.Contains(text, "job "+jobs[0].ID+" by <@U1> in <#C1>") || !strings.Contains(text, "error 3") || !strings.Contains(text, "one\ntwo") {
+		t.Errorf("Expected the job's metadata and output, got %q", text)
+	}
+
+	response = s.handleCommandExecution(ctx, slashCommand{Text: "$ result " + jobs[1].ID, UserID: "U1", ChannelID: "C1"})
+	if !strings.Contains(response["text"], "no job "+jobs[1].ID) {
+		t.Errorf("Expected a private job to be refused in a channel, got %q", response["text"])
+	}
+}
+
+func TestResult_BinaryFromArchive(t *testing.T) {
+	s := newServer(config{DataDir: t.TempDir(), OutputArchive: t.TempDir()})
+	ctx := context.Background()
+	s.handleCommandExecution(ctx, slashCommand{Text: "$ echo hi", UserID: "U1", ChannelID: "C1"})
+	jobs, _ := s.store.since(time.Time{})
+	s.archive.put(ctx, jobs[0].ID, []byte("\x89PNG\r\n\x1a\n\x00\x00"))
+
+	result := runResult(ctx, s, slashCommand{UserID: "U1", ChannelID: "C1"}, []string{jobs[0].ID})
+	if result.Binary == nil || result.ExitCode != 0 {
+		t.Errorf("Expected the archived binary output, got %+v", result)
+	}
+}
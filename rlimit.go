@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const rlimitUsage = "usage: http-shell rlimit SPEC PROGRAM [ARG...]"
+
+// rlimits are resource limits set on each command with setrlimit, a
+// lighter alternative to cgroups that needs no delegation. Each is
+// inherited by everything the command starts, and 0 leaves it unset.
+type rlimits struct {
+	CPU       uint64 `json:"cpu"`    // seconds of CPU time, RLIMIT_CPU
+	FileSize  uint64 `json:"fsize"`  // bytes a file may grow to, RLIMIT_FSIZE
+	OpenFiles uint64 `json:"nofile"` // open files, RLIMIT_NOFILE
+}
+
+// String describes the limits, e.g. "30s of CPU time and 256 open files".
+func (r *rlimits) String() string {
+	var caps []string
+	if r.CPU > 0 {
+		caps = append(caps, fmt.Sprintf("%s of CPU time", time.Duration(r.CPU)*time.Second))
+	}
+	if r.FileSize > 0 {
+		caps = append(caps, "files of up to "+formatBytes(int64(r.FileSize)))
+	}
+	if r.OpenFiles > 0 {
+		caps = append(caps, fmt.Sprintf("%d open files", r.OpenFiles))
+	}
+	return strings.Join(caps, ", ")
+}
+
+// wrap returns argv run by "http-shell rlimit", which sets the limits and
+// then executes argv in its place, since Go cannot set them between
+// starting a process and executing it.
+func (r *rlimits) wrap(argv []string) ([]string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	spec, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{exe, "rlimit", string(spec)}, argv...), nil
+}
+
+// dockerArgs are the options of docker run that set the same limits in a
+// new container.
+func (r *rlimits) dockerArgs() []string {
+	var args []string
+	for _, l := range []struct {
+		name  string
+		value uint64
+	}{{"cpu", r.CPU}, {"fsize", r.FileSize}, {"nofile", r.OpenFiles}} {
+		if l.value > 0 {
+			args = append(args, "--ulimit", l.name+"="+strconv.FormatUint(l.value, 10))
+		}
+	}
+	return args
+}
+
+// runRlimitCommand is "http-shell rlimit": it sets the limits given as JSON
+// and executes the program in its place, so it only returns if that fails.
+func runRlimitCommand(args []string, stderr io.Writer) int {
+	if len(args) < 2 {
+		fmt.Fprintln(stderr, rlimitUsage)
+		return 2
+	}
+	var r rlimits
+	if err := json.Unmarshal([]byte(args[0]), &r); err != nil {
+		fmt.Fprintf(stderr, "rlimit: parsing the limits: %v\n", err)
+		return 2
+	}
+	path, err := exec.LookPath(args[1])
+	if err != nil {
+		fmt.Fprintf(stderr, "rlimit: %v\n", err)
+		return 127
+	}
+	err = execWithRlimits(&r, path, args[1:])
+	fmt.Fprintf(stderr, "rlimit: %v\n", err)
+	return 126
+}
@@ -0,0 +1,15 @@
+//go:build !unix || freebsd || dragonfly
+
+package main
+
+import "errors"
+
+const rlimitsSupported = false
+
+func execWithRlimits(r *rlimits, path string, argv []string) error {
+	return errors.New("not supported on this system")
+}
+
+func rlimitKilled(err error) string {
+	return ""
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRunCommand_Rlimits(t *testing.T) {
+	if !rlimitsSupported {
+		t.Skip("rlimits are not supported on this system")
+	}
+	r := &rlimits{CPU: 1, FileSize: 1 << 20, OpenFiles: 64}
+
+	result := runCommand(context.Background(), "ulimit -t; ulimit -n; ulimit -Hn", runOptions{Rlimits: r})
+	if !slices.Equal(result.Lines, []string{"1", "64", "64"}) {
+		t.Errorf("Expected the limits set on the command, got %+v", result)
+	}
+
+	file := filepath.Join(t.TempDir(), "f")
+	result = runCommand(context.Background(), "head -c 2097152 /dev/zero > "+file+"; echo done", runOptions{Rlimits: r})
+	if result.Killed != "" || !slices.Contains(result.Lines, "done") {
+		t.Errorf("Expected the shell to outlive a program it started exceeding the file size limit, got %+v", result)
+	}
+	result = runCommand(context.Background(), "exec head -c 2097152 /dev/zero > "+file, runOptions{Rlimits: r})
+	if result.Killed != "file size limit exceeded" {
+		t.Errorf("Expected the command killed for exceeding the file size limit, got %+v", result)
+	}
+
+	result = runCommand(context.Background(), "exit 153", runOptions{Rlimits: r})
+	if result.Killed != "" || result.ExitCode != 153 {
+		t.Errorf("Expected an exit code of 128+SIGXFSZ not taken for a kill, got %+v", result)
+	}
+
+	result = runCommand(context.Background(), "while :; do :; done", runOptions{Rlimits: r})
+	if result.Killed != "CPU time limit exceeded" {
+		t.Errorf("Expected the command killed for exceeding its CPU time, got %+v", result)
+	}
+}
+
+func TestRlimits(t *testing.T) {
+	r := &rlimits{CPU: 90, FileSize: 1 << 30, OpenFiles: 256}
+	if got := r.String(); got != "1m30s of CPU time, files of up to 1.0 GiB, 256 open files" {
+		t.Errorf("String() = %q", got)
+	}
+	if args := r.dockerArgs(); !slices.Equal(args, []string{"--ulimit", "cpu=90", "--ulimit", "fsize=1073741824", "--ulimit", "nofile=256"}) {
+		t.Errorf("Expected the limits passed to docker run, got %v", args)
+	}
+}
+
+func TestLoadConfig_Rlimits(t *testing.T) {
+	if !rlimitsSupported {
+		t.Skip("rlimits are not supported on this system")
+	}
+	t.Setenv("COMMAND_CPU_TIME", "1500ms")
+	t.Setenv("COMMAND_FILE_SIZE_MAX", "100m")
+	cfg, err := loadConfig()
+	if err != nil || cfg.Rlimits == nil || *cfg.Rlimits != (rlimits{CPU: 2, FileSize: 100 << 20}) {
+		t.Errorf("Expected 2s of CPU time and 100 MiB files, got %+v (%v)", cfg.Rlimits, err)
+	}
+	t.Setenv("COMMAND_OPEN_FILES_MAX", "3")
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "invalid COMMAND_OPEN_FILES_MAX") {
+		t.Errorf("Expected too few open files refused, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+//go:build unix && !freebsd && !dragonfly
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// FreeBSD and DragonFly declare syscall.Rlimit with signed fields, and are
+// left out rather than given a file of their own.
+const rlimitsSupported = true
+
+// execWithRlimits sets the limits, soft and hard alike so that commands
+// cannot raise them, and executes a program in its place. The hard CPU
+// time limit is a second later, since reaching it sends SIGKILL rather
+// than the SIGXCPU that tells why the command was killed.
+func execWithRlimits(r *rlimits, path string, argv []string) error {
+	for _, l := range []struct {
+		resource int
+		name     string
+		value    uint64
+		grace    uint64
+	}{
+		{syscall.RLIMIT_CPU, "CPU time", r.CPU, 1},
+		{syscall.RLIMIT_FSIZE, "file size", r.FileSize, 0},
+		{syscall.RLIMIT_NOFILE, "open files", r.OpenFiles, 0},
+	} {
+		if l.value == 0 {
+			continue
+		}
+		if err := syscall.Setrlimit(l.resource, &syscall.Rlimit{Cur: l.value, Max: l.value + l.grace}); err != nil {
+			return fmt.Errorf("limiting %s: %w", l.name, err)
+		}
+	}
+	return syscall.Exec(path, argv, os.Environ())
+}
+
+// rlimitKilled says which limit killed a command, from the signal the
+// kernel sends when it is reached. Only a command killed by the signal
+// counts: one that merely exits with 128 plus its number was not.
+func rlimitKilled(err error) string {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return ""
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return ""
+	}
+	switch status.Signal() {
+	case syscall.SIGXCPU:
+		return "CPU time limit exceeded"
+	case syscall.SIGXFSZ:
+		return "file size limit exceeded"
+	}
+	return ""
+}
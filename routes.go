@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"expvar"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// endpointPaths are the URL paths of the server's endpoints. Empty paths
+// use the defaults; randomPath serves an endpoint on a hard-to-guess path.
+type endpointPaths struct {
+	Webhook       string // slash commands
+	Interactivity string // button clicks and modal submissions
+	Events        string // Events API
+	Admin         string // prefix for admin endpoints such as metrics
+	Agents        string // agent connections
+}
+
+// randomPath is the path setting that picks a random path once per process.
+const randomPath = "random"
+
+var defaultPaths = endpointPaths{
+	Webhook:       "/",
+	Interactivity: "/slack/interactive",
+	Events:        "/slack/events",
+	Admin:         "/debug",
+	Agents:        "/agents",
+}
+
+// routeTable serves requests with the current routes. Routes are replaced
+// atomically, so reloading them does not drop connections or in-flight
+// requests.
+type routeTable struct {
+	handler atomic.Value // http.Handler
+
+	mu     sync.Mutex
+	random map[string]string // endpoint -> random path, kept across reloads
+}
+
+func (t *routeTable) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.handler.Load().(http.Handler).ServeHTTP(w, r)
+}
+
+// routes returns the handler for all endpoints.
+func (s *server) routes() http.Handler {
+	return s.routeTable
+}
+
+// setRoutes resolves paths and swaps in the routes for them. It returns
+// the resolved paths.
+func (s *server) setRoutes(paths endpointPaths) endpointPaths {
+	paths = s.routeTable.resolve(paths)
+
+	// Each route has a name used in access logs and sampling settings.
+	mux := http.NewServeMux()
+	mux.Handle(paths.Webhook, s.accessLog.wrap("webhook", http.HandlerFunc(s.handleCommand)))
+	mux.Handle(paths.Interactivity, s.accessLog.wrap("interactivity", http.HandlerFunc(s.handleInteraction)))
+	// Mentions are answered with the Web API, so events need a token.
+	if s.slack != nil {
+		mux.Handle(paths.Events, s.accessLog.wrap("events", http.HandlerFunc(s.handleEvent)))
+	}
+	mux.Handle(paths.Admin+"/vars", s.accessLog.wrap("metrics", expvar.Handler()))
+	if s.store != nil {
+		mux.Handle(paths.Admin+"/transcripts/", s.accessLog.wrap("transcripts", http.HandlerFunc(s.handleTranscript)))
+		mux.Handle(paths.Admin+"/search", s.accessLog.wrap("search", http.HandlerFunc(s.handleSearch)))
+	}
+	if s.deadLetters != nil {
+		deadLetters := s.accessLog.wrap("deadletters", http.HandlerFunc(s.handleDeadLetters))
+		mux.Handle(paths.Admin+"/deadletters", deadLetters)
+		mux.Handle(paths.Admin+"/deadletters/", deadLetters)
+	}
+	if s.archive != nil {
+		mux.Handle(paths.Admin+"/outputs/", s.accessLog.wrap("outputs", http.HandlerFunc(s.handleArchivedOutput)))
+	}
+	if s.agents != nil && s.agents.token != "" {
+		mux.Handle(paths.Agents, s.accessLog.wrap("agents", http.HandlerFunc(s.handleAgent)))
+	}
+	s.routeTable.handler.Store(http.Handler(mux))
+	return paths
+}
+
+// resolve fills in defaults and random paths.
+func (t *routeTable) resolve(paths endpointPaths) endpointPaths {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	resolve := func(endpoint, path, def string) string {
+		switch path {
+		case "":
+			return def
+		case randomPath:
+			if t.random[endpoint] == "" {
+				if t.random == nil {
+					t.random = make(map[string]string)
+				}
+				t.random[endpoint] = "/" + randomToken()
+			}
+			return t.random[endpoint]
+		}
+		return path
+	}
+	return endpointPaths{
+		Webhook:       resolve("webhook", paths.Webhook, defaultPaths.Webhook),
+		Interactivity: resolve("interactivity", paths.Interactivity, defaultPaths.Interactivity),
+		Events:        resolve("events", paths.Events, defaultPaths.Events),
+		Admin:         resolve("admin", paths.Admin, defaultPaths.Admin),
+		Agents:        resolve("agents", paths.Agents, defaultPaths.Agents),
+	}
+}
+
+// randomToken returns 128 random bits, hex encoded.
+func randomToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("reading random bytes: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// printPaths prints where each endpoint is served.
+func printPaths(paths endpointPaths) {
+	fmt.Printf("Serving webhook on %s\n", paths.Webhook)
+	fmt.Printf("Serving interactivity on %s\n", paths.Interactivity)
+	fmt.Printf("Serving events on %s\n", paths.Events)
+	fmt.Printf("Serving metrics on %s/vars\n", paths.Admin)
+}
+
+// reloadOnSignal reloads the configuration on SIGHUP and swaps in routes
+// for the new endpoint paths. The listener and open connections are kept.
+// Other settings take effect on restart.
+func (s *server) reloadOnSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	for range c {
+		cfg, err := loadConfig()
+		holdCredentials()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reloading config: %v\n", err)
+			continue
+		}
+		fmt.Println("Reloaded endpoint paths")
+		printPaths(s.setRoutes(cfg.Paths))
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func serve(s *server, method, path string) int {
+	req := httptest.NewRequest(method, path, strings.NewReader(url.Values{"text": {"echo hi"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.routes().ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRoutes_DefaultPaths(t *testing.T) {
+	s := newServer(config{})
+
+	if code := serve(s, "POST", "/"); code != http.StatusOK {
+		t.Errorf("Expected webhook on /, got status %d", code)
+	}
+	if code := serve(s, "GET", "/debug/vars"); code != http.StatusOK {
+		t.Errorf("Expected metrics on /debug/vars, got status %d", code)
+	}
+}
+
+func TestRoutes_CustomPaths(t *testing.T) {
+	s := newServer(config{Paths: endpointPaths{Webhook: "/slack/commands", Admin: "/admin"}})
+
+	if code := serve(s, "POST", "/slack/commands"); code != http.StatusOK {
+		t.Errorf("Expected webhook on custom path, got status %d", code)
+	}
+	if code := serve(s, "POST", "/"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 on /, got status %d", code)
+	}
+	if code := serve(s, "GET", "/admin/vars"); code != http.StatusOK {
+		t.Errorf("Expected metrics under custom admin path, got status %d", code)
+	}
+}
+
+func TestRoutes_RandomPathKeptAcrossReloads(t *testing.T) {
+	s := newServer(config{})
+
+	paths := s.setRoutes(endpointPaths{Webhook: randomPath})
+	if !regexp.MustCompile(`^/[0-9a-f]{32}$`).MatchString(paths.Webhook) {
+		t.Fatalf("Expected random path, got %q", paths.Webhook)
+	}
+	if again := s.setRoutes(endpointPaths{Webhook: randomPath, Admin: "/admin"}); again.Webhook != paths.Webhook {
+		t.Errorf("Expected random path %q to be kept, got %q", paths.Webhook, again.Webhook)
+	}
+	if code := serve(s, "POST", paths.Webhook); code != http.StatusOK {
+		t.Errorf("Expected webhook on random path, got status %d", code)
+	}
+	if code := serve(s, "POST", "/"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 on /, got status %d", code)
+	}
+}
+
+func TestLoadEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "env")
+	t.Setenv("TEST_KEPT", "original")
+	t.Setenv("TEST_REMOVED", "original")
+	t.Cleanup(func() { loadEnvFile(os.DevNull) })
+
+	os.WriteFile(path, []byte("# paths\nTEST_KEPT=file\nTEST_REMOVED = file\n"), 0o600)
+	if err := loadEnvFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if v := os.Getenv("TEST_REMOVED"); v != "file" {
+		t.Errorf("Expected file value, got %q", v)
+	}
+
+	os.WriteFile(path, []byte("TEST_KEPT=changed\n"), 0o600)
+	if err := loadEnvFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if v := os.Getenv("TEST_KEPT"); v != "changed" {
+		t.Errorf("Expected reloaded value, got %q", v)
+	}
+	if v := os.Getenv("TEST_REMOVED"); v != "original" {
+		t.Errorf("Expected value removed from the file to be restored, got %q", v)
+	}
+}
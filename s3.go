@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Client stores objects in a bucket of S3 or an S3-compatible service
+// such as MinIO, signing requests with AWS Signature Version 4. Buckets
+// are addressed by path, as in https://s3.us-east-1.amazonaws.com/bucket,
+// which every S3-compatible service supports.
+type s3Client struct {
+	bucketURL *url.URL
+	region    string
+
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string // for temporary credentials, else ""
+
+	client *http.Client
+	now    func() time.Time
+}
+
+// newS3Client returns a client for the bucket at bucketURL.
+func newS3Client(bucketURL, region, accessKeyID, secretAccessKey, sessionToken string, client *http.Client) (*s3Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(bucketURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return nil, fmt.Errorf("%s: want http(s)://host/bucket", bucketURL)
+	}
+	return &s3Client{
+		bucketURL:       u,
+		region:          region,
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+		sessionToken:    sessionToken,
+		client:          client,
+		now:             time.Now,
+	}, nil
+}
+
+// put stores body under key.
+func (c *s3Client) put(ctx context.Context, key, contentType string, body []byte) error {
+	resp, err := c.do(ctx, http.MethodPut, key, nil, contentType, body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// get returns the object stored under key, or an error wrapping
+// os.ErrNotExist if there is none.
+func (c *s3Client) get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := c.do(ctx, http.MethodGet, key, nil, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// remove deletes the object stored under key.
+func (c *s3Client) remove(ctx context.Context, key string) error {
+	resp, err := c.do(ctx, http.MethodDelete, key, nil, "", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// s3Object is an entry of a bucket listing.
+type s3Object struct {
+	Key          string    `xml:"Key"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+// list calls fn with every object whose key starts with prefix, in pages
+// of up to 1000, with ListObjectsV2.
+func (c *s3Client) list(ctx context.Context, prefix string, fn func(s3Object) error) error {
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		resp, err := c.do(ctx, http.MethodGet, "", query, "", nil)
+		if err != nil {
+			return err
+		}
+		var page struct {
+			Contents              []s3Object `xml:"Contents"`
+			IsTruncated           bool       `xml:"IsTruncated"`
+			NextContinuationToken string     `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("listing %s: %w", prefix, err)
+		}
+		for _, obj := range page.Contents {
+			if err := fn(obj); err != nil {
+				return err
+			}
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return nil
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+// do sends a signed request for the object at key, or the bucket itself
+// if key is empty. Responses other than 2xx are returned as errors, and
+// 404s wrap os.ErrNotExist.
+func (c *s3Client) do(ctx context.Context, method, key string, query url.Values, contentType string, body []byte) (*http.Response, error) {
+	u := *c.bucketURL
+	if key != "" {
+		u.Path = c.bucketURL.Path + "/" + key
+	}
+	u.RawPath = s3Escape(u.Path, false)
+	u.RawQuery = s3Query(query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	c.sign(req, body)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %w", method, key, os.ErrNotExist)
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: status %d: %s", method, key, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+// sign adds the Signature Version 4 headers to req.
+func (c *s3Client) sign(req *http.Request, body []byte) {
+	now := c.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if c.sessionToken != "" {
+		signed = append(signed, "x-amz-security-token")
+	}
+	var headers strings.Builder
+	for _, name := range signed {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		headers.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+c.secretAccessKey), date)
+	for _, part := range []string{c.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKeyID, scope, signedHeaders, signature))
+}
+
+// s3Query encodes query parameters as Signature Version 4 expects,
+// sorted by name.
+func s3Query(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var pairs []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			pairs = append(pairs, s3Escape(name, true)+"="+s3Escape(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// s3Escape percent-encodes a string as Signature Version 4 expects: every
+// byte but unreserved characters and, unless escapeSlash is set, slashes.
+func s3Escape(path string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~", c) >= 0 || c == '/' && !escapeSlash {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
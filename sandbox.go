@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+)
+
+const sandboxUsage = "usage: http-shell sandbox SPEC PROGRAM [ARG...]"
+
+// localSandbox restricts what the shell commands of a profile's channels
+// may do on the server's host, from the profile's "sandbox": Landlock
+// limits the paths they may open, and a seccomp filter makes some system
+// calls fail with EPERM. With a root, they are also confined to a
+// directory tree.
+type localSandbox struct {
+	// Root is a directory that becomes the commands' /, in mount and user
+	// namespaces of their own, so nothing outside it can be reached. Read
+	// and Write are then paths within it.
+	Root string `json:"root"`
+
+	// Read lists the paths beneath which commands may read and execute
+	// files, and Write those beneath which they may also change them.
+	// Nothing else can be opened. They default to defaultSandboxRead and
+	// defaultSandboxWrite if omitted.
+	Read  []string `json:"read"`
+	Write []string `json:"write"`
+
+	// DenySyscalls lists the system calls that fail, from those of
+	// seccompSyscalls, defaultDeniedSyscalls if omitted.
+	DenySyscalls []string `json:"deny_syscalls"`
+}
+
+var (
+	// defaultSandboxRead is enough for sh and the usual tools to run.
+	defaultSandboxRead  = []string{"/bin", "/sbin", "/usr", "/lib", "/lib32", "/lib64", "/etc"}
+	defaultSandboxWrite = []string{"/tmp", "/dev/null"}
+
+	// defaultDeniedSyscalls are the system calls that change the host's
+	// kernel, mounts or namespaces, or reach into other processes.
+	defaultDeniedSyscalls = []string{
+		"add_key", "bpf", "chroot", "delete_module", "finit_module",
+		"init_module", "io_uring_setup", "kexec_load", "keyctl", "mount",
+		"perf_event_open", "pivot_root", "process_vm_readv",
+		"process_vm_writev", "ptrace", "reboot", "request_key", "setns",
+		"swapoff", "swapon", "syslog", "umount2", "unshare",
+	}
+)
+
+func (sb *localSandbox) readPaths() []string {
+	if sb.Read == nil {
+		return defaultSandboxRead
+	}
+	return sb.Read
+}
+
+func (sb *localSandbox) writePaths() []string {
+	if sb.Write == nil {
+		return defaultSandboxWrite
+	}
+	return sb.Write
+}
+
+func (sb *localSandbox) deniedSyscalls() []string {
+	if sb.DenySyscalls == nil {
+		return defaultDeniedSyscalls
+	}
+	return sb.DenySyscalls
+}
+
+// validate reports a sandbox that cannot be applied: on other systems than
+// Linux, with relative paths, or denying unknown system calls.
+func (sb *localSandbox) validate() error {
+	if !localSandboxSupported {
+		return errors.New("only supported on Linux")
+	}
+	if sb.Root != "" && !filepath.IsAbs(sb.Root) {
+		return fmt.Errorf("root %q is not absolute", sb.Root)
+	}
+	for _, path := range append(slices.Clone(sb.readPaths()), sb.writePaths()...) {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("path %q is not absolute", path)
+		}
+	}
+	for _, name := range sb.deniedSyscalls() {
+		if _, ok := seccompSyscalls[name]; !ok {
+			return fmt.Errorf("unknown system call %q", name)
+		}
+	}
+	return nil
+}
+
+// sandboxedBackend runs commands with sh on the server's host under a
+// profile's sandbox. Builtins run in the server, outside it, so it lacks
+// capFiles.
+var sandboxedBackend = backend{Name: "sandboxed local", Caps: slices.DeleteFunc(localCaps(), func(c capability) bool { return c == capFiles })}
+
+// runSandboxed runs command with sh under a sandbox. The server's own
+// executable is run again as "http-shell sandbox", which restricts itself
+// and then executes sh, so the restrictions hold for sh and everything it
+// starts but never for the server. With a root, it starts in namespaces of
+// its own, in which it can change its root.
+func runSandboxed(ctx context.Context, sb *localSandbox, command string, opts runOptions) commandResult {
+	exe, err := os.Executable()
+	if err != nil {
+		return commandResult{Lines: []string{"sandbox: " + err.Error()}, ExitCode: 126}
+	}
+	spec, err := json.Marshal(sb)
+	if err != nil {
+		return commandResult{Lines: []string{"sandbox: " + err.Error()}, ExitCode: 126}
+	}
+	opts.Namespaces = sb.Root != ""
+	return runProgram(ctx, []string{exe, "sandbox", string(spec), "sh", "-c", command}, nil, opts)
+}
+
+// runSandboxCommand is "http-shell sandbox": it applies the sandbox given
+// as JSON and executes the program in its place, so it only returns if
+// that fails. A sandbox that cannot be applied fails the command rather
+// than running it unrestricted. The program is looked up in the root, if
+// the sandbox has one.
+func runSandboxCommand(args []string, stderr io.Writer) int {
+	if len(args) < 2 {
+		fmt.Fprintln(stderr, sandboxUsage)
+		return 2
+	}
+	var sb localSandbox
+	if err := json.Unmarshal([]byte(args[0]), &sb); err != nil {
+		fmt.Fprintf(stderr, "sandbox: parsing the sandbox: %v\n", err)
+		return 2
+	}
+	if err := sb.validate(); err != nil {
+		fmt.Fprintf(stderr, "sandbox: %v\n", err)
+		return 2
+	}
+	if sb.Root != "" {
+		if err := enterRoot(sb.Root); err != nil {
+			fmt.Fprintf(stderr, "sandbox: changing the root to %s: %v\n", sb.Root, err)
+			return 126
+		}
+	}
+	path, err := exec.LookPath(args[1])
+	if err != nil {
+		fmt.Fprintf(stderr, "sandbox: %v\n", err)
+		return 127
+	}
+	err = execSandboxed(&sb, path, args[1:])
+	fmt.Fprintf(stderr, "sandbox: %v\n", err)
+	return 126
+}
@@ -0,0 +1,225 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const localSandboxSupported = true
+
+// seccompSyscalls are the system calls a sandbox may deny.
+var seccompSyscalls = map[string]uintptr{
+	"add_key":           unix.SYS_ADD_KEY,
+	"bpf":               unix.SYS_BPF,
+	"chroot":            unix.SYS_CHROOT,
+	"delete_module":     unix.SYS_DELETE_MODULE,
+	"finit_module":      unix.SYS_FINIT_MODULE,
+	"init_module":       unix.SYS_INIT_MODULE,
+	"io_uring_setup":    unix.SYS_IO_URING_SETUP,
+	"kexec_load":        unix.SYS_KEXEC_LOAD,
+	"keyctl":            unix.SYS_KEYCTL,
+	"kill":              unix.SYS_KILL,
+	"mount":             unix.SYS_MOUNT,
+	"perf_event_open":   unix.SYS_PERF_EVENT_OPEN,
+	"pivot_root":        unix.SYS_PIVOT_ROOT,
+	"process_vm_readv":  unix.SYS_PROCESS_VM_READV,
+	"process_vm_writev": unix.SYS_PROCESS_VM_WRITEV,
+	"ptrace":            unix.SYS_PTRACE,
+	"reboot":            unix.SYS_REBOOT,
+	"request_key":       unix.SYS_REQUEST_KEY,
+	"setns":             unix.SYS_SETNS,
+	"socket":            unix.SYS_SOCKET,
+	"swapoff":           unix.SYS_SWAPOFF,
+	"swapon":            unix.SYS_SWAPON,
+	"syslog":            unix.SYS_SYSLOG,
+	"tgkill":            unix.SYS_TGKILL,
+	"tkill":             unix.SYS_TKILL,
+	"umount2":           unix.SYS_UMOUNT2,
+	"unshare":           unix.SYS_UNSHARE,
+}
+
+// auditArch is the architecture seccomp reports for system calls made the
+// native way, by GOARCH.
+var auditArch = map[string]uint32{
+	"386":     unix.AUDIT_ARCH_I386,
+	"amd64":   unix.AUDIT_ARCH_X86_64,
+	"arm":     unix.AUDIT_ARCH_ARM,
+	"arm64":   unix.AUDIT_ARCH_AARCH64,
+	"ppc64le": unix.AUDIT_ARCH_PPC64LE,
+	"riscv64": unix.AUDIT_ARCH_RISCV64,
+	"s390x":   unix.AUDIT_ARCH_S390X,
+}
+
+// Landlock access rights: those granted beneath the paths a sandbox reads,
+// and those that apply to files rather than directories.
+const (
+	landlockRead  = unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_READ_DIR
+	landlockFiles = unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_WRITE_FILE | unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_TRUNCATE
+)
+
+// execSandboxed applies a sandbox to the process and executes a program in
+// its place. Landlock and seccomp restrict the thread that applies them,
+// and the program inherits the restrictions of the thread that executes
+// it, so both happen on one locked thread.
+func execSandboxed(sb *localSandbox, path string, argv []string) error {
+	runtime.LockOSThread()
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("setting no_new_privs: %w", err)
+	}
+	if err := landlockRestrict(sb.readPaths(), sb.writePaths()); err != nil {
+		return fmt.Errorf("applying Landlock: %w", err)
+	}
+	if err := seccompDeny(sb.deniedSyscalls()); err != nil {
+		return fmt.Errorf("applying seccomp: %w", err)
+	}
+	return syscall.Exec(path, argv, os.Environ())
+}
+
+// newNamespaces starts cmd in new user and mount namespaces, where it may
+// change its mounts without privileges on the host. Its user and group map
+// to the server's, so files keep their owners.
+func newNamespaces(cmd *exec.Cmd) {
+	cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS
+	cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+	cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+	cmd.SysProcAttr.GidMappingsEnableSetgroups = false
+}
+
+// enterRoot makes root the process's /, in its own mount namespace. Unlike
+// chroot, pivot_root leaves no way back to the old root, which is detached
+// altogether; root is bound onto itself first, since it must be a mount
+// point. It must happen before Landlock is applied, which forbids changing
+// mounts.
+func enterRoot(root string) error {
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("making mounts private: %w", err)
+	}
+	if err := unix.Mount(root, root, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("binding: %w", err)
+	}
+	if err := unix.Chdir(root); err != nil {
+		return err
+	}
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("pivot_root: %w", err)
+	}
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("detaching the old root: %w", err)
+	}
+	return unix.Chdir("/")
+}
+
+// landlockRestrict limits the files the thread may open to those beneath
+// the given paths. Paths that do not exist are skipped.
+func landlockRestrict(read, write []string) error {
+	abi, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		return fmt.Errorf("not supported by the kernel: %w", errno)
+	}
+	handled := uint64(unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_READ_DIR |
+		unix.LANDLOCK_ACCESS_FS_REMOVE_DIR | unix.LANDLOCK_ACCESS_FS_REMOVE_FILE |
+		unix.LANDLOCK_ACCESS_FS_MAKE_CHAR | unix.LANDLOCK_ACCESS_FS_MAKE_DIR |
+		unix.LANDLOCK_ACCESS_FS_MAKE_REG | unix.LANDLOCK_ACCESS_FS_MAKE_SOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_FIFO | unix.LANDLOCK_ACCESS_FS_MAKE_BLOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SYM)
+	if abi >= 2 {
+		handled |= unix.LANDLOCK_ACCESS_FS_REFER
+	}
+	if abi >= 3 {
+		handled |= unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	}
+
+	attr := unix.LandlockRulesetAttr{Access_fs: handled}
+	ruleset, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("creating the ruleset: %w", errno)
+	}
+	defer unix.Close(int(ruleset))
+
+	allow := func(path string, access uint64) error {
+		fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+		if errors.Is(err, unix.ENOENT) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("opening %s: %w", path, err)
+		}
+		defer unix.Close(fd)
+		var st unix.Stat_t
+		if err := unix.Fstat(fd, &st); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		access &= handled
+		if st.Mode&unix.S_IFMT != unix.S_IFDIR {
+			access &= landlockFiles
+		}
+		rule := unix.LandlockPathBeneathAttr{Allowed_access: access, Parent_fd: int32(fd)}
+		if _, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, ruleset, unix.LANDLOCK_RULE_PATH_BENEATH, uintptr(unsafe.Pointer(&rule)), 0, 0, 0); errno != 0 {
+			return fmt.Errorf("allowing %s: %w", path, errno)
+		}
+		return nil
+	}
+	for _, path := range read {
+		if err := allow(path, landlockRead); err != nil {
+			return err
+		}
+	}
+	for _, path := range write {
+		if err := allow(path, handled); err != nil {
+			return err
+		}
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, ruleset, 0, 0); errno != 0 {
+		return fmt.Errorf("restricting: %w", errno)
+	}
+	return nil
+}
+
+// seccompDeny installs a seccomp filter making the named system calls fail
+// with EPERM. System calls made another way than the native one, such as
+// 32-bit calls on amd64, fail too, since they have other numbers.
+func seccompDeny(names []string) error {
+	arch, ok := auditArch[runtime.GOARCH]
+	if !ok {
+		return fmt.Errorf("not supported on %s", runtime.GOARCH)
+	}
+	deny := uint32(unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM))
+	stmt := func(code uint16, k uint32) unix.SockFilter { return unix.SockFilter{Code: code, K: k} }
+	jump := func(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+		return unix.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+	}
+
+	// seccomp_data holds the system call's number at offset 0 and the
+	// architecture at offset 4.
+	filter := []unix.SockFilter{
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, 4),
+		jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, arch, 1, 0),
+		stmt(unix.BPF_RET|unix.BPF_K, deny),
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, 0),
+	}
+	if runtime.GOARCH == "amd64" {
+		// x32 system calls share the architecture, with a high bit set.
+		filter = append(filter,
+			jump(unix.BPF_JMP|unix.BPF_JGE|unix.BPF_K, 0x40000000, 0, 1),
+			stmt(unix.BPF_RET|unix.BPF_K, deny))
+	}
+	for _, name := range names {
+		filter = append(filter,
+			jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, uint32(seccompSyscalls[name]), 0, 1),
+			stmt(unix.BPF_RET|unix.BPF_K, deny))
+	}
+	filter = append(filter, stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ALLOW))
+
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	return unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0)
+}
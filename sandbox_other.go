@@ -0,0 +1,24 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+const localSandboxSupported = false
+
+// seccompSyscalls are the system calls a sandbox may deny: none, since
+// sandboxes need Linux.
+var seccompSyscalls = map[string]uintptr{}
+
+func execSandboxed(sb *localSandbox, path string, argv []string) error {
+	return errors.New("only supported on Linux")
+}
+
+func newNamespaces(cmd *exec.Cmd) {}
+
+func enterRoot(root string) error {
+	return errors.New("only supported on Linux")
+}
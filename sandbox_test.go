@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain lets the test binary stand in for http-shell when it is run
+// again as "http-shell sandbox" or "http-shell rlimit" to run a command,
+// and as a server hiding its credentials for TestHideCredentials.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == "hidecredentials" {
+		os.Exit(runHideCredentialsHelper())
+	}
+	if len(os.Args) > 1 && os.Args[1] == "sandbox" {
+		os.Exit(runSandboxCommand(os.Args[2:], os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "rlimit" {
+		os.Exit(runRlimitCommand(os.Args[2:], os.Stderr))
+	}
+	os.Exit(m.Run())
+}
+
+// sandboxServer returns a server whose default profile sandboxes commands
+// so that they can only write to dir, skipping the test if the kernel
+// cannot apply the sandbox.
+func sandboxServer(t *testing.T, dir string, deny ...string) *server {
+	t.Helper()
+	sb := &localSandbox{Write: []string{dir, "/dev/null"}, DenySyscalls: deny}
+	if err := sb.validate(); err != nil {
+		t.Skipf("sandbox not supported: %v", err)
+	}
+	s := newServer(config{Profiles: []profile{{Name: "default", Sandbox: sb}}})
+	if r := runSandboxed(context.Background(), sb, "true", runOptions{}); r.ExitCode != 0 {
+		t.Skipf("sandbox not supported: %v", r.Lines)
+	}
+	return s
+}
+
+func TestHandleCommand_LocalSandbox(t *testing.T) {
+	allowed, outside := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s := sandboxServer(t, allowed)
+
+	tests := []struct{ command, want string }{
+		{"echo hi > " + allowed + "/f && cat " + allowed + "/f", "hi"},
+		{"cat " + outside + "/secret", "Permission denied"},
+		{"echo x > " + outside + "/new", "Permission denied"},
+	}
+	for _, tt := range tests {
+		data := url.Values{}
+		data.Set("text", "$ "+tt.command)
+		if response := postCommand(t, s, data); !strings.Contains(response["text"], tt.want) || strings.Contains(response["text"], "hunter2") {
+			t.Errorf("%q: expected %q, got %q", tt.command, tt.want, response["text"])
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new")); err == nil {
+		t.Error("Expected the sandboxed command unable to create files outside its write paths")
+	}
+
+	data := url.Values{}
+	data.Set("text", "$ sha256 /etc/hostname")
+	if response := postCommand(t, s, data); !strings.Contains(response["text"], "which the sandboxed local backend does not support") {
+		t.Errorf("Expected builtins reading the server's files refused, got %q", response["text"])
+	}
+}
+
+func TestHandleCommand_SandboxDeniesSyscalls(t *testing.T) {
+	s := sandboxServer(t, t.TempDir(), "kill")
+	data := url.Values{}
+	data.Set("text", "$ kill -0 $$")
+	if response := postCommand(t, s, data); !strings.Contains(response["text"], "Operation not permitted") {
+		t.Errorf("Expected kill denied by seccomp, got %q", response["text"])
+	}
+}
+
+// shellRoot returns a directory holding /bin/sh and the libraries it
+// needs, with an empty /tmp, to confine commands to.
+func shellRoot(t *testing.T) string {
+	t.Helper()
+	sh, err := filepath.EvalSymlinks("/bin/sh")
+	if err != nil {
+		t.Skip("no /bin/sh")
+	}
+	out, err := exec.Command("ldd", sh).Output()
+	if err != nil {
+		t.Skipf("listing the libraries of %s: %v", sh, err)
+	}
+	root := t.TempDir()
+	files := map[string]string{"/bin/sh": sh}
+	for _, field := range strings.Fields(string(out)) {
+		if filepath.IsAbs(field) {
+			files[field] = field
+		}
+	}
+	for dst, src := range files {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Join(root, filepath.Dir(dst)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, dst), data, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(root, "tmp"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestHandleCommand_SandboxRoot(t *testing.T) {
+	root := shellRoot(t)
+	sb := &localSandbox{Root: root}
+	if err := sb.validate(); err != nil {
+		t.Skipf("sandbox not supported: %v", err)
+	}
+	if r := runSandboxed(context.Background(), sb, "true", runOptions{}); r.ExitCode != 0 {
+		t.Skipf("sandbox roots not supported: %v", r.Lines)
+	}
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s := newServer(config{Profiles: []profile{{Name: "default", Sandbox: sb}}})
+
+	tests := []struct{ command, want string }{
+		{"cd /bin && echo *", "\nsh`"},
+		{"echo hi > /tmp/f && read x < /tmp/f && echo $x", "hi"},
+		{"read x < " + secret + "; echo $x", "No such file"},
+		{"read x < /etc/hostname", "No such file"},
+	}
+	for _, tt := range tests {
+		data := url.Values{}
+		data.Set("text", "$ "+tt.command)
+		if response := postCommand(t, s, data); !strings.Contains(response["text"], tt.want) || strings.Contains(response["text"], "hunter2") {
+			t.Errorf("%q: expected %q, got %q", tt.command, tt.want, response["text"])
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "tmp", "f")); err != nil || string(data) != "hi\n" {
+		t.Errorf("Expected the command's file written beneath the root, got %q (%v)", data, err)
+	}
+}
+
+func TestLoadProfiles_Sandbox(t *testing.T) {
+	tests := []struct{ data, want string }{
+		{`[{"name": "x", "sandbox": {"read": ["usr"]}}]`, `sandbox: path "usr" is not absolute`},
+		{`[{"name": "x", "sandbox": {"root": "srv/jail"}}]`, `sandbox: root "srv/jail" is not absolute`},
+		{`[{"name": "x", "sandbox": {"deny_syscalls": ["frobnicate"]}}]`, `sandbox: unknown system call "frobnicate"`},
+		{`[{"name": "x", "agent": "web01", "sandbox": {}}]`, "sandbox only applies to commands run on the server's host"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "profiles.json")
+		if err := os.WriteFile(path, []byte(tt.data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadProfiles(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error %q, got %v", tt.data, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// scenario is an end-to-end test read from testdata/scenarios: a request
+// sent to a server talking to a fake Slack, and what must follow. See
+// testdata/scenarios/README.md for the format.
+type scenario struct {
+	Name string `yaml:"name"`
+
+	// Env holds settings as environment variables, read by loadConfig.
+	Env map[string]string `yaml:"env"`
+
+	// Slack holds extra response fields for Web API methods.
+	Slack map[string]map[string]interface{} `yaml:"slack"`
+
+	Request struct {
+		Path string                 `yaml:"path"`
+		Form map[string]string      `yaml:"form"`
+		JSON map[string]interface{} `yaml:"json"`
+	} `yaml:"request"`
+
+	Expect struct {
+		Status   int                    `yaml:"status"`
+		Response map[string]interface{} `yaml:"response"`
+
+		// Command is the command that ran, or "" if none may run.
+		Command *string `yaml:"command"`
+
+		// Messages are calls to the Web API, or posts to the response
+		// URL as method "response_url", in the order they are made. An
+		// empty list means no calls at all.
+		Messages *[]scenarioMessage `yaml:"messages"`
+
+		// Audit are events of the audit log, in order.
+		Audit []map[string]interface{} `yaml:"audit"`
+	} `yaml:"expect"`
+}
+
+type scenarioMessage struct {
+	Method string                 `yaml:"method"`
+	Params map[string]interface{} `yaml:"params"`
+}
+
+func TestScenarios(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "scenarios", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("Expected scenarios in testdata/scenarios")
+	}
+	for _, file := range files {
+		t.Run(strings.TrimSuffix(filepath.Base(file), ".yaml"), func(t *testing.T) {
+			runScenario(t, file)
+		})
+	}
+}
+
+func runScenario(t *testing.T, file string) {
+	f := newFakeSlack(t)
+	f.mux.HandleFunc("/response", func(w http.ResponseWriter, r *http.Request) {
+		var message map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&message)
+		params := url.Values{}
+		for k, v := range message {
+			if s, ok := v.(string); ok {
+				params.Set(k, s)
+			} else if data, err := json.Marshal(v); err == nil {
+				params.Set(k, string(data))
+			}
+		}
+		f.mu.Lock()
+		f.calls = append(f.calls, fakeSlackCall{Method: "response_url", Params: params})
+		f.mu.Unlock()
+	})
+	f.mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	})
+
+	// $SLACK_URL stands for the fake, as for upload URLs.
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sc scenario
+	if err := yaml.Unmarshal([]byte(strings.ReplaceAll(string(data), "$SLACK_URL", f.URL)), &sc); err != nil {
+		t.Fatalf("Parsing %s: %v", file, err)
+	}
+	if sc.Name == "" {
+		t.Fatalf("%s: missing name", file)
+	}
+	t.Log(sc.Name)
+
+	dir := t.TempDir()
+	t.Setenv("SLACK_TOKEN", "xoxb-test")
+	t.Setenv("SLACK_SIGNING_SECRET", scenarioSigningSecret)
+	t.Setenv("SLACK_API_URL", f.URL+"/api/")
+	t.Setenv("DATA_DIR", dir)
+	for k, v := range sc.Env {
+		t.Setenv(k, v)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("Loading config: %v", err)
+	}
+	for method, fields := range sc.Slack {
+		f.respond(method, fields)
+	}
+	s := newServer(cfg)
+
+	req := scenarioRequest(t, sc, f.URL+"/response")
+	w := httptest.NewRecorder()
+	s.routes().ServeHTTP(w, req)
+
+	want := sc.Expect.Status
+	if want == 0 {
+		want = http.StatusOK
+	}
+	if w.Code != want {
+		t.Fatalf("Expected status %d, got %d: %s", want, w.Code, w.Body.String())
+	}
+	if sc.Expect.Response != nil {
+		var response interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Expected a JSON response, got %q", w.Body.String())
+		}
+		if !scenarioMatch(sc.Expect.Response, response) {
+			t.Errorf("Expected response matching %v, got %s", sc.Expect.Response, w.Body.String())
+		}
+	}
+
+	// Messages and audit events may follow the response, so they are
+	// waited for.
+	var audit []interface{}
+	var calls []fakeSlackCall
+	ok := scenarioEventually(func() bool {
+		audit = readScenarioAudit(t, dir)
+		f.mu.Lock()
+		calls = append([]fakeSlackCall(nil), f.calls...)
+		f.mu.Unlock()
+		return scenarioAuditMatch(sc, audit) && scenarioMessagesMatch(sc, calls)
+	})
+	if ok {
+		return
+	}
+	if !scenarioAuditMatch(sc, audit) {
+		events, _ := json.MarshalIndent(audit, "", "  ")
+		t.Errorf("Expected audit events matching %v and command %v, got %s", sc.Expect.Audit, sc.Expect.Command, events)
+	}
+	if !scenarioMessagesMatch(sc, calls) {
+		var got []string
+		for _, c := range calls {
+			got = append(got, fmt.Sprintf("%s %v", c.Method, c.Params))
+		}
+		t.Errorf("Expected messages matching %v, got:\n%s", *sc.Expect.Messages, strings.Join(got, "\n"))
+	}
+}
+
+// scenarioSigningSecret signs scenario requests.
+const scenarioSigningSecret = "scenario-secret"
+
+// scenarioRequest builds the scenario's request, signed with
+// scenarioSigningSecret. Slash commands get the fake's response URL unless
+// they set one.
+func scenarioRequest(t *testing.T, sc scenario, responseURL string) *http.Request {
+	path := sc.Request.Path
+	if path == "" {
+		path = "/"
+	}
+	var req *http.Request
+	var body string
+	if sc.Request.JSON != nil {
+		data, err := json.Marshal(sc.Request.JSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body = string(data)
+		req = httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		form := url.Values{}
+		for k, v := range sc.Request.Form {
+			form.Set(k, v)
+		}
+		if path == "/" && !form.Has("response_url") {
+			form.Set("response_url", responseURL)
+		}
+		body = form.Encode()
+		req = httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	signRequest(req, scenarioSigningSecret, time.Now(), body)
+	return req
+}
+
+// scenarioEventually waits up to five seconds for ok to report true,
+// then reports the last result. It also waits a little after success, so
+// unexpected late messages are caught.
+func scenarioEventually(ok func() bool) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for !ok() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	return ok()
+}
+
+func readScenarioAudit(t *testing.T, dir string) []interface{} {
+	var events []interface{}
+	for _, line := range strings.Split(auditLogText(t, dir), "\n") {
+		var e interface{}
+		if json.Unmarshal([]byte(line), &e) == nil {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func scenarioAuditMatch(sc scenario, audit []interface{}) bool {
+	if sc.Expect.Command != nil {
+		var ran []interface{}
+		for _, e := range audit {
+			if e.(map[string]interface{})["action"] == auditCommandExecuted {
+				ran = append(ran, e)
+			}
+		}
+		if *sc.Expect.Command == "" && len(ran) > 0 ||
+			*sc.Expect.Command != "" && (len(ran) != 1 || ran[0].(map[string]interface{})["command"] != *sc.Expect.Command) {
+			return false
+		}
+	}
+	return scenarioInOrder(len(sc.Expect.Audit), len(audit), func(i, j int) bool {
+		return scenarioMatch(sc.Expect.Audit[i], audit[j])
+	})
+}
+
+func scenarioMessagesMatch(sc scenario, calls []fakeSlackCall) bool {
+	if sc.Expect.Messages == nil {
+		return true
+	}
+	want := *sc.Expect.Messages
+	if len(want) == 0 {
+		return len(calls) == 0
+	}
+	return scenarioInOrder(len(want), len(calls), func(i, j int) bool {
+		if want[i].Method != calls[j].Method {
+			return false
+		}
+		params := map[string]interface{}{}
+		for k := range calls[j].Params {
+			params[k] = calls[j].Params.Get(k)
+		}
+		return scenarioMatch(want[i].Params, params)
+	})
+}
+
+// scenarioInOrder reports whether each of n expectations matches one of
+// m actual items, in order, with other items allowed in between.
+func scenarioInOrder(n, m int, match func(i, j int) bool) bool {
+	i := 0
+	for j := 0; j < m && i < n; j++ {
+		if match(i, j) {
+			i++
+		}
+	}
+	return i == n
+}
+
+// scenarioMatch reports whether got matches want: maps match if each
+// wanted key matches, lists if each wanted item matches one in order,
+// strings if got contains them, and other values if they print the same.
+func scenarioMatch(want, got interface{}) bool {
+	switch want := want.(type) {
+	case map[string]interface{}:
+		got, ok := got.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range want {
+			if !scenarioMatch(v, got[k]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		got, ok := got.([]interface{})
+		return ok && scenarioInOrder(len(want), len(got), func(i, j int) bool {
+			return scenarioMatch(want[i], got[j])
+		})
+	case string:
+		s, ok := got.(string)
+		return ok && strings.Contains(s, want)
+	case nil:
+		return got == nil
+	}
+	return fmt.Sprint(want) == fmt.Sprint(got)
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const scheduleUsage = `usage: schedule "<cron expression>" <command> | schedule list | schedule remove <id>`
+
+// errScheduleNotFound is returned for schedule IDs that are not known in
+// the channel.
+var errScheduleNotFound = errors.New("no such schedule")
+
+// scheduledCommand is a command run on a cron schedule, as its user, with
+// its result posted in the channel it was scheduled from.
+type scheduledCommand struct {
+	ID        string    `json:"id"`
+	Cron      string    `json:"cron"`
+	Command   string    `json:"command"`
+	TeamID    string    `json:"team_id,omitempty"`
+	ChannelID string    `json:"channel_id"`
+	ThreadTS  string    `json:"thread_ts,omitempty"`
+	UserID    string    `json:"user_id"`
+	Created   time.Time `json:"created"`
+}
+
+// scheduler keeps scheduled commands in the backend chosen by openStores,
+// so they survive restarts.
+type scheduler struct {
+	scheduleBackend
+}
+
+// scheduleBackend is where a scheduler keeps scheduled commands.
+type scheduleBackend interface {
+	// add keeps a new schedule.
+	add(e scheduledCommand) error
+	// remove deletes a schedule of the channel. Only the user who added
+	// it may remove it.
+	remove(id, channelID, userID string) (scheduledCommand, error)
+	// list returns the schedules of a channel, or all of them for "", in
+	// the order they were added.
+	list(channelID string) []scheduledCommand
+}
+
+// scheduleFile keeps scheduled commands in a JSON file in the data
+// directory. The file is rewritten on every change.
+type scheduleFile struct {
+	path string
+
+	mu      sync.Mutex
+	entries []scheduledCommand
+}
+
+// newScheduleFile loads the schedules kept in dir, if any.
+func newScheduleFile(dir string) (*scheduleFile, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	sc := &scheduleFile{path: filepath.Join(dir, "schedules.json")}
+	data, err := os.ReadFile(sc.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return sc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &sc.entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", sc.path, err)
+	}
+	return sc, nil
+}
+
+func (sc *scheduleFile) add(e scheduledCommand) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	entries := append(append([]scheduledCommand(nil), sc.entries...), e)
+	if err := sc.write(entries); err != nil {
+		return err
+	}
+	sc.entries = entries
+	return nil
+}
+
+func (sc *scheduleFile) remove(id, channelID, userID string) (scheduledCommand, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for i, e := range sc.entries {
+		if e.ID != id || e.ChannelID != channelID {
+			continue
+		}
+		if e.UserID != userID {
+			return e, fmt.Errorf("only <@%s> can remove schedule %s", e.UserID, id)
+		}
+		entries := append(append([]scheduledCommand(nil), sc.entries[:i]...), sc.entries[i+1:]...)
+		if err := sc.write(entries); err != nil {
+			return e, err
+		}
+		sc.entries = entries
+		return e, nil
+	}
+	return scheduledCommand{}, errScheduleNotFound
+}
+
+func (sc *scheduleFile) list(channelID string) []scheduledCommand {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	var entries []scheduledCommand
+	for _, e := range sc.entries {
+		if channelID == "" || e.ChannelID == channelID {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// write replaces the file with entries.
+func (sc *scheduleFile) write(entries []scheduledCommand) error {
+	return writeJSONFile(sc.path, entries)
+}
+
+// runScheduler runs scheduled commands as they fall due, checking at the
+// start of every minute.
+func (s *server) runScheduler() {
+	for {
+		next := time.Now().Truncate(time.Minute).Add(time.Minute)
+		time.Sleep(time.Until(next))
+		s.runDueSchedules(context.Background(), next)
+	}
+}
+
+// runDueSchedules starts the scheduled commands that fire at t's minute,
+// unless another server sharing the store runs them.
+func (s *server) runDueSchedules(ctx context.Context, t time.Time) {
+	if !s.leader.isLeader() {
+		return
+	}
+	for _, e := range s.schedules.list("") {
+		sched, err := parseCron(e.Cron)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing schedule %s: %v\n", e.ID, err)
+			continue
+		}
+		if sched.matches(t) {
+			go s.runScheduled(ctx, e)
+		}
+	}
+}
+
+// runScheduled runs a scheduled command through the same checks as one
+// typed by its user, and posts the result in its channel.
+func (s *server) runScheduled(ctx context.Context, e scheduledCommand) {
+	cmd := slashCommand{
+		Text:      e.Command,
+		UserID:    e.UserID,
+		ChannelID: e.ChannelID,
+		TeamID:    e.TeamID,
+		ThreadTS:  e.ThreadTS,
+	}
+	s.postInThread(ctx, cmd, s.handleCommandExecution(ctx, cmd))
+}
+
+func runSchedule(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	fail := func(code int, msg string) commandResult {
+		return commandResult{Lines: []string{msg}, ExitCode: code, Duration: time.Since(startTime)}
+	}
+	if len(args) == 0 {
+		return fail(2, scheduleUsage)
+	}
+	if s.schedules == nil || s.slack == nil {
+		return fail(1, "schedule needs DATA_DIR and SLACK_TOKEN")
+	}
+
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return fail(2, scheduleUsage)
+		}
+		return commandResult{Lines: s.scheduleLines(cmd.ChannelID), Duration: time.Since(startTime)}
+	case "remove", "rm":
+		if len(args) != 2 {
+			return fail(2, scheduleUsage)
+		}
+		e, err := s.schedules.remove(args[1], cmd.ChannelID, cmd.UserID)
+		if err != nil {
+			return fail(1, "schedule: "+err.Error())
+		}
+		return commandResult{Lines: []string{fmt.Sprintf("removed schedule %s: %s", e.ID, e.Command)}, Duration: time.Since(startTime)}
+	}
+
+	expr, command, err := parseScheduleArgs(args)
+	if err != nil {
+		return fail(2, err.Error())
+	}
+	sched, err := parseCron(expr)
+	if err != nil {
+		return fail(1, "schedule: "+err.Error())
+	}
+	if b, _, ok := s.lookupBuiltin(command); ok && (b.Name == "schedule" || b.Name == "watch") {
+		return fail(2, "schedule: cannot schedule "+b.Name)
+	}
+	// Each run is checked again as it starts, but a command that could
+	// never run unattended is refused now rather than every time.
+	if hits := detectSuspicious(command, s.cfg.Honeytokens); len(hits) > 0 {
+		return fail(1, "schedule: refusing to schedule a suspicious command")
+	}
+	if severity, _ := s.classify(command); severity == severityDangerous {
+		return fail(1, "schedule: refusing to schedule a dangerous command")
+	}
+	if d := s.checkPolicy(ctx, cmd, command); d.Decision != policyAllow {
+		return fail(1, "schedule: the policy does not allow running this command")
+	}
+
+	e := scheduledCommand{
+		ID:        randomToken()[:8],
+		Cron:      expr,
+		Command:   command,
+		TeamID:    cmd.TeamID,
+		ChannelID: cmd.ChannelID,
+		ThreadTS:  cmd.ThreadTS,
+		UserID:    cmd.UserID,
+		Created:   time.Now(),
+	}
+	if err := s.schedules.add(e); err != nil {
+		return fail(1, "schedule: "+err.Error())
+	}
+	lines := []string{fmt.Sprintf("scheduled %s: %s, %s", e.ID, command, sched.describe())}
+	if next := sched.next(time.Now()); !next.IsZero() {
+		lines = append(lines, "next run: "+formatClock(next))
+	}
+	return commandResult{Lines: lines, Duration: time.Since(startTime)}
+}
+
+// parseScheduleArgs splits the arguments of "schedule" into the cron
+// expression, which is quoted unless it is a macro such as @daily, and
+// the command after it.
+func parseScheduleArgs(args []string) (string, string, error) {
+	if strings.HasPrefix(args[0], "@") {
+		if len(args) < 2 {
+			return "", "", errors.New(scheduleUsage)
+		}
+		return args[0], strings.Join(args[1:], " "), nil
+	}
+
+	text := strings.Join(args, " ")
+	quote := text[0]
+	if quote != '"' && quote != '\'' {
+		return "", "", errors.New(scheduleUsage)
+	}
+	end := strings.IndexByte(text[1:], quote)
+	if end < 0 {
+		return "", "", errors.New("schedule: unterminated cron expression")
+	}
+	expr, command := text[1:end+1], strings.TrimSpace(text[end+2:])
+	if command == "" {
+		return "", "", errors.New(scheduleUsage)
+	}
+	return expr, command, nil
+}
+
+// scheduleLines lists a channel's schedules, soonest first.
+func (s *server) scheduleLines(channelID string) []string {
+	entries := s.schedules.list(channelID)
+	if len(entries) == 0 {
+		return []string{"no schedules in this channel"}
+	}
+	type listed struct {
+		e    scheduledCommand
+		next time.Time
+		desc string
+	}
+	now := time.Now()
+	rows := make([]listed, 0, len(entries))
+	for _, e := range entries {
+		row := listed{e: e, desc: "invalid schedule"}
+		if sched, err := parseCron(e.Cron); err == nil {
+			row.next, row.desc = sched.next(now), sched.describe()
+		}
+		rows = append(rows, row)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].next.IsZero() != rows[j].next.IsZero() {
+			return !rows[i].next.IsZero()
+		}
+		return rows[i].next.Before(rows[j].next)
+	})
+
+	lines := make([]string, 0, len(rows))
+	for _, r := range rows {
+		next := "never"
+		if !r.next.IsZero() {
+			next = formatClock(r.next)
+		}
+		lines = append(lines, fmt.Sprintf("%s  %-15s  %s  (%s; next %s; by <@%s>)", r.e.ID, r.e.Cron, r.e.Command, r.desc, next, r.e.UserID))
+	}
+	return lines
+}
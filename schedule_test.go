@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseScheduleArgs(t *testing.T) {
+	tests := []struct {
+		args        []string
+		wantExpr    string
+		wantCommand string
+		wantErr     bool
+	}{
+		{[]string{`"0`, "9", "*", "*", `1-5"`, "df", "-h"}, "0 9 * * 1-5", "df -h", false},
+		{[]string{`'*/5`, "*", "*", "*", `*'`, "uptime"}, "*/5 * * * *", "uptime", false},
+		{[]string{"@daily", "df", "-h"}, "@daily", "df -h", false},
+		{[]string{"@daily"}, "", "", true},
+		{[]string{`"0`, "9", "*", "*", `1-5"`}, "", "", true},
+		{[]string{`"0`, "9", "*", "*", "1-5", "df"}, "", "", true},
+		{[]string{"0", "9", "*", "*", "*", "df"}, "", "", true},
+	}
+	for _, tt := range tests {
+		expr, command, err := parseScheduleArgs(tt.args)
+		if (err != nil) != tt.wantErr || expr != tt.wantExpr || command != tt.wantCommand {
+			t.Errorf("parseScheduleArgs(%q) = %q, %q, %v", tt.args, expr, command, err)
+		}
+	}
+}
+
+func TestSchedule_AddListRemove(t *testing.T) {
+	f := newFakeSlack(t)
+	cfg := f.config()
+	cfg.DataDir = t.TempDir()
+	s := newServer(cfg)
+	ctx := context.Background()
+
+	response := s.handleCommandExecution(ctx, slashCommand{Text: `$ schedule "0 9 * * 1-5" echo morning`, UserID: "U1", ChannelID: "C1"})
+	if !strings.Contains(response["text"], "scheduled ") || !strings.Contains(response["text"], "next run:") {
+		t.Fatalf("Expected the schedule to be added, got %q", response["text"])
+	}
+	entries := s.schedules.list("C1")
+	if len(entries) != 1 || entries[0].Cron != "0 9 * * 1-5" || entries[0].Command != "echo morning" {
+		t.Fatalf("Expected one schedule, got %+v", entries)
+	}
+	id := entries[0].ID
+
+	// Schedules survive a restart.
+	reloaded, err := openStores(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.schedules.list(""); len(got) != 1 || got[0].ID != id {
+		t.Fatalf("Expected the schedule to be reloaded, got %+v", got)
+	}
+
+	response = s.handleCommandExecution(ctx, slashCommand{Text: "$ schedule list", UserID: "U2", ChannelID: "C1"})
+	if !strings.Contains(response["text"], id) || !strings.Contains(response["text"], "echo morning") {
+		t.Errorf("Expected the schedule listed, got %q", response["text"])
+	}
+	response = s.handleCommandExecution(ctx, slashCommand{Text: "$ schedule list", UserID: "U1", ChannelID: "C2"})
+	if !strings.Contains(response["text"], "no schedules in this channel") {
+		t.Errorf("Expected other channels' schedules to be hidden, got %q", response["text"])
+	}
+
+	response = s.handleCommandExecution(ctx, slashCommand{Text: "$ schedule remove " + id, UserID: "U2", ChannelID: "C1"})
+	if !strings.Contains(response["text"], "only <@U1> can remove") {
+		t.Errorf("Expected only the owner to remove the schedule, got %q", response["text"])
+	}
+	response = s.handleCommandExecution(ctx, slashCommand{Text: "$ schedule remove " + id, UserID: "U1", ChannelID: "C1"})
+	if !strings.Contains(response["text"], "removed schedule "+id) {
+		t.Errorf("Expected the schedule removed, got %q", response["text"])
+	}
+	if got := s.schedules.list(""); len(got) != 0 {
+		t.Errorf("Expected no schedules left, got %+v", got)
+	}
+}
+
+func TestSchedule_RefusesDangerousCommands(t *testing.T) {
+	f := newFakeSlack(t)
+	cfg := f.config()
+	cfg.DataDir = t.TempDir()
+	cfg.ClassifierRules = dangerRules([]*regexp.Regexp{regexp.MustCompile(`rm -rf`)})
+	s := newServer(cfg)
+
+	// Even once confirmed, a dangerous command is not run unattended.
+	response := s.handleCommandExecution(context.Background(), slashCommand{Text: `$ schedule "@hourly" rm -rf /tmp/x`, UserID: "U1", ChannelID: "C1", Confirmed: true})
+	if !strings.Contains(response["text"], "refusing to schedule a dangerous command") {
+		t.Errorf("Expected the dangerous command refused, got %q", response["text"])
+	}
+	if got := s.schedules.list(""); len(got) != 0 {
+		t.Errorf("Expected nothing scheduled, got %+v", got)
+	}
+}
+
+func TestRunDueSchedules(t *testing.T) {
+	f := newFakeSlack(t)
+	cfg := f.config()
+	cfg.DataDir = t.TempDir()
+	s := newServer(cfg)
+	for _, e := range []scheduledCommand{
+		{ID: "a", Cron: "0 9 * * *", Command: "echo due", ChannelID: "C1", UserID: "U1"},
+		{ID: "b", Cron: "30 9 * * *", Command: "echo later", ChannelID: "C1", UserID: "U1"},
+	} {
+		if err := s.schedules.add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.runDueSchedules(context.Background(), time.Date(2024, 3, 4, 9, 0, 0, 0, time.Local))
+	posts := waitForCalls(t, f, "chat.postMessage", 1)
+	time.Sleep(50 * time.Millisecond)
+	if posts = f.callsTo("chat.postMessage"); len(posts) != 1 {
+		t.Fatalf("Expected one scheduled run, got %v", posts)
+	}
+	if posts[0].Params.Get("channel") != "C1" || !strings.Contains(posts[0].Params.Get("text"), "due") {
+		t.Errorf("Expected the due command's output in its channel, got %v", posts[0].Params)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults for transcript searches.
+const (
+	searchDefaultSince = 7 * 24 * time.Hour
+	searchDefaultLimit = 10
+	searchMaxLimit     = 100
+)
+
+// searchHit is a stored job whose command or output matches a search.
+type searchHit struct {
+	Job     jobRecord
+	Snippet []string // the first matching line with the lines around it
+}
+
+// search returns public jobs started at or after since, and visible to
+// the searcher, whose command or output contains query, ignoring case,
+// newest first.
+func (st *jobStore) search(query string, since time.Time, limit int, visible func(jobRecord) bool) ([]searchHit, error) {
+	lower := strings.ToLower(query)
+	var hits []searchHit
+	err := st.scanMatching(query, jobFilter{Since: since}, func(r jobRecord) bool {
+		// Earlier searches would match their own query.
+		if r.Private || isSearch(r.Text) || !visible(r) {
+			return true
+		}
+		hit := searchHit{Job: r, Snippet: snippet(r.Lines, 0)}
+		for i, line := range r.Lines {
+			if strings.Contains(strings.ToLower(line), lower) {
+				hit.Snippet = snippet(r.Lines, i)
+				break
+			}
+		}
+		hits = append(hits, hit)
+		return len(hits) < limit
+	})
+	return hits, err
+}
+
+// contains reports whether the job's command or output contains text,
+// ignoring case.
+func (r jobRecord) contains(text string) bool {
+	text = strings.ToLower(text)
+	if strings.Contains(strings.ToLower(r.Text), text) {
+		return true
+	}
+	for _, line := range r.Lines {
+		if strings.Contains(strings.ToLower(line), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSearch reports whether a command is the search builtin.
+func isSearch(text string) bool {
+	fields := strings.Fields(strings.TrimPrefix(text, "$"))
+	return len(fields) > 0 && fields[0] == "search"
+}
+
+// snippet returns line i of lines with one line of context on each side.
+func snippet(lines []string, i int) []string {
+	if len(lines) == 0 {
+		return nil
+	}
+	return lines[max(i-1, 0):min(i+2, len(lines))]
+}
+
+// parseSince parses a search window such as "7d", "12h" or "30m".
+func parseSince(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid --since %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid --since %q", s)
+	}
+	return d, nil
+}
+
+// runSearch is the search builtin: $ search "connection refused" --since=7d
+func runSearch(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	fail := func(msg string) commandResult {
+		return commandResult{Lines: []string{msg}, ExitCode: 2, Duration: time.Since(startTime)}
+	}
+
+	since := searchDefaultSince
+	var words []string
+	for _, arg := range args {
+		if v, ok := strings.CutPrefix(arg, "--since="); ok {
+			d, err := parseSince(v)
+			if err != nil {
+				return fail(err.Error())
+			}
+			since = d
+			continue
+		}
+		words = append(words, arg)
+	}
+	query := strings.Trim(strings.Join(words, " "), `"'`)
+	if query == "" {
+		return fail(`usage: search "text" [--since=7d]`)
+	}
+
+	v := s.viewerFor(cmd)
+	hits, err := s.store.search(query, startTime.Add(-since), searchDefaultLimit, func(r jobRecord) bool { return s.canView(v, r) })
+	if err != nil {
+		return fail(fmt.Sprintf("search failed: %v", err))
+	}
+
+	lines := []string{fmt.Sprintf("%d jobs matching %q", len(hits), query)}
+	for _, h := range hits {
+		lines = append(lines, "", fmt.Sprintf("%s %s %s (%s)", h.Job.ID, h.Job.Started.Format("2006-01-02 15:04"), h.Job.Text, translateExitCode(h.Job.ExitCode)))
+		for _, line := range h.Snippet {
+			lines = append(lines, "  "+line)
+		}
+		if link := s.transcriptURL(h.Job.ID); link != "" {
+			lines = append(lines, "  "+link)
+		}
+	}
+	return commandResult{Lines: lines, Duration: time.Since(startTime)}
+}
+
+// handleSearch serves transcript searches as JSON:
+// GET <admin>/search?q=connection+refused&since=7d&limit=20
+func (s *server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	v, err := s.apiViewer(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		http.Error(w, "Missing required parameter: q", http.StatusBadRequest)
+		return
+	}
+	since := searchDefaultSince
+	if v := r.URL.Query().Get("since"); v != "" {
+		d, err := parseSince(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		since = d
+	}
+	limit := searchDefaultLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > searchMaxLimit {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	hits, err := s.store.search(query, time.Now().Add(-since), limit, func(r jobRecord) bool { return s.canView(v, r) })
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error searching jobs: %v\n", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	type result struct {
+		ID        string    `json:"id"`
+		ChannelID string    `json:"channel_id"`
+		UserID    string    `json:"user_id"`
+		Text      string    `json:"text"`
+		ExitCode  int       `json:"exit_code"`
+		Started   time.Time `json:"started"`
+		Snippet   []string  `json:"snippet"`
+		URL       string    `json:"url,omitempty"`
+	}
+	results := make([]result, 0, len(hits))
+	for _, h := range hits {
+		results = append(results, result{
+			ID:        h.Job.ID,
+			ChannelID: h.Job.ChannelID,
+			UserID:    h.Job.UserID,
+			Text:      h.Job.Text,
+			ExitCode:  h.Job.ExitCode,
+			Started:   h.Job.Started,
+			Snippet:   h.Snippet,
+			URL:       s.transcriptURL(h.Job.ID),
+		})
+	}
+	writeJSON(w, results)
+}
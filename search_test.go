@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSince(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"7d", 7 * 24 * time.Hour, true},
+		{"12h", 12 * time.Hour, true},
+		{"30m", 30 * time.Minute, true},
+		{"xd", 0, false},
+		{"-1h", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseSince(tt.in)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("parseSince(%q) = %s, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	s := newServer(config{DataDir: t.TempDir(), PublicURL: "https://shell.example.com", SensitiveChannels: map[string]bool{"C2": true}, APITokens: map[string]string{"tok-u1": "U1"}})
+	ctx := context.Background()
+	s.handleCommandExecution(ctx, slashCommand{Text: "$ printf 'a\\nb\\ncurl: Connection refused\\nc\\nd\\n'", UserID: "U1", ChannelID: "C1"})
+	s.handleCommandExecution(ctx, slashCommand{Text: "$ echo all good", UserID: "U1", ChannelID: "C1"})
+	s.handleCommandExecution(ctx, slashCommand{Text: "$ echo connection refused", UserID: "U1", ChannelID: "C2"})
+
+	response := s.handleCommandExecution(ctx, slashCommand{Text: `$ search "connection refused" --since=1d`, UserID: "U1", ChannelID: "C1"})
+	text := response["text"]
+	for _, want := range []string{"1 jobs matching \"connection refused\"", "  b\n  curl: Connection refused\n  c\n", "https://shell.example.com/debug/transcripts/"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in search result, got %q", want, text)
+		}
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer tok-u1")
+		w := httptest.NewRecorder()
+		s.routes().ServeHTTP(w, req)
+		return w
+	}
+
+	// The search itself is stored but does not match later searches.
+	w := get("/debug/search?q=Connection+Refused&limit=5")
+	var results []struct {
+		Text    string   `json:"text"`
+		Snippet []string `json:"snippet"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Expected JSON results, got %d %q", w.Code, w.Body)
+	}
+	if len(results) != 1 || !strings.HasPrefix(results[0].Text, "$ printf") || len(results[0].Snippet) != 3 {
+		t.Errorf("Expected the public match only, got %+v", results)
+	}
+
+	if w = get("/debug/search?q=x&since=soon"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected bad request for an invalid window, got %d", w.Code)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Audit actions recorded when a command is refused or flagged, which the
+// security report is built from.
+const (
+	auditPolicyDenied          = "policy_denied"
+	auditCommandBlocked        = "command_blocked"
+	auditSuspiciousCommand     = "suspicious_command"
+	auditConfirmationRequested = "confirmation_requested"
+)
+
+// securityReportTop is how many risky patterns a report lists.
+const securityReportTop = 5
+
+// securityReportMaxDenied is how many denied or blocked commands a report
+// lists; the rest are only counted.
+const securityReportMaxDenied = 10
+
+// defaultSecurityReportTemplate renders a report unless
+// SECURITY_REPORT_TEMPLATE names another.
+const defaultSecurityReportTemplate = `*Weekly security report*, {{.Since.Format "Mon Jan 2"}} to {{.Until.Format "Mon Jan 2"}}
+*Denied or blocked:* {{len .Denied}}
+{{- range .Denied}}
+• {{.Time.Local.Format "Mon 15:04"}} <@{{.UserID}}> in <#{{.ChannelID}}>: ` + "`{{.Command}}`" + ` ({{.Detail}})
+{{- end}}
+{{- if gt .MoreDenied 0}}
+• …and {{.MoreDenied}} more
+{{- end}}
+*Approvals:* {{.Approvals.Requested}} requested, {{.Approvals.Granted}} granted, {{.Approvals.Denied}} denied, {{.Approvals.Expired}} expired
+*Top risky patterns:*{{if not .Patterns}} none{{end}}
+{{- range .Patterns}}
+• {{.Pattern}} ({{.Count}})
+{{- end}}
+*New users:*{{if not .NewUsers}} none{{else}}{{range .NewUsers}} <@{{.}}>{{end}}{{end}}`
+
+// securityReport is the data a report template is rendered with.
+type securityReport struct {
+	Since, Until time.Time
+
+	Denied     []auditEvent // denied and blocked commands, latest first
+	MoreDenied int          // denied commands beyond those listed
+
+	Approvals struct {
+		Requested, Granted, Denied, Expired int
+	}
+	Patterns []patternCount // risky patterns attempted, most frequent first
+	NewUsers []string       // users whose first command was in the period
+}
+
+type patternCount struct {
+	Pattern string
+	Count   int
+}
+
+// parseWeekClock parses a day and time of the week such as "mon 09:00".
+func parseWeekClock(s string) (time.Weekday, time.Duration, error) {
+	day, clock, ok := strings.Cut(strings.TrimSpace(s), " ")
+	if !ok {
+		return 0, 0, fmt.Errorf("%q is not <day> HH:MM", s)
+	}
+	weekday, ok := weekdays[strings.ToLower(day)]
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown day %q", day)
+	}
+	offset, err := parseClock(strings.TrimSpace(clock))
+	return weekday, offset, err
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// nextWeekAt returns the first time after now on the given day of the week
+// at the given offset from midnight.
+func nextWeekAt(now time.Time, day time.Weekday, offset time.Duration) time.Time {
+	next := nextAt(now, offset)
+	for next.Weekday() != day {
+		next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, next.Location()).Add(offset)
+	}
+	return next
+}
+
+// runSecurityReport sends the weekly security report to the admins at the
+// configured time.
+func (s *server) runSecurityReport() {
+	day, offset, _ := parseWeekClock(s.cfg.SecurityReportAt)
+	for {
+		next := nextWeekAt(time.Now(), day, offset)
+		time.Sleep(time.Until(next))
+		s.sendSecurityReport(context.Background(), next.AddDate(0, 0, -7), next)
+	}
+}
+
+// sendSecurityReport DMs a report of the given period to each admin.
+func (s *server) sendSecurityReport(ctx context.Context, since, until time.Time) {
+	report, err := s.buildSecurityReport(since, until)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error building security report: %v\n", err)
+		return
+	}
+	text, err := s.renderSecurityReport(report)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error rendering security report: %v\n", err)
+		return
+	}
+	for _, admin := range s.cfg.SecurityReportAdmins {
+		channel, err := s.openDM(ctx, admin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening DM with %s: %v\n", admin, err)
+			continue
+		}
+		if err := s.slack.call(ctx, "chat.postMessage", url.Values{"channel": {channel}, "text": {text}}, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Error sending security report to %s: %v\n", admin, err)
+		}
+	}
+}
+
+// buildSecurityReport gathers a period's audit events and new users.
+func (s *server) buildSecurityReport(since, until time.Time) (securityReport, error) {
+	report := securityReport{Since: since, Until: until}
+	events, err := s.auditLog.between(since, until)
+	if err != nil {
+		return report, err
+	}
+
+	patterns := make(map[string]int)
+	for _, e := range events {
+		switch e.Action {
+		case auditPolicyDenied, auditCommandBlocked:
+			report.Denied = append(report.Denied, e)
+		case "approval_requested":
+			report.Approvals.Requested++
+		case "approval_granted":
+			report.Approvals.Granted++
+		case "approval_denied":
+			report.Approvals.Denied++
+		case "approval_expired":
+			report.Approvals.Expired++
+		}
+		switch e.Action {
+		case auditCommandBlocked, auditSuspiciousCommand, auditConfirmationRequested:
+			for _, p := range strings.Split(e.Detail, ", ") {
+				if p != "" {
+					patterns[p]++
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(report.Denied, func(i, j int) bool { return report.Denied[i].Time.After(report.Denied[j].Time) })
+	if len(report.Denied) > securityReportMaxDenied {
+		report.MoreDenied = len(report.Denied) - securityReportMaxDenied
+		report.Denied = report.Denied[:securityReportMaxDenied]
+	}
+	for p, n := range patterns {
+		report.Patterns = append(report.Patterns, patternCount{p, n})
+	}
+	sort.Slice(report.Patterns, func(i, j int) bool {
+		if report.Patterns[i].Count != report.Patterns[j].Count {
+			return report.Patterns[i].Count > report.Patterns[j].Count
+		}
+		return report.Patterns[i].Pattern < report.Patterns[j].Pattern
+	})
+	if len(report.Patterns) > securityReportTop {
+		report.Patterns = report.Patterns[:securityReportTop]
+	}
+
+	if s.store != nil {
+		if report.NewUsers, err = s.store.firstSeenBetween(since, until); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// renderSecurityReport renders a report with SECURITY_REPORT_TEMPLATE or
+// the default template.
+func (s *server) renderSecurityReport(report securityReport) (string, error) {
+	tmpl := s.cfg.SecurityReportTemplate
+	if tmpl == nil {
+		tmpl = texttemplate.Must(texttemplate.New("report").Parse(defaultSecurityReportTemplate))
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, report); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// loadSecurityReportTemplate parses a report template file.
+func loadSecurityReportTemplate(path string) (*texttemplate.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return texttemplate.New("report").Parse(string(data))
+}
+
+// auditRefusal records a command that was refused or flagged before it
+// ran, with the reasons or patterns behind it as the detail.
+func (s *server) auditRefusal(cmd slashCommand, action, detail string) {
+	s.auditLog.record(auditEvent{
+		Action:    action,
+		UserID:    cmd.UserID,
+		ChannelID: cmd.ChannelID,
+		TeamID:    cmd.TeamID,
+		Command:   s.displayText(cmd),
+		Detail:    detail,
+	})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	texttemplate "text/template"
+	"time"
+)
+
+func TestNextWeekAt(t *testing.T) {
+	day, offset, err := parseWeekClock("Mon 09:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2025-03-01 is a Saturday.
+	now := time.Date(2025, 3, 1, 17, 30, 0, 0, time.UTC)
+	if got := nextWeekAt(now, day, offset); !got.Equal(time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected next Monday, got %s", got)
+	}
+	if got := nextWeekAt(now, time.Saturday, 18*time.Hour); !got.Equal(time.Date(2025, 3, 1, 18, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected later today, got %s", got)
+	}
+	if got := nextWeekAt(now, time.Saturday, 9*time.Hour); !got.Equal(time.Date(2025, 3, 8, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected a week today, got %s", got)
+	}
+
+	for _, bad := range []string{"09:00", "someday 09:00", "mon 9am"} {
+		if _, _, err := parseWeekClock(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestSecurityReport(t *testing.T) {
+	f := newFakeSlack(t)
+	f.respond("conversations.open", map[string]interface{}{"channel": map[string]string{"id": "D1"}})
+	cfg := f.config()
+	cfg.DataDir = t.TempDir()
+	cfg.SecurityReportAdmins = []string{"UADMIN"}
+	s := newServer(cfg)
+
+	since := time.Now().Add(-time.Hour)
+	s.auditRefusal(slashCommand{Text: "$ cat /etc/shadow", UserID: "U1", ChannelID: "C1"}, auditCommandBlocked, "honeytoken, credential file")
+	s.auditRefusal(slashCommand{Text: "$ curl evil", UserID: "U2", ChannelID: "C1"}, auditPolicyDenied, "egress denied")
+	s.auditRefusal(slashCommand{Text: "$ cat ~/.aws/credentials", UserID: "U1", ChannelID: "C1"}, auditSuspiciousCommand, "credential file")
+	s.auditApproval(&approval{Cmd: slashCommand{Text: "$ deploy", UserID: "U1"}}, "approval_granted", "U2")
+	s.recordJob(&job{ID: "j1", Cmd: slashCommand{Text: "$ uptime", UserID: "U3", ChannelID: "C1"}, Started: time.Now()}, commandResult{})
+
+	s.sendSecurityReport(context.Background(), since, time.Now().Add(time.Minute))
+
+	if calls := f.callsTo("conversations.open"); len(calls) != 1 || calls[0].Params.Get("users") != "UADMIN" {
+		t.Fatalf("Expected a DM opened with the admin, got %v", calls)
+	}
+	posts := f.callsTo("chat.postMessage")
+	if len(posts) != 1 || posts[0].Params.Get("channel") != "D1" {
+		t.Fatalf("Expected the report in the DM, got %v", posts)
+	}
+	text := posts[0].Params.Get("text")
+	for _, want := range []string{
+		"*Denied or blocked:* 2",
+		"`$ cat /etc/shadow` (honeytoken, credential file)",
+		"`$ curl evil` (egress denied)",
+		"0 requested, 1 granted",
+		"• credential file (2)",
+		"• honeytoken (1)",
+		"*New users:* <@U3>",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in the report, got:\n%s", want, text)
+		}
+	}
+}
+
+func TestSecurityReport_Template(t *testing.T) {
+	cfg := config{DataDir: t.TempDir()}
+	cfg.SecurityReportTemplate = texttemplate.Must(texttemplate.New("report").Parse("{{len .Denied}} denied, {{len .NewUsers}} new"))
+	s := newServer(cfg)
+	s.auditRefusal(slashCommand{Text: "$ rm -rf /", UserID: "U1"}, auditPolicyDenied, "no")
+
+	report, err := s.buildSecurityReport(time.Now().Add(-time.Hour), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := s.renderSecurityReport(report)
+	if err != nil || text != "1 denied, 0 new" {
+		t.Errorf("Expected the custom template, got %q, %v", text, err)
+	}
+}
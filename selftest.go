@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// selftestSecret is a made-up AWS access key in the canary output, which
+// redaction must remove.
+const selftestSecret = "AKIAZZZZSELFTEST0000"
+
+// selftestStage is one part of the pipeline checked by the selftest
+// builtin. check returns why the stage was skipped, as when it is not
+// configured, or why it failed, or neither if it passed.
+type selftestStage struct {
+	name  string
+	check func(ctx context.Context) (skip, fail string)
+}
+
+// runSelftest is the selftest builtin, for admins: it sends a canary
+// command through each stage of the pipeline and reports which passed,
+// to validate a deployment after changes.
+func runSelftest(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	if !s.cfg.Admins[cmd.UserID] {
+		return commandResult{Lines: []string{"selftest: only admins can run the self-test"}, ExitCode: 1, Duration: time.Since(startTime)}
+	}
+
+	token := randomToken()[:8]
+	canary := fmt.Sprintf("printf 'selftest %%s\\n' %s; printf 'key=%%s\\n' %s", token, selftestSecret)
+	want := []string{"selftest " + token, "key=" + selftestSecret}
+	var streamed bytes.Buffer
+	var result commandResult
+
+	stages := []selftestStage{
+		{"queueing", func(ctx context.Context) (string, string) {
+			_, j := s.jobs.start(ctx, cmd, canary)
+			_, err := s.jobs.get(j.ID, cmd.UserID)
+			s.jobs.finish(j)
+			if err != nil {
+				return "", "job was not registered: " + err.Error()
+			}
+			if _, err := s.jobs.get(j.ID, cmd.UserID); err == nil {
+				return "", "job was not removed when finished"
+			}
+			return "", ""
+		}},
+		{"execution", func(ctx context.Context) (string, string) {
+			result = runCommand(ctx, canary, runOptions{Progress: &streamed})
+			if result.ExitCode != 0 {
+				return "", "canary exited with " + translateExitCode(result.ExitCode)
+			}
+			if strings.Join(result.Lines, "\n") != strings.Join(want, "\n") {
+				return "", fmt.Sprintf("unexpected output %q", result.Lines)
+			}
+			return "", ""
+		}},
+		{"streaming", func(ctx context.Context) (string, string) {
+			if !strings.Contains(streamed.String(), want[0]) {
+				return "", "output was not streamed while the canary ran"
+			}
+			return "", ""
+		}},
+		{"fallback", func(ctx context.Context) (string, string) {
+			if s.cfg.MaxMessageChars <= 0 {
+				return "no MAX_MESSAGE_CHARS", ""
+			}
+			long := commandResult{}
+			for len(strings.Join(long.Lines, "\n")) <= 2*s.cfg.MaxMessageChars {
+				long.Lines = append(long.Lines, want[0])
+			}
+			// A server without Slack or quotas shortens output as the
+			// last resort, without posting anything.
+			scratch := newServer(config{MaxMessageChars: s.cfg.MaxMessageChars})
+			text := scratch.deliver(ctx, slashCommand{Text: "$ selftest"}, nil, long)["text"]
+			if len(text) > s.cfg.MaxMessageChars || !strings.Contains(text, "more lines truncated") {
+				return "", fmt.Sprintf("long output gave a %d-char message, limit %d", len(text), s.cfg.MaxMessageChars)
+			}
+			return "", ""
+		}},
+		{"redaction", func(ctx context.Context) (string, string) {
+			if strings.Contains(strings.Join(redactLines(want), "\n"), selftestSecret) {
+				return "", "the canary's secret was not redacted"
+			}
+			return "", ""
+		}},
+		{"persistence", func(ctx context.Context) (string, string) {
+			if s.store == nil {
+				return "no DATA_DIR", ""
+			}
+			r := jobRecord{
+				ID:        "selftest-" + token,
+				ChannelID: cmd.ChannelID,
+				UserID:    cmd.UserID,
+				Text:      "$ selftest",
+				Lines:     redactLines(result.Lines),
+				Started:   startTime,
+				Private:   true,
+			}
+			if err := s.store.save(r); err != nil {
+				return "", err.Error()
+			}
+			stored, err := s.store.job(r.ID)
+			if err != nil {
+				return "", "saved job cannot be read back: " + err.Error()
+			}
+			if strings.Join(stored.Lines, "\n") != strings.Join(r.Lines, "\n") {
+				return "", "saved job was read back changed"
+			}
+			return "", ""
+		}},
+		{"slack", func(ctx context.Context) (string, string) {
+			if s.slack == nil {
+				return "no SLACK_TOKEN", ""
+			}
+			if err := s.slack.call(ctx, "auth.test", nil, nil); err != nil {
+				return "", err.Error()
+			}
+			return "", ""
+		}},
+	}
+
+	lines := []string{"selftest " + token}
+	failed := 0
+	for _, stage := range stages {
+		start := time.Now()
+		skip, fail := stage.check(ctx)
+		switch {
+		case fail != "":
+			failed++
+			lines = append(lines, fmt.Sprintf("  FAIL  %-11s  %s", stage.name, fail))
+		case skip != "":
+			lines = append(lines, fmt.Sprintf("  SKIP  %-11s  %s", stage.name, skip))
+		default:
+			lines = append(lines, fmt.Sprintf("  PASS  %-11s  %dms", stage.name, time.Since(start).Milliseconds()))
+		}
+	}
+	exitCode := 0
+	if failed > 0 {
+		exitCode = 1
+		lines = append(lines, fmt.Sprintf("%d of %d stages failed", failed, len(stages)))
+	}
+	return commandResult{Lines: lines, ExitCode: exitCode, Duration: time.Since(startTime)}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSelftest_ReportsEachStage(t *testing.T) {
+	s := newServer(config{DataDir: t.TempDir(), MaxMessageChars: 500, Admins: map[string]bool{"UADMIN": true}})
+	ctx := context.Background()
+	in := func(user string) map[string]string {
+		return s.handleCommandExecution(ctx, slashCommand{Text: "$ selftest", UserID: user, ChannelID: "C1"})
+	}
+
+	if got := in("U1")["text"]; !strings.Contains(got, "only admins") {
+		t.Errorf("Expected the self-test closed to other users, got %q", got)
+	}
+
+	got := in("UADMIN")["text"]
+	for _, stage := range []string{"queueing", "execution", "streaming", "fallback", "redaction", "persistence"} {
+		if !strings.Contains(got, "PASS  "+stage) {
+			t.Errorf("Expected %s to pass, got %q", stage, got)
+		}
+	}
+	if !strings.Contains(got, "SKIP  slack        no SLACK_TOKEN") || strings.Contains(got, "FAIL") {
+		t.Errorf("Expected the Slack stage skipped without a token, got %q", got)
+	}
+	if strings.Contains(got, selftestSecret) {
+		t.Errorf("Expected the canary's secret kept out of the report, got %q", got)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// server handles incoming slash command requests.
+type server struct {
+	cfg      config
+	client   *http.Client
+	sessions *sessionManager    // nil unless sessions are enabled
+	verifier *signatureVerifier // nil unless a signing secret is set
+	slack    *slackAPI          // nil unless a Slack token is set
+	policy   policyEngine       // nil allows every command
+	plugins  *wasmPlugins       // nil unless a plugins directory is set
+	hooks    *luaHooks          // nil unless a hooks script is set
+
+	// providerBuiltins are builtins offered by command providers.
+	providerBuiltins []builtin
+
+	mirror        *mirror // nil unless a mirror URL is set
+	jobs          *jobRegistry
+	approvals     *approvalQueue
+	confirmations *approvalQueue // dangerous commands awaiting their user's confirmation
+	// templatePrompts are templates awaiting their parameters from a modal.
+	templatePrompts *approvalQueue
+	events          *eventDedup
+	home            *homeTab
+	auditLog        *auditLog
+	store           *jobStore        // nil unless a data directory is set
+	schedules       *scheduler       // nil unless a data directory is set
+	leader          *leaderElection  // nil unless the store is shared
+	aliases         *aliasStore      // nil unless a data directory is set
+	prefs           *prefStore       // nil unless a data directory is set
+	snippets        *snippetStore    // nil unless a data directory is set
+	vars            *varStore        // nil unless a data directory is set
+	banners         *bannerStore     // nil unless a data directory is set
+	savedTemplates  *templateStore   // nil unless a data directory is set
+	deadLetters     *deadLetterStore // nil unless a data directory is set
+	queue           *inboundQueue    // nil unless the inbound queue is enabled
+	agents          *agentHub        // nil unless agents are accepted
+	quota           *usageQuota
+	exporter        *recordExporter // nil unless an export bucket is set
+	archive         outputArchive   // nil unless an output archive is set
+	accessLog       *accessLogger
+	routeTable      *routeTable
+}
+
+func newServer(cfg config) *server {
+	s := &server{
+		cfg:             cfg,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		accessLog:       newAccessLogger(cfg.AccessLogSampling),
+		jobs:            newJobRegistry(),
+		approvals:       newApprovalQueue(cfg.ApprovalTTL, cfg.Approvers),
+		confirmations:   newApprovalQueue(confirmTTL, nil),
+		templatePrompts: newApprovalQueue(confirmTTL, nil),
+		events:          newEventDedup(eventDedupTTL),
+		home:            newHomeTab(),
+		auditLog:        newAuditLog(cfg.DataDir),
+		quota:           newUsageQuota(cfg.DataDir, cfg.UploadQuotaBytes, cfg.MessageQuota),
+		routeTable:      &routeTable{},
+	}
+	if cfg.DataDir != "" || cfg.DatabaseURL != "" {
+		st, err := openStores(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening store: %v\n", err)
+		} else {
+			s.store, s.aliases, s.schedules, s.prefs = st.jobs, st.aliases, st.schedules, st.prefs
+			if st.schedulerLock != nil {
+				s.leader = newLeaderElection(st.schedulerLock)
+			}
+		}
+	}
+	if cfg.DataDir != "" {
+		snippets, err := newSnippetStore(cfg.DataDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading snippets: %v\n", err)
+		} else {
+			s.snippets = snippets
+		}
+		deadLetters, err := newDeadLetterStore(cfg.DataDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading dead letters: %v\n", err)
+		} else {
+			s.deadLetters = deadLetters
+		}
+		if cfg.Queue {
+			queue, err := newInboundQueue(cfg.DataDir)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error opening inbound queue: %v\n", err)
+			} else {
+				s.queue = queue
+			}
+		}
+		vars, err := newVarStore(cfg.DataDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading variables: %v\n", err)
+		} else {
+			s.vars = vars
+		}
+		savedTemplates, err := newTemplateStore(cfg.DataDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading created templates: %v\n", err)
+		} else {
+			s.savedTemplates = savedTemplates
+		}
+		banners, err := newBannerStore(cfg.DataDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading banners: %v\n", err)
+		} else {
+			s.banners = banners
+		}
+	}
+	if cfg.AuditSyslog != "" {
+		s.auditLog.syslog = newSyslogSink(cfg.AuditSyslog)
+	}
+	if cfg.ExportBucketURL != "" {
+		bucket, err := newS3Client(cfg.ExportBucketURL, cfg.S3Region, cfg.S3AccessKeyID, cfg.S3SecretAccessKey, cfg.S3SessionToken, s.client)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error configuring export: %v\n", err)
+		} else {
+			s.exporter = newRecordExporter(bucket, cfg.ExportPrefix)
+			s.auditLog.export = s.exporter
+		}
+	}
+	if cfg.OutputArchive != "" && s.store != nil {
+		archive, err := newOutputArchive(cfg, s.client)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening output archive: %v\n", err)
+		} else {
+			s.archive = archive
+		}
+	}
+	if cfg.AgentToken != "" || cfg.AgentsListenAddr != "" {
+		// Agents with certificates may only use their own names, which a
+		// token agent could otherwise claim, so then no token is accepted.
+		token := cfg.AgentToken
+		if cfg.AgentsListenAddr != "" {
+			token = ""
+		}
+		s.agents = newAgentHub(token)
+	}
+	if cfg.MirrorURL != "" {
+		s.mirror = newMirror(cfg.MirrorURL, cfg.SigningSecret, s.client)
+	}
+	if cfg.SlackToken != "" {
+		s.slack = &slackAPI{token: cfg.SlackToken, baseURL: cfg.SlackAPIURL, client: s.client, quota: s.quota, pacer: newSlackPacer()}
+		s.jobs.changed = s.homeChanged
+	}
+	if cfg.PluginsDir != "" {
+		plugins, err := newWASMPlugins(cfg.PluginsDir, cfg.PluginTimeout, cfg.PluginMemoryLimitMB)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error starting plugin runtime: %v\n", err)
+		} else {
+			s.plugins = plugins
+		}
+	}
+
+	if cfg.LuaHooksFile != "" {
+		hooks, err := loadLuaHooks(cfg.LuaHooksFile, cfg.PluginTimeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading hooks: %v\n", err)
+		} else {
+			s.hooks = hooks
+		}
+	}
+	if cfg.ProvidersDir != "" {
+		s.providerBuiltins = loadProviders(cfg.ProvidersDir, cfg.PluginTimeout)
+	}
+
+	var policies policyChain
+	if cfg.OPAURL != "" {
+		policies = append(policies, &opaPolicy{url: cfg.OPAURL, client: s.client})
+	}
+	if s.plugins != nil {
+		policies = append(policies, s.plugins)
+	}
+	if len(policies) > 0 {
+		s.policy = policies
+	}
+	if cfg.SigningSecret != "" {
+		s.verifier = newSignatureVerifier(cfg.SigningSecret, cfg.SignatureMaxAge, cfg.SignatureClockSkew)
+	}
+	if cfg.Sessions {
+		s.sessions = newSessionManager(cfg.SessionIdleTimeout, cfg.SessionCommandTimeout)
+		s.sessions.translateANSI = cfg.ANSIMode == ansiTranslate
+		s.sessions.env = cfg.Env
+	}
+
+	// Routes depend on which features are enabled.
+	s.setRoutes(cfg.Paths)
+	return s
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sessionManager keeps one long-lived shell per thread so that commands in
+// the same thread share working directory, variables and history.
+type sessionManager struct {
+	idleTimeout    time.Duration
+	commandTimeout time.Duration
+	translateANSI  bool
+	env            envPolicy // the environment sessions start with
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+func newSessionManager(idleTimeout, commandTimeout time.Duration) *sessionManager {
+	return &sessionManager{
+		idleTimeout:    idleTimeout,
+		commandTimeout: commandTimeout,
+		sessions:       make(map[string]*session),
+	}
+}
+
+// session is a running shell whose stdin receives one command at a time.
+type session struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	lines  chan string
+	marker string
+	idle   *time.Timer
+
+	mu sync.Mutex // serializes commands
+}
+
+// sessionKey identifies the thread a session belongs to.
+func sessionKey(cmd slashCommand) string {
+	return cmd.TeamID + "/" + cmd.ChannelID + "/" + cmd.ThreadTS
+}
+
+// run executes command in the thread's session, starting one if needed.
+// The "exit" builtin closes the session.
+func (m *sessionManager) run(ctx context.Context, key, command string) commandResult {
+	startTime := time.Now()
+
+	if command == "exit" {
+		m.close(key)
+		return commandResult{Lines: []string{"session closed"}, Duration: time.Since(startTime)}
+	}
+
+	sess, err := m.get(key)
+	if err != nil {
+		return commandResult{Lines: []string{err.Error()}, ExitCode: 126, Duration: time.Since(startTime)}
+	}
+
+	lines, exitCode, err := sess.exec(ctx, command, m.commandTimeout)
+	if err != nil {
+		// The shell is unusable after a timeout or exit; start fresh next time.
+		m.close(key)
+		lines = append(lines, err.Error())
+	}
+
+	return commandResult{
+		Lines:    m.cleanOutput(strings.Join(lines, "\n")),
+		ExitCode: exitCode,
+		Duration: time.Since(startTime),
+	}
+}
+
+func (m *sessionManager) cleanOutput(output string) []string {
+	if m.translateANSI {
+		output = translateANSI(output)
+	}
+	return cleanOutput(output)
+}
+
+func (m *sessionManager) get(key string) (*session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if sess, ok := m.sessions[key]; ok {
+		sess.idle.Reset(m.idleTimeout)
+		return sess, nil
+	}
+
+	sess, err := startSession(m.env.environ())
+	if err != nil {
+		return nil, fmt.Errorf("starting session: %w", err)
+	}
+	sess.idle = time.AfterFunc(m.idleTimeout, func() { m.close(key) })
+	m.sessions[key] = sess
+	return sess, nil
+}
+
+func (m *sessionManager) close(key string) {
+	m.mu.Lock()
+	sess, ok := m.sessions[key]
+	delete(m.sessions, key)
+	m.mu.Unlock()
+
+	if ok {
+		sess.idle.Stop()
+		sess.stdin.Close()
+		sess.cmd.Process.Kill()
+		sess.cmd.Wait()
+	}
+}
+
+func startSession(environ []string) (*session, error) {
+	cmd := exec.Command("sh")
+	cmd.Env = environ
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	// Merge stdout and stderr into a single stream
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+
+	if err := cmd.Start(); err != nil {
+		pr.Close()
+		pw.Close()
+		return nil, err
+	}
+	pw.Close()
+
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+
+	sess := &session{
+		cmd:    cmd,
+		stdin:  stdin,
+		lines:  make(chan string, 256),
+		marker: "__http_shell_done_" + hex.EncodeToString(nonce),
+	}
+
+	go func() {
+		defer pr.Close()
+		defer close(sess.lines)
+		scanner := bufio.NewScanner(pr)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			sess.lines <- scanner.Text()
+		}
+	}()
+
+	return sess, nil
+}
+
+// exec writes command to the shell followed by a marker line carrying the
+// exit status, and collects output until the marker is seen.
+func (s *session) exec(ctx context.Context, command string, timeout time.Duration) ([]string, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	input := fmt.Sprintf("%s\nprintf '\\n%%s %%d\\n' '%s' \"$?\"\n", command, s.marker)
+	if _, err := io.WriteString(s.stdin, input); err != nil {
+		return nil, 1, fmt.Errorf("session closed: %w", err)
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	var lines []string
+	for {
+		select {
+		case line, ok := <-s.lines:
+			if !ok {
+				return lines, 1, fmt.Errorf("session ended")
+			}
+			if rest, found := strings.CutPrefix(line, s.marker+" "); found {
+				exitCode, _ := strconv.Atoi(rest)
+				return lines, exitCode, nil
+			}
+			lines = append(lines, line)
+		case <-deadline.C:
+			return lines, 143, fmt.Errorf("session command timed out after %s", timeout)
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return lines, 124, fmt.Errorf("session command timed out")
+			}
+			return lines, 130, fmt.Errorf("session command canceled")
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionManager_SharesStateAcrossCommands(t *testing.T) {
+	m := newSessionManager(time.Minute, 5*time.Second)
+	defer m.close("t1")
+
+	if result := m.run(context.Background(), "t1", "cd /tmp && GREETING=hello"); result.ExitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d (%q)", result.ExitCode, result.Lines)
+	}
+
+	result := m.run(context.Background(), "t1", "pwd; echo $GREETING")
+	if got := strings.Join(result.Lines, "\n"); got != "/tmp\nhello" {
+		t.Errorf("Expected session state to persist, got %q", got)
+	}
+}
+
+func TestSessionManager_ExitCode(t *testing.T) {
+	m := newSessionManager(time.Minute, 5*time.Second)
+	defer m.close("t1")
+
+	result := m.run(context.Background(), "t1", "false")
+	if result.ExitCode != 1 {
+		t.Errorf("Expected exit code 1, got %d", result.ExitCode)
+	}
+}
+
+func TestSessionManager_ExitBuiltin(t *testing.T) {
+	m := newSessionManager(time.Minute, 5*time.Second)
+
+	m.run(context.Background(), "t1", "X=1")
+	m.run(context.Background(), "t1", "exit")
+
+	if _, ok := m.sessions["t1"]; ok {
+		t.Fatal("Expected exit to close the session")
+	}
+
+	result := m.run(context.Background(), "t1", "echo ${X:-unset}")
+	defer m.close("t1")
+	if got := strings.Join(result.Lines, "\n"); got != "unset" {
+		t.Errorf("Expected a fresh session after exit, got %q", got)
+	}
+}
+
+func TestSessionManager_IdleExpiry(t *testing.T) {
+	m := newSessionManager(50*time.Millisecond, 5*time.Second)
+
+	m.run(context.Background(), "t1", "true")
+	time.Sleep(200 * time.Millisecond)
+
+	m.mu.Lock()
+	_, ok := m.sessions["t1"]
+	m.mu.Unlock()
+	if ok {
+		t.Error("Expected idle session to expire")
+	}
+}
+
+func TestSessionManager_CommandTimeout(t *testing.T) {
+	m := newSessionManager(time.Minute, 100*time.Millisecond)
+
+	result := m.run(context.Background(), "t1", "sleep 5")
+	if result.ExitCode != 143 {
+		t.Errorf("Expected exit code 143, got %d", result.ExitCode)
+	}
+	if _, ok := m.sessions["t1"]; ok {
+		t.Error("Expected timed out session to be closed")
+	}
+}
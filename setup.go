@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const setupUsage = "usage: setup [remove]"
+
+// channelBanner is the message $ setup pinned in a channel, and a hash of
+// its text, to tell when the channel's profile has changed.
+type channelBanner struct {
+	TS      string    `json:"ts"`
+	Hash    string    `json:"hash"`
+	UserID  string    `json:"user_id,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+// bannerStore keeps each channel's pinned banner in a JSON file in the data
+// directory. The file is rewritten on every change.
+type bannerStore struct {
+	path string
+
+	mu       sync.Mutex
+	channels map[string]channelBanner
+}
+
+func newBannerStore(dir string) (*bannerStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	st := &bannerStore{path: filepath.Join(dir, "banners.json"), channels: map[string]channelBanner{}}
+	data, err := os.ReadFile(st.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &st.channels); err != nil {
+		return nil, fmt.Errorf("%s: %w", st.path, err)
+	}
+	return st, nil
+}
+
+// get returns a channel's banner, or false if it has none.
+func (st *bannerStore) get(channelID string) (channelBanner, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	b, ok := st.channels[channelID]
+	return b, ok
+}
+
+// set replaces a channel's banner, or forgets it if b is the zero value.
+func (st *bannerStore) set(channelID string, b channelBanner) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	previous, existed := st.channels[channelID]
+	if b == (channelBanner{}) {
+		delete(st.channels, channelID)
+	} else {
+		st.channels[channelID] = b
+	}
+	if err := writeJSONFile(st.path, st.channels); err != nil {
+		if existed {
+			st.channels[channelID] = previous
+		} else {
+			delete(st.channels, channelID)
+		}
+		return err
+	}
+	return nil
+}
+
+// list returns the channels with a banner.
+func (st *bannerStore) list() []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	channels := make([]string, 0, len(st.channels))
+	for ch := range st.channels {
+		channels = append(channels, ch)
+	}
+	slices.Sort(channels)
+	return channels
+}
+
+// profileBanner describes what the profile of a channel allows, from the
+// configuration the server runs with: where commands run, which other
+// hosts may be targeted and by whom, the checks commands go through, and
+// their timeout.
+func (s *server) profileBanner(channelID string) string {
+	p := s.cfg.profileFor(channelID)
+	users := func(ids []string) string {
+		if slices.Contains(ids, "*") {
+			return "anyone"
+		}
+		mentions := make([]string, len(ids))
+		for i, id := range ids {
+			mentions[i] = "<@" + id + ">"
+		}
+		return strings.Join(mentions, ", ")
+	}
+
+	var lines []string
+	lines = append(lines, ":pushpin: *http-shell in this channel*")
+
+	egress := "output may be shared"
+	switch p.Classification {
+	case classInternal:
+		egress = "secrets are redacted"
+	case classSecret:
+		egress = "secrets are redacted and output is shown only to the invoker"
+	}
+	if s.cfg.SensitiveChannels[channelID] {
+		egress += "; this is a sensitive channel, so output is shown only to the invoker"
+	}
+	lines = append(lines, fmt.Sprintf("*Profile:* `%s`, %s: %s", p.Name, p.Classification, egress))
+
+	runsOn := "the server"
+	if p.Agent != "" {
+		runsOn = fmt.Sprintf("`%s`", p.Agent)
+		if agent := s.cfg.Inventory.agentOf(p.Agent); agent != p.Agent {
+			runsOn += fmt.Sprintf(" (agent `%s`)", agent)
+		}
+	}
+	switch {
+	case p.Container != "":
+		runsOn = fmt.Sprintf("container `%s`", p.Container)
+	case p.Image != "":
+		runsOn = fmt.Sprintf("a new container of image `%s` for each command", p.Image)
+	case p.Agent == "" && s.cfg.SandboxImage != "":
+		network := "no network"
+		if s.cfg.SandboxNetwork != "" {
+			network = fmt.Sprintf("network `%s`", s.cfg.SandboxNetwork)
+		}
+		runsOn = fmt.Sprintf("a new sandbox container of image `%s` for each command, with %s and a read-only root", s.cfg.SandboxImage, network)
+	}
+	if p.Sandbox != nil && runsOn == "the server" {
+		if p.Sandbox.Root != "" {
+			runsOn += ", confined to " + p.Sandbox.Root
+		}
+		runsOn += ", sandboxed: commands can only read " + strings.Join(p.Sandbox.readPaths(), ", ") + " and write " + strings.Join(p.Sandbox.writePaths(), ", ")
+	}
+	if len(p.Containers) > 0 {
+		runsOn += fmt.Sprintf("; `--container=` may name %s", strings.Join(p.Containers, ", "))
+	}
+	lines = append(lines, "*Runs on:* "+runsOn)
+
+	if len(p.Hosts) > 0 {
+		var hosts []string
+		for pattern, ids := range p.Hosts {
+			hosts = append(hosts, fmt.Sprintf("`%s` for %s", pattern, users(ids)))
+		}
+		slices.Sort(hosts)
+		lines = append(lines, "*Other hosts:* "+strings.Join(hosts, "; "))
+	}
+
+	checks := []string{"anyone here can run commands"}
+	if len(s.cfg.ClassifierRules) > 0 {
+		if s.cfg.DangerousAction == dangerousBlock {
+			checks = append(checks, "dangerous commands are refused")
+		} else {
+			checks = append(checks, "dangerous commands must be confirmed")
+		}
+	}
+	if s.cfg.SuspiciousAction == suspiciousBlock {
+		checks = append(checks, "suspicious commands are refused")
+	} else {
+		checks = append(checks, "suspicious commands raise an alert")
+	}
+	if n := len(s.cfg.ApprovalPatterns); n > 0 {
+		checks = append(checks, fmt.Sprintf("commands matching %d approval patterns need approval from %s", n, users(s.cfg.Approvers)))
+	}
+	if s.cfg.OPAURL != "" {
+		checks = append(checks, "every command is checked by the policy server")
+	}
+	if len(p.OutputTo) > 0 {
+		checks = append(checks, fmt.Sprintf("output may be posted to %s with --to", strings.Join(p.OutputTo, ", ")))
+	}
+	who := strings.Join(checks, "; ") + "."
+	if admins := sortedKeys(s.cfg.Admins); len(admins) > 0 {
+		who += fmt.Sprintf(" Admins (%s) can also use audit, selftest and setup.", users(admins))
+	}
+	lines = append(lines, "*Who can run what:* "+who)
+
+	timeout := "none"
+	if limit := s.cfg.CommandTimeout; limit > 0 || p.maxDuration > 0 {
+		if p.maxDuration > 0 {
+			limit = p.maxDuration
+		}
+		timeout = "commands are killed after " + limit.String()
+	}
+	if p.softTimeout > 0 {
+		timeout += fmt.Sprintf(", reported as still running after %s", p.softTimeout)
+	}
+	lines = append(lines, "*Timeout:* "+timeout)
+	if p.Agent == "" && p.Container == "" {
+		var limits []string
+		if s.cfg.Limits != nil {
+			limits = append(limits, s.cfg.Limits.String())
+		}
+		if s.cfg.Rlimits != nil {
+			limits = append(limits, s.cfg.Rlimits.String())
+		}
+		if len(limits) > 0 {
+			lines = append(lines, fmt.Sprintf("*Limits:* %s per command", strings.Join(limits, "; ")))
+		}
+	}
+
+	lines = append(lines, "_Pinned by `$ setup` and pinned again when the profile changes._")
+	return strings.Join(lines, "\n")
+}
+
+// bannerHash is the hash of a banner's text that tells whether it changed.
+func bannerHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:8])
+}
+
+// pinBanner posts a channel's banner and pins it in place of the previous
+// one, which is unpinned.
+func (s *server) pinBanner(ctx context.Context, channelID, userID string) error {
+	text := s.profileBanner(channelID)
+	var resp struct {
+		TS string `json:"ts"`
+	}
+	if err := s.slack.call(ctx, "chat.postMessage", url.Values{"channel": {channelID}, "text": {text}}, &resp); err != nil {
+		return fmt.Errorf("posting the banner: %w", err)
+	}
+	if err := s.slack.call(ctx, "pins.add", url.Values{"channel": {channelID}, "timestamp": {resp.TS}}, nil); err != nil {
+		return fmt.Errorf("pinning the banner: %w", err)
+	}
+	previous, ok := s.banners.get(channelID)
+	if ok {
+		s.unpinBanner(ctx, channelID, previous)
+	}
+	return s.banners.set(channelID, channelBanner{TS: resp.TS, Hash: bannerHash(text), UserID: userID, Updated: time.Now()})
+}
+
+// unpinBanner unpins a banner. A banner unpinned by hand is already gone,
+// so failures are only logged.
+func (s *server) unpinBanner(ctx context.Context, channelID string, b channelBanner) {
+	if err := s.slack.call(ctx, "pins.remove", url.Values{"channel": {channelID}, "timestamp": {b.TS}}, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error unpinning the banner in %s: %v\n", channelID, err)
+	}
+}
+
+// refreshBanners pins the banner again in channels whose profile has
+// changed since it was pinned, as happens when the server restarts with a
+// new configuration.
+func (s *server) refreshBanners(ctx context.Context) {
+	for _, channelID := range s.banners.list() {
+		b, ok := s.banners.get(channelID)
+		if !ok || b.Hash == bannerHash(s.profileBanner(channelID)) {
+			continue
+		}
+		if err := s.pinBanner(ctx, channelID, b.UserID); err != nil {
+			fmt.Fprintf(os.Stderr, "Error updating the banner in %s: %v\n", channelID, err)
+		}
+	}
+}
+
+// runSetup is the setup builtin, for admins. It pins a banner describing
+// the channel's profile, or with "remove" unpins it.
+func runSetup(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	fail := func(code int, msg string) commandResult {
+		return commandResult{Lines: []string{msg}, ExitCode: code, Duration: time.Since(startTime)}
+	}
+	if !s.cfg.Admins[cmd.UserID] {
+		return fail(1, "setup: only admins can pin the channel's banner")
+	}
+	if s.banners == nil || s.slack == nil {
+		return fail(1, "setup needs DATA_DIR and SLACK_TOKEN")
+	}
+	if cmd.ChannelID == "" {
+		return fail(1, "setup: no channel to pin the banner in")
+	}
+	switch {
+	case len(args) == 0:
+		if err := s.pinBanner(ctx, cmd.ChannelID, cmd.UserID); err != nil {
+			return fail(1, "setup: "+err.Error())
+		}
+		return commandResult{Lines: []string{"Pinned the channel's banner. It is pinned again when the profile changes."}, Duration: time.Since(startTime)}
+	case len(args) == 1 && args[0] == "remove":
+		b, ok := s.banners.get(cmd.ChannelID)
+		if !ok {
+			return fail(1, "setup: no banner is pinned in this channel")
+		}
+		s.unpinBanner(ctx, cmd.ChannelID, b)
+		if err := s.banners.set(cmd.ChannelID, channelBanner{}); err != nil {
+			return fail(1, "setup: "+err.Error())
+		}
+		return commandResult{Lines: []string{"Unpinned the channel's banner."}, Duration: time.Since(startTime)}
+	}
+	return fail(2, setupUsage)
+}
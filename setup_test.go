@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfileBanner(t *testing.T) {
+	s := newServer(config{
+		Admins:         map[string]bool{"UADMIN": true},
+		CommandTimeout: time.Hour,
+		OPAURL:         "http://opa.invalid",
+		Profiles: []profile{{
+			Name: "web", Channels: []string{"C1"}, Classification: classInternal,
+			Agent: "web01", Hosts: map[string][]string{"db*": {"U1", "U2"}, "web*": {"*"}},
+			maxDuration: 10 * time.Minute, softTimeout: 2 * time.Minute,
+		}},
+	})
+	want := strings.Join([]string{
+		":pushpin: *http-shell in this channel*",
+		"*Profile:* `web`, internal: secrets are redacted",
+		"*Runs on:* `web01`",
+		"*Other hosts:* `db*` for <@U1>, <@U2>; `web*` for anyone",
+		"*Who can run what:* anyone here can run commands; suspicious commands raise an alert; every command is checked by the policy server. Admins (<@UADMIN>) can also use audit, selftest and setup.",
+		"*Timeout:* commands are killed after 10m0s, reported as still running after 2m0s",
+		"_Pinned by `$ setup` and pinned again when the profile changes._",
+	}, "\n")
+	if got := s.profileBanner("C1"); got != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, got)
+	}
+	if got := s.profileBanner("C2"); !strings.Contains(got, "*Runs on:* the server") || !strings.Contains(got, "*Timeout:* commands are killed after 1h0m0s\n") {
+		t.Errorf("Expected the default profile described, got:\n%s", got)
+	}
+
+	s.cfg.Profiles = append(s.cfg.Profiles, profile{Name: "sandboxed", Channels: []string{"C3"}, Sandbox: &localSandbox{Write: []string{"/tmp"}}})
+	if got := s.profileBanner("C3"); !strings.Contains(got, "*Runs on:* the server, sandboxed: commands can only read /bin, /sbin, /usr, /lib, /lib32, /lib64, /etc and write /tmp\n") {
+		t.Errorf("Expected the local sandbox described, got:\n%s", got)
+	}
+	s.cfg.Profiles[len(s.cfg.Profiles)-1].Sandbox.Root = "/srv/jail"
+	if got := s.profileBanner("C3"); !strings.Contains(got, "*Runs on:* the server, confined to /srv/jail, sandboxed: ") {
+		t.Errorf("Expected the sandbox's root described, got:\n%s", got)
+	}
+
+	s.cfg.SandboxImage = "alpine:3.20"
+	if got := s.profileBanner("C2"); !strings.Contains(got, "*Runs on:* a new sandbox container of image `alpine:3.20` for each command, with no network and a read-only root\n") {
+		t.Errorf("Expected the sandbox described, got:\n%s", got)
+	}
+	if got := s.profileBanner("C1"); !strings.Contains(got, "*Runs on:* `web01`\n") {
+		t.Errorf("Expected the agent's channel not sandboxed, got:\n%s", got)
+	}
+}
+
+func TestSetup_PinsAndRepins(t *testing.T) {
+	f := newFakeSlack(t)
+	f.respond("chat.postMessage", map[string]interface{}{"ts": "1700000000.000100"})
+	cfg := f.config()
+	cfg.DataDir = t.TempDir()
+	cfg.Admins = map[string]bool{"UADMIN": true}
+	s := newServer(cfg)
+	cmd := slashCommand{UserID: "UADMIN", ChannelID: "C1"}
+
+	if result := runSetup(context.Background(), s, slashCommand{UserID: "U1", ChannelID: "C1"}, nil); result.ExitCode != 1 {
+		t.Errorf("Expected non-admins refused, got %+v", result)
+	}
+	if result := runSetup(context.Background(), s, cmd, nil); result.ExitCode != 0 {
+		t.Fatalf("Expected the banner pinned, got %+v", result)
+	}
+	if pins := f.callsTo("pins.add"); len(pins) != 1 || pins[0].Params.Get("timestamp") != "1700000000.000100" {
+		t.Fatalf("Expected the banner pinned, got %+v", pins)
+	}
+
+	// An unchanged profile leaves the banner alone after a restart.
+	s = newServer(cfg)
+	s.refreshBanners(context.Background())
+	if len(f.callsTo("pins.add")) != 1 {
+		t.Error("Expected an unchanged banner left pinned")
+	}
+
+	// A changed one replaces it.
+	cfg.CommandTimeout = time.Minute
+	f.respond("chat.postMessage", map[string]interface{}{"ts": "1700000001.000200"})
+	s = newServer(cfg)
+	s.refreshBanners(context.Background())
+	posts := f.callsTo("chat.postMessage")
+	if len(posts) != 2 || !strings.Contains(posts[1].Params.Get("text"), "killed after 1m0s") {
+		t.Fatalf("Expected the changed banner posted, got %+v", posts)
+	}
+	if unpins := f.callsTo("pins.remove"); len(unpins) != 1 || unpins[0].Params.Get("timestamp") != "1700000000.000100" {
+		t.Errorf("Expected the old banner unpinned, got %+v", unpins)
+	}
+	if b, _ := s.banners.get("C1"); b.TS != "1700000001.000200" || b.UserID != "UADMIN" {
+		t.Errorf("Expected the new banner stored, got %+v", b)
+	}
+
+	if result := runSetup(context.Background(), s, cmd, []string{"remove"}); result.ExitCode != 0 {
+		t.Errorf("Expected the banner removed, got %+v", result)
+	}
+	if _, ok := s.banners.get("C1"); ok || len(f.callsTo("pins.remove")) != 2 {
+		t.Error("Expected the banner unpinned and forgotten")
+	}
+}
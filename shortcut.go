@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// callbackRunMessage is the callback ID of the "Run this as a command"
+// message shortcut, set when creating the shortcut in the Slack app.
+const callbackRunMessage = "run_as_command"
+
+var (
+	codeBlock  = regexp.MustCompile("(?s)```(.*?)```")
+	inlineCode = regexp.MustCompile("`([^`\n]+)`")
+)
+
+// slackUnescape undoes the escaping Slack applies to message text.
+var slackUnescape = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&")
+
+// runMessage handles the "Run this as a command" shortcut: the first code
+// block of the message is run, once the user confirms it in a modal, and
+// the result is posted in the message's thread.
+func (s *server) runMessage(ctx context.Context, p interactionPayload) {
+	thread := p.Message.ThreadTS
+	if thread == "" {
+		thread = p.Message.TS
+	}
+	cmd := slashCommand{
+		UserID:      p.User.ID,
+		ChannelID:   p.Channel.ID,
+		TeamID:      p.Team.ID,
+		ResponseURL: p.ResponseURL,
+		ThreadTS:    thread,
+		TriggerID:   p.TriggerID,
+		FromMessage: true,
+		MessageTS:   p.Message.TS,
+	}
+
+	var reply map[string]string
+	if code, ok := extractCode(p.Message.Text); !ok {
+		reply = ephemeral("_no code block in this message_")
+	} else {
+		cmd.Text = code
+		reply = s.requestConfirmation(ctx, cmd, code, "run from a message")
+	}
+	if p.ResponseURL == "" {
+		return
+	}
+	if err := postWebhook(ctx, s.client, p.ResponseURL, reply); err != nil {
+		fmt.Fprintf(os.Stderr, "Error responding to shortcut: %v\n", err)
+	}
+}
+
+// extractCode returns the contents of the first code block in a message,
+// or of its first inline code if it has no block.
+func extractCode(text string) (string, bool) {
+	m := codeBlock.FindStringSubmatch(text)
+	if m == nil {
+		m = inlineCode.FindStringSubmatch(text)
+	}
+	if m == nil {
+		return "", false
+	}
+	code := strings.TrimSpace(slackUnescape.Replace(m[1]))
+	return code, code != ""
+}
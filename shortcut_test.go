@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestExtractCode(t *testing.T) {
+	tests := []struct {
+		text string
+		code string
+		ok   bool
+	}{
+		{"try this:\n```df -h /var```\nthen tell me", "df -h /var", true},
+		{"```\nls | wc -l &gt; count\n```", "ls | wc -l > count", true},
+		{"run `uptime` and `w`", "uptime", true},
+		{"```first``` and ```second```", "first", true},
+		{"no code here", "", false},
+		{"``` ```", "", false},
+	}
+	for _, tt := range tests {
+		if code, ok := extractCode(tt.text); code != tt.code || ok != tt.ok {
+			t.Errorf("extractCode(%q) = %q %v, want %q %v", tt.text, code, ok, tt.code, tt.ok)
+		}
+	}
+}
+
+func TestRunMessage_ConfirmsAndRunsInThread(t *testing.T) {
+	f := newFakeSlack(t)
+	cfg := f.config()
+	cfg.Interactivity = true
+	s := newServer(cfg)
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"type":        "message_action",
+		"callback_id": callbackRunMessage,
+		"trigger_id":  "T123",
+		"user":        map[string]string{"id": "U1"},
+		"channel":     map[string]string{"id": "C1"},
+		"message":     map[string]string{"text": "can someone run ```echo from message```", "ts": "1700000000.000100"},
+	})
+	req := httptest.NewRequest("POST", "/slack/interactive", strings.NewReader(url.Values{"payload": {string(payload)}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.routes().ServeHTTP(httptest.NewRecorder(), req)
+
+	calls := f.callsTo("views.open")
+	if len(calls) != 1 {
+		t.Fatalf("Expected a confirmation modal, got %d views.open calls", len(calls))
+	}
+	var view struct {
+		PrivateMetadata string `json:"private_metadata"`
+	}
+	json.Unmarshal([]byte(calls[0].Params.Get("view")), &view)
+
+	submitView(t, s, "U1", callbackConfirm, view.PrivateMetadata)
+
+	posts := waitForCalls(t, f, "chat.postMessage", 1)
+	if len(posts) != 1 {
+		t.Fatalf("Expected the result to be posted, got %d posts", len(posts))
+	}
+	if p := posts[0].Params; p.Get("thread_ts") != "1700000000.000100" || !strings.Contains(p.Get("text"), "from message") {
+		t.Errorf("Expected output in the message's thread, got %v", p)
+	}
+}
+
+func FuzzExtractCode(f *testing.F) {
+	for _, seed := range []string{
+		"try this:\n```df -h /var```\nthen tell me",
+		"```\nls | wc -l &gt; count\n```",
+		"run `uptime` and `w`",
+		"``` ```",
+		"````",
+		"&amp;lt;`&amp;`",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		code, ok := extractCode(text)
+		if ok != (code != "") || code != strings.TrimSpace(code) {
+			t.Fatalf("extractCode(%q) = %q %v", text, code, ok)
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// signatureRejections counts rejected requests by reason so operators can
+// tell replay attempts apart from clock drift.
+var signatureRejections = expvar.NewMap("signature_rejections")
+
+// Reasons a signed request is rejected.
+var (
+	errSignatureInvalid = errors.New("invalid signature")
+	errSignatureStale   = errors.New("stale timestamp")
+	errSignatureFuture  = errors.New("timestamp in the future")
+	errSignatureReplay  = errors.New("replayed request")
+)
+
+// signatureVerifier checks Slack request signatures and rejects requests
+// outside the timestamp window or seen before.
+type signatureVerifier struct {
+	secret []byte
+	maxAge time.Duration // oldest accepted request
+	skew   time.Duration // tolerated clock difference in either direction
+	now    func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]map[string]time.Time // team ID -> signature -> timestamp
+}
+
+func newSignatureVerifier(secret string, maxAge, skew time.Duration) *signatureVerifier {
+	return &signatureVerifier{
+		secret: []byte(secret),
+		maxAge: maxAge,
+		skew:   skew,
+		now:    time.Now,
+		seen:   make(map[string]map[string]time.Time),
+	}
+}
+
+// verify checks the signature headers of r against its raw body.
+func (v *signatureVerifier) verify(r *http.Request, body []byte) error {
+	err := v.check(r, body)
+	if err != nil {
+		signatureRejections.Add(rejectionReason(err), 1)
+	}
+	return err
+}
+
+func (v *signatureVerifier) check(r *http.Request, body []byte) error {
+	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+	signature := r.Header.Get("X-Slack-Signature")
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || signature == "" {
+		return errSignatureInvalid
+	}
+
+	sent := time.Unix(seconds, 0)
+	age := v.now().Sub(sent)
+	if age > v.maxAge+v.skew {
+		return fmt.Errorf("%w: %s old", errSignatureStale, age.Round(time.Second))
+	}
+	if age < -v.skew {
+		return fmt.Errorf("%w: %s ahead", errSignatureFuture, (-age).Round(time.Second))
+	}
+
+	mac := hmac.New(sha256.New, v.secret)
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errSignatureInvalid
+	}
+
+	values, _ := url.ParseQuery(string(body))
+	return v.remember(values.Get("team_id"), signature, sent)
+}
+
+// remember records a signature for the team, failing if it was already
+// used. Signatures older than the window are forgotten since they would be
+// rejected as stale anyway.
+func (v *signatureVerifier) remember(team, signature string, sent time.Time) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	cutoff := v.now().Add(-(v.maxAge + v.skew))
+	seen := v.seen[team]
+	if seen == nil {
+		seen = make(map[string]time.Time)
+		v.seen[team] = seen
+	}
+	for sig, ts := range seen {
+		if ts.Before(cutoff) {
+			delete(seen, sig)
+		}
+	}
+
+	if _, ok := seen[signature]; ok {
+		return errSignatureReplay
+	}
+	seen[signature] = sent
+	return nil
+}
+
+func rejectionReason(err error) string {
+	switch {
+	case errors.Is(err, errSignatureStale):
+		return "stale"
+	case errors.Is(err, errSignatureFuture):
+		return "future"
+	case errors.Is(err, errSignatureReplay):
+		return "replay"
+	default:
+		return "invalid"
+	}
+}
+
+// logRejection records why a request was refused.
+func logRejection(r *http.Request, err error) {
+	fmt.Fprintf(os.Stderr, "Rejected request from %s: %v\n", r.RemoteAddr, err)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signedRequest builds a request signed with secret at the given time.
+func signedRequest(secret string, sent time.Time, body string) *http.Request {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	signRequest(req, secret, sent, body)
+	return req
+}
+
+// signRequest sets the signature headers of a request with the given body.
+func signRequest(req *http.Request, secret string, sent time.Time, body string) {
+	timestamp := strconv.FormatInt(sent.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := "team_id=T1&text=date"
+
+	tests := []struct {
+		name     string
+		sent     time.Time
+		secret   string
+		expected error
+	}{
+		{"valid", now, "secret", nil},
+		{"within skew in the future", now.Add(20 * time.Second), "secret", nil},
+		{"within window plus skew", now.Add(-5*time.Minute - 20*time.Second), "secret", nil},
+		{"stale", now.Add(-6 * time.Minute), "secret", errSignatureStale},
+		{"future", now.Add(time.Minute), "secret", errSignatureFuture},
+		{"wrong secret", now, "other", errSignatureInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newSignatureVerifier("secret", 5*time.Minute, 30*time.Second)
+			v.now = func() time.Time { return now }
+
+			err := v.verify(signedRequest(tt.secret, tt.sent, body), []byte(body))
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestSignatureVerifier_Replay(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	v := newSignatureVerifier("secret", 5*time.Minute, 30*time.Second)
+	v.now = func() time.Time { return now }
+
+	body := "team_id=T1&text=date"
+	if err := v.verify(signedRequest("secret", now, body), []byte(body)); err != nil {
+		t.Fatalf("Expected first request to pass, got %v", err)
+	}
+	if err := v.verify(signedRequest("secret", now, body), []byte(body)); !errors.Is(err, errSignatureReplay) {
+		t.Errorf("Expected replay to be rejected, got %v", err)
+	}
+}
+
+func TestHandleCommand_RejectsUnsignedRequest(t *testing.T) {
+	s := newServer(config{SigningSecret: "secret", SignatureMaxAge: 5 * time.Minute})
+
+	data := url.Values{}
+	data.Set("text", "$ echo hello")
+	req := httptest.NewRequest("POST", "/", strings.NewReader(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	s.handleCommand(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestHandleCommand_AcceptsSignedRequest(t *testing.T) {
+	s := newServer(config{SigningSecret: "secret", SignatureMaxAge: 5 * time.Minute})
+
+	data := url.Values{}
+	data.Set("text", "$ echo hello")
+	w := httptest.NewRecorder()
+
+	s.handleCommand(w, signedRequest("secret", time.Now(), data.Encode()))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "hello") {
+		t.Errorf("Expected command output, got %q", w.Body.String())
+	}
+}
+
+func TestLoadConfig_SigningSecretRequired(t *testing.T) {
+	t.Setenv("INTERACTIVITY_ENABLED", "true")
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "INTERACTIVITY_ENABLED requires SLACK_SIGNING_SECRET") {
+		t.Errorf("Expected unsigned interactivity refused, got %v", err)
+	}
+	t.Setenv("INTERACTIVITY_ENABLED", "")
+	t.Setenv("SLACK_TOKEN", "xoxb-test")
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "SLACK_TOKEN requires SLACK_SIGNING_SECRET") {
+		t.Errorf("Expected an unsigned events endpoint refused, got %v", err)
+	}
+	t.Setenv("SLACK_SIGNING_SECRET", "secret")
+	t.Setenv("INTERACTIVITY_ENABLED", "true")
+	if _, err := loadConfig(); err != nil {
+		t.Errorf("Expected signed interactivity and events accepted, got %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// slackAPIStats counts Slack calls per method: calls, errors, rate_limited
+// (HTTP 429) and latency_ms, the total time spent. Posts to response_url
+// and incoming webhooks are counted as "webhook", file content uploads as
+// "files.upload".
+var slackAPIStats = expvar.NewMap("slack_api")
+
+// slackAPIStatsMu serializes adding methods to slackAPIStats.
+var slackAPIStatsMu sync.Mutex
+
+// recordSlackCall counts a Slack call that started at start and ended
+// with an HTTP status, or 0 if no response was received, and an error.
+func recordSlackCall(method string, start time.Time, status int, err error) {
+	slackAPIStatsMu.Lock()
+	stats, _ := slackAPIStats.Get(method).(*expvar.Map)
+	if stats == nil {
+		stats = new(expvar.Map).Init()
+		slackAPIStats.Set(method, stats)
+	}
+	slackAPIStatsMu.Unlock()
+
+	stats.Add("calls", 1)
+	stats.Add("latency_ms", time.Since(start).Milliseconds())
+	if err != nil {
+		stats.Add("errors", 1)
+		errorCounts.Add(string(errorCodeOf(err, codeSlackError)), 1)
+	}
+	if status == http.StatusTooManyRequests {
+		stats.Add("rate_limited", 1)
+	}
+}
+
+// postWebhook sends a message to a slash command's response_url or to an
+// incoming webhook. The message is encoded as JSON.
+func postWebhook(ctx context.Context, client *http.Client, url string, message interface{}) (err error) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	start, status := time.Now(), 0
+	defer func() { recordSlackCall("webhook", start, status, err) }()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	status = resp.StatusCode
+
+	if resp.StatusCode != http.StatusOK {
+		return slackStatusError(fmt.Errorf("webhook returned status %d", resp.StatusCode), resp.StatusCode)
+	}
+	return nil
+}
+
+// slackStatusError codes an error for an HTTP status other than 200.
+func slackStatusError(err error, status int) error {
+	if status == http.StatusTooManyRequests {
+		return withCode(codeSlackRateLimited, err)
+	}
+	return withCode(codeSlackError, err)
+}
+
+// slackAPI is a minimal client for the Slack Web API.
+type slackAPI struct {
+	token   string
+	baseURL string // e.g. "https://slack.com/api/"
+	client  *http.Client
+	quota   *usageQuota // counts messages posted and files uploaded, if set
+	pacer   *slackPacer // learns the workspace's rate limits, if set
+}
+
+// call invokes a Web API method with form parameters and decodes the
+// response into out, which may be nil. Responses with "ok": false are
+// returned as errors.
+func (api *slackAPI) call(ctx context.Context, method string, params url.Values, out interface{}) (err error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", api.baseURL+method, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+api.token)
+
+	start, httpStatus, retryAfter := time.Now(), 0, ""
+	defer func() {
+		recordSlackCall(method, start, httpStatus, err)
+		api.pacer.observe(method, err, retryAfter)
+	}()
+
+	resp, err := api.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	httpStatus, retryAfter = resp.StatusCode, resp.Header.Get("Retry-After")
+
+	if resp.StatusCode != http.StatusOK {
+		return slackStatusError(fmt.Errorf("%s: status %d", method, resp.StatusCode), resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	if !status.OK {
+		code := codeSlackError
+		if status.Error == "ratelimited" {
+			code = codeSlackRateLimited
+		}
+		return withCode(code, fmt.Errorf("%s: %s", method, status.Error))
+	}
+	if method == "chat.postMessage" {
+		api.quota.countMessages(1)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSlack is a stand-in for the Slack Web API that records calls and
+// answers them with canned responses.
+type fakeSlack struct {
+	*httptest.Server
+	mux *http.ServeMux // extra routes, e.g. file downloads
+
+	mu        sync.Mutex
+	calls     []fakeSlackCall
+	responses map[string]map[string]interface{} // method -> response fields
+}
+
+type fakeSlackCall struct {
+	Method string
+	Params url.Values
+}
+
+func newFakeSlack(t *testing.T) *fakeSlack {
+	t.Helper()
+
+	f := &fakeSlack{mux: http.NewServeMux(), responses: make(map[string]map[string]interface{})}
+	f.mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer xoxb-test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		r.ParseForm()
+		method := strings.TrimPrefix(r.URL.Path, "/api/")
+
+		f.mu.Lock()
+		f.calls = append(f.calls, fakeSlackCall{Method: method, Params: r.PostForm})
+		response := map[string]interface{}{"ok": true}
+		for k, v := range f.responses[method] {
+			response[k] = v
+		}
+		f.mu.Unlock()
+
+		json.NewEncoder(w).Encode(response)
+	})
+	f.Server = httptest.NewServer(f.mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// respond sets extra fields returned by a method.
+func (f *fakeSlack) respond(method string, fields map[string]interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses[method] = fields
+}
+
+// callsTo returns the recorded calls of a method.
+func (f *fakeSlack) callsTo(method string) []fakeSlackCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var calls []fakeSlackCall
+	for _, c := range f.calls {
+		if c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// config returns a server config that talks to the fake.
+func (f *fakeSlack) config() config {
+	return config{SlackToken: "xoxb-test", SlackAPIURL: f.URL + "/api/"}
+}
+
+func TestSlackAPI_CallError(t *testing.T) {
+	f := newFakeSlack(t)
+	f.respond("chat.postMessage", map[string]interface{}{"ok": false, "error": "channel_not_found"})
+
+	api := newServer(f.config()).slack
+	err := api.call(context.Background(), "chat.postMessage", url.Values{"channel": {"C1"}}, nil)
+
+	if err == nil || !strings.Contains(err.Error(), "channel_not_found") {
+		t.Errorf("Expected channel_not_found error, got %v", err)
+	}
+	if code := errorCodeOf(err, ""); code != codeSlackError {
+		t.Errorf("Expected %s, got %q", codeSlackError, code)
+	}
+}
+
+func TestSlackAPI_RateLimitedCode(t *testing.T) {
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer limited.Close()
+
+	before, _ := errorCounts.Get(string(codeSlackRateLimited)).(*expvar.Int)
+	var n int64
+	if before != nil {
+		n = before.Value()
+	}
+
+	api := newServer(config{SlackToken: "xoxb-test", SlackAPIURL: limited.URL + "/api/"}).slack
+	err := api.call(context.Background(), "chat.postMessage", nil, nil)
+	if code := errorCodeOf(err, ""); code != codeSlackRateLimited {
+		t.Errorf("Expected %s, got %q from %v", codeSlackRateLimited, code, err)
+	}
+	if !strings.HasSuffix(err.Error(), "(SLACK_RATE_LIMITED)") {
+		t.Errorf("Expected the code in the message for logs, got %q", err)
+	}
+	if after := errorCounts.Get(string(codeSlackRateLimited)).(*expvar.Int).Value(); after != n+1 {
+		t.Errorf("Expected the errors metric counted once, got %d -> %d", n, after)
+	}
+}
+
+func TestSlackAPI_CallCountedPerMethod(t *testing.T) {
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer limited.Close()
+
+	api := newServer(config{SlackToken: "xoxb-test", SlackAPIURL: limited.URL + "/api/"}).slack
+	api.call(context.Background(), "test.rateLimited", nil, nil)
+	api.call(context.Background(), "test.rateLimited", nil, nil)
+
+	for _, st := range slackStats() {
+		if st.Method != "test.rateLimited" {
+			continue
+		}
+		if st.Calls != 2 || st.Errors != 2 || st.RateLimited != 2 {
+			t.Errorf("Expected 2 calls, errors and 429s, got %+v", st)
+		}
+		return
+	}
+	t.Error("Expected test.rateLimited in the Slack API stats")
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	snippetUsage = "usage: snippet add <name> (script on the following lines) | snippet list | snippet show <name> | snippet remove <name>"
+	runUsage     = "usage: run <snippet>"
+)
+
+// errSnippetNotFound is returned for snippet names not known to a team.
+var errSnippetNotFound = errors.New("no such snippet")
+
+// savedSnippet is a named script shared by a team and run with "run <name>".
+type savedSnippet struct {
+	Script    string    `json:"script"`
+	AuthorID  string    `json:"author_id,omitempty"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+	Updated   time.Time `json:"updated"`
+}
+
+// snippetStore keeps each team's snippets in a JSON file in the data
+// directory. The file is rewritten on every change.
+type snippetStore struct {
+	path string
+
+	mu    sync.Mutex
+	teams map[string]map[string]savedSnippet // team ID, then snippet name
+}
+
+func newSnippetStore(dir string) (*snippetStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	st := &snippetStore{path: filepath.Join(dir, "snippets.json"), teams: map[string]map[string]savedSnippet{}}
+	data, err := os.ReadFile(st.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &st.teams); err != nil {
+		return nil, fmt.Errorf("%s: %w", st.path, err)
+	}
+	return st, nil
+}
+
+// save adds or replaces a team's snippet. A replaced snippet keeps its
+// author.
+func (st *snippetStore) save(teamID, name, script, userID string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.teams[teamID] == nil {
+		st.teams[teamID] = map[string]savedSnippet{}
+	}
+	previous, existed := st.teams[teamID][name]
+	sn := savedSnippet{Script: script, AuthorID: userID, UpdatedBy: userID, Updated: time.Now()}
+	if existed {
+		sn.AuthorID = previous.AuthorID
+	}
+	st.teams[teamID][name] = sn
+	if err := writeJSONFile(st.path, st.teams); err != nil {
+		if existed {
+			st.teams[teamID][name] = previous
+		} else {
+			delete(st.teams[teamID], name)
+		}
+		return err
+	}
+	return nil
+}
+
+// remove deletes a team's snippet.
+func (st *snippetStore) remove(teamID, name string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sn, ok := st.teams[teamID][name]
+	if !ok {
+		return errSnippetNotFound
+	}
+	delete(st.teams[teamID], name)
+	if err := writeJSONFile(st.path, st.teams); err != nil {
+		st.teams[teamID][name] = sn
+		return err
+	}
+	return nil
+}
+
+// get returns a team's snippet.
+func (st *snippetStore) get(teamID, name string) (savedSnippet, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	sn, ok := st.teams[teamID][name]
+	return sn, ok
+}
+
+// names returns the names of a team's snippets, sorted.
+func (st *snippetStore) names(teamID string) []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	names := make([]string, 0, len(st.teams[teamID]))
+	for name := range st.teams[teamID] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// expandSnippet replaces "run <name>" with the script of the team's
+// snippet of that name, so that detection, policy and approval apply to
+// the script itself. Other commands are returned unchanged.
+func (s *server) expandSnippet(cmd slashCommand, command string) string {
+	fields := strings.Fields(command)
+	if s.snippets == nil || len(fields) != 2 || fields[0] != "run" {
+		return command
+	}
+	if sn, ok := s.snippets.get(cmd.TeamID, fields[1]); ok {
+		return sn.Script
+	}
+	return command
+}
+
+// runRun is reached only for snippets that do not exist, since known ones
+// are expanded before the command gets this far.
+func runRun(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	if s.snippets == nil {
+		return commandResult{Lines: []string{"run needs DATA_DIR"}, ExitCode: 1, Duration: time.Since(startTime)}
+	}
+	if len(args) != 1 {
+		return commandResult{Lines: []string{runUsage}, ExitCode: 2, Duration: time.Since(startTime)}
+	}
+	return commandResult{Lines: []string{fmt.Sprintf("run: %s: %v", args[0], errSnippetNotFound)}, ExitCode: 1, Duration: time.Since(startTime)}
+}
+
+func runSnippet(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	result := func(code int, lines ...string) commandResult {
+		return commandResult{Lines: lines, ExitCode: code, Duration: time.Since(startTime)}
+	}
+	if s.snippets == nil {
+		return result(1, "snippet needs DATA_DIR")
+	}
+	if len(args) == 0 {
+		return result(2, snippetUsage)
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		names := s.snippets.names(cmd.TeamID)
+		if len(names) == 0 {
+			return result(0, "no snippets yet")
+		}
+		lines := make([]string, 0, len(names))
+		for _, name := range names {
+			sn, _ := s.snippets.get(cmd.TeamID, name)
+			first, _, _ := strings.Cut(sn.Script, "\n")
+			lines = append(lines, fmt.Sprintf("%s  %s  (%d lines, by <@%s>)", name, first, strings.Count(sn.Script, "\n")+1, sn.AuthorID))
+		}
+		return result(0, lines...)
+
+	case args[0] == "show" && len(args) == 2:
+		sn, ok := s.snippets.get(cmd.TeamID, args[1])
+		if !ok {
+			return result(1, fmt.Sprintf("snippet: %s: %v", args[1], errSnippetNotFound))
+		}
+		header := fmt.Sprintf("# %s, by <@%s>, last changed by <@%s> on %s", args[1], sn.AuthorID, sn.UpdatedBy, sn.Updated.Local().Format("2006-01-02 15:04"))
+		return result(0, append([]string{header}, strings.Split(sn.Script, "\n")...)...)
+
+	case args[0] == "add" && len(args) >= 2:
+		name := args[1]
+		if !aliasName.MatchString(name) {
+			return result(2, snippetUsage)
+		}
+		_, script, _ := strings.Cut(cmd.Text, "\n")
+		script = strings.TrimSpace(script)
+		if script == "" {
+			return result(2, "snippet: put the script on the lines after \"snippet add "+name+"\"")
+		}
+		if err := s.snippets.save(cmd.TeamID, name, script, cmd.UserID); err != nil {
+			return result(1, "snippet: "+err.Error())
+		}
+		s.auditSnippet(cmd, "snippet_saved", name, script)
+		return result(0, fmt.Sprintf("saved snippet %s (%d lines); run it with: run %s", name, strings.Count(script, "\n")+1, name))
+
+	case (args[0] == "remove" || args[0] == "rm") && len(args) == 2:
+		sn, ok := s.snippets.get(cmd.TeamID, args[1])
+		if ok && sn.AuthorID != cmd.UserID && !s.cfg.Admins[cmd.UserID] {
+			return result(1, fmt.Sprintf("snippet: only <@%s> or an admin can remove %s", sn.AuthorID, args[1]))
+		}
+		if err := s.snippets.remove(cmd.TeamID, args[1]); err != nil {
+			return result(1, fmt.Sprintf("snippet: %s: %v", args[1], err))
+		}
+		s.auditSnippet(cmd, "snippet_removed", args[1], sn.Script)
+		return result(0, "removed snippet "+args[1])
+	}
+	return result(2, snippetUsage)
+}
+
+// auditSnippet records a change to the snippet library, so what "run"
+// does can be reviewed later.
+func (s *server) auditSnippet(cmd slashCommand, action, name, script string) {
+	s.auditLog.record(auditEvent{
+		Action:    action,
+		UserID:    cmd.UserID,
+		ChannelID: cmd.ChannelID,
+		TeamID:    cmd.TeamID,
+		Command:   script,
+		Detail:    name,
+	})
+}
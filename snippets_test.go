@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSnippet_SaveRunRemove(t *testing.T) {
+	dir := t.TempDir()
+	s := newServer(config{DataDir: dir, Admins: map[string]bool{"UADMIN": true}})
+	ctx := context.Background()
+	in := func(user, text string) string {
+		return s.handleCommandExecution(ctx, slashCommand{Text: text, UserID: user, ChannelID: "C1", TeamID: "T1"})["text"]
+	}
+
+	if got := in("U1", "$ snippet add greet\necho one\necho two"); !strings.Contains(got, "saved snippet greet (2 lines)") {
+		t.Fatalf("Expected the snippet saved, got %q", got)
+	}
+	if got := in("U2", "$ run greet"); !strings.Contains(got, "one\ntwo") {
+		t.Errorf("Expected both lines of the snippet to run, got %q", got)
+	}
+	if got := in("U2", "$ snippet list"); !strings.Contains(got, "greet  echo one  (2 lines, by <@U1>)") {
+		t.Errorf("Expected the snippet listed, got %q", got)
+	}
+	if got := in("U2", "$ snippet show greet"); !strings.Contains(got, "# greet, by <@U1>") || !strings.Contains(got, "echo two") {
+		t.Errorf("Expected the snippet shown, got %q", got)
+	}
+	if got := in("U1", "$ run missing"); !strings.Contains(got, "run: missing: no such snippet") {
+		t.Errorf("Expected an unknown snippet reported, got %q", got)
+	}
+
+	// Snippets belong to the team and survive a restart.
+	if got := s.handleCommandExecution(ctx, slashCommand{Text: "$ run greet", UserID: "U1", ChannelID: "C1", TeamID: "T2"})["text"]; strings.Contains(got, "one") {
+		t.Errorf("Expected another team not to see the snippet, got %q", got)
+	}
+	s = newServer(config{DataDir: dir, Admins: map[string]bool{"UADMIN": true}})
+
+	if got := in("U2", "$ snippet remove greet"); !strings.Contains(got, "only <@U1> or an admin") {
+		t.Errorf("Expected only the author to remove the snippet, got %q", got)
+	}
+	if got := in("UADMIN", "$ snippet remove greet"); !strings.Contains(got, "removed snippet greet") {
+		t.Errorf("Expected an admin to remove the snippet, got %q", got)
+	}
+	if got := in("U1", "$ snippet list"); !strings.Contains(got, "no snippets yet") {
+		t.Errorf("Expected no snippets left, got %q", got)
+	}
+}
+
+func TestSnippet_ChecksApplyToScript(t *testing.T) {
+	s := newServer(config{
+		DataDir:         t.TempDir(),
+		ClassifierRules: dangerRules([]*regexp.Regexp{regexp.MustCompile(`rm -rf`)}),
+		DangerousAction: dangerousBlock,
+	})
+	s.snippets.save("T1", "cleanup", "rm -rf /tmp/cache", "U1")
+
+	got := s.handleCommandExecution(context.Background(), slashCommand{Text: "$ run cleanup", UserID: "U1", ChannelID: "C1", TeamID: "T1"})["text"]
+	if !strings.Contains(got, "blocked") {
+		t.Errorf("Expected the snippet's script to be classified, got %q", got)
+	}
+}
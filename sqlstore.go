@@ -0,0 +1,599 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// Storage backends, chosen with STORE.
+const (
+	storeSQLite   = "sqlite"
+	storeFiles    = "files"
+	storePostgres = "postgres"
+)
+
+// stores are the stores the server keeps state in, in one backend.
+type stores struct {
+	jobs      *jobStore
+	aliases   *aliasStore
+	schedules *scheduler
+	prefs     *prefStore
+
+	// schedulerLock elects which server runs the schedules, for stores
+	// several servers share. It is nil for stores of a single server.
+	schedulerLock leaderLock
+}
+
+// openStores opens the backend chosen by cfg: a Postgres database at
+// DatabaseURL, which several servers can share, JSON files in DataDir, or
+// by default an SQLite database in DataDir. A new SQLite database starts
+// with what the files held, so upgrading keeps history.
+func openStores(cfg config) (stores, error) {
+	switch cfg.storeBackend() {
+	case storePostgres:
+		db, err := openSQLStore("pgx", cfg.DatabaseURL, true)
+		if err != nil {
+			return stores{}, fmt.Errorf("opening %s: %w", storePostgres, err)
+		}
+		st := db.stores()
+		st.schedulerLock = &pgAdvisoryLock{db: db.db, key: schedulerLockKey}
+		return st, nil
+	case storeFiles:
+		return openFileStores(cfg.DataDir)
+	}
+
+	path := filepath.Join(cfg.DataDir, "state.db")
+	if err := os.MkdirAll(cfg.DataDir, 0o700); err != nil {
+		return stores{}, err
+	}
+	_, err := os.Stat(path)
+	fresh := errors.Is(err, os.ErrNotExist)
+	// secure_delete overwrites deleted content, so redacted output is gone
+	// from the file and not just unlinked.
+	db, err := openSQLStore("sqlite", sqliteDSN(path, "_pragma=busy_timeout(5000)&_pragma=secure_delete(1)"), false)
+	if err != nil {
+		return stores{}, fmt.Errorf("opening %s: %w", path, err)
+	}
+	st := db.stores()
+	if fresh {
+		if err := importFileStores(cfg.DataDir, st); err != nil {
+			db.db.Close()
+			os.Remove(path)
+			return stores{}, fmt.Errorf("importing %s into %s: %w", cfg.DataDir, path, err)
+		}
+	}
+	return st, nil
+}
+
+// storeBackend returns the backend openStores uses.
+func (cfg config) storeBackend() string {
+	switch {
+	case cfg.Store != "":
+		return cfg.Store
+	case cfg.DatabaseURL != "":
+		return storePostgres
+	}
+	return storeSQLite
+}
+
+func openFileStores(dir string) (stores, error) {
+	jobs, err := newJobFile(dir)
+	if err != nil {
+		return stores{}, err
+	}
+	aliases, err := newAliasFile(dir)
+	if err != nil {
+		return stores{}, fmt.Errorf("loading aliases: %w", err)
+	}
+	schedules, err := newScheduleFile(dir)
+	if err != nil {
+		return stores{}, fmt.Errorf("loading schedules: %w", err)
+	}
+	prefs, err := newPrefFile(dir)
+	if err != nil {
+		return stores{}, fmt.Errorf("loading preferences: %w", err)
+	}
+	return stores{jobs: &jobStore{jobs}, aliases: &aliasStore{aliases}, schedules: &scheduler{schedules}, prefs: &prefStore{prefs}}, nil
+}
+
+// fileStoreNames are the files openFileStores keeps state in.
+var fileStoreNames = []string{"jobs.jsonl", "users.txt", "aliases.json", "schedules.json", "prefs.json"}
+
+// importFileStores copies the jobs, users, aliases, schedules and
+// preferences kept as files in dir into st, and then removes the files,
+// so that jobs later redacted in st are not left behind in them.
+func importFileStores(dir string, st stores) error {
+	files, err := openFileStores(dir)
+	if err != nil {
+		return err
+	}
+	var saveErr error
+	err = files.jobs.scan(func(r jobRecord) bool {
+		saveErr = st.jobs.save(r)
+		return saveErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	if saveErr != nil {
+		return saveErr
+	}
+
+	users, err := os.ReadFile(filepath.Join(dir, "users.txt"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, id := range strings.Fields(string(users)) {
+		if _, err := st.jobs.markSeen(id); err != nil {
+			return err
+		}
+	}
+
+	for scope, aliases := range files.aliases.aliasBackend.(*aliasFile).scopes {
+		for name, e := range aliases {
+			if err := st.aliases.set(scope, name, e); err != nil {
+				return err
+			}
+		}
+	}
+	for _, e := range files.schedules.list("") {
+		if err := st.schedules.add(e); err != nil {
+			return err
+		}
+	}
+	for userID, p := range files.prefs.prefBackend.(*prefFile).users {
+		if err := st.prefs.set(userID, p); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range fileStoreNames {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqlStore keeps state in an SQL database. Queries are written with ?
+// placeholders, which are rewritten for Postgres.
+type sqlStore struct {
+	db       *sql.DB
+	postgres bool
+}
+
+// sqlSchema creates the tables, with a placeholder for each dialect's
+// auto-incrementing key.
+const sqlSchema = `
+CREATE TABLE IF NOT EXISTS jobs (seq %[1]s, id TEXT NOT NULL UNIQUE, channel_id TEXT NOT NULL DEFAULT '', started BIGINT NOT NULL DEFAULT 0, record TEXT NOT NULL);
+CREATE TABLE IF NOT EXISTS users (id TEXT PRIMARY KEY);
+CREATE TABLE IF NOT EXISTS aliases (scope TEXT NOT NULL, name TEXT NOT NULL, entry TEXT NOT NULL, PRIMARY KEY (scope, name));
+CREATE TABLE IF NOT EXISTS schedules (seq %[1]s, id TEXT NOT NULL UNIQUE, channel_id TEXT NOT NULL, entry TEXT NOT NULL);
+CREATE TABLE IF NOT EXISTS prefs (user_id TEXT PRIMARY KEY, entry TEXT NOT NULL);
+`
+
+// sqliteSearchSchema indexes the command and output of SQLite jobs for
+// search. The trigram tokenizer matches any text of three characters or
+// more, ignoring case, as searches did before there was an index. The index
+// keeps no copy of the text, and secure-delete removes a job's entries
+// when it is redacted, rather than only marking them deleted.
+const sqliteSearchSchema = `
+CREATE VIRTUAL TABLE jobs_fts USING fts5 (text, output, tokenize = 'trigram', content = '', contentless_delete = 1);
+INSERT INTO jobs_fts (jobs_fts, rank) VALUES ('secure-delete', 1);
+CREATE TRIGGER jobs_fts_insert AFTER INSERT ON jobs BEGIN
+	INSERT INTO jobs_fts (rowid, text, output) VALUES (new.seq, json_extract(new.record, '$.text'),
+		(SELECT group_concat(value, char(10)) FROM json_each(new.record, '$.lines')));
+END;
+CREATE TRIGGER jobs_fts_redact AFTER UPDATE OF record ON jobs BEGIN
+	DELETE FROM jobs_fts WHERE rowid = old.seq;
+	INSERT INTO jobs_fts (rowid, text, output) VALUES (new.seq, json_extract(new.record, '$.text'),
+		(SELECT group_concat(value, char(10)) FROM json_each(new.record, '$.lines')));
+END;
+INSERT INTO jobs_fts (rowid, text, output) SELECT seq, json_extract(record, '$.text'),
+	(SELECT group_concat(value, char(10)) FROM json_each(record, '$.lines')) FROM jobs;
+`
+
+// sqliteDSN is the data source name of the SQLite database at path, with
+// the query's parameters. Characters that URIs give a meaning, such as the
+// "#" of a channel name in a directory, are escaped.
+func sqliteDSN(path, query string) string {
+	return "file:" + strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(path) + "?" + query
+}
+
+func openSQLStore(driver, dsn string, postgres bool) (*sqlStore, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if !postgres {
+		// SQLite allows one writer at a time; a single connection queues
+		// them here rather than failing with SQLITE_BUSY.
+		db.SetMaxOpenConns(1)
+	}
+	key := "INTEGER PRIMARY KEY AUTOINCREMENT"
+	if postgres {
+		key = "BIGSERIAL PRIMARY KEY"
+	}
+	for _, stmt := range strings.Split(strings.TrimSpace(fmt.Sprintf(sqlSchema, key)), ";\n") {
+		if _, err := db.Exec(strings.TrimSuffix(stmt, ";")); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	st := &sqlStore{db: db, postgres: postgres}
+	if err := st.indexJobs(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if !postgres {
+		if err := st.indexText(); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+// indexText creates the search index of an SQLite store that has none,
+// with the jobs already stored.
+func (st *sqlStore) indexText() error {
+	var n int
+	if err := st.queryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'jobs_fts'").Scan(&n); err != nil || n > 0 {
+		return err
+	}
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(sqliteSearchSchema); err != nil {
+		return fmt.Errorf("creating the search index: %w", err)
+	}
+	return tx.Commit()
+}
+
+// indexJobs indexes jobs by channel and start time, which are copied out
+// of the records of jobs tables created by earlier versions first.
+func (st *sqlStore) indexJobs() error {
+	if _, err := st.exec("SELECT channel_id, started FROM jobs LIMIT 0"); err != nil {
+		for _, stmt := range []string{
+			"ALTER TABLE jobs ADD COLUMN channel_id TEXT NOT NULL DEFAULT ''",
+			"ALTER TABLE jobs ADD COLUMN started BIGINT NOT NULL DEFAULT 0",
+		} {
+			if _, err := st.exec(stmt); err != nil {
+				return err
+			}
+		}
+		// The records are read before they are updated, since SQLite has
+		// a single connection.
+		var jobs []jobRecord
+		if err := (sqlJobs{st}).scan(func(r jobRecord) bool {
+			jobs = append(jobs, r)
+			return true
+		}); err != nil {
+			return err
+		}
+		tx, err := st.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		for _, r := range jobs {
+			if _, err := tx.Exec(st.rebind("UPDATE jobs SET channel_id = ?, started = ? WHERE id = ?"), r.ChannelID, r.Started.UnixMicro(), r.ID); err != nil {
+				return err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	_, err := st.exec("CREATE INDEX IF NOT EXISTS jobs_channel_started ON jobs (channel_id, started)")
+	return err
+}
+
+func (st *sqlStore) stores() stores {
+	return stores{jobs: &jobStore{sqlJobs{st}}, aliases: &aliasStore{sqlAliases{st}}, schedules: &scheduler{sqlSchedules{st}}, prefs: &prefStore{sqlPrefs{st}}}
+}
+
+// rebind rewrites ? placeholders as $1, $2, … for Postgres.
+func (st *sqlStore) rebind(query string) string {
+	if !st.postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func (st *sqlStore) exec(query string, args ...interface{}) (sql.Result, error) {
+	return st.db.Exec(st.rebind(query), args...)
+}
+
+func (st *sqlStore) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return st.db.Query(st.rebind(query), args...)
+}
+
+func (st *sqlStore) queryRow(query string, args ...interface{}) *sql.Row {
+	return st.db.QueryRow(st.rebind(query), args...)
+}
+
+// sqlJobs is a jobBackend keeping each record as JSON in a row.
+type sqlJobs struct{ *sqlStore }
+
+func (st sqlJobs) markSeen(userID string) (bool, error) {
+	res, err := st.exec("INSERT INTO users (id) VALUES (?) ON CONFLICT DO NOTHING", userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (st sqlJobs) save(r jobRecord) error {
+	record, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = st.exec("INSERT INTO jobs (id, channel_id, started, record) VALUES (?, ?, ?, ?)", r.ID, r.ChannelID, r.Started.UnixMicro(), string(record))
+	return err
+}
+
+// jobPage is how many jobs scanNewest reads at a time.
+const jobPage = 100
+
+// scanNewest reads a page of jobs at a time, so that the connection is
+// not held while fn runs.
+func (st sqlJobs) scanNewest(f jobFilter, fn func(jobRecord) bool) error {
+	query := "SELECT record FROM jobs WHERE started >= ?"
+	args := []interface{}{f.Since.UnixMicro()}
+	if f.ChannelID != "" {
+		query += " AND channel_id = ?"
+		args = append(args, f.ChannelID)
+	}
+	return st.pages(query+" ORDER BY started DESC, seq DESC", args, fn)
+}
+
+// scanMatching looks text up in the search index of SQLite stores. The
+// index cannot find text shorter than three characters, and Postgres
+// stores have none, so those jobs are read and checked instead.
+func (st sqlJobs) scanMatching(text string, f jobFilter, fn func(jobRecord) bool) error {
+	if st.postgres || utf8.RuneCountInString(text) < 3 {
+		return st.scanNewest(f, func(r jobRecord) bool {
+			return !r.contains(text) || fn(r)
+		})
+	}
+	// The text is searched for as a phrase, in which quotes are doubled.
+	query := `SELECT jobs.record FROM jobs JOIN jobs_fts ON jobs_fts.rowid = jobs.seq
+		WHERE jobs_fts MATCH ? AND jobs.started >= ?`
+	args := []interface{}{`"` + strings.ReplaceAll(text, `"`, `""`) + `"`, f.Since.UnixMicro()}
+	if f.ChannelID != "" {
+		query += " AND jobs.channel_id = ?"
+		args = append(args, f.ChannelID)
+	}
+	// The index folds case differently from Go for some letters, so
+	// candidates are checked again.
+	return st.pages(query+" ORDER BY jobs.started DESC, jobs.seq DESC", args, func(r jobRecord) bool {
+		return !r.contains(text) || fn(r)
+	})
+}
+
+// pages calls fn for each record an ordered query returns, reading
+// jobPage of them at a time, until fn returns false.
+func (st sqlJobs) pages(query string, args []interface{}, fn func(jobRecord) bool) error {
+	query += " LIMIT ? OFFSET ?"
+	for offset := 0; ; offset += jobPage {
+		var page []jobRecord
+		if err := st.records(query, append(args, jobPage, offset), func(r jobRecord) bool {
+			page = append(page, r)
+			return true
+		}); err != nil {
+			return err
+		}
+		for _, r := range page {
+			if !fn(r) {
+				return nil
+			}
+		}
+		if len(page) < jobPage {
+			return nil
+		}
+	}
+}
+
+func (st sqlJobs) scan(fn func(jobRecord) bool) error {
+	return st.records("SELECT record FROM jobs ORDER BY seq", nil, fn)
+}
+
+// records calls fn for each record a query returns until fn returns
+// false.
+func (st sqlJobs) records(query string, args []interface{}, fn func(jobRecord) bool) error {
+	rows, err := st.query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var record string
+		if err := rows.Scan(&record); err != nil {
+			return err
+		}
+		var r jobRecord
+		if err := json.Unmarshal([]byte(record), &r); err != nil {
+			return fmt.Errorf("reading jobs: %w", err)
+		}
+		if !fn(r) {
+			break
+		}
+	}
+	return rows.Err()
+}
+
+func (st sqlJobs) job(id string) (jobRecord, error) {
+	var record string
+	err := st.queryRow("SELECT record FROM jobs WHERE id = ?", id).Scan(&record)
+	if errors.Is(err, sql.ErrNoRows) {
+		return jobRecord{}, errJobNotStored
+	}
+	if err != nil {
+		return jobRecord{}, err
+	}
+	var r jobRecord
+	if err := json.Unmarshal([]byte(record), &r); err != nil {
+		return jobRecord{}, fmt.Errorf("reading job %s: %w", id, err)
+	}
+	return r, nil
+}
+
+func (st sqlJobs) redact(id, by string) (jobRecord, error) {
+	r, err := st.job(id)
+	if err != nil {
+		return jobRecord{}, err
+	}
+	r.Text, r.Lines = redactedText, nil
+	r.Redacted, r.RedactedBy = true, by
+	record, err := json.Marshal(r)
+	if err != nil {
+		return jobRecord{}, err
+	}
+	if _, err := st.exec("UPDATE jobs SET record = ? WHERE id = ?", string(record), id); err != nil {
+		return jobRecord{}, err
+	}
+	return r, nil
+}
+
+// sqlAliases is an aliasBackend keeping each alias in a row.
+type sqlAliases struct{ *sqlStore }
+
+func (st sqlAliases) set(scope, name string, e aliasEntry) error {
+	entry, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = st.exec(`INSERT INTO aliases (scope, name, entry) VALUES (?, ?, ?)
+		ON CONFLICT (scope, name) DO UPDATE SET entry = excluded.entry`, scope, name, string(entry))
+	return err
+}
+
+func (st sqlAliases) remove(scope, name string) error {
+	res, err := st.exec("DELETE FROM aliases WHERE scope = ? AND name = ?", scope, name)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errAliasNotFound
+	}
+	return nil
+}
+
+func (st sqlAliases) get(scope, name string) (aliasEntry, bool) {
+	var entry string
+	err := st.queryRow("SELECT entry FROM aliases WHERE scope = ? AND name = ?", scope, name).Scan(&entry)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			fmt.Fprintf(os.Stderr, "Error reading alias %s: %v\n", name, err)
+		}
+		return aliasEntry{}, false
+	}
+	var e aliasEntry
+	if err := json.Unmarshal([]byte(entry), &e); err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading alias %s: %v\n", name, err)
+		return aliasEntry{}, false
+	}
+	return e, true
+}
+
+func (st sqlAliases) list(scope string) map[string]aliasEntry {
+	aliases := map[string]aliasEntry{}
+	rows, err := st.query("SELECT name, entry FROM aliases WHERE scope = ?", scope)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing aliases: %v\n", err)
+		return aliases
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, entry string
+		var e aliasEntry
+		if err := rows.Scan(&name, &entry); err == nil && json.Unmarshal([]byte(entry), &e) == nil {
+			aliases[name] = e
+		}
+	}
+	if err := rows.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing aliases: %v\n", err)
+	}
+	return aliases
+}
+
+// sqlSchedules is a scheduleBackend keeping each schedule in a row.
+type sqlSchedules struct{ *sqlStore }
+
+func (st sqlSchedules) add(e scheduledCommand) error {
+	entry, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = st.exec("INSERT INTO schedules (id, channel_id, entry) VALUES (?, ?, ?)", e.ID, e.ChannelID, string(entry))
+	return err
+}
+
+func (st sqlSchedules) remove(id, channelID, userID string) (scheduledCommand, error) {
+	var entry string
+	err := st.queryRow("SELECT entry FROM schedules WHERE id = ? AND channel_id = ?", id, channelID).Scan(&entry)
+	if errors.Is(err, sql.ErrNoRows) {
+		return scheduledCommand{}, errScheduleNotFound
+	}
+	if err != nil {
+		return scheduledCommand{}, err
+	}
+	var e scheduledCommand
+	if err := json.Unmarshal([]byte(entry), &e); err != nil {
+		return scheduledCommand{}, err
+	}
+	if e.UserID != userID {
+		return e, fmt.Errorf("only <@%s> can remove schedule %s", e.UserID, id)
+	}
+	if _, err := st.exec("DELETE FROM schedules WHERE id = ?", id); err != nil {
+		return e, err
+	}
+	return e, nil
+}
+
+func (st sqlSchedules) list(channelID string) []scheduledCommand {
+	rows, err := st.query("SELECT entry FROM schedules WHERE ? = '' OR channel_id = ? ORDER BY seq", channelID, channelID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing schedules: %v\n", err)
+		return nil
+	}
+	defer rows.Close()
+	var entries []scheduledCommand
+	for rows.Next() {
+		var entry string
+		var e scheduledCommand
+		if err := rows.Scan(&entry); err == nil && json.Unmarshal([]byte(entry), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing schedules: %v\n", err)
+	}
+	return entries
+}
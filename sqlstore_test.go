@@ -0,0 +1,361 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dataDirContaining returns a file under dir that contains s, or "". The
+// audit log is skipped, since it records commands as typed.
+func dataDirContaining(t *testing.T, dir, s string) string {
+	t.Helper()
+
+	var found string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), "audit.db") {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if strings.Contains(string(data), s) {
+			found = path
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func TestStores(t *testing.T) {
+	backends := map[string]config{
+		storeSQLite: {DataDir: t.TempDir()},
+		storeFiles:  {DataDir: t.TempDir(), Store: storeFiles},
+	}
+	// Postgres is tested against a scratch database, which is emptied.
+	if url := os.Getenv("TEST_DATABASE_URL"); url != "" {
+		db, err := openSQLStore("pgx", url, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, table := range []string{"jobs", "users", "aliases", "schedules", "prefs"} {
+			if _, err := db.exec("DELETE FROM " + table); err != nil {
+				t.Fatal(err)
+			}
+		}
+		db.db.Close()
+		backends[storePostgres] = config{DatabaseURL: url}
+	}
+
+	for name, cfg := range backends {
+		t.Run(name, func(t *testing.T) {
+			st, err := openStores(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			testJobBackend(t, st.jobs)
+			testAliasBackend(t, st.aliases)
+			testScheduleBackend(t, st.schedules)
+			testPrefBackend(t, st.prefs)
+		})
+	}
+}
+
+func testJobBackend(t *testing.T, st *jobStore) {
+	if first, err := st.markSeen("U1"); err != nil || !first {
+		t.Errorf("Expected U1 to be new, got %v, %v", first, err)
+	}
+	if first, err := st.markSeen("U1"); err != nil || first {
+		t.Errorf("Expected U1 to be known, got %v, %v", first, err)
+	}
+
+	started := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, id := range []string{"j1", "j2", "j3"} {
+		if err := st.save(jobRecord{ID: id, UserID: "U1", Text: "echo " + id, Lines: []string{"out " + id}, Started: started}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var ids []string
+	if err := st.scan(func(r jobRecord) bool {
+		ids = append(ids, r.ID)
+		return len(ids) < 2
+	}); err != nil || strings.Join(ids, ",") != "j1,j2" {
+		t.Errorf("Expected to scan j1 and j2 in order, got %v, %v", ids, err)
+	}
+
+	r, err := st.job("j2")
+	if err != nil || r.Text != "echo j2" || !r.Started.Equal(started) {
+		t.Errorf("Expected job j2, got %+v, %v", r, err)
+	}
+	if _, err := st.job("missing"); !errors.Is(err, errJobNotStored) {
+		t.Errorf("Expected errJobNotStored, got %v", err)
+	}
+
+	if r, err := st.redact("j2", "U2"); err != nil || !r.Redacted || r.Text != redactedText {
+		t.Errorf("Expected j2 redacted, got %+v, %v", r, err)
+	}
+	if r, err := st.job("j2"); err != nil || !r.Redacted || r.RedactedBy != "U2" || len(r.Lines) != 0 {
+		t.Errorf("Expected j2 stored redacted, got %+v, %v", r, err)
+	}
+	if r, err := st.job("j3"); err != nil || r.Text != "echo j3" {
+		t.Errorf("Expected j3 untouched, got %+v, %v", r, err)
+	}
+	for text, want := range map[string]string{"OUT J": "j3,j1", "out j2": "", "j3": "j3", `"`: ""} {
+		ids = nil
+		if err := st.scanMatching(text, jobFilter{}, func(r jobRecord) bool {
+			ids = append(ids, r.ID)
+			return true
+		}); err != nil || strings.Join(ids, ",") != want {
+			t.Errorf("Expected jobs containing %q to be %q, got %v, %v", text, want, ids, err)
+		}
+	}
+
+	for i, channel := range []string{"C1", "C2", "C1", "C1"} {
+		r := jobRecord{ID: fmt.Sprintf("c%d", i), ChannelID: channel, Started: started.Add(time.Duration(i) * time.Hour)}
+		if err := st.save(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids = nil
+	if err := st.scanNewest(jobFilter{ChannelID: "C1", Since: started.Add(time.Minute)}, func(r jobRecord) bool {
+		ids = append(ids, r.ID)
+		return true
+	}); err != nil || strings.Join(ids, ",") != "c3,c2" {
+		t.Errorf("Expected the later jobs of C1, newest first, got %v, %v", ids, err)
+	}
+	if jobs, err := st.recent(2, jobFilter{ChannelID: "C1"}, func(r jobRecord) bool { return r.ID != "c3" }); err != nil || len(jobs) != 2 || jobs[0].ID != "c0" || jobs[1].ID != "c2" {
+		t.Errorf("Expected c0 and c2, oldest first, got %+v, %v", jobs, err)
+	}
+}
+
+func testAliasBackend(t *testing.T, st *aliasStore) {
+	cmd := slashCommand{TeamID: "T1", ChannelID: "C1"}
+	if err := st.set(aliasScope(cmd, true), "disk", aliasEntry{Command: "df -h"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.set(aliasScope(cmd, false), "disk", aliasEntry{Command: "df -i"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.set(aliasScope(cmd, false), "disk", aliasEntry{Command: "df -hT"}); err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := st.lookup(cmd, "disk"); !ok || e.Command != "df -hT" {
+		t.Errorf("Expected the redefined channel alias, got %+v, %v", e, ok)
+	}
+	if got := st.list(aliasScope(cmd, false)); len(got) != 1 || got["disk"].Command != "df -hT" {
+		t.Errorf("Expected one channel alias, got %v", got)
+	}
+
+	if err := st.remove(aliasScope(cmd, false), "disk"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.remove(aliasScope(cmd, false), "disk"); !errors.Is(err, errAliasNotFound) {
+		t.Errorf("Expected errAliasNotFound, got %v", err)
+	}
+	if e, ok := st.lookup(cmd, "disk"); !ok || e.Command != "df -h" {
+		t.Errorf("Expected the team alias, got %+v, %v", e, ok)
+	}
+}
+
+func testScheduleBackend(t *testing.T, st *scheduler) {
+	for _, e := range []scheduledCommand{
+		{ID: "s1", Cron: "@daily", Command: "uptime", ChannelID: "C1", UserID: "U1"},
+		{ID: "s2", Cron: "@hourly", Command: "df -h", ChannelID: "C2", UserID: "U1"},
+		{ID: "s3", Cron: "@daily", Command: "free -m", ChannelID: "C1", UserID: "U1"},
+	} {
+		if err := st.add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := st.list("C1"); len(got) != 2 || got[0].ID != "s1" || got[1].ID != "s3" {
+		t.Errorf("Expected the schedules of C1 in order, got %+v", got)
+	}
+	if got := st.list(""); len(got) != 3 {
+		t.Errorf("Expected all schedules, got %+v", got)
+	}
+
+	if _, err := st.remove("s1", "C2", "U1"); !errors.Is(err, errScheduleNotFound) {
+		t.Errorf("Expected another channel's schedule not found, got %v", err)
+	}
+	if _, err := st.remove("s1", "C1", "U2"); err == nil || !strings.Contains(err.Error(), "only <@U1>") {
+		t.Errorf("Expected only the owner to remove it, got %v", err)
+	}
+	if e, err := st.remove("s1", "C1", "U1"); err != nil || e.Command != "uptime" {
+		t.Errorf("Expected s1 removed, got %+v, %v", e, err)
+	}
+	if got := st.list("C1"); len(got) != 1 || got[0].ID != "s3" {
+		t.Errorf("Expected s3 left in C1, got %+v", got)
+	}
+}
+
+func testPrefBackend(t *testing.T, st *prefStore) {
+	if _, ok := st.get("U1"); ok {
+		t.Error("Expected no preferences for a new user")
+	}
+	if err := st.set("U1", userPrefs{Plain: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.set("U1", userPrefs{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.set("U2", userPrefs{Plain: true}); err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := st.get("U1"); !ok || p.Plain {
+		t.Errorf("Expected U1's replaced preferences, got %+v, %v", p, ok)
+	}
+	if p, ok := st.get("U2"); !ok || !p.Plain {
+		t.Errorf("Expected U2's preferences, got %+v, %v", p, ok)
+	}
+}
+
+func TestOpenStores_ImportsFiles(t *testing.T) {
+	dir := t.TempDir()
+	files, err := openStores(config{DataDir: dir, Store: storeFiles})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files.jobs.save(jobRecord{ID: "j1", Text: "uptime"})
+	files.jobs.markSeen("U1")
+	files.aliases.set("channel:C1", "disk", aliasEntry{Command: "df -h"})
+	files.schedules.add(scheduledCommand{ID: "s1", Cron: "@daily", Command: "uptime", ChannelID: "C1", UserID: "U1"})
+	files.prefs.set("U1", userPrefs{Plain: true})
+
+	st, err := openStores(config{DataDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "state.db")); err != nil {
+		t.Fatalf("Expected an SQLite database, got %v", err)
+	}
+	if r, err := st.jobs.job("j1"); err != nil || r.Text != "uptime" {
+		t.Errorf("Expected the job imported, got %+v, %v", r, err)
+	}
+	if first, err := st.jobs.markSeen("U1"); err != nil || first {
+		t.Errorf("Expected U1 imported, got %v, %v", first, err)
+	}
+	if e, ok := st.aliases.get("channel:C1", "disk"); !ok || e.Command != "df -h" {
+		t.Errorf("Expected the alias imported, got %+v, %v", e, ok)
+	}
+	if got := st.schedules.list("C1"); len(got) != 1 || got[0].ID != "s1" {
+		t.Errorf("Expected the schedule imported, got %+v", got)
+	}
+	if p, ok := st.prefs.get("U1"); !ok || !p.Plain {
+		t.Errorf("Expected the preferences imported, got %+v, %v", p, ok)
+	}
+	for _, name := range fileStoreNames {
+		if _, err := os.Stat(filepath.Join(dir, name)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected %s removed once imported, got %v", name, err)
+		}
+	}
+
+	// Files are only imported into a new database.
+	files.jobs.save(jobRecord{ID: "j2"})
+	st, err = openStores(config{DataDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.jobs.job("j2"); !errors.Is(err, errJobNotStored) {
+		t.Errorf("Expected no second import, got %v", err)
+	}
+}
+
+func TestOpenStores_IndexesEarlierJobs(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(dir, "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		"CREATE TABLE jobs (seq INTEGER PRIMARY KEY AUTOINCREMENT, id TEXT NOT NULL UNIQUE, record TEXT NOT NULL)",
+		`INSERT INTO jobs (id, record) VALUES ('j1', '{"id": "j1", "channel_id": "C1", "text": "uptime", "started": "2026-01-02T03:04:05Z"}')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	st, err := openStores(config{DataDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := st.jobs.recent(10, jobFilter{ChannelID: "C1", Since: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}, func(jobRecord) bool { return true })
+	if err != nil || len(jobs) != 1 || jobs[0].Text != "uptime" {
+		t.Errorf("Expected the earlier job selected by channel and start, got %+v, %v", jobs, err)
+	}
+	if hits, err := st.jobs.search("UPTIME", time.Time{}, 10, func(jobRecord) bool { return true }); err != nil || len(hits) != 1 {
+		t.Errorf("Expected the earlier job in the search index, got %+v, %v", hits, err)
+	}
+}
+
+func TestSQLStore_SearchIndex(t *testing.T) {
+	dir := t.TempDir()
+	st, err := openStores(config{DataDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []jobRecord{
+		{ID: "j1", Text: "psql -c 'select 1'", Lines: []string{"connection refused", "retrying"}},
+		{ID: "j2", Text: "cat .env", Lines: []string{"API_KEY=tr1gram-secret"}},
+	} {
+		if err := st.jobs.save(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	indexed := func(text string) []string {
+		t.Helper()
+		rows, err := st.jobs.jobBackend.(sqlJobs).query(`SELECT jobs.id FROM jobs JOIN jobs_fts ON jobs_fts.rowid = jobs.seq WHERE jobs_fts MATCH ? ORDER BY jobs.seq`, `"`+text+`"`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var ids []string
+		for rows.Next() {
+			var id string
+			rows.Scan(&id)
+			ids = append(ids, id)
+		}
+		return ids
+	}
+	if got := indexed("Connection Ref"); strings.Join(got, ",") != "j1" {
+		t.Errorf("Expected saved jobs indexed by output, got %v", got)
+	}
+	if got := indexed("psql"); strings.Join(got, ",") != "j1" {
+		t.Errorf("Expected saved jobs indexed by command, got %v", got)
+	}
+
+	if _, err := st.jobs.redact("j2", "U1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := indexed("tr1gram-secret"); len(got) != 0 {
+		t.Errorf("Expected redacted output gone from the index, got %v", got)
+	}
+	if got := indexed("redacted"); strings.Join(got, ",") != "j2" {
+		t.Errorf("Expected the redacted job indexed as it is now, got %v", got)
+	}
+	st.jobs.jobBackend.(sqlJobs).db.Close()
+	if path := dataDirContaining(t, dir, "tr1gram"); path != "" {
+		t.Errorf("Expected the redacted output gone from disk, found in %s", path)
+	}
+}
+
+func TestSQLStore_Rebind(t *testing.T) {
+	query := "SELECT entry FROM aliases WHERE scope = ? AND name = ?"
+	if got := (&sqlStore{}).rebind(query); got != query {
+		t.Errorf("Expected SQLite queries unchanged, got %q", got)
+	}
+	if got := (&sqlStore{postgres: true}).rebind(query); got != "SELECT entry FROM aliases WHERE scope = $1 AND name = $2" {
+		t.Errorf("Expected numbered placeholders for Postgres, got %q", got)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// slackMethodStats are the counters of one Slack method.
+type slackMethodStats struct {
+	Method                              string
+	Calls, Errors, RateLimited, Latency int64
+}
+
+// slackStats returns the Slack call counters, busiest method first.
+func slackStats() []slackMethodStats {
+	counter := func(m *expvar.Map, key string) int64 {
+		if v, ok := m.Get(key).(*expvar.Int); ok {
+			return v.Value()
+		}
+		return 0
+	}
+
+	var stats []slackMethodStats
+	slackAPIStats.Do(func(kv expvar.KeyValue) {
+		m, ok := kv.Value.(*expvar.Map)
+		if !ok {
+			return
+		}
+		stats = append(stats, slackMethodStats{
+			Method:      kv.Key,
+			Calls:       counter(m, "calls"),
+			Errors:      counter(m, "errors"),
+			RateLimited: counter(m, "rate_limited"),
+			Latency:     counter(m, "latency_ms"),
+		})
+	})
+	sort.SliceStable(stats, func(a, b int) bool { return stats[a].Calls > stats[b].Calls })
+	return stats
+}
+
+// runStatus is the status builtin. It shows running jobs and how much of
+// the Slack API the server has used since it started.
+func runStatus(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+
+	lines := []string{fmt.Sprintf("Running jobs: %d", len(s.jobs.running()))}
+	if s.leader != nil {
+		role := "standby, another server runs the schedules"
+		if s.leader.isLeader() {
+			role = "leader, this server runs the schedules"
+		}
+		lines = append(lines, "Scheduler: "+role)
+	}
+	if s.agents != nil {
+		lines = append(lines, s.agents.agentLines()...)
+	}
+	lines = append(lines, "", "Slack API calls:")
+	stats := slackStats()
+	if len(stats) == 0 {
+		lines = append(lines, "  none")
+	} else {
+		width := len("method")
+		for _, st := range stats {
+			width = max(width, len(st.Method))
+		}
+		lines = append(lines, fmt.Sprintf("  %-*s  %7s  %6s  %4s  %6s", width, "method", "calls", "errors", "429s", "avg ms"))
+		for _, st := range stats {
+			var avg int64
+			if st.Calls > 0 {
+				avg = st.Latency / st.Calls
+			}
+			lines = append(lines, fmt.Sprintf("  %-*s  %7d  %6d  %4d  %6d", width, st.Method, st.Calls, st.Errors, st.RateLimited, avg))
+		}
+	}
+	if s.slack != nil {
+		if pacing := s.slack.pacer.pacingLines(); len(pacing) > 0 {
+			lines = append(lines, "", "Streaming slowed down:")
+			lines = append(lines, pacing...)
+		}
+	}
+	return commandResult{Lines: lines, Duration: time.Since(startTime)}
+}
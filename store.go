@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errJobNotStored is returned for job IDs the store does not know.
+var errJobNotStored = errors.New("no such job")
+
+// jobRecord is a finished command as kept by the store. Text and output
+// are redacted according to the channel's profile before they are stored.
+type jobRecord struct {
+	ID        string        `json:"id"`
+	TeamID    string        `json:"team_id,omitempty"`
+	ChannelID string        `json:"channel_id,omitempty"`
+	UserID    string        `json:"user_id,omitempty"`
+	ThreadTS  string        `json:"thread_ts,omitempty"`
+	Text      string        `json:"text"`
+	Lines     []string      `json:"lines,omitempty"`
+	ExitCode  int           `json:"exit_code"`
+	Severity  string        `json:"severity,omitempty"`
+	Started   time.Time     `json:"started"`
+	Duration  time.Duration `json:"duration"`
+
+	// Private is set for jobs whose output was only shown to the invoker.
+	Private bool `json:"private,omitempty"`
+
+	// Redacted is set, with who did it, once a job's command and output
+	// have been removed with the redact builtin.
+	Redacted   bool   `json:"redacted,omitempty"`
+	RedactedBy string `json:"redacted_by,omitempty"`
+
+	// Quarantined is set for jobs whose output contained a secret. Their
+	// output is stored redacted and only shown to admins through the API.
+	Quarantined bool `json:"quarantined,omitempty"`
+}
+
+// jobStore keeps finished jobs and the users seen, in the backend chosen
+// by openStores.
+type jobStore struct {
+	jobBackend
+}
+
+// jobBackend is where a jobStore keeps its records.
+type jobBackend interface {
+	// markSeen records that a user has used the server and reports
+	// whether this is the first time.
+	markSeen(userID string) (bool, error)
+	// save adds a job record.
+	save(r jobRecord) error
+	// scan calls fn for every stored job, oldest first, until fn returns
+	// false.
+	scan(fn func(jobRecord) bool) error
+	// scanNewest calls fn for the stored jobs f selects, latest started
+	// first, until fn returns false.
+	scanNewest(f jobFilter, fn func(jobRecord) bool) error
+	// scanMatching is scanNewest for the jobs whose command or output
+	// contains text, ignoring case.
+	scanMatching(text string, f jobFilter, fn func(jobRecord) bool) error
+	// job returns the job with the given ID, or errJobNotStored.
+	job(id string) (jobRecord, error)
+	// redact removes a stored job's command and output, so they are gone
+	// from disk and not just hidden, and returns the redacted record.
+	redact(id, by string) (jobRecord, error)
+}
+
+// jobFilter selects stored jobs. Zero fields select every job.
+type jobFilter struct {
+	ChannelID string
+	Since     time.Time // jobs started at or after
+}
+
+func (f jobFilter) matches(r jobRecord) bool {
+	return (f.ChannelID == "" || r.ChannelID == f.ChannelID) && !r.Started.Before(f.Since)
+}
+
+// jobFile keeps finished jobs as JSON lines in a file. The file is only
+// appended to, so it can be shipped or rotated with ordinary tools, except
+// when a job is redacted and the file is rewritten without its output.
+type jobFile struct {
+	path      string
+	usersPath string // users seen, one ID per line
+
+	mu    sync.Mutex
+	users map[string]bool // loaded on first use
+}
+
+func newJobFile(dir string) (*jobFile, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &jobFile{
+		path:      filepath.Join(dir, "jobs.jsonl"),
+		usersPath: filepath.Join(dir, "users.txt"),
+	}, nil
+}
+
+func (st *jobFile) markSeen(userID string) (bool, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.users == nil {
+		data, err := os.ReadFile(st.usersPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, err
+		}
+		st.users = make(map[string]bool)
+		for _, id := range strings.Fields(string(data)) {
+			st.users[id] = true
+		}
+	}
+	if st.users[userID] {
+		return false, nil
+	}
+
+	f, err := os.OpenFile(st.usersPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintln(f, userID); err != nil {
+		return false, err
+	}
+	st.users[userID] = true
+	return true, nil
+}
+
+// save appends a job record.
+func (st *jobFile) save(r jobRecord) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	f, err := os.OpenFile(st.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (st *jobFile) scan(fn func(jobRecord) bool) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	f, err := os.Open(st.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var r jobRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return fmt.Errorf("reading %s: %w", st.path, err)
+		}
+		if !fn(r) {
+			break
+		}
+	}
+	return scanner.Err()
+}
+
+// scanNewest reads the whole file, which has no index to go by.
+func (st *jobFile) scanNewest(f jobFilter, fn func(jobRecord) bool) error {
+	var jobs []jobRecord
+	err := st.scan(func(r jobRecord) bool {
+		if f.matches(r) {
+			jobs = append(jobs, r)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	slices.Reverse(jobs)
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].Started.After(jobs[j].Started) })
+	for _, r := range jobs {
+		if !fn(r) {
+			break
+		}
+	}
+	return nil
+}
+
+func (st *jobFile) scanMatching(text string, f jobFilter, fn func(jobRecord) bool) error {
+	return st.scanNewest(f, func(r jobRecord) bool {
+		return !r.contains(text) || fn(r)
+	})
+}
+
+func (st *jobFile) job(id string) (jobRecord, error) {
+	var found *jobRecord
+	err := st.scan(func(r jobRecord) bool {
+		if r.ID == id {
+			found = &r
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return jobRecord{}, err
+	}
+	if found == nil {
+		return jobRecord{}, errJobNotStored
+	}
+	return *found, nil
+}
+
+// since returns the jobs started at or after t.
+func (st *jobStore) since(t time.Time) ([]jobRecord, error) {
+	var jobs []jobRecord
+	err := st.scan(func(r jobRecord) bool {
+		if !r.Started.Before(t) {
+			jobs = append(jobs, r)
+		}
+		return true
+	})
+	return jobs, err
+}
+
+// firstSeenBetween returns the users whose first stored job started in
+// [since, until), in the order they first appeared.
+func (st *jobStore) firstSeenBetween(since, until time.Time) ([]string, error) {
+	first := make(map[string]time.Time)
+	var order []string
+	err := st.scan(func(r jobRecord) bool {
+		if r.UserID == "" {
+			return true
+		}
+		if t, ok := first[r.UserID]; !ok || r.Started.Before(t) {
+			if !ok {
+				order = append(order, r.UserID)
+			}
+			first[r.UserID] = r.Started
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	var users []string
+	for _, user := range order {
+		if t := first[user]; !t.Before(since) && t.Before(until) {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+// recordJob stores a finished job, if a store is configured, and queues
+// it for export.
+func (s *server) recordJob(j *job, result commandResult) {
+	if s.store == nil && s.exporter == nil {
+		return
+	}
+
+	rules := s.cfg.profileFor(j.Cmd.ChannelID).Classification.rules()
+	lines := result.Lines
+	quarantined := len(j.Leaks) > 0
+	if rules.Redact || quarantined {
+		lines = redactLines(lines)
+	}
+	r := jobRecord{
+		ID:        j.ID,
+		TeamID:    j.Cmd.TeamID,
+		ChannelID: j.Cmd.ChannelID,
+		UserID:    j.Cmd.UserID,
+		ThreadTS:  j.Cmd.ThreadTS,
+		Text:      s.displayText(j.Cmd),
+		Lines:     lines,
+		ExitCode:  result.ExitCode,
+		Severity:  j.Severity,
+		Started:   j.Started,
+		Duration:  result.Duration,
+		Private:   rules.PrivateOnly || s.cfg.SensitiveChannels[j.Cmd.ChannelID],
+
+		Quarantined: quarantined,
+	}
+	if s.exporter != nil {
+		if line, err := json.Marshal(r); err == nil {
+			s.exporter.add(exportJobs, line)
+		}
+	}
+	if s.store == nil {
+		return
+	}
+	if err := s.store.save(r); err != nil {
+		fmt.Fprintf(os.Stderr, "Error storing job: %v\n", err)
+	}
+}
+
+// writeJSONFile replaces a file with v as indented JSON, through a
+// temporary file so a crash never leaves it half written.
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// maxSuggestions is how many close matches are listed for an unknown name.
+const maxSuggestions = 3
+
+// metaFlagNames are the meta-flags recognized by parseMetaFlags.
+var metaFlagNames = []string{"--pty", "--stdin", "--file=", "--canvas", "--dm", "--quiet", "--no-watchdog"}
+
+// suggestion is a near miss for a builtin or meta-flag in a command.
+type suggestion struct {
+	Word  string   // the unrecognized word
+	Names []string // closest known names, best first
+
+	start, end int // position of Word in the command text
+}
+
+// apply returns text with the unrecognized word replaced by name.
+func (sg suggestion) apply(text, name string) string {
+	return text[:sg.start] + name + text[sg.end:]
+}
+
+// suggest looks for a misspelled meta-flag or builtin at the start of a
+// command's text. A word close to a builtin name is only reported if the
+// shell does not know it either.
+func (s *server) suggest(ctx context.Context, text string) (suggestion, bool) {
+	pos := 0
+	if strings.HasPrefix(text, "$") {
+		pos = 1
+	}
+	for {
+		for pos < len(text) && unicode.IsSpace(rune(text[pos])) {
+			pos++
+		}
+		end := pos
+		for end < len(text) && !unicode.IsSpace(rune(text[end])) {
+			end++
+		}
+		word := text[pos:end]
+		if word == "" {
+			return suggestion{}, false
+		}
+
+		if strings.HasPrefix(word, "--") {
+			// Only the name of a --flag=value is compared.
+			if i := strings.IndexByte(word, '='); i >= 0 {
+				word, end = word[:i+1], pos+i+1
+			}
+			if contains(metaFlagNames, word) {
+				pos = end
+				for pos < len(text) && !unicode.IsSpace(rune(text[pos])) {
+					pos++
+				}
+				continue
+			}
+			names := closest(word, metaFlagNames)
+			return suggestion{Word: word, Names: names, start: pos, end: end}, len(names) > 0
+		}
+
+		all := s.builtins()
+		if _, ok := all[word]; ok {
+			return suggestion{}, false
+		}
+		names := make([]string, 0, len(all))
+		for name, b := range all {
+			// Builtins that share a name with a shell command, such as
+			// head, are only builtins in special forms.
+			if b.Claims != nil {
+				continue
+			}
+			names = append(names, name)
+		}
+		names = closest(word, names)
+		if len(names) == 0 || shellKnows(ctx, word) {
+			return suggestion{}, false
+		}
+		return suggestion{Word: word, Names: names, start: pos, end: end}, true
+	}
+}
+
+// suggestionMessage renders the reply to a command with a near miss, with a
+// button that runs the command with the closest match when interactivity is
+// enabled.
+func (s *server) suggestionMessage(cmd slashCommand, sg suggestion) interface{} {
+	quoted := make([]string, len(sg.Names))
+	for i, name := range sg.Names {
+		quoted[i] = "`" + name + "`"
+	}
+	kind := "command"
+	if strings.HasPrefix(sg.Word, "--") {
+		kind = "meta-flag"
+	}
+	text := fmt.Sprintf("_unknown %s_ `%s`_; did you mean_ %s_?_", kind, sg.Word, strings.Join(quoted, " _or_ "))
+
+	fixed := sg.apply(cmd.Text, sg.Names[0])
+	if !s.cfg.Interactivity || cmd.DryRun || len(fixed) > maxButtonValue {
+		return ephemeral(text)
+	}
+	return map[string]interface{}{
+		"response_type": "ephemeral",
+		"text":          text,
+		"blocks": []block{
+			sectionBlock(text),
+			actionsBlock(button(actionRerun, "Run "+sg.Names[0], fixed, "primary")),
+		},
+	}
+}
+
+// shellKnows reports whether sh resolves word to a command, builtin or
+// keyword.
+func shellKnows(ctx context.Context, word string) bool {
+	return exec.CommandContext(ctx, "sh", "-c", `command -v "$1" >/dev/null`, "sh", word).Run() == nil
+}
+
+// closest returns up to maxSuggestions names within a small edit distance
+// of word, closest first.
+func closest(word string, names []string) []string {
+	type match struct {
+		name     string
+		distance int
+	}
+	var matches []match
+	for _, name := range names {
+		d := levenshtein(word, name)
+		if d <= 2 && d < len(word) {
+			matches = append(matches, match{name, d})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].name < matches[j].name
+	})
+
+	var closest []string
+	for i := 0; i < len(matches) && i < maxSuggestions; i++ {
+		closest = append(closest, matches[i].name)
+	}
+	return closest
+}
+
+// levenshtein returns the number of single-character insertions, deletions
+// and substitutions needed to turn a into b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "help", 4},
+		{"help", "help", 0},
+		{"hlep", "help", 2},
+		{"hepl", "help", 2},
+		{"hel", "help", 1},
+		{"kitten", "sitting", 3},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	s := newServer(config{})
+
+	tests := []struct {
+		text  string
+		names []string
+		fixed string
+	}{
+		{"$ hlep", []string{"help"}, "$ help"},
+		{"$ --pty hepl me", []string{"help"}, "$ --pty help me"},
+		{"$ --ptty top", []string{"--pty"}, "$ --pty top"},
+		{"$ --fiel=F123 wc -l", []string{"--file="}, "$ --file=F123 wc -l"},
+		{"$ --file=F123 hlp", []string{"help"}, "$ --file=F123 help"},
+		{"$ help", nil, ""},
+		{"$ ls", nil, ""},
+		{"$ set", nil, ""}, // a shell builtin
+	}
+	for _, tt := range tests {
+		sg, ok := s.suggest(context.Background(), tt.text)
+		if !reflect.DeepEqual(sg.Names, tt.names) || ok != (tt.names != nil) {
+			t.Errorf("suggest(%q) = %v %v, want %v", tt.text, sg.Names, ok, tt.names)
+			continue
+		}
+		if ok && sg.apply(tt.text, sg.Names[0]) != tt.fixed {
+			t.Errorf("suggest(%q) fixes to %q, want %q", tt.text, sg.apply(tt.text, sg.Names[0]), tt.fixed)
+		}
+	}
+}
+
+func TestSuggest_ButtonRunsSuggestion(t *testing.T) {
+	ts, messages := messageRecorder(t)
+	s := newServer(config{Interactivity: true})
+
+	var response map[string]interface{}
+	data, _ := json.Marshal(s.respond(context.Background(), slashCommand{Text: "$ hlep", UserID: "U1"}))
+	json.Unmarshal(data, &response)
+	if response["text"] != "_unknown command_ `hlep`_; did you mean_ `help`_?_" {
+		t.Errorf("Unexpected suggestion %q", response["text"])
+	}
+	if value := buttonValue(t, response, actionRerun); value != "$ help" {
+		t.Fatalf("Expected button to run the suggestion, got %q", value)
+	}
+
+	clickButton(t, s, "U2", actionRerun, "$ help", ts.URL)
+	if text, _ := nextResult(t, messages)["text"].(string); !strings.Contains(text, "Builtin commands:") {
+		t.Errorf("Expected help output, got %q", text)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// summaryTop is how many of the longest jobs, users and failures a daily
+// summary lists.
+const summaryTop = 3
+
+// parseClock parses a time of day such as "18:00" into the offset from
+// midnight.
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// nextAt returns the first time after now at the given offset from
+// midnight, in now's location.
+func nextAt(now time.Time, offset time.Duration) time.Time {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	next := midnight.Add(offset)
+	if !next.After(now) {
+		next = midnight.AddDate(0, 0, 1).Add(offset)
+	}
+	return next
+}
+
+// runDailySummary posts a summary of the last day to every channel that
+// ran commands, each day at the configured time.
+func (s *server) runDailySummary() {
+	offset, _ := parseClock(s.cfg.DailySummaryAt)
+	for {
+		next := nextAt(time.Now(), offset)
+		time.Sleep(time.Until(next))
+		s.postDailySummaries(context.Background(), next.AddDate(0, 0, -1))
+	}
+}
+
+// postDailySummaries posts a digest of the jobs started since the given
+// time to each channel they ran in.
+func (s *server) postDailySummaries(ctx context.Context, since time.Time) {
+	jobs, err := s.store.since(since)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading jobs for summary: %v\n", err)
+		return
+	}
+
+	byChannel := make(map[string][]jobRecord)
+	for _, j := range jobs {
+		if j.ChannelID != "" {
+			byChannel[j.ChannelID] = append(byChannel[j.ChannelID], j)
+		}
+	}
+	for channel, jobs := range byChannel {
+		params := url.Values{"channel": {channel}, "text": {s.formatSummary(jobs)}}
+		if err := s.slack.call(ctx, "chat.postMessage", params, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Error posting summary to %s: %v\n", channel, err)
+		}
+	}
+}
+
+// formatSummary renders a compact digest of a channel's jobs.
+func (s *server) formatSummary(jobs []jobRecord) string {
+	var failures []jobRecord
+	users := make(map[string]int)
+	for _, j := range jobs {
+		if j.ExitCode != 0 {
+			failures = append(failures, j)
+		}
+		users[j.UserID]++
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*Daily summary:* %d commands, %d failed", len(jobs), len(failures))
+
+	longest := append([]jobRecord(nil), jobs...)
+	sort.SliceStable(longest, func(a, b int) bool { return longest[a].Duration > longest[b].Duration })
+	b.WriteString("\n*Longest:* ")
+	s.writeSummaryJobs(&b, longest, func(j jobRecord) string { return j.Duration.Round(time.Millisecond).String() })
+
+	top := make([]string, 0, len(users))
+	for user := range users {
+		top = append(top, user)
+	}
+	sort.Slice(top, func(a, b int) bool {
+		if users[top[a]] != users[top[b]] {
+			return users[top[a]] > users[top[b]]
+		}
+		return top[a] < top[b]
+	})
+	b.WriteString("\n*Top users:* ")
+	for i, user := range top {
+		if i == summaryTop {
+			break
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		name := "unknown"
+		if user != "" {
+			name = "<@" + user + ">"
+		}
+		fmt.Fprintf(&b, "%s (%d)", name, users[user])
+	}
+
+	if len(failures) > 0 {
+		b.WriteString("\n*Failures:* ")
+		s.writeSummaryJobs(&b, failures, func(j jobRecord) string { return fmt.Sprintf("exit %d", j.ExitCode) })
+	}
+	return b.String()
+}
+
+// writeSummaryJobs lists the first jobs with a detail and a transcript link
+// where one can be shared. Commands whose output was private are not named.
+func (s *server) writeSummaryJobs(b *strings.Builder, jobs []jobRecord, detail func(jobRecord) string) {
+	for i, j := range jobs {
+		if i == summaryTop {
+			break
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if j.Private {
+			fmt.Fprintf(b, "_private command_ (%s)", detail(j))
+			continue
+		}
+		fmt.Fprintf(b, "`%s` (%s)", j.Text, detail(j))
+		if link := s.transcriptURL(j.ID); link != "" {
+			fmt.Fprintf(b, " <%s|transcript>", link)
+		}
+	}
+}
+
+// transcriptURL returns the public link to a job's transcript, or "" if
+// no public URL is configured.
+func (s *server) transcriptURL(id string) string {
+	if s.cfg.PublicURL == "" {
+		return ""
+	}
+	paths := s.routeTable.resolve(s.cfg.Paths)
+	return strings.TrimSuffix(s.cfg.PublicURL, "/") + paths.Admin + "/transcripts/" + id
+}
+
+// handleTranscript serves a stored job's command and output as text, to
+// callers who may see the job. Others get a 404, as for a missing job.
+func (s *server) handleTranscript(w http.ResponseWriter, r *http.Request) {
+	v, err := s.apiViewer(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	j, err := s.store.job(id)
+	if err != nil || !s.canView(v, j) {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%s\n", j.Text)
+	for _, line := range j.Lines {
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintf(w, "\n%s, %s, %s\n", translateExitCode(j.ExitCode), j.Duration.Round(time.Millisecond), j.Started.UTC().Format(time.RFC3339))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNextAt(t *testing.T) {
+	now := time.Date(2025, 3, 1, 17, 30, 0, 0, time.UTC)
+
+	if got := nextAt(now, 18*time.Hour); !got.Equal(time.Date(2025, 3, 1, 18, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected later today, got %s", got)
+	}
+	if got := nextAt(now, 9*time.Hour); !got.Equal(time.Date(2025, 3, 2, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected tomorrow, got %s", got)
+	}
+}
+
+func TestDailySummary(t *testing.T) {
+	f := newFakeSlack(t)
+	cfg := f.config()
+	cfg.DataDir = t.TempDir()
+	cfg.PublicURL = "https://shell.example.com/"
+	cfg.SensitiveChannels = map[string]bool{"C2": true}
+	s := newServer(cfg)
+
+	ctx := context.Background()
+	start := time.Now()
+	s.handleCommandExecution(ctx, slashCommand{Text: "$ sleep 0.2", UserID: "U1", ChannelID: "C1"})
+	s.handleCommandExecution(ctx, slashCommand{Text: "$ false", UserID: "U2", ChannelID: "C1"})
+	s.handleCommandExecution(ctx, slashCommand{Text: "$ echo hi", UserID: "U1", ChannelID: "C1"})
+	s.handleCommandExecution(ctx, slashCommand{Text: "$ cat /etc/hostname", UserID: "U1", ChannelID: "C2"})
+
+	s.postDailySummaries(ctx, start)
+
+	calls := f.callsTo("chat.postMessage")
+	if len(calls) != 2 {
+		t.Fatalf("Expected a summary per channel, got %d", len(calls))
+	}
+	texts := map[string]string{}
+	for _, c := range calls {
+		texts[c.Params.Get("channel")] = c.Params.Get("text")
+	}
+
+	c1 := texts["C1"]
+	for _, want := range []string{"3 commands, 1 failed", "*Longest:* `$ sleep 0.2`", "<@U1> (2), <@U2> (1)", "`$ false` (exit 1)", "https://shell.example.com/debug/transcripts/"} {
+		if !strings.Contains(c1, want) {
+			t.Errorf("Expected summary to contain %q, got %q", want, c1)
+		}
+	}
+	if c2 := texts["C2"]; strings.Contains(c2, "hostname") || strings.Contains(c2, "transcript") {
+		t.Errorf("Expected private commands to be hidden, got %q", c2)
+	}
+}
+
+func TestHandleTranscript(t *testing.T) {
+	s := newServer(config{DataDir: t.TempDir(), SensitiveChannels: map[string]bool{"C2": true}, APITokens: map[string]string{"tok-u1": "U1"}})
+	s.handleCommandExecution(context.Background(), slashCommand{Text: "$ echo hello", UserID: "U1", ChannelID: "C1"})
+	s.handleCommandExecution(context.Background(), slashCommand{Text: "$ echo private", UserID: "U2", ChannelID: "C2"})
+
+	jobs, err := s.store.since(time.Time{})
+	if err != nil || len(jobs) != 2 {
+		t.Fatalf("Expected two stored jobs, got %d (%v)", len(jobs), err)
+	}
+	get := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/debug/transcripts/"+id, nil)
+		req.Header.Set("Authorization", "Bearer tok-u1")
+		w := httptest.NewRecorder()
+		s.routes().ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get(jobs[0].ID); w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), "$ echo hello\nhello\n\nsuccess") {
+		t.Errorf("Expected transcript, got %d %q", w.Code, w.Body.String())
+	}
+	if w := get(jobs[1].ID); w.Code != http.StatusNotFound {
+		t.Errorf("Expected someone else's private transcript to be hidden, got %d", w.Code)
+	}
+}
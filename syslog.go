@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// syslogPriority is facility auth (4) at severity notice (5), which is
+// where SIEM pipelines expect to find who ran what.
+const syslogPriority = 4*8 + 5
+
+// syslogQueueSize bounds the events waiting to be sent, so a slow or
+// unreachable syslog server never holds up commands.
+const syslogQueueSize = 1024
+
+// localSyslogSockets are tried in order for AUDIT_SYSLOG=local.
+var localSyslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// syslogSink sends audit events to syslog, locally or to a remote server,
+// with the event as JSON in the message so fields can be extracted.
+type syslogSink struct {
+	network, addr string // "" network for the local socket
+	hostname      string
+
+	queue chan []byte
+	conn  net.Conn // used by the sending goroutine only
+}
+
+// parseSyslogTarget parses AUDIT_SYSLOG: "local", or a udp://, tcp:// or
+// unix:// URL.
+func parseSyslogTarget(target string) (network, addr string, err error) {
+	if target == "local" {
+		return "", "", nil
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", "", err
+	}
+	switch u.Scheme {
+	case "udp", "tcp":
+		if u.Port() == "" {
+			return "", "", fmt.Errorf("%s: missing port", target)
+		}
+		return u.Scheme, u.Host, nil
+	case "unix":
+		return "unixgram", u.Path, nil
+	}
+	return "", "", fmt.Errorf("%s: want local, udp://, tcp:// or unix://", target)
+}
+
+// newSyslogSink starts sending to the target, which must have been
+// checked with parseSyslogTarget.
+func newSyslogSink(target string) *syslogSink {
+	network, addr, _ := parseSyslogTarget(target)
+	hostname, _ := os.Hostname()
+	sink := &syslogSink{network: network, addr: addr, hostname: hostname, queue: make(chan []byte, syslogQueueSize)}
+	go sink.run()
+	return sink
+}
+
+// send queues an event, dropping it if the queue is full. The audit table
+// still has it.
+func (sink *syslogSink) send(event []byte) {
+	select {
+	case sink.queue <- event:
+	default:
+		fmt.Fprintf(os.Stderr, "Error sending audit event to syslog: queue full\n")
+	}
+}
+
+func (sink *syslogSink) run() {
+	for event := range sink.queue {
+		msg := sink.format(event, time.Now())
+		// A broken connection is redialed once per event.
+		for attempt := 0; attempt < 2; attempt++ {
+			if sink.conn == nil {
+				var err error
+				if sink.conn, err = sink.dial(); err != nil {
+					fmt.Fprintf(os.Stderr, "Error connecting to syslog: %v\n", err)
+					break
+				}
+			}
+			if _, err := sink.conn.Write(msg); err == nil {
+				break
+			} else if attempt == 1 {
+				fmt.Fprintf(os.Stderr, "Error sending audit event to syslog: %v\n", err)
+			}
+			sink.conn.Close()
+			sink.conn = nil
+		}
+	}
+}
+
+func (sink *syslogSink) dial() (net.Conn, error) {
+	if sink.network != "" {
+		return net.DialTimeout(sink.network, sink.addr, 5*time.Second)
+	}
+	for _, path := range localSyslogSockets {
+		for _, network := range []string{"unixgram", "unix"} {
+			if conn, err := net.Dial(network, path); err == nil {
+				return conn, nil
+			}
+		}
+	}
+	return nil, errors.New("no local syslog socket")
+}
+
+// format renders an event as a syslog message: the traditional format
+// for the local socket, which every local daemon reads, and RFC 5424 for
+// remote servers. Messages over TCP are newline framed.
+func (sink *syslogSink) format(event []byte, t time.Time) []byte {
+	var msg string
+	if sink.network == "" || sink.network == "unixgram" {
+		msg = fmt.Sprintf("<%d>%s http-shell[%d]: audit %s", syslogPriority, t.Format(time.Stamp), os.Getpid(), event)
+	} else {
+		msg = fmt.Sprintf("<%d>1 %s %s http-shell %d audit - %s", syslogPriority, t.UTC().Format(time.RFC3339Nano), sink.hostname, os.Getpid(), event)
+	}
+	if sink.network == "tcp" {
+		msg = strings.TrimRight(msg, "\n") + "\n"
+	}
+	return []byte(msg)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditSyslog_Remote(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on UDP: %v", err)
+	}
+	defer conn.Close()
+
+	s := newServer(config{AuditSyslog: "udp://" + conn.LocalAddr().String()})
+	s.auditLog.record(auditEvent{Action: auditCommandExecuted, UserID: "U1", Command: "uptime"})
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 4096)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Expected a syslog message, got %v", err)
+	}
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<37>1 ") || !strings.Contains(msg, " http-shell ") || !strings.Contains(msg, `audit - {"time":`) || !strings.Contains(msg, `"user_id":"U1","command":"uptime"`) {
+		t.Errorf("Expected an RFC 5424 message with the event as JSON, got %q", msg)
+	}
+}
+
+func TestParseSyslogTarget(t *testing.T) {
+	for target, want := range map[string]string{
+		"local":                  " ",
+		"udp://10.0.0.1:514":     "udp 10.0.0.1:514",
+		"tcp://siem:6514":        "tcp siem:6514",
+		"unix:///run/syslog.sck": "unixgram /run/syslog.sck",
+	} {
+		network, addr, err := parseSyslogTarget(target)
+		if err != nil || network+" "+addr != want {
+			t.Errorf("%s: got %q %q, %v", target, network, addr, err)
+		}
+	}
+	for _, target := range []string{"udp://siem", "http://siem:514", "syslog"} {
+		if _, _, err := parseSyslogTarget(target); err == nil {
+			t.Errorf("%s: expected an error", target)
+		}
+	}
+}
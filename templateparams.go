@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// callbackTemplateParams identifies the modal that prompts for a
+// template's parameters.
+const callbackTemplateParams = "template_params"
+
+// templatePlaceholder is a parameter in a template's command.
+var templatePlaceholder = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// defaultParamPattern is what a parameter without options or a pattern
+// accepts: one word, since arguments are split on spaces.
+const defaultParamPattern = `^[A-Za-z0-9_.:/@=+-]+$`
+
+// templateParam is a value a template's command is completed with.
+type templateParam struct {
+	Name    string   `json:"name"`
+	Label   string   `json:"label"`
+	Options []string `json:"options"`
+	Pattern string   `json:"pattern"`
+
+	re *regexp.Regexp
+}
+
+// compileParams checks that the command's placeholders and the params
+// match, and compiles their patterns.
+func (t *template) compileParams() error {
+	declared := make(map[string]bool)
+	for i := range t.Params {
+		p := &t.Params[i]
+		if p.Name == "" || declared[p.Name] {
+			return fmt.Errorf("param %d: missing or repeated name", i+1)
+		}
+		declared[p.Name] = true
+		if !strings.Contains(t.Command, "{"+p.Name+"}") {
+			return fmt.Errorf("param %s is not used in the command", p.Name)
+		}
+		pattern := p.Pattern
+		if pattern == "" {
+			pattern = defaultParamPattern
+		}
+		var err error
+		if p.re, err = regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("param %s: %w", p.Name, err)
+		}
+	}
+	if len(t.Params) == 0 {
+		// Commands without params may use braces for other things, as
+		// awk '{print}' does.
+		return nil
+	}
+	for _, m := range templatePlaceholder.FindAllStringSubmatch(t.Command, -1) {
+		if !declared[m[1]] {
+			return fmt.Errorf("{%s} is not a param", m[1])
+		}
+	}
+	return nil
+}
+
+// usage shows the template's name and parameters.
+func (t template) usage() string {
+	usage := t.Name
+	for _, p := range t.Params {
+		usage += " <" + p.Name + ">"
+	}
+	return usage
+}
+
+// check validates a value for the parameter.
+func (p templateParam) check(value string) error {
+	if len(p.Options) > 0 {
+		if !contains(p.Options, value) {
+			return fmt.Errorf("%s must be one of %s", p.Name, strings.Join(p.Options, ", "))
+		}
+		return nil
+	}
+	if p.re != nil && !p.re.MatchString(value) {
+		return fmt.Errorf("%s: %q is not allowed", p.Name, value)
+	}
+	return nil
+}
+
+// render completes the template's command with arguments, one per
+// parameter in order. Values are quoted for the shell.
+func (t template) render(args []string) (string, error) {
+	if len(args) != len(t.Params) {
+		if len(t.Params) == 0 {
+			return "", fmt.Errorf("%s takes no arguments", t.Name)
+		}
+		return "", fmt.Errorf("usage: %s", t.usage())
+	}
+	values := make(map[string]string, len(args))
+	for i, p := range t.Params {
+		if err := p.check(args[i]); err != nil {
+			return "", err
+		}
+		values[p.Name] = shellQuote(args[i])
+	}
+	return templatePlaceholder.ReplaceAllStringFunc(t.Command, func(m string) string {
+		return values[m[1:len(m)-1]]
+	}), nil
+}
+
+// shellQuote quotes a value as one shell word.
+func shellQuote(v string) string {
+	return "'" + strings.ReplaceAll(v, "'", `'\''`) + "'"
+}
+
+// promptableTemplate returns the template a command runs if it is a
+// template with parameters run without arguments.
+func (s *server) promptableTemplate(command string) (template, bool) {
+	b, args, ok := s.lookupBuiltin(command)
+	if !ok || b.Template == nil || len(b.Template.Params) == 0 || len(args) > 0 {
+		return template{}, false
+	}
+	return *b.Template, true
+}
+
+// promptTemplate opens a modal asking for a template's parameters. Without
+// a trigger_id, a token or interactivity the usage is shown instead.
+func (s *server) promptTemplate(ctx context.Context, cmd slashCommand, t template) map[string]string {
+	usage := failure(codeBadRequest, fmt.Sprintf("_usage:_ `%s`", t.usage()))
+	if !s.cfg.Interactivity || s.slack == nil || cmd.TriggerID == "" {
+		return usage
+	}
+
+	blocks := make([]block, 0, len(t.Params))
+	for _, p := range t.Params {
+		label := p.Label
+		if label == "" {
+			label = p.Name
+		}
+		element := block{"type": "plain_text_input", "action_id": p.Name}
+		if len(p.Options) > 0 {
+			options := make([]block, len(p.Options))
+			for i, o := range p.Options {
+				options[i] = block{"text": plainText(o), "value": o}
+			}
+			element = block{"type": "static_select", "action_id": p.Name, "options": options}
+		}
+		blocks = append(blocks, block{"type": "input", "block_id": p.Name, "label": plainText(label), "element": element})
+	}
+
+	pending := s.templatePrompts.add(cmd, t.Name, "")
+	view, err := json.Marshal(block{
+		"type":             "modal",
+		"callback_id":      callbackTemplateParams,
+		"private_metadata": pending.ID,
+		"title":            plainText(truncateRunes(t.Name, 24)),
+		"submit":           plainText("Run"),
+		"close":            plainText("Cancel"),
+		"blocks":           blocks,
+	})
+	if err != nil {
+		return usage
+	}
+	if err := s.slack.call(ctx, "views.open", url.Values{"trigger_id": {cmd.TriggerID}, "view": {string(view)}}, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening template prompt: %v\n", err)
+		return usage
+	}
+	return ephemeral("_waiting for parameters_")
+}
+
+// submitTemplate runs a template with the parameters submitted in its
+// modal, as the user who ran it, and posts the result like a confirmed
+// command's. Invalid values are returned by block ID, to be shown in the
+// modal, which then stays open.
+func (s *server) submitTemplate(p interactionPayload) map[string]string {
+	pending, ok := s.templatePrompts.peek(p.View.PrivateMetadata, p.User.ID)
+	if !ok {
+		return nil
+	}
+	b, _, ok := s.lookupBuiltin(pending.Command)
+	if !ok || b.Template == nil {
+		return nil
+	}
+	t := *b.Template
+
+	args := make([]string, len(t.Params))
+	errs := make(map[string]string)
+	for i, param := range t.Params {
+		v := p.View.State.Values[param.Name][param.Name]
+		args[i] = strings.TrimSpace(v.Value)
+		if v.SelectedOption.Value != "" {
+			args[i] = v.SelectedOption.Value
+		}
+		if err := param.check(args[i]); err != nil {
+			errs[param.Name] = err.Error()
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if _, err := s.templatePrompts.take(pending.ID, p.User.ID); err != nil {
+		return nil
+	}
+	cmd := pending.Cmd
+	cmd.Text = "$ " + t.Name + " " + strings.Join(args, " ")
+	cmd.TriggerID = ""
+	go func() {
+		ctx := context.Background()
+		if cmd.FromMessage {
+			s.postInThread(ctx, cmd, s.handleCommandExecution(ctx, cmd))
+			return
+		}
+		message := s.respond(ctx, cmd)
+		if cmd.ResponseURL == "" {
+			return
+		}
+		if err := postWebhook(ctx, s.client, cmd.ResponseURL, message); err != nil {
+			fmt.Fprintf(os.Stderr, "Error posting template result: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// truncateRunes shortens s to at most n runes, as for modal titles.
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
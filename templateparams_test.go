@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// paramTemplates loads a template with a select and a text parameter.
+func paramTemplates(t *testing.T) []template {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "templates.json")
+	os.WriteFile(path, []byte(`[{
+		"name": "restart", "summary": "restart a service",
+		"command": "echo restarting {service} on {host}",
+		"params": [
+			{"name": "service", "options": ["api", "worker"]},
+			{"name": "host", "label": "Host", "pattern": "^web[0-9]+$"}
+		]
+	}]`), 0o600)
+	templates, err := loadTemplates(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return templates
+}
+
+func TestTemplate_RenderQuotesAndChecks(t *testing.T) {
+	tmpl := paramTemplates(t)[0]
+
+	got, err := tmpl.render([]string{"api", "web1"})
+	if err != nil || got != "echo restarting 'api' on 'web1'" {
+		t.Errorf("Expected quoted values, got %q, %v", got, err)
+	}
+	for _, args := range [][]string{{"db", "web1"}, {"api", "web1;id"}, {"api"}} {
+		if _, err := tmpl.render(args); err == nil {
+			t.Errorf("%q: expected an error", args)
+		}
+	}
+	if got := shellQuote("it's"); got != `'it'\''s'` {
+		t.Errorf("Expected the quote escaped, got %s", got)
+	}
+}
+
+func TestLoadTemplates_InvalidParams(t *testing.T) {
+	for name, body := range map[string]string{
+		"undeclared":  `[{"name": "x", "command": "echo {a} {b}", "params": [{"name": "a"}]}]`,
+		"unused":      `[{"name": "x", "command": "echo", "params": [{"name": "a"}]}]`,
+		"repeated":    `[{"name": "x", "command": "echo {a}", "params": [{"name": "a"}, {"name": "a"}]}]`,
+		"bad pattern": `[{"name": "x", "command": "echo {a}", "params": [{"name": "a", "pattern": "("}]}]`,
+	} {
+		path := filepath.Join(t.TempDir(), "templates.json")
+		os.WriteFile(path, []byte(body), 0o600)
+		if _, err := loadTemplates(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestTemplate_RunWithArguments(t *testing.T) {
+	s := newServer(config{Templates: paramTemplates(t)})
+
+	got := s.handleCommandExecution(context.Background(), slashCommand{Text: "$ restart worker web2", UserID: "U1"})["text"]
+	if !strings.Contains(got, "restarting worker on web2") {
+		t.Errorf("Expected the rendered command to run, got %q", got)
+	}
+	got = s.handleCommandExecution(context.Background(), slashCommand{Text: "$ restart", UserID: "U1"})["text"]
+	if !strings.Contains(got, "restart <service> <host>") {
+		t.Errorf("Expected the usage without a trigger_id, got %q", got)
+	}
+}
+
+// submitParams posts a template modal's submission and returns the reply.
+func submitParams(t *testing.T, s *server, metadata, service, host string) map[string]interface{} {
+	t.Helper()
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"type": "view_submission",
+		"user": map[string]string{"id": "U1"},
+		"view": map[string]interface{}{
+			"callback_id":      callbackTemplateParams,
+			"private_metadata": metadata,
+			"state": map[string]interface{}{"values": map[string]interface{}{
+				"service": map[string]interface{}{"service": map[string]interface{}{"selected_option": map[string]string{"value": service}}},
+				"host":    map[string]interface{}{"host": map[string]string{"value": host}},
+			}},
+		},
+	})
+	req := httptest.NewRequest("POST", "/slack/interactive", strings.NewReader(url.Values{"payload": {string(payload)}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.routes().ServeHTTP(w, req)
+
+	var reply map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &reply)
+	return reply
+}
+
+func TestTemplate_PromptsInModal(t *testing.T) {
+	f := newFakeSlack(t)
+	ts, messages := messageRecorder(t)
+	cfg := f.config()
+	cfg.Interactivity = true
+	cfg.Templates = paramTemplates(t)
+	s := newServer(cfg)
+
+	cmd := slashCommand{Text: "$ restart", UserID: "U1", ResponseURL: ts.URL, TriggerID: "T123"}
+	if got := s.handleCommandExecution(context.Background(), cmd)["text"]; got != "_waiting for parameters_" {
+		t.Fatalf("Expected the command to wait for parameters, got %q", got)
+	}
+	calls := f.callsTo("views.open")
+	if len(calls) != 1 {
+		t.Fatalf("Expected a modal, got %v", calls)
+	}
+	var view struct {
+		PrivateMetadata string  `json:"private_metadata"`
+		Blocks          []block `json:"blocks"`
+	}
+	if err := json.Unmarshal([]byte(calls[0].Params.Get("view")), &view); err != nil {
+		t.Fatal(err)
+	}
+	if len(view.Blocks) != 2 || view.Blocks[0]["element"].(map[string]interface{})["type"] != "static_select" || view.Blocks[1]["element"].(map[string]interface{})["type"] != "plain_text_input" {
+		t.Fatalf("Expected a select and a text input, got %v", view.Blocks)
+	}
+
+	reply := submitParams(t, s, view.PrivateMetadata, "api", "db1")
+	if reply["response_action"] != "errors" || reply["errors"].(map[string]interface{})["host"] == nil {
+		t.Fatalf("Expected the bad host reported in the modal, got %v", reply)
+	}
+	if reply := submitParams(t, s, view.PrivateMetadata, "api", "web1"); reply != nil {
+		t.Fatalf("Expected the modal closed, got %v", reply)
+	}
+	if m := nextResult(t, messages); !strings.Contains(m["text"].(string), "restarting api on web1") {
+		t.Errorf("Expected the rendered command's output, got %v", m)
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Templates are curated commands defined in the JSON file named by
+// TEMPLATES_FILE. Each becomes a builtin that runs the command through the
+// shell and passes its output through the template's post-processors in
+// order:
+//
+//	[{"name": "disk", "summary": "disk usage", "command": "df -h",
+//	  "post": [{"grep": "^/dev/"}, {"regex": "(\\S+)\\s+\\S+\\s+\\S+\\s+\\S+\\s+(\\d+%)"}]}]
+//
+// A command may take parameters, written {name} and listed in "params"
+// with an optional label, a list of options or a pattern values must
+// match. They are given as arguments in order or, when the template is
+// run without any, in a modal:
+//
+//	{"name": "restart", "command": "systemctl restart {service}",
+//	  "params": [{"name": "service", "options": ["nginx", "redis"]}]}
+//
+// A post-processor sets exactly one of:
+//
+//	regex   keep matching lines; with groups, only the groups, tab separated
+//	jq      a path such as .items[].metadata.name, applied to JSON output
+//	grep    keep lines matching a regular expression
+//	grep_v  drop lines matching a regular expression
+//	head    keep the first N lines
+//	tail    keep the last N lines
+//	wasm    a plugin implementing the "postprocess" hook
+type template struct {
+	Name    string          `json:"name"`
+	Summary string          `json:"summary"`
+	Command string          `json:"command"`
+	Params  []templateParam `json:"params"`
+	Post    []postProcessor `json:"post"`
+}
+
+type postProcessor struct {
+	Regex string `json:"regex,omitempty"`
+	JQ    string `json:"jq,omitempty"`
+	Grep  string `json:"grep,omitempty"`
+	GrepV string `json:"grep_v,omitempty"`
+	Head  int    `json:"head,omitempty"`
+	Tail  int    `json:"tail,omitempty"`
+	WASM  string `json:"wasm,omitempty"`
+
+	re   *regexp.Regexp
+	path []jqStep
+}
+
+// hookPostprocess is the plugin hook for template post-processors. Unlike
+// filter plugins, which see all output, these run only where a template
+// names them.
+const hookPostprocess = "postprocess"
+
+// loadTemplates reads templates from a JSON array and checks their
+// post-processors.
+func loadTemplates(path string) ([]template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var templates []template
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for i, t := range templates {
+		if t.Name == "" || t.Command == "" {
+			return nil, fmt.Errorf("template %d: name and command are required", i+1)
+		}
+		if err := templates[i].compileParams(); err != nil {
+			return nil, fmt.Errorf("template %s: %w", t.Name, err)
+		}
+		for j := range t.Post {
+			if err := t.Post[j].compile(); err != nil {
+				return nil, fmt.Errorf("template %s: post-processor %d: %w", t.Name, j+1, err)
+			}
+		}
+	}
+	return templates, nil
+}
+
+func (p *postProcessor) compile() error {
+	set := 0
+	for _, ok := range []bool{p.Regex != "", p.JQ != "", p.Grep != "", p.GrepV != "", p.Head > 0, p.Tail > 0, p.WASM != ""} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.New("exactly one of regex, jq, grep, grep_v, head, tail and wasm must be set")
+	}
+
+	var err error
+	switch {
+	case p.Regex != "":
+		p.re, err = regexp.Compile(p.Regex)
+	case p.Grep != "":
+		p.re, err = regexp.Compile(p.Grep)
+	case p.GrepV != "":
+		p.re, err = regexp.Compile(p.GrepV)
+	case p.JQ != "":
+		p.path, err = parseJQPath(p.JQ)
+	}
+	return err
+}
+
+// apply runs the post-processor on output lines.
+func (p *postProcessor) apply(ctx context.Context, s *server, command string, result commandResult) ([]string, error) {
+	lines := result.Lines
+	switch {
+	case p.Regex != "":
+		var out []string
+		for _, line := range lines {
+			m := p.re.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			if len(m) > 1 {
+				out = append(out, strings.Join(m[1:], "\t"))
+			} else {
+				out = append(out, m[0])
+			}
+		}
+		return out, nil
+	case p.Grep != "", p.GrepV != "":
+		keep := p.Grep != ""
+		var out []string
+		for _, line := range lines {
+			if p.re.MatchString(line) == keep {
+				out = append(out, line)
+			}
+		}
+		return out, nil
+	case p.Head > 0:
+		return lines[:min(p.Head, len(lines))], nil
+	case p.Tail > 0:
+		return lines[len(lines)-min(p.Tail, len(lines)):], nil
+	case p.JQ != "":
+		return evalJQPath(p.path, strings.Join(lines, "\n"))
+	case p.WASM != "":
+		if s.plugins == nil {
+			return nil, fmt.Errorf("plugin %s: no plugins are loaded", p.WASM)
+		}
+		resp, err := s.plugins.callNamed(ctx, p.WASM, hookPostprocess, pluginRequest{
+			Hook:     hookPostprocess,
+			Command:  command,
+			Output:   strings.Join(lines, "\n"),
+			ExitCode: result.ExitCode,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return cleanOutput(resp.Output), nil
+	}
+	return lines, nil
+}
+
+// builtin returns the builtin that runs the template.
+func (t template) builtin() builtin {
+	return builtin{
+		Name:     t.Name,
+		Usage:    t.usage(),
+		Summary:  t.Summary,
+		Template: &t,
+		Run: func(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+			startTime := time.Now()
+			command, err := t.render(args)
+			if err != nil {
+				return commandResult{Lines: []string{err.Error()}, ExitCode: 2, Duration: time.Since(startTime)}
+			}
+
+			result := runCommand(ctx, command, runOptions{})
+			for i := range t.Post {
+				lines, err := t.Post[i].apply(ctx, s, command, result)
+				if err != nil {
+					// The unprocessed output is more useful than nothing.
+					result.Lines = append(result.Lines, fmt.Sprintf("(post-processor %d failed: %v)", i+1, err))
+					break
+				}
+				result.Lines = lines
+			}
+			result.Duration = time.Since(startTime)
+			return result
+		},
+	}
+}
+
+// jqStep is one step of a jq path: a field, an index, or every element.
+type jqStep struct {
+	Field string
+	Index *int
+	Each  bool
+}
+
+// parseJQPath parses the subset of jq used by templates: paths made of
+// .field, ."quoted field", [N] and [] steps, such as .items[].name. A
+// lone "." is the whole document.
+func parseJQPath(expr string) ([]jqStep, error) {
+	if !strings.HasPrefix(expr, ".") {
+		return nil, fmt.Errorf("jq path %q must start with '.'", expr)
+	}
+	var steps []jqStep
+	rest := expr
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "[]"):
+			steps = append(steps, jqStep{Each: true})
+			rest = rest[2:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("jq path %q: missing ']'", expr)
+			}
+			n, err := strconv.Atoi(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("jq path %q: bad index %q", expr, rest[1:end])
+			}
+			steps = append(steps, jqStep{Index: &n})
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, `."`):
+			end := strings.IndexByte(rest[2:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("jq path %q: unterminated field name", expr)
+			}
+			steps = append(steps, jqStep{Field: rest[2 : 2+end]})
+			rest = rest[3+end:]
+		case strings.HasPrefix(rest, "."):
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			if field := rest[1 : 1+end]; field != "" {
+				steps = append(steps, jqStep{Field: field})
+			}
+			rest = rest[1+end:]
+		default:
+			return nil, fmt.Errorf("jq path %q: unexpected %q", expr, rest)
+		}
+	}
+	return steps, nil
+}
+
+// evalJQPath applies a path to each JSON value in input, which may hold
+// several, as in JSON lines. Strings are printed raw, like jq -r, and
+// other values as compact JSON.
+func evalJQPath(steps []jqStep, input string) ([]string, error) {
+	dec := json.NewDecoder(strings.NewReader(input))
+	dec.UseNumber()
+
+	var out []string
+	for {
+		var doc interface{}
+		if err := dec.Decode(&doc); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("output is not JSON: %w", err)
+		}
+
+		values := []interface{}{doc}
+		for _, step := range steps {
+			var next []interface{}
+			for _, v := range values {
+				switch {
+				case step.Each:
+					switch v := v.(type) {
+					case []interface{}:
+						next = append(next, v...)
+					case map[string]interface{}:
+						keys := make([]string, 0, len(v))
+						for k := range v {
+							keys = append(keys, k)
+						}
+						sort.Strings(keys)
+						for _, k := range keys {
+							next = append(next, v[k])
+						}
+					default:
+						return nil, fmt.Errorf("cannot iterate over %s", jsonType(v))
+					}
+				case step.Index != nil:
+					a, ok := v.([]interface{})
+					if !ok && v != nil {
+						return nil, fmt.Errorf("cannot index %s with a number", jsonType(v))
+					}
+					i := *step.Index
+					if i < 0 {
+						i += len(a)
+					}
+					if i >= 0 && i < len(a) {
+						next = append(next, a[i])
+					} else {
+						next = append(next, nil)
+					}
+				default:
+					m, ok := v.(map[string]interface{})
+					if !ok && v != nil {
+						return nil, fmt.Errorf("cannot index %s with %q", jsonType(v), step.Field)
+					}
+					next = append(next, m[step.Field])
+				}
+			}
+			values = next
+		}
+
+		for _, v := range values {
+			if str, ok := v.(string); ok {
+				out = append(out, strings.Split(str, "\n")...)
+				continue
+			}
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			enc.Encode(v)
+			out = append(out, strings.TrimSuffix(buf.String(), "\n"))
+		}
+	}
+	return out, nil
+}
+
+// jsonType names the JSON type of a decoded value for error messages.
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return "null"
+}
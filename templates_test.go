@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHandleCommand_TemplatePostProcessors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "templates.json")
+	os.WriteFile(path, []byte(`[{
+		"name": "pods", "summary": "pod names",
+		"command": "printf '{\"items\":[{\"name\":\"api-1\"},{\"name\":\"db-1\"},{\"name\":\"api-2\"}]}'",
+		"post": [{"jq": ".items[].name"}, {"grep": "^api-"}, {"regex": "-(\\d+)$"}, {"head": 1}]
+	}]`), 0o600)
+	templates, err := loadTemplates(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer(config{Templates: templates})
+
+	data := url.Values{}
+	data.Set("text", "$ pods")
+
+	response := postCommand(t, s, data)
+
+	if !strings.Contains(response["text"], "$ pods\n1```") {
+		t.Errorf("Expected only the first api pod number, got %q", response["text"])
+	}
+}
+
+func TestLoadTemplates_Invalid(t *testing.T) {
+	for name, body := range map[string]string{
+		"no command":   `[{"name": "x"}]`,
+		"two steps":    `[{"name": "x", "command": "true", "post": [{"grep": "a", "head": 1}]}]`,
+		"bad regex":    `[{"name": "x", "command": "true", "post": [{"regex": "("}]}]`,
+		"bad jq":       `[{"name": "x", "command": "true", "post": [{"jq": "items"}]}]`,
+		"empty filter": `[{"name": "x", "command": "true", "post": [{}]}]`,
+	} {
+		path := filepath.Join(t.TempDir(), "templates.json")
+		os.WriteFile(path, []byte(body), 0o600)
+		if _, err := loadTemplates(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestEvalJQPath(t *testing.T) {
+	for _, tc := range []struct {
+		path, input string
+		want        []string
+	}{
+		{".", `{"a":1}`, []string{`{"a":1}`}},
+		{".a.b", `{"a":{"b":"x"}}`, []string{"x"}},
+		{".items[1]", `{"items":[1,2,3]}`, []string{"2"}},
+		{".items[-1]", `{"items":[1,2,3]}`, []string{"3"}},
+		{".[]", `{"b":2,"a":1}`, []string{"1", "2"}},
+		{`."x-y"[]`, `{"x-y":["p","q"]}`, []string{"p", "q"}},
+		{".missing", `{}`, []string{"null"}},
+		{".n", "{\"n\":1}\n{\"n\":2}\n", []string{"1", "2"}},
+	} {
+		steps, err := parseJQPath(tc.path)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.path, err)
+		}
+		got, err := evalJQPath(steps, tc.input)
+		if err != nil {
+			t.Errorf("%s: %v", tc.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s on %s: expected %q, got %q", tc.path, tc.input, tc.want, got)
+		}
+	}
+
+	steps, _ := parseJQPath(".a[]")
+	if _, err := evalJQPath(steps, `{"a":"text"}`); err == nil {
+		t.Error("Expected an error iterating over a string")
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A command is suggested as a template once it has run templateSuggestRuns
+// times in a channel in a week. Each channel gets at most
+// templateSuggestPerChannel suggestions, and a message templateSuggestMax.
+const (
+	templateSuggestRuns       = 5
+	templateSuggestPerChannel = 3
+	templateSuggestMax        = 20
+)
+
+const actionCreateTemplate = "create_template"
+
+// templateNameWord is what a word of a suggested template name keeps.
+var templateNameWord = regexp.MustCompile(`[a-z0-9]+`)
+
+// savedTemplate is a template created from a suggestion.
+type savedTemplate struct {
+	Name      string    `json:"name"`
+	Command   string    `json:"command"`
+	CreatedBy string    `json:"created_by"`
+	Created   time.Time `json:"created"`
+}
+
+// template returns the template that runs the saved command.
+func (t savedTemplate) template() template {
+	return template{Name: t.Name, Summary: "runs " + t.Command, Command: t.Command}
+}
+
+// templateStore keeps the templates created from suggestions in a JSON
+// file in the data directory, next to those of TEMPLATES_FILE. The file is
+// rewritten on every change.
+type templateStore struct {
+	path string
+
+	mu        sync.Mutex
+	templates []savedTemplate
+}
+
+func newTemplateStore(dir string) (*templateStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	st := &templateStore{path: filepath.Join(dir, "created-templates.json")}
+	data, err := os.ReadFile(st.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &st.templates); err != nil {
+		return nil, fmt.Errorf("%s: %w", st.path, err)
+	}
+	return st, nil
+}
+
+// list returns the created templates, oldest first.
+func (st *templateStore) list() []savedTemplate {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return append([]savedTemplate(nil), st.templates...)
+}
+
+// add saves a template.
+func (st *templateStore) add(t savedTemplate) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, existing := range st.templates {
+		if existing.Name == t.Name {
+			return fmt.Errorf("a template named %s already exists", t.Name)
+		}
+	}
+	st.templates = append(st.templates, t)
+	if err := writeJSONFile(st.path, st.templates); err != nil {
+		st.templates = st.templates[:len(st.templates)-1]
+		return err
+	}
+	return nil
+}
+
+// templateSuggestion is a command run often enough in a channel to be
+// worth a template, with the name suggested for it.
+type templateSuggestion struct {
+	ChannelID string `json:"channel"`
+	Command   string `json:"command"`
+	Name      string `json:"name"`
+	Runs      int    `json:"-"`
+	Users     int    `json:"-"`
+}
+
+// suggestTemplates finds the raw shell commands run most often in each
+// channel. Builtins and templates, commands taking input, redacted or
+// quarantined jobs, and commands that would be refused or need
+// confirmation are left out, since a template of them could not run as
+// it is.
+func (s *server) suggestTemplates(ctx context.Context, jobs []jobRecord) []templateSuggestion {
+	type key struct{ channel, command string }
+	runs := make(map[key]int)
+	users := make(map[key]map[string]bool)
+	for _, j := range jobs {
+		if j.ChannelID == "" || j.Redacted || j.Quarantined {
+			continue
+		}
+		flags, command := normalizeCommand(j.Text)
+		if command == "" || flags.Stdin || flags.File != "" || flags.Host != "" || flags.Container != "" || strings.ContainsAny(command, "\n") || strings.Contains(command, redacted) {
+			continue
+		}
+		k := key{j.ChannelID, command}
+		runs[k]++
+		if users[k] == nil {
+			users[k] = make(map[string]bool)
+		}
+		users[k][j.UserID] = true
+	}
+
+	var suggestions []templateSuggestion
+	for k, n := range runs {
+		if n < templateSuggestRuns {
+			continue
+		}
+		if _, _, ok := s.lookupBuiltin(k.command); ok {
+			continue
+		}
+		if severity, _ := s.classify(k.command); severity == severityDangerous || len(detectSuspicious(k.command, s.cfg.Honeytokens)) > 0 {
+			continue
+		}
+		suggestions = append(suggestions, templateSuggestion{ChannelID: k.channel, Command: k.command, Runs: n, Users: len(users[k])})
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if a.ChannelID != b.ChannelID {
+			return a.ChannelID < b.ChannelID
+		}
+		if a.Runs != b.Runs {
+			return a.Runs > b.Runs
+		}
+		return a.Command < b.Command
+	})
+
+	var kept []templateSuggestion
+	perChannel := make(map[string]int)
+	taken := make(map[string]bool)
+	for _, sg := range suggestions {
+		if perChannel[sg.ChannelID] == templateSuggestPerChannel || len(kept) == templateSuggestMax {
+			continue
+		}
+		sg.Name = s.templateName(ctx, sg.Command, taken)
+		if sg.Name == "" {
+			continue
+		}
+		taken[sg.Name] = true
+		perChannel[sg.ChannelID]++
+		kept = append(kept, sg)
+	}
+	return kept
+}
+
+// templateName suggests a name for a template of a command, from its
+// first words, e.g. "kubectl-get-pods". It must not hide a builtin, a
+// template or a command the shell knows, so a number is added if needed.
+func (s *server) templateName(ctx context.Context, command string, taken map[string]bool) string {
+	var words []string
+	for _, field := range strings.Fields(strings.ToLower(command)) {
+		if word := strings.Join(templateNameWord.FindAllString(field, -1), ""); word != "" {
+			words = append(words, word)
+		}
+		if len(words) == 3 {
+			break
+		}
+	}
+	if len(words) == 0 {
+		return ""
+	}
+	base := strings.Join(words, "-")
+	for i := 1; i < 10; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s-%d", base, i)
+		}
+		if _, _, ok := s.lookupBuiltin(name); !ok && !taken[name] && !shellKnows(ctx, name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// runTemplateSuggestions sends admins the week's template suggestions at
+// the configured time each week.
+func (s *server) runTemplateSuggestions() {
+	day, offset, _ := parseWeekClock(s.cfg.TemplateSuggestionsAt)
+	for {
+		next := nextWeekAt(time.Now(), day, offset)
+		time.Sleep(time.Until(next))
+		s.sendTemplateSuggestions(context.Background(), next.AddDate(0, 0, -7))
+	}
+}
+
+// sendTemplateSuggestions DMs each admin the commands run often since the
+// given time, each with a button that creates a template of it.
+func (s *server) sendTemplateSuggestions(ctx context.Context, since time.Time) {
+	jobs, err := s.store.since(since)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading jobs for template suggestions: %v\n", err)
+		return
+	}
+	suggestions := s.suggestTemplates(ctx, jobs)
+	if len(suggestions) == 0 {
+		return
+	}
+
+	text := "These commands were typed often in the past week. A template gives each a short name that runs it as it is:"
+	blocks := []block{sectionBlock(text)}
+	for _, sg := range suggestions {
+		value, err := json.Marshal(sg)
+		if err != nil || len(value) > maxButtonValue {
+			continue
+		}
+		blocks = append(blocks,
+			sectionBlock(fmt.Sprintf("`%s` was run %d times by %d users in <#%s>", sg.Command, sg.Runs, sg.Users, sg.ChannelID)),
+			actionsBlock(button(actionCreateTemplate, "Create template "+sg.Name, string(value), "primary")))
+	}
+	encoded, err := json.Marshal(blocks)
+	if err != nil {
+		return
+	}
+	for _, admin := range sortedKeys(s.cfg.Admins) {
+		channel, err := s.openDM(ctx, admin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening DM with %s: %v\n", admin, err)
+			continue
+		}
+		params := url.Values{"channel": {channel}, "text": {text}, "blocks": {string(encoded)}}
+		if err := s.slack.call(ctx, "chat.postMessage", params, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Error sending template suggestions to %s: %v\n", admin, err)
+		}
+	}
+}
+
+// createTemplate handles a click on a suggestion's Create template button.
+// The command is checked again as the admin who clicked, in the channel it
+// was run in, since the policy may have changed since it was suggested.
+func (s *server) createTemplate(ctx context.Context, p interactionPayload, value string) map[string]string {
+	fail := func(msg string) map[string]string {
+		return map[string]string{
+			"response_type":    "ephemeral",
+			"replace_original": "false",
+			"text":             "_cannot create template: " + msg + "_",
+		}
+	}
+	if !s.cfg.Admins[p.User.ID] {
+		return fail("only admins can create templates")
+	}
+	if s.savedTemplates == nil {
+		return fail("templates can only be created with DATA_DIR")
+	}
+	var sg templateSuggestion
+	if err := json.Unmarshal([]byte(value), &sg); err != nil || sg.Name == "" || sg.Command == "" {
+		return fail("malformed suggestion")
+	}
+	if _, _, ok := s.lookupBuiltin(sg.Name); ok {
+		return fail(fmt.Sprintf("a command named %s already exists", sg.Name))
+	}
+	if hits := detectSuspicious(sg.Command, s.cfg.Honeytokens); len(hits) > 0 {
+		return fail("the command is suspicious (" + strings.Join(hits, ", ") + ")")
+	}
+	if severity, reasons := s.classify(sg.Command); severity == severityDangerous {
+		return fail("the command is dangerous (" + strings.Join(reasons, ", ") + ")")
+	}
+	cmd := slashCommand{Text: "$ " + sg.Command, UserID: p.User.ID, ChannelID: sg.ChannelID, TeamID: p.Team.ID}
+	if d := s.checkPolicy(ctx, cmd, sg.Command); d.Decision == policyDeny {
+		return fail("denied by policy: " + d.Reason)
+	}
+
+	t := savedTemplate{Name: sg.Name, Command: sg.Command, CreatedBy: p.User.ID, Created: time.Now()}
+	if err := s.savedTemplates.add(t); err != nil {
+		return fail(err.Error())
+	}
+	s.auditLog.record(auditEvent{
+		Action:    "template_created",
+		UserID:    p.User.ID,
+		ChannelID: sg.ChannelID,
+		TeamID:    p.Team.ID,
+		Command:   sg.Command,
+		Detail:    sg.Name,
+	})
+	return map[string]string{
+		"response_type":    "ephemeral",
+		"replace_original": "false",
+		"text":             fmt.Sprintf("_created template_ `%s`_: `$ %s` runs_ `%s`", sg.Name, sg.Name, sg.Command),
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func suggestionJobs(channel, text string, users ...string) []jobRecord {
+	var jobs []jobRecord
+	for i, user := range users {
+		jobs = append(jobs, jobRecord{ID: randomToken()[:12], ChannelID: channel, UserID: user, Text: text, Started: time.Now().Add(-time.Duration(i) * time.Minute)})
+	}
+	return jobs
+}
+
+func TestSuggestTemplates(t *testing.T) {
+	s := newServer(config{ClassifierRules: []classifierRule{
+		{Pattern: "^rm ", Severity: severityDangerous, Reason: "deletes", re: regexp.MustCompile("^rm ")},
+	}})
+	var jobs []jobRecord
+	jobs = append(jobs, suggestionJobs("C1", "$ kubectl get pods -n prod", "U1", "U1", "U2", "U2", "U3", "U1")...)
+	jobs = append(jobs, suggestionJobs("C1", "$ --pty df -h", "U1", "U1", "U1", "U1", "U1")...)
+	jobs = append(jobs, suggestionJobs("C1", "$ uptime", "U1", "U1", "U1", "U1")...)
+	jobs = append(jobs, suggestionJobs("C1", "$ help", "U1", "U1", "U1", "U1", "U1")...)
+	jobs = append(jobs, suggestionJobs("C1", "$ rm -rf /tmp/cache", "U1", "U1", "U1", "U1", "U1")...)
+	jobs = append(jobs, suggestionJobs("C2", "$ kubectl get pods -n prod", "U4", "U4", "U4", "U4", "U4")...)
+
+	got := s.suggestTemplates(context.Background(), jobs)
+	want := []templateSuggestion{
+		{ChannelID: "C1", Command: "kubectl get pods -n prod", Name: "kubectl-get-pods", Runs: 6, Users: 3},
+		{ChannelID: "C1", Command: "df -h", Name: "df-h", Runs: 5, Users: 1},
+		{ChannelID: "C2", Command: "kubectl get pods -n prod", Name: "kubectl-get-pods-2", Runs: 5, Users: 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %+v, got %+v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Suggestion %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestTemplateSuggestions_CreateTemplate(t *testing.T) {
+	f := newFakeSlack(t)
+	f.respond("conversations.open", map[string]interface{}{"channel": map[string]string{"id": "D1"}})
+	cfg := f.config()
+	cfg.DataDir = t.TempDir()
+	cfg.Admins = map[string]bool{"UADMIN": true}
+	s := newServer(cfg)
+	for _, j := range suggestionJobs("C1", "$ echo templated", "U1", "U2", "U1", "U2", "U1") {
+		if err := s.store.save(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.sendTemplateSuggestions(context.Background(), time.Now().Add(-7*24*time.Hour))
+	posts := f.callsTo("chat.postMessage")
+	if len(posts) != 1 || posts[0].Params.Get("channel") != "D1" {
+		t.Fatalf("Expected the suggestions sent to the admin, got %+v", posts)
+	}
+	var blocks []map[string]interface{}
+	if err := json.Unmarshal([]byte(posts[0].Params.Get("blocks")), &blocks); err != nil || len(blocks) != 3 {
+		t.Fatalf("Expected an intro, the suggestion and its button, got %s", posts[0].Params.Get("blocks"))
+	}
+	if text := blocks[1]["text"].(map[string]interface{})["text"]; text != "`echo templated` was run 5 times by 2 users in <#C1>" {
+		t.Errorf("Unexpected suggestion %q", text)
+	}
+	value := blocks[2]["elements"].([]interface{})[0].(map[string]interface{})["value"].(string)
+
+	var p interactionPayload
+	p.User.ID = "U1"
+	if message := s.createTemplate(context.Background(), p, value); !strings.Contains(message["text"], "only admins") {
+		t.Errorf("Expected non-admins refused, got %q", message["text"])
+	}
+	p.User.ID = "UADMIN"
+	if message := s.createTemplate(context.Background(), p, value); !strings.Contains(message["text"], "created template") {
+		t.Fatalf("Expected the template created, got %q", message["text"])
+	}
+	if message := s.createTemplate(context.Background(), p, value); !strings.Contains(message["text"], "already exists") {
+		t.Errorf("Expected a second click refused, got %q", message["text"])
+	}
+
+	// The template is kept across restarts and runs like any other.
+	s = newServer(cfg)
+	data := url.Values{}
+	data.Set("text", "$ echo-templated")
+	if response := postCommand(t, s, data); !strings.Contains(response["text"], "\ntemplated") {
+		t.Errorf("Expected the template to run, got %q", response["text"])
+	}
+}
+
+func TestCreateTemplate_CheckedByPolicy(t *testing.T) {
+	s := newServer(config{
+		DataDir: t.TempDir(),
+		Admins:  map[string]bool{"UADMIN": true},
+		OPAURL: fakeOPA(t, func(in policyInput) interface{} {
+			return map[string]interface{}{"decision": "deny", "reason": "not in " + in.Channel}
+		}).URL,
+	})
+	var p interactionPayload
+	p.User.ID = "UADMIN"
+	value := `{"channel": "C1", "command": "echo hi", "name": "echo-hi"}`
+	if message := s.createTemplate(context.Background(), p, value); message["text"] != "_cannot create template: denied by policy: not in C1_" {
+		t.Errorf("Expected the policy to refuse the template, got %q", message["text"])
+	}
+	if _, _, ok := s.lookupBuiltin("echo-hi"); ok {
+		t.Error("Expected no template created")
+	}
+}
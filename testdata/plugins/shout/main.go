@@ -0,0 +1,46 @@
+// Command shout is a test plugin. As a builtin it prints its arguments in
+// upper case, as a filter it appends "!" to every line, and as a policy it
+// denies commands containing "forbidden".
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+type request struct {
+	Hook   string   `json:"hook"`
+	Args   []string `json:"args"`
+	Output string   `json:"output"`
+	Input  struct {
+		Command string `json:"command"`
+	} `json:"input"`
+}
+
+func main() {
+	var req request
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		os.Stderr.WriteString(err.Error())
+		os.Exit(1)
+	}
+
+	resp := map[string]interface{}{}
+	switch req.Hook {
+	case "builtin":
+		resp["output"] = strings.ToUpper(strings.Join(req.Args, " "))
+	case "filter":
+		lines := strings.Split(req.Output, "\n")
+		for i := range lines {
+			lines[i] += "!"
+		}
+		resp["output"] = strings.Join(lines, "\n")
+	case "policy":
+		resp["decision"] = "allow"
+		if strings.Contains(req.Input.Command, "forbidden") {
+			resp["decision"] = "deny"
+			resp["reason"] = "shouted down"
+		}
+	}
+	json.NewEncoder(os.Stdout).Encode(resp)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	setUsage   = "usage: set <NAME>=<value>"
+	unsetUsage = "usage: unset <NAME>"
+)
+
+// varName is what a channel variable may be called: a shell variable name.
+var varName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// reservedVars may not be set per channel: they change how every command
+// is found and run, or belong to http-shell.
+var reservedVars = regexp.MustCompile(`^(PATH|HOME|SHELL|IFS|ENV|BASH_ENV|PS4|LD_.*|SLACK_.*)$`)
+
+// secretVar matches names of variables whose values are not shown.
+var secretVar = regexp.MustCompile(`(?i)(pass|secret|token|key|credential)`)
+
+// errVarNotFound is returned for variables not set in a channel.
+var errVarNotFound = errors.New("no such variable")
+
+// channelVar is a variable's value and who last set it.
+type channelVar struct {
+	Value   string    `json:"value"`
+	UserID  string    `json:"user_id,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+// varStore keeps each channel's variables in a JSON file in the data
+// directory. The file is rewritten on every change.
+type varStore struct {
+	path string
+
+	mu       sync.Mutex
+	channels map[string]map[string]channelVar // channel ID, then name
+}
+
+func newVarStore(dir string) (*varStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	st := &varStore{path: filepath.Join(dir, "vars.json"), channels: map[string]map[string]channelVar{}}
+	data, err := os.ReadFile(st.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &st.channels); err != nil {
+		return nil, fmt.Errorf("%s: %w", st.path, err)
+	}
+	return st, nil
+}
+
+// set sets or replaces a channel's variable.
+func (st *varStore) set(channelID, name string, v channelVar) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.channels[channelID] == nil {
+		st.channels[channelID] = map[string]channelVar{}
+	}
+	previous, existed := st.channels[channelID][name]
+	st.channels[channelID][name] = v
+	if err := writeJSONFile(st.path, st.channels); err != nil {
+		if existed {
+			st.channels[channelID][name] = previous
+		} else {
+			delete(st.channels[channelID], name)
+		}
+		return err
+	}
+	return nil
+}
+
+// remove deletes a channel's variable.
+func (st *varStore) remove(channelID, name string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	v, ok := st.channels[channelID][name]
+	if !ok {
+		return errVarNotFound
+	}
+	delete(st.channels[channelID], name)
+	if err := writeJSONFile(st.path, st.channels); err != nil {
+		st.channels[channelID][name] = v
+		return err
+	}
+	return nil
+}
+
+// env returns a channel's variables as "NAME=value", sorted by name.
+func (st *varStore) env(channelID string) []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	env := make([]string, 0, len(st.channels[channelID]))
+	for name, v := range st.channels[channelID] {
+		env = append(env, name+"="+v.Value)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// channelEnv returns the variables commands in a command's channel run
+// with. An approved or confirmed command keeps those it was reviewed with.
+func (s *server) channelEnv(cmd slashCommand) []string {
+	if cmd.Reviewed != nil {
+		return cmd.Reviewed.Env
+	}
+	if s.vars == nil || cmd.ChannelID == "" {
+		return nil
+	}
+	return s.vars.env(cmd.ChannelID)
+}
+
+// claimsSet leaves "set -e" and the like to the shell.
+func claimsSet(args []string) bool {
+	return len(args) > 0 && strings.Contains(args[0], "=")
+}
+
+// withExports prefixes a command run in a session with exports of env.
+// "exit" is left alone, since the session treats it specially.
+func withExports(env []string, command string) string {
+	if len(env) == 0 || command == "exit" {
+		return command
+	}
+	var b strings.Builder
+	b.WriteString("export")
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		b.WriteString(" " + name + "=" + shellQuote(value))
+	}
+	return b.String() + "; " + command
+}
+
+func runSet(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	fail := func(code int, msg string) commandResult {
+		return commandResult{Lines: []string{msg}, ExitCode: code, Duration: time.Since(startTime)}
+	}
+	if s.vars == nil {
+		return fail(1, "set needs DATA_DIR")
+	}
+	if cmd.ChannelID == "" {
+		return fail(1, "set: variables belong to a channel")
+	}
+	name, value, ok := strings.Cut(strings.Join(args, " "), "=")
+	if !ok || !varName.MatchString(name) {
+		return fail(2, setUsage)
+	}
+	if reservedVars.MatchString(name) {
+		return fail(1, fmt.Sprintf("set: %s cannot be set per channel", name))
+	}
+	if n := len(value); n >= 2 && (value[0] == '\'' || value[0] == '"') && value[n-1] == value[0] {
+		value = value[1 : n-1]
+	}
+
+	if err := s.vars.set(cmd.ChannelID, name, channelVar{Value: value, UserID: cmd.UserID, Updated: time.Now()}); err != nil {
+		return fail(1, "set: "+err.Error())
+	}
+	return commandResult{Lines: []string{showVar(name + "=" + value)}, Duration: time.Since(startTime)}
+}
+
+func runUnset(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	fail := func(code int, msg string) commandResult {
+		return commandResult{Lines: []string{msg}, ExitCode: code, Duration: time.Since(startTime)}
+	}
+	if s.vars == nil {
+		return fail(1, "unset needs DATA_DIR")
+	}
+	if len(args) != 1 {
+		return fail(2, unsetUsage)
+	}
+	if err := s.vars.remove(cmd.ChannelID, args[0]); err != nil {
+		return fail(1, fmt.Sprintf("unset: %s: %v", args[0], err))
+	}
+	return commandResult{Lines: []string{"unset " + args[0]}, Duration: time.Since(startTime)}
+}
+
+// runVars lists the channel's variables. Values that may be secrets are
+// hidden, since the list may be posted in the channel.
+func runVars(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	if s.vars == nil {
+		return commandResult{Lines: []string{"vars needs DATA_DIR"}, ExitCode: 1, Duration: time.Since(startTime)}
+	}
+	if len(args) != 0 {
+		return commandResult{Lines: []string{"usage: vars"}, ExitCode: 2, Duration: time.Since(startTime)}
+	}
+	env := s.channelEnv(cmd)
+	if len(env) == 0 {
+		return commandResult{Lines: []string{"no variables in this channel"}, Duration: time.Since(startTime)}
+	}
+	lines := make([]string, len(env))
+	for i, kv := range env {
+		lines[i] = showVar(kv)
+	}
+	return commandResult{Lines: lines, Duration: time.Since(startTime)}
+}
+
+// showVar hides the value of a "NAME=value" pair if the name suggests a
+// secret, and redacts credential-like values otherwise.
+func showVar(kv string) string {
+	name, _, _ := strings.Cut(kv, "=")
+	if secretVar.MatchString(name) {
+		return name + "=" + redacted
+	}
+	return redactLine(kv)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestVars_SetUseUnset(t *testing.T) {
+	dir := t.TempDir()
+	s := newServer(config{DataDir: dir})
+	ctx := context.Background()
+	in := func(channel, text string) string {
+		return s.handleCommandExecution(ctx, slashCommand{Text: text, UserID: "U1", ChannelID: channel})["text"]
+	}
+
+	if got := in("C1", "$ set NAMESPACE=prod"); !strings.Contains(got, "NAMESPACE=prod") {
+		t.Fatalf("Expected the variable set, got %q", got)
+	}
+	in("C1", `$ set GREETING="hello there"`)
+	if got := in("C1", "$ echo $NAMESPACE $GREETING"); !strings.Contains(got, "prod hello there") {
+		t.Errorf("Expected the variables in the environment, got %q", got)
+	}
+	if got := in("C2", "$ echo ns=$NAMESPACE"); !strings.Contains(got, "ns=```") {
+		t.Errorf("Expected variables scoped to their channel, got %q", got)
+	}
+
+	// Variables survive a restart.
+	s = newServer(config{DataDir: dir})
+	in("C1", "$ set API_TOKEN=abc123")
+	got := in("C1", "$ vars")
+	if !strings.Contains(got, "GREETING=hello there\nNAMESPACE=prod") || strings.Contains(got, "abc123") {
+		t.Errorf("Expected the variables listed with secrets redacted, got %q", got)
+	}
+	if got := in("C1", "$ unset NAMESPACE"); !strings.Contains(got, "unset NAMESPACE") {
+		t.Errorf("Expected the variable removed, got %q", got)
+	}
+	if got := in("C1", "$ unset NAMESPACE"); !strings.Contains(got, "no such variable") {
+		t.Errorf("Expected a missing variable reported, got %q", got)
+	}
+	if got := in("C1", "$ set PATH=/tmp"); !strings.Contains(got, "PATH cannot be set per channel") {
+		t.Errorf("Expected PATH refused, got %q", got)
+	}
+}
+
+func TestWithExports(t *testing.T) {
+	if got := withExports([]string{"A=1", "B=it's"}, "echo $A"); got != `export A='1' B='it'\''s'; echo $A` {
+		t.Errorf("Unexpected command %s", got)
+	}
+	if got := withExports([]string{"A=1"}, "exit"); got != "exit" {
+		t.Errorf("Expected exit left alone, got %s", got)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Who may see a channel's stored jobs, set by its profile's history.
+const (
+	historyOwn     = "own"     // each user their own jobs
+	historyChannel = "channel" // everyone asking from the channel its public jobs
+)
+
+// viewer is someone asking to see stored jobs, through a builtin or the
+// admin API.
+type viewer struct {
+	UserID    string
+	ChannelID string // where a builtin was run; "" for the API
+	Admin     bool
+}
+
+// viewerFor returns the viewer running a command.
+func (s *server) viewerFor(cmd slashCommand) viewer {
+	return viewer{UserID: cmd.UserID, ChannelID: cmd.ChannelID, Admin: s.cfg.Admins[cmd.UserID]}
+}
+
+// canView reports whether a viewer may see a stored job. Admins see all
+// public jobs and users their own; others see a public job only when
+// asking from its channel, if its profile shares history. Replies to
+// builtins may be posted in a channel, so private jobs are only served by
+// the API, to their user and admins, and quarantined jobs to admins.
+func (s *server) canView(v viewer, r jobRecord) bool {
+	switch {
+	case r.Quarantined:
+		return v.ChannelID == "" && v.Admin
+	case r.Private:
+		return v.ChannelID == "" && (v.Admin || r.UserID == v.UserID)
+	case v.Admin || r.UserID == v.UserID:
+		return true
+	}
+	return v.ChannelID != "" && v.ChannelID == r.ChannelID && s.cfg.profileFor(r.ChannelID).History == historyChannel
+}
+
+// apiViewer identifies the caller of an admin API endpoint by its bearer
+// token. Without API_TOKENS no caller is known.
+func (s *server) apiViewer(r *http.Request) (viewer, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if ok {
+		for known, userID := range s.cfg.APITokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(known)) == 1 {
+				return viewer{UserID: userID, Admin: s.cfg.Admins[userID]}, nil
+			}
+		}
+	}
+	return viewer{}, errors.New("missing or unknown API token")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCanView(t *testing.T) {
+	s := newServer(config{
+		Admins:   map[string]bool{"UADMIN": true},
+		Profiles: []profile{{Name: "shared", Channels: []string{"CSHARED"}, History: historyChannel}},
+	})
+	own := jobRecord{UserID: "U1", ChannelID: "C1"}
+	shared := jobRecord{UserID: "U1", ChannelID: "CSHARED"}
+	private := jobRecord{UserID: "U1", ChannelID: "C1", Private: true}
+
+	tests := []struct {
+		name string
+		v    viewer
+		r    jobRecord
+		want bool
+	}{
+		{"own job", viewer{UserID: "U1", ChannelID: "C1"}, own, true},
+		{"someone else's job", viewer{UserID: "U2", ChannelID: "C1"}, own, false},
+		{"admin", viewer{UserID: "UADMIN", ChannelID: "C9", Admin: true}, own, true},
+		{"shared channel", viewer{UserID: "U2", ChannelID: "CSHARED"}, shared, true},
+		{"shared channel from elsewhere", viewer{UserID: "U2", ChannelID: "C1"}, shared, false},
+		{"own private job in a channel", viewer{UserID: "U1", ChannelID: "C1"}, private, false},
+		{"own private job by API", viewer{UserID: "U1"}, private, true},
+		{"admin private job by API", viewer{UserID: "UADMIN", Admin: true}, private, true},
+	}
+	for _, tt := range tests {
+		if got := s.canView(tt.v, tt.r); got != tt.want {
+			t.Errorf("%s: canView = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHistory_Visibility(t *testing.T) {
+	s := newServer(config{
+		DataDir:  t.TempDir(),
+		Admins:   map[string]bool{"UADMIN": true},
+		Profiles: []profile{{Name: "shared", Channels: []string{"CSHARED"}, History: historyChannel}},
+	})
+	ctx := context.Background()
+	for _, channel := range []string{"C1", "CSHARED"} {
+		s.handleCommandExecution(ctx, slashCommand{Text: "$ echo first", UserID: "U1", ChannelID: channel})
+		s.handleCommandExecution(ctx, slashCommand{Text: "$ echo second", UserID: "U2", ChannelID: channel})
+	}
+	history := func(user, channel string) string {
+		return s.handleCommandExecution(ctx, slashCommand{Text: "$ history", UserID: user, ChannelID: channel})["text"]
+	}
+
+	if got := history("U2", "C1"); !strings.Contains(got, "echo second") || strings.Contains(got, "echo first") {
+		t.Errorf("Expected only the user's own commands, got %q", got)
+	}
+	if got := history("UADMIN", "C1"); !strings.Contains(got, "echo first") || !strings.Contains(got, "echo second") {
+		t.Errorf("Expected admins to see everyone's commands, got %q", got)
+	}
+	if got := history("U2", "CSHARED"); !strings.Contains(got, "echo first") || !strings.Contains(got, "echo second") {
+		t.Errorf("Expected a shared channel's history to be shared, got %q", got)
+	}
+	if got := history("U3", "C1"); !strings.Contains(got, "no history in this channel") {
+		t.Errorf("Expected no history for a new user, got %q", got)
+	}
+}
+
+func TestTranscript_APITokens(t *testing.T) {
+	s := newServer(config{
+		DataDir:   t.TempDir(),
+		Admins:    map[string]bool{"UADMIN": true},
+		APITokens: map[string]string{"tok-u1": "U1", "tok-u2": "U2", "tok-admin": "UADMIN"},
+	})
+	s.handleCommandExecution(context.Background(), slashCommand{Text: "$ echo hello", UserID: "U1", ChannelID: "C1"})
+	jobs, err := s.store.since(time.Time{})
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("Expected one stored job, got %v, %v", jobs, err)
+	}
+
+	get := func(token string) int {
+		req := httptest.NewRequest("GET", "/debug/transcripts/"+jobs[0].ID, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		s.routes().ServeHTTP(w, req)
+		return w.Code
+	}
+	for _, tt := range []struct {
+		token string
+		want  int
+	}{
+		{"", http.StatusUnauthorized},
+		{"wrong", http.StatusUnauthorized},
+		{"tok-u1", http.StatusOK},
+		{"tok-u2", http.StatusNotFound},
+		{"tok-admin", http.StatusOK},
+	} {
+		if got := get(tt.token); got != tt.want {
+			t.Errorf("token %q: got %d, want %d", tt.token, got, tt.want)
+		}
+	}
+
+	// Without API_TOKENS no caller is known, so none is served.
+	s.cfg.APITokens = nil
+	if got := get(""); got != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without API_TOKENS, got %d", got)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Watch intervals. chat.update allows about one edit a second per
+// channel, and several watches may share one.
+const (
+	watchDefaultInterval = 30 * time.Second
+	watchMinInterval     = 10 * time.Second
+)
+
+// watchMaxDuration ends a watch that was never stopped.
+const watchMaxDuration = 8 * time.Hour
+
+// watchMaxChars bounds the output shown in a watch message, within the
+// 3000 characters of a section block.
+const watchMaxChars = 2800
+
+const watchUsage = "usage: watch [-n <seconds>] <command>"
+
+// watch re-runs a command on an interval and keeps one message up to date
+// with its latest output. It is a job, so it is listed by status and
+// ended with the message's Stop button.
+type watch struct {
+	s        *server
+	cmd      slashCommand // the watch itself, for the job and the channel
+	command  string       // the command re-run
+	shown    string       // the command as shown in the channel
+	interval time.Duration
+	redact   bool
+
+	ts       string
+	runs     int
+	previous []string
+}
+
+func runWatch(ctx context.Context, s *server, cmd slashCommand, args []string) commandResult {
+	startTime := time.Now()
+	fail := func(code int, msg string) commandResult {
+		return commandResult{Lines: []string{msg}, ExitCode: code, Duration: time.Since(startTime)}
+	}
+
+	interval, command, err := parseWatchArgs(args)
+	if err != nil {
+		return fail(2, err.Error())
+	}
+	if b, _, ok := s.lookupBuiltin(command); ok && b.Name == "watch" {
+		return fail(2, "watch: cannot watch a watch")
+	}
+	if s.slack == nil || !s.cfg.Interactivity || !s.liveAllowed(cmd) {
+		return fail(1, "watch needs SLACK_TOKEN, interactivity and a channel where output may be shown")
+	}
+	// The watch as a whole passed the checks for "watch ...", but each
+	// run is of the inner command, which must pass them too.
+	if hits := detectSuspicious(command, s.cfg.Honeytokens); len(hits) > 0 {
+		return fail(1, "watch: refusing to re-run a suspicious command")
+	}
+	if severity, _ := s.classify(command); severity == severityDangerous {
+		return fail(1, "watch: refusing to re-run a dangerous command")
+	}
+	if d := s.checkPolicy(ctx, cmd, command); d.Decision != policyAllow {
+		return fail(1, "watch: the policy does not allow re-running this command")
+	}
+
+	w := &watch{
+		s:        s,
+		cmd:      cmd,
+		command:  command,
+		shown:    command,
+		interval: interval,
+		redact:   s.cfg.profileFor(cmd.ChannelID).Classification.rules().Redact,
+	}
+	if w.redact {
+		w.shown = redactLine(command)
+	}
+	jobCtx, j := s.jobs.start(context.WithoutCancel(ctx), cmd, "watch "+command)
+	if err := w.post(ctx, j); err != nil {
+		s.jobs.finish(j)
+		return fail(1, "watch: "+err.Error())
+	}
+	go w.run(jobCtx, j)
+
+	return commandResult{
+		Lines:    []string{fmt.Sprintf("watching every %s; use Stop on the watch message to end it", interval)},
+		Duration: time.Since(startTime),
+	}
+}
+
+// parseWatchArgs reads "-n <seconds>" and the command after it.
+func parseWatchArgs(args []string) (time.Duration, string, error) {
+	interval := watchDefaultInterval
+	if len(args) > 0 && args[0] == "-n" {
+		if len(args) < 2 {
+			return 0, "", errors.New(watchUsage)
+		}
+		secs, err := strconv.ParseFloat(args[1], 64)
+		if err != nil || secs <= 0 {
+			return 0, "", fmt.Errorf("watch: bad interval %q", args[1])
+		}
+		interval = max(time.Duration(secs*float64(time.Second)), watchMinInterval)
+		args = args[2:]
+	}
+	if len(args) == 0 {
+		return 0, "", errors.New(watchUsage)
+	}
+	return interval, strings.Join(args, " "), nil
+}
+
+// post posts the watch message, with a Stop button for the job.
+func (w *watch) post(ctx context.Context, j *job) error {
+	params, err := w.params(j, []string{"_waiting for the first run…_"})
+	if err != nil {
+		return err
+	}
+	if w.cmd.ThreadTS != "" {
+		params.Set("thread_ts", w.cmd.ThreadTS)
+	}
+	var resp struct {
+		TS string `json:"ts"`
+	}
+	if err := w.s.slack.call(ctx, "chat.postMessage", params, &resp); err != nil {
+		return err
+	}
+	w.ts = resp.TS
+	return nil
+}
+
+// run re-runs the command until the job is stopped or the watch has
+// lasted watchMaxDuration.
+func (w *watch) run(ctx context.Context, j *job) {
+	defer w.s.jobs.finish(j)
+	update := context.WithoutCancel(ctx)
+	expired := time.NewTimer(watchMaxDuration)
+	defer expired.Stop()
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		result := w.s.execute(ctx, slashCommand{UserID: w.cmd.UserID, ChannelID: w.cmd.ChannelID, TeamID: w.cmd.TeamID}, w.command, runOptions{})
+		if ctx.Err() != nil {
+			// Stopped: the Stop button's reply replaces the message.
+			return
+		}
+		w.update(update, j, result)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		case <-expired.C:
+			w.end(update, fmt.Sprintf("_watch ended after %s_", watchMaxDuration))
+			return
+		}
+	}
+}
+
+// update shows the latest run. From the second run on, lines that changed
+// since the previous run are marked with "+".
+func (w *watch) update(ctx context.Context, j *job, result commandResult) {
+	w.runs++
+	lines := result.Lines
+	if w.redact {
+		lines = redactLines(lines)
+	}
+	shown := make([]string, len(lines))
+	changed := 0
+	for i, line := range lines {
+		shown[i] = line
+		if w.runs == 1 {
+			continue
+		}
+		marker := "  "
+		if i >= len(w.previous) || w.previous[i] != line {
+			marker = "+ "
+			changed++
+		}
+		shown[i] = marker + line
+	}
+	if w.runs > 1 && len(w.previous) > len(lines) {
+		changed += len(w.previous) - len(lines)
+	}
+	w.previous = lines
+
+	status := fmt.Sprintf("_run %d at %s, %s, every %s_", w.runs, time.Now().Format("15:04:05"), translateExitCode(result.ExitCode), w.interval)
+	switch {
+	case w.runs == 1:
+	case changed == 0:
+		status += " _· no change_"
+	default:
+		status += fmt.Sprintf(" _· %d lines changed_", changed)
+	}
+
+	params, err := w.params(j, append([]string{watchBlock(w.shown, shown)}, status))
+	if err != nil {
+		return
+	}
+	params.Set("ts", w.ts)
+	if err := w.s.slack.call(ctx, "chat.update", params, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error updating watch: %v\n", err)
+	}
+}
+
+// end replaces the watch message with a final note.
+func (w *watch) end(ctx context.Context, text string) {
+	params := url.Values{"channel": {w.cmd.ChannelID}, "ts": {w.ts}, "text": {text}, "blocks": {"[]"}}
+	if err := w.s.slack.call(ctx, "chat.update", params, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error ending watch: %v\n", err)
+	}
+}
+
+// params renders the watch message: the given sections and a Stop button.
+func (w *watch) params(j *job, sections []string) (url.Values, error) {
+	blocks := make([]block, 0, len(sections)+1)
+	for _, text := range sections {
+		blocks = append(blocks, sectionBlock(text))
+	}
+	blocks = append(blocks, actionsBlock(button(actionStop, "Stop", j.ID, "danger")))
+	data, err := json.Marshal(blocks)
+	if err != nil {
+		return nil, err
+	}
+	return url.Values{
+		"channel": {w.cmd.ChannelID},
+		"text":    {"watch " + w.shown},
+		"blocks":  {string(data)},
+	}, nil
+}
+
+// watchBlock formats output as a code block headed by the command,
+// keeping its last lines if it is too long.
+func watchBlock(command string, lines []string) string {
+	size := 0
+	start := len(lines)
+	for start > 0 && size+len(lines[start-1])+1 <= watchMaxChars {
+		start--
+		size += len(lines[start]) + 1
+	}
+	header := "$ " + command
+	if start > 0 {
+		header += fmt.Sprintf("\n… %d earlier lines", start)
+	}
+	return "```" + header + "\n" + strings.Join(lines[start:], "\n") + "```"
+}
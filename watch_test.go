@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWatchArgs(t *testing.T) {
+	tests := []struct {
+		args         []string
+		wantInterval time.Duration
+		wantCommand  string
+		wantErr      bool
+	}{
+		{[]string{"kubectl", "get", "pods"}, watchDefaultInterval, "kubectl get pods", false},
+		{[]string{"-n", "60", "uptime"}, time.Minute, "uptime", false},
+		{[]string{"-n", "1", "uptime"}, watchMinInterval, "uptime", false},
+		{[]string{"-n", "soon", "uptime"}, 0, "", true},
+		{[]string{"-n", "30"}, 0, "", true},
+		{nil, 0, "", true},
+	}
+	for _, tt := range tests {
+		interval, command, err := parseWatchArgs(tt.args)
+		if (err != nil) != tt.wantErr || interval != tt.wantInterval || command != tt.wantCommand {
+			t.Errorf("parseWatchArgs(%q) = %s, %q, %v", tt.args, interval, command, err)
+		}
+	}
+}
+
+func TestWatch_StopEndsJob(t *testing.T) {
+	f := newFakeSlack(t)
+	f.respond("chat.postMessage", map[string]interface{}{"ts": "1700000000.000400"})
+	cfg := f.config()
+	cfg.Interactivity = true
+	s := newServer(cfg)
+
+	response := s.handleCommandExecution(context.Background(), slashCommand{Text: "$ watch -n 30 echo tick", UserID: "U1", ChannelID: "C1"})
+	if !strings.Contains(response["text"], "watching every 30s") {
+		t.Fatalf("Expected the watch to start, got %q", response["text"])
+	}
+	posts := f.callsTo("chat.postMessage")
+	if len(posts) != 1 || !strings.Contains(posts[0].Params.Get("blocks"), `"action_id":"`+actionStop+`"`) {
+		t.Fatalf("Expected a watch message with a Stop button, got %v", posts)
+	}
+
+	// The first run updates the message straight away.
+	updates := waitForCalls(t, f, "chat.update", 1)
+	if len(updates) != 1 || updates[0].Params.Get("ts") != "1700000000.000400" || !strings.Contains(updates[0].Params.Get("blocks"), "tick") {
+		t.Fatalf("Expected the first run shown, got %v", updates)
+	}
+
+	running := s.jobs.running()
+	if len(running) != 1 || running[0].Command != "watch echo tick" {
+		t.Fatalf("Expected the watch listed as a job, got %v", running)
+	}
+	if _, err := s.jobs.stop(running[0].ID, "U1"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.jobs.running()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := len(s.jobs.running()); n != 0 {
+		t.Errorf("Expected the watch to end when stopped, got %d jobs", n)
+	}
+}
+
+func TestWatch_MarksChangedLines(t *testing.T) {
+	f := newFakeSlack(t)
+	s := newServer(f.config())
+	w := &watch{s: s, cmd: slashCommand{ChannelID: "C1"}, command: "kubectl get pods", shown: "kubectl get pods", interval: time.Minute, ts: "1.1"}
+	j := &job{ID: "job1"}
+
+	w.update(context.Background(), j, commandResult{Lines: []string{"web-1 Running", "web-2 Pending"}})
+	w.update(context.Background(), j, commandResult{Lines: []string{"web-1 Running", "web-2 Running"}})
+	w.update(context.Background(), j, commandResult{Lines: []string{"web-1 Running", "web-2 Running"}})
+
+	updates := f.callsTo("chat.update")
+	if len(updates) != 3 {
+		t.Fatalf("Expected 3 updates, got %d", len(updates))
+	}
+	if blocks := updates[0].Params.Get("blocks"); strings.Contains(blocks, "+ ") || strings.Contains(blocks, "change") {
+		t.Errorf("Expected no diff markers on the first run, got %s", blocks)
+	}
+	second := updates[1].Params.Get("blocks")
+	if !strings.Contains(second, `  web-1 Running\n+ web-2 Running`) || !strings.Contains(second, "1 lines changed") {
+		t.Errorf("Expected the changed line marked, got %s", second)
+	}
+	if third := updates[2].Params.Get("blocks"); !strings.Contains(third, "no change") {
+		t.Errorf("Expected no change reported, got %s", third)
+	}
+}
+
+func TestWatchBlock_KeepsTail(t *testing.T) {
+	lines := make([]string, 100)
+	for i := range lines {
+		lines[i] = strings.Repeat("x", 99)
+	}
+	block := watchBlock("seq", lines)
+	if len(block) > watchMaxChars+100 || !strings.Contains(block, "earlier lines") {
+		t.Errorf("Expected a shortened block noting earlier lines, got %d chars", len(block))
+	}
+}
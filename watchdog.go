@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// actionKeepWaiting is the watchdog's "Keep waiting" button; its "Kill"
+// button is the job's Stop button.
+const actionKeepWaiting = "keep_waiting"
+
+// What the watchdog does about a job that has gone quiet.
+const (
+	watchdogAsk  = "ask"  // post a message asking whether to kill it
+	watchdogKill = "kill" // kill it and say so
+)
+
+// watchdog acts on a job that has produced no output for a while, which
+// is often a command waiting for input or stuck on a network call.
+type watchdog struct {
+	s    *server
+	j    *job
+	idle time.Duration
+
+	mu         sync.Mutex
+	lastOutput time.Time
+	fired      bool   // acted on the current quiet spell
+	channel    string // where the question was posted, if it was
+	ts         string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startWatchdog watches a job's output, if the watchdog is enabled.
+func (s *server) startWatchdog(ctx context.Context, j *job) *watchdog {
+	if s.cfg.WatchdogIdle <= 0 || s.slack == nil || j.Cmd.ChannelID == "" {
+		return nil
+	}
+	w := &watchdog{
+		s:          s,
+		j:          j,
+		idle:       s.cfg.WatchdogIdle,
+		lastOutput: time.Now(),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	j.watchdog = w
+	go w.run(context.WithoutCancel(ctx))
+	return w
+}
+
+func (w *watchdog) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	w.lastOutput = time.Now()
+	w.mu.Unlock()
+	return len(p), nil
+}
+
+// keepWaiting starts a new quiet spell, as if output had just arrived.
+func (w *watchdog) keepWaiting() {
+	w.mu.Lock()
+	w.lastOutput = time.Now()
+	w.fired = false
+	w.mu.Unlock()
+}
+
+func (w *watchdog) run(ctx context.Context) {
+	defer close(w.done)
+	ticker := time.NewTicker(min(w.idle/4, time.Minute))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.mu.Lock()
+			quiet := time.Since(w.lastOutput)
+			act := quiet >= w.idle && !w.fired
+			if act {
+				w.fired = true
+			}
+			w.mu.Unlock()
+			if act {
+				w.act(ctx, quiet.Round(time.Second))
+			}
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// act kills the job or asks its owner what to do.
+func (w *watchdog) act(ctx context.Context, quiet time.Duration) {
+	text := fmt.Sprintf("_no output for %s from_ `%s` _— still waiting?_", quiet, w.s.publicText(w.j.Cmd))
+	var buttons []block
+	if w.s.cfg.WatchdogAction == watchdogKill {
+		w.s.jobs.stop(w.j.ID, w.j.Cmd.UserID)
+		text = fmt.Sprintf("_killed_ `%s` _after no output for %s_", w.s.publicText(w.j.Cmd), quiet)
+	} else if w.s.cfg.Interactivity {
+		buttons = append(buttons, button(actionStop, "Kill", w.j.ID, "danger"), button(actionKeepWaiting, "Keep waiting", w.j.ID, ""))
+	}
+
+	params := url.Values{"channel": {w.j.Cmd.ChannelID}, "text": {text}}
+	if len(buttons) > 0 {
+		blocks, err := json.Marshal([]block{sectionBlock(text), actionsBlock(buttons...)})
+		if err != nil {
+			return
+		}
+		params.Set("blocks", string(blocks))
+	}
+	if w.j.Cmd.ThreadTS != "" {
+		params.Set("thread_ts", w.j.Cmd.ThreadTS)
+	}
+
+	// Where output is not for the channel, neither is the question.
+	method := "chat.postMessage"
+	if !w.s.liveAllowed(w.j.Cmd) {
+		method = "chat.postEphemeral"
+		params.Set("user", w.j.Cmd.UserID)
+	}
+	var resp struct {
+		TS string `json:"ts"`
+	}
+	if err := w.s.slack.call(ctx, method, params, &resp); err != nil {
+		fmt.Fprintf(os.Stderr, "Error posting watchdog message: %v\n", err)
+		return
+	}
+	if method == "chat.postMessage" && len(buttons) > 0 {
+		w.mu.Lock()
+		w.channel, w.ts = w.j.Cmd.ChannelID, resp.TS
+		w.mu.Unlock()
+	}
+}
+
+// close stops watching. A question that was not answered is deleted,
+// since the job has finished, unless the job was stopped with its Kill
+// button, whose reply replaced the question.
+func (w *watchdog) close(ctx context.Context, stopped bool) {
+	if w == nil {
+		return
+	}
+	close(w.stop)
+	<-w.done
+
+	w.mu.Lock()
+	channel, ts, open := w.channel, w.ts, w.fired
+	w.mu.Unlock()
+	if ts == "" || !open || stopped {
+		return
+	}
+	if err := w.s.slack.call(ctx, "chat.delete", url.Values{"channel": {channel}, "ts": {ts}}, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error deleting watchdog message: %v\n", err)
+	}
+}
+
+// keepWaiting answers the watchdog's "Keep waiting" button for the user
+// who started the job and returns the message that replaces the question.
+func (s *server) keepWaiting(userID, jobID string) map[string]string {
+	j, err := s.jobs.get(jobID, userID)
+	if err == nil && j.watchdog == nil {
+		err = errJobNotFound
+	}
+	if err != nil {
+		return map[string]string{
+			"response_type":    "ephemeral",
+			"replace_original": "false",
+			"text":             fmt.Sprintf("_cannot keep waiting: %v_", err),
+		}
+	}
+	j.watchdog.keepWaiting()
+	return map[string]string{
+		"replace_original": "true",
+		"text":             fmt.Sprintf("_<@%s> is still waiting for_ `%s`", userID, s.publicText(j.Cmd)),
+	}
+}
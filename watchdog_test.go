@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchdog_AsksAboutQuietCommand(t *testing.T) {
+	f := newFakeSlack(t)
+	f.respond("chat.postMessage", map[string]interface{}{"ts": "1700000000.000500"})
+	cfg := f.config()
+	cfg.Interactivity = true
+	cfg.WatchdogIdle = 100 * time.Millisecond
+	s := newServer(cfg)
+
+	response := s.handleCommandExecution(context.Background(), slashCommand{Text: "$ sleep 0.5; echo late", UserID: "U1", ChannelID: "C1", ThreadTS: "1.1"})
+
+	if !strings.Contains(response["text"], "late") {
+		t.Errorf("Expected the command to run to completion, got %q", response["text"])
+	}
+	posts := f.callsTo("chat.postMessage")
+	if len(posts) != 1 {
+		t.Fatalf("Expected one watchdog question, got %v", posts)
+	}
+	p := posts[0].Params
+	if !strings.Contains(p.Get("text"), "no output for") || p.Get("thread_ts") != "1.1" || !strings.Contains(p.Get("blocks"), actionKeepWaiting) {
+		t.Errorf("Expected a question with Kill and Keep waiting in the thread, got %v", p)
+	}
+	if deletes := f.callsTo("chat.delete"); len(deletes) != 1 || deletes[0].Params.Get("ts") != "1700000000.000500" {
+		t.Errorf("Expected the unanswered question deleted once the command finished, got %v", deletes)
+	}
+}
+
+func TestWatchdog_Kill(t *testing.T) {
+	f := newFakeSlack(t)
+	cfg := f.config()
+	cfg.WatchdogIdle = 100 * time.Millisecond
+	cfg.WatchdogAction = watchdogKill
+	s := newServer(cfg)
+
+	start := time.Now()
+	response := s.handleCommandExecution(context.Background(), slashCommand{Text: "$ sleep 5", UserID: "U1", ChannelID: "C1"})
+
+	if time.Since(start) > 3*time.Second || !strings.Contains(response["text"], "terminated") {
+		t.Errorf("Expected the quiet command killed, got %q after %s", response["text"], time.Since(start))
+	}
+	if posts := f.callsTo("chat.postMessage"); len(posts) != 1 || !strings.Contains(posts[0].Params.Get("text"), "_killed_") {
+		t.Errorf("Expected a note saying the command was killed, got %v", posts)
+	}
+}
+
+func TestWatchdog_OutputAndOptOut(t *testing.T) {
+	f := newFakeSlack(t)
+	cfg := f.config()
+	cfg.WatchdogIdle = 150 * time.Millisecond
+	cfg.WatchdogAction = watchdogKill
+	s := newServer(cfg)
+
+	for _, text := range []string{
+		"$ for i in 1 2 3 4 5; do echo $i; sleep 0.05; done",
+		"$ --no-watchdog sleep 0.4",
+	} {
+		response := s.handleCommandExecution(context.Background(), slashCommand{Text: text, UserID: "U1", ChannelID: "C1"})
+		if !strings.Contains(response["text"], "_success") {
+			t.Errorf("%s: expected the command to finish, got %q", text, response["text"])
+		}
+	}
+	if posts := f.callsTo("chat.postMessage"); len(posts) != 0 {
+		t.Errorf("Expected no watchdog action, got %v", posts)
+	}
+}
+
+func TestKeepWaiting(t *testing.T) {
+	s := newServer(config{})
+	_, j := s.jobs.start(context.Background(), slashCommand{Text: "$ make", UserID: "U1"}, "make")
+	defer s.jobs.finish(j)
+	j.watchdog = &watchdog{fired: true}
+
+	if message := s.keepWaiting("U2", j.ID); message["replace_original"] != "false" {
+		t.Errorf("Expected only the job's owner to answer, got %v", message)
+	}
+	message := s.keepWaiting("U1", j.ID)
+	if message["replace_original"] != "true" || !strings.Contains(message["text"], "still waiting") {
+		t.Errorf("Expected the question replaced, got %v", message)
+	}
+	if j.watchdog.fired {
+		t.Error("Expected a new quiet spell to start")
+	}
+}
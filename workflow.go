@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+)
+
+// callbackWorkflowStep is the callback ID of the "Run a command" workflow
+// step, set when adding the step to the Slack app.
+const callbackWorkflowStep = "run_command"
+
+// Block and action IDs of the workflow step's configuration modal.
+const (
+	workflowCommandBlock = "command"
+	workflowChannelBlock = "channel"
+)
+
+// workflowStep holds the fields of a workflow step in interactivity
+// payloads and events.
+type workflowStep struct {
+	EditID    string `json:"workflow_step_edit_id"`
+	ExecuteID string `json:"workflow_step_execute_id"`
+	Inputs    map[string]struct {
+		Value string `json:"value"`
+	} `json:"inputs"`
+}
+
+// workflowVariable matches a workflow variable in a step's command.
+var workflowVariable = regexp.MustCompile(`\{\{[^{}]+\}\}`)
+
+// workflowScript replaces the workflow variables in a step's command with
+// the shell variables INPUT_1, INPUT_2 and so on, quoted, and returns them
+// in that order. Slack fills in the variables saved as separate inputs,
+// and their values reach the command in its environment, so that they are
+// never taken for part of the command.
+func workflowScript(command string) (string, []string) {
+	var variables []string
+	script := workflowVariable.ReplaceAllStringFunc(command, func(v string) string {
+		variables = append(variables, v)
+		return fmt.Sprintf(`"$INPUT_%d"`, len(variables))
+	})
+	return script, variables
+}
+
+// workflowOutputs are the variables the step offers to later steps.
+var workflowOutputs = []map[string]string{
+	{"name": "output", "type": "text", "label": "Command output"},
+}
+
+// editWorkflowStep opens the configuration modal of the step, filled in
+// with its current inputs.
+func (s *server) editWorkflowStep(ctx context.Context, p interactionPayload) {
+	if s.slack == nil {
+		return
+	}
+	input := block{"type": "plain_text_input", "action_id": workflowCommandBlock, "multiline": true}
+	if v := p.WorkflowStep.Inputs["command"].Value; v != "" {
+		input["initial_value"] = v
+	}
+	channel := block{"type": "conversations_select", "action_id": workflowChannelBlock}
+	if v := p.WorkflowStep.Inputs["channel"].Value; v != "" {
+		channel["initial_conversation"] = v
+	}
+
+	view, err := json.Marshal(block{
+		"type":        "workflow_step",
+		"callback_id": callbackWorkflowStep,
+		"blocks": []block{
+			{
+				"type":     "input",
+				"block_id": workflowCommandBlock,
+				"label":    plainText("Command"),
+				"hint":     plainText("Insert variables to fill in the command when the workflow runs, e.g. `ping {{host}}`."),
+				"element":  input,
+			},
+			{
+				"type":     "input",
+				"block_id": workflowChannelBlock,
+				"optional": true,
+				"label":    plainText("Channel whose profile applies"),
+				"element":  channel,
+			},
+		},
+	})
+	if err != nil {
+		return
+	}
+	if err := s.slack.call(ctx, "views.open", url.Values{"trigger_id": {p.TriggerID}, "view": {string(view)}}, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening workflow step configuration: %v\n", err)
+	}
+}
+
+// saveWorkflowStep stores the inputs entered in the configuration modal,
+// with the command as it is run and each of its variables. The user who
+// configures the step is the user it runs as.
+func (s *server) saveWorkflowStep(ctx context.Context, p interactionPayload) {
+	if s.slack == nil {
+		return
+	}
+	values := p.View.State.Values
+	command := values[workflowCommandBlock][workflowCommandBlock].Value
+	script, variables := workflowScript(command)
+	inputs := map[string]map[string]string{
+		"command":       {"value": command},
+		"script":        {"value": script},
+		"channel":       {"value": values[workflowChannelBlock][workflowChannelBlock].SelectedConversation},
+		"configured_by": {"value": p.User.ID},
+	}
+	for i, v := range variables {
+		inputs[fmt.Sprintf("input_%d", i+1)] = map[string]string{"value": v}
+	}
+	inputsJSON, err := json.Marshal(inputs)
+	if err != nil {
+		return
+	}
+	outputsJSON, err := json.Marshal(workflowOutputs)
+	if err != nil {
+		return
+	}
+	params := url.Values{
+		"workflow_step_edit_id": {p.WorkflowStep.EditID},
+		"inputs":                {string(inputsJSON)},
+		"outputs":               {string(outputsJSON)},
+	}
+	if err := s.slack.call(ctx, "workflows.updateStep", params, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving workflow step: %v\n", err)
+	}
+}
+
+// executeWorkflowStep runs the command of a workflow step, with the values
+// Slack filled in for its variables in its environment, and reports the
+// result as the step's output. Commands that are refused fail the step.
+func (s *server) executeWorkflowStep(ctx context.Context, step workflowStep, teamID string) {
+	script, saved := step.Inputs["script"]
+	cmd := slashCommand{
+		Text:      script.Value,
+		UserID:    step.Inputs["configured_by"].Value,
+		ChannelID: step.Inputs["channel"].Value,
+		TeamID:    teamID,
+	}
+	for i := 1; ; i++ {
+		v, ok := step.Inputs[fmt.Sprintf("input_%d", i)]
+		if !ok {
+			break
+		}
+		cmd.Inputs = append(cmd.Inputs, fmt.Sprintf("INPUT_%d=%s", i, v.Value))
+	}
+	var message map[string]string
+	switch {
+	case step.Inputs["command"].Value == "":
+		message = ephemeral("_no command configured_")
+	case !saved:
+		// Steps saved before variables were passed in the environment
+		// have them filled into the command itself.
+		message = ephemeral("_step was saved by an older version; edit and save it again_")
+	case cmd.UserID == "":
+		message = ephemeral("_step has no owner; edit and save it again_")
+	default:
+		message = s.handleCommandExecution(ctx, cmd)
+	}
+
+	method := "workflows.stepCompleted"
+	params := url.Values{"workflow_step_execute_id": {step.ExecuteID}}
+	if message["response_type"] == "in_channel" {
+		outputs, _ := json.Marshal(map[string]string{"output": message["text"]})
+		params.Set("outputs", string(outputs))
+	} else {
+		method = "workflows.stepFailed"
+		failure, _ := json.Marshal(map[string]string{"message": message["text"]})
+		params.Set("error", string(failure))
+	}
+	if err := s.slack.call(ctx, method, params, nil); err != nil {
+		fmt.Fprintf(os.Stderr, "Error completing workflow step: %v\n", err)
+	}
+}
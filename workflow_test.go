@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// postPayload posts an interactivity payload.
+func postPayload(t *testing.T, s *server, payload map[string]interface{}) {
+	t.Helper()
+
+	data, _ := json.Marshal(payload)
+	req := httptest.NewRequest("POST", "/slack/interactive", strings.NewReader(url.Values{"payload": {string(data)}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.routes().ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestWorkflowStep_ConfigureAndSave(t *testing.T) {
+	f := newFakeSlack(t)
+	s := newServer(f.config())
+
+	postPayload(t, s, map[string]interface{}{
+		"type":          "workflow_step_edit",
+		"callback_id":   callbackWorkflowStep,
+		"trigger_id":    "T123",
+		"workflow_step": map[string]interface{}{"inputs": map[string]interface{}{"command": map[string]string{"value": "uptime"}}},
+	})
+	calls := f.callsTo("views.open")
+	if len(calls) != 1 || !strings.Contains(calls[0].Params.Get("view"), `"initial_value":"uptime"`) {
+		t.Fatalf("Expected the configuration modal with the current command, got %v", calls)
+	}
+
+	postPayload(t, s, map[string]interface{}{
+		"type":          "view_submission",
+		"user":          map[string]string{"id": "U1"},
+		"workflow_step": map[string]string{"workflow_step_edit_id": "E1"},
+		"view": map[string]interface{}{
+			"type":        "workflow_step",
+			"callback_id": callbackWorkflowStep,
+			"state": map[string]interface{}{"values": map[string]interface{}{
+				"command": map[string]interface{}{"command": map[string]string{"value": "ping -c 1 {{host}}"}},
+				"channel": map[string]interface{}{"channel": map[string]string{"selected_conversation": "C1"}},
+			}},
+		},
+	})
+	calls = f.callsTo("workflows.updateStep")
+	if len(calls) != 1 || calls[0].Params.Get("workflow_step_edit_id") != "E1" {
+		t.Fatalf("Expected the step to be saved, got %v", calls)
+	}
+	var inputs map[string]map[string]string
+	json.Unmarshal([]byte(calls[0].Params.Get("inputs")), &inputs)
+	if inputs["command"]["value"] != "ping -c 1 {{host}}" || inputs["channel"]["value"] != "C1" || inputs["configured_by"]["value"] != "U1" {
+		t.Errorf("Unexpected inputs %v", inputs)
+	}
+	if inputs["script"]["value"] != `ping -c 1 "$INPUT_1"` || inputs["input_1"]["value"] != "{{host}}" {
+		t.Errorf("Expected the variable saved as an input of its own, got %v", inputs)
+	}
+}
+
+func TestWorkflowStep_Execute(t *testing.T) {
+	f := newFakeSlack(t)
+	cfg := f.config()
+	cfg.DangerousAction = dangerousBlock
+	cfg.ClassifierRules = dangerRules([]*regexp.Regexp{regexp.MustCompile(`^rm `)})
+	s := newServer(cfg)
+
+	execute := func(id, command, input string) {
+		script, _ := workflowScript(command)
+		inputs, _ := json.Marshal(map[string]map[string]string{
+			"command":       {"value": command},
+			"script":        {"value": script},
+			"input_1":       {"value": input},
+			"configured_by": {"value": "U1"},
+		})
+		postEvent(t, s, `{"type": "event_callback", "event_id": "Ev`+id+`", "event": {"type": "workflow_step_execute", "callback_id": "run_command",
+			"workflow_step": {"workflow_step_execute_id": "`+id+`", "inputs": `+string(inputs)+`}}}`)
+	}
+
+	execute("X1", "echo from {{source}}", "workflow; rm -rf /tmp/x")
+	calls := waitForCalls(t, f, "workflows.stepCompleted", 1)
+	if len(calls) != 1 || calls[0].Params.Get("workflow_step_execute_id") != "X1" || !strings.Contains(calls[0].Params.Get("outputs"), "from workflow; rm -rf /tmp/x") {
+		t.Fatalf("Expected the step to complete with the variable taken as a value, got %v", calls)
+	}
+
+	execute("X2", "rm -rf {{path}}", "/tmp/x")
+	calls = waitForCalls(t, f, "workflows.stepFailed", 1)
+	if len(calls) != 1 || !strings.Contains(calls[0].Params.Get("error"), "blocked") {
+		t.Errorf("Expected the step to fail for a blocked command, got %v", calls)
+	}
+
+	postEvent(t, s, `{"type": "event_callback", "event_id": "EvX3", "event": {"type": "workflow_step_execute", "callback_id": "run_command",
+		"workflow_step": {"workflow_step_execute_id": "X3", "inputs": {"command": {"value": "echo filled in"}, "configured_by": {"value": "U1"}}}}}`)
+	calls = waitForCalls(t, f, "workflows.stepFailed", 2)
+	if len(calls) != 2 || !strings.Contains(calls[1].Params.Get("error"), "edit and save it again") {
+		t.Errorf("Expected a step saved by an older version to fail, got %v", calls)
+	}
+}